@@ -0,0 +1,179 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package embed runs a netsy server in-process, similar to etcd's embed
+// package. It is intended for integration tests of projects which use the
+// subset of the etcd API used by Kubernetes (e.g. operators, kine users), so
+// the server runs without S3 and serves the client API without TLS.
+//
+// Servers in the same process share netsy's global configuration, which
+// Start sets for in-process use (e.g. S3 is disabled).
+package embed
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/hooks"
+	"github.com/nadrama-com/netsy/internal/clientapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+// defaultInstanceID is the leader ID recorded against records when no
+// instance ID has been configured
+const defaultInstanceID = "netsy-embed"
+
+// configMutex serializes changes to the global configuration
+var configMutex sync.Mutex
+
+// Config configures an embedded server. The zero value is valid.
+type Config struct {
+	// DataDir is the directory for the local database. If empty, a temporary
+	// directory is created, which is removed by Close.
+	DataDir string
+	// ListenAddr is the address of the client API. If empty, a random port
+	// on 127.0.0.1 is used.
+	ListenAddr string
+	// EtcdVersion is the etcd minor version to emulate (3.4 or 3.5). If
+	// empty, the configured default is used.
+	EtcdVersion string
+	// Logger receives server logs. If nil, logs are discarded.
+	Logger log.Logger
+	// Hooks are called on events such as commits (see package hooks), other
+	// than snapshots, as embedded servers do not use S3. If nil, no hooks
+	// are called.
+	Hooks *hooks.Hooks
+}
+
+// Server is a running embedded netsy server
+type Server struct {
+	listener     net.Listener
+	grpcServer   *grpc.Server
+	clientServer *clientapi.ClientAPIServer
+	tempDir      string
+	serveErrCh   chan error
+	closeOnce    sync.Once
+}
+
+// Start starts an embedded server. Close must be called to stop it.
+func Start(cfg Config) (s *Server, err error) {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	c, err := config.Init(logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize config: %w", err)
+	}
+	configMutex.Lock()
+	viper.Set("s3_enabled", false)
+	if viper.GetString("instance_id") == "" {
+		viper.Set("instance_id", defaultInstanceID)
+	}
+	if cfg.EtcdVersion != "" {
+		viper.Set("etcd_version", cfg.EtcdVersion)
+	}
+	configMutex.Unlock()
+
+	s = &Server{serveErrCh: make(chan error, 1)}
+	defer func() {
+		if err != nil {
+			s.cleanup()
+		}
+	}()
+
+	// create data directory
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		s.tempDir, err = os.MkdirTemp("", "netsy-embed-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary data dir: %w", err)
+		}
+		dataDir = s.tempDir
+	}
+
+	// open database
+	db := localdb.New(filepath.Join(dataDir, "db.sqlite3"), int(c.DBMaxReadConns()))
+	if err = db.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// create client API server
+	s.grpcServer = grpc.NewServer()
+	s.clientServer, err = clientapi.NewServer(logger, c, db, s.grpcServer, nil, nil, nil, nil)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create client API server: %w", err)
+	}
+	s.clientServer.SetHooks(cfg.Hooks)
+	// an embedded server is the only leader of its database
+	s.clientServer.AdvanceLeaderEpoch(1)
+	if err = s.clientServer.SetReady(); err != nil {
+		return nil, err
+	}
+
+	// listen and serve
+	listenAddr := cfg.ListenAddr
+	if listenAddr == "" {
+		listenAddr = "127.0.0.1:0"
+	}
+	s.listener, err = net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+	go func() {
+		s.serveErrCh <- s.grpcServer.Serve(s.listener)
+	}()
+
+	return s, nil
+}
+
+// Endpoint returns the client API address, e.g. for clientv3.Config
+func (s *Server) Endpoint() string {
+	return s.listener.Addr().String()
+}
+
+// Endpoints returns the client API addresses, e.g. for clientv3.Config
+func (s *Server) Endpoints() []string {
+	return []string{s.Endpoint()}
+}
+
+// Err returns a channel which receives an error if the server stops serving
+func (s *Server) Err() <-chan error {
+	return s.serveErrCh
+}
+
+// Close stops the server, closing open client connections, and removes the
+// data directory if it was created by Start
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.cleanup()
+	})
+	return err
+}
+
+// cleanup releases everything which has been started so far
+func (s *Server) cleanup() error {
+	if s.grpcServer != nil {
+		// Stop rather than GracefulStop, so open watches don't block Close
+		s.grpcServer.Stop()
+	}
+	if s.clientServer != nil {
+		s.clientServer.Close()
+	}
+	if s.tempDir != "" {
+		if err := os.RemoveAll(s.tempDir); err != nil {
+			return fmt.Errorf("failed to remove temporary data dir: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package embed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/hooks"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestServerPutGet(t *testing.T) {
+	configtest.Restore(t, "s3_enabled", "instance_id", "etcd_version")
+	h := hooks.New()
+	commits := make(chan hooks.Commit, 1)
+	h.OnCommit(func(c hooks.Commit) {
+		commits <- c
+	})
+	var leaderChanges []hooks.LeaderChange
+	h.OnLeaderChange(func(l hooks.LeaderChange) {
+		leaderChanges = append(leaderChanges, l)
+	})
+	s, err := Start(Config{Hooks: h})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer s.Close()
+	if len(leaderChanges) != 1 || leaderChanges[0].Epoch != 1 {
+		t.Fatalf("expected the server to start leading with epoch 1, got %v", leaderChanges)
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   s.Endpoints(),
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("clientv3.New: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// create the key the way Kubernetes does
+	txnResp, err := client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision("/test/key"), "=", 0)).
+		Then(clientv3.OpPut("/test/key", "value")).
+		Commit()
+	if err != nil {
+		t.Fatalf("Txn: %v", err)
+	}
+	if !txnResp.Succeeded {
+		t.Fatalf("expected create Txn to succeed")
+	}
+	select {
+	case c := <-commits:
+		if string(c.Key) != "/test/key" || string(c.Value) != "value" || !c.Created || c.Revision != txnResp.Header.Revision {
+			t.Fatalf("unexpected commit hook: %+v", c)
+		}
+	default:
+		t.Fatalf("expected commit hook to be called")
+	}
+	resp, err := client.Get(ctx, "/test/key")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "value" {
+		t.Fatalf("unexpected Get response: %+v", resp.Kvs)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package hooks lets embedders and extensions (e.g. custom backups or
+// notifications) register callbacks which netsy calls on internal events,
+// without changing the code which fires them. Callbacks are registered with
+// a Hooks, which is passed to the server (see embed.Config).
+//
+// Callbacks are called synchronously on the goroutine of the event, in the
+// order they were registered, so must not block for long: a commit callback
+// delays the response to the write which committed the record. Callbacks
+// which do slow work (e.g. network calls) should hand events off to their
+// own goroutine.
+package hooks
+
+import (
+	"slices"
+	"sync"
+)
+
+// Commit is a record committed by a write, including the deletion of a key
+type Commit struct {
+	// Revision is the revision the record was committed at
+	Revision int64
+	Key      []byte
+	// Value is the value written, or nil if the key was deleted
+	Value          []byte
+	CreateRevision int64
+	Version        int64
+	Lease          int64
+	// Created is set if the write created the key
+	Created bool
+	// Deleted is set if the write deleted the key
+	Deleted bool
+}
+
+// Snapshot is a snapshot uploaded to S3
+type Snapshot struct {
+	// Revision is the latest revision of the records in the snapshot
+	Revision int64
+	// Records is the number of records in the snapshot
+	Records int
+	// Parts is the number of files the snapshot was split into
+	Parts int
+}
+
+// LeaderChange is a change to a new leader term
+type LeaderChange struct {
+	// Epoch is the new leader term's epoch, and PreviousEpoch the epoch it
+	// replaced
+	Epoch         int64
+	PreviousEpoch int64
+}
+
+// Hooks holds the callbacks registered for each event. A nil *Hooks fires
+// no callbacks, so servers need not check whether hooks are configured.
+type Hooks struct {
+	commit       callbacks[Commit]
+	snapshot     callbacks[Snapshot]
+	leaderChange callbacks[LeaderChange]
+}
+
+// New returns a Hooks with no callbacks registered
+func New() *Hooks {
+	return &Hooks{}
+}
+
+// OnCommit registers fn to be called with each record once it is committed.
+// Concurrent writes may call fn concurrently, so not necessarily in
+// revision order. It returns a function which unregisters fn.
+func (h *Hooks) OnCommit(fn func(Commit)) (unregister func()) {
+	return h.commit.add(fn)
+}
+
+// OnSnapshot registers fn to be called once each snapshot is uploaded to
+// S3, so is never called by servers without S3 (e.g. embedded servers). It
+// returns a function which unregisters fn.
+func (h *Hooks) OnSnapshot(fn func(Snapshot)) (unregister func()) {
+	return h.snapshot.add(fn)
+}
+
+// OnLeaderChange registers fn to be called once the server moves to a new
+// leader term, which it does as it starts, once its local database has been
+// backfilled. It returns a function which unregisters fn.
+func (h *Hooks) OnLeaderChange(fn func(LeaderChange)) (unregister func()) {
+	return h.leaderChange.add(fn)
+}
+
+// WantsCommit returns true if any commit callbacks are registered, so that
+// servers can skip building a Commit (e.g. decoding its value) otherwise
+func (h *Hooks) WantsCommit() bool {
+	return h != nil && h.commit.registered()
+}
+
+// FireCommit calls the commit callbacks with c
+func (h *Hooks) FireCommit(c Commit) {
+	if h != nil {
+		h.commit.fire(c)
+	}
+}
+
+// FireSnapshot calls the snapshot callbacks with s
+func (h *Hooks) FireSnapshot(s Snapshot) {
+	if h != nil {
+		h.snapshot.fire(s)
+	}
+}
+
+// FireLeaderChange calls the leader change callbacks with l
+func (h *Hooks) FireLeaderChange(l LeaderChange) {
+	if h != nil {
+		h.leaderChange.fire(l)
+	}
+}
+
+// callbacks are the callbacks registered for events of type E, in the order
+// they were registered
+type callbacks[E any] struct {
+	mu     sync.RWMutex
+	nextID int
+	fns    []callback[E]
+}
+
+type callback[E any] struct {
+	id int
+	fn func(E)
+}
+
+// add registers fn, returning a function which unregisters it
+func (c *callbacks[E]) add(fn func(E)) (unregister func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	id := c.nextID
+	c.fns = append(c.fns, callback[E]{id: id, fn: fn})
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// fns is replaced rather than modified, as fire calls a copy
+		c.fns = slices.DeleteFunc(slices.Clone(c.fns), func(cb callback[E]) bool {
+			return cb.id == id
+		})
+	}
+}
+
+// registered returns true if any callbacks are registered
+func (c *callbacks[E]) registered() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.fns) > 0
+}
+
+// fire calls each callback with event. Callbacks are called without the
+// lock held, so that they may register or unregister callbacks.
+func (c *callbacks[E]) fire(event E) {
+	c.mu.RLock()
+	fns := c.fns
+	c.mu.RUnlock()
+	for _, cb := range fns {
+		cb.fn(event)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package hooks
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	h := New()
+	if h.WantsCommit() {
+		t.Fatalf("expected no commit callbacks")
+	}
+	var called []string
+	unregisterFirst := h.OnCommit(func(c Commit) {
+		called = append(called, fmt.Sprintf("first %d", c.Revision))
+	})
+	h.OnCommit(func(c Commit) {
+		called = append(called, fmt.Sprintf("second %d", c.Revision))
+	})
+	h.OnLeaderChange(func(l LeaderChange) {
+		called = append(called, fmt.Sprintf("leader %d", l.Epoch))
+	})
+	if !h.WantsCommit() {
+		t.Fatalf("expected commit callbacks")
+	}
+
+	// callbacks are called in the order they were registered, until they
+	// are unregistered
+	h.FireCommit(Commit{Revision: 1})
+	unregisterFirst()
+	unregisterFirst()
+	h.FireCommit(Commit{Revision: 2})
+	h.FireLeaderChange(LeaderChange{Epoch: 3})
+	h.FireSnapshot(Snapshot{Revision: 4})
+	expected := []string{"first 1", "second 1", "second 2", "leader 3"}
+	if fmt.Sprint(called) != fmt.Sprint(expected) {
+		t.Fatalf("called %q, want %q", called, expected)
+	}
+
+	// a nil Hooks fires nothing
+	var none *Hooks
+	if none.WantsCommit() {
+		t.Fatalf("expected nil hooks to have no commit callbacks")
+	}
+	none.FireCommit(Commit{})
+	none.FireSnapshot(Snapshot{})
+	none.FireLeaderChange(LeaderChange{})
+}
@@ -0,0 +1,236 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package audit records client requests for compliance. Handlers call an
+// Auditor once each request completes, and built-in Auditors write an Entry
+// per request to the log or to a file. Other integrations implement Auditor
+// (and are added in New) without changing the handlers.
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/keys"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Auditor is called by the client API handlers once each request completes.
+// Calls are made on the request's goroutine, so must not block for long.
+type Auditor interface {
+	// OnTxn is called with the response or error of each Txn request
+	OnTxn(ctx context.Context, r *pb.TxnRequest, resp *pb.TxnResponse, err error)
+	// OnRange is called with the response or error of each Range request
+	OnRange(ctx context.Context, r *pb.RangeRequest, resp *pb.RangeResponse, err error)
+	// OnDeleteRange is called with the response or error of each
+	// DeleteRange request
+	OnDeleteRange(ctx context.Context, r *pb.DeleteRangeRequest, resp *pb.DeleteRangeResponse, err error)
+	// OnWatchCreate is called when a watcher requests a watch is created
+	OnWatchCreate(ctx context.Context, watcherID int64, r *pb.WatchCreateRequest)
+}
+
+// Entry is the record of a request written by the built-in Auditors
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"` // txn, range, delete_range or watch_create
+	// Peer is the client's address, and Identity the common name of its
+	// TLS client certificate
+	Peer     string `json:"peer,omitempty"`
+	Identity string `json:"identity,omitempty"`
+	// Internal is set for requests made by netsy itself rather than the
+	// client, e.g. lease_expired (see commonapi.WithInternalCaller)
+	Internal string `json:"internal,omitempty"`
+	// Key and RangeEnd are escaped (see keys.String)
+	Key      string `json:"key"`
+	RangeEnd string `json:"range_end,omitempty"`
+	// Ops are the operations a Txn executed, i.e. its success or failure
+	// operations (put, delete or range)
+	Ops       []string `json:"ops,omitempty"`
+	Succeeded bool     `json:"succeeded,omitempty"`
+	Revision  int64    `json:"revision,omitempty"`
+	Count     int64    `json:"count,omitempty"`
+	WatcherID int64    `json:"watcher_id,omitempty"`
+	// Code is the gRPC status code of the response, OK if it succeeded
+	Code  string `json:"code"`
+	Error string `json:"error,omitempty"`
+}
+
+// Sinks for New
+const (
+	SinkLog  = "log"
+	SinkFile = "file"
+)
+
+// New returns the Auditor for the configured audit sinks, which is a no-op
+// if none are configured. The returned io.Closer must be closed once
+// requests are no longer audited.
+func New(logger log.Logger, conf *config.Config) (Auditor, io.Closer, error) {
+	var auditors Multi
+	for _, sink := range strings.Split(conf.AuditSinks(), ",") {
+		sink = strings.TrimSpace(sink)
+		switch sink {
+		case "":
+		case SinkLog:
+			auditors = append(auditors, NewLogAuditor(logger))
+		case SinkFile:
+			fileAuditor, err := NewFileAuditor(conf.AuditFile())
+			if err != nil {
+				auditors.Close()
+				return nil, nil, err
+			}
+			auditors = append(auditors, fileAuditor)
+		default:
+			auditors.Close()
+			return nil, nil, fmt.Errorf("unknown audit sink %q, expected %s or %s", sink, SinkLog, SinkFile)
+		}
+	}
+	if len(auditors) == 0 {
+		return Nop{}, Nop{}, nil
+	}
+	return auditors, auditors, nil
+}
+
+// Nop is an Auditor which does nothing
+type Nop struct{}
+
+func (Nop) OnTxn(context.Context, *pb.TxnRequest, *pb.TxnResponse, error)                         {}
+func (Nop) OnRange(context.Context, *pb.RangeRequest, *pb.RangeResponse, error)                   {}
+func (Nop) OnDeleteRange(context.Context, *pb.DeleteRangeRequest, *pb.DeleteRangeResponse, error) {}
+func (Nop) OnWatchCreate(context.Context, int64, *pb.WatchCreateRequest)                          {}
+func (Nop) Close() error                                                                          { return nil }
+
+// Multi calls each of its Auditors in turn
+type Multi []Auditor
+
+func (m Multi) OnTxn(ctx context.Context, r *pb.TxnRequest, resp *pb.TxnResponse, err error) {
+	for _, a := range m {
+		a.OnTxn(ctx, r, resp, err)
+	}
+}
+
+func (m Multi) OnRange(ctx context.Context, r *pb.RangeRequest, resp *pb.RangeResponse, err error) {
+	for _, a := range m {
+		a.OnRange(ctx, r, resp, err)
+	}
+}
+
+func (m Multi) OnDeleteRange(ctx context.Context, r *pb.DeleteRangeRequest, resp *pb.DeleteRangeResponse, err error) {
+	for _, a := range m {
+		a.OnDeleteRange(ctx, r, resp, err)
+	}
+}
+
+func (m Multi) OnWatchCreate(ctx context.Context, watcherID int64, r *pb.WatchCreateRequest) {
+	for _, a := range m {
+		a.OnWatchCreate(ctx, watcherID, r)
+	}
+}
+
+// Close closes each Auditor which is an io.Closer
+func (m Multi) Close() error {
+	var errs []error
+	for _, a := range m {
+		if closer, ok := a.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TxnEntry returns the Entry for a Txn request
+func TxnEntry(ctx context.Context, r *pb.TxnRequest, resp *pb.TxnResponse, err error) Entry {
+	entry := newEntry(ctx, "txn", err)
+	ops := r.Success
+	if len(r.Compare) > 0 {
+		entry.Key = keys.String(r.Compare[0].Key)
+	}
+	if resp != nil {
+		entry.Succeeded = resp.Succeeded
+		if !resp.Succeeded {
+			ops = r.Failure
+		}
+		if resp.Header != nil {
+			entry.Revision = resp.Header.Revision
+		}
+	}
+	for _, op := range ops {
+		switch {
+		case op.GetRequestPut() != nil:
+			entry.Ops = append(entry.Ops, "put")
+		case op.GetRequestDeleteRange() != nil:
+			entry.Ops = append(entry.Ops, "delete")
+		case op.GetRequestRange() != nil:
+			entry.Ops = append(entry.Ops, "range")
+		case op.GetRequestTxn() != nil:
+			entry.Ops = append(entry.Ops, "txn")
+		}
+	}
+	return entry
+}
+
+// RangeEntry returns the Entry for a Range request
+func RangeEntry(ctx context.Context, r *pb.RangeRequest, resp *pb.RangeResponse, err error) Entry {
+	entry := newEntry(ctx, "range", err)
+	entry.Key = keys.String(r.Key)
+	entry.RangeEnd = keys.String(r.RangeEnd)
+	if resp != nil {
+		entry.Count = resp.Count
+		if resp.Header != nil {
+			entry.Revision = resp.Header.Revision
+		}
+	}
+	return entry
+}
+
+// DeleteRangeEntry returns the Entry for a DeleteRange request, whose count
+// is the number of keys deleted
+func DeleteRangeEntry(ctx context.Context, r *pb.DeleteRangeRequest, resp *pb.DeleteRangeResponse, err error) Entry {
+	entry := newEntry(ctx, "delete_range", err)
+	entry.Key = keys.String(r.Key)
+	entry.RangeEnd = keys.String(r.RangeEnd)
+	if resp != nil {
+		entry.Count = resp.Deleted
+		if resp.Header != nil {
+			entry.Revision = resp.Header.Revision
+		}
+	}
+	return entry
+}
+
+// WatchCreateEntry returns the Entry for a watch create request
+func WatchCreateEntry(ctx context.Context, watcherID int64, r *pb.WatchCreateRequest) Entry {
+	entry := newEntry(ctx, "watch_create", nil)
+	entry.Key = keys.String(r.Key)
+	entry.RangeEnd = keys.String(r.RangeEnd)
+	entry.Revision = r.StartRevision
+	entry.WatcherID = watcherID
+	return entry
+}
+
+// newEntry returns an Entry for a request from the client in ctx, which
+// returned err
+func newEntry(ctx context.Context, method string, err error) Entry {
+	entry := Entry{
+		Time:   time.Now().UTC(),
+		Method: method,
+		Code:   status.Code(err).String(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		entry.Peer = p.Addr.String()
+	}
+	entry.Identity = commonapi.ClientIdentity(ctx)
+	entry.Internal = commonapi.InternalCaller(ctx)
+	return entry
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestFileAuditor(t *testing.T) {
+	path := t.TempDir() + "/audit.jsonl"
+	configtest.Set(t, map[string]any{"audit_sinks": "log, file", "audit_file": path})
+	auditor, closer, err := New(log.NewNopLogger(), &config.Config{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+	txn := &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: []byte("/a"), Target: pb.Compare_MOD, TargetUnion: &pb.Compare_ModRevision{ModRevision: 2}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("/a")}}}},
+		Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte("/a")}}}},
+	}
+	auditor.OnTxn(ctx, txn, &pb.TxnResponse{Header: &pb.ResponseHeader{Revision: 3}, Succeeded: true}, nil)
+	auditor.OnTxn(commonapi.WithInternalCaller(ctx, "lease_expired"), txn, &pb.TxnResponse{Header: &pb.ResponseHeader{Revision: 4}}, nil)
+	auditor.OnRange(ctx, &pb.RangeRequest{Key: []byte("/a"), RangeEnd: []byte("/b")}, nil, status.Error(codes.Unavailable, "not ready"))
+	auditor.OnWatchCreate(ctx, 7, &pb.WatchCreateRequest{Key: []byte("/\x00")})
+	if err = closer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// entries after the auditor is closed are dropped
+	auditor.OnRange(ctx, &pb.RangeRequest{Key: []byte("/a")}, nil, nil)
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Unmarshal %s: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+	for i, expected := range []Entry{
+		{Method: "txn", Key: "/a", Ops: []string{"put"}, Succeeded: true, Revision: 3, Code: "OK"},
+		{Method: "txn", Key: "/a", Ops: []string{"range"}, Revision: 4, Code: "OK", Internal: "lease_expired"},
+		{Method: "range", Key: "/a", RangeEnd: "/b", Code: "Unavailable", Error: "rpc error: code = Unavailable desc = not ready"},
+		{Method: "watch_create", Key: `/\x00`, WatcherID: 7, Code: "OK"},
+	} {
+		entry := entries[i]
+		if entry.Peer != "10.0.0.1:1234" {
+			t.Errorf("entry %d: expected peer 10.0.0.1:1234, got %q", i, entry.Peer)
+		}
+		if entry.Method != expected.Method || entry.Key != expected.Key || entry.RangeEnd != expected.RangeEnd ||
+			!slices.Equal(entry.Ops, expected.Ops) || entry.Succeeded != expected.Succeeded || entry.Revision != expected.Revision ||
+			entry.WatcherID != expected.WatcherID || entry.Code != expected.Code || entry.Error != expected.Error ||
+			entry.Internal != expected.Internal {
+			t.Errorf("entry %d: expected %+v, got %+v", i, expected, entry)
+		}
+	}
+}
+
+func TestFileAuditorWriteError(t *testing.T) {
+	auditor, err := NewFileAuditor(t.TempDir() + "/audit.jsonl")
+	if err != nil {
+		t.Fatalf("NewFileAuditor: %v", err)
+	}
+	defer auditor.Close()
+	// entries which fail to be written are counted
+	auditor.file.Close()
+	dropped := testutil.ToFloat64(metrics.AuditEntriesDropped.WithLabelValues(SinkFile))
+	auditor.OnRange(context.Background(), &pb.RangeRequest{Key: []byte("/a")}, nil, nil)
+	if count := testutil.ToFloat64(metrics.AuditEntriesDropped.WithLabelValues(SinkFile)) - dropped; count != 1 {
+		t.Errorf("expected 1 dropped entry, got %v", count)
+	}
+}
+
+func TestNewUnknownSink(t *testing.T) {
+	configtest.Set(t, map[string]any{"audit_sinks": "syslog"})
+	if _, _, err := New(log.NewNopLogger(), &config.Config{}); err == nil {
+		t.Fatalf("expected an error for an unknown sink")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// LogAuditor writes an Entry per request to the log, at info level
+type LogAuditor struct {
+	logger log.Logger
+}
+
+// NewLogAuditor returns an Auditor which logs requests
+func NewLogAuditor(logger log.Logger) *LogAuditor {
+	return &LogAuditor{logger: log.With(logger, "msg", "audit")}
+}
+
+func (a *LogAuditor) OnTxn(ctx context.Context, r *pb.TxnRequest, resp *pb.TxnResponse, err error) {
+	a.log(TxnEntry(ctx, r, resp, err))
+}
+
+func (a *LogAuditor) OnRange(ctx context.Context, r *pb.RangeRequest, resp *pb.RangeResponse, err error) {
+	a.log(RangeEntry(ctx, r, resp, err))
+}
+
+func (a *LogAuditor) OnDeleteRange(ctx context.Context, r *pb.DeleteRangeRequest, resp *pb.DeleteRangeResponse, err error) {
+	a.log(DeleteRangeEntry(ctx, r, resp, err))
+}
+
+func (a *LogAuditor) OnWatchCreate(ctx context.Context, watcherID int64, r *pb.WatchCreateRequest) {
+	a.log(WatchCreateEntry(ctx, watcherID, r))
+}
+
+// log logs entry, omitting empty fields
+func (a *LogAuditor) log(entry Entry) {
+	keyvals := []any{"method", entry.Method, "key", entry.Key}
+	for _, field := range []struct {
+		key   string
+		value any
+		empty bool
+	}{
+		{"range_end", entry.RangeEnd, entry.RangeEnd == ""},
+		{"peer", entry.Peer, entry.Peer == ""},
+		{"identity", entry.Identity, entry.Identity == ""},
+		{"internal", entry.Internal, entry.Internal == ""},
+		{"ops", strings.Join(entry.Ops, ","), len(entry.Ops) == 0},
+		{"succeeded", entry.Succeeded, entry.Method != "txn"},
+		{"revision", entry.Revision, entry.Revision == 0},
+		{"count", entry.Count, entry.Method != "range"},
+		{"watcher", entry.WatcherID, entry.WatcherID == 0},
+		{"code", entry.Code, false},
+		{"error", entry.Error, entry.Error == ""},
+	} {
+		if !field.empty {
+			keyvals = append(keyvals, field.key, field.value)
+		}
+	}
+	level.Info(a.logger).Log(keyvals...)
+}
+
+// FileAuditor appends an Entry per request to a file, as a line of JSON
+type FileAuditor struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditor returns an Auditor which appends requests to the file at
+// path, creating it if needed
+func NewFileAuditor(path string) (*FileAuditor, error) {
+	if path == "" {
+		return nil, fmt.Errorf("audit file path is required for the %s audit sink", SinkFile)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &FileAuditor{file: file}, nil
+}
+
+func (a *FileAuditor) OnTxn(ctx context.Context, r *pb.TxnRequest, resp *pb.TxnResponse, err error) {
+	a.write(TxnEntry(ctx, r, resp, err))
+}
+
+func (a *FileAuditor) OnRange(ctx context.Context, r *pb.RangeRequest, resp *pb.RangeResponse, err error) {
+	a.write(RangeEntry(ctx, r, resp, err))
+}
+
+func (a *FileAuditor) OnDeleteRange(ctx context.Context, r *pb.DeleteRangeRequest, resp *pb.DeleteRangeResponse, err error) {
+	a.write(DeleteRangeEntry(ctx, r, resp, err))
+}
+
+func (a *FileAuditor) OnWatchCreate(ctx context.Context, watcherID int64, r *pb.WatchCreateRequest) {
+	a.write(WatchCreateEntry(ctx, watcherID, r))
+}
+
+// write appends entry to the file. Entries which fail to be written are
+// dropped and counted, as a request must not fail because it could not be
+// audited.
+func (a *FileAuditor) write(entry Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		metrics.AuditEntriesDropped.WithLabelValues(SinkFile).Inc()
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return
+	}
+	if _, err = a.file.Write(append(line, '\n')); err != nil {
+		metrics.AuditEntriesDropped.WithLabelValues(SinkFile).Inc()
+	}
+}
+
+// Close closes the file, after which entries are dropped
+func (a *FileAuditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
@@ -7,6 +7,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/go-kit/log"
@@ -14,8 +15,11 @@ import (
 
 	"github.com/nadrama-com/netsy/internal/config"
 	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/lease"
 	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/progress"
 	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/replication"
 	"github.com/nadrama-com/netsy/internal/s3client"
 )
 
@@ -24,61 +28,137 @@ import (
 // If the latest revision = 0, it will first check for a snapshot and download that
 // if it exists.
 // After that, it will iterate on finding any chunks, and insert each of those.
-func Backfill(logger log.Logger, db localdb.Database, cfg *config.Config, latestRevision int64, latestSnapshotInfo *s3client.LatestSnapshotInfo, s3Client *s3client.S3Client) error {
+//
+// It returns the leader epoch this instance leads with (see
+// clientapi.AdvanceLeaderEpoch), which is newer than the leader epoch of
+// every file imported, or of the latest chunk if none were imported, so that
+// backfills can detect leaders which wrote concurrently (see
+// lineage.checkEpoch). If backfill is skipped, the first epoch is returned.
+func Backfill(logger log.Logger, db localdb.Database, cfg *config.Config, latestRevision int64, latestSnapshotInfo *s3client.LatestSnapshotInfo, s3Client *s3client.S3Client) (leaderEpoch int64, err error) {
 	// If S3 is not enabled, skip backfill
 	if !cfg.S3Enabled() {
 		level.Info(logger).Log("msg", "S3 not enabled, skipping backfill")
-		return nil
+		return 1, nil
+	}
+
+	// Trust the local database, e.g. when S3 cannot be listed, in which case
+	// it is checked for missing revisions later (see ReconcileSkippedBackfill)
+	if cfg.SkipBackfill() {
+		level.Warn(logger).Log("msg", "skipping backfill as configured, trusting the local database, which may be missing revisions written to S3 by other instances", "revision", latestRevision)
+		return 1, nil
 	}
 
 	ctx := context.Background()
-	var err error
+
+	// Track progress, with totals added as files are found and read
+	tracker := progress.Start(logger, "backfill", 0, 0)
+	defer tracker.Finish()
+
+	// Check each file imported fits the lineage of the files before it
+	lineage := newLineage(logger, cfg)
 
 	// Track temporary files for cleanup
 	var tempFiles []string
 	defer func() {
-		// Clean up temporary files
-		for _, file := range tempFiles {
-			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
-				level.Warn(logger).Log("msg", "failed to clean up temporary file", "file", file, "error", err)
-			} else {
-				level.Debug(logger).Log("msg", "cleaned up temporary file", "file", file)
-			}
-		}
+		removeTempFiles(logger, tempFiles)
 	}()
 
 	// Step 1: If database is empty (latestRevision == 0), try to download latest snapshot
 	if latestRevision == 0 && latestSnapshotInfo != nil && latestSnapshotInfo.Found {
 		level.Info(logger).Log("msg", "database is empty, downloading latest snapshot", "key", latestSnapshotInfo.Key, "revision", latestSnapshotInfo.Revision)
-		err = downloadAndImportSnapshotFile(ctx, logger, db, s3Client, cfg, latestSnapshotInfo, &tempFiles)
+		err = downloadAndImportSnapshotFile(ctx, logger, db, s3Client, cfg, latestSnapshotInfo, lineage, tracker, &tempFiles)
 		if err != nil {
-			return fmt.Errorf("failed to download snapshot: %w", err)
+			return 0, fmt.Errorf("failed to download snapshot: %w", err)
 		}
 
 		// Get updated latest revision after snapshot import
 		latestRevision, err = db.LatestRevision()
 		if err != nil {
-			return fmt.Errorf("failed to get latest revision after snapshot: %w", err)
+			return 0, fmt.Errorf("failed to get latest revision after snapshot: %w", err)
 		}
 		level.Info(logger).Log("msg", "updated latest revision after snapshot", "revision", latestRevision)
 	}
 
 	// Step 2: Find and download chunk files for revisions greater than latestRevision
-	err = downloadAndImportChunks(ctx, logger, db, s3Client, cfg, latestRevision, &tempFiles)
+	err = downloadAndImportChunks(ctx, logger, db, s3Client, cfg, latestRevision, lineage, tracker, &tempFiles)
 	if err != nil {
-		return fmt.Errorf("failed to download chunks: %w", err)
+		return 0, fmt.Errorf("failed to download chunks: %w", err)
 	}
 
-	level.Info(logger).Log("msg", "backfill complete")
-	return nil
+	// Step 3: Apply the latest compaction, as chunks do not record compaction
+	err = applyLatestCompaction(ctx, logger, db, cfg, latestSnapshotInfo, s3Client)
+	if err != nil {
+		return 0, fmt.Errorf("failed to apply compaction: %w", err)
+	}
+
+	// Step 4: Apply the latest lease state, as chunks do not record leases
+	err = applyLatestLeases(ctx, logger, db, s3Client)
+	if err != nil {
+		return 0, fmt.Errorf("failed to apply leases: %w", err)
+	}
+
+	// Step 5: Find the leader epoch of the latest chunk, if no files with
+	// metadata were imported, e.g. as the local database was up to date
+	if !lineage.epochSeen {
+		observeLatestChunkEpoch(ctx, logger, db, s3Client, lineage)
+	}
+
+	p := tracker.Progress()
+	level.Info(logger).Log("msg", "backfill complete", "records", p.RecordsDone, "bytes", p.BytesDone, "elapsed", p.Elapsed, "leader_epoch", lineage.maxEpoch+1)
+	return lineage.maxEpoch + 1, nil
 }
 
-func downloadAndImportSnapshotFile(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, cfg *config.Config, snapshotInfo *s3client.LatestSnapshotInfo, tempFiles *[]string) error {
-	// Download and import the snapshot
-	return downloadAndImportFile(ctx, logger, db, s3Client, cfg, snapshotInfo.Key, snapshotInfo.Size, pb.FileKind_KIND_SNAPSHOT, tempFiles)
+// observeLatestChunkEpoch records the leader epoch in the metadata of the
+// chunk of the latest revision in the local db. The chunk may not exist,
+// e.g. if the latest revision was not uploaded before a restart, which is
+// only warned about.
+func observeLatestChunkEpoch(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, lineage *lineage) {
+	latestRevision, err := db.LatestRevision()
+	if err != nil || latestRevision == 0 {
+		return
+	}
+	metadata, ok, err := s3Client.ChunkMetadata(ctx, latestRevision)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to get leader epoch of the latest chunk, leader epochs may not increase", "revision", latestRevision, "error", err)
+		return
+	}
+	if ok {
+		lineage.observeEpoch(&metadata)
+	}
 }
 
-func downloadAndImportSnapshot(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, cfg *config.Config, tempFiles *[]string) error {
+// downloadAndImportSnapshotFile imports a snapshot, which is either a single
+// snapshot file, or a manifest whose parts are imported in revision order
+func downloadAndImportSnapshotFile(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, cfg *config.Config, snapshotInfo *s3client.LatestSnapshotInfo, lineage *lineage, tracker *progress.Tracker, tempFiles *[]string) error {
+	replication.ObserveLeaderRevision(snapshotInfo.Revision)
+	if !s3client.IsSnapshotManifest(snapshotInfo.Key) {
+		// Download and import the snapshot
+		tracker.AddTotal(0, snapshotInfo.Size)
+		return downloadAndImportFile(ctx, logger, db, s3Client, cfg, snapshotInfo.Key, snapshotInfo.Size, pb.FileKind_KIND_SNAPSHOT, 0, lineage, tracker, tempFiles)
+	}
+
+	parts, err := s3Client.SnapshotParts(ctx, snapshotInfo.Key)
+	if err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "importing multi-part snapshot", "key", snapshotInfo.Key, "parts", len(parts))
+	for _, part := range parts {
+		tracker.AddTotal(0, part.Size)
+	}
+	// Each part follows on from the previous part, and temporary files are
+	// removed as each part is imported, so that at most one is on disk
+	for _, part := range parts {
+		partTempFiles := []string{}
+		err = downloadAndImportFile(ctx, logger, db, s3Client, cfg, part.Key, part.Size, pb.FileKind_KIND_SNAPSHOT, 0, lineage, tracker, &partTempFiles)
+		removeTempFiles(logger, partTempFiles)
+		if err != nil {
+			return fmt.Errorf("failed to import snapshot part %s: %w", part.Key, err)
+		}
+	}
+	return nil
+}
+
+func downloadAndImportSnapshot(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, cfg *config.Config, lineage *lineage, tracker *progress.Tracker, tempFiles *[]string) error {
 	// List available snapshots
 	snapshots, err := s3Client.ListSnapshots(ctx)
 	if err != nil {
@@ -95,10 +175,11 @@ func downloadAndImportSnapshot(ctx context.Context, logger log.Logger, db locald
 	level.Info(logger).Log("msg", "found latest snapshot", "key", latest.Key, "revision", latest.Revision, "size", latest.Size)
 
 	// Download and import the snapshot
-	return downloadAndImportFile(ctx, logger, db, s3Client, cfg, latest.Key, latest.Size, pb.FileKind_KIND_SNAPSHOT, tempFiles)
+	snapshotInfo := &s3client.LatestSnapshotInfo{Revision: latest.Revision, Key: latest.Key, Size: latest.Size, Found: true}
+	return downloadAndImportSnapshotFile(ctx, logger, db, s3Client, cfg, snapshotInfo, lineage, tracker, tempFiles)
 }
 
-func downloadAndImportChunks(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, cfg *config.Config, fromRevision int64, tempFiles *[]string) error {
+func downloadAndImportChunks(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, cfg *config.Config, fromRevision int64, lineage *lineage, tracker *progress.Tracker, tempFiles *[]string) error {
 	// List available chunks greater than fromRevision
 	chunks, err := s3Client.ListChunks(ctx, fromRevision)
 	if err != nil {
@@ -111,10 +192,22 @@ func downloadAndImportChunks(ctx context.Context, logger log.Logger, db localdb.
 	}
 
 	level.Info(logger).Log("msg", "found chunks to backfill", "count", len(chunks))
+	// the leader has written at least up to the last chunk
+	replication.ObserveLeaderRevision(chunks[len(chunks)-1].Revision)
+	for _, chunk := range chunks {
+		tracker.AddTotal(0, chunk.Size)
+	}
 
 	// Download and import each chunk file (ListChunks returns them sorted oldest first)
+	// Coalesced chunks contain multiple records and are named by their last
+	// revision, so records already imported (from an earlier chunk, or before
+	// fromRevision) are skipped.
 	for _, chunk := range chunks {
-		err := downloadAndImportFile(ctx, logger, db, s3Client, cfg, chunk.Key, chunk.Size, pb.FileKind_KIND_CHUNK, tempFiles)
+		latestRevision, err := db.LatestRevision()
+		if err != nil {
+			return fmt.Errorf("failed to get latest revision: %w", err)
+		}
+		err = downloadAndImportFile(ctx, logger, db, s3Client, cfg, chunk.Key, chunk.Size, pb.FileKind_KIND_CHUNK, latestRevision, lineage, tracker, tempFiles)
 		if err != nil {
 			return fmt.Errorf("failed to import chunk %s: %w", chunk.Key, err)
 		}
@@ -123,44 +216,155 @@ func downloadAndImportChunks(ctx context.Context, logger log.Logger, db localdb.
 	return nil
 }
 
+// applyLatestCompaction applies the most recent compaction recorded in S3.
+// Each compaction includes all earlier compactions, so only the latest needs
+// to be applied. If enabled, tombstones covered by both the compaction and
+// the latest snapshot are then pruned.
+func applyLatestCompaction(ctx context.Context, logger log.Logger, db localdb.Database, cfg *config.Config, latestSnapshotInfo *s3client.LatestSnapshotInfo, s3Client *s3client.S3Client) error {
+	compaction, err := s3Client.LatestCompaction(ctx)
+	if err != nil {
+		return err
+	}
+	if compaction == nil {
+		return nil
+	}
+	compacted, err := db.Compact(compaction.Revision, compaction.CompactedAt)
+	if err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "applied compaction", "revision", compaction.Revision, "compacted_records", compacted)
+
+	if cfg.CompactionPruneTombstones() && latestSnapshotInfo != nil && latestSnapshotInfo.Found {
+		pruneRevision := min(compaction.Revision, latestSnapshotInfo.Revision)
+		var pruned int64
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			batch, err := db.PruneTombstones(pruneRevision, localdb.PruneTombstonesBatchSize)
+			if err != nil {
+				return err
+			}
+			if batch == 0 {
+				break
+			}
+			pruned += batch
+		}
+		level.Info(logger).Log("msg", "pruned tombstones", "revision", pruneRevision, "pruned_records", pruned)
+	}
+	return nil
+}
+
+// applyLatestLeases applies the most recent lease state recorded in S3, so
+// that leases granted by the leader are restored and their keys are deleted
+// once they end. Each lease file includes every lease which has not ended,
+// so only the latest needs to be applied.
+func applyLatestLeases(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client) error {
+	leases, err := s3Client.LatestLeases(ctx)
+	if err != nil {
+		return err
+	}
+	if leases == nil {
+		return nil
+	}
+	granted, ended, err := lease.Apply(db, leases.Entries)
+	if err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "applied leases", "revision", leases.Revision, "granted", granted, "ended", ended)
+	return nil
+}
+
 // downloadAndImportFile downloads and imports a file, automatically choosing the best strategy
-func downloadAndImportFile(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, cfg *config.Config, key string, size int64, expectedKind pb.FileKind, tempFiles *[]string) error {
+// Records with revision <= skipUpToRevision are not imported.
+func downloadAndImportFile(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client, cfg *config.Config, key string, size int64, expectedKind pb.FileKind, skipUpToRevision int64, lineage *lineage, tracker *progress.Tracker, tempFiles *[]string) error {
 	level.Debug(logger).Log("msg", "downloading and importing file", "key", key, "size", size)
 
 	// Download the file using the appropriate strategy
-	reader, err := s3Client.DownloadFile(ctx, key, size, cfg.DataDir(), tempFiles)
+	reader, metadata, err := s3Client.DownloadFile(ctx, key, size, cfg.DataDir(), tempFiles)
 	if err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
 	defer reader.Close()
+	if lineage != nil {
+		lineage.observeEpoch(metadata)
+		if expectedKind == pb.FileKind_KIND_CHUNK {
+			lineage.checkEpoch(key, metadata)
+		}
+	}
 
-	// Create buffered reader for the datafile reader
-	buffer := bufio.NewReader(reader)
+	// Create buffered reader for the datafile reader, counting bytes read
+	buffer := bufio.NewReader(&progressReader{reader: reader, tracker: tracker})
 
-	return importFromReader(logger, db, buffer, expectedKind, key)
+	return importFromReader(logger, db, buffer, expectedKind, key, skipUpToRevision, s3Client.DictionaryLoader(ctx), lineage, tracker)
 }
 
-// importFromReader handles the common logic for importing records from a reader
-func importFromReader(logger log.Logger, db localdb.Database, buffer *bufio.Reader, expectedKind pb.FileKind, key string) error {
+// importFromReader handles the common logic for importing records from a reader.
+// The file header is checked against lineage, unless it is nil.
+func importFromReader(logger log.Logger, db localdb.Database, buffer *bufio.Reader, expectedKind pb.FileKind, key string, skipUpToRevision int64, loadDictionary datafile.DictionaryLoader, lineage *lineage, tracker *progress.Tracker) error {
 	// Create datafile reader
-	reader, err := datafile.NewReader(buffer, &expectedKind)
+	reader, err := datafile.NewReaderWithDictionaries(buffer, &expectedKind, loadDictionary)
 	if err != nil {
 		return fmt.Errorf("failed to create datafile reader: %w", err)
 	}
+	defer reader.Release()
+	tracker.AddTotal(reader.Count(), 0)
+	if lineage != nil {
+		lineage.check(key, reader.Header())
+	}
+
+	// Imported records must follow on from the latest local revision
+	latestRevision, err := db.LatestRevision()
+	if err != nil {
+		return fmt.Errorf("failed to get latest revision: %w", err)
+	}
+
+	// Snapshots omit revisions which were pruned (see PruneTombstones),
+	// whereas chunks are written as revisions are created so have no gaps
+	allowGaps := expectedKind == pb.FileKind_KIND_SNAPSHOT
 
 	// Read and import all records
 	recordCount := int64(0)
+	prevRevision := int64(0)
 	for i := int64(0); i < reader.Count(); i++ {
 		record, err := reader.Read()
 		if err != nil {
 			return fmt.Errorf("failed to read record %d: %w", i, err)
 		}
+		tracker.Add(1, 0)
+
+		// Validate the record, rejecting the rest of the file if it is
+		// invalid. Records before it have been imported, which is safe as
+		// they were valid and contiguous.
+		skip := record.Revision <= skipUpToRevision
+		expectAfter := latestRevision
+		if skip {
+			expectAfter = -1
+		}
+		if err = validateRecord(record, prevRevision, expectAfter, allowGaps); err != nil {
+			level.Error(logger).Log("msg", "rejecting file with invalid record", "key", key, "record", i, "error", err)
+			return fmt.Errorf("file %s record %d: %w", key, i, err)
+		}
+		prevRevision = record.Revision
+
+		// Skip records which have already been imported
+		if skip {
+			continue
+		}
+
+		// Record revisions pruned before the snapshot was written
+		if record.Revision > latestRevision+1 {
+			if err = db.RecordGap(latestRevision+1, record.Revision-1, localdb.GapReasonBackfill, nil); err != nil {
+				return fmt.Errorf("failed to record pruned revisions before record %d: %w", i, err)
+			}
+		}
 
 		// Import record using replicate function (no validation)
-		_, err = db.ReplicateRecord(record)
+		_, err = db.ReplicateRecord(record, nil)
 		if err != nil {
 			return fmt.Errorf("failed to replicate record %d: %w", i, err)
 		}
+		latestRevision = record.Revision
 
 		recordCount++
 	}
@@ -174,3 +378,26 @@ func importFromReader(logger log.Logger, db localdb.Database, buffer *bufio.Read
 	level.Info(logger).Log("msg", "successfully imported file", "key", key, "kind", results.Kind, "records", recordCount, "first_revision", results.FirstRevision, "last_revision", results.LastRevision)
 	return nil
 }
+
+// removeTempFiles removes temporary files created by downloads
+func removeTempFiles(logger log.Logger, tempFiles []string) {
+	for _, file := range tempFiles {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			level.Warn(logger).Log("msg", "failed to clean up temporary file", "file", file, "error", err)
+		} else {
+			level.Debug(logger).Log("msg", "cleaned up temporary file", "file", file)
+		}
+	}
+}
+
+// progressReader counts bytes read towards a progress tracker
+type progressReader struct {
+	reader  io.Reader
+	tracker *progress.Tracker
+}
+
+func (r *progressReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.tracker.Add(0, int64(n))
+	return n, err
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+// lineage cross-checks the header and metadata of each data file imported by
+// backfill against the files imported before it, warning about files which
+// do not fit, e.g. files created in the future, written by a leader which
+// took over without fencing the previous leader, or written by an unknown
+// instance. These may have been written by a misconfigured instance sharing
+// the bucket, or tampered with, so are detected early. Anomalies are only
+// warned about, as records are still validated as they are imported.
+type lineage struct {
+	logger log.Logger
+	known  map[string]bool // expected leader IDs, or nil if any are expected
+	skew   time.Duration
+	now    func() time.Time
+
+	// leader ID and creation time of the previous chunk
+	prevKey       string
+	prevLeader    string
+	prevCreatedAt time.Time
+
+	// key, leader ID and leader epoch of the previous chunk with metadata
+	prevEpochKey    string
+	prevEpochLeader string
+	prevEpoch       int64
+
+	// newest leader epoch of any file with metadata, and whether any file
+	// had metadata (see observeEpoch)
+	maxEpoch  int64
+	epochSeen bool
+}
+
+// newLineage creates a lineage checker for a backfill
+func newLineage(logger log.Logger, cfg *config.Config) *lineage {
+	l := &lineage{
+		logger: logger,
+		skew:   time.Duration(cfg.BackfillClockSkewSeconds()) * time.Second,
+		now:    time.Now,
+	}
+	for _, leader := range cfg.BackfillKnownLeaders() {
+		if l.known == nil {
+			l.known = map[string]bool{}
+		}
+		l.known[leader] = true
+	}
+	return l
+}
+
+// check warns about anomalies in the header of the file at key, returning
+// the reason for each. Chunks are written in revision order, so each chunk
+// is expected to have been created no earlier than the previous chunk,
+// whereas snapshots are written after the chunks they cover so are only
+// checked against the current time.
+func (l *lineage) check(key string, header *pb.FileHeader) (reasons []string) {
+	leader := header.GetLeaderId()
+	switch {
+	case leader == "":
+		reasons = append(reasons, "missing_leader")
+	case l.known != nil && !l.known[leader]:
+		reasons = append(reasons, "unknown_leader")
+	}
+
+	var createdAt time.Time
+	future := false
+	if header.GetCreatedAt() == nil {
+		reasons = append(reasons, "missing_created_at")
+	} else {
+		createdAt = header.GetCreatedAt().AsTime()
+		if future = createdAt.After(l.now().Add(l.skew)); future {
+			reasons = append(reasons, "future_created_at")
+		}
+		if header.GetKind() == pb.FileKind_KIND_CHUNK && !l.prevCreatedAt.IsZero() && createdAt.Before(l.prevCreatedAt.Add(-l.skew)) {
+			reasons = append(reasons, "out_of_order_created_at")
+		}
+	}
+
+	for _, reason := range reasons {
+		metrics.DatafileLineageAnomalies.WithLabelValues(reason).Inc()
+		level.Warn(l.logger).Log("msg", "data file header does not fit lineage of previous files, it may be foreign or tampered", "key", key, "reason", reason,
+			"leader_id", leader, "created_at", createdAt, "previous_key", l.prevKey, "previous_leader_id", l.prevLeader, "previous_created_at", l.prevCreatedAt)
+	}
+
+	if header.GetKind() == pb.FileKind_KIND_CHUNK {
+		l.prevKey, l.prevLeader = key, leader
+		// files created in the future would make every later file appear
+		// out of order, so are not used as the baseline
+		if !future && createdAt.After(l.prevCreatedAt) {
+			l.prevCreatedAt = createdAt
+		}
+	}
+	return reasons
+}
+
+// observeEpoch records the leader epoch in the metadata of a file, so that
+// this instance leads with a newer epoch than every leader before it (see
+// Backfill). Files without metadata are ignored.
+func (l *lineage) observeEpoch(metadata *s3client.ObjectMetadata) {
+	if metadata == nil {
+		return
+	}
+	l.maxEpoch = max(l.maxEpoch, metadata.LeaderEpoch)
+	l.epochSeen = true
+}
+
+// checkEpoch warns about chunks which show a leader takeover that was not
+// fenced, using the leader epoch in the metadata of the chunk at key, and
+// returns the reason for each. Each leader writes chunks with a newer epoch
+// than the leaders before it (see s3client.SetLeaderEpoch), so a chunk with
+// an older epoch than the previous chunk was written by a stale leader after
+// a newer leader took over, and a chunk written by another leader with the
+// same epoch was written by a leader which took over without advancing the
+// epoch. Chunks without metadata, e.g. uploaded by older versions, are not
+// checked.
+func (l *lineage) checkEpoch(key string, metadata *s3client.ObjectMetadata) (reasons []string) {
+	if metadata == nil {
+		return nil
+	}
+	if l.prevEpochKey != "" {
+		switch {
+		case metadata.LeaderEpoch < l.prevEpoch:
+			reasons = append(reasons, "stale_leader_epoch")
+		case metadata.LeaderEpoch == l.prevEpoch && metadata.LeaderID != l.prevEpochLeader:
+			reasons = append(reasons, "takeover_without_epoch")
+		}
+	}
+
+	for _, reason := range reasons {
+		metrics.DatafileLineageAnomalies.WithLabelValues(reason).Inc()
+		level.Warn(l.logger).Log("msg", "data file leader epoch does not fit lineage of previous files, leaders may have written concurrently", "key", key, "reason", reason,
+			"leader_id", metadata.LeaderID, "leader_epoch", metadata.LeaderEpoch, "previous_key", l.prevEpochKey, "previous_leader_id", l.prevEpochLeader, "previous_leader_epoch", l.prevEpoch)
+	}
+
+	// chunks of a stale leader are not used as the baseline, so that the
+	// newer leader's chunks which follow them are not warned about
+	if l.prevEpochKey == "" || metadata.LeaderEpoch >= l.prevEpoch {
+		l.prevEpochKey, l.prevEpochLeader, l.prevEpoch = key, metadata.LeaderID, metadata.LeaderEpoch
+	}
+	return reasons
+}
@@ -0,0 +1,75 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestLineageCheck(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := &lineage{
+		logger: log.NewNopLogger(),
+		known:  map[string]bool{"a": true, "b": true},
+		skew:   time.Minute,
+		now:    func() time.Time { return now },
+	}
+	header := func(kind pb.FileKind, leader string, createdAt time.Time) *pb.FileHeader {
+		h := &pb.FileHeader{Kind: kind, LeaderId: leader}
+		if !createdAt.IsZero() {
+			h.CreatedAt = timestamppb.New(createdAt)
+		}
+		return h
+	}
+	for _, tc := range []struct {
+		name   string
+		header *pb.FileHeader
+		want   []string
+	}{
+		{"snapshot", header(pb.FileKind_KIND_SNAPSHOT, "a", now.Add(-time.Hour)), nil},
+		{"chunk before snapshot", header(pb.FileKind_KIND_CHUNK, "a", now.Add(-2*time.Hour)), nil},
+		{"chunk within skew", header(pb.FileKind_KIND_CHUNK, "b", now.Add(-2*time.Hour-30*time.Second)), nil},
+		{"chunk out of order", header(pb.FileKind_KIND_CHUNK, "b", now.Add(-3*time.Hour)), []string{"out_of_order_created_at"}},
+		{"chunk in the future", header(pb.FileKind_KIND_CHUNK, "a", now.Add(time.Hour)), []string{"future_created_at"}},
+		{"unknown leader", header(pb.FileKind_KIND_CHUNK, "c", now), []string{"unknown_leader"}},
+		{"missing fields", header(pb.FileKind_KIND_CHUNK, "", time.Time{}), []string{"missing_leader", "missing_created_at"}},
+		{"after missing fields", header(pb.FileKind_KIND_CHUNK, "a", now.Add(30*time.Second)), nil},
+	} {
+		if got := l.check(tc.name, tc.header); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: expected anomalies %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestLineageCheckEpoch(t *testing.T) {
+	l := &lineage{logger: log.NewNopLogger()}
+	metadata := func(leader string, epoch int64) *s3client.ObjectMetadata {
+		return &s3client.ObjectMetadata{LeaderID: leader, LeaderEpoch: epoch}
+	}
+	for _, tc := range []struct {
+		name     string
+		metadata *s3client.ObjectMetadata
+		want     []string
+	}{
+		{"first chunk", metadata("a", 1), nil},
+		{"same leader", metadata("a", 1), nil},
+		{"without metadata", nil, nil},
+		{"fenced takeover", metadata("b", 2), nil},
+		{"stale leader", metadata("a", 1), []string{"stale_leader_epoch"}},
+		{"after stale leader", metadata("b", 2), nil},
+		{"unfenced takeover", metadata("c", 2), []string{"takeover_without_epoch"}},
+		{"after unfenced takeover", metadata("c", 2), nil},
+	} {
+		if got := l.checkEpoch(tc.name, tc.metadata); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: expected anomalies %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
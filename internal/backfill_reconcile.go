@@ -0,0 +1,79 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/replication"
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+// ReconcileSkippedBackfill checks S3 for revisions missing from the local
+// database after backfill was skipped, retrying until S3 can be listed or ctx
+// is cancelled. Missing revisions are reported rather than imported, as the
+// local database is already serving requests, so the instance must then be
+// restarted without skip_backfill to backfill them.
+func ReconcileSkippedBackfill(ctx context.Context, logger log.Logger, db localdb.Database, cfg *config.Config, s3Client *s3client.S3Client) {
+	metrics.BackfillSkipped.Set(1)
+	interval := time.Duration(cfg.BackfillReconcileIntervalSeconds()) * time.Second
+	for {
+		result, err := reconcileSkippedBackfill(ctx, logger, db, s3Client)
+		metrics.BackfillReconciles.WithLabelValues(result).Inc()
+		if err == nil {
+			if result == "reconciled" {
+				metrics.BackfillSkipped.Set(0)
+			}
+			return
+		}
+		level.Warn(logger).Log("msg", "failed to reconcile local database with S3 after skipping backfill, retrying", "retry_interval", interval, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// reconcileSkippedBackfill compares the latest local revision with the
+// latest revision in S3, from the latest snapshot and any chunks after the
+// local revision, returning whether the local database is behind
+func reconcileSkippedBackfill(ctx context.Context, logger log.Logger, db localdb.Database, s3Client *s3client.S3Client) (result string, err error) {
+	latestRevision, err := db.LatestRevision()
+	if err != nil {
+		return "error", fmt.Errorf("failed to get latest revision: %w", err)
+	}
+	snapshotInfo, err := s3Client.GetLatestSnapshot(ctx)
+	if err != nil {
+		return "error", fmt.Errorf("failed to get latest snapshot info: %w", err)
+	}
+	chunks, err := s3Client.ListChunks(ctx, latestRevision)
+	if err != nil {
+		return "error", fmt.Errorf("failed to list chunks: %w", err)
+	}
+
+	var s3Revision int64
+	if snapshotInfo != nil && snapshotInfo.Found {
+		s3Revision = snapshotInfo.Revision
+	}
+	if len(chunks) > 0 {
+		s3Revision = max(s3Revision, chunks[len(chunks)-1].Revision)
+	}
+	replication.ObserveLeaderRevision(s3Revision)
+	if s3Revision > latestRevision {
+		level.Error(logger).Log("msg", "local database is missing revisions written to S3, restart without skip_backfill to backfill them",
+			"local_revision", latestRevision, "s3_revision", s3Revision, "chunks", len(chunks))
+		return "behind", nil
+	}
+	level.Info(logger).Log("msg", "reconciled local database with S3 after skipping backfill, no revisions are missing", "local_revision", latestRevision, "s3_revision", s3Revision)
+	return "reconciled", nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/s3client"
+	"github.com/spf13/viper"
+)
+
+// TestReconcileSkippedBackfill checks that a local database which skipped
+// backfill is reported as behind if S3 has revisions it is missing
+func TestReconcileSkippedBackfill(t *testing.T) {
+	bucket := newChaosBucket(t)
+	leader := startChaosServer(t, bucket, "leader", t.TempDir())
+	for _, key := range []string{"a", "b"} {
+		if _, err := leader.create(key, key); err != nil {
+			t.Fatalf("create %s: %v", key, err)
+		}
+	}
+
+	viper.Set("s3_access_key_id", "reconcile")
+	s3Client, err := s3client.New(&config.Config{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("s3client.New: %v", err)
+	}
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		db     func() localdb.Database
+		result string
+	}{
+		{"up to date", func() localdb.Database { return leader.db }, "reconciled"},
+		{"missing revisions", func() localdb.Database { return localdbtest.New(t) }, "behind"},
+	} {
+		result, err := reconcileSkippedBackfill(ctx, log.NewNopLogger(), tc.db(), s3Client)
+		if err != nil || result != tc.result {
+			t.Errorf("%s: expected %s, got %s: %v", tc.name, tc.result, result, err)
+		}
+	}
+
+	// S3 errors are returned, so reconciling is retried
+	bucket.inject("reconcile", func(f *chaosFaults) {
+		f.down = true
+	})
+	if result, err := reconcileSkippedBackfill(ctx, log.NewNopLogger(), leader.db, s3Client); err == nil || result != "error" {
+		t.Fatalf("expected an error while S3 is down, got %s: %v", result, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/progress"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"go.uber.org/goleak"
+)
+
+// TestImportFromReaderGoroutines checks that importing compressed files does
+// not leak zstd decompressor goroutines, including when a file is rejected
+func TestImportFromReaderGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	// zstd decodes files with multiple blocks on separate goroutines, when
+	// more than one CPU may be used
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	var records []*pb.Record
+	for revision := int64(1); revision <= 64; revision++ {
+		value := make([]byte, 32*1024)
+		for i := range value {
+			value[i] = byte((int64(i) * revision) % 251)
+		}
+		records = append(records, &pb.Record{Revision: revision, Key: fmt.Appendf(nil, "key%d", revision), Value: value, Created: true, LeaderId: "test"})
+	}
+	buf := &bytes.Buffer{}
+	bufWriter := bufio.NewWriter(buf)
+	compression := pb.FileCompression_COMPRESSION_ZSTD
+	writer, err := datafile.NewWriterWithCompression(bufWriter, pb.FileKind_KIND_CHUNK, int64(len(records)), "test", &compression)
+	if err != nil {
+		t.Fatalf("NewWriterWithCompression: %v", err)
+	}
+	for _, record := range records {
+		if err = writer.Write(record); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	data := buf.Bytes()
+
+	db := localdb.New(t.TempDir()+"/db.sqlite3", 2)
+	if err = db.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	tracker := progress.Start(log.NewNopLogger(), "test", 0, 0)
+	defer tracker.Finish()
+
+	err = importFromReader(log.NewNopLogger(), db, bufio.NewReader(bytes.NewReader(data)), pb.FileKind_KIND_CHUNK, "chunk", 0, nil, nil, tracker)
+	if err != nil {
+		t.Fatalf("importFromReader: %v", err)
+	}
+	// the same records no longer follow the latest local revision
+	err = importFromReader(log.NewNopLogger(), db, bufio.NewReader(bytes.NewReader(data)), pb.FileKind_KIND_CHUNK, "chunk", 0, nil, nil, tracker)
+	if err == nil {
+		t.Fatalf("expected importing the same records again to fail")
+	}
+	if err = db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// TestBackfillLeaderEpoch checks that each server leads with a newer leader
+// epoch than the leader of the chunks before it, whether it backfilled
+// their chunks or its local database was already up to date
+func TestBackfillLeaderEpoch(t *testing.T) {
+	bucket := newChaosBucket(t)
+	first := startChaosServer(t, bucket, "first", t.TempDir())
+	if epoch := first.server.LeaderEpoch(); epoch != 1 {
+		t.Fatalf("expected the first server to lead with epoch 1, got %d", epoch)
+	}
+	createAll(t, first, "first", 2)
+	first.kill()
+
+	// the chunks of the first server are backfilled
+	next := startChaosServer(t, bucket, "next", t.TempDir())
+	if epoch := next.server.LeaderEpoch(); epoch != 2 {
+		t.Fatalf("expected the next server to lead with epoch 2, got %d", epoch)
+	}
+	createAll(t, next, "next", 1)
+
+	// no chunks are backfilled, so the latest chunk's epoch is used
+	restarted := next.restart(t)
+	if epoch := restarted.server.LeaderEpoch(); epoch != 3 {
+		t.Fatalf("expected the restarted server to lead with epoch 3, got %d", epoch)
+	}
+}
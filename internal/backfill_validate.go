@@ -0,0 +1,42 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+// ErrInvalidRecord is returned when a record read from S3 is not valid to
+// insert into the local database
+var ErrInvalidRecord = errors.New("invalid record")
+
+// validateRecord checks a record read from S3 before it is inserted, given
+// the revision of the previous record read from the same file (or 0 for the
+// first record), and the latest revision in the local database (for records
+// which will be inserted, otherwise -1). Datafile CRCs detect corruption, so
+// this instead catches files which are well formed but whose contents do not
+// follow on from the local database, e.g. files written by a buggy or
+// misconfigured leader. If allowGaps is true, records may skip revisions
+// after the latest local revision, e.g. as snapshots omit pruned revisions.
+func validateRecord(record *pb.Record, prevRevision int64, latestRevision int64, allowGaps bool) error {
+	if record.Revision <= 0 {
+		return fmt.Errorf("%w: revision %d is not positive", ErrInvalidRecord, record.Revision)
+	}
+	if prevRevision > 0 && record.Revision <= prevRevision {
+		return fmt.Errorf("%w: revision %d does not follow previous revision %d in file", ErrInvalidRecord, record.Revision, prevRevision)
+	}
+	if latestRevision >= 0 && (record.Revision <= latestRevision || (!allowGaps && record.Revision != latestRevision+1)) {
+		return fmt.Errorf("%w: revision %d does not follow latest local revision %d", ErrInvalidRecord, record.Revision, latestRevision)
+	}
+	if len(record.Key) == 0 {
+		return fmt.Errorf("%w: revision %d has an empty key", ErrInvalidRecord, record.Revision)
+	}
+	if record.Created && record.Deleted {
+		return fmt.Errorf("%w: revision %d is both created and deleted", ErrInvalidRecord, record.Revision)
+	}
+	return nil
+}
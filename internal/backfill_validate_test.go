@@ -0,0 +1,44 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestValidateRecord(t *testing.T) {
+	tests := []struct {
+		name           string
+		record         *pb.Record
+		prevRevision   int64
+		latestRevision int64
+		allowGaps      bool
+		valid          bool
+	}{
+		{"first record", &pb.Record{Revision: 1, Key: []byte("a"), Created: true}, 0, 0, false, true},
+		{"follows local", &pb.Record{Revision: 6, Key: []byte("a")}, 5, 5, false, true},
+		{"skipped", &pb.Record{Revision: 3, Key: []byte("a")}, 2, -1, false, true},
+		{"zero revision", &pb.Record{Revision: 0, Key: []byte("a")}, 0, -1, false, false},
+		{"not monotonic", &pb.Record{Revision: 5, Key: []byte("a")}, 5, -1, false, false},
+		{"gap after local", &pb.Record{Revision: 7, Key: []byte("a")}, 0, 5, false, false},
+		{"before local", &pb.Record{Revision: 5, Key: []byte("a")}, 0, 5, false, false},
+		{"allowed gap after local", &pb.Record{Revision: 7, Key: []byte("a")}, 0, 5, true, true},
+		{"before local with gaps allowed", &pb.Record{Revision: 5, Key: []byte("a")}, 0, 5, true, false},
+		{"empty key", &pb.Record{Revision: 1}, 0, 0, false, false},
+		{"created and deleted", &pb.Record{Revision: 1, Key: []byte("a"), Created: true, Deleted: true}, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRecord(tt.record, tt.prevRevision, tt.latestRevision, tt.allowGaps)
+			if tt.valid && err != nil {
+				t.Errorf("validateRecord() = %v, want nil", err)
+			} else if !tt.valid && !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("validateRecord() = %v, want ErrInvalidRecord", err)
+			}
+		})
+	}
+}
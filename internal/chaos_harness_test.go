@@ -0,0 +1,482 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/clientapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/s3client"
+	"github.com/spf13/viper"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+)
+
+// The chaos tests run netsy servers in-process against an in-memory S3
+// bucket, which injects faults into the requests of each server (see
+// chaosFaults). Servers share netsy's global configuration, so the bucket
+// identifies them by the access key ID their requests are signed with.
+
+// chaosBucketName is the name of the fake bucket
+const chaosBucketName = "netsy"
+
+// chaosFaults are the faults injected into the S3 requests of a server
+type chaosFaults struct {
+	// down fails every request, as if the server were partitioned from S3
+	// or had crashed
+	down bool
+	// latency delays every request
+	latency time.Duration
+	// failUploads fails the next N uploads without writing them
+	failUploads int
+	// loseUploads writes the next N uploads but fails them, as if their
+	// responses were lost
+	loseUploads int
+	// crashAt crashes the server (i.e. sets down) once it uploads the chunk
+	// of this revision, before the upload is written unless
+	// crashAfterWrite is set
+	crashAt         int64
+	crashAfterWrite bool
+}
+
+// chaosObject is an object in a chaosBucket
+type chaosObject struct {
+	data []byte
+	// metadata holds the X-Amz-Meta-* headers the object was uploaded with
+	metadata http.Header
+	etag     string
+	modified time.Time
+}
+
+// chaosBucket is an in-memory S3 bucket shared by the servers of a chaos
+// test. It implements the S3 API used by netsy: conditional uploads,
+// (ranged) downloads and ListObjectsV2.
+type chaosBucket struct {
+	url string
+
+	mu      sync.Mutex
+	objects map[string]*chaosObject
+	faults  map[string]*chaosFaults
+	etags   int
+}
+
+// newChaosBucket starts a chaosBucket, and configures netsy to replicate
+// synchronously to it
+func newChaosBucket(t *testing.T) *chaosBucket {
+	t.Helper()
+	bucket := &chaosBucket{objects: map[string]*chaosObject{}, faults: map[string]*chaosFaults{}}
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+	bucket.url = server.URL
+
+	// faults are injected once per request, rather than retried by the
+	// SDK with backoff. netsy's own retries are unaffected.
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	settings := map[string]any{
+		"s3_enabled":           true,
+		"s3_bucket_name":       chaosBucketName,
+		"s3_key_prefix":        "cluster",
+		"s3_region":            "us-east-1",
+		"s3_endpoint":          server.URL,
+		"s3_force_path_style":  true,
+		"s3_secret_access_key": "chaos",
+		// the bucket does not verify checksums
+		"s3_checksums":                     false,
+		"instance_id":                      "chaos",
+		"data_dir":                         t.TempDir(),
+		"replication_mode":                 "synchronous",
+		"replication_s3_failure_threshold": 3,
+		"replication_s3_retry_seconds":     0,
+	}
+	configtest.Set(t, settings)
+	configtest.Restore(t, "s3_access_key_id")
+	return bucket
+}
+
+// inject changes the faults injected into the requests of server
+func (b *chaosBucket) inject(server string, change func(f *chaosFaults)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	change(b.faultsOf(server))
+}
+
+// faultsOf returns the faults of server. b.mu must be held.
+func (b *chaosBucket) faultsOf(server string) *chaosFaults {
+	faults, ok := b.faults[server]
+	if !ok {
+		faults = &chaosFaults{}
+		b.faults[server] = faults
+	}
+	return faults
+}
+
+// chunks returns the revision range of each chunk in the bucket
+func (b *chaosBucket) chunks() (ranges [][2]int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, object := range b.objects {
+		if !strings.Contains(key, "/chunks/") {
+			continue
+		}
+		first, _ := strconv.ParseInt(object.metadata.Get("X-Amz-Meta-Netsy-First-Revision"), 10, 64)
+		last, _ := strconv.ParseInt(object.metadata.Get("X-Amz-Meta-Netsy-Last-Revision"), 10, 64)
+		ranges = append(ranges, [2]int64{first, last})
+	}
+	slices.SortFunc(ranges, func(a, b [2]int64) int {
+		return int(a[0] - b[0])
+	})
+	return ranges
+}
+
+func (b *chaosBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server := accessKeyID(r)
+	b.mu.Lock()
+	latency := b.faultsOf(server).latency
+	b.mu.Unlock()
+	time.Sleep(latency)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	faults := b.faultsOf(server)
+	if faults.down {
+		s3Error(w, http.StatusServiceUnavailable, "ServiceUnavailable")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+chaosBucketName+"/")
+	switch {
+	case r.URL.Path == "/"+chaosBucketName || r.URL.Path == "/"+chaosBucketName+"/":
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			b.list(w, r)
+		}
+	case r.Method == http.MethodPut:
+		b.upload(w, r, key, faults)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		object, ok := b.objects[key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for name, values := range object.metadata {
+			w.Header()[name] = values
+		}
+		w.Header().Set("ETag", object.etag)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, key, object.modified, bytes.NewReader(object.data))
+	case r.Method == http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusBadRequest, "InvalidRequest")
+	}
+}
+
+// upload writes an object, if its conditions hold, injecting faults.
+// b.mu must be held.
+func (b *chaosBucket) upload(w http.ResponseWriter, r *http.Request, key string, faults *chaosFaults) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		s3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	if faults.failUploads > 0 {
+		faults.failUploads--
+		s3Error(w, http.StatusInternalServerError, "InternalError")
+		return
+	}
+	crash := faults.crashAt > 0 && r.Header.Get("X-Amz-Meta-Netsy-Last-Revision") == strconv.FormatInt(faults.crashAt, 10)
+	if crash && !faults.crashAfterWrite {
+		faults.down = true
+		s3Error(w, http.StatusServiceUnavailable, "ServiceUnavailable")
+		return
+	}
+	existing, exists := b.objects[key]
+	if (exists && r.Header.Get("If-None-Match") == "*") ||
+		(r.Header.Get("If-Match") != "" && (!exists || existing.etag != r.Header.Get("If-Match"))) {
+		s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+	b.etags++
+	object := &chaosObject{data: data, metadata: http.Header{}, etag: fmt.Sprintf(`"%d"`, b.etags), modified: time.Now()}
+	for name, values := range r.Header {
+		if strings.HasPrefix(name, "X-Amz-Meta-") {
+			object.metadata[name] = values
+		}
+	}
+	b.objects[key] = object
+	if crash {
+		faults.down = true
+		s3Error(w, http.StatusServiceUnavailable, "ServiceUnavailable")
+		return
+	}
+	if faults.loseUploads > 0 {
+		faults.loseUploads--
+		s3Error(w, http.StatusInternalServerError, "InternalError")
+		return
+	}
+	w.Header().Set("ETag", object.etag)
+}
+
+type listBucketResult struct {
+	XMLName        xml.Name         `xml:"ListBucketResult"`
+	Name           string           `xml:"Name"`
+	Prefix         string           `xml:"Prefix"`
+	KeyCount       int              `xml:"KeyCount"`
+	MaxKeys        int              `xml:"MaxKeys"`
+	IsTruncated    bool             `xml:"IsTruncated"`
+	Contents       []listObject     `xml:"Contents"`
+	CommonPrefixes []listCommonPart `xml:"CommonPrefixes"`
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+}
+
+type listCommonPart struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// list implements ListObjectsV2, returning every matching key in a single
+// page. b.mu must be held.
+func (b *chaosBucket) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix, delimiter, startAfter := query.Get("prefix"), query.Get("delimiter"), query.Get("start-after")
+	result := listBucketResult{Name: chaosBucketName, Prefix: prefix, MaxKeys: 1000}
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok || key <= startAfter {
+			continue
+		}
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			commonPrefix := prefix + rest[:i+len(delimiter)]
+			if n := len(result.CommonPrefixes); n == 0 || result.CommonPrefixes[n-1].Prefix != commonPrefix {
+				result.CommonPrefixes = append(result.CommonPrefixes, listCommonPart{Prefix: commonPrefix})
+			}
+			continue
+		}
+		object := b.objects[key]
+		result.Contents = append(result.Contents, listObject{
+			Key:          key,
+			LastModified: object.modified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         object.etag,
+			Size:         len(object.data),
+		})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	w.Header().Set("Content-Type", "application/xml")
+	if err := xml.NewEncoder(w).Encode(result); err != nil {
+		s3Error(w, http.StatusInternalServerError, "InternalError")
+	}
+}
+
+// s3Error writes an S3 error response
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// accessKeyID returns the access key ID a request was signed with
+func accessKeyID(r *http.Request) string {
+	_, credential, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+	id, _, _ := strings.Cut(credential, "/")
+	return id
+}
+
+// chaosServer is a netsy server of a chaos test
+type chaosServer struct {
+	name    string
+	dataDir string
+	bucket  *chaosBucket
+	db      localdb.Database
+	server  *clientapi.ClientAPIServer
+	close   sync.Once
+}
+
+// startChaosServer starts a server as netsy does, backfilling its local
+// database in dataDir from the bucket, then serving writes. Its S3 requests
+// are signed with name, which identifies it to the bucket.
+func startChaosServer(t *testing.T, bucket *chaosBucket, name string, dataDir string) *chaosServer {
+	t.Helper()
+	logger := log.NewNopLogger()
+	c := &config.Config{}
+	viper.Set("s3_access_key_id", name)
+	s3Client, err := s3client.New(c, logger)
+	if err != nil {
+		t.Fatalf("%s: s3client.New: %v", name, err)
+	}
+	ctx := context.Background()
+	latestSnapshot, err := s3Client.GetLatestSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("%s: GetLatestSnapshot: %v", name, err)
+	}
+	if err = s3Client.LoadLatestDictionary(ctx); err != nil {
+		t.Fatalf("%s: LoadLatestDictionary: %v", name, err)
+	}
+
+	db := localdb.New(filepath.Join(dataDir, "db.sqlite3"), 2)
+	if err = db.Connect(); err != nil {
+		t.Fatalf("%s: Connect: %v", name, err)
+	}
+	s := &chaosServer{name: name, dataDir: dataDir, bucket: bucket, db: db}
+	t.Cleanup(s.stop)
+	latestRevision, err := db.LatestRevision()
+	if err != nil {
+		t.Fatalf("%s: LatestRevision: %v", name, err)
+	}
+	leaderEpoch, err := Backfill(logger, db, c, latestRevision, latestSnapshot, s3Client)
+	if err != nil {
+		t.Fatalf("%s: Backfill: %v", name, err)
+	}
+	if err = db.VerifyIntegrity(); err != nil {
+		t.Fatalf("%s: VerifyIntegrity: %v", name, err)
+	}
+	s.server, err = clientapi.NewServer(logger, c, db, grpc.NewServer(), nil, s3Client, nil, nil)
+	if err != nil {
+		t.Fatalf("%s: NewServer: %v", name, err)
+	}
+	s.server.AdvanceLeaderEpoch(leaderEpoch)
+	if err = s.server.SetReady(); err != nil {
+		t.Fatalf("%s: SetReady: %v", name, err)
+	}
+	return s
+}
+
+// create creates key with value, returning the revision it was committed
+// at, or an error if the write was not acknowledged
+func (s *chaosServer) create(key, value string) (revision int64, err error) {
+	resp, err := s.server.Txn(context.Background(), &pb.TxnRequest{
+		Compare: []*pb.Compare{{
+			Key:         []byte(key),
+			Target:      pb.Compare_MOD,
+			Result:      pb.Compare_EQUAL,
+			TargetUnion: &pb.Compare_ModRevision{ModRevision: 0},
+		}},
+		Success: []*pb.RequestOp{{
+			Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte(value)}},
+		}},
+		Failure: []*pb.RequestOp{{
+			Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte(key)}},
+		}},
+	})
+	if err != nil {
+		return 0, err
+	} else if !resp.Succeeded {
+		return 0, fmt.Errorf("write of %s was not acknowledged", key)
+	}
+	return resp.Header.Revision, nil
+}
+
+// kill crashes the server: its S3 requests fail from then on, as its
+// process has gone, and its local database is closed as-is
+func (s *chaosServer) kill() {
+	s.bucket.inject(s.name, func(f *chaosFaults) {
+		f.down = true
+	})
+	s.stop()
+}
+
+// stop stops the server
+func (s *chaosServer) stop() {
+	s.close.Do(func() {
+		if s.server != nil {
+			s.server.Close()
+		} else {
+			s.db.Close()
+		}
+	})
+}
+
+// restart starts the server again from its local database, with the
+// faults injected into its requests cleared
+func (s *chaosServer) restart(t *testing.T) *chaosServer {
+	t.Helper()
+	s.kill()
+	s.bucket.inject(s.name, func(f *chaosFaults) {
+		*f = chaosFaults{}
+	})
+	return startChaosServer(t, s.bucket, s.name, s.dataDir)
+}
+
+// chaosWrite is a write acknowledged to a client
+type chaosWrite struct {
+	revision int64
+	key      string
+	value    string
+}
+
+// checkChaosInvariants checks that no revision committed to S3 was assigned
+// to more than one record, and that every acknowledged write is in S3 at
+// its revision, by backfilling a new server from the bucket. The records of
+// each server in servers must match those in S3.
+func checkChaosInvariants(t *testing.T, bucket *chaosBucket, acked []chaosWrite, servers ...*chaosServer) {
+	t.Helper()
+	var last int64
+	for _, chunk := range bucket.chunks() {
+		if chunk[0] <= last {
+			t.Errorf("chunk of revisions %d-%d overlaps an earlier chunk ending at revision %d", chunk[0], chunk[1], last)
+		}
+		last = chunk[1]
+	}
+	revisions := map[int64]chaosWrite{}
+	for _, write := range acked {
+		if other, ok := revisions[write.revision]; ok {
+			t.Errorf("revision %d was acknowledged for both %s and %s", write.revision, other.key, write.key)
+		}
+		revisions[write.revision] = write
+	}
+
+	// backfill fails unless the records in S3 have consecutive revisions
+	verifier := startChaosServer(t, bucket, "verifier", t.TempDir())
+	defer verifier.stop()
+	records, err := verifier.db.FindRecordsFrom(0, -1)
+	if err != nil {
+		t.Fatalf("FindRecordsFrom: %v", err)
+	}
+	for _, write := range acked {
+		record, err := verifier.db.FindRecordByRev(write.revision)
+		if err != nil || record == nil || string(record.Key) != write.key || string(record.Value) != write.value {
+			t.Errorf("acknowledged write of %s at revision %d is not in S3, found %v (%v)", write.key, write.revision, record, err)
+		}
+	}
+	for _, s := range servers {
+		local, err := s.db.FindRecordsFrom(0, -1)
+		if err != nil {
+			t.Fatalf("%s: FindRecordsFrom: %v", s.name, err)
+		}
+		if len(local) != len(records) {
+			t.Errorf("%s has %d records, S3 has %d", s.name, len(local), len(records))
+			continue
+		}
+		for i, record := range local {
+			if record.Revision != records[i].Revision || !bytes.Equal(record.Key, records[i].Key) || !bytes.Equal(record.Value, records[i].Value) {
+				t.Errorf("%s has %s at revision %d, S3 has %s at revision %d", s.name, record.Key, record.Revision, records[i].Key, records[i].Revision)
+			}
+		}
+	}
+}
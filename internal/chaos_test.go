@@ -0,0 +1,248 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The chaos tests check that replication to S3 in synchronous mode holds up
+// to crashes, S3 faults and partitions: no write acknowledged to a client
+// is lost, and no revision is assigned to more than one record (see
+// checkChaosInvariants). Changes to replication must keep them passing:
+//
+//	go test ./internal -run Chaos
+
+// createAll creates n keys named prefix-i on s, failing the test unless
+// every write is acknowledged
+func createAll(t *testing.T, s *chaosServer, prefix string, n int) (acked []chaosWrite) {
+	t.Helper()
+	for i := range n {
+		key, value := fmt.Sprintf("%s-%d", prefix, i), fmt.Sprintf("value-%d", i)
+		revision, err := s.create(key, value)
+		if err != nil {
+			t.Fatalf("%s: create %s: %v", s.name, key, err)
+		}
+		acked = append(acked, chaosWrite{revision: revision, key: key, value: value})
+	}
+	return acked
+}
+
+// TestChaosKillLeader kills the leader part way through a transaction,
+// either before or after its chunk is written to S3, then either restarts
+// it from its local database or fails over to a new server
+func TestChaosKillLeader(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		afterWrite bool
+		failover   bool
+	}{
+		{"before upload, restart", false, false},
+		{"after upload, restart", true, false},
+		{"before upload, failover", false, true},
+		{"after upload, failover", true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			bucket := newChaosBucket(t)
+			leader := startChaosServer(t, bucket, "leader", t.TempDir())
+			acked := createAll(t, leader, "before", 3)
+
+			// the transaction inserting revision 4 is never committed
+			// locally, as the leader crashes while uploading it
+			bucket.inject("leader", func(f *chaosFaults) {
+				f.crashAt = 4
+				f.crashAfterWrite = test.afterWrite
+			})
+			if revision, err := leader.create("crash", "value"); err == nil {
+				t.Fatalf("expected the write to fail as the leader crashed, got revision %d", revision)
+			}
+			leader.kill()
+
+			var next *chaosServer
+			if test.failover {
+				next = startChaosServer(t, bucket, "next", t.TempDir())
+			} else {
+				next = leader.restart(t)
+			}
+			// the write in flight was not acknowledged, so may or may not
+			// have been committed, but once it was written to S3 the next
+			// leader must not assign its revision again
+			expected := int64(4)
+			if test.afterWrite {
+				expected = 5
+			}
+			after := createAll(t, next, "after", 3)
+			if after[0].revision != expected {
+				t.Errorf("expected the next write at revision %d, got %d", expected, after[0].revision)
+			}
+			checkChaosInvariants(t, bucket, append(acked, after...), next)
+		})
+	}
+}
+
+// TestChaosS3Errors injects S3 upload errors, including uploads which are
+// written but whose responses are lost, and an S3 outage
+func TestChaosS3Errors(t *testing.T) {
+	bucket := newChaosBucket(t)
+	leader := startChaosServer(t, bucket, "leader", t.TempDir())
+	acked := createAll(t, leader, "healthy", 2)
+
+	// a failed upload is retried
+	bucket.inject("leader", func(f *chaosFaults) {
+		f.failUploads = 1
+	})
+	acked = append(acked, createAll(t, leader, "failed", 1)...)
+
+	// an upload whose response is lost is found to be written when retried
+	bucket.inject("leader", func(f *chaosFaults) {
+		f.loseUploads = 1
+	})
+	acked = append(acked, createAll(t, leader, "lost", 1)...)
+
+	// writes fail while S3 is down, and none are committed
+	latest, err := leader.db.LatestRevision()
+	if err != nil {
+		t.Fatalf("LatestRevision: %v", err)
+	}
+	bucket.inject("leader", func(f *chaosFaults) {
+		f.down = true
+	})
+	for i := range 5 {
+		if revision, err := leader.create(fmt.Sprintf("outage-%d", i), "value"); err == nil {
+			t.Fatalf("expected the write to fail while S3 is down, got revision %d", revision)
+		}
+	}
+	if revision, err := leader.db.LatestRevision(); err != nil || revision != latest {
+		t.Fatalf("expected no writes committed while S3 is down, latest revision %d (%v)", revision, err)
+	}
+
+	// writes resume once S3 recovers, at the next revision
+	bucket.inject("leader", func(f *chaosFaults) {
+		f.down = false
+	})
+	recovered := createAll(t, leader, "recovered", 2)
+	if recovered[0].revision != latest+1 {
+		t.Errorf("expected writes to resume at revision %d, got %d", latest+1, recovered[0].revision)
+	}
+	checkChaosInvariants(t, bucket, append(acked, recovered...), leader)
+}
+
+// TestChaosS3Latency writes concurrently while S3 uploads are slow, so that
+// writes queue behind each other's uploads
+func TestChaosS3Latency(t *testing.T) {
+	bucket := newChaosBucket(t)
+	leader := startChaosServer(t, bucket, "leader", t.TempDir())
+	bucket.inject("leader", func(f *chaosFaults) {
+		f.latency = 5 * time.Millisecond
+	})
+
+	const writers, writes = 4, 10
+	var mu sync.Mutex
+	var acked []chaosWrite
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range writes {
+				key, value := fmt.Sprintf("writer-%d-%d", w, i), fmt.Sprintf("value-%d", i)
+				revision, err := leader.create(key, value)
+				if err != nil {
+					t.Errorf("create %s: %v", key, err)
+					continue
+				}
+				mu.Lock()
+				acked = append(acked, chaosWrite{revision: revision, key: key, value: value})
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if latest, err := leader.db.LatestRevision(); err != nil || latest != writers*writes {
+		t.Errorf("expected %d revisions, got %d (%v)", writers*writes, latest, err)
+	}
+	checkChaosInvariants(t, bucket, acked, leader)
+}
+
+// TestChaosPartition starts a second leader while the first is still
+// running, as when the first is partitioned from its peers but not from
+// S3, so that both write the same revisions. Only the first write of each
+// revision is acknowledged, and the other leader stops accepting writes.
+func TestChaosPartition(t *testing.T) {
+	bucket := newChaosBucket(t)
+	old := startChaosServer(t, bucket, "old", t.TempDir())
+	acked := createAll(t, old, "old", 2)
+
+	// the new leader backfills the old leader's writes, then both write
+	// revision 3
+	leader := startChaosServer(t, bucket, "new", t.TempDir())
+	acked = append(acked, createAll(t, leader, "new", 1)...)
+	if _, err := old.create("stale", "value"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the old leader's conflicting write to fail with Unavailable, got %v", err)
+	}
+	// the old leader is fenced, rather than assigning later revisions
+	if _, err := old.create("fenced", "value"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the fenced old leader's write to fail with Unavailable, got %v", err)
+	}
+	acked = append(acked, createAll(t, leader, "new-after", 2)...)
+	checkChaosInvariants(t, bucket, acked, leader)
+
+	// once the new leader is stopped, the old leader recovers by restarting,
+	// which backfills the new leader's writes
+	leader.stop()
+	old = old.restart(t)
+	acked = append(acked, createAll(t, old, "recovered", 2)...)
+	checkChaosInvariants(t, bucket, acked, old)
+}
+
+// TestChaosPartitionFollower checks a server which does not write, such as
+// a standby, while the leaders are partitioned: it keeps the records of the
+// old leader it backfilled, none of which are replaced by the new leader,
+// and catches up with the new leader's writes when it restarts, rather than
+// with the old leader's rejected write.
+func TestChaosPartitionFollower(t *testing.T) {
+	bucket := newChaosBucket(t)
+	old := startChaosServer(t, bucket, "old", t.TempDir())
+	acked := createAll(t, old, "old", 2)
+	follower := startChaosServer(t, bucket, "follower", t.TempDir())
+
+	leader := startChaosServer(t, bucket, "new", t.TempDir())
+	acked = append(acked, createAll(t, leader, "new", 1)...)
+	if _, err := old.create("stale", "value"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the old leader's conflicting write to fail with Unavailable, got %v", err)
+	}
+	acked = append(acked, createAll(t, leader, "new-after", 2)...)
+
+	// the follower's records are those of the old leader acknowledged
+	// before the partition
+	records, err := follower.db.FindRecordsFrom(0, -1)
+	if err != nil {
+		t.Fatalf("FindRecordsFrom: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected the follower to have 2 records, got %d", len(records))
+	}
+	for i, record := range records {
+		if record.Revision != acked[i].revision || string(record.Key) != acked[i].key {
+			t.Errorf("expected the follower to have %s at revision %d, got %s at revision %d", acked[i].key, acked[i].revision, record.Key, record.Revision)
+		}
+	}
+
+	// once restarted, it has the new leader's writes, and the old leader's
+	// rejected write is in neither
+	follower = follower.restart(t)
+	stale, err := follower.db.FindKeyRecords([]byte("stale"))
+	if err != nil {
+		t.Fatalf("FindKeyRecords: %v", err)
+	} else if len(stale) != 0 {
+		t.Errorf("expected the old leader's rejected write not to be replicated, got %v", stale)
+	}
+	checkChaosInvariants(t, bucket, acked, leader, follower)
+}
@@ -0,0 +1,63 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// adminIdentities are the TLS client certificate common names allowed to
+// call the Admin API, which is served on the client port. Every client of
+// the client port presents a certificate, so clients such as kube-apiserver
+// must not be able to change the server's state through it.
+type adminIdentities map[string]bool
+
+// newAdminIdentities returns the configured admin_client_identities, or the
+// common name of tls_client_cert if none are configured, which is the
+// certificate netsy commands connect with. If neither is configured, the
+// Admin API is denied to every client.
+func newAdminIdentities(conf *config.Config) (adminIdentities, error) {
+	identities := adminIdentities{}
+	for _, identity := range conf.AdminClientIdentities() {
+		identities[identity] = true
+	}
+	if len(identities) > 0 || conf.TLSClientCert() == "" {
+		return identities, nil
+	}
+	certPEM, err := os.ReadFile(conf.TLSClientCert())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client cert for the Admin API: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode client cert %s for the Admin API", conf.TLSClientCert())
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client cert %s for the Admin API: %w", conf.TLSClientCert(), err)
+	}
+	if cert.Subject.CommonName != "" {
+		identities[cert.Subject.CommonName] = true
+	}
+	return identities, nil
+}
+
+// authorize returns PermissionDenied unless the client in ctx is allowed to
+// call the Admin API
+func (a adminIdentities) authorize(ctx context.Context) error {
+	identity := commonapi.ClientIdentity(ctx)
+	if identity == "" || !a[identity] {
+		return status.Errorf(codes.PermissionDenied, "client %q is not allowed to call the Admin API (see admin_client_identities)", clientIdentity(ctx))
+	}
+	return nil
+}
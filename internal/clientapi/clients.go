@@ -0,0 +1,165 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"golang.org/x/time/rate"
+)
+
+// Clients, such as each kube-apiserver in a fleet, are identified by the
+// common name of their TLS client certificate. Their requests and watchers
+// are counted by identity, and each identity may be given its own watch
+// progress interval and request rate limit (see client_overrides), as
+// apiservers of different versions or sizes may need different settings.
+
+// anonymousClient identifies clients which did not present a certificate
+const anonymousClient = "anonymous"
+
+// clientPolicy holds the settings applied to a client
+type clientPolicy struct {
+	// progressInterval is how often its watchers are sent progress
+	// notifications
+	progressInterval time.Duration
+	// rateLimit is the maximum number of Range and Txn requests per second,
+	// or 0 if unlimited
+	rateLimit int64
+}
+
+// clientPolicies holds the settings of each client, and rate limits their
+// requests
+type clientPolicies struct {
+	defaults  clientPolicy
+	overrides map[string]clientPolicy
+
+	mu sync.Mutex
+	// limiters holds the request rate limiter of each rate limited client,
+	// created on its first request. Identities are those of issued
+	// certificates, so the number of limiters is bounded.
+	limiters map[string]*rate.Limiter
+}
+
+// newClientPolicies creates the client policies from the config, returning
+// an error if the client overrides are invalid
+func newClientPolicies(conf *config.Config) (*clientPolicies, error) {
+	defaults := clientPolicy{
+		progressInterval: time.Duration(conf.WatchProgressIntervalMS()) * time.Millisecond,
+		rateLimit:        conf.RequestClientRateLimit(),
+	}
+	if defaults.progressInterval <= 0 {
+		return nil, fmt.Errorf("watch_progress_interval_ms must be positive")
+	}
+	overrides, err := parseClientOverrides(conf.ClientOverrides(), defaults)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client_overrides: %w", err)
+	}
+	return &clientPolicies{
+		defaults:  defaults,
+		overrides: overrides,
+		limiters:  map[string]*rate.Limiter{},
+	}, nil
+}
+
+// parseClientOverrides parses semicolon-separated client overrides, each of
+// the form identity=setting:value,setting:value. Settings which are not
+// overridden for a client are taken from defaults.
+func parseClientOverrides(s string, defaults clientPolicy) (overrides map[string]clientPolicy, err error) {
+	overrides = map[string]clientPolicy{}
+	for _, entry := range strings.Split(s, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		// identities may contain colons, e.g. system:kube-apiserver, so
+		// are separated from their settings by the first equals sign
+		identity, settings, ok := strings.Cut(entry, "=")
+		identity = strings.TrimSpace(identity)
+		if !ok || identity == "" {
+			return nil, fmt.Errorf("expected identity=setting:value in %q", entry)
+		}
+		if _, ok := overrides[identity]; ok {
+			return nil, fmt.Errorf("duplicate client %q", identity)
+		}
+		policy := defaults
+		for _, setting := range strings.Split(settings, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(setting), ":")
+			if !ok {
+				return nil, fmt.Errorf("expected setting:value in %q for client %q", setting, identity)
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid value %q of %s for client %q", value, name, identity)
+			}
+			switch strings.TrimSpace(name) {
+			case "watch_progress_interval_ms":
+				if n == 0 {
+					return nil, fmt.Errorf("watch_progress_interval_ms must be positive for client %q", identity)
+				}
+				policy.progressInterval = time.Duration(n) * time.Millisecond
+			case "request_client_rate_limit":
+				policy.rateLimit = n
+			default:
+				return nil, fmt.Errorf("unknown setting %q for client %q", name, identity)
+			}
+		}
+		overrides[identity] = policy
+	}
+	return overrides, nil
+}
+
+// clientIdentity returns the identity of the client in ctx, used as its
+// metric label and to look up its policy
+func clientIdentity(ctx context.Context) string {
+	if identity := commonapi.ClientIdentity(ctx); identity != "" {
+		return identity
+	}
+	return anonymousClient
+}
+
+// policy returns the settings of the client with identity
+func (p *clientPolicies) policy(identity string) clientPolicy {
+	if policy, ok := p.overrides[identity]; ok {
+		return policy
+	}
+	return p.defaults
+}
+
+// admit counts a read or write request from the client with identity,
+// returning an error if the client has exceeded its rate limit. Requests
+// made by netsy itself, such as deleting the keys of expired leases, are
+// not clients' requests, so are neither counted nor limited.
+func (p *clientPolicies) admit(ctx context.Context, identity string, write bool) error {
+	if commonapi.InternalCaller(ctx) != "" {
+		return nil
+	}
+	kind := "read"
+	if write {
+		kind = "write"
+	}
+	limit := p.policy(identity).rateLimit
+	if limit > 0 {
+		p.mu.Lock()
+		limiter, ok := p.limiters[identity]
+		if !ok {
+			limiter = rate.NewLimiter(rate.Limit(limit), int(limit))
+			p.limiters[identity] = limiter
+		}
+		p.mu.Unlock()
+		if !limiter.Allow() {
+			metrics.ClientRequestsThrottled.WithLabelValues(identity, kind).Inc()
+			return rpctypes.ErrGRPCRequestTooManyRequests
+		}
+	}
+	metrics.ClientRequests.WithLabelValues(identity, kind).Inc()
+	return nil
+}
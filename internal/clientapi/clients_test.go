@@ -0,0 +1,104 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseClientOverrides(t *testing.T) {
+	defaults := clientPolicy{progressInterval: 5 * time.Second}
+	overrides, err := parseClientOverrides(" apiserver-a=watch_progress_interval_ms:1000, request_client_rate_limit:500 ;system:kube-apiserver=request_client_rate_limit:100;", defaults)
+	if err != nil {
+		t.Fatalf("parseClientOverrides: %v", err)
+	}
+	expect := map[string]clientPolicy{
+		"apiserver-a":           {progressInterval: time.Second, rateLimit: 500},
+		"system:kube-apiserver": {progressInterval: 5 * time.Second, rateLimit: 100},
+	}
+	if len(overrides) != len(expect) {
+		t.Fatalf("expected %d overrides, got %v", len(expect), overrides)
+	}
+	for identity, policy := range expect {
+		if overrides[identity] != policy {
+			t.Errorf("override of %q = %+v, want %+v", identity, overrides[identity], policy)
+		}
+	}
+
+	for _, invalid := range []string{
+		"apiserver-a",
+		"=request_client_rate_limit:1",
+		"apiserver-a=request_client_rate_limit",
+		"apiserver-a=request_client_rate_limit:-1",
+		"apiserver-a=watch_progress_interval_ms:0",
+		"apiserver-a=unknown:1",
+		"apiserver-a=request_client_rate_limit:1;apiserver-a=request_client_rate_limit:2",
+	} {
+		if _, err := parseClientOverrides(invalid, defaults); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestNewClientPolicies(t *testing.T) {
+	configtest.Set(t, map[string]any{
+		"watch_progress_interval_ms": 2000,
+		"client_overrides":           "apiserver-a=request_client_rate_limit:10",
+	})
+	p, err := newClientPolicies(&config.Config{})
+	if err != nil {
+		t.Fatalf("newClientPolicies: %v", err)
+	}
+	// overrides inherit the configured progress interval
+	if p.policy("apiserver-a").progressInterval != 2*time.Second || p.policy("apiserver-b").progressInterval != 2*time.Second {
+		t.Errorf("expected progress intervals of 2s, got %v and %v", p.policy("apiserver-a"), p.policy("apiserver-b"))
+	}
+
+	viper.Set("watch_progress_interval_ms", 0)
+	if _, err = newClientPolicies(&config.Config{}); err == nil {
+		t.Errorf("expected an error for a progress interval of 0")
+	}
+}
+
+func TestClientPoliciesAdmit(t *testing.T) {
+	p := &clientPolicies{
+		defaults:  clientPolicy{progressInterval: 5 * time.Second},
+		overrides: map[string]clientPolicy{"apiserver-a": {progressInterval: time.Second, rateLimit: 2}},
+		limiters:  map[string]*rate.Limiter{},
+	}
+	if p.policy("apiserver-a").progressInterval != time.Second || p.policy("apiserver-b").progressInterval != 5*time.Second {
+		t.Fatalf("expected progress intervals of 1s and 5s, got %v and %v", p.policy("apiserver-a"), p.policy("apiserver-b"))
+	}
+
+	// requests beyond the burst are rejected, for the overridden client only
+	for i := 0; i < 2; i++ {
+		if err := p.admit(context.Background(), "apiserver-a", false); err != nil {
+			t.Fatalf("expected request %d to be admitted, got %v", i, err)
+		}
+	}
+	if err := p.admit(context.Background(), "apiserver-a", true); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected request to be rejected as too many requests, got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := p.admit(context.Background(), "apiserver-b", true); err != nil {
+			t.Fatalf("expected unlimited client's request %d to be admitted, got %v", i, err)
+		}
+	}
+
+	// requests made by netsy itself, e.g. when leases expire, are not limited
+	internal := commonapi.WithInternalCaller(context.Background(), "lease_expired")
+	if err := p.admit(internal, "apiserver-a", true); err != nil {
+		t.Fatalf("expected internal request to be admitted, got %v", err)
+	}
+}
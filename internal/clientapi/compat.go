@@ -0,0 +1,68 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"fmt"
+
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// etcdCompat holds the behaviour which differs between the etcd minor
+// versions netsy can emulate. kube-apiserver keys some of its behaviour off
+// the version reported by Status, so responses should be consistent with it.
+type etcdCompat struct {
+	// version is the full etcd server version reported by Status
+	version string
+	// progressBroadcast permits interval progress notifications to be sent as
+	// a single broadcast (watch ID -1) when all watches on a stream have
+	// progress notify enabled. etcd v3.4 only sends these per watch.
+	progressBroadcast bool
+	// compactedReason is the cancel reason sent when a watch start revision
+	// has been compacted
+	compactedReason string
+	// raftAppliedIndex is whether Status includes raft_applied_index, which
+	// was added in etcd v3.5
+	raftAppliedIndex bool
+}
+
+// newEtcdCompat returns the compatibility settings for an etcd minor version
+func newEtcdCompat(minorVersion string) (*etcdCompat, error) {
+	switch minorVersion {
+	case "3.4":
+		return &etcdCompat{
+			version:           "3.4.34",
+			progressBroadcast: false,
+			compactedReason:   "mvcc: required revision has been compacted",
+			raftAppliedIndex:  false,
+		}, nil
+	case "3.5":
+		return &etcdCompat{
+			version:           "3.5.16",
+			progressBroadcast: true,
+			compactedReason:   "etcdserver: mvcc: required revision has been compacted",
+			raftAppliedIndex:  true,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported etcd version %q", minorVersion)
+}
+
+// statusResponse builds a Status response for the emulated version.
+// As netsy does not use raft, the latest revision is reported as the raft
+// index, which only ever increases like a real raft index.
+func (c *etcdCompat) statusResponse(header commonapi.ResponseHeader, dbSize localdb.SizeStats, latestRevision int64) *pb.StatusResponse {
+	resp := &pb.StatusResponse{
+		Header:      header.At(latestRevision),
+		Version:     c.version,
+		DbSize:      dbSize.Size(),
+		DbSizeInUse: dbSize.SizeInUse(),
+		RaftIndex:   uint64(latestRevision),
+	}
+	if c.raftAppliedIndex {
+		resp.RaftAppliedIndex = uint64(latestRevision)
+	}
+	return resp
+}
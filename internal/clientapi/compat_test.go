@@ -0,0 +1,56 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/localdb"
+)
+
+func TestEtcdCompat(t *testing.T) {
+	dbSize := localdb.SizeStats{PageSize: 4096, PageCount: 10, FreelistCount: 4}
+	tests := []struct {
+		minorVersion      string
+		version           string
+		progressBroadcast bool
+		compactedReason   string
+		raftAppliedIndex  uint64
+	}{
+		{"3.4", "3.4.34", false, "mvcc: required revision has been compacted", 0},
+		{"3.5", "3.5.16", true, "etcdserver: mvcc: required revision has been compacted", 42},
+	}
+	for _, test := range tests {
+		t.Run(test.minorVersion, func(t *testing.T) {
+			c, err := newEtcdCompat(test.minorVersion)
+			if err != nil {
+				t.Fatalf("newEtcdCompat(%q) error: %v", test.minorVersion, err)
+			}
+			if c.progressBroadcast != test.progressBroadcast {
+				t.Errorf("progressBroadcast = %t, want %t", c.progressBroadcast, test.progressBroadcast)
+			}
+			if c.compactedReason != test.compactedReason {
+				t.Errorf("compactedReason = %q, want %q", c.compactedReason, test.compactedReason)
+			}
+			resp := c.statusResponse(commonapi.ResponseHeader{}, dbSize, 42)
+			if resp.Version != test.version {
+				t.Errorf("Version = %q, want %q", resp.Version, test.version)
+			}
+			if resp.Header.Revision != 42 || resp.RaftIndex != 42 {
+				t.Errorf("Header.Revision = %d, RaftIndex = %d, want 42", resp.Header.Revision, resp.RaftIndex)
+			}
+			if resp.RaftAppliedIndex != test.raftAppliedIndex {
+				t.Errorf("RaftAppliedIndex = %d, want %d", resp.RaftAppliedIndex, test.raftAppliedIndex)
+			}
+			if resp.DbSize != 40960 || resp.DbSizeInUse != 24576 {
+				t.Errorf("DbSize = %d, DbSizeInUse = %d, want 40960, 24576", resp.DbSize, resp.DbSizeInUse)
+			}
+		})
+	}
+
+	if _, err := newEtcdCompat("3.6"); err == nil {
+		t.Errorf("expected error for unsupported version")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"sync"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/hooks"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+// leaderEpoch fences the distribution of watch events across leader changes.
+// Each leader term has an epoch, which only increases. Events are distributed
+// while holding the read lock, and the epoch is advanced while holding the
+// write lock, so advancing the epoch waits for in-flight distribution from
+// the old epoch to finish, and any events from the old epoch which arrive
+// later are dropped rather than interleaved with the new leader's events.
+type leaderEpoch struct {
+	sync.RWMutex
+	epoch int64
+}
+
+// LeaderEpoch returns the current leader epoch. Callers which distribute
+// events should capture it before writing, and pass it to DistributeAt.
+func (cs *ClientAPIServer) LeaderEpoch() int64 {
+	cs.epoch.RLock()
+	defer cs.epoch.RUnlock()
+	return cs.epoch.epoch
+}
+
+// AdvanceLeaderEpoch moves to a new leader epoch, once in-flight distribution
+// for the current epoch has finished, then fires the leader change hooks. It
+// returns false (and does nothing) if epoch is not newer than the current
+// epoch.
+func (cs *ClientAPIServer) AdvanceLeaderEpoch(epoch int64) bool {
+	cs.epoch.Lock()
+	if epoch <= cs.epoch.epoch {
+		cs.epoch.Unlock()
+		return false
+	}
+	level.Info(cs.logger).Log("msg", "leader epoch advanced", "from", cs.epoch.epoch, "to", epoch)
+	previous := cs.epoch.epoch
+	cs.epoch.epoch = epoch
+	if cs.s3Client != nil {
+		cs.s3Client.SetLeaderEpoch(epoch)
+	}
+	cs.epoch.Unlock()
+	// hooks are fired without the lock, so that they do not block writes
+	cs.hooks.FireLeaderChange(hooks.LeaderChange{Epoch: epoch, PreviousEpoch: previous})
+	return true
+}
+
+// DistributeAt distributes a record to watchers if it was written in the
+// current leader epoch, otherwise the record is dropped. It returns true if
+// the record was distributed.
+func (cs *ClientAPIServer) DistributeAt(epoch int64, record *proto.Record, prevRecord *proto.Record) bool {
+	if record == nil {
+		return false
+	}
+	cs.epoch.RLock()
+	defer cs.epoch.RUnlock()
+	if epoch != cs.epoch.epoch {
+		level.Warn(cs.logger).Log("msg", "dropping watch event from stale leader epoch", "epoch", epoch, "current", cs.epoch.epoch, "rev", record.Revision)
+		metrics.WatchEventsFenced.Inc()
+		return false
+	}
+	cs.Distribute(record, prevRecord)
+	return true
+}
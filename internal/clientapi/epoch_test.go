@@ -0,0 +1,115 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/hooks"
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+// newTestWatcher registers a watcher with a single watch on key, returning
+// its inbox. It is removed from allWatchers when the test ends.
+func newTestWatcher(t *testing.T, key string, inboxSize int) chan inboxMsg {
+	t.Helper()
+	w := &watcher{
+		id:      -1,
+		inboxOk: true,
+		inboxCh: make(chan inboxMsg, inboxSize),
+		watches: map[int64]watch{1: {key: []byte(key), cancel: func() {}}},
+	}
+	allWatchers.Lock()
+	allWatchers.servers[w.id] = w
+	allWatchers.Unlock()
+	t.Cleanup(func() {
+		allWatchers.Lock()
+		delete(allWatchers.servers, w.id)
+		allWatchers.Unlock()
+	})
+	return w.inboxCh
+}
+
+func TestDistributeAtDropsStaleEpoch(t *testing.T) {
+	cs := &ClientAPIServer{logger: log.NewNopLogger()}
+	var changes []hooks.LeaderChange
+	cs.SetHooks(hooks.New())
+	cs.hooks.OnLeaderChange(func(l hooks.LeaderChange) {
+		changes = append(changes, l)
+	})
+	inbox := newTestWatcher(t, "a", 10)
+
+	stale := cs.LeaderEpoch()
+	if !cs.AdvanceLeaderEpoch(stale + 1) {
+		t.Fatal("AdvanceLeaderEpoch returned false for newer epoch")
+	}
+	if cs.AdvanceLeaderEpoch(stale) {
+		t.Fatal("AdvanceLeaderEpoch returned true for older epoch")
+	}
+	if len(changes) != 1 || changes[0] != (hooks.LeaderChange{Epoch: stale + 1, PreviousEpoch: stale}) {
+		t.Fatalf("expected one leader change hook call, got %+v", changes)
+	}
+
+	if cs.DistributeAt(stale, &proto.Record{Revision: 1, Key: []byte("a")}, nil) {
+		t.Error("DistributeAt distributed record from stale epoch")
+	}
+	if !cs.DistributeAt(stale+1, &proto.Record{Revision: 2, Key: []byte("a")}, nil) {
+		t.Error("DistributeAt dropped record from current epoch")
+	}
+
+	if len(inbox) != 1 {
+		t.Fatalf("inbox has %d messages, want 1", len(inbox))
+	}
+	if msg := <-inbox; msg.Header.Revision != 2 {
+		t.Errorf("received revision %d, want 2", msg.Header.Revision)
+	}
+}
+
+func TestAdvanceLeaderEpochWaitsForInFlightDistribute(t *testing.T) {
+	cs := &ClientAPIServer{logger: log.NewNopLogger()}
+	inbox := newTestWatcher(t, "a", 1)
+	// lock the watcher, so Distribute blocks until it is unlocked
+	allWatchers.RLock()
+	w := allWatchers.servers[-1]
+	allWatchers.RUnlock()
+	w.Lock()
+
+	distributed := make(chan bool)
+	go func() {
+		distributed <- cs.DistributeAt(0, &proto.Record{Revision: 1, Key: []byte("a")}, nil)
+	}()
+
+	// wait until the distribute is in flight, holding the epoch read lock
+	for cs.epoch.TryLock() {
+		cs.epoch.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	advanced := make(chan struct{})
+	go func() {
+		cs.AdvanceLeaderEpoch(1)
+		close(advanced)
+	}()
+	select {
+	case <-advanced:
+		t.Fatal("AdvanceLeaderEpoch did not wait for in-flight DistributeAt")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w.Unlock()
+	if msg := <-inbox; msg.Header.Revision != 1 {
+		t.Errorf("received revision %d, want 1", msg.Header.Revision)
+	}
+	if !<-distributed {
+		t.Error("in-flight DistributeAt was dropped")
+	}
+	<-advanced
+
+	// later events from the old epoch are fenced
+	if cs.DistributeAt(0, &proto.Record{Revision: 2, Key: []byte("a")}, nil) {
+		t.Error("DistributeAt distributed record from stale epoch after advance")
+	}
+}
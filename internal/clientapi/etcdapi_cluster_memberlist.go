@@ -11,9 +11,10 @@ import (
 
 func (cs *ClientAPIServer) MemberList(ctx context.Context, r *pb.MemberListRequest) (resp *pb.MemberListResponse, err error) {
 	return &pb.MemberListResponse{
-		Header: &pb.ResponseHeader{},
+		Header: cs.header.At(0),
 		Members: []*pb.Member{
 			{
+				ID:         cs.header.MemberID(),
 				Name:       "netsy",
 				ClientURLs: []string{cs.config.ListenClientsAddr()},
 				PeerURLs:   []string{cs.config.ListenClientsAddr()},
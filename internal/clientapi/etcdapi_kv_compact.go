@@ -0,0 +1,62 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/peerapi"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Compact compacts the key-value history up to the given revision, as called
+// periodically by the kube-apiserver compactor. As with etcd, compacting to
+// a revision at or before the current compaction revision returns
+// ErrGRPCCompacted (which the compactor treats as another instance having
+// compacted first), and compacting to a future revision returns
+// ErrGRPCFutureRev. When physical is set, the response is sent once space
+// has been reclaimed (see LeaderCompact).
+func (cs *ClientAPIServer) Compact(ctx context.Context, r *pb.CompactionRequest) (resp *pb.CompactionResponse, err error) {
+	if r.Revision < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "revision must be non-negative")
+	}
+	if cs.proxy != nil {
+		return cs.proxyCompact(ctx, r)
+	}
+
+	_, err = cs.peerServer.LeaderCompact(ctx, r.Revision, r.Physical)
+	if errors.Is(err, peerapi.ErrCompacted) {
+		level.Debug(cs.logger).Log("msg", "compact", "error", err)
+		return nil, rpctypes.ErrGRPCCompacted
+	} else if errors.Is(err, peerapi.ErrFutureRevision) {
+		level.Debug(cs.logger).Log("msg", "compact", "error", err)
+		return nil, rpctypes.ErrGRPCFutureRev
+	} else if errors.Is(err, peerapi.ErrWriteFenced) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	} else if err != nil {
+		level.Error(cs.logger).Log("msg", "compact", "revision", r.Revision, "error", err)
+		return nil, status.Errorf(codes.Internal, "compaction failed: %v", err)
+	}
+
+	latestRevision, err := cs.db.LatestRevision()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CompactionResponse{
+		Header: cs.header.At(latestRevision),
+	}, nil
+}
+
+// CompactTo compacts the key-value history up to revision, as Compact does
+// but without a client request, e.g. for periodic compaction. It returns the
+// number of records compacted.
+func (cs *ClientAPIServer) CompactTo(ctx context.Context, revision int64) (compacted int64, err error) {
+	return cs.peerServer.LeaderCompact(commonapi.WithInternalCaller(ctx, "compaction"), revision, false)
+}
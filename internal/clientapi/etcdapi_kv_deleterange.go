@@ -0,0 +1,76 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/peerapi"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeleteRange deletes a key, or the keys in a range (e.g. etcdctl del
+// --prefix). Kubernetes deletes keys with Txn instead.
+func (cs *ClientAPIServer) DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (resp *pb.DeleteRangeResponse, err error) {
+	defer func() {
+		cs.loadAuditor().OnDeleteRange(ctx, r, resp, err)
+	}()
+	if len(r.Key) == 0 {
+		return nil, rpctypes.ErrGRPCEmptyKey
+	}
+	if err = cs.keyAllowlist.checkDeleteRange(r.Key, r.RangeEnd); err != nil {
+		return nil, err
+	}
+
+	identity := clientIdentity(ctx)
+	reads := cs.readRules.policy(identity)
+	if err = reads.checkRange(r.Key, r.RangeEnd); err != nil {
+		return nil, err
+	}
+	defer func() {
+		reads.redactDeleteRange(resp)
+	}()
+
+	if err = cs.clients.admit(ctx, identity, true); err != nil {
+		return nil, err
+	}
+	release, err := cs.admission.acquire(ctx, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if cs.proxy != nil {
+		return cs.proxyDeleteRange(ctx, r)
+	}
+
+	// Capture the leader epoch before writing, as for Txn
+	epoch := cs.LeaderEpoch()
+	inserted, resp, err := cs.peerServer.LeaderDeleteRange(ctx, r)
+	if errors.Is(err, peerapi.ErrWriteFenced) || errors.Is(err, peerapi.ErrS3Unavailable) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	} else if errors.Is(err, peerapi.ErrS3UploadFailed) {
+		// repeated S3 upload failures are logged by the leader
+		level.Debug(cs.logger).Log("deleterangeerror", err.Error())
+		return nil, status.Error(codes.Unavailable, err.Error())
+	} else if err != nil {
+		cs.logger.Log("deleterangeerror", err.Error())
+		return nil, err
+	}
+	if len(inserted) > 0 {
+		level.Debug(cs.logger).Log("deleterange", keys.Key(r.Key), "range_end", keys.Key(r.RangeEnd), "deleted", len(inserted), "rev", resp.Header.Revision)
+	}
+	// Replicate to watchers, which receive a DELETE event for each key
+	for _, record := range inserted {
+		cs.DistributeAt(epoch, record, cs.findPrevRecord(record))
+		cs.fireCommitHooks(record)
+		cs.namespaces.record(record)
+	}
+	return resp, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nadrama-com/netsy/hooks"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+func TestDeleteRange(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	h := hooks.New()
+	var deleted []string
+	h.OnCommit(func(c hooks.Commit) {
+		if c.Deleted {
+			deleted = append(deleted, string(c.Key))
+		}
+	})
+	cs.SetHooks(h)
+	ctx := context.Background()
+	for _, key := range []string{"/registry/pods/a", "/registry/pods/b", "/registry/pods/c", "/registry/services/a"} {
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte("v")}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	// deleting a prefix deletes each key under it, at consecutive revisions
+	prefix := "/registry/pods/"
+	resp, err := cs.DeleteRange(ctx, &pb.DeleteRangeRequest{
+		Key:      []byte(prefix),
+		RangeEnd: []byte(clientv3.GetPrefixRangeEnd(prefix)),
+		PrevKv:   true,
+	})
+	if err != nil {
+		t.Fatalf("DeleteRange: %v", err)
+	}
+	if resp.Deleted != 3 || len(resp.PrevKvs) != 3 || string(resp.PrevKvs[0].Value) != "v" {
+		t.Fatalf("expected 3 keys deleted with their previous values, got %v", resp)
+	}
+	if resp.Header.Revision != 7 {
+		t.Fatalf("expected header revision 7, got %d", resp.Header.Revision)
+	}
+	if len(deleted) != 3 || deleted[0] != "/registry/pods/a" || deleted[2] != "/registry/pods/c" {
+		t.Fatalf("expected commit hooks for each deleted key, got %v", deleted)
+	}
+	rangeResp, err := cs.Range(ctx, &pb.RangeRequest{Key: []byte("/registry/"), RangeEnd: []byte(clientv3.GetPrefixRangeEnd("/registry/"))})
+	if err != nil || len(rangeResp.Kvs) != 1 || string(rangeResp.Kvs[0].Key) != "/registry/services/a" {
+		t.Fatalf("expected only keys outside the prefix to remain, got %v (%v)", rangeResp, err)
+	}
+
+	// deleting a missing key deletes nothing
+	resp, err = cs.DeleteRange(ctx, &pb.DeleteRangeRequest{Key: []byte("/registry/pods/a")})
+	if err != nil || resp.Deleted != 0 || resp.Header.Revision != 7 {
+		t.Fatalf("expected no keys deleted at revision 7, got %v (%v)", resp, err)
+	}
+}
@@ -5,11 +5,114 @@ package clientapi
 
 import (
 	"context"
+	"errors"
+	"math/rand"
 
+	"github.com/go-kit/log/level"
 	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/metrics"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 )
 
-func (cs *ClientAPIServer) Range(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
-	return commonapi.Range(cs.db, ctx, r)
+func (cs *ClientAPIServer) Range(ctx context.Context, r *pb.RangeRequest) (resp *pb.RangeResponse, err error) {
+	defer func() {
+		cs.loadAuditor().OnRange(ctx, r, resp, err)
+	}()
+	identity := clientIdentity(ctx)
+	reads := cs.readRules.policy(identity)
+	if err = reads.checkRange(r.Key, r.RangeEnd); err != nil {
+		return nil, err
+	}
+	if err = cs.clients.admit(ctx, identity, false); err != nil {
+		return nil, err
+	}
+	cacheKey, cacheable := rangeCacheKey(r)
+	cacheable = cacheable && cs.rangeCache != nil
+	if cacheable {
+		if resp = cs.cachedRange(ctx, cacheKey, r); resp != nil {
+			reads.redactRange(resp)
+			return resp, nil
+		}
+	}
+	release, err := cs.admission.acquire(ctx, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err = commonapi.Range(cs.db, cs.header, cs.values, ctx, r)
+	// responses at future revisions change as they are written
+	if err == nil && cacheable && r.Revision <= resp.Header.Revision {
+		cs.rangeCache.add(cacheKey, resp)
+	}
+	reads.redactRange(resp)
+	return resp, err
+}
+
+// cachedRange returns the cached response to Range request r with cacheKey,
+// with a header at the latest revision, or nil if it is not cached. Responses
+// at a compacted revision are evicted, so that the request fails as
+// compacted (unless none of its keys were compacted). A sample of responses
+// are verified against the local db (see verifyCachedRange).
+func (cs *ClientAPIServer) cachedRange(ctx context.Context, cacheKey string, r *pb.RangeRequest) *pb.RangeResponse {
+	revision := r.Revision
+	resp, ok := cs.rangeCache.get(cacheKey)
+	if !ok {
+		metrics.RangeCacheRequests.WithLabelValues("miss").Inc()
+		return nil
+	}
+	compactRevision, err := cs.db.CompactRevision()
+	if err == nil && revision < compactRevision {
+		cs.rangeCache.evict(cacheKey)
+	}
+	latestRevision, latestErr := cs.db.LatestRevision()
+	if err != nil || latestErr != nil || revision < compactRevision {
+		metrics.RangeCacheRequests.WithLabelValues("miss").Inc()
+		return nil
+	}
+	if percent := cs.config.RangeCacheVerifyPercent(); percent > 0 && rand.Int63n(100) < percent && !cs.verifyCachedRange(ctx, cacheKey, r, resp) {
+		metrics.RangeCacheRequests.WithLabelValues("miss").Inc()
+		return nil
+	}
+	metrics.RangeCacheRequests.WithLabelValues("hit").Inc()
+	resp.Header = cs.header.At(latestRevision)
+	return resp
+}
+
+// LocalRange serves a Range request from the local db, without the client
+// checks, admission or caching of Range, for internal readers such as
+// shadow etcd comparisons
+func (cs *ClientAPIServer) LocalRange(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
+	return commonapi.Range(cs.db, cs.header, cs.values, ctx, r)
+}
+
+// verifyCachedRange queries the local db for Range request r, returning
+// false if the response differs from the cached response, which is then
+// evicted. Responses at a past revision should never change, so a mismatch
+// is a bug, e.g. in how compaction removes values, unless the revision was
+// compacted meanwhile. The cached response is assumed to be correct if the
+// local db cannot be queried.
+func (cs *ClientAPIServer) verifyCachedRange(ctx context.Context, cacheKey string, r *pb.RangeRequest, cached *pb.RangeResponse) bool {
+	resp, err := commonapi.Range(cs.db, cs.header, cs.values, ctx, r)
+	if err != nil && !errors.Is(err, rpctypes.ErrGRPCCompacted) {
+		return true
+	}
+	if err == nil && rangeResponseHash(resp) == rangeResponseHash(cached) {
+		metrics.RangeCacheVerifications.WithLabelValues("match").Inc()
+		return true
+	}
+	// the revision may have been compacted since cachedRange checked it
+	if errors.Is(err, rpctypes.ErrGRPCCompacted) {
+		if compactRevision, compactErr := cs.db.CompactRevision(); compactErr == nil && r.Revision < compactRevision {
+			metrics.RangeCacheVerifications.WithLabelValues("compacted").Inc()
+			level.Debug(cs.logger).Log("msg", "cached Range response was compacted while it was verified, evicting it", "key", keys.Key(r.Key), "range_end", keys.Key(r.RangeEnd), "revision", r.Revision, "compact_revision", compactRevision)
+			cs.rangeCache.evict(cacheKey)
+			return false
+		}
+	}
+	metrics.RangeCacheVerifications.WithLabelValues("mismatch").Inc()
+	level.Error(cs.logger).Log("msg", "cached Range response differs from the local db, evicting it", "key", keys.Key(r.Key), "range_end", keys.Key(r.RangeEnd), "revision", r.Revision, "err", err)
+	cs.rangeCache.evict(cacheKey)
+	return false
 }
@@ -6,18 +6,76 @@ package clientapi
 import (
 	"context"
 	"errors"
+	"slices"
 
 	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/keys"
 	"github.com/nadrama-com/netsy/internal/localdb"
-	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/peerapi"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func (cs *ClientAPIServer) Txn(ctx context.Context, r *pb.TxnRequest) (resp *pb.TxnResponse, err error) {
+	defer func() {
+		cs.loadAuditor().OnTxn(ctx, r, resp, err)
+	}()
+	if err = cs.keyAllowlist.checkTxn(r); err != nil {
+		return nil, err
+	}
+
+	if err = cs.checkTxnLeases(r); err != nil {
+		return nil, err
+	}
+
+	identity := clientIdentity(ctx)
+	reads := cs.readRules.policy(identity)
+	if err = reads.checkTxn(r); err != nil {
+		return nil, err
+	}
+	defer func() {
+		reads.redactTxn(resp)
+	}()
+
+	if err = cs.clients.admit(ctx, identity, !commonapi.IsReadOnlyTxn(r)); err != nil {
+		return nil, err
+	}
+
+	release, err := cs.admission.acquire(ctx, txnKey(r))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// In proxy mode, all transactions are forwarded, as the upstream etcd
+	// is the source of truth. Otherwise transactions which only range are
+	// executed locally, without writing a record.
+	if cs.proxy != nil {
+		return cs.proxyTxn(ctx, r)
+	}
+	if commonapi.IsReadOnlyTxn(r) {
+		return commonapi.ReadOnlyTxn(cs.db, cs.header, cs.values, ctx, r)
+	}
+
+	// Capture the leader epoch before writing, so the result is not sent to
+	// watchers if the leader changes while the transaction is in flight
+	epoch := cs.LeaderEpoch()
+
 	// Process transaction on leader
 	inserted, resp, err := cs.peerServer.LeaderTxn(ctx, r)
-	// If any type of error occurs, logs and then always return well-formed error response
-	if err != nil {
+	// If any type of error occurs, logs and then always return well-formed
+	// error response, except when writes are fenced or failing fast because
+	// S3 is unavailable, or the request uses an unsupported etcd feature, so
+	// that clients do not mistake it for a compare failure
+	var unsupported *commonapi.UnsupportedError
+	if errors.Is(err, peerapi.ErrWriteFenced) || errors.Is(err, peerapi.ErrS3Unavailable) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	} else if errors.As(err, &unsupported) {
+		level.Debug(cs.logger).Log("txnerror", err.Error(), "request", r.String())
+		return nil, unsupported
+	} else if err != nil {
 		if errors.Is(err, localdb.ErrCompareRevisionFailed) ||
 			errors.Is(err, localdb.ErrCreateKeyExists) ||
 			errors.Is(err, localdb.ErrDeleteKeyNotFound) {
@@ -26,34 +84,47 @@ func (cs *ClientAPIServer) Txn(ctx context.Context, r *pb.TxnRequest) (resp *pb.
 			} else {
 				level.Info(cs.logger).Log("txnerror", err.Error())
 			}
+		} else if errors.Is(err, peerapi.ErrS3UploadFailed) {
+			// repeated S3 upload failures are logged by the leader
+			level.Debug(cs.logger).Log("txnerror", err.Error())
 		} else {
 			cs.logger.Log("txnerror", err.Error())
 		}
-		// Best-effort latest revision retrieval
-		// If this fails we still want to return a well formed error
-		latestRevision, _ := cs.db.LatestRevision()
-		resp = &pb.TxnResponse{
-			Header: &pb.ResponseHeader{
-				Revision: latestRevision,
-			},
+		// LeaderTxn returns a response with the latest revision in the header
+		// on error, unless the latest revision could not be read, in which
+		// case an error is returned rather than a response with revision 0
+		if resp == nil {
+			return nil, status.Errorf(codes.Unavailable, "unable to determine latest revision: %v", err)
 		}
 	} else if inserted != nil && inserted.Created {
-		level.Debug(cs.logger).Log("txncreated", string(inserted.Key), "rev", string(inserted.Revision))
+		level.Debug(cs.logger).Log("txncreated", keys.Key(inserted.Key), "rev", inserted.Revision)
 	} else if inserted != nil && inserted.Deleted {
-		level.Debug(cs.logger).Log("txndeleted", string(inserted.Key), "rev", string(inserted.Revision))
+		level.Debug(cs.logger).Log("txndeleted", keys.Key(inserted.Key), "rev", inserted.Revision)
 	} else if inserted != nil {
-		level.Debug(cs.logger).Log("txnupdated", string(inserted.Key), "rev", string(inserted.Revision))
+		level.Debug(cs.logger).Log("txnupdated", keys.Key(inserted.Key), "rev", inserted.Revision)
 	}
 	// Replicate to watchers
-	var prevRecord *proto.Record
-	if inserted != nil && !inserted.Created && inserted.PrevRevision > 0 {
-		prevRecord, err = cs.db.FindRecordByRev(inserted.PrevRevision)
-		if err != nil {
-			level.Debug(cs.logger).Log("findprev", string(inserted.Key), "rev", string(inserted.Revision), "prev", string(inserted.PrevRevision), "err", err.Error())
-		}
-	}
 	if inserted != nil {
-		cs.Distribute(inserted, prevRecord)
+		cs.DistributeAt(epoch, inserted, cs.findPrevRecord(inserted))
+		cs.fireCommitHooks(inserted)
+		cs.namespaces.record(inserted)
 	}
 	return resp, nil
 }
+
+// checkTxnLeases returns ErrGRPCLeaseNotFound if either branch of a Txn
+// request attaches a key to a lease which does not exist, as the key would
+// never be deleted. In proxy mode, leases are checked by the upstream etcd.
+func (cs *ClientAPIServer) checkTxnLeases(r *pb.TxnRequest) error {
+	if cs.proxy != nil {
+		return nil
+	}
+	for _, op := range slices.Concat(r.Success, r.Failure) {
+		if put := op.GetRequestPut(); put != nil && put.Lease != 0 {
+			if err := cs.leases.Check(put.Lease); err != nil {
+				return leaseError(err)
+			}
+		}
+	}
+	return nil
+}
@@ -5,40 +5,184 @@ package clientapi
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"io"
 
+	"github.com/nadrama-com/netsy/internal/lease"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// LeaseGrant grants a lease, with a random ID unless one is requested
 func (cs *ClientAPIServer) LeaseGrant(ctx context.Context, r *pb.LeaseGrantRequest) (resp *pb.LeaseGrantResponse, err error) {
-	// TODO
-
-	cs.logger.Log("msg", "lease grant", "TODO", "implement LeaseGrant", "req", fmt.Sprintf("%+v", r))
+	if r.ID < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "lease ID must be non-negative")
+	}
+	if cs.proxy != nil {
+		if resp, err = cs.proxy.Lease().LeaseGrant(ctx, r); err == nil {
+			resp.Header = cs.proxyHeader(resp.Header)
+		}
+		return resp, err
+	}
+	granted, err := cs.leases.Grant(r.ID, r.TTL)
+	if err != nil {
+		return nil, leaseError(err)
+	}
+	header, err := cs.leaseHeader()
+	if err != nil {
+		return nil, err
+	}
 	return &pb.LeaseGrantResponse{
-		Header: &pb.ResponseHeader{},
-		ID:     r.TTL,
-		TTL:    r.TTL,
+		Header: header,
+		ID:     granted.ID,
+		TTL:    granted.TTL,
 	}, nil
 }
 
+// LeaseRevoke revokes a lease, deleting the keys attached to it
 func (cs *ClientAPIServer) LeaseRevoke(ctx context.Context, r *pb.LeaseRevokeRequest) (resp *pb.LeaseRevokeResponse, err error) {
-	cs.logger.Log("TODO", "implement LeaseRevoke")
-	return nil, status.Errorf(codes.Unimplemented, "method LeaseRevoke not implemented")
+	if cs.proxy != nil {
+		if resp, err = cs.proxy.Lease().LeaseRevoke(ctx, r); err == nil {
+			resp.Header = cs.proxyHeader(resp.Header)
+		}
+		return resp, err
+	}
+	if err = cs.leases.Revoke(ctx, r.ID); err != nil {
+		return nil, leaseError(err)
+	}
+	header, err := cs.leaseHeader()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.LeaseRevokeResponse{Header: header}, nil
 }
 
+// LeaseKeepAlive renews each lease requested on the stream for its full
+// TTL, responding with a TTL of 0 for leases which do not exist, as etcd
+// does. As keep alive streams are long-lived, they are ended by Stop.
 func (cs *ClientAPIServer) LeaseKeepAlive(ka pb.Lease_LeaseKeepAliveServer) error {
-	cs.logger.Log("TODO", "implement LeaseKeepAlive")
-	return fmt.Errorf("method LeaseKeepAlive not implemented")
+	if cs.proxy != nil {
+		return cs.proxyLeaseKeepAlive(ka)
+	}
+	// receive requests on a separate goroutine, as Recv cannot be
+	// interrupted, which ends once the stream ends when this returns
+	reqCh := make(chan *pb.LeaseKeepAliveRequest)
+	recvErrCh := make(chan error, 1)
+	cs.goWatch(func() {
+		for {
+			req, err := ka.Recv()
+			if err != nil {
+				recvErrCh <- err
+				return
+			}
+			select {
+			case reqCh <- req:
+			case <-ka.Context().Done():
+				return
+			}
+		}
+	})
+	for {
+		select {
+		case <-cs.stopCtx.Done():
+			return errServerStopping
+		case err := <-recvErrCh:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case req := <-reqCh:
+			ttl, err := cs.leases.KeepAlive(req.ID)
+			if err != nil && !errors.Is(err, lease.ErrLeaseNotFound) {
+				return leaseError(err)
+			}
+			header, err := cs.leaseHeader()
+			if err != nil {
+				return err
+			}
+			if err = ka.Send(&pb.LeaseKeepAliveResponse{Header: header, ID: req.ID, TTL: ttl}); err != nil {
+				return err
+			}
+		}
+	}
 }
 
+// LeaseTimeToLive returns the remaining TTL of a lease, and optionally the
+// keys attached to it. Leases which do not exist have a TTL of -1, as in
+// etcd.
 func (cs *ClientAPIServer) LeaseTimeToLive(ctx context.Context, r *pb.LeaseTimeToLiveRequest) (resp *pb.LeaseTimeToLiveResponse, err error) {
-	cs.logger.Log("TODO", "implement LeaseTimeToLive")
-	return nil, status.Errorf(codes.Unimplemented, "method LeaseTimeToLive not implemented")
+	if cs.proxy != nil {
+		if resp, err = cs.proxy.Lease().LeaseTimeToLive(ctx, r); err == nil {
+			resp.Header = cs.proxyHeader(resp.Header)
+		}
+		return resp, err
+	}
+	header, err := cs.leaseHeader()
+	if err != nil {
+		return nil, err
+	}
+	granted, remaining, err := cs.leases.TimeToLive(r.ID)
+	if errors.Is(err, lease.ErrLeaseNotFound) {
+		return &pb.LeaseTimeToLiveResponse{Header: header, ID: r.ID, TTL: -1}, nil
+	} else if err != nil {
+		return nil, leaseError(err)
+	}
+	resp = &pb.LeaseTimeToLiveResponse{
+		Header:     header,
+		ID:         r.ID,
+		TTL:        remaining,
+		GrantedTTL: granted.TTL,
+	}
+	if r.Keys {
+		if resp.Keys, err = cs.leases.Keys(r.ID); err != nil {
+			return nil, leaseError(err)
+		}
+	}
+	return resp, nil
 }
 
+// LeaseLeases lists all leases
 func (cs *ClientAPIServer) LeaseLeases(ctx context.Context, r *pb.LeaseLeasesRequest) (resp *pb.LeaseLeasesResponse, err error) {
-	cs.logger.Log("TODO", "implement LeaseLeases")
-	return nil, status.Errorf(codes.Unimplemented, "method LeaseLeases not implemented")
+	if cs.proxy != nil {
+		if resp, err = cs.proxy.Lease().LeaseLeases(ctx, r); err == nil {
+			resp.Header = cs.proxyHeader(resp.Header)
+		}
+		return resp, err
+	}
+	header, err := cs.leaseHeader()
+	if err != nil {
+		return nil, err
+	}
+	resp = &pb.LeaseLeasesResponse{Header: header}
+	for _, id := range cs.leases.Leases() {
+		resp.Leases = append(resp.Leases, &pb.LeaseStatus{ID: id})
+	}
+	return resp, nil
+}
+
+// leaseHeader returns the response header for lease requests
+func (cs *ClientAPIServer) leaseHeader() (*pb.ResponseHeader, error) {
+	latestRevision, err := cs.db.LatestRevision()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error getting latest revision: %s", err)
+	}
+	return cs.header.At(latestRevision), nil
+}
+
+// leaseError converts a lease.Manager error to the etcd gRPC error
+func leaseError(err error) error {
+	switch {
+	case errors.Is(err, lease.ErrLeaseNotFound):
+		return rpctypes.ErrGRPCLeaseNotFound
+	case errors.Is(err, lease.ErrLeaseExists):
+		return rpctypes.ErrGRPCLeaseExist
+	case errors.Is(err, lease.ErrTTLTooLarge):
+		return rpctypes.ErrGRPCLeaseTTLTooLarge
+	case errors.Is(err, lease.ErrNotLeader):
+		return rpctypes.ErrGRPCNoLeader
+	default:
+		return status.Errorf(codes.Unavailable, "lease error: %s", err)
+	}
 }
@@ -0,0 +1,215 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// TestLeaseRevoke checks that revoking a lease deletes only the keys
+// attached to it, through the transaction path so that watchers see them
+// deleted
+func TestLeaseRevoke(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	cs := newTestServer(t, grpcServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	for _, id := range []int64{1, 2} {
+		if _, err = cs.LeaseGrant(ctx, &pb.LeaseGrantRequest{ID: id, TTL: 60}); err != nil {
+			t.Fatalf("LeaseGrant %d: %v", id, err)
+		}
+	}
+	put := func(key string, lease int64) {
+		t.Helper()
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte("v"), Lease: lease}}}},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte(key)}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	put("/a", 1)
+	put("/b", 1)
+	put("/c", 2)
+	put("/d", 0)
+
+	stream, err := pb.NewWatchClient(conn).Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	err = stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+		CreateRequest: &pb.WatchCreateRequest{Key: []byte("/"), RangeEnd: []byte("0")},
+	}})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp, err := recvWatchResponse(stream); err != nil || !resp.Created {
+		t.Fatalf("expected watch to be created, got %v: %v", resp, err)
+	}
+
+	if _, err = cs.LeaseRevoke(ctx, &pb.LeaseRevokeRequest{ID: 1}); err != nil {
+		t.Fatalf("LeaseRevoke: %v", err)
+	}
+	deleted := map[string]bool{}
+	for len(deleted) < 2 {
+		resp, err := recvWatchResponse(stream)
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		for _, event := range resp.Events {
+			if event.Type != mvccpb.DELETE {
+				t.Fatalf("expected only delete events, got %v", event)
+			}
+			deleted[string(event.Kv.Key)] = true
+		}
+	}
+	if !deleted["/a"] || !deleted["/b"] {
+		t.Fatalf("expected /a and /b to be deleted, got %v", deleted)
+	}
+	resp, err := cs.Range(ctx, &pb.RangeRequest{Key: []byte("/"), RangeEnd: []byte("0")})
+	if err != nil {
+		t.Fatalf("Range: %v", err)
+	}
+	var remaining []string
+	for _, kv := range resp.Kvs {
+		remaining = append(remaining, string(kv.Key))
+	}
+	if len(remaining) != 2 || remaining[0] != "/c" || remaining[1] != "/d" {
+		t.Fatalf("expected /c and /d to remain, got %v", remaining)
+	}
+
+	// a revoked lease no longer exists
+	if _, err = cs.LeaseRevoke(ctx, &pb.LeaseRevokeRequest{ID: 1}); err != rpctypes.ErrGRPCLeaseNotFound {
+		t.Fatalf("expected lease not found revoking it again, got %v", err)
+	}
+	// keys cannot be attached to it by either branch of a transaction
+	_, err = cs.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: []byte("/e"), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte("/e")}}}},
+		Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("/e"), Value: []byte("v"), Lease: 1}}}},
+	})
+	if err != rpctypes.ErrGRPCLeaseNotFound {
+		t.Fatalf("expected lease not found attaching a key in the failure branch, got %v", err)
+	}
+	stream.CloseSend()
+}
+
+// TestLeaseExpiryEvents checks that watchers receive a DELETE event for
+// each key of a lease which expires, with the deleted value as the previous
+// key-value, as the kube-apiserver relies on for event garbage collection
+func TestLeaseExpiryEvents(t *testing.T) {
+	configtest.Set(t, map[string]any{"lease_min_ttl_seconds": 1, "lease_check_interval_ms": 10})
+	grpcServer := grpc.NewServer()
+	cs := newTestServer(t, grpcServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := pb.NewWatchClient(conn).Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	err = stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+		CreateRequest: &pb.WatchCreateRequest{Key: []byte("/events/a"), PrevKv: true},
+	}})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp, err := recvWatchResponse(stream); err != nil || !resp.Created {
+		t.Fatalf("expected watch to be created, got %v: %v", resp, err)
+	}
+
+	if _, err = cs.LeaseGrant(ctx, &pb.LeaseGrantRequest{ID: 1, TTL: 1}); err != nil {
+		t.Fatalf("LeaseGrant: %v", err)
+	}
+	key := []byte("/events/a")
+	for modRevision, value := range []string{"v1", "v2"} {
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: key, Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: int64(modRevision)}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: key, Value: []byte(value), Lease: 1}}}},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: key}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put %s: %v", value, err)
+		}
+	}
+
+	var events []*mvccpb.Event
+	var header *pb.ResponseHeader
+	for len(events) < 3 {
+		resp, err := recvWatchResponse(stream)
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		events = append(events, resp.Events...)
+		header = resp.Header
+	}
+	deleted := events[2]
+	if deleted.Type != mvccpb.DELETE || header.Revision != 3 {
+		t.Fatalf("expected the key to be deleted at revision 3, got %v at %v", deleted, header)
+	}
+	if kv := deleted.Kv; string(kv.Key) != "/events/a" || kv.ModRevision != 3 || kv.CreateRevision != 0 || kv.Version != 0 || kv.Lease != 0 || len(kv.Value) != 0 {
+		t.Fatalf("expected only the key and mod revision 3 to be set, got %v", kv)
+	}
+	if prevKv := deleted.PrevKv; prevKv == nil || string(prevKv.Value) != "v2" || prevKv.ModRevision != 2 || prevKv.CreateRevision != 1 || prevKv.Version != 2 || prevKv.Lease != 1 {
+		t.Fatalf("expected the previous key-value to be v2 at revision 2, got %v", prevKv)
+	}
+	stream.CloseSend()
+}
+
+func TestLeaseLeases(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := context.Background()
+	for _, id := range []int64{3, 1, 2} {
+		if _, err := cs.LeaseGrant(ctx, &pb.LeaseGrantRequest{ID: id, TTL: 60}); err != nil {
+			t.Fatalf("LeaseGrant %d: %v", id, err)
+		}
+	}
+	if _, err := cs.LeaseRevoke(ctx, &pb.LeaseRevokeRequest{ID: 2}); err != nil {
+		t.Fatalf("LeaseRevoke: %v", err)
+	}
+	resp, err := cs.LeaseLeases(ctx, &pb.LeaseLeasesRequest{})
+	if err != nil {
+		t.Fatalf("LeaseLeases: %v", err)
+	}
+	var ids []int64
+	for _, l := range resp.Leases {
+		ids = append(ids, l.ID)
+	}
+	if !slices.Equal(ids, []int64{1, 3}) {
+		t.Fatalf("expected leases [1 3], got %v", ids)
+	}
+}
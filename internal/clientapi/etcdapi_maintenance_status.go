@@ -6,6 +6,7 @@ package clientapi
 import (
 	"context"
 
+	"github.com/nadrama-com/netsy/internal/replication"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -16,9 +17,20 @@ func (cs *ClientAPIServer) Status(ctx context.Context, r *pb.StatusRequest) (res
 	if err != nil {
 		return nil, status.Errorf(codes.Unavailable, "error getting db size: %s", err)
 	}
-	return &pb.StatusResponse{
-		Header:  &pb.ResponseHeader{},
-		DbSize:  dbSize,
-		Version: "3.5.16",
-	}, nil
+	latestRevision, err := cs.db.LatestRevision()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error getting latest revision: %s", err)
+	}
+	resp = cs.compat.statusResponse(cs.header, dbSize, latestRevision)
+	// while replicating from a leader and behind it, report the leader
+	// revision as the raft index and the applied revision as the applied
+	// index, as an etcd follower would. Netsy-specific state, such as the
+	// lag itself and write fences, is reported by the Admin GetStatus API.
+	if lag, ok := replication.Current(); ok && lag.LeaderRevision > latestRevision {
+		resp.RaftIndex = uint64(lag.LeaderRevision)
+		if cs.compat.raftAppliedIndex {
+			resp.RaftAppliedIndex = uint64(latestRevision)
+		}
+	}
+	return resp, nil
 }
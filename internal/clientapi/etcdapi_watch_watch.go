@@ -11,10 +11,13 @@ package clientapi
 //                single kube-apiserver watcher.
 
 import (
+	"context"
 	"fmt"
 	"sync/atomic"
-	"time"
 
+	"github.com/nadrama-com/netsy/internal/lockhold"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/watchdog"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
@@ -32,77 +35,147 @@ import (
 // one stream.
 // Each watcher has an 'inbox' channel. Watch runs a separate goroutine
 // to process any incoming messages on the inbox channel and send back to
-// the watcher. The inbox channel messages are expected to already be
-// a WatchResponse.
+// the watcher, and another to catch the watcher up if its inbox overflows.
+// The inbox channel messages are expected to already be a WatchResponse. If sending fails, the Watch ends and the watcher is
+// cleaned up (see runInbox).
 func (cs *ClientAPIServer) Watch(ws pb.Watch_WatchServer) error {
 	// create a globally-unique watcher ID
 	watcherID := atomic.AddInt64(&watcherIDCounter, 1)
 
-	// instantiate a new watcher
+	// instantiate a new watcher, with the settings of its client
+	identity := clientIdentity(ws.Context())
+	policy := cs.clients.policy(identity)
+	metrics.ClientWatchers.WithLabelValues(identity).Inc()
+	defer metrics.ClientWatchers.WithLabelValues(identity).Dec()
 	w := &watcher{
-		id:       watcherID,
-		client:   ws,
-		inboxOk:  true,
-		inboxCh:  make(chan pb.WatchResponse), // TODO: use a buffered channel?
-		watches:  map[int64]watch{},
-		progress: map[int64]bool{},
+		id:              watcherID,
+		identity:        identity,
+		reads:           cs.readRules.policy(identity),
+		RWMutex:         lockhold.RWMutex{Name: "watcher"},
+		client:          ws,
+		inboxOk:         true,
+		inboxCh:         make(chan inboxMsg, cs.config.WatchQueueSize()),
+		catchUpCh:       make(chan struct{}, 1),
+		replayCh:        make(chan watchReplay, cs.config.WatchCreateQueueSize()),
+		createCh:        make(chan struct{}, 1),
+		createQueueSize: cs.config.WatchCreateQueueSize(),
+		watches:         map[int64]watch{},
+		progress:        map[int64]bool{},
+		compat:          cs.compat,
+		lagAlarm:        cs.newWatchLagAlarm(watcherID),
+		header:          cs.header,
+		maxWatches:      cs.config.WatchMaxPerWatcher(),
+		draining:        &cs.draining,
 	}
 
-	// add watcher to map of all watchers
-	// obtain write lock, add to map, then release lock immediately
-	allWatchers.Lock()
-	allWatchers.servers[watcherID] = w
-	allWatchers.Unlock()
+	// add watcher to map of all watchers. beyond the watcher limit, the
+	// watcher is not added, so no events are dispatched to it, and its
+	// watch create requests are rejected (see receiveWatchRequests)
+	if maxWatchers := cs.config.WatchMaxWatchers(); !allWatchers.add(w, maxWatchers) {
+		metrics.WatchersRejected.Inc()
+		w.rejectReason = fmt.Sprintf("too many watch streams (limit %d)", maxWatchers)
+		fmt.Printf("Watch(%d) watcher limit reached, rejecting watches\n", watcherID)
+	}
+
+	// ctx is cancelled when the stream ends, when sending to the client
+	// fails (see runInbox), or when the server is stopped, which ends the
+	// Watch. Goroutines started below are tracked (see goWatch), and all
+	// exit once ctx is cancelled and Cleanup has closed the inbox channel.
+	ctx, cancel := context.WithCancelCause(w.client.Context())
+	defer cancel(nil)
+	stopWatch := context.AfterFunc(cs.stopCtx, func() {
+		cancel(errServerStopping)
+	})
+	defer stopWatch()
 
 	// start a goroutine to handle messages on the inbox channel
-	go func() {
-		for {
-			// block until next message is received
-			msg, ok := <-w.inboxCh
-
-			// end goroutine once channel is closed
-			// this will happen if Cleanup is invoked (at end of Watch method)
-			if !ok {
-				fmt.Printf("Watch() inboxCh closed\n")
-				return
-			}
+	cs.goWatch(func() {
+		w.runInbox(cancel)
+	})
 
-			// send message back to client
-			// note that because this should be the only goroutine sending
-			// messages to the client, we don't need to lock the watcher
-			err := w.client.Send(&msg)
-			if err != nil {
-				fmt.Printf("Watch() Send() error: %v\n", err)
-				return
-			}
-		}
-	}()
-
-	// we use PollUntilContextCancel to invoke progress reporting on an interval
-	// it will continue until the context is cancelled or hits a deadline.
-	go wait.PollUntilContextCancel(
-		w.client.Context(),
-		// TODO: add jitter so we don't send updates to all watchers at the same time
-		time.Second*5,
-		true,
-		w.ReportProgressOnInterval(cs.db.LatestRevision),
-	)
-
-	// block until gRPC stream is closed
+	// start a goroutine to catch up the watcher from the local db if its
+	// inbox overflows (see watch_catchup.go)
+	cs.goWatch(func() {
+		cs.catchUpWatches(ctx, w)
+	})
+
+	// start a goroutine to replay the past events of watches created with a
+	// past start revision (see watch_replay.go)
+	cs.goWatch(func() {
+		cs.replayWatches(ctx, w)
+	})
+
+	// start a goroutine to process watch create requests, so that the
+	// receive loop below is not blocked while watches are created
+	cs.goWatch(func() {
+		w.ProcessCreates(ctx, cs.watchCreatePool, cs.db.LatestRevision, cs.db.GetRevisions)
+	})
+
+	// we use JitterUntilWithContext to invoke progress reporting on an
+	// interval until the context is cancelled. Each interval is randomly
+	// lengthened, so that watchers which connected at the same time (e.g.
+	// after a restart) do not send progress notifications in sync.
+	reportProgress := w.ReportProgressOnInterval(cs.db.LatestRevision, cs.compat.progressBroadcast)
+	cs.goWatch(func() {
+		wait.JitterUntilWithContext(
+			ctx,
+			func(ctx context.Context) {
+				reportProgress(ctx)
+			},
+			policy.progressInterval,
+			float64(cs.config.WatchProgressJitterPercent())/100,
+			true,
+		)
+	})
+
+	// receive requests on a separate goroutine, as Recv cannot be
+	// interrupted, and block until the gRPC stream is closed or ctx is
+	// cancelled. If ctx is cancelled, the stream ends once Watch returns,
+	// which also ends the receive goroutine.
+	recvErrCh := make(chan error, 1)
+	cs.goWatch(func() {
+		recvErrCh <- cs.receiveWatchRequests(ctx, w)
+	})
 	var err error
+	select {
+	case err = <-recvErrCh:
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	}
+
+	// if above loop has exited, it means the stream is closed, so stop the
+	// progress poller and create processing, then cleanup
+	cancel(err)
+	w.Cleanup(watcherID)
+	return err
+}
+
+// receiveWatchRequests handles requests received on the watcher's gRPC
+// stream, until the stream has an error or is closed
+func (cs *ClientAPIServer) receiveWatchRequests(ctx context.Context, w *watcher) error {
 	for {
 		// wait for next message or error from gRPC stream
-		var msg *pb.WatchRequest
-		msg, err = w.client.Recv()
+		msg, err := w.client.Recv()
 		if err != nil {
 			fmt.Printf("Watch() cancelled or returning error\n")
 			// end watch/exit loop when the stream has an error/is closed
-			break
+			return err
 		}
 		if cr := msg.GetCreateRequest(); cr != nil {
-			// handle watch create request
-			latestRevision, _ := cs.db.LatestRevision()
-			w.CreateWatch(cr, latestRevision, cs.db.GetRevision)
+			cs.loadAuditor().OnWatchCreate(w.client.Context(), w.id, cr)
+			metrics.ClientWatchCreates.WithLabelValues(w.identity).Inc()
+			// queue watch create request. when shedding load, its
+			// rejection is queued instead, so that it is answered in
+			// order with the requests received before it.
+			if w.rejectReason != "" {
+				metrics.WatchCreateRejected.WithLabelValues("watcher_limit").Inc()
+				w.RejectCreate(w.rejectReason)
+			} else if cs.memWatchdog.Level() >= watchdog.LevelElevated {
+				metrics.WatchCreateRejected.WithLabelValues("memory_pressure").Inc()
+				w.RejectCreate("watch rejected due to memory pressure")
+			} else {
+				w.EnqueueCreate(cr)
+			}
 		}
 		if cr := msg.GetCancelRequest(); cr != nil {
 			// handle watch cancel request
@@ -111,11 +184,8 @@ func (cs *ClientAPIServer) Watch(ws pb.Watch_WatchServer) error {
 		}
 		if pr := msg.GetProgressRequest(); pr != nil {
 			// handle watch progress request
-			w.ReportProgressOnInterval(cs.db.LatestRevision)(w.client.Context())
+			// etcd always responds to these with a broadcast
+			w.ReportProgressOnInterval(cs.db.LatestRevision, true)(ctx)
 		}
 	}
-
-	// if above loop has exited, it means the stream is closed, so cleanup
-	w.Cleanup(watcherID)
-	return err
 }
@@ -0,0 +1,70 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// TestWatchProgressInterval checks that watchers are sent progress
+// notifications on the configured interval, lengthened by up to the jitter
+func TestWatchProgressInterval(t *testing.T) {
+	configtest.Set(t, map[string]any{"watch_progress_interval_ms": 100, "watch_progress_jitter_percent": 50})
+	grpcServer := grpc.NewServer()
+	newTestServer(t, grpcServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := pb.NewWatchClient(conn).Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	err = stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+		CreateRequest: &pb.WatchCreateRequest{Key: []byte("/a"), ProgressNotify: true},
+	}})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp, err := stream.Recv(); err != nil || !resp.Created {
+		t.Fatalf("expected watch to be created, got %v: %v", resp, err)
+	}
+
+	var last time.Time
+	for i := 0; i < 4; i++ {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if resp.Created || len(resp.Events) != 0 {
+			t.Fatalf("expected a progress notification, got %v", resp)
+		}
+		now := time.Now()
+		// the first notification may follow the create at any point
+		if !last.IsZero() {
+			if elapsed := now.Sub(last); elapsed < 90*time.Millisecond || elapsed > time.Second {
+				t.Errorf("expected notifications 100-150ms apart, got %s", elapsed)
+			}
+		}
+		last = now
+	}
+	stream.CloseSend()
+}
@@ -0,0 +1,43 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/hooks"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+// SetHooks sets the callbacks fired on commits and leader changes (see
+// package hooks). It must be called before SetReady.
+func (clientServer *ClientAPIServer) SetHooks(h *hooks.Hooks) {
+	clientServer.hooks = h
+}
+
+// fireCommitHooks calls the commit callbacks with a committed record, with
+// its value decoded as it would be read
+func (cs *ClientAPIServer) fireCommitHooks(record *proto.Record) {
+	if !cs.hooks.WantsCommit() {
+		return
+	}
+	commit := hooks.Commit{
+		Revision:       record.Revision,
+		Key:            record.Key,
+		CreateRevision: record.CreateRevision,
+		Version:        record.Version,
+		Lease:          record.Lease,
+		Created:        record.Created,
+		Deleted:        record.Deleted,
+	}
+	if !record.Deleted {
+		value, err := cs.values.Decode(record.Key, record.Value)
+		if err != nil {
+			level.Error(cs.logger).Log("msg", "failed to decode value for commit hooks", "key", keys.Key(record.Key), "rev", record.Revision, "err", err)
+			return
+		}
+		commit.Value = value
+	}
+	cs.hooks.FireCommit(commit)
+}
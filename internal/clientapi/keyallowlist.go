@@ -0,0 +1,107 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"bytes"
+
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// keyAllowlist restricts writes to keys with one of the allowed prefixes, so
+// that stray clients of a shared instance cannot pollute the keyspace (e.g.
+// with keys outside /registry/). A nil keyAllowlist allows all keys.
+type keyAllowlist struct {
+	prefixes [][]byte
+}
+
+// newKeyAllowlist returns an allowlist for prefixes, or nil to allow all keys
+// if there are no prefixes
+func newKeyAllowlist(prefixes []string) *keyAllowlist {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	a := &keyAllowlist{}
+	for _, prefix := range prefixes {
+		a.prefixes = append(a.prefixes, []byte(prefix))
+	}
+	return a
+}
+
+// allowed returns true if writes to key are allowed. A prefix ending in "/"
+// matches keys under it, otherwise it must match the whole key (e.g.
+// compact_rev_key, which the Kubernetes compactor writes).
+func (a *keyAllowlist) allowed(key []byte) bool {
+	if a == nil {
+		return true
+	}
+	for _, prefix := range a.prefixes {
+		if bytes.HasSuffix(prefix, []byte("/")) {
+			if len(key) > len(prefix) && bytes.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if bytes.Equal(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTxn returns an InvalidArgument error if a Txn request writes to a key
+// which is not allowed
+func (a *keyAllowlist) checkTxn(r *pb.TxnRequest) error {
+	if a == nil {
+		return nil
+	}
+	for _, ops := range [][]*pb.RequestOp{r.Success, r.Failure} {
+		for _, op := range ops {
+			var key []byte
+			switch {
+			case op.GetRequestPut() != nil:
+				key = op.GetRequestPut().Key
+			case op.GetRequestDeleteRange() != nil:
+				key = op.GetRequestDeleteRange().Key
+			default:
+				continue
+			}
+			if !a.allowed(key) {
+				metrics.TxnKeyRejected.WithLabelValues(keys.Label(key)).Inc()
+				return status.Errorf(codes.InvalidArgument, "writes to key %s are not allowed", keys.Quote(key))
+			}
+		}
+	}
+	return nil
+}
+
+// checkDeleteRange returns an InvalidArgument error if a DeleteRange request
+// may delete a key which is not allowed. A range must lie within a prefix
+// ending in "/", as other keys in the range may not be allowed.
+func (a *keyAllowlist) checkDeleteRange(key, rangeEnd []byte) error {
+	if a == nil {
+		return nil
+	}
+	if len(rangeEnd) == 0 {
+		if a.allowed(key) {
+			return nil
+		}
+	} else {
+		for _, prefix := range a.prefixes {
+			if !bytes.HasSuffix(prefix, []byte("/")) || !bytes.HasPrefix(key, prefix) {
+				continue
+			}
+			// a range end of "\x00" is all keys from key
+			prefixEnd := []byte(clientv3.GetPrefixRangeEnd(string(prefix)))
+			if !bytes.Equal(rangeEnd, []byte{0}) && bytes.Compare(rangeEnd, prefixEnd) <= 0 {
+				return nil
+			}
+		}
+	}
+	metrics.TxnKeyRejected.WithLabelValues(keys.Label(key)).Inc()
+	return status.Errorf(codes.InvalidArgument, "writes to key %s are not allowed", keys.Quote(key))
+}
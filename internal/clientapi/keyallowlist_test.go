@@ -0,0 +1,78 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"testing"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestKeyAllowlist(t *testing.T) {
+	a := newKeyAllowlist([]string{"/registry/", "compact_rev_key"})
+	tests := []struct {
+		key    string
+		expect bool
+	}{
+		{"/registry/pods/default/app", true},
+		{"compact_rev_key", true},
+		{"/registry/", false},
+		{"/registry", false},
+		{"compact_rev_key2", false},
+		{"/other/key", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if result := a.allowed([]byte(test.key)); result != test.expect {
+			t.Errorf("allowed(%q) = %t, want %t", test.key, result, test.expect)
+		}
+	}
+
+	var none *keyAllowlist = newKeyAllowlist(nil)
+	if !none.allowed([]byte("/other/key")) {
+		t.Errorf("nil allowlist should allow all keys")
+	}
+}
+
+func TestKeyAllowlistCheckTxn(t *testing.T) {
+	a := newKeyAllowlist([]string{"/registry/"})
+	txn := func(key string) *pb.TxnRequest {
+		return &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key)}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key)}}}},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte(key)}}}},
+		}
+	}
+	if err := a.checkTxn(txn("/registry/pods/default/app")); err != nil {
+		t.Errorf("checkTxn(allowed) = %v", err)
+	}
+	if err := a.checkTxn(txn("/other/key")); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("checkTxn(not allowed) = %v, want InvalidArgument", err)
+	}
+}
+
+func TestKeyAllowlistCheckDeleteRange(t *testing.T) {
+	a := newKeyAllowlist([]string{"/registry/", "compact_rev_key"})
+	tests := []struct {
+		key, rangeEnd string
+		expect        bool
+	}{
+		{"/registry/pods/default/app", "", true},
+		{"compact_rev_key", "", true},
+		{"/registry/pods/", "/registry/pods0", true},
+		{"/registry/", "/registry0", true},
+		{"/registry/pods/", "\x00", false},
+		{"/registry/pods/", "/s", false},
+		{"compact_rev_key", "compact_rev_kez", false},
+		{"/other/", "/other0", false},
+	}
+	for _, test := range tests {
+		err := a.checkDeleteRange([]byte(test.key), []byte(test.rangeEnd))
+		if (err == nil) != test.expect {
+			t.Errorf("checkDeleteRange(%q, %q) = %v, want allowed %t", test.key, test.rangeEnd, err, test.expect)
+		}
+	}
+}
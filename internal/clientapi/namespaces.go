@@ -0,0 +1,174 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+// Writes are aggregated by the Kubernetes namespace of their key, so that
+// the noisy tenants driving revision growth and S3 costs can be found (see
+// ListNamespaceWrites). The write rates are read from the records in the
+// local database, so that every node reports the writes of the whole
+// cluster, including those committed before it started or by a previous
+// leader. Records committed by this node are also counted in per-namespace
+// metrics.
+
+// namespaceWindow is the period over which the write rate of each
+// namespace is averaged, to the minute: the current minute so far, and the
+// minutes before it
+const namespaceWindow = 5 * time.Minute
+
+const (
+	// clusterNamespace labels writes to keys without a namespace, e.g. of
+	// cluster-scoped resources
+	clusterNamespace = "_cluster"
+	// overflowNamespace labels the metrics of writes to namespaces beyond
+	// metrics_namespaces_max
+	overflowNamespace = "_overflow"
+)
+
+// namespaceCount is the number of records committed in a namespace, and
+// the bytes of their keys and values
+type namespaceCount struct {
+	writes int64
+	bytes  int64
+}
+
+// namespaceRate is the average write rate of a namespace over the window
+type namespaceRate struct {
+	namespace       string
+	writes          int64
+	bytes           int64
+	writesPerMinute float64
+	bytesPerMinute  float64
+}
+
+// namespaceWrites counts the writes to each namespace
+type namespaceWrites struct {
+	db localdb.Database
+	// labelsMax is the maximum number of namespaces labelled in metrics, or
+	// 0 if per-namespace metrics are disabled
+	labelsMax int
+	now       func() time.Time
+
+	mu sync.Mutex
+	// labelled holds the namespaces labelled in metrics
+	labelled map[string]bool
+}
+
+// newNamespaceWrites creates a namespaceWrites reading the records of db,
+// labelling up to labelsMax namespaces in metrics
+func newNamespaceWrites(db localdb.Database, labelsMax int64) *namespaceWrites {
+	return &namespaceWrites{
+		db:        db,
+		labelsMax: int(max(labelsMax, 0)),
+		now:       time.Now,
+		labelled:  map[string]bool{},
+	}
+}
+
+// recordNamespace returns the namespace of a record's key, for aggregating
+// its writes
+func recordNamespace(record *proto.Record) string {
+	if namespace := keys.Namespace(record.Key); namespace != "" {
+		return namespace
+	}
+	return clusterNamespace
+}
+
+// record counts a record committed by this node in metrics
+func (n *namespaceWrites) record(record *proto.Record) {
+	if n.labelsMax == 0 {
+		return
+	}
+	namespace := recordNamespace(record)
+	label := namespace
+	n.mu.Lock()
+	if !n.labelled[namespace] {
+		if len(n.labelled) < n.labelsMax {
+			n.labelled[namespace] = true
+		} else {
+			label = overflowNamespace
+		}
+	}
+	n.mu.Unlock()
+
+	metrics.NamespaceWrites.WithLabelValues(label).Inc()
+	metrics.NamespaceWriteBytes.WithLabelValues(label).Add(float64(len(record.Key) + len(record.Value)))
+}
+
+// windowStart returns the start of the oldest minute in the window at now
+func windowStart(now time.Time) time.Time {
+	return now.Truncate(time.Minute).Add(time.Minute - namespaceWindow)
+}
+
+// top returns the average write rate of each namespace over the window,
+// most writes first, and the window the rates were averaged over
+func (n *namespaceWrites) top() (rates []namespaceRate, window time.Duration, err error) {
+	now := n.now()
+	start := windowStart(now)
+	// the records in the window are found by revision, as they are created
+	// in revision order
+	first, err := n.db.RevisionCreatedBefore(start)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find the first revision in the window: %w", err)
+	}
+	latest, err := n.db.LatestRevision()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get latest revision: %w", err)
+	}
+	totals := map[string]*namespaceCount{}
+	if latest > first {
+		err = n.db.ScanRecordsForSnapshot(first+1, latest, func(record *proto.Record) error {
+			if record.CreatedAt.AsTime().Before(start) {
+				return nil
+			}
+			namespace := recordNamespace(record)
+			total, ok := totals[namespace]
+			if !ok {
+				total = &namespaceCount{}
+				totals[namespace] = total
+			}
+			total.writes++
+			total.bytes += int64(len(record.Key) + len(record.Value))
+			return nil
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read records in the window: %w", err)
+		}
+	}
+
+	window = now.Sub(start)
+	minutes := window.Minutes()
+	for namespace, total := range totals {
+		rates = append(rates, namespaceRate{
+			namespace:       namespace,
+			writes:          total.writes,
+			bytes:           total.bytes,
+			writesPerMinute: float64(total.writes) / minutes,
+			bytesPerMinute:  float64(total.bytes) / minutes,
+		})
+	}
+	slices.SortFunc(rates, func(a, b namespaceRate) int {
+		if a.writes != b.writes {
+			return cmp.Compare(b.writes, a.writes)
+		}
+		if a.bytes != b.bytes {
+			return cmp.Compare(b.bytes, a.bytes)
+		}
+		return strings.Compare(a.namespace, b.namespace)
+	})
+	return rates, window, nil
+}
@@ -0,0 +1,389 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/peerapi"
+	"github.com/nadrama-com/netsy/internal/progress"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/replication"
+	"github.com/nadrama-com/netsy/internal/s3client"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (cs *ClientAPIServer) ListDataFiles(ctx context.Context, r *proto.ListDataFilesRequest) (resp *proto.ListDataFilesResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if cs.s3Client == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "S3 is not enabled")
+	}
+	resp = &proto.ListDataFilesResponse{}
+	resp.LocalRevision, err = cs.db.LatestRevision()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error getting latest revision: %s", err)
+	}
+
+	snapshots, err := cs.s3Client.ListSnapshots(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error listing snapshots: %s", err)
+	}
+	for _, snapshot := range snapshots {
+		kind := proto.FileKind_KIND_SNAPSHOT
+		if s3client.IsSnapshotManifest(snapshot.Key) {
+			kind = proto.FileKind_KIND_SNAPSHOT_MANIFEST
+		}
+		resp.Snapshots = append(resp.Snapshots, dataFile(kind, snapshot))
+	}
+	if len(snapshots) > 0 {
+		resp.LatestSnapshotRevision = snapshots[0].Revision
+		resp.LatestChunkRevision = snapshots[0].Revision
+	}
+
+	// by default only list chunks which are not covered by a snapshot
+	fromRevision := r.ChunksFromRevision
+	if fromRevision == 0 {
+		fromRevision = resp.LatestSnapshotRevision
+	}
+	chunks, err := cs.s3Client.ListChunks(ctx, fromRevision)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error listing chunks: %s", err)
+	}
+	for _, chunk := range chunks {
+		resp.Chunks = append(resp.Chunks, dataFile(proto.FileKind_KIND_CHUNK, chunk))
+	}
+	if len(chunks) > 0 && chunks[len(chunks)-1].Revision > resp.LatestChunkRevision {
+		resp.LatestChunkRevision = chunks[len(chunks)-1].Revision
+	}
+
+	if r.IncludeMetadata {
+		for _, file := range append(resp.Snapshots, resp.Chunks...) {
+			metadata, ok, err := cs.s3Client.HeadObjectMetadata(ctx, file.Key)
+			if err != nil {
+				return nil, status.Errorf(codes.Unavailable, "error reading metadata of %s: %s", file.Key, err)
+			} else if ok {
+				file.Metadata = dataFileMetadata(metadata)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (cs *ClientAPIServer) ListOperations(ctx context.Context, r *proto.ListOperationsRequest) (resp *proto.ListOperationsResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	resp = &proto.ListOperationsResponse{}
+	for _, p := range progress.Active() {
+		resp.Operations = append(resp.Operations, operation(p, true))
+	}
+	for _, p := range progress.Finished() {
+		resp.Operations = append(resp.Operations, operation(p, false))
+	}
+	return resp, nil
+}
+
+func (cs *ClientAPIServer) GetStatus(ctx context.Context, r *proto.GetStatusRequest) (resp *proto.GetStatusResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	resp = &proto.GetStatusResponse{MemoryLevel: cs.memWatchdog.Level().String()}
+	resp.LocalRevision, err = cs.db.LatestRevision()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error getting latest revision: %s", err)
+	}
+	if fence := cs.peerServer.WriteFence(); fence != nil {
+		resp.WriteFence = &proto.WriteFenceStatus{
+			Revision: fence.Revision,
+			FencedAt: timestamppb.New(fence.FencedAt),
+			Cause:    fence.Cause.Error(),
+		}
+	}
+	for _, p := range progress.Active() {
+		resp.Operations = append(resp.Operations, operation(p, true))
+	}
+	if lag, ok := replication.Current(); ok {
+		resp.Replication = &proto.ReplicationStatus{
+			LeaderRevision:  lag.LeaderRevision,
+			AppliedRevision: lag.AppliedRevision,
+			LagRecords:      lag.Records,
+			Lag:             durationpb.New(lag.Duration),
+		}
+	}
+	return resp, nil
+}
+
+// dataFileMetadata converts S3 object metadata to Admin API DataFileMetadata
+func dataFileMetadata(metadata s3client.ObjectMetadata) *proto.DataFileMetadata {
+	return &proto.DataFileMetadata{
+		FirstRevision: metadata.FirstRevision,
+		LastRevision:  metadata.LastRevision,
+		RecordsCount:  metadata.RecordsCount,
+		LeaderId:      metadata.LeaderID,
+		LeaderEpoch:   metadata.LeaderEpoch,
+		Sha256:        metadata.SHA256,
+	}
+}
+
+// dataFile converts S3 file info to an Admin API DataFile
+func dataFile(kind proto.FileKind, info s3client.FileInfo) *proto.DataFile {
+	file := &proto.DataFile{
+		Kind:     kind,
+		Key:      info.Key,
+		Size:     info.Size,
+		Revision: info.Revision,
+	}
+	if !info.LastModified.IsZero() {
+		file.LastModified = timestamppb.New(info.LastModified)
+	}
+	return file
+}
+
+// operation converts operation progress to an Admin API Operation
+func operation(p progress.Progress, running bool) *proto.Operation {
+	op := &proto.Operation{
+		Name:         p.Operation,
+		Running:      running,
+		RecordsDone:  p.RecordsDone,
+		RecordsTotal: p.RecordsTotal,
+		BytesDone:    p.BytesDone,
+		BytesTotal:   p.BytesTotal,
+		Elapsed:      durationpb.New(p.Elapsed),
+	}
+	if running && p.ETA > 0 {
+		op.Eta = durationpb.New(p.ETA)
+	}
+	return op
+}
+
+func (cs *ClientAPIServer) ClearWriteFence(ctx context.Context, r *proto.ClearWriteFenceRequest) (resp *proto.ClearWriteFenceResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	fence, err := cs.peerServer.ClearWriteFence()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error clearing write fence: %s", err)
+	}
+	resp = &proto.ClearWriteFenceResponse{}
+	if fence != nil {
+		resp.Cleared = true
+		resp.FencedRevision = fence.Revision
+		resp.FencedAt = timestamppb.New(fence.FencedAt)
+		resp.Cause = fence.Cause.Error()
+	}
+	return resp, nil
+}
+
+func (cs *ClientAPIServer) GetConfig(ctx context.Context, r *proto.GetConfigRequest) (resp *proto.GetConfigResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return &proto.GetConfigResponse{Settings: ConfigSettings(cs.config.Settings())}, nil
+}
+
+// ConfigSettings converts config settings to Admin API ConfigSettings
+func ConfigSettings(settings []config.Setting) []*proto.ConfigSetting {
+	result := make([]*proto.ConfigSetting, 0, len(settings))
+	for _, setting := range settings {
+		result = append(result, &proto.ConfigSetting{
+			Name:         setting.Name,
+			Value:        setting.Value,
+			Source:       setting.Source,
+			EnvKey:       setting.EnvKey,
+			DefaultValue: setting.Default,
+			Description:  setting.Description,
+			Secret:       setting.Secret,
+		})
+	}
+	return result
+}
+
+// UndeleteKey recreates a deleted key with its last value before it was
+// deleted, or its value as of r.AsOfRevision, by writing a create through
+// Txn. It fails if the key exists or the value to restore was compacted.
+func (cs *ClientAPIServer) UndeleteKey(ctx context.Context, r *proto.UndeleteKeyRequest) (resp *proto.UndeleteKeyResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if len(r.Key) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "key is required")
+	} else if r.AsOfRevision < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "as of revision must be non-negative")
+	}
+	history, err := cs.db.FindKeyRecords(r.Key)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error finding records of %s: %s", keys.Quote(r.Key), err)
+	}
+	if len(history) == 0 {
+		return nil, status.Errorf(codes.NotFound, "key %s has no records", keys.Quote(r.Key))
+	}
+	deleted := history[len(history)-1]
+	if !deleted.Deleted {
+		return nil, status.Errorf(codes.FailedPrecondition, "key %s exists (revision %d)", keys.Quote(r.Key), deleted.Revision)
+	}
+
+	// find the record to restore: the latest record at the requested
+	// revision, or the latest record which is not a tombstone
+	var restore *proto.Record
+	for i := len(history) - 1; i >= 0 && restore == nil; i-- {
+		record := history[i]
+		if r.AsOfRevision > 0 && record.Revision <= r.AsOfRevision {
+			if record.Deleted {
+				return nil, status.Errorf(codes.FailedPrecondition, "key %s was deleted as of revision %d", keys.Quote(r.Key), r.AsOfRevision)
+			}
+			restore = record
+		} else if r.AsOfRevision == 0 && !record.Deleted {
+			restore = record
+		}
+	}
+	if restore == nil {
+		return nil, status.Errorf(codes.NotFound, "key %s has no value to restore", keys.Quote(r.Key))
+	} else if restore.CompactedAt != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "the value of key %s at revision %d has been compacted", keys.Quote(r.Key), restore.Revision)
+	}
+
+	// write through the normal transaction path, so that the create is
+	// replicated and sent to watchers. The key is not attached to the
+	// restored record's lease, which will usually have ended. The value is
+	// decoded, as the transaction encodes it again.
+	value, err := cs.values.Decode(restore.Key, restore.Value)
+	if err != nil {
+		return nil, status.Errorf(codes.DataLoss, "%s", err)
+	}
+	txnResp, err := cs.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{
+			Key:         r.Key,
+			Target:      pb.Compare_MOD,
+			Result:      pb.Compare_EQUAL,
+			TargetUnion: &pb.Compare_ModRevision{ModRevision: 0},
+		}},
+		Success: []*pb.RequestOp{{
+			Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: r.Key, Value: value}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	} else if !txnResp.Succeeded {
+		return nil, status.Errorf(codes.Aborted, "key %s was created while restoring it", keys.Quote(r.Key))
+	}
+	level.Info(cs.logger).Log("msg", "undeleted key", "key", keys.Key(r.Key), "revision", txnResp.Header.Revision, "restored_revision", restore.Revision, "deleted_revision", deleted.Revision)
+	return &proto.UndeleteKeyResponse{
+		Revision:         txnResp.Header.Revision,
+		RestoredRevision: restore.Revision,
+		DeletedRevision:  deleted.Revision,
+	}, nil
+}
+
+// ListWatchPrefixes returns the number of active watches and watchers by key
+// prefix (see keys.Label), most watched first, e.g. to find clients which
+// leak watches. Each watcher is counted once per prefix it watches.
+func (cs *ClientAPIServer) ListWatchPrefixes(ctx context.Context, r *proto.ListWatchPrefixesRequest) (resp *proto.ListWatchPrefixesResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	resp = &proto.ListWatchPrefixesResponse{}
+	prefixes := map[string]*proto.WatchPrefix{}
+	allWatchers.RLock()
+	for _, w := range allWatchers.servers {
+		resp.Watchers++
+		w.RLock()
+		// count each watcher once per prefix
+		watched := map[string]bool{}
+		for _, watch := range w.watches {
+			prefix, ok := prefixes[watch.prefix]
+			if !ok {
+				prefix = &proto.WatchPrefix{Prefix: watch.prefix}
+				prefixes[watch.prefix] = prefix
+			}
+			prefix.Watches++
+			if !watched[watch.prefix] {
+				watched[watch.prefix] = true
+				prefix.Watchers++
+			}
+			resp.Watches++
+		}
+		w.RUnlock()
+	}
+	allWatchers.RUnlock()
+	for _, prefix := range prefixes {
+		resp.Prefixes = append(resp.Prefixes, prefix)
+	}
+	slices.SortFunc(resp.Prefixes, func(a, b *proto.WatchPrefix) int {
+		if a.Watches != b.Watches {
+			return cmp.Compare(b.Watches, a.Watches)
+		}
+		return strings.Compare(a.Prefix, b.Prefix)
+	})
+	return resp, nil
+}
+
+func (cs *ClientAPIServer) ListNamespaceWrites(ctx context.Context, r *proto.ListNamespaceWritesRequest) (resp *proto.ListNamespaceWritesResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if r.Limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be non-negative")
+	}
+	rates, window, err := cs.namespaces.top()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error reading namespace writes: %s", err)
+	}
+	resp = &proto.ListNamespaceWritesResponse{Window: durationpb.New(window)}
+	for i, rate := range rates {
+		resp.Writes += rate.writes
+		resp.Bytes += rate.bytes
+		if r.Limit > 0 && int64(i) >= r.Limit {
+			continue
+		}
+		resp.Namespaces = append(resp.Namespaces, &proto.NamespaceWrites{
+			Namespace:       rate.namespace,
+			Writes:          rate.writes,
+			Bytes:           rate.bytes,
+			WritesPerMinute: rate.writesPerMinute,
+			BytesPerMinute:  rate.bytesPerMinute,
+		})
+	}
+	return resp, nil
+}
+
+func (cs *ClientAPIServer) SetNextRevision(ctx context.Context, r *proto.SetNextRevisionRequest) (resp *proto.SetNextRevisionResponse, err error) {
+	if err = cs.admins.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if r.Revision <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "revision must be positive")
+	} else if cs.proxy != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "revisions are set by the upstream etcd in proxy mode")
+	} else if !cs.peerServer.IsLeader() {
+		return nil, status.Errorf(codes.FailedPrecondition, "revisions can only be set on the leader")
+	}
+	change, err := cs.peerServer.SetNextRevision(ctx, r.Revision, r.DryRun)
+	if errors.Is(err, peerapi.ErrInvalidNextRevision) || errors.Is(err, peerapi.ErrWriteFenced) {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s", err)
+	} else if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error setting next revision: %s", err)
+	}
+	return &proto.SetNextRevisionResponse{
+		PreviousRevision: change.Previous,
+		Revision:         change.Next,
+		LocalRevision:    change.LocalRevision,
+		S3Revision:       change.S3Revision,
+		GapFirstRevision: change.GapFirst,
+		GapLastRevision:  change.GapLast,
+		DryRun:           r.DryRun,
+	}, nil
+}
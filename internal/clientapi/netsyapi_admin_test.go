@@ -0,0 +1,358 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/progress"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/viper"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testAdminIdentity is allowed to call the Admin API of newTestServer
+const testAdminIdentity = "admin"
+
+// identityContext returns the context of a request from a client which
+// presented a TLS client certificate with the common name identity
+func identityContext(identity string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: identity}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+	})
+}
+
+// adminContext returns the context of a request from testAdminIdentity
+func adminContext() context.Context {
+	return identityContext(testAdminIdentity)
+}
+
+func TestAdminIdentities(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	for _, ctx := range []context.Context{context.Background(), identityContext("system:kube-apiserver")} {
+		if _, err := cs.SetNextRevision(ctx, &proto.SetNextRevisionRequest{Revision: 100}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("expected PermissionDenied, got %v", err)
+		}
+		if _, err := cs.GetStatus(ctx, &proto.GetStatusRequest{}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("expected PermissionDenied, got %v", err)
+		}
+	}
+	if _, err := cs.GetStatus(adminContext(), &proto.GetStatusRequest{}); err != nil {
+		t.Errorf("GetStatus: %v", err)
+	}
+}
+
+func TestNewAdminIdentities(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "netsy-cli"}}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	certFile := t.TempDir() + "/client.crt"
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	configtest.Set(t, map[string]any{"tls_client_cert": certFile, "admin_client_identities": ""})
+
+	// by default only the common name of tls_client_cert is allowed
+	admins, err := newAdminIdentities(&config.Config{})
+	if err != nil {
+		t.Fatalf("newAdminIdentities: %v", err)
+	}
+	if len(admins) != 1 || !admins["netsy-cli"] {
+		t.Errorf("expected netsy-cli, got %v", admins)
+	}
+
+	viper.Set("admin_client_identities", "ops, backup")
+	if admins, err = newAdminIdentities(&config.Config{}); err != nil {
+		t.Fatalf("newAdminIdentities: %v", err)
+	}
+	if len(admins) != 2 || !admins["ops"] || !admins["backup"] {
+		t.Errorf("expected ops and backup, got %v", admins)
+	}
+}
+
+func TestListDataFilesWithoutS3(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	if _, err := cs.ListDataFiles(adminContext(), &proto.ListDataFilesRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition without S3, got %v", err)
+	}
+}
+
+func TestListOperations(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	find := func(name string) *proto.Operation {
+		t.Helper()
+		resp, err := cs.ListOperations(adminContext(), &proto.ListOperationsRequest{})
+		if err != nil {
+			t.Fatalf("ListOperations: %v", err)
+		}
+		for _, op := range resp.Operations {
+			if op.Name == name {
+				return op
+			}
+		}
+		return nil
+	}
+
+	tracker := progress.Start(log.NewNopLogger(), "test-list-operations", 10, 100)
+	tracker.Add(5, 50)
+	op := find("test-list-operations")
+	if op == nil || !op.Running || op.RecordsDone != 5 || op.RecordsTotal != 10 || op.BytesDone != 50 || op.BytesTotal != 100 {
+		t.Fatalf("expected a running operation half done, got %+v", op)
+	}
+
+	// finished operations are listed with their final progress
+	tracker.Add(5, 50)
+	tracker.Finish()
+	op = find("test-list-operations")
+	if op == nil || op.Running || op.RecordsDone != 10 || op.Eta != nil {
+		t.Fatalf("expected a finished operation, got %+v", op)
+	}
+}
+
+func TestUndeleteKey(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := adminContext()
+	key := []byte("/registry/configmaps/default/a")
+	txn := func(modRevision int64, op *pb.RequestOp) {
+		t.Helper()
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: key, Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: modRevision}}},
+			Success: []*pb.RequestOp{op},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: key}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("Txn: %v", err)
+		}
+	}
+	put := func(value string) *pb.RequestOp {
+		return &pb.RequestOp{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: key, Value: []byte(value)}}}
+	}
+	value := func() string {
+		t.Helper()
+		resp, err := cs.Range(ctx, &pb.RangeRequest{Key: key})
+		if err != nil || len(resp.Kvs) != 1 {
+			t.Fatalf("expected key to exist, got %v: %v", resp, err)
+		}
+		return string(resp.Kvs[0].Value)
+	}
+
+	txn(0, put("v1"))
+	txn(1, put("v2"))
+	txn(2, &pb.RequestOp{Request: &pb.RequestOp_RequestDeleteRange{RequestDeleteRange: &pb.DeleteRangeRequest{Key: key}}})
+
+	// by default the last value before the delete is restored
+	resp, err := cs.UndeleteKey(ctx, &proto.UndeleteKeyRequest{Key: key})
+	if err != nil {
+		t.Fatalf("UndeleteKey: %v", err)
+	}
+	if resp.Revision != 4 || resp.RestoredRevision != 2 || resp.DeletedRevision != 3 {
+		t.Fatalf("expected revision 4 restored from 2 deleted at 3, got %+v", resp)
+	}
+	if v := value(); v != "v2" {
+		t.Fatalf("expected restored value v2, got %s", v)
+	}
+
+	// keys which exist are not undeleted
+	if _, err = cs.UndeleteKey(ctx, &proto.UndeleteKeyRequest{Key: key}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for a key which exists, got %v", err)
+	}
+
+	// an earlier value can be restored as of a revision, but not as of a
+	// revision at which the key was deleted
+	txn(4, &pb.RequestOp{Request: &pb.RequestOp_RequestDeleteRange{RequestDeleteRange: &pb.DeleteRangeRequest{Key: key}}})
+	if _, err = cs.UndeleteKey(ctx, &proto.UndeleteKeyRequest{Key: key, AsOfRevision: 3}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition as of a deleted revision, got %v", err)
+	}
+	if resp, err = cs.UndeleteKey(ctx, &proto.UndeleteKeyRequest{Key: key, AsOfRevision: 1}); err != nil {
+		t.Fatalf("UndeleteKey as of revision 1: %v", err)
+	}
+	if resp.RestoredRevision != 1 || resp.DeletedRevision != 5 {
+		t.Fatalf("expected revision 1 restored, deleted at 5, got %+v", resp)
+	}
+	if v := value(); v != "v1" {
+		t.Fatalf("expected restored value v1, got %s", v)
+	}
+
+	// keys without records are not found
+	if _, err = cs.UndeleteKey(ctx, &proto.UndeleteKeyRequest{Key: []byte("missing")}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for a key without records, got %v", err)
+	}
+}
+
+func TestListWatchPrefixes(t *testing.T) {
+	cs := &ClientAPIServer{admins: adminIdentities{testAdminIdentity: true}}
+	watchers := []*watcher{
+		{id: -1, watches: map[int64]watch{
+			1: {prefix: "/registry/pods"},
+			2: {prefix: "/registry/pods"},
+			3: {prefix: "/registry/secrets"},
+		}},
+		{id: -2, watches: map[int64]watch{
+			4: {prefix: "/registry/pods"},
+		}},
+		{id: -3, watches: map[int64]watch{}},
+	}
+	allWatchers.Lock()
+	for _, w := range watchers {
+		allWatchers.servers[w.id] = w
+	}
+	allWatchers.Unlock()
+	t.Cleanup(func() {
+		allWatchers.Lock()
+		for _, w := range watchers {
+			delete(allWatchers.servers, w.id)
+		}
+		allWatchers.Unlock()
+	})
+
+	resp, err := cs.ListWatchPrefixes(adminContext(), &proto.ListWatchPrefixesRequest{})
+	if err != nil {
+		t.Fatalf("ListWatchPrefixes: %v", err)
+	}
+	if resp.Watches != 4 || resp.Watchers != 3 || len(resp.Prefixes) != 2 {
+		t.Fatalf("expected 4 watches on 2 prefixes from 3 watchers, got %+v", resp)
+	}
+	for i, expected := range []*proto.WatchPrefix{
+		{Prefix: "/registry/pods", Watches: 3, Watchers: 2},
+		{Prefix: "/registry/secrets", Watches: 1, Watchers: 1},
+	} {
+		prefix := resp.Prefixes[i]
+		if prefix.Prefix != expected.Prefix || prefix.Watches != expected.Watches || prefix.Watchers != expected.Watchers {
+			t.Errorf("prefix %d: expected %+v, got %+v", i, expected, prefix)
+		}
+	}
+}
+
+func TestListNamespaceWrites(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 30, 0, time.UTC)
+	db := localdbtest.New(t)
+	namespaces := newNamespaceWrites(db, 2)
+	namespaces.now = func() time.Time { return now }
+	cs := &ClientAPIServer{namespaces: namespaces, admins: adminIdentities{testAdminIdentity: true}}
+
+	// records are read from the local database, so writes committed by
+	// another leader, or before the window, are counted by when they were
+	// created
+	revision := int64(0)
+	write := func(key string, createdAt time.Time) {
+		t.Helper()
+		revision++
+		record := &proto.Record{Revision: revision, Key: []byte(key), Created: true, CreateRevision: revision, Version: 1, Value: []byte("value"), LeaderId: "other", CreatedAt: timestamppb.New(createdAt)}
+		if _, err := db.ReplicateRecord(record, nil); err != nil {
+			t.Fatalf("ReplicateRecord: %v", err)
+		}
+	}
+	write("/registry/pods/team-d/p1", now.Add(-10*time.Minute))
+	for _, key := range []string{
+		"/registry/pods/team-a/p1",
+		"/registry/pods/team-a/p2",
+		"/registry/configmaps/team-a/c1",
+		"/registry/pods/team-b/p1",
+		"/registry/namespaces/team-c",
+		"/registry/pods/team-c/p1",
+	} {
+		write(key, now.Add(-time.Minute))
+	}
+
+	resp, err := cs.ListNamespaceWrites(adminContext(), &proto.ListNamespaceWritesRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListNamespaceWrites: %v", err)
+	}
+	// the window is the current minute so far and the 4 minutes before it
+	if window := resp.Window.AsDuration(); window != 4*time.Minute+30*time.Second {
+		t.Errorf("expected a window of 4m30s, got %s", window)
+	}
+	if resp.Writes != 6 || len(resp.Namespaces) != 2 {
+		t.Fatalf("expected 6 writes with 2 namespaces returned, got %+v", resp)
+	}
+	top := resp.Namespaces[0]
+	if top.Namespace != "team-a" || top.Writes != 3 || top.Bytes != int64(len("/registry/pods/team-a/p1value")*2+len("/registry/configmaps/team-a/c1value")) {
+		t.Errorf("expected team-a to have the most writes, got %+v", top)
+	}
+	if top.WritesPerMinute != 3/4.5 {
+		t.Errorf("expected %f writes per minute, got %f", 3/4.5, top.WritesPerMinute)
+	}
+
+	// writes leave the window once their minute is older than it
+	now = now.Add(5 * time.Minute)
+	write("/registry/pods/team-b/p2", now)
+	resp, err = cs.ListNamespaceWrites(adminContext(), &proto.ListNamespaceWritesRequest{})
+	if err != nil {
+		t.Fatalf("ListNamespaceWrites: %v", err)
+	}
+	if resp.Writes != 1 || len(resp.Namespaces) != 1 || resp.Namespaces[0].Namespace != "team-b" {
+		t.Errorf("expected only the latest write to team-b, got %+v", resp)
+	}
+
+	// only the first 2 namespaces written to by this node are labelled in
+	// metrics
+	for _, key := range []string{"/registry/pods/team-a/p3", "/registry/pods/team-b/p3", "/registry/pods/team-c/p2"} {
+		namespaces.record(&proto.Record{Key: []byte(key)})
+	}
+	if len(namespaces.labelled) != 2 || !namespaces.labelled["team-a"] || !namespaces.labelled["team-b"] {
+		t.Errorf("expected team-a and team-b to be labelled, got %v", namespaces.labelled)
+	}
+
+	if _, err = cs.ListNamespaceWrites(adminContext(), &proto.ListNamespaceWritesRequest{Limit: -1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a negative limit, got %v", err)
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := adminContext()
+	key := []byte("/registry/a")
+	_, err := cs.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: key, Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: key, Value: []byte("a")}}}},
+	})
+	if err != nil {
+		t.Fatalf("Txn: %v", err)
+	}
+
+	resp, err := cs.GetStatus(ctx, &proto.GetStatusRequest{})
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if resp.LocalRevision != 1 || resp.MemoryLevel != "normal" || resp.WriteFence != nil {
+		t.Errorf("expected revision 1, normal memory level and no fence, got %+v", resp)
+	}
+
+	// netsy-specific state is not reported as etcd Status errors
+	statusResp, err := cs.Status(ctx, &pb.StatusRequest{})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statusResp.Errors) != 0 {
+		t.Errorf("expected no Status errors, got %v", statusResp.Errors)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc/status"
+)
+
+// priorityClass determines which admission slots a request may use
+type priorityClass int
+
+const (
+	// priorityUser is bulk traffic, e.g. reads and writes of most resources
+	priorityUser priorityClass = iota
+	// prioritySystem is traffic for keys which control plane liveness
+	// depends on, e.g. leases and leader election
+	prioritySystem
+)
+
+func (p priorityClass) String() string {
+	if p == prioritySystem {
+		return "system"
+	}
+	return "user"
+}
+
+// classifyKey returns the priority class for a key, which is system if the
+// key has one of the system prefixes
+func classifyKey(key []byte, systemPrefixes [][]byte) priorityClass {
+	for _, prefix := range systemPrefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return prioritySystem
+		}
+	}
+	return priorityUser
+}
+
+// txnKey returns the key a Txn request operates on. Kubernetes transactions
+// only ever operate on a single key, so the first key found is used.
+func txnKey(r *pb.TxnRequest) []byte {
+	if len(r.Compare) > 0 {
+		return r.Compare[0].Key
+	}
+	for _, ops := range [][]*pb.RequestOp{r.Success, r.Failure} {
+		for _, op := range ops {
+			switch {
+			case op.GetRequestRange() != nil:
+				return op.GetRequestRange().Key
+			case op.GetRequestPut() != nil:
+				return op.GetRequestPut().Key
+			case op.GetRequestDeleteRange() != nil:
+				return op.GetRequestDeleteRange().Key
+			}
+		}
+	}
+	return nil
+}
+
+// admission bounds the number of in-flight Range and Txn requests, while
+// reserving some slots for system requests. When user traffic saturates its
+// slots, user requests wait but system requests still proceed, so that
+// liveness-critical keys stay responsive during load spikes.
+type admission struct {
+	// shared slots may be used by any request
+	shared chan struct{}
+	// reserved slots may only be used by system requests
+	reserved chan struct{}
+	// systemPrefixes are the key prefixes of system requests
+	systemPrefixes [][]byte
+}
+
+// newAdmission creates an admission controller permitting up to maxInFlight
+// requests, of which reservedSystem are reserved for system requests.
+// If maxInFlight is zero, admission control is disabled and nil is returned.
+func newAdmission(maxInFlight int64, reservedSystem int64, systemPrefixes []string) *admission {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	if reservedSystem < 0 {
+		reservedSystem = 0
+	}
+	if reservedSystem >= maxInFlight {
+		reservedSystem = maxInFlight - 1
+	}
+	a := &admission{
+		shared:   make(chan struct{}, maxInFlight-reservedSystem),
+		reserved: make(chan struct{}, reservedSystem),
+	}
+	for _, prefix := range systemPrefixes {
+		a.systemPrefixes = append(a.systemPrefixes, []byte(prefix))
+	}
+	return a
+}
+
+// acquire blocks until a slot is available for a request on key, returning
+// a function to release the slot. A nil admission admits all requests.
+func (a *admission) acquire(ctx context.Context, key []byte) (release func(), err error) {
+	if a == nil {
+		return func() {}, nil
+	}
+	class := classifyKey(key, a.systemPrefixes)
+	start := time.Now()
+	var slots chan struct{}
+	if class == prioritySystem {
+		// prefer reserved slots, so shared slots remain for user requests
+		select {
+		case a.reserved <- struct{}{}:
+			slots = a.reserved
+		default:
+		}
+	}
+	if slots == nil {
+		if class == prioritySystem {
+			select {
+			case a.reserved <- struct{}{}:
+				slots = a.reserved
+			case a.shared <- struct{}{}:
+				slots = a.shared
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+		} else {
+			select {
+			case a.shared <- struct{}{}:
+				slots = a.shared
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+		}
+	}
+	metrics.RequestAdmissionWait.WithLabelValues(class.String()).Observe(time.Since(start).Seconds())
+	metrics.RequestsInFlight.WithLabelValues(class.String()).Inc()
+	return func() {
+		<-slots
+		metrics.RequestsInFlight.WithLabelValues(class.String()).Dec()
+	}, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+func TestClassifyKey(t *testing.T) {
+	prefixes := [][]byte{[]byte("/registry/leases/"), []byte("/registry/configmaps/kube-system/")}
+	tests := []struct {
+		key    string
+		expect priorityClass
+	}{
+		{"/registry/leases/kube-node-lease/node-1", prioritySystem},
+		{"/registry/configmaps/kube-system/extension-apiserver-authentication", prioritySystem},
+		{"/registry/configmaps/default/app", priorityUser},
+		{"/registry/pods/default/app", priorityUser},
+		{"", priorityUser},
+	}
+	for _, test := range tests {
+		if result := classifyKey([]byte(test.key), prefixes); result != test.expect {
+			t.Errorf("classifyKey(%q) = %s, want %s", test.key, result, test.expect)
+		}
+	}
+}
+
+func TestTxnKey(t *testing.T) {
+	put := &pb.TxnRequest{
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("a")}}}},
+	}
+	if key := string(txnKey(put)); key != "a" {
+		t.Errorf("txnKey(put) = %q, want %q", key, "a")
+	}
+	compare := &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: []byte("b")}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("b")}}}},
+	}
+	if key := string(txnKey(compare)); key != "b" {
+		t.Errorf("txnKey(compare) = %q, want %q", key, "b")
+	}
+	if key := txnKey(&pb.TxnRequest{}); key != nil {
+		t.Errorf("txnKey(empty) = %q, want nil", key)
+	}
+}
+
+func TestAdmissionReservesSystemSlots(t *testing.T) {
+	a := newAdmission(2, 1, []string{"/registry/leases/"})
+
+	// saturate the single shared slot with a user request
+	releaseUser, err := a.acquire(context.Background(), []byte("/registry/pods/a"))
+	if err != nil {
+		t.Fatalf("acquire user error: %v", err)
+	}
+
+	// another user request must wait
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := a.acquire(ctx, []byte("/registry/pods/b")); err == nil {
+		t.Fatalf("expected user request to wait while shared slots are saturated")
+	}
+
+	// a system request is still admitted using the reserved slot
+	releaseSystem, err := a.acquire(context.Background(), []byte("/registry/leases/kube-system/leader"))
+	if err != nil {
+		t.Fatalf("acquire system error: %v", err)
+	}
+	releaseSystem()
+	releaseUser()
+
+	// once released, user requests are admitted again
+	releaseUser, err = a.acquire(context.Background(), []byte("/registry/pods/b"))
+	if err != nil {
+		t.Fatalf("acquire user after release error: %v", err)
+	}
+	releaseUser()
+}
+
+func TestAdmissionDisabled(t *testing.T) {
+	a := newAdmission(0, 0, nil)
+	if a != nil {
+		t.Fatalf("expected nil admission when max in flight is zero")
+	}
+	release, err := a.acquire(context.Background(), []byte("a"))
+	if err != nil {
+		t.Fatalf("acquire on nil admission error: %v", err)
+	}
+	release()
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/peerapi"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/proxy"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SetProxy runs the server in proxy mode (see package proxy): writes and
+// leases are forwarded to the upstream etcd of p, and the records it
+// replicates are sent to watchers. Replication is started by SetReady, so
+// SetProxy must be called before it.
+func (clientServer *ClientAPIServer) SetProxy(p *proxy.Proxy) {
+	clientServer.proxy = p
+}
+
+// proxyDistributor sends records replicated by the proxy to watchers and
+// commit hooks, and counts their namespace writes, as for records committed
+// by Txn
+type proxyDistributor struct {
+	cs *ClientAPIServer
+}
+
+func (d proxyDistributor) Distribute(record *proto.Record, prevRecord *proto.Record) {
+	d.cs.Distribute(record, prevRecord)
+	d.cs.fireCommitHooks(record)
+	d.cs.namespaces.record(record)
+}
+
+// proxyHeader returns the response header for a response forwarded from
+// the upstream etcd, with this server's cluster and member IDs
+func (cs *ClientAPIServer) proxyHeader(header *pb.ResponseHeader) *pb.ResponseHeader {
+	return cs.header.At(header.GetRevision())
+}
+
+// proxyError converts the error of a forwarded request, which is returned
+// as is if it came from the upstream etcd
+func proxyError(err error) error {
+	if errors.Is(err, proxy.ErrNotReplicated) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return err
+}
+
+// proxyTxn forwards a transaction to the upstream etcd. Of the transactions
+// which write, only those netsy supports are forwarded, which write a single
+// key, as the proxy cannot replicate revisions which change more than one
+// key. Read-only transactions are forwarded as is.
+func (cs *ClientAPIServer) proxyTxn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	if !commonapi.IsReadOnlyTxn(r) {
+		if _, err := peerapi.ParseTxnRequest(r); errors.Is(err, commonapi.ErrUnsupported) {
+			commonapi.CountUnsupported(err)
+			return nil, err
+		} else if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	resp, err := cs.proxy.Txn(ctx, r)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	resp.Header = cs.proxyHeader(resp.Header)
+	return resp, nil
+}
+
+// proxyDeleteRange forwards the delete of a single key to the upstream etcd.
+// Range deletes are not forwarded, as the proxy cannot replicate revisions
+// which change more than one key.
+func (cs *ClientAPIServer) proxyDeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, error) {
+	if len(r.RangeEnd) > 0 {
+		return nil, commonapi.Unsupported("DeleteRange range_end in proxy mode")
+	}
+	resp, err := cs.proxy.DeleteRange(ctx, r)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	resp.Header = cs.proxyHeader(resp.Header)
+	return resp, nil
+}
+
+// proxyLeaseKeepAlive forwards a keep alive stream to the upstream etcd,
+// until either stream ends or the server is stopped
+func (cs *ClientAPIServer) proxyLeaseKeepAlive(ka pb.Lease_LeaseKeepAliveServer) error {
+	ctx, cancel := context.WithCancel(ka.Context())
+	defer cancel()
+	upstream, err := cs.proxy.Lease().LeaseKeepAlive(ctx)
+	if err != nil {
+		return err
+	}
+	// forward each direction on a separate goroutine, which ends once the
+	// streams end when this returns
+	errCh := make(chan error, 2)
+	cs.goWatch(func() {
+		for {
+			req, err := ka.Recv()
+			if err == nil {
+				err = upstream.Send(req)
+			}
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}
+	})
+	cs.goWatch(func() {
+		for {
+			resp, err := upstream.Recv()
+			if err == nil {
+				resp.Header = cs.proxyHeader(resp.Header)
+				err = ka.Send(resp)
+			}
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}
+	})
+	select {
+	case <-cs.stopCtx.Done():
+		return errServerStopping
+	case err := <-errCh:
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+}
+
+// proxyCompact forwards a compaction to the upstream etcd, then compacts the
+// local database to the same revision
+func (cs *ClientAPIServer) proxyCompact(ctx context.Context, r *pb.CompactionRequest) (*pb.CompactionResponse, error) {
+	resp, err := cs.proxy.Compact(ctx, r)
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	if _, err = cs.peerServer.LeaderCompact(ctx, r.Revision, r.Physical); err != nil && !errors.Is(err, peerapi.ErrCompacted) {
+		level.Warn(cs.logger).Log("msg", "failed to compact local database after compacting upstream etcd", "revision", r.Revision, "error", err)
+	}
+	resp.Header = cs.proxyHeader(resp.Header)
+	return resp, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// rangeCache caches the responses of Range requests at a past revision,
+// which cannot change once the revision has been written, e.g. the pages of
+// lists by multiple kube-apiservers, which each request at the same
+// revision. Responses are evicted least recently used first, once the cache
+// exceeds its size. Reads at a compacted revision are not served from the
+// cache, as the compacted values are no longer stored (see cachedRange).
+type rangeCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	lru      *list.List // of *rangeCacheEntry, most recently used first
+	entries  map[string]*list.Element
+}
+
+// rangeCacheEntry is a cached response, without its header
+type rangeCacheEntry struct {
+	key  string
+	resp *pb.RangeResponse
+	size int64
+}
+
+// newRangeCache returns a cache of up to maxBytes of responses, or nil if
+// maxBytes is 0, in which case responses are not cached
+func newRangeCache(maxBytes int64) *rangeCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &rangeCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+// rangeCacheKey returns the cache key of r, or false if its response may
+// change and so cannot be cached, i.e. it is not at a past revision
+func rangeCacheKey(r *pb.RangeRequest) (string, bool) {
+	if r.Revision <= 0 {
+		return "", false
+	}
+	key, err := r.Marshal()
+	if err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+// get returns a copy of the cached response to the request with key, without
+// a header
+func (c *rangeCache) get(key string) (resp *pb.RangeResponse, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return copyRangeResponse(element.Value.(*rangeCacheEntry).resp), true
+}
+
+// evict removes the cached response to the request with key, if any
+func (c *rangeCache) evict(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// add caches a copy of resp, the response to the request with key, evicting
+// the least recently used responses to keep the cache within its size.
+// Responses larger than the cache are not cached.
+func (c *rangeCache) add(key string, resp *pb.RangeResponse) {
+	entry := &rangeCacheEntry{key: key, resp: copyRangeResponse(resp)}
+	entry.resp.Header = nil
+	entry.size = int64(len(key) + entry.resp.Size())
+	if entry.size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	for c.bytes+entry.size > c.maxBytes {
+		c.remove(c.lru.Back())
+		metrics.RangeCacheEvictions.Inc()
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+	metrics.RangeCacheEntries.Inc()
+	metrics.RangeCacheBytes.Add(float64(entry.size))
+}
+
+// remove removes a cached response. The cache must be locked.
+func (c *rangeCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*rangeCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+	metrics.RangeCacheEntries.Dec()
+	metrics.RangeCacheBytes.Sub(float64(entry.size))
+}
+
+// rangeResponseHash returns the SHA-256 hash of resp, excluding its header,
+// which is at the latest revision
+func rangeResponseHash(resp *pb.RangeResponse) [sha256.Size]byte {
+	withoutHeader := *resp
+	withoutHeader.Header = nil
+	data, _ := withoutHeader.Marshal()
+	return sha256.Sum256(data)
+}
+
+// copyRangeResponse returns a copy of resp whose key-values can be modified
+// (e.g. by redactRange) without modifying resp. Their keys and values are
+// shared, so must not be modified in place.
+func copyRangeResponse(resp *pb.RangeResponse) *pb.RangeResponse {
+	copied := *resp
+	copied.Kvs = make([]*mvccpb.KeyValue, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		kvCopy := *kv
+		copied.Kvs[i] = &kvCopy
+	}
+	return &copied
+}
@@ -0,0 +1,170 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc"
+)
+
+func TestRangeCacheEviction(t *testing.T) {
+	response := func(value string) *pb.RangeResponse {
+		return &pb.RangeResponse{Kvs: []*mvccpb.KeyValue{{Key: []byte("/a"), Value: []byte(value)}}, Count: 1}
+	}
+	entrySize := int64(len("a") + response("1").Size())
+	c := newRangeCache(2 * entrySize)
+	c.add("a", response("1"))
+	c.add("b", response("2"))
+	// a is used more recently than b, so b is evicted to make room for c
+	if _, ok := c.get("a"); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+	c.add("c", response("3"))
+	if _, ok := c.get("b"); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	resp, ok := c.get("a")
+	if !ok || string(resp.Kvs[0].Value) != "1" {
+		t.Fatalf("expected a to be cached, got %v", resp)
+	}
+	// cached responses are copied, so are not modified by their readers
+	resp.Kvs[0].Value = nil
+	if resp, _ = c.get("a"); string(resp.Kvs[0].Value) != "1" {
+		t.Fatalf("expected cached response not to be modified, got %v", resp)
+	}
+	if c.bytes != 2*entrySize || c.lru.Len() != 2 {
+		t.Fatalf("expected 2 cached responses of %d bytes, got %d of %d bytes", entrySize, c.lru.Len(), c.bytes)
+	}
+
+	// responses larger than the cache are not cached
+	c.add("d", &pb.RangeResponse{Kvs: []*mvccpb.KeyValue{{Key: []byte("/d"), Value: make([]byte, 2*entrySize)}}})
+	if _, ok = c.get("d"); ok {
+		t.Fatalf("expected response larger than the cache not to be cached")
+	}
+	if newRangeCache(0) != nil {
+		t.Fatalf("expected a cache of 0 bytes to be disabled")
+	}
+}
+
+// TestRangeCache checks that Range requests at a past revision are served
+// from the cache, with a header at the latest revision, until the revision
+// is compacted
+func TestRangeCache(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := context.Background()
+	for i, modRevision := range []int64{0, 1} {
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte("/a"), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: modRevision}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("/a"), Value: []byte(fmt.Sprint(i + 1))}}}},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte("/a")}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put: %v", err)
+		}
+	}
+
+	hits := testutil.ToFloat64(metrics.RangeCacheRequests.WithLabelValues("hit"))
+	for i := 0; i < 2; i++ {
+		resp, err := cs.Range(ctx, &pb.RangeRequest{Key: []byte("/a"), Revision: 1})
+		if err != nil || len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "1" || resp.Header.Revision != 2 {
+			t.Fatalf("expected value at revision 1 with header at revision 2, got %v (%v)", resp, err)
+		}
+	}
+	if hit := testutil.ToFloat64(metrics.RangeCacheRequests.WithLabelValues("hit")) - hits; hit != 1 {
+		t.Fatalf("expected 1 cache hit, got %v", hit)
+	}
+	// requests at a future revision are not cached
+	if _, err := cs.Range(ctx, &pb.RangeRequest{Key: []byte("/a"), Revision: 3}); err != nil {
+		t.Fatalf("Range: %v", err)
+	}
+	if key, _ := rangeCacheKey(&pb.RangeRequest{Key: []byte("/a"), Revision: 3}); cs.rangeCache.entries[key] != nil {
+		t.Fatalf("expected response at a future revision not to be cached")
+	}
+
+	if _, err := cs.Compact(ctx, &pb.CompactionRequest{Revision: 2}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if _, err := cs.Range(ctx, &pb.RangeRequest{Key: []byte("/a"), Revision: 1}); err != rpctypes.ErrGRPCCompacted {
+		t.Fatalf("expected ErrGRPCCompacted once compacted, got %v", err)
+	}
+}
+
+// TestRangeCacheVerify checks that cached responses which differ from the
+// local db are evicted, and the response from the local db is returned
+func TestRangeCacheVerify(t *testing.T) {
+	configtest.Set(t, map[string]any{"range_cache_verify_percent": 100})
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := context.Background()
+	resp, err := cs.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: []byte("/a"), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("/a"), Value: []byte("1")}}}},
+	})
+	if err != nil || !resp.Succeeded {
+		t.Fatalf("put: %v", err)
+	}
+	r := &pb.RangeRequest{Key: []byte("/a"), Revision: 1}
+	if _, err = cs.Range(ctx, r); err != nil {
+		t.Fatalf("Range: %v", err)
+	}
+
+	matches := testutil.ToFloat64(metrics.RangeCacheVerifications.WithLabelValues("match"))
+	if rangeResp, err := cs.Range(ctx, r); err != nil || string(rangeResp.Kvs[0].Value) != "1" {
+		t.Fatalf("expected cached value, got %v (%v)", rangeResp, err)
+	}
+	if match := testutil.ToFloat64(metrics.RangeCacheVerifications.WithLabelValues("match")) - matches; match != 1 {
+		t.Fatalf("expected cached response to match, got %v matches", match)
+	}
+
+	// a cached response which changed is evicted
+	key, _ := rangeCacheKey(r)
+	cs.rangeCache.entries[key].Value.(*rangeCacheEntry).resp.Kvs[0].Value = []byte("changed")
+	mismatches := testutil.ToFloat64(metrics.RangeCacheVerifications.WithLabelValues("mismatch"))
+	if rangeResp, err := cs.Range(ctx, r); err != nil || string(rangeResp.Kvs[0].Value) != "1" {
+		t.Fatalf("expected value from the local db, got %v (%v)", rangeResp, err)
+	}
+	if mismatch := testutil.ToFloat64(metrics.RangeCacheVerifications.WithLabelValues("mismatch")) - mismatches; mismatch != 1 {
+		t.Fatalf("expected cached response not to match, got %v mismatches", mismatch)
+	}
+	cached, ok := cs.rangeCache.get(key)
+	if !ok || string(cached.Kvs[0].Value) != "1" {
+		t.Fatalf("expected response from the local db to be cached, got %v", cached)
+	}
+
+	// a response compacted while it is verified is evicted, but is not a
+	// mismatch
+	resp, err = cs.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: []byte("/a"), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 1}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("/a"), Value: []byte("2")}}}},
+		Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte("/a")}}}},
+	})
+	if err != nil || !resp.Succeeded {
+		t.Fatalf("put: %v", err)
+	}
+	if _, err = cs.Compact(ctx, &pb.CompactionRequest{Revision: 2}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	mismatches = testutil.ToFloat64(metrics.RangeCacheVerifications.WithLabelValues("mismatch"))
+	compacted := testutil.ToFloat64(metrics.RangeCacheVerifications.WithLabelValues("compacted"))
+	if cs.verifyCachedRange(ctx, key, r, cached) {
+		t.Fatalf("expected compacted response not to be verified")
+	}
+	if mismatch := testutil.ToFloat64(metrics.RangeCacheVerifications.WithLabelValues("mismatch")) - mismatches; mismatch != 0 {
+		t.Fatalf("expected compacted response not to be a mismatch, got %v mismatches", mismatch)
+	}
+	if compacted = testutil.ToFloat64(metrics.RangeCacheVerifications.WithLabelValues("compacted")) - compacted; compacted != 1 {
+		t.Fatalf("expected compacted response to be counted, got %v", compacted)
+	}
+	if _, ok = cs.rangeCache.get(key); ok {
+		t.Fatalf("expected compacted response to be evicted")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Readiness tracks whether the server is ready to serve client requests,
+// i.e. backfill and integrity verification have completed. Until it is
+// ready, the health service reports NOT_SERVING and client requests fail
+// with Unavailable, so the gRPC listener may be started early.
+type Readiness struct {
+	ready  atomic.Bool
+	health *health.Server
+}
+
+// NewReadiness returns a Readiness which is not yet ready
+func NewReadiness() *Readiness {
+	r := &Readiness{health: health.NewServer()}
+	r.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return r
+}
+
+// Ready returns true once SetReady has been called
+func (r *Readiness) Ready() bool {
+	return r.ready.Load()
+}
+
+// setReady marks the server as ready, see ClientAPIServer.SetReady
+func (r *Readiness) setReady() {
+	r.ready.Store(true)
+	r.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+}
+
+// setNotServing reports NOT_SERVING from the health service as the server
+// stops, so that load balancers stop sending it new clients, while requests
+// continue to be served until the gRPC server is stopped
+func (r *Readiness) setNotServing() {
+	r.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// RegisterHealth registers the health service on s, e.g. a plaintext server
+// for probes which do not support TLS (see listen_health_addr)
+func (r *Readiness) RegisterHealth(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, r.health)
+}
+
+// ServerOptions returns interceptors which fail client requests with
+// Unavailable until ready, for use with grpc.NewServer
+func (r *Readiness) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(r.unaryInterceptor),
+		grpc.ChainStreamInterceptor(r.streamInterceptor),
+	}
+}
+
+func (r *Readiness) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := r.check(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (r *Readiness) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := r.check(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// check returns Unavailable if not ready, except for the health and
+// reflection services which are always available
+func (r *Readiness) check(fullMethod string) error {
+	if r.Ready() ||
+		strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/") ||
+		strings.HasPrefix(fullMethod, "/grpc.reflection.") {
+		return nil
+	}
+	return status.Errorf(codes.Unavailable, "netsy is starting up")
+}
@@ -0,0 +1,50 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadiness(t *testing.T) {
+	r := NewReadiness()
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	call := func(method string) error {
+		_, err := r.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	health := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := r.health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("health Check: %v", err)
+		}
+		return resp.Status
+	}
+
+	if err := call("/etcdserverpb.KV/Range"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable before ready, got %v", err)
+	}
+	if err := call("/grpc.health.v1.Health/Check"); err != nil {
+		t.Fatalf("expected health to be available before ready, got %v", err)
+	}
+	if s := health(); s != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected NOT_SERVING before ready, got %v", s)
+	}
+
+	r.setReady()
+	if err := call("/etcdserverpb.KV/Range"); err != nil {
+		t.Fatalf("expected request to be served once ready, got %v", err)
+	}
+	if s := health(); s != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected SERVING once ready, got %v", s)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Read rules restrict which clients may read keys under a prefix (see
+// read_rules), e.g. so that only the kube-apiserver can read
+// /registry/secrets/, as a defense in depth beyond Kubernetes RBAC for
+// clients with direct access, such as backup or debugging tools.
+
+// readAction is what a read rule does for a client
+type readAction int
+
+const (
+	// readAllow allows the client access to keys under the prefix
+	readAllow readAction = iota
+	// readRedact strips the values of keys under the prefix from the
+	// client's ranges and watch events
+	readRedact
+	// readDeny rejects the client's requests and watches which include keys
+	// under the prefix
+	readDeny
+)
+
+var readActions = map[string]readAction{
+	"allow":  readAllow,
+	"redact": readRedact,
+	"deny":   readDeny,
+}
+
+// anyClient matches clients which are not listed in a read rule
+const anyClient = "*"
+
+// readRule is the action for each client for keys under prefix
+type readRule struct {
+	prefix  []byte
+	actions map[string]readAction
+}
+
+// readRules are the configured read rules, in order
+type readRules []readRule
+
+// parseReadRules parses semicolon-separated read rules, each of the form
+// prefix=client:action,client:action. Clients may contain colons (e.g.
+// system:kube-apiserver), so the action follows the last colon.
+func parseReadRules(s string) (rules readRules, err error) {
+	for _, entry := range strings.Split(s, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, clients, ok := strings.Cut(entry, "=")
+		if prefix = strings.TrimSpace(prefix); !ok || prefix == "" {
+			return nil, fmt.Errorf("expected prefix=client:action in %q", entry)
+		}
+		rule := readRule{prefix: []byte(prefix), actions: map[string]readAction{}}
+		for _, client := range strings.Split(clients, ",") {
+			i := strings.LastIndex(client, ":")
+			if i < 0 {
+				return nil, fmt.Errorf("expected client:action in %q", client)
+			}
+			identity, actionName := strings.TrimSpace(client[:i]), strings.TrimSpace(client[i+1:])
+			action, ok := readActions[actionName]
+			if !ok {
+				return nil, fmt.Errorf("unknown action %q for prefix %s, expected allow, redact or deny", actionName, prefix)
+			}
+			if identity == "" {
+				return nil, fmt.Errorf("missing client for prefix %s", prefix)
+			}
+			if _, ok := rule.actions[identity]; ok {
+				return nil, fmt.Errorf("duplicate client %q for prefix %s", identity, prefix)
+			}
+			rule.actions[identity] = action
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// policy returns the prefixes a client is denied or has redacted
+func (rules readRules) policy(identity string) (p readPolicy) {
+	for _, rule := range rules {
+		action, ok := rule.actions[identity]
+		if !ok {
+			action = rule.actions[anyClient]
+		}
+		switch action {
+		case readRedact:
+			p.redact = append(p.redact, rule.prefix)
+		case readDeny:
+			p.deny = append(p.deny, rule.prefix)
+		}
+	}
+	p.identity = identity
+	return p
+}
+
+// readPolicy is the prefixes a client is denied access to or has redacted.
+// The zero readPolicy allows all keys.
+type readPolicy struct {
+	identity string
+	deny     [][]byte
+	redact   [][]byte
+}
+
+// checkRange returns a PermissionDenied error if the range from key to
+// rangeEnd (as in a Range request) includes keys under a denied prefix
+func (p readPolicy) checkRange(key, rangeEnd []byte) error {
+	for _, prefix := range p.deny {
+		if rangeIncludesPrefix(key, rangeEnd, prefix) {
+			metrics.ClientRequestsDenied.WithLabelValues(p.identity).Inc()
+			return status.Errorf(codes.PermissionDenied, "client %q may not access keys under %s", p.identity, keys.Quote(prefix))
+		}
+	}
+	return nil
+}
+
+// checkTxn returns a PermissionDenied error if a Txn request's compares or
+// operations include keys under a denied prefix, or it compares the value of
+// a key under a redacted prefix
+func (p readPolicy) checkTxn(r *pb.TxnRequest) error {
+	if len(p.deny) == 0 && len(p.redact) == 0 {
+		return nil
+	}
+	for _, c := range r.Compare {
+		if err := p.checkRange(c.Key, c.RangeEnd); err != nil {
+			return err
+		}
+		if c.Target == pb.Compare_VALUE {
+			for _, prefix := range p.redact {
+				if rangeIncludesPrefix(c.Key, c.RangeEnd, prefix) {
+					metrics.ClientRequestsDenied.WithLabelValues(p.identity).Inc()
+					return status.Errorf(codes.PermissionDenied, "client %q may not compare values under %s", p.identity, keys.Quote(prefix))
+				}
+			}
+		}
+	}
+	for _, ops := range [][]*pb.RequestOp{r.Success, r.Failure} {
+		for _, op := range ops {
+			var err error
+			switch {
+			case op.GetRequestRange() != nil:
+				err = p.checkRange(op.GetRequestRange().Key, op.GetRequestRange().RangeEnd)
+			case op.GetRequestPut() != nil:
+				err = p.checkRange(op.GetRequestPut().Key, nil)
+			case op.GetRequestDeleteRange() != nil:
+				err = p.checkRange(op.GetRequestDeleteRange().Key, op.GetRequestDeleteRange().RangeEnd)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// redacts returns true if the values of key are stripped
+func (p readPolicy) redacts(key []byte) bool {
+	for _, prefix := range p.redact {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactRange strips the values of keys under redacted prefixes from resp
+func (p readPolicy) redactRange(resp *pb.RangeResponse) {
+	if resp == nil || len(p.redact) == 0 {
+		return
+	}
+	for _, kv := range resp.Kvs {
+		if p.redacts(kv.Key) {
+			kv.Value = nil
+		}
+	}
+}
+
+// redactTxn strips the values of keys under redacted prefixes from the
+// ranges of resp
+func (p readPolicy) redactTxn(resp *pb.TxnResponse) {
+	if resp == nil || len(p.redact) == 0 {
+		return
+	}
+	for _, op := range resp.Responses {
+		p.redactRange(op.GetResponseRange())
+	}
+}
+
+// redactDeleteRange strips the values of keys under redacted prefixes from
+// the previous key-values of resp
+func (p readPolicy) redactDeleteRange(resp *pb.DeleteRangeResponse) {
+	if resp == nil || len(p.redact) == 0 {
+		return
+	}
+	for _, kv := range resp.PrevKvs {
+		if p.redacts(kv.Key) {
+			kv.Value = nil
+		}
+	}
+}
+
+// redactEvent returns event with the values of keys under redacted prefixes
+// stripped. Events are shared by all watchers, so are copied if redacted.
+func (p readPolicy) redactEvent(event *mvccpb.Event) *mvccpb.Event {
+	if !p.redacts(event.Kv.Key) {
+		return event
+	}
+	redacted := &mvccpb.Event{Type: event.Type}
+	kv := *event.Kv
+	kv.Value = nil
+	redacted.Kv = &kv
+	if event.PrevKv != nil {
+		prevKv := *event.PrevKv
+		prevKv.Value = nil
+		redacted.PrevKv = &prevKv
+	}
+	return redacted
+}
+
+// rangeIncludesPrefix returns true if the range from key to rangeEnd (as in
+// a Range request) includes any key under prefix
+func rangeIncludesPrefix(key, rangeEnd, prefix []byte) bool {
+	if len(rangeEnd) == 0 {
+		return bytes.HasPrefix(key, prefix)
+	}
+	// a range end of "\x00" is all keys from key, as is a prefix end
+	toEnd := []byte{0}
+	prefixEnd := []byte(clientv3.GetPrefixRangeEnd(string(prefix)))
+	if !bytes.Equal(rangeEnd, toEnd) && bytes.Compare(rangeEnd, prefix) <= 0 {
+		return false
+	}
+	if !bytes.Equal(prefixEnd, toEnd) && bytes.Compare(key, prefixEnd) >= 0 {
+		return false
+	}
+	return true
+}
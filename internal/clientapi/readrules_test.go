@@ -0,0 +1,148 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseReadRules(t *testing.T) {
+	rules, err := parseReadRules(" /registry/secrets/=system:kube-apiserver:allow, backup:redact ,*:deny; /registry/configmaps/=backup:deny;")
+	if err != nil {
+		t.Fatalf("parseReadRules: %v", err)
+	}
+	tests := []struct {
+		identity string
+		deny     []string
+		redact   []string
+	}{
+		{"system:kube-apiserver", nil, nil},
+		{"backup", []string{"/registry/configmaps/"}, []string{"/registry/secrets/"}},
+		{anonymousClient, []string{"/registry/secrets/"}, nil},
+	}
+	for _, test := range tests {
+		p := rules.policy(test.identity)
+		if len(p.deny) != len(test.deny) || len(p.redact) != len(test.redact) {
+			t.Fatalf("policy of %q = %+v, want deny %v and redact %v", test.identity, p, test.deny, test.redact)
+		}
+		for i, prefix := range test.deny {
+			if string(p.deny[i]) != prefix {
+				t.Errorf("policy of %q denies %q, want %q", test.identity, p.deny[i], prefix)
+			}
+		}
+		for i, prefix := range test.redact {
+			if string(p.redact[i]) != prefix {
+				t.Errorf("policy of %q redacts %q, want %q", test.identity, p.redact[i], prefix)
+			}
+		}
+	}
+
+	for _, invalid := range []string{
+		"/registry/secrets/",
+		"=backup:deny",
+		"/registry/secrets/=backup",
+		"/registry/secrets/=backup:hide",
+		"/registry/secrets/=:deny",
+		"/registry/secrets/=backup:deny,backup:allow",
+	} {
+		if _, err := parseReadRules(invalid); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
+
+func TestRangeIncludesPrefix(t *testing.T) {
+	prefix := []byte("/registry/secrets/")
+	tests := []struct {
+		key, rangeEnd string
+		expect        bool
+	}{
+		{"/registry/secrets/default/a", "", true},
+		{"/registry/pods/default/a", "", false},
+		{"/registry/secrets/", "/registry/secrets0", true},
+		{"/registry/", "/registry0", true},
+		{"/registry/services/", "/registry/services0", false},
+		{"/registry/pods/", "/registry/secrets/", false},
+		{"/registry/pods/", "/registry/secrets/a", true},
+		{"/registry/secrets0", "\x00", false},
+		{"\x00", "\x00", true},
+	}
+	for _, test := range tests {
+		if result := rangeIncludesPrefix([]byte(test.key), []byte(test.rangeEnd), prefix); result != test.expect {
+			t.Errorf("rangeIncludesPrefix(%q, %q) = %t, want %t", test.key, test.rangeEnd, result, test.expect)
+		}
+	}
+}
+
+func TestReadPolicyRedactEvent(t *testing.T) {
+	p := readPolicy{redact: [][]byte{[]byte("/registry/secrets/")}}
+	event := &mvccpb.Event{
+		Kv:     &mvccpb.KeyValue{Key: []byte("/registry/secrets/a"), Value: []byte("v2"), ModRevision: 2},
+		PrevKv: &mvccpb.KeyValue{Key: []byte("/registry/secrets/a"), Value: []byte("v1"), ModRevision: 1},
+	}
+	redacted := p.redactEvent(event)
+	if redacted.Kv.Value != nil || redacted.PrevKv.Value != nil || redacted.Kv.ModRevision != 2 {
+		t.Fatalf("expected values to be redacted, got %v", redacted)
+	}
+	// events are shared by watchers, so must not be modified
+	if string(event.Kv.Value) != "v2" || string(event.PrevKv.Value) != "v1" {
+		t.Fatalf("expected event not to be modified, got %v", event)
+	}
+	other := &mvccpb.Event{Kv: &mvccpb.KeyValue{Key: []byte("/registry/pods/a"), Value: []byte("v")}}
+	if p.redactEvent(other) != other {
+		t.Fatalf("expected event of other key not to be redacted")
+	}
+}
+
+// TestReadRules checks that Range and Txn requests of a client are denied or
+// have values redacted by the read rules
+func TestReadRules(t *testing.T) {
+	configtest.Set(t, map[string]any{"read_rules": "/registry/secrets/=*:redact;/registry/private/=anonymous:deny"})
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := context.Background()
+	key := []byte("/registry/secrets/default/a")
+	resp, err := cs.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: key, Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: key, Value: []byte("secret")}}}},
+	})
+	if err != nil || !resp.Succeeded {
+		t.Fatalf("put: %v", err)
+	}
+
+	rangeResp, err := cs.Range(ctx, &pb.RangeRequest{Key: []byte("/registry/secrets/"), RangeEnd: []byte("/registry/secrets0")})
+	if err != nil || len(rangeResp.Kvs) != 1 || rangeResp.Kvs[0].Value != nil || rangeResp.Kvs[0].ModRevision != resp.Header.Revision {
+		t.Fatalf("expected value to be redacted, got %v (%v)", rangeResp, err)
+	}
+	txnResp, err := cs.Txn(ctx, &pb.TxnRequest{
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: key}}}},
+	})
+	if err != nil || len(txnResp.Responses[0].GetResponseRange().Kvs) != 1 || txnResp.Responses[0].GetResponseRange().Kvs[0].Value != nil {
+		t.Fatalf("expected Txn value to be redacted, got %v (%v)", txnResp, err)
+	}
+	_, err = cs.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: key, Target: pb.Compare_VALUE, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_Value{Value: []byte("secret")}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: key}}}},
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected comparing a redacted value to be denied, got %v", err)
+	}
+
+	// requests including a denied prefix are rejected
+	for _, r := range []*pb.RangeRequest{
+		{Key: []byte("/registry/private/a")},
+		{Key: []byte("/registry/"), RangeEnd: []byte("/registry0")},
+	} {
+		if _, err = cs.Range(ctx, r); status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expected Range %v to be denied, got %v", r, err)
+		}
+	}
+}
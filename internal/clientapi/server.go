@@ -4,22 +4,44 @@
 package clientapi
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/hooks"
+	"github.com/nadrama-com/netsy/internal/audit"
+	"github.com/nadrama-com/netsy/internal/commonapi"
 	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/lease"
 	"github.com/nadrama-com/netsy/internal/localdb"
 	"github.com/nadrama-com/netsy/internal/peerapi"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/proxy"
 	"github.com/nadrama-com/netsy/internal/s3client"
 	"github.com/nadrama-com/netsy/internal/snapshot"
+	"github.com/nadrama-com/netsy/internal/transform"
+	"github.com/nadrama-com/netsy/internal/watchdog"
 
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/codes"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
+// gracefulStopTimeout is how long Stop waits for in-flight requests to
+// complete before closing client connections
+const gracefulStopTimeout = 10 * time.Second
+
+// errServerStopping ends watches when the server is stopped, so that clients
+// reconnect to another server
+var errServerStopping = status.Error(codes.Unavailable, "server is stopping")
+
 // ClientAPIServer implements a gRPC server compatible with the Kubernetes etcd API subset
 // @see https://github.com/etcd-io/etcd/blob/main/api/etcdserverpb/rpc.proto#L37
 // @see https://github.com/etcd-io/etcd/blob/main/api/etcdserverpb/rpc.pb.go
@@ -31,6 +53,7 @@ import (
 // * Maintenance
 // * Auth
 // we include the 'Unimplemented' services by default and override them where required
+// netsy additionally serves its own Admin service (see proto/admin.proto)
 type ClientAPIServer struct {
 	logger     log.Logger
 	config     *config.Config
@@ -38,6 +61,57 @@ type ClientAPIServer struct {
 	grpcServer *grpc.Server
 	// note: in future we will replace this with a peer server gRPC client
 	peerServer *peerapi.PeerAPIServer
+	// s3Client lists data files for the Admin API, may be nil
+	s3Client *s3client.S3Client
+	// watchCreatePool bounds concurrent watch creation across all watchers
+	watchCreatePool *watchCreatePool
+	// compat holds behaviour specific to the emulated etcd version
+	compat *etcdCompat
+	// header is the template for response headers, with this server's
+	// cluster and member IDs
+	header commonapi.ResponseHeader
+	// values transforms the values of records as they are read
+	values transform.Chain
+	// admission prioritizes system requests when saturated, may be nil
+	admission *admission
+	// clients holds per-client settings and rate limits requests
+	clients *clientPolicies
+	// keyAllowlist restricts the keys which may be written, may be nil
+	keyAllowlist *keyAllowlist
+	// readRules restrict the keys each client may read
+	readRules readRules
+	// admins are the clients allowed to call the Admin API
+	admins adminIdentities
+	// rangeCache caches Range responses at past revisions, may be nil
+	rangeCache *rangeCache
+	// memWatchdog reports the memory degradation level, may be nil
+	memWatchdog *watchdog.Watchdog
+	// epoch fences watch events from earlier leaders (see epoch.go)
+	epoch leaderEpoch
+	// auditor is called once each request completes (see SetAuditor), and
+	// is replaced atomically as requests may be in flight
+	auditor     atomic.Pointer[audit.Auditor]
+	auditCloser io.Closer
+	// hooks are fired on commits and leader changes (see SetHooks), may be
+	// nil
+	hooks *hooks.Hooks
+	// namespaces counts the writes to each Kubernetes namespace
+	namespaces *namespaceWrites
+	// proxy forwards writes to an upstream etcd in proxy mode (see
+	// SetProxy), may be nil
+	proxy *proxy.Proxy
+	// leases grants leases and deletes their keys once they end
+	leases *lease.Manager
+	// readiness gates client requests until SetReady is called
+	readiness *Readiness
+	// draining is set by Stop, once it starts draining watchers
+	draining atomic.Bool
+	// stopCtx is cancelled by Stop, which ends all watches
+	stopCtx    context.Context
+	stopCancel context.CancelFunc
+	// watchGoroutines tracks the goroutines started by Watch and
+	// LeaseKeepAlive, which Stop waits for
+	watchGoroutines sync.WaitGroup
 	// note: sending messages not currently required
 	//wsSendCh     chan []byte
 	pb.UnimplementedKVServer
@@ -46,10 +120,18 @@ type ClientAPIServer struct {
 	pb.UnimplementedClusterServer
 	pb.UnimplementedMaintenanceServer
 	pb.UnimplementedAuthServer
+	proto.UnimplementedAdminServer
 }
 
-func NewServer(logger log.Logger, conf *config.Config, db localdb.Database, grpcServer *grpc.Server, snapshotWorker *snapshot.Worker, s3Client *s3client.S3Client) (*ClientAPIServer, error) {
+// NewServer creates a client API server and registers it with grpcServer.
+// Client requests are not served until SetReady is called, which requires
+// grpcServer to have been created with readiness.ServerOptions. readiness
+// may be nil, in which case only the health service reflects readiness.
+func NewServer(logger log.Logger, conf *config.Config, db localdb.Database, grpcServer *grpc.Server, snapshotWorker *snapshot.Worker, s3Client *s3client.S3Client, memWatchdog *watchdog.Watchdog, readiness *Readiness) (*ClientAPIServer, error) {
 	var err error
+	if readiness == nil {
+		readiness = NewReadiness()
+	}
 
 	// TODO: in future we will replace this with a peer server gRPC client
 	// when the Netsy server is not the leader
@@ -58,6 +140,37 @@ func NewServer(logger log.Logger, conf *config.Config, db localdb.Database, grpc
 		return nil, fmt.Errorf("peerapi.NewServer error: %s", err)
 	}
 
+	compat, err := newEtcdCompat(conf.EtcdVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	clients, err := newClientPolicies(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := transform.New(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	readRules, err := parseReadRules(conf.ReadRules())
+	if err != nil {
+		return nil, fmt.Errorf("invalid read_rules: %w", err)
+	}
+
+	admins, err := newAdminIdentities(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	auditor, auditCloser, err := audit.New(logger, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	stopCtx, stopCancel := context.WithCancel(context.Background())
 	clientServer := &ClientAPIServer{
 		logger:     logger,
 		config:     conf,
@@ -65,8 +178,34 @@ func NewServer(logger log.Logger, conf *config.Config, db localdb.Database, grpc
 		db:         db,
 		// TODO: in future we will replace this with a peer server gRPC client
 		// when the Netsy server is not the leader
-		peerServer: peerServer,
+		peerServer:      peerServer,
+		s3Client:        s3Client,
+		watchCreatePool: newWatchCreatePool(conf.WatchCreateWorkers()),
+		compat:          compat,
+		header:          commonapi.NewResponseHeader(conf),
+		values:          values,
+		admission:       newAdmission(conf.RequestMaxInFlight(), conf.RequestReservedSystem(), conf.RequestSystemKeyPrefixes()),
+		clients:         clients,
+		keyAllowlist:    newKeyAllowlist(conf.WriteKeyAllowedPrefixes()),
+		readRules:       readRules,
+		admins:          admins,
+		rangeCache:      newRangeCache(conf.RangeCacheSizeMB() * 1024 * 1024),
+		namespaces:      newNamespaceWrites(db, conf.MetricsNamespacesMax()),
+		memWatchdog:     memWatchdog,
+		readiness:       readiness,
+		auditCloser:     auditCloser,
+		stopCtx:         stopCtx,
+		stopCancel:      stopCancel,
+	}
+	clientServer.auditor.Store(&auditor)
+
+	// keys of leases which end are deleted through Txn, and leases are
+	// replicated to S3 so that backfill restores them
+	var leaseReplicator lease.Replicator
+	if conf.S3Enabled() && s3Client != nil {
+		leaseReplicator = s3Client
 	}
+	clientServer.leases = lease.NewManager(logger, conf, db, clientServer, leaseReplicator, peerServer)
 
 	pb.RegisterKVServer(grpcServer, clientServer)
 	pb.RegisterWatchServer(grpcServer, clientServer)
@@ -74,15 +213,91 @@ func NewServer(logger log.Logger, conf *config.Config, db localdb.Database, grpc
 	pb.RegisterClusterServer(grpcServer, clientServer)
 	pb.RegisterMaintenanceServer(grpcServer, clientServer)
 	pb.RegisterAuthServer(grpcServer, clientServer)
-	hsrv := health.NewServer()
-	hsrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
-	healthpb.RegisterHealthServer(grpcServer, hsrv)
+	// Admin is served on the client port, restricted to admins
+	proto.RegisterAdminServer(grpcServer, clientServer)
+	healthpb.RegisterHealthServer(grpcServer, readiness.health)
 	reflection.Register(grpcServer)
 
 	return clientServer, nil
 }
 
+// SetReady starts serving client requests, once the database has been
+// backfilled and verified. The health service reports SERVING from then on.
+// In proxy mode, the keys of the upstream etcd are first replicated.
+func (clientServer *ClientAPIServer) SetReady() error {
+	if clientServer.proxy != nil {
+		if err := clientServer.proxy.Start(proxyDistributor{clientServer}); err != nil {
+			return err
+		}
+	}
+	if err := clientServer.peerServer.InitializeRevisionCounter(); err != nil {
+		return fmt.Errorf("failed to initialize revision counter: %w", err)
+	}
+	if err := clientServer.leases.Start(); err != nil {
+		return err
+	}
+	clientServer.readiness.setReady()
+	return nil
+}
+
+// Stop ends all watches and stops serving client requests, waiting for
+// in-flight requests to complete (up to gracefulStopTimeout), for goroutines
+// started by watches to exit, and for background work such as tombstone
+// pruning. Watches are first cancelled, so that clients re-create them on
+// another server (see drainWatchers). Stop is safe to call more than once.
+func (clientServer *ClientAPIServer) Stop() {
+	// stop ending leases first, as keys are deleted using the server
+	clientServer.leases.Stop()
+
+	// watches are long-lived, so end them rather than waiting for clients,
+	// once their clients have been sent the cancellation of each watch
+	clientServer.readiness.setNotServing()
+	clientServer.drainWatchers(time.Duration(clientServer.config.WatchDrainTimeoutMS()) * time.Millisecond)
+	clientServer.stopCancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		clientServer.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(gracefulStopTimeout):
+		// e.g. a send to a client which is not reading is blocked
+		clientServer.grpcServer.Stop()
+		<-stopped
+	}
+
+	// all Watch handlers have returned, so no more goroutines are started
+	clientServer.watchGoroutines.Wait()
+	clientServer.peerServer.Close()
+	clientServer.auditCloser.Close()
+}
+
+// loadAuditor returns the auditor requests are audited with
+func (clientServer *ClientAPIServer) loadAuditor() audit.Auditor {
+	return *clientServer.auditor.Load()
+}
+
+// SetAuditor replaces the configured auditor, e.g. with an integration
+// which also calls it (see audit.Multi). Requests in flight may still be
+// audited with the previous auditor.
+func (clientServer *ClientAPIServer) SetAuditor(auditor audit.Auditor) {
+	clientServer.auditor.Store(&auditor)
+}
+
+// goWatch runs fn on a goroutine which Stop waits for, for streams which
+// are ended by Stop
+func (clientServer *ClientAPIServer) goWatch(fn func()) {
+	clientServer.watchGoroutines.Add(1)
+	go func() {
+		defer clientServer.watchGoroutines.Done()
+		fn()
+	}()
+}
+
+// Close stops the server (see Stop), then closes the database
 func (clientServer *ClientAPIServer) Close() {
-	clientServer.grpcServer.GracefulStop()
+	clientServer.Stop()
 	clientServer.db.Close()
 }
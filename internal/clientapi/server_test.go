@@ -0,0 +1,164 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// newTestServer returns a ready server using grpcServer, with a new local db
+// and S3 disabled. It is closed when the test ends.
+func newTestServer(t *testing.T, grpcServer *grpc.Server) *ClientAPIServer {
+	t.Helper()
+	configtest.Set(t, map[string]any{
+		"s3_enabled":              false,
+		"instance_id":             "test",
+		"admin_client_identities": testAdminIdentity,
+	})
+
+	db := localdb.New(t.TempDir()+"/db.sqlite3", 2)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	cs, err := NewServer(log.NewNopLogger(), &config.Config{}, db, grpcServer, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(cs.Close)
+	if err = cs.SetReady(); err != nil {
+		t.Fatalf("SetReady: %v", err)
+	}
+	return cs
+}
+
+// TestCloseEndsWatches checks that watches end, and that every goroutine
+// started for them exits, both when a client closes its stream and when the
+// server is closed while a stream is still open
+func TestCloseEndsWatches(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	db := localdb.New(t.TempDir()+"/db.sqlite3", 2)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	readiness := NewReadiness()
+	grpcServer := grpc.NewServer(readiness.ServerOptions()...)
+	cs, err := NewServer(log.NewNopLogger(), &config.Config{}, db, grpcServer, nil, nil, nil, readiness)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	if err = cs.SetReady(); err != nil {
+		t.Fatalf("SetReady: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	serveErrCh := make(chan error, 1)
+	go func() {
+		serveErrCh <- grpcServer.Serve(listener)
+	}()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewWatchClient(conn)
+	openWatch := func(ctx context.Context) pb.Watch_WatchClient {
+		t.Helper()
+		stream, err := client.Watch(ctx)
+		if err != nil {
+			t.Fatalf("Watch: %v", err)
+		}
+		err = stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+			CreateRequest: &pb.WatchCreateRequest{Key: []byte("a"), ProgressNotify: true},
+		}})
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		// the first progress notification may be sent before the watch
+		// created response
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("expected watch to be created: %v", err)
+			}
+			if resp.Created {
+				return stream
+			}
+		}
+	}
+
+	// a watch whose client closes the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	openWatch(ctx)
+	cancel()
+
+	// a watch which is still open when the server is closed
+	stream := openWatch(context.Background())
+	cs.Close()
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable once the server is closed, got %v", err)
+	}
+	if err = <-serveErrCh; err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	conn.Close()
+}
+
+// TestValueTransformers checks that values are stored transformed, and are
+// decoded by Range and watches
+func TestValueTransformers(t *testing.T) {
+	configtest.Set(t, map[string]any{"value_transformers": "zstd"})
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := context.Background()
+	key, value := []byte("/registry/secrets/default/a"), []byte("secret")
+	resp, err := cs.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: key, Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: key, Value: value}}}},
+	})
+	if err != nil || !resp.Succeeded {
+		t.Fatalf("put: %v", err)
+	}
+
+	record, err := cs.db.FindRecordByRev(resp.Header.Revision)
+	if err != nil {
+		t.Fatalf("FindRecordByRev: %v", err)
+	}
+	if !bytes.HasPrefix(record.Value, []byte("netsy:zstd:")) {
+		t.Fatalf("expected value to be stored transformed, got %q", record.Value)
+	}
+	rangeResp, err := cs.Range(ctx, &pb.RangeRequest{Key: key})
+	if err != nil || len(rangeResp.Kvs) != 1 || !bytes.Equal(rangeResp.Kvs[0].Value, value) {
+		t.Fatalf("expected Range to decode value, got %v (%v)", rangeResp, err)
+	}
+	event, _, err := newWatchEvents(record, nil, cs.values)
+	if err != nil || !bytes.Equal(event.Kv.Value, value) {
+		t.Fatalf("expected watch event value to be decoded, got %v (%v)", event, err)
+	}
+	// stored values cannot be sorted by their decoded value
+	if _, err = cs.Range(ctx, &pb.RangeRequest{Key: key, SortTarget: pb.RangeRequest_VALUE}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected sorting by value to be unimplemented, got %v", err)
+	}
+}
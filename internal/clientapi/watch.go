@@ -11,17 +11,25 @@ package clientapi
 //                single kube-apiserver watcher.
 
 import (
-	"bytes"
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/lockhold"
+	"github.com/nadrama-com/netsy/internal/metrics"
 	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/transform"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/status"
 )
 
 //
@@ -36,15 +44,39 @@ import (
 // the dispatcher only requires a read lock,
 // everything else requires a write lock.
 type watchers struct {
-	sync.RWMutex
+	lockhold.RWMutex
 	servers map[int64]*watcher
 }
 
 // we track all watchers in a global
 var allWatchers = watchers{
+	RWMutex: lockhold.RWMutex{Name: "all_watchers"},
 	servers: map[int64]*watcher{},
 }
 
+// add adds w to the map of watchers, unless there are already max watchers
+// (if max is positive), returning false if w was not added
+func (ws *watchers) add(w *watcher, max int64) bool {
+	ws.Lock()
+	defer ws.Unlock()
+	if max > 0 && int64(len(ws.servers)) >= max {
+		return false
+	}
+	ws.servers[w.id] = w
+	metrics.WatchersActive.Inc()
+	return true
+}
+
+// remove removes the watcher with watcherID from the map of watchers
+func (ws *watchers) remove(watcherID int64) {
+	ws.Lock()
+	defer ws.Unlock()
+	if _, ok := ws.servers[watcherID]; ok {
+		delete(ws.servers, watcherID)
+		metrics.WatchersActive.Dec()
+	}
+}
+
 // watcherIDCounter is a global counter for watcher IDs
 // atomic.AddInt64 is used to increment it while a lock is held
 var watcherIDCounter int64
@@ -53,18 +85,189 @@ var watcherIDCounter int64
 // where each client may have one or more 'watch(es)' and each 'watch' may have
 // progress notifications enabled.
 // client is a gRPC bidirectional stream
-// inboxCh is used to send WatchResponse messages to the watcher
+// inboxCh is used to send WatchResponse messages to the watcher, and is
+// bounded: if it overflows, the watcher falls behind (see watch_catchup.go)
+// createQueue queues watch create requests (see ProcessCreates)
 // data flow (where brackets represent other components):
 // (kubeapi-server) > client.Recv > Get[Create|Cancel|Progress]Request > (api)
 // (netsy Leader) > inboxCh > client.Send > (kube-apiserver) [> watcher client]
 type watcher struct {
 	id int64
-	sync.RWMutex
+	// identity is the identity of the client (see clients.go)
+	identity string
+	// reads restricts the keys the client may watch (see readrules.go)
+	reads readPolicy
+	lockhold.RWMutex
 	client   pb.Watch_WatchServer // the gRPC stream
+	sendMu   sync.Mutex           // serializes client.Send calls
 	inboxOk  bool
-	inboxCh  chan pb.WatchResponse
+	inboxCh  chan inboxMsg
 	watches  map[int64]watch
 	progress map[int64]bool
+	// nextWatchID is the last watch ID assigned (see newWatchID)
+	nextWatchID int64
+	// nextWatchToken is the token of the last watch added (see watch.token)
+	nextWatchToken uint64
+	compat         *etcdCompat
+	// lagAlarm detects events delivered too long after they were committed,
+	// may be nil
+	lagAlarm *watchLagAlarm
+	// queueMu serializes queueing responses on inboxCh (see tryQueue), and
+	// guards behind, caughtUp and roomCh. inboxOk is only changed with both
+	// the watcher lock and queueMu held.
+	queueMu sync.Mutex
+	// roomCh is closed once a response is taken from inboxCh, to wake
+	// producers waiting for room (see waitQueue), or nil if none are
+	roomCh chan struct{}
+	// behind is the revision from which events were not queued because
+	// inboxCh overflowed, or 0 if the watcher is not behind
+	behind int64
+	// caughtUp is the revision up to which events were queued by catchUp
+	caughtUp int64
+	// catchUpCh signals catchUp once the watcher falls behind
+	catchUpCh chan struct{}
+	// createMu guards createQueue and createPending (see EnqueueCreate)
+	createMu sync.Mutex
+	// createQueue holds watch create requests and rejections, in the order
+	// they were received, until they are answered by ProcessCreates
+	createQueue []watchCreate
+	// createPending is the number of queued requests which are not
+	// rejected, up to createQueueSize
+	createPending   int64
+	createQueueSize int64
+	// createCh signals ProcessCreates once a request is queued
+	createCh chan struct{}
+	// replayCh queues watches whose past events are to be replayed (see
+	// watch_replay.go)
+	replayCh chan watchReplay
+	// header is the template for response headers
+	header commonapi.ResponseHeader
+	// maxWatches is the maximum number of watches, or 0 if unlimited
+	maxWatches int64
+	// rejectReason is set if the watcher was not added to allWatchers as
+	// the watcher limit was reached, in which case all of its watch create
+	// requests are rejected with this reason
+	rejectReason string
+	// draining is set once the server starts draining watchers (see
+	// watch_drain.go), may be nil
+	draining *atomic.Bool
+}
+
+// inboxMsg is a response queued for sending to a watcher, with the time
+// its event was committed (zero for responses without events)
+type inboxMsg struct {
+	pb.WatchResponse
+	committedAt time.Time
+	// sent is closed once the response is sent or discarded, may be nil
+	sent chan struct{}
+}
+
+// send sends a message to the client. gRPC streams do not support concurrent
+// calls to Send, so all sends to the client must go through this method.
+func (w *watcher) send(msg *pb.WatchResponse) error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+	return w.client.Send(msg)
+}
+
+// runInbox sends messages on the inbox channel to the client, until the
+// inbox channel is closed by Cleanup. If a send fails or panics, cancel is
+// called with the error so that Watch returns and cleans up the watcher, and
+// the inbox channel is drained until it is closed, so that producers waiting
+// for room (see waitQueue) are not blocked until Cleanup.
+func (w *watcher) runInbox(cancel context.CancelCauseFunc) {
+	defer func() {
+		for msg := range w.inboxCh {
+			w.dequeued()
+			msg.markSent()
+		}
+	}()
+	if err := w.sendInbox(); err != nil {
+		fmt.Printf("Watch() send error: %v\n", err)
+		cancel(err)
+	}
+}
+
+// sendInbox sends messages on the inbox channel to the client until the
+// channel is closed, returning an error if a send fails or panics
+func (w *watcher) sendInbox() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			metrics.WatchSendFailures.WithLabelValues("panic").Inc()
+			err = fmt.Errorf("panic sending watch response: %v\n%s", r, debug.Stack())
+		}
+	}()
+	for msg := range w.inboxCh {
+		w.dequeued()
+		// note that because this should be the only goroutine sending
+		// messages to the client, we don't need to lock the watcher
+		sendStart := time.Now()
+		err = w.send(&msg.WatchResponse)
+		msg.markSent()
+		if err != nil {
+			metrics.WatchSendFailures.WithLabelValues("error").Inc()
+			return fmt.Errorf("failed to send watch response: %w", err)
+		}
+		metrics.ClientWatchSendDuration.WithLabelValues(w.identity).Observe(time.Since(sendStart).Seconds())
+		if len(msg.Events) > 0 {
+			metrics.ClientWatchEventsSent.WithLabelValues(w.identity).Add(float64(len(msg.Events)))
+		}
+		if msg.committedAt.IsZero() {
+			continue
+		}
+		now := time.Now()
+		lag := now.Sub(msg.committedAt)
+		metrics.WatchDeliveryLag.Observe(lag.Seconds())
+		if w.lagAlarm != nil {
+			if err = w.lagAlarm.observe(lag, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// markSent closes the sent channel of msg, if any
+func (msg *inboxMsg) markSent() {
+	if msg.sent != nil {
+		close(msg.sent)
+	}
+}
+
+// prefixWatches counts the active watches of each key prefix, so that the
+// WatchesActive series of a prefix is deleted once it has no watches, rather
+// than reported as 0 until the process exits
+type prefixWatches struct {
+	sync.Mutex
+	watches map[string]int
+}
+
+// we track the watches of all watchers in a global, as with allWatchers
+var allPrefixWatches = prefixWatches{watches: map[string]int{}}
+
+// add adds delta to the number of active watches of prefix
+func (p *prefixWatches) add(prefix string, delta int) {
+	p.Lock()
+	defer p.Unlock()
+	p.watches[prefix] += delta
+	if p.watches[prefix] > 0 {
+		metrics.WatchesActive.WithLabelValues(prefix).Set(float64(p.watches[prefix]))
+		return
+	}
+	delete(p.watches, prefix)
+	metrics.WatchesActive.DeleteLabelValues(prefix)
+}
+
+// watchAdded counts watch as active, by key prefix and client
+func (w *watcher) watchAdded(watch watch) {
+	allPrefixWatches.add(watch.prefix, 1)
+	metrics.ClientWatchesActive.WithLabelValues(w.identity).Inc()
+}
+
+// watchRemoved counts watch as no longer active
+func (w *watcher) watchRemoved(watch watch) {
+	allPrefixWatches.add(watch.prefix, -1)
+	metrics.ClientWatchesActive.WithLabelValues(w.identity).Dec()
 }
 
 // Cleanup is used to cleanup a watcher
@@ -77,13 +280,19 @@ func (w *watcher) Cleanup(watcherID int64) {
 	w.Lock()
 	defer w.Unlock()
 
-	// close the watcher inbox channel
+	// close the watcher inbox channel. responses are only queued with
+	// queueMu held (see tryQueue), so none are being sent on it, and
+	// producers waiting for room are woken.
+	w.queueMu.Lock()
 	w.inboxOk = false
 	close(w.inboxCh)
+	w.wakeQueue()
+	w.queueMu.Unlock()
 
 	// remove all watchIDs from watcher (in case Cancel was not processed)
 	for watchID, watch := range w.watches {
 		watch.cancel()
+		w.watchRemoved(watch)
 		delete(w.watches, watchID)
 	}
 	for watchID := range w.progress {
@@ -91,10 +300,7 @@ func (w *watcher) Cleanup(watcherID int64) {
 	}
 
 	// remove watcherID from all watchers map
-	// obtain write lock, remove, then release lock immediately
-	allWatchers.Lock()
-	delete(allWatchers.servers, watcherID)
-	allWatchers.Unlock()
+	allWatchers.remove(watcherID)
 }
 
 //
@@ -111,41 +317,83 @@ type watch struct {
 	progressNotify  bool
 	filtersNoPut    bool
 	filtersNoDelete bool
-	cancel          func()
+	// replaying is set while the watch's past events are replayed from the
+	// local db, during which it is not sent live events or progress
+	replaying bool
+	// token identifies the watch among all of the watcher's watches, as
+	// watch IDs may be reused once a watch is cancelled, so that a replay
+	// never queues events for a later watch with the same ID
+	token  uint64
+	cancel func()
+	// prefix is the metric label of key (see keys.Label)
+	prefix string
 }
 
-// watchIDCounter is a global counter for watch IDs
-// we do this because we do not support client-supplied watch IDs
-// atomic.AddInt64 is used to increment it while a lock is held
-var watchIDCounter int64
+// errWatchDuplicateID is the cancel reason of watch create requests whose
+// client-supplied watch ID is already in use, as returned by etcd
+var errWatchDuplicateID = errors.New("mvcc: duplicate watch ID provided on the WatchStream")
+
+// newWatchID returns requested if it is a client-supplied watch ID, unless it
+// is already in use by one of the watcher's watches. Otherwise it assigns the
+// next watch ID not in use. Watch IDs are only unique per watcher, as in
+// etcd. Watches are only created by ProcessCreates, so a watch ID which is
+// not in use cannot be taken before the watch is added. The write lock is
+// held as nextWatchID is updated.
+func (w *watcher) newWatchID(requested int64) (watchID int64, err error) {
+	w.Lock()
+	defer w.Unlock()
+	if requested != clientv3.AutoWatchID {
+		if _, ok := w.watches[requested]; ok {
+			return 0, errWatchDuplicateID
+		}
+		return requested, nil
+	}
+	for {
+		w.nextWatchID++
+		if _, ok := w.watches[w.nextWatchID]; !ok {
+			return w.nextWatchID, nil
+		}
+	}
+}
 
 // CreateWatch handles watch create requests
-func (w *watcher) CreateWatch(r *pb.WatchCreateRequest, latestRevision int64, getRevision func(findRevision int64) (revision int64, compacted bool, compactedAt sql.NullString, err error)) {
+// check is the result of validating the request start revision, which is
+// performed for a batch of requests by ProcessCreates.
+// If the start revision is at or before the latest revision, the watch is
+// created replaying, and the replay of its past events is returned.
+func (w *watcher) CreateWatch(r *pb.WatchCreateRequest, latestRevision int64, check revisionCheck) (replay *watchReplay) {
 	fmt.Printf("CreateWatch(%d)\n", w.id)
 
-	respHeader := &pb.ResponseHeader{
-		Revision: latestRevision,
-	}
-
-	// do not support user-provided watch IDs
-	if r.WatchId != clientv3.AutoWatchID {
-		fmt.Printf("user-provided watch IDs ('%d') are unsupported", r.WatchId)
-		_ = w.client.Send(&pb.WatchResponse{
-			Header:  respHeader,
-			Created: true,
-			WatchId: r.WatchId,
-		})
-		_ = w.client.Send(&pb.WatchResponse{
-			Header:       respHeader,
-			Canceled:     true,
-			CancelReason: "user-provided watch IDs are unsupported",
-			WatchId:      r.WatchId,
-		})
+	respHeader := w.header.At(latestRevision)
+
+	// reject watches beyond the limit. watches are only created by
+	// ProcessCreates, so the number of watches cannot increase before this
+	// watch is added.
+	w.RLock()
+	watches := int64(len(w.watches))
+	w.RUnlock()
+	if w.maxWatches > 0 && watches >= w.maxWatches {
+		metrics.WatchCreateRejected.WithLabelValues("watch_limit").Inc()
+		w.rejectCreate(latestRevision, fmt.Sprintf("too many watches on this watch stream (limit %d)", w.maxWatches))
+		return
+	}
+
+	// reject watches including keys the client may not read
+	if err := w.reads.checkRange(r.Key, r.RangeEnd); err != nil {
+		metrics.WatchCreateRejected.WithLabelValues("denied").Inc()
+		w.rejectCreate(latestRevision, status.Convert(err).Message())
 		return
 	}
 
-	// create a globally-unique watch ID
-	watchID := atomic.AddInt64(&watchIDCounter, 1)
+	// use the client-supplied watch ID, or assign one. As in etcd, a
+	// duplicate watch ID is acknowledged and cancelled in one response,
+	// without a watch ID.
+	watchID, err := w.newWatchID(r.WatchId)
+	if err != nil {
+		metrics.WatchCreateRejected.WithLabelValues("duplicate_id").Inc()
+		w.rejectCreate(latestRevision, err.Error())
+		return
+	}
 
 	// get cancel function associated with watch server
 	_, cancelFunc := context.WithCancel(w.client.Context())
@@ -154,19 +402,18 @@ func (w *watcher) CreateWatch(r *pb.WatchCreateRequest, latestRevision int64, ge
 	// if it is set to zero, use latest revision and do not return error
 	var revision int64
 	var compacted bool
-	var err error
 	if r.StartRevision == 0 {
 		revision = latestRevision
 	} else {
-		revision, compacted, _, err = getRevision(r.StartRevision)
+		revision, compacted, err = check.revision, check.compacted, check.err
 	}
 	respHeader.Revision = revision
 	if err != nil || compacted {
 		var cancelReason string
 		var compactRevision int64
 		if compacted {
-			compactRevision = r.StartRevision
-			cancelReason = fmt.Sprintf("revision '%d' has been compacted", r.StartRevision)
+			compactRevision = check.compactRevision
+			cancelReason = w.compat.compactedReason
 		} else if r.StartRevision <= latestRevision {
 			respHeader.Revision = r.StartRevision
 			cancelReason = fmt.Sprintf("failed to get revision '%d' for CreateWatch: %v", r.StartRevision, err)
@@ -176,12 +423,12 @@ func (w *watcher) CreateWatch(r *pb.WatchCreateRequest, latestRevision int64, ge
 		}
 		if cancelReason != "" {
 			fmt.Printf("CreateWatch() failed: %s\n", cancelReason)
-			w.client.Send(&pb.WatchResponse{
+			w.send(&pb.WatchResponse{
 				Header:  respHeader,
 				Created: true,
 				WatchId: watchID,
 			})
-			w.client.Send(&pb.WatchResponse{
+			w.send(&pb.WatchResponse{
 				Header:          respHeader,
 				Canceled:        true,
 				CancelReason:    cancelReason,
@@ -194,13 +441,22 @@ func (w *watcher) CreateWatch(r *pb.WatchCreateRequest, latestRevision int64, ge
 	}
 
 	// prep watch
+	// a start revision of zero watches for events after the latest
+	// revision, which is set explicitly so that a watcher which is
+	// catching up (see catchUp) does not send the watch earlier events
+	startRevision := r.StartRevision
+	if startRevision == 0 {
+		startRevision = latestRevision + 1
+	}
 	watchData := watch{
 		key:            r.Key,
 		rangeEnd:       r.RangeEnd,
-		startRevision:  r.StartRevision,
+		startRevision:  startRevision,
 		prevKv:         r.PrevKv,
 		progressNotify: r.ProgressNotify,
+		replaying:      startRevision <= latestRevision,
 		cancel:         cancelFunc,
+		prefix:         keys.Label(r.Key),
 	}
 	for _, filterType := range r.Filters {
 		switch filterType {
@@ -212,22 +468,38 @@ func (w *watcher) CreateWatch(r *pb.WatchCreateRequest, latestRevision int64, ge
 	}
 
 	// add watchID to to the watcher
-	// obtain write lock, add, then release lock immediately
+	// obtain write lock, add, then release lock immediately. once the
+	// server is draining, the watcher's watches have been cancelled, so the
+	// watch is rejected instead.
 	w.Lock()
+	if w.isDraining() {
+		w.Unlock()
+		cancelFunc()
+		metrics.WatchCreateRejected.WithLabelValues("draining").Inc()
+		w.rejectCreate(latestRevision, errWatchDraining.Error())
+		return nil
+	}
+	w.nextWatchToken++
+	watchData.token = w.nextWatchToken
 	w.watches[watchID] = watchData
 	w.progress[watchID] = r.ProgressNotify
+	w.watchAdded(watchData)
 	w.Unlock()
 
 	// acknowledge the watch create request to the client
-	if err := w.client.Send(&pb.WatchResponse{
+	if err := w.send(&pb.WatchResponse{
 		Header:  respHeader,
 		Created: true,
 		WatchId: watchID,
 	}); err != nil {
 		// cancel watch if unable to send ack
 		w.CancelWatch(watchID, revision, err)
-		return
+		return nil
 	}
+	if watchData.replaying {
+		return &watchReplay{watchID: watchID, token: watchData.token, from: startRevision}
+	}
+	return nil
 }
 
 // CancelWatch handles watch cancel requests for a watch server instance.
@@ -241,23 +513,29 @@ func (w *watcher) CancelWatch(watchID int64, revision int64, reason error) {
 	// remove watchID from watcher
 	// obtain write lock, cancel, delete, then release lock immediately
 	w.Lock()
-	if watch, ok := w.watches[watchID]; ok {
+	watch, ok := w.watches[watchID]
+	if ok {
 		watch.cancel()
+		w.watchRemoved(watch)
+		delete(w.watches, watchID)
+		delete(w.progress, watchID)
 	}
-	delete(w.watches, watchID)
-	delete(w.progress, watchID)
 	w.Unlock()
 
+	// as in etcd, cancelling a watch which does not exist (e.g. as it was
+	// already cancelled) is not acknowledged
+	if !ok {
+		return
+	}
+
 	// ack cancellation with client
 	reasonMsg := ""
 	if reason != nil {
 		reasonMsg = reason.Error()
 	}
-	err := w.client.Send(&pb.WatchResponse{
-		Header: &pb.ResponseHeader{
-			Revision: revision,
-		},
-		Canceled:     reason != nil,
+	err := w.send(&pb.WatchResponse{
+		Header:       w.header.At(revision),
+		Canceled:     true,
 		CancelReason: reasonMsg,
 		WatchId:      watchID,
 	})
@@ -275,9 +553,10 @@ func (w *watcher) CancelWatch(watchID int64, revision int64, reason error) {
 // notifications enabled. It then writes one message for each watch to the
 // dispatch channel for the main watcher goroutine to handle sending back
 // to the watcher client. If all watches have progress notifications enabled,
-// instead of sending multiple messages, it sends a broadcast message.
+// instead of sending multiple messages, it sends a broadcast message, if
+// allowBroadcast is true.
 // Note that this function is also used for on-demand progress requests.
-func (w *watcher) ReportProgressOnInterval(DbLatestRevision func() (int64, error)) func(ctx context.Context) (bool, error) {
+func (w *watcher) ReportProgressOnInterval(DbLatestRevision func() (int64, error), allowBroadcast bool) func(ctx context.Context) (bool, error) {
 	return func(ctx context.Context) (bool, error) {
 		// get latest revision from local db
 		revision, err := DbLatestRevision()
@@ -289,7 +568,7 @@ func (w *watcher) ReportProgressOnInterval(DbLatestRevision func() (int64, error
 
 		// create array of watchIDs to send to
 		progressWatchIDs := make([]int64, 0)
-		broadcast := true
+		broadcast := allowBroadcast
 
 		// get a read lock on the watcher to ensure inbox channel is not closed
 		// release at the end of the function
@@ -306,6 +585,11 @@ func (w *watcher) ReportProgressOnInterval(DbLatestRevision func() (int64, error
 		// disabled.
 		// obtain read lock, iterate on progress map, then release lock immediately
 		for watchID, progressNotify := range w.progress {
+			// replaying watches have not been sent events up to revision
+			if w.watches[watchID].replaying {
+				broadcast = false
+				continue
+			}
 			if progressNotify {
 				progressWatchIDs = append(progressWatchIDs, watchID)
 			} else {
@@ -313,26 +597,24 @@ func (w *watcher) ReportProgressOnInterval(DbLatestRevision func() (int64, error
 			}
 		}
 
+		var msgs []inboxMsg
 		if broadcast {
 			// send a single watch response to the dispatch channel
-			w.inboxCh <- pb.WatchResponse{
-				Header: &pb.ResponseHeader{
-					Revision: revision,
-				},
+			msgs = append(msgs, inboxMsg{WatchResponse: pb.WatchResponse{
+				Header: w.header.At(revision),
 				// using an invalid watch ID makes it a broadcast
 				WatchId: clientv3.InvalidWatchID,
-			}
+			}})
 		} else {
 			// send a watch response for each watch ID to the dispatch channel
 			for _, watchID := range progressWatchIDs {
-				w.inboxCh <- pb.WatchResponse{
-					Header: &pb.ResponseHeader{
-						Revision: revision,
-					},
+				msgs = append(msgs, inboxMsg{WatchResponse: pb.WatchResponse{
+					Header:  w.header.At(revision),
 					WatchId: watchID,
-				}
+				}})
 			}
 		}
+		w.queueProgress(msgs)
 
 		// always return condition=false, err=nil
 		return false, nil
@@ -348,68 +630,167 @@ func (cs *ClientAPIServer) Distribute(record *proto.Record, prevRecord *proto.Re
 		return
 	}
 
-	eventType := mvccpb.PUT
-	if record.Deleted {
-		eventType = mvccpb.DELETE
+	committedAt := recordCommittedAt(record)
+	// look up the previous record if the caller did not supply it, as
+	// watches requesting previous key-values are otherwise sent events
+	// without them
+	if prevRecord == nil && allWatchers.wantPrevKv(record) {
+		prevRecord = cs.findPrevRecord(record)
 	}
-
-	// note: WatchId is set in the watches loop (below), this is a msg template
-	msg := pb.WatchResponse{
-		Header: &pb.ResponseHeader{
-			Revision: record.Revision,
-		},
-		Events: []*mvccpb.Event{
-			{
-				Type: eventType,
-				Kv: &mvccpb.KeyValue{
-					Key:            record.Key,
-					CreateRevision: record.CreateRevision,
-					ModRevision:    record.Revision,
-					Version:        record.Version,
-					Value:          record.Value,
-					Lease:          record.Lease,
-				},
-			},
-		},
-	}
-
-	// note: this value will not be set if prevRecord has already
-	// been compacted. we also do not set on the msg struct
-	// directly as not all watches will request prev_kv=true.
-	var msgPrevKv *mvccpb.KeyValue
-	if prevRecord != nil {
-		msgPrevKv = &mvccpb.KeyValue{
-			Key:            prevRecord.Key,
-			CreateRevision: prevRecord.CreateRevision,
-			ModRevision:    prevRecord.Revision,
-			Version:        prevRecord.Version,
-			Value:          prevRecord.Value,
-			Lease:          prevRecord.Lease,
-		}
+	event, eventWithPrevKv, err := newWatchEvents(record, prevRecord, cs.values)
+	if err != nil {
+		level.Error(cs.logger).Log("msg", "failed to decode value, not sending event to watchers", "revision", record.Revision, "error", err)
+		return
 	}
 
 	// obtain read lock on allWatchers
 	allWatchers.RLock()
 	defer allWatchers.RUnlock()
+	defer lockhold.Observe(allWatchers.Name, lockhold.Read, time.Now())
 
 	// loop over all watchers
 	for _, w := range allWatchers.servers {
 		// obtain lock for all watcher watches
 		w.RLock()
 		defer w.RUnlock()
-		// send to all watches that should receive the record
-		for watchID, watch := range w.watches {
-			if isWatchMatch(watch, record) {
-				msg.WatchId = watchID
-				if watch.prevKv {
-					msg.Events[0].PrevKv = msgPrevKv
-				} else {
-					msg.Events[0].PrevKv = nil
-				}
-				w.inboxCh <- msg
+		defer lockhold.Observe(w.Name, lockhold.Read, time.Now())
+		// queue for all watches that should receive the record
+		if msgs := w.responses(record, event, eventWithPrevKv, committedAt); len(msgs) > 0 {
+			w.queue(record.Revision, msgs)
+		}
+	}
+}
+
+// wantPrevKv returns true if any watch which should receive record requested
+// previous key-values
+func (ws *watchers) wantPrevKv(record *proto.Record) bool {
+	if record.Created || record.PrevRevision <= 0 {
+		return false
+	}
+	ws.RLock()
+	defer ws.RUnlock()
+	for _, w := range ws.servers {
+		w.RLock()
+		for _, watch := range w.watches {
+			if watch.prevKv && !watch.replaying && isWatchMatch(watch, record) {
+				w.RUnlock()
+				return true
 			}
 		}
+		w.RUnlock()
+	}
+	return false
+}
+
+// findPrevRecord returns the previous record of record's key from the local
+// db, or nil if record created its key, or if the previous record cannot be
+// read or has been compacted, as its value is no longer stored. The
+// previous key-value is then omitted from events, rather than sent without
+// its value.
+func (cs *ClientAPIServer) findPrevRecord(record *proto.Record) *proto.Record {
+	if record.Created || record.PrevRevision <= 0 {
+		return nil
+	}
+	prevRecord, err := cs.db.FindRecordByRev(record.PrevRevision)
+	if err != nil {
+		level.Debug(cs.logger).Log("findprev", keys.Key(record.Key), "rev", record.Revision, "prev", record.PrevRevision, "err", err.Error())
+		return nil
+	}
+	if prevRecord.CompactedAt != nil {
+		return nil
+	}
+	return prevRecord
+}
+
+// recordCommittedAt returns when record was committed, which is when it was
+// created in the local database, as events are delivered after that
+func recordCommittedAt(record *proto.Record) time.Time {
+	if record.CreatedAt != nil {
+		return record.CreatedAt.AsTime()
+	}
+	return time.Now()
+}
+
+// newWatchEvents returns the watch event for record, without and with the
+// previous key-value. Note that prevRecord will be nil if it has already been
+// compacted, in which case the previous key-value is not set.
+// As in etcd, the key-value of a DELETE event only has the key and the
+// revision at which it was deleted, e.g. when its lease ended, and the
+// deleted value is only sent as the previous key-value. Values are decoded
+// by values.
+func newWatchEvents(record *proto.Record, prevRecord *proto.Record, values transform.Chain) (event *mvccpb.Event, eventWithPrevKv *mvccpb.Event, err error) {
+	if record.Deleted {
+		event = &mvccpb.Event{
+			Type: mvccpb.DELETE,
+			Kv: &mvccpb.KeyValue{
+				Key:         record.Key,
+				ModRevision: record.Revision,
+			},
+		}
+	} else {
+		value, err := values.Decode(record.Key, record.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		event = &mvccpb.Event{
+			Type: mvccpb.PUT,
+			Kv: &mvccpb.KeyValue{
+				Key:            record.Key,
+				CreateRevision: record.CreateRevision,
+				ModRevision:    record.Revision,
+				Version:        record.Version,
+				Value:          value,
+				Lease:          record.Lease,
+			},
+		}
+	}
+	eventWithPrevKv = &mvccpb.Event{Type: event.Type, Kv: event.Kv}
+	if prevRecord != nil {
+		prevValue, err := values.Decode(prevRecord.Key, prevRecord.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		eventWithPrevKv.PrevKv = &mvccpb.KeyValue{
+			Key:            prevRecord.Key,
+			CreateRevision: prevRecord.CreateRevision,
+			ModRevision:    prevRecord.Revision,
+			Version:        prevRecord.Version,
+			Value:          prevValue,
+			Lease:          prevRecord.Lease,
+		}
+	}
+	return event, eventWithPrevKv, nil
+}
+
+// responses returns a response for each of the watcher's watches which
+// should receive record, except watches which are replaying, as they are
+// sent record once replayed. The watcher must be read locked.
+func (w *watcher) responses(record *proto.Record, event *mvccpb.Event, eventWithPrevKv *mvccpb.Event, committedAt time.Time) (msgs []inboxMsg) {
+	for watchID, watch := range w.watches {
+		if watch.replaying || !isWatchMatch(watch, record) {
+			continue
+		}
+		msgs = append(msgs, w.response(watchID, watch, record, event, eventWithPrevKv, committedAt))
 	}
+	return msgs
+}
+
+// response returns the response sending event (or eventWithPrevKv, if the
+// watch requested previous key-values) for record to a watch
+func (w *watcher) response(watchID int64, watch watch, record *proto.Record, event *mvccpb.Event, eventWithPrevKv *mvccpb.Event, committedAt time.Time) inboxMsg {
+	msg := inboxMsg{
+		WatchResponse: pb.WatchResponse{
+			Header:  w.header.At(record.Revision),
+			WatchId: watchID,
+			Events:  []*mvccpb.Event{event},
+		},
+		committedAt: committedAt,
+	}
+	if watch.prevKv {
+		msg.Events[0] = eventWithPrevKv
+	}
+	msg.Events[0] = w.reads.redactEvent(msg.Events[0])
+	return msg
 }
 
 // isWatchMatch checks if a watch should be sent a record based on its filters properties
@@ -430,61 +811,10 @@ func isWatchMatch(w watch, record *proto.Record) bool {
 	}
 
 	// match if key is 'in range'
-	if isInRange(record.Key, w.key, w.rangeEnd) {
+	if commonapi.KeyInRange(record.Key, w.key, w.rangeEnd) {
 		return true
 	}
 
 	// default to false
 	return false
 }
-
-// isInRange checks if a key is in the range e.g. of a watch
-func isInRange(key []byte, rangeKey []byte, rangeEnd []byte) bool {
-	// determine case (similar to etcdapi_kv_range.go Range)
-	zeroByte := []byte{0}
-	rangeKeyAndZeroByte := append(rangeKey, byte(0))
-	var rangeEndPrefixValue []byte
-	if len(key) > 0 {
-		rangeKeyCopy := make([]byte, len(rangeKey))
-		copy(rangeKeyCopy, rangeKey)
-		rangeEndPrefixValue = append(
-			rangeKeyCopy[:len(rangeKeyCopy)-1],
-			rangeKeyCopy[len(rangeKeyCopy)-1]+1,
-		)
-	}
-	if len(rangeEnd) == 0 || bytes.Equal(rangeEnd, rangeKeyAndZeroByte) {
-		// check for exact match
-		if bytes.Equal(key, bytes.TrimRight(rangeKey, "\x00")) {
-			return true
-		}
-	} else if bytes.Equal(rangeKey, zeroByte) && bytes.Equal(rangeEnd, zeroByte) {
-		// both keys are zero bytes, true for all keys
-		return true
-	} else if bytes.Equal(rangeEnd, zeroByte) {
-		// rangeEnd is zero bytes, true for all keys greater than or equal to
-		// range key
-		// key_blob >= r.Key
-		if bytes.Compare(key, rangeKey) >= 0 {
-			// key=abc, rangeKey=abd, compare=-1 ("key less than rangeKey")
-			// key=abc, rangeKey=abc, compare=0 ("key equal to rangeKey")
-			// key=abc, rangeKey=abb, compare=1 ("key greater than rangeKey")
-			return true
-		}
-	} else if rangeEndPrefixValue != nil && bytes.Equal(rangeEnd, rangeEndPrefixValue) {
-		// check if key matches prefix, where rangeKey is the prefix
-		if bytes.HasPrefix(key, rangeKey) {
-			return true
-		}
-	} else {
-		// range; check if key is greater than or equal to rangeKey, and less than rangeEnd
-		// key_blob >= r.Key
-		// AND key_blob < r.RangeEnd
-		if bytes.Compare(key, rangeKey) >= 0 && bytes.Compare(key, rangeEnd) < 0 {
-			// key=abc, rangeKey=abd, compare=-1 ("key less than rangeKey")
-			// key=abc, rangeKey=abc, compare=0 ("key equal to rangeKey")
-			// key=abc, rangeKey=abb, compare=1 ("key greater than rangeKey")
-			return true
-		}
-	}
-	return false
-}
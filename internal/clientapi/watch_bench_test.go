@@ -0,0 +1,172 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+// watch scale benchmark parameters, e.g. to profile the dispatcher:
+// go test ./internal/clientapi -run '^$' -bench DistributeScale -benchtime 50000x -cpuprofile cpu.out
+var (
+	benchWatchers  = flag.Int("watch.watchers", 1000, "number of watchers (clients) for BenchmarkDistributeScale")
+	benchWatches   = flag.Int("watch.watches", 10000, "number of watches, spread across watchers, for BenchmarkDistributeScale")
+	benchWriteRate = flag.Int("watch.rate", 5000, "writes per second driven through Distribute by BenchmarkDistributeScale (0 = unlimited)")
+	benchInboxSize = flag.Int("watch.inbox", 1024, "watcher inbox size for BenchmarkDistributeScale")
+)
+
+// writes are spread across resources in namespaces, each with its own prefix
+const (
+	benchNamespaces  = 100
+	benchResources   = 10
+	benchPrefixCount = benchNamespaces * benchResources
+)
+
+// benchPrefix returns the key prefix of a namespaced resource, e.g.
+// /registry/res-1/ns-2/
+func benchPrefix(n int) string {
+	return fmt.Sprintf("/registry/res-%d/ns-%d/", n%benchResources, n/benchResources)
+}
+
+// benchWatcher is a registered watcher which drains its inbox, recording the
+// delivery latency of each event
+type benchWatcher struct {
+	w         *watcher
+	latencies []time.Duration
+	done      chan struct{}
+}
+
+// newBenchWatchers registers watchers with watches spread evenly across the
+// namespaced resource prefixes, so each write matches watches/prefixes
+// watches, and starts a goroutine draining each watcher's inbox.
+// sentAt is indexed by revision and holds the time the write was distributed.
+func newBenchWatchers(b *testing.B, sentAt []atomic.Int64) []*benchWatcher {
+	b.Helper()
+	bws := make([]*benchWatcher, *benchWatchers)
+	for i := range bws {
+		bws[i] = &benchWatcher{
+			w: &watcher{
+				id:      -int64(i) - 1,
+				inboxOk: true,
+				inboxCh: make(chan inboxMsg, *benchInboxSize),
+				watches: map[int64]watch{},
+			},
+			done: make(chan struct{}),
+		}
+	}
+	for i := 0; i < *benchWatches; i++ {
+		prefix := benchPrefix(i % benchPrefixCount)
+		rangeEnd := []byte(prefix)
+		rangeEnd[len(rangeEnd)-1]++
+		bw := bws[i%len(bws)]
+		bw.w.watches[int64(i)] = watch{key: []byte(prefix), rangeEnd: rangeEnd, cancel: func() {}}
+	}
+
+	allWatchers.Lock()
+	for _, bw := range bws {
+		allWatchers.servers[bw.w.id] = bw.w
+	}
+	allWatchers.Unlock()
+	b.Cleanup(func() {
+		allWatchers.Lock()
+		for _, bw := range bws {
+			delete(allWatchers.servers, bw.w.id)
+		}
+		allWatchers.Unlock()
+	})
+
+	for _, bw := range bws {
+		go func() {
+			defer close(bw.done)
+			for msg := range bw.w.inboxCh {
+				sent := sentAt[msg.Header.Revision].Load()
+				bw.latencies = append(bw.latencies, time.Duration(time.Now().UnixNano()-sent))
+			}
+		}()
+	}
+	return bws
+}
+
+// cpuTime returns the user and system CPU time used by the process
+func cpuTime(b *testing.B) time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		b.Fatalf("Getrusage: %v", err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// BenchmarkDistributeScale drives writes through Distribute at a fixed rate
+// to many watchers, reporting the CPU time used per write and per delivered
+// event, and the p99 latency from distributing a write to its delivery
+func BenchmarkDistributeScale(b *testing.B) {
+	cs := &ClientAPIServer{logger: log.NewNopLogger()}
+	sentAt := make([]atomic.Int64, b.N+1)
+	bws := newBenchWatchers(b, sentAt)
+
+	// writes are generated upfront with a fixed seed, so runs are comparable
+	random := rand.New(rand.NewSource(1))
+	records := make([]*proto.Record, b.N)
+	for i := range records {
+		key := fmt.Sprintf("%sobj-%d", benchPrefix(random.Intn(benchPrefixCount)), random.Intn(1000))
+		records[i] = &proto.Record{Revision: int64(i + 1), Key: []byte(key), Value: make([]byte, 512)}
+	}
+
+	var interval time.Duration
+	if *benchWriteRate > 0 {
+		interval = time.Second / time.Duration(*benchWriteRate)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	cpuStart := cpuTime(b)
+	start := time.Now()
+	for i, record := range records {
+		// pace writes, sleeping until each write is due
+		if interval > 0 {
+			if wait := time.Until(start.Add(time.Duration(i) * interval)); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		sentAt[record.Revision].Store(time.Now().UnixNano())
+		cs.Distribute(record, nil)
+	}
+
+	// Distribute has queued every event once it returns, so closing the
+	// inboxes lets the watchers drain them and finish. Watchers whose inbox
+	// overflowed are behind and are not caught up, as there is no db, which
+	// shows as fewer events/op.
+	for _, bw := range bws {
+		close(bw.w.inboxCh)
+	}
+	for _, bw := range bws {
+		<-bw.done
+	}
+	b.StopTimer()
+	cpu := cpuTime(b) - cpuStart
+
+	var latencies []time.Duration
+	for _, bw := range bws {
+		latencies = append(latencies, bw.latencies...)
+	}
+	if len(latencies) == 0 {
+		b.Fatal("no events were delivered")
+	}
+	slices.Sort(latencies)
+	p99 := latencies[(len(latencies)*99)/100]
+
+	b.ReportMetric(float64(len(latencies))/float64(b.N), "events/op")
+	b.ReportMetric(float64(cpu.Nanoseconds())/float64(b.N), "cpu-ns/op")
+	b.ReportMetric(float64(cpu.Nanoseconds())/float64(len(latencies)), "cpu-ns/event")
+	b.ReportMetric(float64(p99.Microseconds()), "p99-latency-us")
+}
@@ -0,0 +1,312 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// A watcher's responses are queued on its inbox channel, which is bounded
+// so that a slow client cannot block Distribute (and so every other
+// watcher). If an event does not fit, the watcher falls behind: its watches
+// are kept, but Distribute stops queueing events for it, and catchUp instead
+// reads events from the local db from the revision it fell behind at, in
+// order, once there is room in the inbox. Once catchUp reaches the latest
+// revision, Distribute resumes queueing events for the watcher. This keeps
+// clients such as the kube-apiserver watch cache alive through short bursts
+// of writes, rather than having to relist.
+// If the watch overflow policy is cancel, a watcher which falls behind is
+// instead considered slow, and its watches are cancelled once there is room
+// in the inbox, so that clients recreate them rather than being sent events
+// late.
+
+// watchCatchUpPageSize is the number of records catchUp reads at a time
+const watchCatchUpPageSize = 1000
+
+// All responses are queued on the inbox by tryQueue, with queueMu held, and
+// only if the inbox has room for them, so that queueing never blocks while
+// a lock is held, and Cleanup can close the inbox (with queueMu held)
+// without a producer sending on it. Producers which must not drop responses
+// wait for room with waitQueue, without holding the watcher lock.
+
+// tryQueue queues msgs if the inbox has room for all of them, returning
+// false if it does not, or context.Canceled if the inbox is closed.
+// queueMu must be held.
+func (w *watcher) tryQueue(msgs []inboxMsg) (bool, error) {
+	if !w.inboxOk {
+		return false, context.Canceled
+	}
+	if cap(w.inboxCh)-len(w.inboxCh) < len(msgs) {
+		return false, nil
+	}
+	for _, msg := range msgs {
+		w.inboxCh <- msg
+	}
+	return true, nil
+}
+
+// waitQueue queues msgs in order, waiting for room in the inbox for each,
+// until ctx is cancelled. The watcher must not be locked.
+func (w *watcher) waitQueue(ctx context.Context, msgs []inboxMsg) error {
+	for i := 0; i < len(msgs); {
+		w.queueMu.Lock()
+		queued, err := w.tryQueue(msgs[i : i+1])
+		if !queued && err == nil && w.roomCh == nil {
+			w.roomCh = make(chan struct{})
+		}
+		room := w.roomCh
+		w.queueMu.Unlock()
+		if err != nil {
+			return err
+		}
+		if queued {
+			i++
+			continue
+		}
+		select {
+		case <-room:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// wakeQueue wakes producers waiting for room in the inbox. queueMu must be
+// held.
+func (w *watcher) wakeQueue() {
+	if w.roomCh != nil {
+		close(w.roomCh)
+		w.roomCh = nil
+	}
+}
+
+// dequeued wakes producers waiting for room once a response is taken from
+// the inbox
+func (w *watcher) dequeued() {
+	w.queueMu.Lock()
+	w.wakeQueue()
+	w.queueMu.Unlock()
+}
+
+// queue queues the responses for an event at revision, unless the watcher is
+// behind or the event was already queued by catchUp. If the inbox does not
+// have room for all of the responses, none are queued and the watcher falls
+// behind from revision.
+func (w *watcher) queue(revision int64, msgs []inboxMsg) {
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	if w.behind > 0 || revision <= w.caughtUp {
+		return
+	}
+	if queued, err := w.tryQueue(msgs); queued || err != nil {
+		return
+	}
+	fmt.Printf("watcher %d queue full, falling behind at revision %d\n", w.id, revision)
+	for _, msg := range msgs {
+		metrics.ClientWatchEventsDropped.WithLabelValues(w.identity).Add(float64(len(msg.Events)))
+	}
+	w.behind = revision
+	metrics.WatchersBehind.Inc()
+	select {
+	case w.catchUpCh <- struct{}{}:
+	default:
+	}
+}
+
+// caughtUpTo marks the watcher as no longer behind, with events queued up
+// to revision. queueMu must be held.
+func (w *watcher) caughtUpTo(revision int64) {
+	if w.behind > 0 {
+		metrics.WatchersBehind.Dec()
+	}
+	w.behind = 0
+	w.caughtUp = revision
+}
+
+// queueProgress queues progress notifications, unless the watcher is behind,
+// as they would report revisions whose events have not been sent. They are
+// dropped if the inbox does not have room for them, as the next
+// notification supersedes them.
+func (w *watcher) queueProgress(msgs []inboxMsg) {
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	if w.behind > 0 {
+		return
+	}
+	w.tryQueue(msgs)
+}
+
+// watchOverflowCancel is the watch overflow policy which cancels the
+// watches of watchers which fall behind
+const watchOverflowCancel = "cancel"
+
+// errWatcherSlow is the reason watches are cancelled when their watcher falls
+// behind, if the watch overflow policy is cancel
+var errWatcherSlow = errors.New("watcher is slow")
+
+// catchUpWatches runs catchUp each time the watcher falls behind, or cancels
+// its watches if the overflow policy is cancel, until ctx is cancelled. A
+// watcher which is still behind then stops being counted as behind, but
+// stays behind, so that Distribute does not queue events after the gap.
+func (cs *ClientAPIServer) catchUpWatches(ctx context.Context, w *watcher) {
+	defer func() {
+		w.queueMu.Lock()
+		if w.behind > 0 {
+			metrics.WatchersBehind.Dec()
+		}
+		w.queueMu.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.catchUpCh:
+		}
+		if cs.config.WatchOverflowPolicy() == watchOverflowCancel {
+			level.Warn(cs.logger).Log("msg", "watcher is slow, cancelling its watches", "watcher", w.id)
+			cs.cancelBehindWatches(ctx, w, errWatcherSlow)
+			metrics.WatchCatchUps.WithLabelValues("slow").Inc()
+			continue
+		}
+		result := "caught_up"
+		if err := cs.catchUp(ctx, w); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			level.Warn(cs.logger).Log("msg", "failed to catch up watcher, cancelling its watches", "watcher", w.id, "error", err)
+			result = "error"
+			if errors.Is(err, errWatchCompacted) {
+				result = "compacted"
+			}
+			cs.cancelBehindWatches(ctx, w, err)
+		}
+		metrics.WatchCatchUps.WithLabelValues(result).Inc()
+	}
+}
+
+// errWatchCompacted is returned by catchUp if events it needs to send have
+// been compacted
+var errWatchCompacted = errors.New("watch events have been compacted")
+
+// findWatchRecordsFrom returns the next page of records to send to watches
+// from revision from, or errWatchCompacted if from is at or before the
+// compact revision, as compacted values (and pruned deletes) cannot be sent.
+// The compact revision is checked after the records are read, so that
+// records compacted while they were being read are never sent.
+func (cs *ClientAPIServer) findWatchRecordsFrom(from int64) ([]*proto.Record, error) {
+	records, err := cs.db.FindRecordsFrom(from, watchCatchUpPageSize)
+	if err != nil {
+		return nil, err
+	}
+	compactRevision, err := cs.db.CompactRevision()
+	if err != nil {
+		return nil, err
+	}
+	if from <= compactRevision {
+		return nil, fmt.Errorf("%w: revision %d is at or before compacted revision %d", errWatchCompacted, from, compactRevision)
+	}
+	return records, nil
+}
+
+// catchUp queues events for a watcher which is behind from the local db, in
+// revision order, until it reaches the latest revision, at which point the
+// watcher is no longer behind
+func (cs *ClientAPIServer) catchUp(ctx context.Context, w *watcher) error {
+	w.queueMu.Lock()
+	from := w.behind
+	w.queueMu.Unlock()
+	for {
+		records, err := cs.findWatchRecordsFrom(from)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err = cs.queueCatchUp(ctx, w, record); err != nil {
+				return err
+			}
+			from = record.Revision + 1
+		}
+		if len(records) == watchCatchUpPageSize {
+			continue
+		}
+
+		// stop catching up if there are no newer records. This is checked
+		// while holding queueMu, so that Distribute queues any records
+		// committed after this point.
+		w.queueMu.Lock()
+		latestRevision, err := cs.db.LatestRevision()
+		if err != nil {
+			w.queueMu.Unlock()
+			return err
+		}
+		if latestRevision < from {
+			w.caughtUpTo(from - 1)
+			w.queueMu.Unlock()
+			level.Info(cs.logger).Log("msg", "watcher caught up", "watcher", w.id, "revision", w.caughtUp)
+			return nil
+		}
+		w.queueMu.Unlock()
+	}
+}
+
+// queueCatchUp queues the responses for record to the watcher, waiting for
+// room in the inbox
+func (cs *ClientAPIServer) queueCatchUp(ctx context.Context, w *watcher, record *proto.Record) error {
+	event, eventWithPrevKv, err := newWatchEvents(record, cs.findPrevRecord(record), cs.values)
+	if err != nil {
+		return err
+	}
+	w.RLock()
+	msgs := w.responses(record, event, eventWithPrevKv, recordCommittedAt(record))
+	w.RUnlock()
+	return w.waitQueue(ctx, msgs)
+}
+
+// cancelBehindWatches cancels all of a watcher's watches, as they cannot be
+// caught up, after which the watcher is no longer behind. Clients recreate
+// the watches, e.g. the kube-apiserver relists. The cancellations are queued
+// after any events already queued for the watches, once the watches are
+// removed, so that no events are queued for them after their cancellations.
+func (cs *ClientAPIServer) cancelBehindWatches(ctx context.Context, w *watcher, reason error) {
+	latestRevision, _ := cs.db.LatestRevision()
+	compactRevision, _ := cs.db.CompactRevision()
+	w.Lock()
+	if !w.inboxOk {
+		w.Unlock()
+		return
+	}
+	msgs := make([]inboxMsg, 0, len(w.watches))
+	for watchID, watch := range w.watches {
+		watch.cancel()
+		w.watchRemoved(watch)
+		delete(w.watches, watchID)
+		delete(w.progress, watchID)
+		msg := inboxMsg{WatchResponse: pb.WatchResponse{
+			Header:       w.header.At(latestRevision),
+			WatchId:      watchID,
+			Canceled:     true,
+			CancelReason: reason.Error(),
+		}}
+		if errors.Is(reason, errWatchCompacted) {
+			msg.CancelReason = w.compat.compactedReason
+			msg.CompactRevision = compactRevision
+		}
+		msgs = append(msgs, msg)
+	}
+	w.Unlock()
+	if err := w.waitQueue(ctx, msgs); err != nil {
+		return
+	}
+	w.queueMu.Lock()
+	w.caughtUpTo(latestRevision)
+	w.queueMu.Unlock()
+}
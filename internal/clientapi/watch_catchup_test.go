@@ -0,0 +1,187 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+)
+
+// receive takes the next response from the watcher's inbox, waking producers
+// waiting for room, as runInbox does
+func receive(w *watcher) inboxMsg {
+	msg := <-w.inboxCh
+	w.dequeued()
+	return msg
+}
+
+// TestWatchCatchUp checks that a watcher whose inbox overflows falls behind
+// rather than blocking, then receives every event in order once caught up
+// from the db, and that it cannot catch up past a compaction
+func TestWatchCatchUp(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := context.Background()
+	put := func(key string) {
+		t.Helper()
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte("v")}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	w := &watcher{
+		id:        -1,
+		inboxOk:   true,
+		inboxCh:   make(chan inboxMsg, 2),
+		catchUpCh: make(chan struct{}, 1),
+		watches:   map[int64]watch{1: {key: []byte("/"), rangeEnd: []byte("0"), cancel: func() {}}},
+		progress:  map[int64]bool{},
+		compat:    cs.compat,
+	}
+	allWatchers.Lock()
+	allWatchers.servers[w.id] = w
+	allWatchers.Unlock()
+	t.Cleanup(func() {
+		allWatchers.Lock()
+		delete(allWatchers.servers, w.id)
+		allWatchers.Unlock()
+	})
+
+	// the third event overflows the inbox, after which events are not
+	// queued until the watcher catches up
+	for _, key := range []string{"/a", "/b", "/c", "/d"} {
+		put(key)
+	}
+	if w.behind != 3 || len(w.inboxCh) != 2 || len(w.catchUpCh) != 1 {
+		t.Fatalf("expected watcher to fall behind at revision 3, got behind=%d queued=%d", w.behind, len(w.inboxCh))
+	}
+	<-w.catchUpCh
+
+	revisions := make(chan int64, 10)
+	go func() {
+		for msg := range w.inboxCh {
+			w.dequeued()
+			for _, event := range msg.Events {
+				revisions <- event.Kv.ModRevision
+			}
+		}
+		close(revisions)
+	}()
+	if err := cs.catchUp(ctx, w); err != nil {
+		t.Fatalf("catchUp: %v", err)
+	}
+	if w.behind != 0 || w.caughtUp != 4 {
+		t.Fatalf("expected watcher to be caught up to revision 4, got behind=%d caughtUp=%d", w.behind, w.caughtUp)
+	}
+	put("/e")
+	for expected := int64(1); expected <= 5; expected++ {
+		if revision := <-revisions; revision != expected {
+			t.Fatalf("expected event at revision %d, got %d", expected, revision)
+		}
+	}
+
+	// events which have been compacted cannot be caught up
+	w.queueMu.Lock()
+	w.behind = 2
+	w.queueMu.Unlock()
+	if _, err := cs.Compact(ctx, &pb.CompactionRequest{Revision: 3}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if err := cs.catchUp(ctx, w); !errors.Is(err, errWatchCompacted) {
+		t.Fatalf("expected errWatchCompacted, got %v", err)
+	}
+	w.Lock()
+	w.inboxOk = false
+	close(w.inboxCh)
+	w.Unlock()
+}
+
+// TestWatchOverflowCancel checks that if the overflow policy is cancel, a
+// watcher which falls behind has its watches cancelled after the events
+// which were queued, and is then no longer behind
+func TestWatchOverflowCancel(t *testing.T) {
+	configtest.Set(t, map[string]any{"watch_overflow_policy": "cancel"})
+	cs := newTestServer(t, grpc.NewServer())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &watcher{
+		id:        -1,
+		inboxOk:   true,
+		inboxCh:   make(chan inboxMsg, 2),
+		catchUpCh: make(chan struct{}, 1),
+		watches:   map[int64]watch{1: {key: []byte("/"), rangeEnd: []byte("0"), cancel: func() {}}},
+		progress:  map[int64]bool{1: false},
+		compat:    cs.compat,
+	}
+	allWatchers.Lock()
+	allWatchers.servers[w.id] = w
+	allWatchers.Unlock()
+	t.Cleanup(func() {
+		allWatchers.Lock()
+		delete(allWatchers.servers, w.id)
+		allWatchers.Unlock()
+	})
+
+	for _, key := range []string{"/a", "/b", "/c"} {
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte("v")}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	go cs.catchUpWatches(ctx, w)
+
+	for expected := int64(1); expected <= 2; expected++ {
+		if msg := receive(w); len(msg.Events) != 1 || msg.Events[0].Kv.ModRevision != expected {
+			t.Fatalf("expected event at revision %d, got %v", expected, msg.WatchResponse)
+		}
+	}
+	if msg := receive(w); !msg.Canceled || msg.WatchId != 1 || msg.CancelReason != errWatcherSlow.Error() {
+		t.Fatalf("expected watch to be cancelled as the watcher is slow, got %v", msg.WatchResponse)
+	}
+	w.RLock()
+	watches := len(w.watches)
+	w.RUnlock()
+	w.queueMu.Lock()
+	behind := w.behind
+	w.queueMu.Unlock()
+	if watches != 0 || behind != 0 {
+		t.Fatalf("expected no watches and the watcher not to be behind, got %d watches behind=%d", watches, behind)
+	}
+}
+
+// TestWatchersBehindOnExit checks that a watcher which is behind when its
+// stream ends is no longer counted as behind
+func TestWatchersBehindOnExit(t *testing.T) {
+	w := &watcher{
+		inboxOk:   true,
+		inboxCh:   make(chan inboxMsg),
+		catchUpCh: make(chan struct{}, 1),
+	}
+	before := testutil.ToFloat64(metrics.WatchersBehind)
+	w.queue(1, []inboxMsg{{}})
+	<-w.catchUpCh
+	if behind := testutil.ToFloat64(metrics.WatchersBehind); behind != before+1 {
+		t.Fatalf("expected watcher to be counted as behind, got %v", behind-before)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	(&ClientAPIServer{}).catchUpWatches(ctx, w)
+	if behind := testutil.ToFloat64(metrics.WatchersBehind); behind != before {
+		t.Fatalf("expected watcher to no longer be counted as behind, got %v", behind-before)
+	}
+}
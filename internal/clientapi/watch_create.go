@@ -0,0 +1,257 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// watchCreateMaxBatch is the maximum number of queued watch create requests
+// a watcher will process as a single batch
+const watchCreateMaxBatch = 256
+
+// watchCreatePool bounds how many watch create batches are processed
+// concurrently across all watchers. When a kube-apiserver restarts it creates
+// thousands of watches within seconds; without a bound, every watcher would
+// validate start revisions against the local db at the same time.
+type watchCreatePool struct {
+	slots chan struct{}
+}
+
+// newWatchCreatePool creates a pool permitting up to workers concurrent batches
+func newWatchCreatePool(workers int64) *watchCreatePool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &watchCreatePool{
+		slots: make(chan struct{}, workers),
+	}
+}
+
+// acquire blocks until a worker slot is available or the context is done,
+// returning false if the context is done
+func (p *watchCreatePool) acquire(ctx context.Context) bool {
+	select {
+	case p.slots <- struct{}{}:
+		metrics.WatchCreateWorkersBusy.Inc()
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees a worker slot obtained using acquire
+func (p *watchCreatePool) release() {
+	<-p.slots
+	metrics.WatchCreateWorkersBusy.Dec()
+}
+
+// revisionCheck holds the result of validating a watch start revision.
+// compactRevision is the revision reported to the client if the start
+// revision has been compacted.
+type revisionCheck struct {
+	revision        int64
+	compacted       bool
+	compactRevision int64
+	err             error
+}
+
+// validateStartRevisions checks the start revision of each request using a
+// single lookup for the whole batch, returning the result keyed by start
+// revision. Requests with a start revision of zero are not looked up, as they
+// always use the latest revision. As in etcd, a start revision at or before
+// the compact revision is compacted, whether or not it still exists, and is
+// reported with the compact revision rather than the start revision, so
+// clients know where history resumes. Revisions compacted otherwise (e.g.
+// skipped revisions) are reported with the start revision.
+func validateStartRevisions(batch []*pb.WatchCreateRequest, getRevisions func(findRevisions []int64) (map[int64]bool, int64, error)) map[int64]revisionCheck {
+	checks := map[int64]revisionCheck{}
+	var findRevisions []int64
+	for _, r := range batch {
+		if r.StartRevision == 0 {
+			continue
+		}
+		if _, ok := checks[r.StartRevision]; ok {
+			continue
+		}
+		checks[r.StartRevision] = revisionCheck{}
+		findRevisions = append(findRevisions, r.StartRevision)
+	}
+	if len(findRevisions) == 0 {
+		return checks
+	}
+	compacted, compactRevision, err := getRevisions(findRevisions)
+	for _, findRevision := range findRevisions {
+		if err != nil {
+			checks[findRevision] = revisionCheck{err: err}
+		} else if findRevision <= compactRevision {
+			checks[findRevision] = revisionCheck{revision: findRevision, compacted: true, compactRevision: compactRevision}
+		} else if isCompacted, ok := compacted[findRevision]; ok && isCompacted {
+			checks[findRevision] = revisionCheck{revision: findRevision, compacted: true, compactRevision: findRevision}
+		} else if ok {
+			checks[findRevision] = revisionCheck{revision: findRevision}
+		} else {
+			checks[findRevision] = revisionCheck{err: sql.ErrNoRows}
+		}
+	}
+	return checks
+}
+
+// watchCreate is a queued watch create request, or a run of consecutive
+// watch create requests rejected with the same reason. Rejections are queued
+// with the requests around them so that they are answered in order.
+type watchCreate struct {
+	request      *pb.WatchCreateRequest // nil if rejected
+	rejectReason string
+	rejected     int
+}
+
+// EnqueueCreate queues a watch create request for processing by
+// ProcessCreates, so that the stream receive loop is never blocked by
+// watch creation. If the queue is full the request is rejected.
+func (w *watcher) EnqueueCreate(r *pb.WatchCreateRequest) {
+	w.createMu.Lock()
+	defer w.createMu.Unlock()
+	if w.createPending >= w.createQueueSize {
+		metrics.WatchCreateRejected.WithLabelValues("queue_full").Inc()
+		fmt.Printf("EnqueueCreate(%d) create queue full, rejecting watch\n", w.id)
+		w.queueRejection("too many pending watch create requests")
+		return
+	}
+	w.createQueue = append(w.createQueue, watchCreate{request: r})
+	w.createPending++
+	metrics.WatchCreateQueued.Inc()
+	w.signalCreate()
+}
+
+// RejectCreate queues the rejection of a watch create request, which is sent
+// by ProcessCreates once the requests received before it are answered
+func (w *watcher) RejectCreate(reason string) {
+	w.createMu.Lock()
+	defer w.createMu.Unlock()
+	w.queueRejection(reason)
+}
+
+// queueRejection queues a rejection, adding it to the last queued run of
+// rejections if it has the same reason, so a client sending requests faster
+// than they are rejected cannot grow the queue without bound. createMu must
+// be held.
+func (w *watcher) queueRejection(reason string) {
+	if n := len(w.createQueue); n > 0 && w.createQueue[n-1].request == nil && w.createQueue[n-1].rejectReason == reason {
+		w.createQueue[n-1].rejected++
+	} else {
+		w.createQueue = append(w.createQueue, watchCreate{rejectReason: reason, rejected: 1})
+	}
+	w.signalCreate()
+}
+
+// signalCreate wakes ProcessCreates if it is waiting for queued requests.
+// createMu must be held.
+func (w *watcher) signalCreate() {
+	select {
+	case w.createCh <- struct{}{}:
+	default:
+	}
+}
+
+// dequeueCreates removes up to watchCreateMaxBatch entries from the front of
+// the create queue, returning them and the requests among them which are
+// not rejected
+func (w *watcher) dequeueCreates() (batch []watchCreate, requests []*pb.WatchCreateRequest) {
+	w.createMu.Lock()
+	defer w.createMu.Unlock()
+	n := min(len(w.createQueue), watchCreateMaxBatch)
+	batch = w.createQueue[:n:n]
+	if w.createQueue = w.createQueue[n:]; len(w.createQueue) == 0 {
+		w.createQueue = nil
+	}
+	for _, c := range batch {
+		if c.request != nil {
+			requests = append(requests, c.request)
+		}
+	}
+	w.createPending -= int64(len(requests))
+	metrics.WatchCreateQueued.Sub(float64(len(requests)))
+	return batch, requests
+}
+
+// rejectCreate acknowledges and cancels a watch create request which will
+// not be processed. As in etcd, the response has no watch ID.
+func (w *watcher) rejectCreate(latestRevision int64, reason string) {
+	_ = w.send(&pb.WatchResponse{
+		Header:       w.header.At(latestRevision),
+		Created:      true,
+		Canceled:     true,
+		CancelReason: reason,
+		WatchId:      clientv3.InvalidWatchID,
+	})
+}
+
+// ProcessCreates handles queued watch create requests until the context is
+// cancelled. Requests are processed in the order they were received, as
+// clients match create responses to their requests in order. Any requests
+// queued at the same time are processed together as a batch, which
+// validates all start revisions using a single db query. Queued rejections
+// are sent in sequence with the requests around them.
+func (w *watcher) ProcessCreates(ctx context.Context, pool *watchCreatePool, dbLatestRevision func() (int64, error), getRevisions func(findRevisions []int64) (map[int64]bool, int64, error)) {
+	// requests still queued when the stream closes are never processed
+	defer func() {
+		w.createMu.Lock()
+		metrics.WatchCreateQueued.Sub(float64(w.createPending))
+		w.createMu.Unlock()
+	}()
+	for {
+		// take the queued requests as a batch, or block until a request
+		// is queued
+		batch, requests := w.dequeueCreates()
+		if len(batch) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.createCh:
+			}
+			continue
+		}
+
+		// wait for a worker slot
+		if !pool.acquire(ctx) {
+			return
+		}
+		start := time.Now()
+		latestRevision, _ := dbLatestRevision()
+		checks := validateStartRevisions(requests, getRevisions)
+		var replays []watchReplay
+		for _, c := range batch {
+			if c.request == nil {
+				for range c.rejected {
+					w.rejectCreate(latestRevision, c.rejectReason)
+				}
+				continue
+			}
+			if replay := w.CreateWatch(c.request, latestRevision, checks[c.request.StartRevision]); replay != nil {
+				replays = append(replays, *replay)
+			}
+		}
+		pool.release()
+		metrics.WatchCreateBatchSize.Observe(float64(len(requests)))
+		metrics.WatchCreateBatchDuration.Observe(time.Since(start).Seconds())
+
+		// queue replays once the worker slot is released, as the queue
+		// may be full until earlier replays complete
+		for _, replay := range replays {
+			select {
+			case w.replayCh <- replay:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
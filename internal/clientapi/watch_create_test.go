@@ -0,0 +1,383 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/lockhold"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestValidateStartRevisions(t *testing.T) {
+	batch := []*pb.WatchCreateRequest{
+		{StartRevision: 0},
+		{StartRevision: 2},
+		{StartRevision: 3},
+		{StartRevision: 5},
+		{StartRevision: 5},
+		{StartRevision: 7},
+		{StartRevision: 9},
+	}
+
+	var calls int
+	var lookedUp []int64
+	getRevisions := func(findRevisions []int64) (map[int64]bool, int64, error) {
+		calls++
+		lookedUp = findRevisions
+		return map[int64]bool{2: true, 3: false, 5: false, 7: true}, 3, nil
+	}
+
+	checks := validateStartRevisions(batch, getRevisions)
+	if calls != 1 {
+		t.Fatalf("expected a single batched lookup, got %d", calls)
+	}
+	if len(lookedUp) != 5 {
+		t.Errorf("expected duplicate and zero start revisions to be skipped, looked up %v", lookedUp)
+	}
+	if _, ok := checks[0]; ok {
+		t.Errorf("expected no check for start revision 0")
+	}
+	// revisions at or before the compact revision are reported with it,
+	// whether or not the record at the revision has been compacted
+	for _, revision := range []int64{2, 3} {
+		if c := checks[revision]; !c.compacted || c.compactRevision != 3 || c.err != nil {
+			t.Errorf("revision %d = %+v, want compacted at compact revision 3", revision, c)
+		}
+	}
+	if c := checks[5]; c.revision != 5 || c.compacted || c.err != nil {
+		t.Errorf("revision 5 = %+v, want found and not compacted", c)
+	}
+	if c := checks[7]; c.revision != 7 || !c.compacted || c.compactRevision != 7 || c.err != nil {
+		t.Errorf("revision 7 = %+v, want found and compacted", c)
+	}
+	if c := checks[9]; !errors.Is(c.err, sql.ErrNoRows) {
+		t.Errorf("revision 9 = %+v, want sql.ErrNoRows", c)
+	}
+}
+
+func TestValidateStartRevisionsError(t *testing.T) {
+	lookupErr := errors.New("db unavailable")
+	checks := validateStartRevisions(
+		[]*pb.WatchCreateRequest{{StartRevision: 3}},
+		func(findRevisions []int64) (map[int64]bool, int64, error) {
+			return nil, 0, lookupErr
+		},
+	)
+	if c := checks[3]; !errors.Is(c.err, lookupErr) {
+		t.Errorf("revision 3 = %+v, want lookup error", c)
+	}
+}
+
+// recordingWatchServer is a watch stream which records the responses sent
+type recordingWatchServer struct {
+	pb.Watch_WatchServer
+	mu    sync.Mutex
+	sent  []*pb.WatchResponse
+	count chan struct{}
+}
+
+func (s *recordingWatchServer) Context() context.Context {
+	return context.Background()
+}
+
+func (s *recordingWatchServer) Send(resp *pb.WatchResponse) error {
+	s.mu.Lock()
+	s.sent = append(s.sent, resp)
+	s.mu.Unlock()
+	s.count <- struct{}{}
+	return nil
+}
+
+// TestProcessCreatesOrder checks that rejected watch create requests are
+// answered in the order they were received, after the requests queued
+// before them, and without a watch ID
+func TestProcessCreatesOrder(t *testing.T) {
+	client := &recordingWatchServer{count: make(chan struct{}, 10)}
+	w := &watcher{
+		RWMutex:         lockhold.RWMutex{Name: "watcher"},
+		client:          client,
+		createCh:        make(chan struct{}, 1),
+		createQueueSize: 1,
+		watches:         map[int64]watch{},
+		progress:        map[int64]bool{},
+	}
+
+	// the second request is rejected as the queue is full, and the
+	// rejections with the same reason are queued as a single entry
+	w.EnqueueCreate(&pb.WatchCreateRequest{Key: []byte("a"), WatchId: 1})
+	w.EnqueueCreate(&pb.WatchCreateRequest{Key: []byte("b"), WatchId: 2})
+	w.RejectCreate("rejected")
+	w.RejectCreate("rejected")
+	if len(w.createQueue) != 3 {
+		t.Fatalf("expected 3 queued entries, got %d", len(w.createQueue))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.ProcessCreates(ctx, newWatchCreatePool(1), func() (int64, error) { return 1, nil }, nil)
+	for range 4 {
+		select {
+		case <-client.count:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 4 responses, got %d", len(client.sent))
+		}
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if resp := client.sent[0]; !resp.Created || resp.Canceled || resp.WatchId != 1 {
+		t.Fatalf("expected the queued watch to be created first, got %v", resp)
+	}
+	reasons := []string{"too many pending watch create requests", "rejected", "rejected"}
+	for i, reason := range reasons {
+		resp := client.sent[i+1]
+		if !resp.Created || !resp.Canceled || resp.WatchId != clientv3.InvalidWatchID || resp.CancelReason != reason {
+			t.Fatalf("response %d = %v, want rejection %q", i+1, resp, reason)
+		}
+	}
+}
+
+// recvWatchResponse receives the next watch response, skipping progress
+// notifications, e.g. the notification broadcast when a watcher starts
+func recvWatchResponse(stream pb.Watch_WatchClient) (resp *pb.WatchResponse, err error) {
+	for {
+		resp, err = stream.Recv()
+		if err != nil || resp.WatchId != clientv3.InvalidWatchID || len(resp.Events) > 0 || resp.Created || resp.Canceled {
+			return resp, err
+		}
+	}
+}
+
+func TestWatchLimitPerWatcher(t *testing.T) {
+	configtest.Set(t, map[string]any{"watch_max_per_watcher": 2})
+	grpcServer := grpc.NewServer()
+	newTestServer(t, grpcServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := pb.NewWatchClient(conn).Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	create := func() *pb.WatchResponse {
+		t.Helper()
+		err := stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+			CreateRequest: &pb.WatchCreateRequest{Key: []byte("/registry/pods/")},
+		}})
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		resp, err := recvWatchResponse(stream)
+		if err != nil || !resp.Created {
+			t.Fatalf("expected watch to be created, got %v: %v", resp, err)
+		}
+		return resp
+	}
+
+	// watches up to the limit are created
+	first := create()
+	create()
+
+	// further watches are acknowledged and cancelled, without a watch ID
+	if resp := create(); !resp.Canceled || resp.WatchId != clientv3.InvalidWatchID || !strings.Contains(resp.CancelReason, "limit 2") {
+		t.Fatalf("expected watch beyond the limit to be cancelled, got %v", resp)
+	}
+
+	// cancelling a watch permits another
+	err = stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CancelRequest{
+		CancelRequest: &pb.WatchCancelRequest{WatchId: first.WatchId},
+	}})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp, err := recvWatchResponse(stream); err != nil || !resp.Canceled || resp.WatchId != first.WatchId {
+		t.Fatalf("expected watch cancellation to be acknowledged, got %v: %v", resp, err)
+	}
+	create()
+	stream.CloseSend()
+}
+
+// TestWatchClientSuppliedIDs checks that clients can supply their own watch
+// IDs, which must not be in use by another of the watcher's watches, and
+// that assigned watch IDs skip IDs in use
+func TestWatchClientSuppliedIDs(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	newTestServer(t, grpcServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := pb.NewWatchClient(conn).Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	send := func(req *pb.WatchRequest) *pb.WatchResponse {
+		t.Helper()
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		resp, err := recvWatchResponse(stream)
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		return resp
+	}
+	create := func(watchID int64) *pb.WatchResponse {
+		return send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+			CreateRequest: &pb.WatchCreateRequest{Key: []byte("/registry/pods/"), WatchId: watchID},
+		}})
+	}
+	cancelWatch := func(watchID int64) *pb.WatchResponse {
+		return send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CancelRequest{
+			CancelRequest: &pb.WatchCancelRequest{WatchId: watchID},
+		}})
+	}
+
+	if resp := create(1); !resp.Created || resp.Canceled || resp.WatchId != 1 {
+		t.Fatalf("expected watch 1 to be created, got %v", resp)
+	}
+	if resp := create(1); !resp.Created || !resp.Canceled || resp.WatchId != clientv3.InvalidWatchID || resp.CancelReason != errWatchDuplicateID.Error() {
+		t.Fatalf("expected duplicate watch ID to be cancelled, got %v", resp)
+	}
+	if resp := create(clientv3.AutoWatchID); !resp.Created || resp.Canceled || resp.WatchId != 2 {
+		t.Fatalf("expected assigned watch ID to skip watch 1, got %v", resp)
+	}
+	if resp := cancelWatch(1); !resp.Canceled || resp.WatchId != 1 {
+		t.Fatalf("expected watch 1 to be cancelled, got %v", resp)
+	}
+
+	// cancelling watch 1 again is not acknowledged, and its ID may be reused
+	if err = stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CancelRequest{
+		CancelRequest: &pb.WatchCancelRequest{WatchId: 1},
+	}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp := create(1); !resp.Created || resp.Canceled || resp.WatchId != 1 {
+		t.Fatalf("expected watch 1 to be created again, got %v", resp)
+	}
+	stream.CloseSend()
+}
+
+func TestWatchersAddLimit(t *testing.T) {
+	ws := &watchers{servers: map[int64]*watcher{}}
+	if !ws.add(&watcher{id: 1}, 2) || !ws.add(&watcher{id: 2}, 2) {
+		t.Fatalf("expected watchers up to the limit to be added")
+	}
+	if ws.add(&watcher{id: 3}, 2) {
+		t.Fatalf("expected watcher beyond the limit not to be added")
+	}
+	ws.remove(1)
+	if !ws.add(&watcher{id: 3}, 2) {
+		t.Fatalf("expected watcher to be added once another was removed")
+	}
+	if !ws.add(&watcher{id: 4}, 0) || len(ws.servers) != 3 {
+		t.Fatalf("expected watchers to be unlimited with a zero limit")
+	}
+}
+
+// TestWatchCompactedStartRevision checks that a watch from a revision at or
+// before the compact revision is cancelled with the compact revision rather
+// than the start revision, whether or not the record at the start revision
+// has been compacted
+func TestWatchCompactedStartRevision(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	cs := newTestServer(t, grpcServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	put := func(key string, modRevision int64) {
+		t.Helper()
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: modRevision}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte("v")}}}},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte(key)}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	put("/a", 0)
+	put("/b", 0)
+	put("/c", 0)
+	put("/a", 1) // compacts the record at revision 1
+	put("/d", 0)
+	if _, err := cs.Compact(ctx, &pb.CompactionRequest{Revision: 4}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	stream, err := pb.NewWatchClient(conn).Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	create := func(startRevision int64) {
+		t.Helper()
+		err := stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+			CreateRequest: &pb.WatchCreateRequest{Key: []byte("/"), RangeEnd: []byte("0"), StartRevision: startRevision},
+		}})
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if resp, err := recvWatchResponse(stream); err != nil || !resp.Created {
+			t.Fatalf("expected watch to be created, got %v: %v", resp, err)
+		}
+	}
+	for _, startRevision := range []int64{1, 2, 4} {
+		create(startRevision)
+		resp, err := recvWatchResponse(stream)
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if !resp.Canceled || resp.CompactRevision != 4 || len(resp.Events) > 0 {
+			t.Fatalf("expected watch from revision %d to be cancelled at compact revision 4, got %v", startRevision, resp)
+		}
+	}
+
+	// a watch after the compact revision is replayed
+	create(5)
+	if resp, err := recvWatchResponse(stream); err != nil || len(resp.Events) != 1 || resp.Events[0].Kv.ModRevision != 5 {
+		t.Fatalf("expected event at revision 5, got %v: %v", resp, err)
+	}
+	stream.CloseSend()
+}
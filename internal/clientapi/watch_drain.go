@@ -0,0 +1,107 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// errWatchDraining is the reason watches are cancelled when the server shuts
+// down, and watch create requests are rejected while it does, so that
+// clients such as the kube-apiserver re-create their watches on another
+// server rather than seeing their streams end abruptly
+var errWatchDraining = errors.New("server is shutting down")
+
+// drainWatchers cancels the watches of all watchers, then waits up to
+// timeout for the cancellations to be sent. Each watcher is sent the
+// responses already queued for it first. Watches are not created once
+// drainWatchers is called.
+func (cs *ClientAPIServer) drainWatchers(timeout time.Duration) {
+	cs.draining.Store(true)
+	if timeout <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// copy the watchers, as sending to them may block until the timeout,
+	// which must not block Distribute or watchers being cleaned up
+	allWatchers.RLock()
+	watchers := make([]*watcher, 0, len(allWatchers.servers))
+	for _, w := range allWatchers.servers {
+		watchers = append(watchers, w)
+	}
+	allWatchers.RUnlock()
+	if len(watchers) == 0 {
+		return
+	}
+	level.Info(cs.logger).Log("msg", "draining watchers", "watchers", len(watchers), "timeout", timeout)
+
+	latestRevision, _ := cs.db.LatestRevision()
+	var pending []<-chan struct{}
+	for _, w := range watchers {
+		if sent := w.drain(ctx, latestRevision); sent != nil {
+			pending = append(pending, sent)
+		}
+	}
+	for i, sent := range pending {
+		select {
+		case <-sent:
+			metrics.WatchersDrained.WithLabelValues("drained").Inc()
+		case <-ctx.Done():
+			metrics.WatchersDrained.WithLabelValues("timeout").Add(float64(len(pending) - i))
+			level.Warn(cs.logger).Log("msg", "timed out draining watchers", "pending", len(pending)-i)
+			return
+		}
+	}
+}
+
+// drain cancels all of the watcher's watches with errWatchDraining, queueing
+// the cancellations after any responses already queued. It returns a channel
+// which is closed once they have been sent (or discarded, if the stream
+// ended), or nil if the watcher has no watches.
+func (w *watcher) drain(ctx context.Context, revision int64) <-chan struct{} {
+	w.Lock()
+	if !w.inboxOk || len(w.watches) == 0 {
+		w.Unlock()
+		return nil
+	}
+	sent := make(chan struct{})
+	msgs := make([]inboxMsg, 0, len(w.watches))
+	remaining := len(w.watches)
+	for watchID, watch := range w.watches {
+		watch.cancel()
+		w.watchRemoved(watch)
+		delete(w.watches, watchID)
+		delete(w.progress, watchID)
+		msg := inboxMsg{WatchResponse: pb.WatchResponse{
+			Header:       w.header.At(revision),
+			WatchId:      watchID,
+			Canceled:     true,
+			CancelReason: errWatchDraining.Error(),
+		}}
+		if remaining--; remaining == 0 {
+			msg.sent = sent
+		}
+		msgs = append(msgs, msg)
+	}
+	w.Unlock()
+	if err := w.waitQueue(ctx, msgs); err != nil {
+		return nil
+	}
+	return sent
+}
+
+// isDraining returns true once the server has started draining watchers, in
+// which case watches are not created. It is checked with the watcher locked
+// as each watch is added, so that drain cannot miss a watch.
+func (w *watcher) isDraining() bool {
+	return w.draining != nil && w.draining.Load()
+}
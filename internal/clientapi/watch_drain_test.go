@@ -0,0 +1,115 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// TestStopDrainsWatchers checks that when the server is stopped, watchers are
+// sent their queued events, then the cancellation of each watch, before
+// their streams end
+func TestStopDrainsWatchers(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	cs := newTestServer(t, grpcServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewWatchClient(conn).Watch(context.Background())
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		err = stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+			CreateRequest: &pb.WatchCreateRequest{Key: []byte(key)},
+		}})
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if resp, err := recvWatchResponse(stream); err != nil || !resp.Created {
+			t.Fatalf("expected watch to be created, got %v (%v)", resp, err)
+		}
+	}
+
+	// the event is queued before the server is stopped, so is sent first
+	cs.Distribute(&proto.Record{Revision: 1, Key: []byte("a"), Value: []byte("1")}, nil)
+	stopped := make(chan struct{})
+	go func() {
+		cs.Stop()
+		close(stopped)
+	}()
+	resp, err := recvWatchResponse(stream)
+	if err != nil || len(resp.Events) != 1 || string(resp.Events[0].Kv.Key) != "a" {
+		t.Fatalf("expected queued event, got %v (%v)", resp, err)
+	}
+	canceled := map[int64]bool{}
+	for len(canceled) < 2 {
+		resp, err = recvWatchResponse(stream)
+		if err != nil || !resp.Canceled || resp.CancelReason != errWatchDraining.Error() {
+			t.Fatalf("expected watch to be cancelled as the server is shutting down, got %v (%v)", resp, err)
+		}
+		canceled[resp.WatchId] = true
+	}
+	if _, err = recvWatchResponse(stream); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable once the watchers are drained, got %v", err)
+	}
+	<-stopped
+}
+
+// TestDrainUnlocked checks that a watcher whose inbox is full does not hold
+// its lock while its cancellations wait for room, so that Distribute and
+// the watcher's other goroutines are not blocked while the server drains
+func TestDrainUnlocked(t *testing.T) {
+	w := &watcher{
+		inboxOk:  true,
+		inboxCh:  make(chan inboxMsg, 1),
+		watches:  map[int64]watch{1: {key: []byte("a"), cancel: func() {}}},
+		progress: map[int64]bool{1: false},
+	}
+	// the inbox is full
+	w.inboxCh <- inboxMsg{}
+	drained := make(chan (<-chan struct{}), 1)
+	go func() {
+		drained <- w.drain(context.Background(), 1)
+	}()
+
+	locked := make(chan struct{})
+	go func() {
+		w.RLock()
+		w.RUnlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watcher not to be locked while the cancellation waits for room")
+	}
+
+	receive(w)
+	msg := receive(w)
+	if sent := <-drained; sent == nil {
+		t.Fatal("expected a channel closed once the cancellation is sent")
+	}
+	if msg.WatchId != 1 || !msg.Canceled || msg.CancelReason != errWatchDraining.Error() {
+		t.Fatalf("expected the watch to be cancelled as the server is draining, got %v", msg.WatchResponse)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watchLagAlarm detects a watcher whose events are consistently delivered
+// late, i.e. more than threshold after they were committed, for at least
+// period. As events are distributed to each watcher in turn, a slow watcher
+// also delays every other watcher, so when cancel is set its stream is
+// ended, and its client reconnects and resumes from its last revision.
+// It is only used by the watcher's inbox goroutine, so is not locked.
+type watchLagAlarm struct {
+	logger    log.Logger
+	threshold time.Duration
+	period    time.Duration
+	cancel    bool
+
+	// laggingSince is when events started being delivered late, zero if the
+	// last event was delivered on time
+	laggingSince time.Time
+	// alarmed is true once the alarm fired, until events are on time again
+	alarmed bool
+}
+
+// newWatchLagAlarm returns the lag alarm for a watcher, or nil if watch lag
+// alarms are disabled
+func (cs *ClientAPIServer) newWatchLagAlarm(watcherID int64) *watchLagAlarm {
+	if cs.config.WatchLagAlarmMS() <= 0 {
+		return nil
+	}
+	return &watchLagAlarm{
+		logger:    log.With(cs.logger, "watcher", watcherID),
+		threshold: time.Duration(cs.config.WatchLagAlarmMS()) * time.Millisecond,
+		period:    time.Duration(cs.config.WatchLagAlarmSeconds()) * time.Second,
+		cancel:    cs.config.WatchLagCancel(),
+	}
+}
+
+// observe records that an event was delivered lag after it was committed,
+// at now. It returns an error if the alarm fired and the watcher's stream
+// must be ended.
+func (a *watchLagAlarm) observe(lag time.Duration, now time.Time) error {
+	if lag <= a.threshold {
+		if a.alarmed {
+			level.Info(a.logger).Log("msg", "watch events are delivered on time again", "lag", lag)
+		}
+		a.laggingSince = time.Time{}
+		a.alarmed = false
+		return nil
+	}
+	if a.laggingSince.IsZero() {
+		a.laggingSince = now
+	}
+	if a.alarmed || now.Sub(a.laggingSince) < a.period {
+		return nil
+	}
+	a.alarmed = true
+	if !a.cancel {
+		metrics.WatchLagAlarms.WithLabelValues("warn").Inc()
+		level.Warn(a.logger).Log("msg", "watch events are consistently delivered late", "lag", lag, "threshold", a.threshold, "lagging_for", now.Sub(a.laggingSince))
+		return nil
+	}
+	metrics.WatchLagAlarms.WithLabelValues("cancel").Inc()
+	level.Warn(a.logger).Log("msg", "ending watch stream as its events are consistently delivered late", "lag", lag, "threshold", a.threshold, "lagging_for", now.Sub(a.laggingSince))
+	return status.Errorf(codes.Unavailable, "watch events delivered %s after commit for %s, exceeding %s", lag.Round(time.Millisecond), now.Sub(a.laggingSince).Round(time.Second), a.threshold)
+}
@@ -0,0 +1,55 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWatchLagAlarm(t *testing.T) {
+	for _, cancel := range []bool{false, true} {
+		a := &watchLagAlarm{logger: log.NewNopLogger(), threshold: time.Second, period: 10 * time.Second, cancel: cancel}
+		now := time.Unix(1000, 0)
+		observe := func(lag time.Duration, after time.Duration) error {
+			now = now.Add(after)
+			return a.observe(lag, now)
+		}
+
+		// late events only alarm once they have been late for the period
+		for _, err := range []error{
+			observe(2*time.Second, 0),
+			observe(2*time.Second, 5*time.Second),
+			// an event on time resets the period
+			observe(time.Second, time.Second),
+			observe(2*time.Second, time.Second),
+			observe(2*time.Second, 9*time.Second),
+		} {
+			if err != nil || a.alarmed {
+				t.Fatalf("cancel=%t: expected no alarm before the period, got alarmed=%t err=%v", cancel, a.alarmed, err)
+			}
+		}
+		err := observe(2*time.Second, time.Second)
+		if !a.alarmed {
+			t.Fatalf("cancel=%t: expected alarm once late for the period", cancel)
+		}
+		if cancel && status.Code(err) != codes.Unavailable {
+			t.Fatalf("expected Unavailable to end the watch stream, got %v", err)
+		} else if !cancel && err != nil {
+			t.Fatalf("expected alarm to only warn, got %v", err)
+		}
+
+		// the alarm fires once until events are on time again
+		if err = observe(2*time.Second, time.Second); err != nil {
+			t.Fatalf("cancel=%t: expected alarm to fire once, got %v", cancel, err)
+		}
+		if err = observe(0, time.Second); err != nil || a.alarmed {
+			t.Fatalf("cancel=%t: expected alarm to reset, got alarmed=%t err=%v", cancel, a.alarmed, err)
+		}
+	}
+}
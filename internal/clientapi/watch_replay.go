@@ -0,0 +1,182 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// As in etcd, a watch created with a start revision at or before the latest
+// revision is first sent the events from its start revision, so that clients
+// such as the kube-apiserver can resume watching from the revision they last
+// saw. The watch is created replaying, so Distribute does not queue events
+// for it, and replay queues its past events from the local db, in order,
+// until it reaches the latest revision, at which point the watch receives
+// events from Distribute (or catchUp) from the next revision onwards.
+
+// watchReplay is a watch whose events from revision from are to be replayed
+type watchReplay struct {
+	watchID int64
+	token   uint64
+	from    int64
+}
+
+// replayWatch returns the watch being replayed, if it has not been
+// cancelled. A watch which has the same ID but was created after the watch
+// being replayed is not returned. The caller must hold the watcher lock.
+func (w *watcher) replayWatch(r watchReplay) (watch, bool) {
+	watch, ok := w.watches[r.watchID]
+	if !ok || watch.token != r.token {
+		return watch, false
+	}
+	return watch, true
+}
+
+// errReplayWatchCanceled is returned by replay if the watch was cancelled
+// before its events were replayed
+var errReplayWatchCanceled = errors.New("watch was cancelled while replaying")
+
+// replayWatches replays the events of each watch queued on the watcher's
+// replay channel, in the order the watches were created, until ctx is
+// cancelled
+func (cs *ClientAPIServer) replayWatches(ctx context.Context, w *watcher) {
+	for {
+		var r watchReplay
+		select {
+		case <-ctx.Done():
+			return
+		case r = <-w.replayCh:
+		}
+		result := "replayed"
+		if err := cs.replay(ctx, w, r); errors.Is(err, errReplayWatchCanceled) {
+			result = "canceled"
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			level.Warn(cs.logger).Log("msg", "failed to replay watch, cancelling it", "watcher", w.id, "watch", r.watchID, "from", r.from, "error", err)
+			result = "error"
+			if errors.Is(err, errWatchCompacted) {
+				result = "compacted"
+			}
+			cs.cancelReplayWatch(ctx, w, r, err)
+		}
+		metrics.WatchReplays.WithLabelValues(result).Inc()
+	}
+}
+
+// replay queues the events of a replaying watch from the local db, in
+// revision order, until it reaches the latest revision, at which point the
+// watch is no longer replaying
+func (cs *ClientAPIServer) replay(ctx context.Context, w *watcher, r watchReplay) error {
+	from := r.from
+	for {
+		records, err := cs.findWatchRecordsFrom(from)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err = cs.queueReplay(ctx, w, r, record); err != nil {
+				return err
+			}
+			from = record.Revision + 1
+		}
+		if len(records) == watchCatchUpPageSize {
+			continue
+		}
+
+		// stop replaying if there are no newer records. This is checked
+		// while holding the watcher lock, so that Distribute, which holds
+		// the watcher read lock, sends the watch any records committed
+		// after this point. The watch then starts from the next revision,
+		// so that catchUp does not send it records which were replayed.
+		w.Lock()
+		latestRevision, err := cs.db.LatestRevision()
+		if err != nil {
+			w.Unlock()
+			return err
+		}
+		if latestRevision < from {
+			watch, ok := w.replayWatch(r)
+			if ok {
+				watch.replaying = false
+				watch.startRevision = from
+				w.watches[r.watchID] = watch
+			}
+			w.Unlock()
+			if !ok {
+				return errReplayWatchCanceled
+			}
+			return nil
+		}
+		w.Unlock()
+	}
+}
+
+// queueReplay queues the response for record to a replaying watch, if the
+// record matches it, waiting for room in the inbox. Replayed events are
+// queued without their commit time, as they are not delivered late. The
+// watch is copied and the watcher unlocked before finding the previous
+// record and waiting, so that a full inbox does not block the watcher's
+// other watches.
+func (cs *ClientAPIServer) queueReplay(ctx context.Context, w *watcher, r watchReplay, record *proto.Record) error {
+	w.RLock()
+	inboxOk := w.inboxOk
+	watch, ok := w.replayWatch(r)
+	w.RUnlock()
+	if !inboxOk {
+		return context.Canceled
+	}
+	if !ok {
+		return errReplayWatchCanceled
+	}
+	if !isWatchMatch(watch, record) {
+		return nil
+	}
+	var prevRecord *proto.Record
+	if watch.prevKv {
+		prevRecord = cs.findPrevRecord(record)
+	}
+	event, eventWithPrevKv, err := newWatchEvents(record, prevRecord, cs.values)
+	if err != nil {
+		return err
+	}
+	return w.waitQueue(ctx, []inboxMsg{w.response(r.watchID, watch, record, event, eventWithPrevKv, time.Time{})})
+}
+
+// cancelReplayWatch cancels a watch whose events cannot be replayed. The
+// cancellation is queued after any events already queued for the watch.
+func (cs *ClientAPIServer) cancelReplayWatch(ctx context.Context, w *watcher, r watchReplay, reason error) {
+	latestRevision, _ := cs.db.LatestRevision()
+	compactRevision, _ := cs.db.CompactRevision()
+	w.Lock()
+	watch, ok := w.replayWatch(r)
+	if !w.inboxOk || !ok {
+		w.Unlock()
+		return
+	}
+	watch.cancel()
+	w.watchRemoved(watch)
+	delete(w.watches, r.watchID)
+	delete(w.progress, r.watchID)
+	msg := inboxMsg{WatchResponse: pb.WatchResponse{
+		Header:       w.header.At(latestRevision),
+		WatchId:      r.watchID,
+		Canceled:     true,
+		CancelReason: reason.Error(),
+	}}
+	if errors.Is(reason, errWatchCompacted) {
+		msg.CancelReason = w.compat.compactedReason
+		msg.CompactRevision = compactRevision
+	}
+	w.Unlock()
+	w.waitQueue(ctx, []inboxMsg{msg})
+}
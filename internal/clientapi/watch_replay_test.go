@@ -0,0 +1,153 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package clientapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// TestWatchReplay checks that a watch created with a past start revision is
+// sent the matching events from its start revision, in order, followed by
+// live events, and that it only receives each event once
+func TestWatchReplay(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	cs := newTestServer(t, grpcServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	put := func(key string, modRevision int64) {
+		t.Helper()
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: modRevision}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte("v")}}}},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte(key)}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	put("/a/1", 0)
+	put("/b/1", 0)
+	put("/a/2", 0)
+	put("/a/1", 1)
+
+	stream, err := pb.NewWatchClient(conn).Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	err = stream.Send(&pb.WatchRequest{RequestUnion: &pb.WatchRequest_CreateRequest{
+		CreateRequest: &pb.WatchCreateRequest{Key: []byte("/a/"), RangeEnd: []byte("/a0"), StartRevision: 2, PrevKv: true},
+	}})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp, err := recvWatchResponse(stream); err != nil || !resp.Created {
+		t.Fatalf("expected watch to be created, got %v: %v", resp, err)
+	}
+	put("/a/3", 0)
+
+	var revisions []int64
+	for len(revisions) < 3 {
+		resp, err := recvWatchResponse(stream)
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		for _, event := range resp.Events {
+			revisions = append(revisions, event.Kv.ModRevision)
+			if event.Kv.ModRevision == 4 && (event.PrevKv == nil || event.PrevKv.ModRevision != 1) {
+				t.Fatalf("expected replayed event to have the previous key-value, got %v", event)
+			}
+		}
+	}
+	if revisions[0] != 3 || revisions[1] != 4 || revisions[2] != 5 {
+		t.Fatalf("expected events at revisions [3 4 5], got %v", revisions)
+	}
+
+	// the watch receives live events once replayed, without duplicates
+	put("/a/4", 0)
+	resp, err := recvWatchResponse(stream)
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Kv.ModRevision != 6 {
+		t.Fatalf("expected live event at revision 6, got %v", resp)
+	}
+	stream.CloseSend()
+}
+
+// TestQueueReplayUnlocked checks that a replayed event waiting for room in
+// the inbox does not hold the watcher's lock, so the watcher's other watches
+// can still be changed
+func TestQueueReplayUnlocked(t *testing.T) {
+	w := &watcher{
+		inboxOk: true,
+		inboxCh: make(chan inboxMsg, 1),
+		watches: map[int64]watch{1: {key: []byte("a"), replaying: true, token: 1, cancel: func() {}}},
+	}
+	// the inbox is full
+	w.inboxCh <- inboxMsg{}
+	queued := make(chan error, 1)
+	go func() {
+		queued <- (&ClientAPIServer{}).queueReplay(context.Background(), w, watchReplay{watchID: 1, token: 1}, &proto.Record{Revision: 2, Key: []byte("a"), Deleted: true})
+	}()
+
+	locked := make(chan struct{})
+	go func() {
+		w.Lock()
+		w.watches[2] = watch{key: []byte("b"), cancel: func() {}}
+		w.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watcher not to be locked while the replayed event waits for room")
+	}
+
+	receive(w)
+	msg := receive(w)
+	if err := <-queued; err != nil {
+		t.Fatalf("queueReplay: %v", err)
+	}
+	if msg.WatchId != 1 || len(msg.Events) != 1 || msg.Events[0].Kv.ModRevision != 2 {
+		t.Fatalf("expected the replayed event at revision 2, got %v", msg.WatchResponse)
+	}
+}
+
+// TestQueueReplayReusedWatchID checks that once a replaying watch is
+// cancelled, its replay does not queue events for a later watch which was
+// created with the same watch ID
+func TestQueueReplayReusedWatchID(t *testing.T) {
+	w := &watcher{
+		inboxOk: true,
+		inboxCh: make(chan inboxMsg, 1),
+		watches: map[int64]watch{1: {key: []byte("a"), token: 2, cancel: func() {}}},
+	}
+	err := (&ClientAPIServer{}).queueReplay(context.Background(), w, watchReplay{watchID: 1, token: 1}, &proto.Record{Revision: 2, Key: []byte("a"), Deleted: true})
+	if !errors.Is(err, errReplayWatchCanceled) {
+		t.Fatalf("expected errReplayWatchCanceled, got %v", err)
+	}
+	if len(w.inboxCh) != 0 {
+		t.Fatal("expected no event to be queued for the later watch")
+	}
+}
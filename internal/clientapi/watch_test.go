@@ -4,10 +4,18 @@
 package clientapi
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/nadrama-com/netsy/internal/metrics"
 	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	mvccpb "go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
 )
 
 func TestIsWatchMatch(t *testing.T) {
@@ -47,3 +55,171 @@ func TestIsWatchMatch(t *testing.T) {
 		})
 	}
 }
+
+// failingWatchServer is a watch stream whose Send fails or panics
+type failingWatchServer struct {
+	pb.Watch_WatchServer
+	panics bool
+}
+
+func (s *failingWatchServer) Send(*pb.WatchResponse) error {
+	if s.panics {
+		panic("send failed")
+	}
+	return errors.New("send failed")
+}
+
+func TestRunInboxSendFailure(t *testing.T) {
+	for _, panics := range []bool{false, true} {
+		t.Run(fmt.Sprintf("panics=%v", panics), func(t *testing.T) {
+			w := &watcher{
+				client:  &failingWatchServer{panics: panics},
+				inboxOk: true,
+				inboxCh: make(chan inboxMsg),
+			}
+			ctx, cancel := context.WithCancelCause(context.Background())
+			done := make(chan struct{})
+			go func() {
+				w.runInbox(cancel)
+				close(done)
+			}()
+
+			w.inboxCh <- inboxMsg{}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected send failure to cancel the watch")
+			}
+			if context.Cause(ctx) == nil {
+				t.Fatalf("expected cancel cause")
+			}
+
+			// producers do not block once the consumer has failed
+			for range 3 {
+				select {
+				case w.inboxCh <- inboxMsg{}:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("expected inbox to be drained")
+				}
+			}
+			close(w.inboxCh)
+			<-done
+		})
+	}
+}
+
+// discardWatchServer is a watch stream whose Send succeeds
+type discardWatchServer struct {
+	pb.Watch_WatchServer
+}
+
+func (s *discardWatchServer) Send(*pb.WatchResponse) error {
+	return nil
+}
+
+// TestWatchClientMetrics checks that events sent to a client, and events
+// not queued as its queue was full, are counted by client
+func TestWatchClientMetrics(t *testing.T) {
+	w := &watcher{
+		identity:  "metrics-test",
+		client:    &discardWatchServer{},
+		inboxOk:   true,
+		inboxCh:   make(chan inboxMsg, 1),
+		catchUpCh: make(chan struct{}, 1),
+	}
+	event := func() inboxMsg {
+		return inboxMsg{WatchResponse: pb.WatchResponse{Events: []*mvccpb.Event{{}}}}
+	}
+	w.queue(1, []inboxMsg{event()})
+	// the second event does not fit, so the watcher falls behind
+	w.queue(2, []inboxMsg{event(), event()})
+	if dropped := testutil.ToFloat64(metrics.ClientWatchEventsDropped.WithLabelValues("metrics-test")); dropped != 2 {
+		t.Fatalf("expected 2 dropped events, got %v", dropped)
+	}
+	// the watcher is no longer counted as behind once it stops catching up
+	<-w.catchUpCh
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	(&ClientAPIServer{}).catchUpWatches(ctx, w)
+
+	close(w.inboxCh)
+	if err := w.sendInbox(); err != nil {
+		t.Fatalf("sendInbox: %v", err)
+	}
+	if sent := testutil.ToFloat64(metrics.ClientWatchEventsSent.WithLabelValues("metrics-test")); sent != 1 {
+		t.Fatalf("expected 1 sent event, got %v", sent)
+	}
+}
+
+// TestWatchesActiveDeleted checks that the active watches series of a key
+// prefix is deleted once the prefix has no watches
+func TestWatchesActiveDeleted(t *testing.T) {
+	w := &watcher{identity: "prefix-test"}
+	a, b := watch{prefix: "/registry/prefix-test"}, watch{prefix: "/registry/prefix-test"}
+	w.watchAdded(a)
+	w.watchAdded(b)
+	w.watchRemoved(a)
+	if active := testutil.ToFloat64(metrics.WatchesActive.WithLabelValues(a.prefix)); active != 1 {
+		t.Fatalf("expected 1 active watch, got %v", active)
+	}
+	w.watchRemoved(b)
+	if metrics.WatchesActive.DeleteLabelValues(a.prefix) {
+		t.Fatalf("expected the series of a prefix without watches to be deleted")
+	}
+}
+
+// TestDistributeFindsPrevKv checks that Distribute looks up the previous
+// key-value for watches which requested it if the caller did not supply it,
+// and omits it once it has been compacted
+func TestDistributeFindsPrevKv(t *testing.T) {
+	cs := newTestServer(t, grpc.NewServer())
+	ctx := context.Background()
+	put := func(value string, modRevision int64) {
+		t.Helper()
+		resp, err := cs.Txn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte("/a"), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: modRevision}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("/a"), Value: []byte(value)}}}},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte("/a")}}}},
+		})
+		if err != nil || !resp.Succeeded {
+			t.Fatalf("put %s: %v", value, err)
+		}
+	}
+	put("v1", 0)
+	put("v2", 1)
+	record, err := cs.db.FindRecordByRev(2)
+	if err != nil {
+		t.Fatalf("FindRecordByRev: %v", err)
+	}
+
+	w := &watcher{
+		id:       -1,
+		inboxOk:  true,
+		inboxCh:  make(chan inboxMsg, 2),
+		watches:  map[int64]watch{1: {key: []byte("/a"), prevKv: true, cancel: func() {}}},
+		progress: map[int64]bool{},
+	}
+	allWatchers.Lock()
+	allWatchers.servers[w.id] = w
+	allWatchers.Unlock()
+	t.Cleanup(func() {
+		allWatchers.Lock()
+		delete(allWatchers.servers, w.id)
+		allWatchers.Unlock()
+	})
+
+	cs.Distribute(record, nil)
+	msg := <-w.inboxCh
+	if prevKv := msg.Events[0].PrevKv; prevKv == nil || string(prevKv.Value) != "v1" || prevKv.ModRevision != 1 {
+		t.Fatalf("expected previous key-value to be looked up, got %v", msg.Events[0])
+	}
+
+	// compacted values are no longer stored, so are not sent as empty
+	if _, err = cs.Compact(ctx, &pb.CompactionRequest{Revision: 2}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	cs.Distribute(record, nil)
+	if msg = <-w.inboxCh; msg.Events[0].PrevKv != nil {
+		t.Fatalf("expected compacted previous key-value to be omitted, got %v", msg.Events[0])
+	}
+}
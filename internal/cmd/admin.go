@@ -0,0 +1,44 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// newAdminCmd returns the `netsy admin` command, which groups expert
+// recovery commands which change a running server's state
+func newAdminCmd(c *config.Config) *cobra.Command {
+	adminCmd := &cobra.Command{
+		Use:   "admin",
+		Short: "Expert recovery commands for a running server",
+	}
+	adminCmd.AddCommand(newSetNextRevisionCmd(c))
+	return adminCmd
+}
+
+// dialAdmin connects to the Admin API of the server at endpoint, using the
+// tls_client_* certificate and key. The connection must be closed.
+func dialAdmin(c *config.Config, endpoint string) (pb.AdminClient, *grpc.ClientConn, error) {
+	tlsFiles, err := config.LoadTLSFiles(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		RootCAs:      tlsFiles.ServerCA,
+		Certificates: []tls.Certificate{*tlsFiles.ClientCert},
+	})))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", endpoint, err)
+	}
+	return pb.NewAdminClient(conn), conn, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/clientapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/cobra"
+)
+
+// newConfigCmd returns the `netsy config` command, for printing the
+// effective runtime configuration, e.g. to debug which S3 bucket is used
+func newConfigCmd(c *config.Config) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Print the effective configuration, and where each value came from",
+		Long: `Print the effective configuration, and where each value came from (default,
+env, flag, or override when set by netsy itself), with secrets redacted.
+
+By default the configuration netsy would use in this environment is printed.
+With --endpoint, the configuration of a running server is fetched from its
+Admin API, connecting with the tls_client_* certificate and key.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString("format")
+			if format != "json" && format != "text" {
+				return fmt.Errorf("unsupported format %q, expected json or text", format)
+			}
+			resp := &pb.GetConfigResponse{Settings: clientapi.ConfigSettings(c.Settings())}
+			if endpoint, _ := cmd.Flags().GetString("endpoint"); endpoint != "" {
+				var err error
+				resp, err = getServerConfig(cmd, c, endpoint)
+				if err != nil {
+					return err
+				}
+			}
+			if format == "json" {
+				return printJSON(cmd.OutOrStdout(), resp)
+			}
+			return printConfigSettings(cmd.OutOrStdout(), resp.Settings)
+		},
+	}
+	configCmd.Flags().String("endpoint", "", "Address of a running server's client API to fetch the configuration from (default = this environment)")
+	configCmd.Flags().Duration("timeout", 10*time.Second, "Timeout for fetching the configuration from --endpoint")
+	configCmd.Flags().String("format", "text", "Output format: text (a table of names, values and sources) or json (all fields)")
+	return configCmd
+}
+
+// getServerConfig fetches the configuration of the server at endpoint
+func getServerConfig(cmd *cobra.Command, c *config.Config, endpoint string) (*pb.GetConfigResponse, error) {
+	client, conn, err := dialAdmin(c, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	defer cancel()
+	resp, err := client.GetConfig(ctx, &pb.GetConfigRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config from %s: %w", endpoint, err)
+	}
+	return resp, nil
+}
+
+// printConfigSettings prints settings as a table, one per line
+func printConfigSettings(out io.Writer, settings []*pb.ConfigSetting) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tSOURCE\tENV")
+	for _, setting := range settings {
+		fmt.Fprintf(w, "%s\t%q\t%s\t%s\n", setting.Name, setting.Value, setting.Source, setting.EnvKey)
+	}
+	return w.Flush()
+}
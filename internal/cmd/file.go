@@ -0,0 +1,342 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/keys"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// newFileCmd returns the `netsy file` command, for inspecting and
+// manipulating netsy data files (snapshots and chunks) offline
+func newFileCmd() *cobra.Command {
+	fileCmd := &cobra.Command{
+		Use:   "file",
+		Short: "Inspect and manipulate netsy data files",
+		Long:  `Inspect and manipulate netsy data files (snapshots and chunks), e.g. downloaded from S3.`,
+	}
+	fileCmd.PersistentFlags().StringSlice("dictionary", nil, "Path to a zstd dictionary file required to read compressed chunks (may be repeated)")
+
+	catCmd := &cobra.Command{
+		Use:   "cat <file>",
+		Short: "Print the records in a data file, one per line",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString("format")
+			if format != "json" && format != "text" {
+				return fmt.Errorf("unsupported format %q, expected json or text", format)
+			}
+			out := cmd.OutOrStdout()
+			_, err := readDataFile(cmd, args[0], func(record *pb.Record) error {
+				if format == "text" {
+					_, err := fmt.Fprintf(out, "revision=%d key=%s created=%t deleted=%t create_revision=%d prev_revision=%d version=%d lease=%d value_bytes=%d\n",
+						record.Revision, keys.Quote(record.Key), record.Created, record.Deleted, record.CreateRevision, record.PrevRevision, record.Version, record.Lease, len(record.Value))
+					return err
+				}
+				return printJSON(out, record)
+			})
+			return err
+		},
+	}
+	catCmd.Flags().String("format", "json", "Output format: json (all fields, with keys and values base64 encoded) or text (one line per record, with escaped keys and without values)")
+	fileCmd.AddCommand(catCmd)
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify <file>",
+		Short: "Verify the checksums and revisions of a data file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reader, err := readDataFile(cmd, args[0], nil)
+			if err != nil {
+				return err
+			}
+			sum, err := fileSHA256(args[0])
+			if err != nil {
+				return err
+			}
+			if expected, _ := cmd.Flags().GetString("sha256"); expected != "" && !strings.EqualFold(expected, sum) {
+				return fmt.Errorf("%s: sha256 %s does not match expected sha256 %s", args[0], sum, expected)
+			}
+			header, footer := reader.Header(), reader.Footer()
+			fmt.Fprintf(cmd.OutOrStdout(), "ok: kind=%s schema_version=%d compression=%s records=%d first_revision=%d last_revision=%d records_crc=%d sha256=%s\n",
+				header.Kind, header.SchemaVersion, header.Compression, header.RecordsCount, footer.FirstRevision, footer.LastRevision, footer.RecordsCrc, sum)
+			return nil
+		},
+	}
+	verifyCmd.Flags().String("sha256", "", "Also check the SHA-256 hash of the file, e.g. from the netsy-sha256 metadata of the S3 object it was downloaded from")
+	fileCmd.AddCommand(verifyCmd)
+
+	fileCmd.AddCommand(&cobra.Command{
+		Use:   "header <file>",
+		Short: "Print the header of a data file as JSON",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			// the header is verified without reading (or decompressing) records
+			header, err := datafile.ReadHeader(bufio.NewReader(file))
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			return printJSON(cmd.OutOrStdout(), header)
+		},
+	})
+
+	fileCmd.AddCommand(&cobra.Command{
+		Use:   "footer <file>",
+		Short: "Print the footer of a data file as JSON, after verifying all records",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reader, err := readDataFile(cmd, args[0], nil)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), reader.Footer())
+		},
+	})
+
+	mergeCmd := &cobra.Command{
+		Use:   "merge <chunk>...",
+		Short: "Combine chunk files with contiguous revisions into a single chunk file",
+		Long: `Combine chunk files with contiguous revisions into a single chunk file.
+Chunks must be given in revision order. Records which were already read from an
+earlier chunk (e.g. overlapping coalesced chunks) are skipped.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			var records []*pb.Record
+			var leaderID string
+			for _, path := range args {
+				reader, err := readDataFile(cmd, path, func(record *pb.Record) error {
+					var lastRevision int64
+					if len(records) > 0 {
+						lastRevision = records[len(records)-1].Revision
+					}
+					if record.Revision <= lastRevision {
+						return nil
+					}
+					if lastRevision > 0 && record.Revision != lastRevision+1 {
+						return fmt.Errorf("revision %d does not follow revision %d", record.Revision, lastRevision)
+					}
+					records = append(records, record)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				if reader.Header().Kind != pb.FileKind_KIND_CHUNK {
+					return fmt.Errorf("%s: expected a chunk file, got %s", path, reader.Header().Kind)
+				}
+				if leaderID == "" {
+					leaderID = reader.Header().LeaderId
+				}
+			}
+			err := writeDataFile(output, pb.FileKind_KIND_CHUNK, records, leaderID)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "wrote %s: records=%d first_revision=%d last_revision=%d\n",
+				output, len(records), records[0].Revision, records[len(records)-1].Revision)
+			return nil
+		},
+	}
+	mergeCmd.Flags().StringP("output", "o", "", "Path of the merged chunk file to create")
+	mergeCmd.MarkFlagRequired("output")
+	fileCmd.AddCommand(mergeCmd)
+
+	splitCmd := &cobra.Command{
+		Use:   "split <file>",
+		Short: "Split a data file into files of consecutive records",
+		Long: `Split a data file (e.g. a snapshot) into files of the same kind, each holding
+at most --records records in revision order. Files are named by their last
+revision, as in S3. Records are read one file at a time, so at most --records
+records are held in memory.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			outputDir, _ := cmd.Flags().GetString("output-dir")
+			perFile, _ := cmd.Flags().GetInt64("records")
+			if perFile <= 0 {
+				return fmt.Errorf("--records must be positive")
+			}
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			header, err := datafile.ReadHeader(bufio.NewReader(file))
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+
+			// files are written as records are read, and removed if a later
+			// record fails verification
+			var written []string
+			var part []*pb.Record
+			writePart := func() error {
+				output := filepath.Join(outputDir, fmt.Sprintf("%019d.netsy", part[len(part)-1].Revision))
+				if err := writeDataFile(output, header.Kind, part, header.LeaderId); err != nil {
+					return err
+				}
+				written = append(written, output)
+				fmt.Fprintf(cmd.OutOrStdout(), "wrote %s: records=%d first_revision=%d last_revision=%d\n",
+					output, len(part), part[0].Revision, part[len(part)-1].Revision)
+				part = part[:0]
+				return nil
+			}
+			_, err = readDataFile(cmd, args[0], func(record *pb.Record) error {
+				part = append(part, record)
+				if int64(len(part)) < perFile {
+					return nil
+				}
+				return writePart()
+			})
+			if err == nil && len(part) > 0 {
+				err = writePart()
+			}
+			if err != nil {
+				for _, output := range written {
+					os.Remove(output)
+				}
+				return err
+			}
+			return nil
+		},
+	}
+	splitCmd.Flags().StringP("output-dir", "o", ".", "Directory to create the split files in")
+	splitCmd.Flags().Int64("records", 10000, "Maximum number of records per file")
+	fileCmd.AddCommand(splitCmd)
+
+	return fileCmd
+}
+
+// fileSHA256 returns the hex encoded SHA-256 hash of the file at path
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readDataFile reads and verifies all records in the data file at path,
+// calling fn (if not nil) for each record
+func readDataFile(cmd *cobra.Command, path string, fn func(record *pb.Record) error) (reader *datafile.Reader, err error) {
+	dictionaryPaths, _ := cmd.Flags().GetStringSlice("dictionary")
+	loadDictionary, err := dictionaryLoader(dictionaryPaths)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err = datafile.NewReaderWithDictionaries(bufio.NewReader(file), nil, loadDictionary)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer reader.Release()
+	for i := int64(0); i < reader.Count(); i++ {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if fn != nil {
+			if err = fn(record); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	if _, err = reader.Close(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return reader, nil
+}
+
+// dictionaryLoader returns a loader for the zstd dictionary files at paths
+func dictionaryLoader(paths []string) (datafile.DictionaryLoader, error) {
+	dictionaries := map[uint32]*datafile.Dictionary{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		dictionary, err := datafile.ParseDictionary(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		dictionaries[dictionary.ID] = dictionary
+	}
+	return func(id uint32) (*datafile.Dictionary, error) {
+		dictionary, ok := dictionaries[id]
+		if !ok {
+			return nil, fmt.Errorf("dictionary %d not provided, use --dictionary", id)
+		}
+		return dictionary, nil
+	}, nil
+}
+
+// writeDataFile creates a data file at path containing records, compressing
+// it as netsy would when uploading it. It fails if path already exists.
+func writeDataFile(path string, kind pb.FileKind, records []*pb.Record, leaderID string) error {
+	if len(records) == 0 {
+		return fmt.Errorf("no records to write to %s", path)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	bufWriter := bufio.NewWriter(file)
+	writer, err := datafile.NewWriterWithSmartCompression(bufWriter, kind, records, leaderID, datafile.CompressionOptions{})
+	if err == nil {
+		for _, record := range records {
+			if err = writer.Write(record); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// printJSON prints a protobuf message as JSON on a single line
+func printJSON(out io.Writer, message proto.Message) error {
+	data, err := protojson.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
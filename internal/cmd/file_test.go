@@ -0,0 +1,121 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+func runFileCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	fileCmd := newFileCmd()
+	out := &bytes.Buffer{}
+	fileCmd.SetOut(out)
+	fileCmd.SetErr(out)
+	fileCmd.SetArgs(args)
+	err := fileCmd.Execute()
+	return out.String(), err
+}
+
+func TestFileMergeSplit(t *testing.T) {
+	dir := t.TempDir()
+	var records []*pb.Record
+	for revision := int64(1); revision <= 5; revision++ {
+		records = append(records, &pb.Record{Revision: revision, Key: []byte("key"), Value: []byte("value"), LeaderId: "test"})
+	}
+	// chunks 1-3 and 3-5 overlap at revision 3
+	chunkA := filepath.Join(dir, "a.netsy")
+	chunkB := filepath.Join(dir, "b.netsy")
+	if err := writeDataFile(chunkA, pb.FileKind_KIND_CHUNK, records[:3], "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDataFile(chunkB, pb.FileKind_KIND_CHUNK, records[2:], "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	merged := filepath.Join(dir, "merged.netsy")
+	if _, err := runFileCmd(t, "merge", "-o", merged, chunkA, chunkB); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	out, err := runFileCmd(t, "verify", merged)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !strings.Contains(out, "records=5 first_revision=1 last_revision=5") {
+		t.Fatalf("unexpected verify output %q", out)
+	}
+	sum, err := fileSHA256(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "sha256="+sum) {
+		t.Fatalf("expected verify output %q to include sha256", out)
+	}
+	if _, err = runFileCmd(t, "verify", "--sha256", strings.Repeat("0", 64), merged); err == nil {
+		t.Fatalf("expected verify with a different sha256 to fail")
+	}
+	out, err = runFileCmd(t, "cat", "--format", "text", merged)
+	if err != nil {
+		t.Fatalf("cat failed: %v", err)
+	}
+	if !strings.HasPrefix(out, `revision=1 key="key" created=false`) {
+		t.Fatalf("unexpected cat output %q", out)
+	}
+
+	// merging again must not overwrite the existing file
+	if _, err = runFileCmd(t, "merge", "-o", merged, chunkA, chunkB); err == nil {
+		t.Fatalf("expected merge to an existing file to fail")
+	}
+	// chunks with a gap between them cannot be merged
+	chunkC := filepath.Join(dir, "c.netsy")
+	if err = writeDataFile(chunkC, pb.FileKind_KIND_CHUNK, records[4:], "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = runFileCmd(t, "merge", "-o", filepath.Join(dir, "gap.netsy"), chunkA, chunkC); err == nil {
+		t.Fatalf("expected merge of chunks with a revision gap to fail")
+	}
+
+	splitDir := filepath.Join(dir, "split")
+	if err = os.Mkdir(splitDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = runFileCmd(t, "split", "--records", "2", "-o", splitDir, merged); err != nil {
+		t.Fatalf("split failed: %v", err)
+	}
+	for _, name := range []string{"0000000000000000002.netsy", "0000000000000000004.netsy", "0000000000000000005.netsy"} {
+		out, err = runFileCmd(t, "cat", filepath.Join(splitDir, name))
+		if err != nil {
+			t.Fatalf("cat %s failed: %v", name, err)
+		}
+		if lines := strings.Count(out, "\n"); lines == 0 || lines > 2 {
+			t.Fatalf("unexpected %d records in %s", lines, name)
+		}
+	}
+
+	// files split from a file which fails verification are removed
+	data, err := os.ReadFile(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.netsy")
+	if err = os.WriteFile(truncated, data[:len(data)-8], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	truncatedDir := filepath.Join(dir, "truncated")
+	if err = os.Mkdir(truncatedDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = runFileCmd(t, "split", "--records", "2", "-o", truncatedDir, truncated); err == nil {
+		t.Fatalf("expected split of a truncated file to fail")
+	}
+	if entries, err := os.ReadDir(truncatedDir); err != nil || len(entries) != 0 {
+		t.Fatalf("expected no split files to remain, got %v (%v)", entries, err)
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"text/template"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// Paths at which the manifests mount volumes into the netsy container
+const (
+	manifestDataDir  = "/var/lib/netsy"
+	manifestTLSDir   = "/etc/netsy/tls"
+	manifestFilesDir = "/etc/netsy/files"
+)
+
+// manifestHealthPort is the port of the plaintext gRPC health server the
+// manifests probe (see listen_health_addr)
+const manifestHealthPort = 2383
+
+// manifestEnv is an env var of the netsy container, set to Value unless it
+// is a secret, which is read from the key of the same name in SecretName
+type manifestEnv struct {
+	Name       string
+	Value      string
+	SecretName string
+}
+
+// manifestPort is a named container port
+type manifestPort struct {
+	Name string
+	Port int
+}
+
+// manifestValues are the values the manifests template is executed with
+type manifestValues struct {
+	Name                   string
+	Namespace              string
+	StatefulSet            bool
+	Image                  string
+	CPU                    string
+	MemoryMB               int64
+	StorageSize            string
+	StorageClass           string
+	TLSSecret              string
+	FilesSecret            string
+	DataDir                string
+	TLSDir                 string
+	FilesDir               string
+	HealthPort             int
+	Ports                  []manifestPort
+	Env                    []manifestEnv
+	TerminationGracePeriod int64
+}
+
+// newManifestsCmd returns the `netsy manifests` command, which prints
+// recommended Kubernetes manifests for running netsy, configured with the
+// settings of this environment
+func newManifestsCmd(c *config.Config) *cobra.Command {
+	manifestsCmd := &cobra.Command{
+		Use:   "manifests",
+		Short: "Print recommended Kubernetes manifests for running netsy",
+		Long: `Print recommended Kubernetes manifests for running netsy: a Service, and
+either a StatefulSet with a persistent volume for the local database, or a
+Deployment whose local database is restored from S3 when a pod starts.
+
+Each setting configured in this environment (by env var or flag) is set on
+the netsy container, with secrets read from the <name>-env Secret. The data
+directory, TLS files (read from the <name>-tls Secret, with ca.crt, tls.crt
+and tls.key as written by cert-manager) and memory limits are set by the
+manifests. Other settings which are paths on this host are remapped: the
+audit file into the data directory, and other files to the <name>-files
+Secret, with a key named after each setting. Probes use the gRPC health
+service, served in plaintext on port 2383, which reports NOT_SERVING until
+the local database has been backfilled.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := manifestValuesFromFlags(cmd, c)
+			if err != nil {
+				return err
+			}
+			return writeManifests(cmd.OutOrStdout(), values)
+		},
+	}
+	manifestsCmd.Flags().String("mode", "statefulset", "Workload kind: statefulset (local database on a persistent volume) or deployment (local database restored from S3, requires s3_enabled)")
+	manifestsCmd.Flags().String("name", "netsy", "Name of the workload and Service, and prefix of the Secrets it reads")
+	manifestsCmd.Flags().String("namespace", "", "Namespace of the resources (default = the namespace they are applied to)")
+	manifestsCmd.Flags().String("image", "", "Container image, e.g. built with make build")
+	manifestsCmd.MarkFlagRequired("image")
+	manifestsCmd.Flags().String("cpu", "500m", "CPU request")
+	manifestsCmd.Flags().Int64("memory-mb", 1024, "Memory request and limit in MB, from which memory_soft_limit_mb and memory_hard_limit_mb default to 75% and 90%")
+	manifestsCmd.Flags().String("storage", "10Gi", "Size of the persistent volume in statefulset mode")
+	manifestsCmd.Flags().String("storage-class", "", "Storage class of the persistent volume in statefulset mode (default = the cluster default)")
+	return manifestsCmd
+}
+
+// manifestValuesFromFlags returns the values of the manifests for the
+// flags of cmd and the settings of c
+func manifestValuesFromFlags(cmd *cobra.Command, c *config.Config) (values manifestValues, err error) {
+	mode, _ := cmd.Flags().GetString("mode")
+	if mode != "statefulset" && mode != "deployment" {
+		return values, fmt.Errorf("unsupported mode %q, expected statefulset or deployment", mode)
+	}
+	if mode == "deployment" && !c.S3Enabled() {
+		return values, fmt.Errorf("deployment mode requires s3_enabled, as the local database is not persisted")
+	}
+	if c.InstanceID() == "" {
+		return values, fmt.Errorf("instance_id must be set (INSTANCE_ID), as it identifies the instance in S3")
+	}
+	values = manifestValues{
+		StatefulSet: mode == "statefulset",
+		DataDir:     manifestDataDir,
+		TLSDir:      manifestTLSDir,
+		FilesDir:    manifestFilesDir,
+		HealthPort:  manifestHealthPort,
+		// snapshots are given time to complete on shutdown
+		TerminationGracePeriod: c.SnapshotShutdownTimeoutSeconds() + c.WatchDrainTimeoutMS()/1000 + 30,
+	}
+	values.Name, _ = cmd.Flags().GetString("name")
+	values.Namespace, _ = cmd.Flags().GetString("namespace")
+	values.Image, _ = cmd.Flags().GetString("image")
+	values.CPU, _ = cmd.Flags().GetString("cpu")
+	values.MemoryMB, _ = cmd.Flags().GetInt64("memory-mb")
+	values.StorageSize, _ = cmd.Flags().GetString("storage")
+	values.StorageClass, _ = cmd.Flags().GetString("storage-class")
+	values.TLSSecret = values.Name + "-tls"
+	if values.MemoryMB <= 0 {
+		return values, fmt.Errorf("memory-mb must be positive")
+	}
+
+	for _, port := range []struct {
+		name string
+		addr string
+	}{
+		{"clients", c.ListenClientsAddr()},
+		{"peers", c.ListenPeersAddr()},
+		{"metrics", c.ListenMetricsAddr()},
+	} {
+		if port.addr == "" {
+			continue
+		}
+		host, portStr, err := net.SplitHostPort(port.addr)
+		if err != nil {
+			return values, fmt.Errorf("invalid %s address %q: %w", port.name, port.addr, err)
+		}
+		// metrics listening on loopback are only scraped from the pod
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			continue
+		}
+		number, err := strconv.Atoi(portStr)
+		if err != nil {
+			return values, fmt.Errorf("invalid %s port %q: %w", port.name, portStr, err)
+		}
+		values.Ports = append(values.Ports, manifestPort{Name: port.name, Port: number})
+	}
+	if len(values.Ports) == 0 || values.Ports[0].Name != "clients" {
+		return values, fmt.Errorf("the client API must listen on a non-loopback address to be reachable, got %q", c.ListenClientsAddr())
+	}
+	var files []string
+	values.Env, files = manifestEnvs(c.Settings(), values)
+	if len(files) > 0 {
+		values.FilesSecret = values.Name + "-files"
+	}
+	return values, nil
+}
+
+// manifestEnvs returns the env vars of the netsy container: those of the
+// settings configured by env var or flag, in the order they are defined,
+// except those set by the manifests themselves. Paths on this host do not
+// exist in the container, so the audit file is written to the data
+// directory, and other files are read from the files Secret, whose keys are
+// returned as files.
+func manifestEnvs(settings []config.Setting, values manifestValues) (envs []manifestEnv, files []string) {
+	managed := map[string]string{
+		"data_dir":        values.DataDir,
+		"tls_server_ca":   values.TLSDir + "/ca.crt",
+		"tls_server_cert": values.TLSDir + "/tls.crt",
+		"tls_server_key":  values.TLSDir + "/tls.key",
+		"tls_client_ca":   values.TLSDir + "/ca.crt",
+		"tls_client_cert": values.TLSDir + "/tls.crt",
+		"tls_client_key":  values.TLSDir + "/tls.key",
+		// probed by the kubelet, whose grpc probes do not support TLS
+		"listen_health_addr": ":" + strconv.Itoa(values.HealthPort),
+	}
+	memoryLimits := map[string]int64{
+		"memory_soft_limit_mb": values.MemoryMB * 75 / 100,
+		"memory_hard_limit_mb": values.MemoryMB * 90 / 100,
+	}
+	for _, setting := range settings {
+		if setting.EnvKey == "" {
+			continue
+		}
+		configured := setting.Source == config.SourceEnv || setting.Source == config.SourceFlag
+		if value, ok := managed[setting.Name]; ok {
+			envs = append(envs, manifestEnv{Name: setting.EnvKey, Value: value})
+		} else if configured && setting.Path && setting.Value != "" {
+			if setting.Name == "audit_file" {
+				envs = append(envs, manifestEnv{Name: setting.EnvKey, Value: values.DataDir + "/audit.jsonl"})
+				continue
+			}
+			envs = append(envs, manifestEnv{Name: setting.EnvKey, Value: values.FilesDir + "/" + setting.Name})
+			files = append(files, setting.Name)
+		} else if limit, ok := memoryLimits[setting.Name]; ok && !configured {
+			envs = append(envs, manifestEnv{Name: setting.EnvKey, Value: strconv.FormatInt(limit, 10)})
+		} else if configured && setting.Secret {
+			envs = append(envs, manifestEnv{Name: setting.EnvKey, SecretName: values.Name + "-env"})
+		} else if configured {
+			envs = append(envs, manifestEnv{Name: setting.EnvKey, Value: setting.Value})
+		}
+	}
+	return envs, files
+}
+
+// writeManifests writes the manifests for values to out
+func writeManifests(out io.Writer, values manifestValues) error {
+	return manifestsTemplate.Execute(out, values)
+}
+
+// manifestsTemplate renders the manifests. Strings are quoted with
+// strconv.Quote, whose escapes are valid in YAML double-quoted scalars.
+var manifestsTemplate = template.Must(template.New("manifests").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`# Generated by netsy manifests. netsy is single-node, so run one replica.
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{quote .Name}}
+{{- if .Namespace}}
+  namespace: {{quote .Namespace}}
+{{- end}}
+  labels:
+    app.kubernetes.io/name: netsy
+    app.kubernetes.io/instance: {{quote .Name}}
+spec:
+{{- if .StatefulSet}}
+  clusterIP: None
+{{- end}}
+  selector:
+    app.kubernetes.io/name: netsy
+    app.kubernetes.io/instance: {{quote .Name}}
+  ports:
+{{- range .Ports}}
+  - name: {{.Name}}
+    port: {{.Port}}
+    targetPort: {{.Name}}
+{{- end}}
+---
+apiVersion: apps/v1
+kind: {{if .StatefulSet}}StatefulSet{{else}}Deployment{{end}}
+metadata:
+  name: {{quote .Name}}
+{{- if .Namespace}}
+  namespace: {{quote .Namespace}}
+{{- end}}
+  labels:
+    app.kubernetes.io/name: netsy
+    app.kubernetes.io/instance: {{quote .Name}}
+spec:
+  replicas: 1
+{{- if .StatefulSet}}
+  serviceName: {{quote .Name}}
+{{- else}}
+  # the old pod stops before the new pod starts, so only one writes to S3
+  strategy:
+    type: Recreate
+{{- end}}
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: netsy
+      app.kubernetes.io/instance: {{quote .Name}}
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: netsy
+        app.kubernetes.io/instance: {{quote .Name}}
+    spec:
+      terminationGracePeriodSeconds: {{.TerminationGracePeriod}}
+      containers:
+      - name: netsy
+        image: {{quote .Image}}
+        ports:
+{{- range .Ports}}
+        - name: {{.Name}}
+          containerPort: {{.Port}}
+{{- end}}
+        - name: health
+          containerPort: {{.HealthPort}}
+        env:
+{{- range .Env}}
+        - name: {{.Name}}
+{{- if .SecretName}}
+          valueFrom:
+            secretKeyRef:
+              name: {{quote .SecretName}}
+              key: {{.Name}}
+{{- else}}
+          value: {{quote .Value}}
+{{- end}}
+{{- end}}
+        resources:
+          requests:
+            cpu: {{quote .CPU}}
+            memory: {{.MemoryMB}}Mi
+          limits:
+            memory: {{.MemoryMB}}Mi
+        # the health service reports NOT_SERVING until the local database has
+        # been backfilled from S3, which may take a while for large databases
+        startupProbe:
+          grpc:
+            port: {{.HealthPort}}
+          periodSeconds: 10
+          failureThreshold: 360
+        readinessProbe:
+          grpc:
+            port: {{.HealthPort}}
+          periodSeconds: 5
+        livenessProbe:
+          grpc:
+            port: {{.HealthPort}}
+          periodSeconds: 10
+          failureThreshold: 6
+        volumeMounts:
+        - name: data
+          mountPath: {{quote .DataDir}}
+        - name: tls
+          mountPath: {{quote .TLSDir}}
+          readOnly: true
+{{- if .FilesSecret}}
+        - name: files
+          mountPath: {{quote .FilesDir}}
+          readOnly: true
+{{- end}}
+      volumes:
+      - name: tls
+        secret:
+          secretName: {{quote .TLSSecret}}
+{{- if .FilesSecret}}
+      - name: files
+        secret:
+          secretName: {{quote .FilesSecret}}
+{{- end}}
+{{- if not .StatefulSet}}
+      # the local database is restored from S3 when the pod starts
+      - name: data
+        emptyDir: {}
+{{- else}}
+  volumeClaimTemplates:
+  - metadata:
+      name: data
+    spec:
+      accessModes:
+      - ReadWriteOnce
+{{- if .StorageClass}}
+      storageClassName: {{quote .StorageClass}}
+{{- end}}
+      resources:
+        requests:
+          storage: {{quote .StorageSize}}
+{{- end}}
+`))
@@ -0,0 +1,105 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/config"
+)
+
+func TestManifestEnvs(t *testing.T) {
+	settings := []config.Setting{
+		{Name: "instance_id", EnvKey: "INSTANCE_ID", Value: "id", Source: config.SourceEnv},
+		{Name: "listen_health_addr", EnvKey: "NETSY_LISTEN_HEALTH_ADDR", Source: config.SourceDefault},
+		{Name: "data_dir", EnvKey: "NETSY_DATA_DIR", Value: "/home/user/data", Source: config.SourceEnv, Path: true},
+		{Name: "tls_server_ca", EnvKey: "NETSY_TLS_SERVER_CA", Source: config.SourceDefault, Path: true},
+		{Name: "s3_bucket_name", EnvKey: "NETSY_S3_BUCKET_NAME", Value: "bucket", Source: config.SourceFlag},
+		{Name: "s3_region", EnvKey: "NETSY_S3_REGION", Value: "us-east-1", Source: config.SourceDefault},
+		{Name: "s3_secret_access_key", EnvKey: "AWS_SECRET_ACCESS_KEY", Value: config.Redacted, Source: config.SourceEnv, Secret: true},
+		{Name: "memory_soft_limit_mb", EnvKey: "NETSY_MEMORY_SOFT_LIMIT_MB", Value: "0", Source: config.SourceDefault},
+		{Name: "memory_hard_limit_mb", EnvKey: "NETSY_MEMORY_HARD_LIMIT_MB", Value: "500", Source: config.SourceEnv},
+		{Name: "audit_file", EnvKey: "NETSY_AUDIT_FILE", Value: "/home/user/audit.jsonl", Source: config.SourceEnv, Path: true},
+		{Name: "metrics_bearer_token_file", EnvKey: "NETSY_METRICS_BEARER_TOKEN_FILE", Value: "/home/user/token", Source: config.SourceFlag, Path: true},
+		{Name: "proxy_etcd_ca", EnvKey: "NETSY_PROXY_ETCD_CA", Value: "/home/user/ca.crt", Source: config.SourceDefault, Path: true},
+	}
+	envs, files := manifestEnvs(settings, manifestValues{Name: "netsy", MemoryMB: 1000, DataDir: manifestDataDir, TLSDir: manifestTLSDir, FilesDir: manifestFilesDir, HealthPort: manifestHealthPort})
+	// paths on this host are remapped into the container
+	expected := []manifestEnv{
+		{Name: "INSTANCE_ID", Value: "id"},
+		{Name: "NETSY_LISTEN_HEALTH_ADDR", Value: ":2383"},
+		{Name: "NETSY_DATA_DIR", Value: manifestDataDir},
+		{Name: "NETSY_TLS_SERVER_CA", Value: manifestTLSDir + "/ca.crt"},
+		{Name: "NETSY_S3_BUCKET_NAME", Value: "bucket"},
+		{Name: "AWS_SECRET_ACCESS_KEY", SecretName: "netsy-env"},
+		{Name: "NETSY_MEMORY_SOFT_LIMIT_MB", Value: "750"},
+		{Name: "NETSY_MEMORY_HARD_LIMIT_MB", Value: "500"},
+		{Name: "NETSY_AUDIT_FILE", Value: manifestDataDir + "/audit.jsonl"},
+		{Name: "NETSY_METRICS_BEARER_TOKEN_FILE", Value: manifestFilesDir + "/metrics_bearer_token_file"},
+	}
+	if !slices.Equal(envs, expected) {
+		t.Errorf("expected env\n%v\ngot\n%v", expected, envs)
+	}
+	if !slices.Equal(files, []string{"metrics_bearer_token_file"}) {
+		t.Errorf("expected the metrics bearer token to be read from the files Secret, got %v", files)
+	}
+}
+
+func TestWriteManifests(t *testing.T) {
+	values := manifestValues{
+		Name:        "netsy",
+		Namespace:   "kube-system",
+		Image:       "netsy:dev",
+		CPU:         "1",
+		MemoryMB:    512,
+		StorageSize: "5Gi",
+		TLSSecret:   "netsy-tls",
+		DataDir:     manifestDataDir,
+		TLSDir:      manifestTLSDir,
+		FilesDir:    manifestFilesDir,
+		HealthPort:  manifestHealthPort,
+		Ports:       []manifestPort{{Name: "clients", Port: 2378}},
+		Env:         []manifestEnv{{Name: "INSTANCE_ID", Value: `"quoted"`}},
+	}
+	for _, tc := range []struct {
+		statefulSet bool
+		contains    []string
+		excludes    []string
+	}{
+		{true, []string{"kind: StatefulSet", "clusterIP: None", "volumeClaimTemplates:", `storage: "5Gi"`}, []string{"emptyDir", "Recreate", "storageClassName", "tcpSocket", "files"}},
+		{false, []string{"kind: Deployment", "type: Recreate", "emptyDir: {}"}, []string{"clusterIP", "volumeClaimTemplates"}},
+	} {
+		values.StatefulSet = tc.statefulSet
+		out := &bytes.Buffer{}
+		if err := writeManifests(out, values); err != nil {
+			t.Fatalf("writeManifests: %v", err)
+		}
+		manifests := out.String()
+		for _, s := range append(tc.contains, `namespace: "kube-system"`, `value: "\"quoted\""`, "memory: 512Mi", "grpc:\n            port: 2383") {
+			if !strings.Contains(manifests, s) {
+				t.Errorf("statefulset=%t: expected manifests to contain %q:\n%s", tc.statefulSet, s, manifests)
+			}
+		}
+		for _, s := range tc.excludes {
+			if strings.Contains(manifests, s) {
+				t.Errorf("statefulset=%t: expected manifests not to contain %q:\n%s", tc.statefulSet, s, manifests)
+			}
+		}
+	}
+
+	// the files Secret is mounted if settings are read from it
+	values.FilesSecret = "netsy-files"
+	out := &bytes.Buffer{}
+	if err := writeManifests(out, values); err != nil {
+		t.Fatalf("writeManifests: %v", err)
+	}
+	for _, s := range []string{`secretName: "netsy-files"`, `mountPath: "` + manifestFilesDir + `"`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected manifests to contain %q:\n%s", s, out.String())
+		}
+	}
+}
@@ -6,23 +6,35 @@ package cmd
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/hooks"
 	"github.com/nadrama-com/netsy/internal"
 	"github.com/nadrama-com/netsy/internal/buildvars"
 	"github.com/nadrama-com/netsy/internal/clientapi"
+	"github.com/nadrama-com/netsy/internal/compaction"
 	"github.com/nadrama-com/netsy/internal/config"
 	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/lockhold"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proxy"
+	"github.com/nadrama-com/netsy/internal/replication"
+	"github.com/nadrama-com/netsy/internal/retention"
 	"github.com/nadrama-com/netsy/internal/s3client"
+	"github.com/nadrama-com/netsy/internal/shadow"
 	"github.com/nadrama-com/netsy/internal/snapshot"
+	"github.com/nadrama-com/netsy/internal/watchdog"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -46,6 +58,9 @@ func init() {
 	pflags.VisitAll(func(flag *pflag.Flag) {
 		viper.BindPFlag(flag.Name, flag)
 	})
+	pflags.Bool("skip-backfill", false, "Start from the local database without backfilling from S3, for recovery when S3 cannot be listed but the local database is known to be good")
+	viper.BindPFlag("skip_backfill", pflags.Lookup("skip-backfill"))
+	rootCmd.AddCommand(newFileCmd())
 }
 
 func NewRootCmd() *cobra.Command {
@@ -64,6 +79,15 @@ func NewRootCmd() *cobra.Command {
 		os.Exit(1)
 	}
 
+	c.SetFlags(rootCmd.PersistentFlags())
+	rootCmd.AddCommand(newConfigCmd(c))
+	rootCmd.AddCommand(newUndeleteCmd(c))
+	rootCmd.AddCommand(newWatchesCmd(c))
+	rootCmd.AddCommand(newWritesCmd(c))
+	rootCmd.AddCommand(newStatusCmd(c))
+	rootCmd.AddCommand(newAdminCmd(c))
+	rootCmd.AddCommand(newManifestsCmd(c))
+
 	// Apply log level filtering based on verbose setting
 	if !c.Verbose() {
 		logger = level.NewFilter(logger, level.AllowInfo())
@@ -97,6 +121,7 @@ func NewRootCmd() *cobra.Command {
 		if c.Verbose() {
 			fmt.Println("Verbose ouput ENABLED")
 		}
+		lockhold.SetWarnThreshold(logger, time.Duration(c.LockHoldWarnMS())*time.Millisecond)
 
 		// load certs and keys
 		tlsFiles, err := config.LoadTLSFiles(c)
@@ -118,25 +143,56 @@ func NewRootCmd() *cobra.Command {
 			ClientCAs:  tlsFiles.ClientCA,
 		}
 
-		// configure signal handling for shutdown
-		shutdownErrsCh := make(chan error)
+		// configure signal handling for shutdown. Only the first error is
+		// received, so the channel is buffered for each sender (signals,
+		// metrics server, gRPC server, health server, proxy) so that none of
+		// them block forever.
+		shutdownErrsCh := make(chan error, 5)
 		go func() {
-			// if a signal is received, push it on to the c channel
+			// if a signal is received, push it on to the c channel. On
+			// Windows, Ctrl-C is delivered as os.Interrupt, and closing the
+			// console, logging off or shutting down as syscall.SIGTERM.
 			c := make(chan os.Signal, 1)
-			signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+			signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 			defer signal.Stop(c)
 			// block until a signal is received, then push it on to the shutdownErrsCh channel
 			shutdownErrsCh <- fmt.Errorf("%s", <-c)
 		}()
 
 		// instantiate database
-		db := localdb.New(fmt.Sprintf("%s/db.sqlite3", c.DataDir()))
-		err = db.Connect()
+		db, err := connectDB(logger, c)
 		if err != nil {
 			logger.Log("msg", "db.Connect error: %s", "error", err)
 			jitterWaitThenExit(logger)
 		}
 
+		// setup and run HTTP server for metrics, before backfill so that
+		// backfill progress can be observed
+		var metricsServer *metrics.Server
+		if c.ListenMetricsAddr() != "" {
+			metrics.RegisterDBSize(func() (metrics.DBSize, error) {
+				stats, err := db.Size()
+				return metrics.DBSize{
+					SizeBytes:       stats.Size(),
+					SizeInUseBytes:  stats.SizeInUse(),
+					WALSizeBytes:    stats.WALSize,
+					FreelistPages:   stats.FreelistCount,
+					PageUtilization: stats.PageUtilization(),
+				}, err
+			})
+			replication.RegisterMetrics()
+			metricsOptions, err := metricsServerOptions(c, tlsFiles)
+			if err != nil {
+				logger.Log("msg", "Invalid metrics server config", "error", err)
+				os.Exit(1)
+			}
+			metricsServer = metrics.NewServer(c.ListenMetricsAddr(), metricsOptions)
+			logger.Log("msg", "starting metrics (http) server...", "addr", c.ListenMetricsAddr(), "tls", metricsOptions.TLSConfig != nil)
+			go func() {
+				shutdownErrsCh <- metricsServer.ListenAndServe()
+			}()
+		}
+
 		// backfill and verify database
 		latestRevision, err := db.LatestRevision()
 		if err != nil {
@@ -146,6 +202,7 @@ func NewRootCmd() *cobra.Command {
 
 		// Create S3 client and get latest snapshot info
 		var snapshotWorker *snapshot.Worker
+		var retentionWorker *retention.Worker
 		var latestSnapshotInfo *s3client.LatestSnapshotInfo
 		var s3Client *s3client.S3Client
 		if c.S3Enabled() {
@@ -155,40 +212,59 @@ func NewRootCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
-			// Get latest snapshot info once
+			// check the bucket can be used before reading or writing
+			// data files. If backfill is skipped, S3 may be unreachable.
+			if c.S3ValidateBucket() {
+				err = s3Client.ValidateBucket(context.Background())
+				if err != nil && c.SkipBackfill() {
+					level.Warn(logger).Log("msg", "Failed to validate S3 bucket, continuing as backfill is skipped", "error", err)
+				} else if err != nil {
+					logger.Log("msg", "Failed to validate S3 bucket", "error", err)
+					os.Exit(1)
+				}
+			}
+
+			// Get latest snapshot info once. If backfill is skipped, S3 may
+			// be unreachable, in which case snapshots start from scratch
 			latestSnapshotInfo, err = s3Client.GetLatestSnapshot(context.Background())
-			if err != nil {
+			if err != nil && c.SkipBackfill() {
+				level.Warn(logger).Log("msg", "Failed to get latest snapshot info, continuing as backfill is skipped", "error", err)
+			} else if err != nil {
 				logger.Log("msg", "Failed to get latest snapshot info", "error", err)
 				os.Exit(1)
 			}
 
+			// Load the chunk dictionary, so new chunks continue to use it
+			err = s3Client.LoadLatestDictionary(context.Background())
+			if err != nil && c.SkipBackfill() {
+				level.Warn(logger).Log("msg", "Failed to load chunk dictionary, continuing as backfill is skipped", "error", err)
+			} else if err != nil {
+				logger.Log("msg", "Failed to load chunk dictionary", "error", err)
+				os.Exit(1)
+			}
+
 			snapshotWorker = snapshot.NewWorker(logger, c, db, s3Client)
 			snapshotWorker.InitializeWithSnapshot(latestSnapshotInfo)
-
-			// Ensure snapshot worker is stopped on shutdown
-			defer func() {
-				level.Info(logger).Log("msg", "shutting down snapshot worker")
-				snapshotWorker.Stop()
-			}()
+			retentionWorker = retention.NewWorker(logger, c, s3Client)
 		}
 
-		err = internal.Backfill(logger, db, c, latestRevision, latestSnapshotInfo, s3Client)
-		if err != nil {
-			logger.Log("msg", "clientServer.Backfill error", "error", err)
-			jitterWaitThenExit(logger)
-		}
-		err = db.VerifyIntegrity()
-		if err != nil {
-			logger.Log("msg", "clientServer.db.VerifyIntegrity error", "error", err)
-			jitterWaitThenExit(logger)
-		}
-
-		// Start snapshot worker after backfill is complete
+		// Create memory watchdog, which sheds load when memory is constrained
+		memWatchdog := watchdog.New(logger, c)
 		if snapshotWorker != nil {
-			snapshotWorker.Start()
+			memWatchdog.OnLevelChange(func(memLevel watchdog.Level) {
+				if memLevel < watchdog.LevelCritical {
+					return
+				}
+				// snapshotting allows chunks to be cleaned up
+				if latestRevision, err := db.LatestRevision(); err == nil {
+					snapshotWorker.ForceSnapshot(latestRevision)
+				}
+			})
 		}
 
-		// setup and run gRPC server with (etcd-compatible) client API
+		// setup gRPC server with (etcd-compatible) client API, which fails
+		// client requests with Unavailable until it is ready
+		readiness := clientapi.NewReadiness()
 		gopts := []grpc.ServerOption{
 			grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
 				MinTime:             embed.DefaultGRPCKeepAliveMinTime,
@@ -200,27 +276,157 @@ func NewRootCmd() *cobra.Command {
 			}),
 		}
 		gopts = append(gopts, grpc.Creds(credentials.NewTLS(&tlsConfig)))
+		gopts = append(gopts, readiness.ServerOptions()...)
 		grpcServer := grpc.NewServer(gopts...)
-		clienApiServer, err := clientapi.NewServer(logger, c, db, grpcServer, snapshotWorker, s3Client)
+		clienApiServer, err := clientapi.NewServer(logger, c, db, grpcServer, snapshotWorker, s3Client, memWatchdog, readiness)
 		if err != nil {
 			logger.Log("msg", "Unable to create server client", "err", err)
 			os.Exit(1)
 		}
-		grpcListener, err := net.Listen("tcp", c.ListenClientsAddr())
+		// fire hooks on commits, snapshots and leader changes
+		serverHooks := hooks.New()
+		clienApiServer.SetHooks(serverHooks)
+		if snapshotWorker != nil {
+			snapshotWorker.SetHooks(serverHooks)
+		}
+		// forward writes to a shadow etcd and compare their keys, if
+		// configured
+		shadowEtcd, err := shadow.NewFromConfig(logger, c, clienApiServer)
 		if err != nil {
-			logger.Log("msg", "Unable to create gRPC server listener", "err", err)
+			logger.Log("msg", "Unable to create shadow etcd client", "err", err)
 			os.Exit(1)
 		}
-		logger.Log("msg", "starting client (grpc) server...", "addr", c.ListenClientsAddr())
-		go func() {
-			shutdownErrsCh <- grpcServer.Serve(grpcListener)
-		}()
+		if shadowEtcd != nil {
+			shadowEtcd.Start(serverHooks)
+		}
+		// serve reads from a replica of an upstream etcd, forwarding writes
+		// to it, if configured
+		proxyEtcd, err := proxy.NewFromConfig(logger, c, db)
+		if err != nil {
+			logger.Log("msg", "Unable to create upstream etcd client", "err", err)
+			os.Exit(1)
+		}
+		if proxyEtcd != nil {
+			clienApiServer.SetProxy(proxyEtcd)
+			go func() {
+				shutdownErrsCh <- <-proxyEtcd.Err()
+			}()
+		}
+		serveClients := func() {
+			grpcListener, err := net.Listen("tcp", c.ListenClientsAddr())
+			if err != nil {
+				logger.Log("msg", "Unable to create gRPC server listener", "err", err)
+				os.Exit(1)
+			}
+			logger.Log("msg", "starting client (grpc) server...", "addr", c.ListenClientsAddr(), "ready", readiness.Ready())
+			go func() {
+				shutdownErrsCh <- grpcServer.Serve(grpcListener)
+			}()
+		}
+
+		// serve the health service in plaintext, if configured, from before
+		// backfill so that probes see NOT_SERVING until the server is ready
+		var healthServer *grpc.Server
+		if c.ListenHealthAddr() != "" {
+			healthListener, err := net.Listen("tcp", c.ListenHealthAddr())
+			if err != nil {
+				logger.Log("msg", "Unable to create gRPC health server listener", "err", err)
+				os.Exit(1)
+			}
+			healthServer = grpc.NewServer()
+			readiness.RegisterHealth(healthServer)
+			logger.Log("msg", "starting health (grpc) server...", "addr", c.ListenHealthAddr())
+			go func() {
+				shutdownErrsCh <- healthServer.Serve(healthListener)
+			}()
+		}
+
+		// optionally listen before backfill, e.g. so that health checks can
+		// distinguish a starting server from one which is down
+		if c.ListenClientsEarly() {
+			serveClients()
+		}
+
+		leaderEpoch, err := internal.Backfill(logger, db, c, latestRevision, latestSnapshotInfo, s3Client)
+		if err != nil {
+			logger.Log("msg", "clientServer.Backfill error", "error", err)
+			jitterWaitThenExit(logger)
+		}
+		if c.SkipBackfill() && s3Client != nil {
+			reconcileCtx, stopReconcile := context.WithCancel(context.Background())
+			defer stopReconcile()
+			go internal.ReconcileSkippedBackfill(reconcileCtx, logger, db, c, s3Client)
+		}
+		err = db.VerifyIntegrity()
+		if err != nil {
+			logger.Log("msg", "clientServer.db.VerifyIntegrity error", "error", err)
+			jitterWaitThenExit(logger)
+		}
+
+		// lead with a newer epoch than the leaders before this instance,
+		// before any files are uploaded
+		clienApiServer.AdvanceLeaderEpoch(leaderEpoch)
+
+		// Start snapshot worker after backfill is complete
+		if snapshotWorker != nil {
+			snapshotWorker.Start()
+		}
+		if retentionWorker != nil {
+			retentionWorker.Start()
+		}
+
+		memWatchdog.Start()
+		defer memWatchdog.Stop()
+
+		// serve client requests, now that the database has been backfilled
+		// and verified
+		if !c.ListenClientsEarly() {
+			serveClients()
+		}
+		if err = clienApiServer.SetReady(); err != nil {
+			logger.Log("msg", "Unable to start serving client requests", "err", err)
+			os.Exit(1)
+		}
+		logger.Log("msg", "ready to serve client requests")
+
+		// periodically compact history outside of the retention window. In
+		// proxy mode, the upstream etcd's compactions are replicated instead.
+		var compactionWorker *compaction.Worker
+		if proxyEtcd == nil {
+			compactionWorker = compaction.NewWorker(logger, c, db, clienApiServer.CompactTo)
+			compactionWorker.Start()
+		}
 
 		// block until a shutdown error is received (err or signal)
 		err = <-shutdownErrsCh
 		logger.Log("msg", "shutting down...")
 
 		// cleanup and exit
+		if metricsServer != nil {
+			metricsServer.Close()
+		}
+		// stop accepting client requests (ending watches), then let the
+		// snapshot worker drain before the database is closed
+		if compactionWorker != nil {
+			compactionWorker.Stop()
+		}
+		clienApiServer.Stop()
+		if healthServer != nil {
+			healthServer.Stop()
+		}
+		if shadowEtcd != nil {
+			shadowEtcd.Stop()
+		}
+		if proxyEtcd != nil {
+			proxyEtcd.Stop()
+		}
+		if snapshotWorker != nil {
+			level.Info(logger).Log("msg", "shutting down snapshot worker")
+			snapshotWorker.Stop()
+		}
+		if retentionWorker != nil {
+			retentionWorker.Stop()
+		}
 		clienApiServer.Close()
 		logger.Log("msg", "exiting")
 	}
@@ -228,13 +434,89 @@ func NewRootCmd() *cobra.Command {
 	return rootCmd
 }
 
+// metricsServerOptions returns the configured metrics server TLS and access
+// restrictions
+func metricsServerOptions(c *config.Config, tlsFiles *config.TLSFiles) (options metrics.ServerOptions, err error) {
+	if c.MetricsTLS() {
+		options.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*tlsFiles.ServerCert},
+		}
+		if c.MetricsTLSClientAuth() {
+			options.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			options.TLSConfig.ClientCAs = tlsFiles.ClientCA
+		}
+	} else if c.MetricsTLSClientAuth() {
+		return options, fmt.Errorf("metrics_tls_client_auth requires metrics_tls")
+	}
+	if c.MetricsBearerTokenFile() != "" {
+		token, err := os.ReadFile(c.MetricsBearerTokenFile())
+		if err != nil {
+			return options, fmt.Errorf("failed to read metrics bearer token file: %w", err)
+		}
+		options.BearerToken = strings.TrimSpace(string(token))
+		if options.BearerToken == "" {
+			return options, fmt.Errorf("metrics bearer token file %s is empty", c.MetricsBearerTokenFile())
+		}
+	}
+	options.AllowedPrefixes, err = metrics.ParseAllowedPrefixes(c.MetricsAllowedCIDRs())
+	if err != nil {
+		return options, fmt.Errorf("invalid metrics_allowed_cidrs: %w", err)
+	}
+	return options, nil
+}
+
+// connectDB connects to the local database and checks it for corruption. If
+// it is corrupt and rebuilding is enabled, the corrupt files are moved aside
+// and an empty database is created in their place, which is then rebuilt
+// from S3 by Backfill, rather than serving bad data.
+func connectDB(logger log.Logger, c *config.Config) (db localdb.Database, err error) {
+	file := filepath.Join(c.DataDir(), "db.sqlite3")
+	db = localdb.New(file, int(c.DBMaxReadConns()))
+	err = db.Connect()
+	if err == nil && c.DBIntegrityCheck() != "off" {
+		start := time.Now()
+		err = db.CheckIntegrity(c.DBIntegrityCheck() == "full")
+		if err == nil {
+			level.Info(logger).Log("msg", "db integrity check passed", "mode", c.DBIntegrityCheck(), "duration", time.Since(start))
+		}
+	}
+	if !errors.Is(err, localdb.ErrCorrupt) {
+		return db, err
+	}
+	if !c.DBRebuildOnCorruption() || !c.S3Enabled() {
+		return nil, fmt.Errorf("%w (enable db_rebuild_on_corruption with S3 to rebuild it automatically)", err)
+	}
+
+	// rebuild from S3
+	level.Error(logger).Log("msg", "db is corrupt, rebuilding from S3", "error", err)
+	if err = db.Close(); err != nil {
+		level.Warn(logger).Log("msg", "failed to close corrupt db", "error", err)
+	}
+	quarantined, err := localdb.Quarantine(file)
+	if err != nil {
+		return nil, err
+	}
+	level.Warn(logger).Log("msg", "moved corrupt db aside", "path", quarantined)
+	db = localdb.New(file, int(c.DBMaxReadConns()))
+	if err = db.Connect(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// sleep and exit are used by jitterWaitThenExit, and are replaced in tests
+var (
+	sleep = time.Sleep
+	exit  = os.Exit
+)
+
 func jitterWaitThenExit(logger log.Logger) {
 	// generate a random amount of time to wait before exiting
 	// to introduce jitter / so we don't constantly retry
 	waitFor := time.Duration(rand.Intn(10)) * time.Second
 	logger.Log("msg", "waiting before exiting", "wait", waitFor)
-	time.Sleep(waitFor)
+	sleep(waitFor)
 	logger.Log("msg", "exiting...")
-	os.Exit(1)
-	return
+	exit(1)
 }
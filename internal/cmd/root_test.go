@@ -0,0 +1,37 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestJitterWaitThenExit(t *testing.T) {
+	prevSleep, prevExit := sleep, exit
+	t.Cleanup(func() {
+		sleep, exit = prevSleep, prevExit
+	})
+	var waits []time.Duration
+	var codes []int
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	exit = func(code int) { codes = append(codes, code) }
+
+	for range 20 {
+		jitterWaitThenExit(log.NewNopLogger())
+	}
+	if len(waits) != 20 || len(codes) != 20 {
+		t.Fatalf("expected 20 waits and exits, got %d and %d", len(waits), len(codes))
+	}
+	for i, wait := range waits {
+		if wait < 0 || wait >= 10*time.Second || wait%time.Second != 0 {
+			t.Errorf("wait %d: expected whole seconds below 10s, got %v", i, wait)
+		}
+		if codes[i] != 1 {
+			t.Errorf("exit %d: expected code 1, got %d", i, codes[i])
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/cobra"
+)
+
+// newSetNextRevisionCmd returns the `netsy admin set-next-revision` command,
+// for recovering after manual changes to the local db or S3
+func newSetNextRevisionCmd(c *config.Config) *cobra.Command {
+	setNextRevisionCmd := &cobra.Command{
+		Use:   "set-next-revision <revision>",
+		Short: "Set the revision assigned to the next write (expert recovery)",
+		Long: `Set the revision assigned to the next write of a running server, for rare
+recovery scenarios after manual changes to the local db or S3.
+
+The revision must be after the latest revision in both the local db and S3,
+and the local db must not be missing revisions written to S3, so that no
+revision is assigned twice. Revisions skipped are recorded as a gap in the
+local db, so the revision is kept across restarts, and a snapshot is written
+once the next record is written, as backfill requires chunks to be
+contiguous. Until then, backfilling another instance from S3 fails.
+
+Without --yes the revision is only validated, and the change which would be
+made is printed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			revision, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil || revision <= 0 {
+				return fmt.Errorf("invalid revision %q, expected a positive integer", args[0])
+			}
+			endpoint, _ := cmd.Flags().GetString("endpoint")
+			yes, _ := cmd.Flags().GetBool("yes")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			client, conn, err := dialAdmin(c, endpoint)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			resp, err := client.SetNextRevision(ctx, &pb.SetNextRevisionRequest{Revision: revision, DryRun: !yes})
+			if err != nil {
+				return fmt.Errorf("failed to set next revision to %d: %w", revision, err)
+			}
+			result := "ok"
+			if resp.DryRun {
+				result = "dry run"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: next_revision=%d previous_next_revision=%d local_revision=%d s3_revision=%d",
+				result, resp.Revision, resp.PreviousRevision, resp.LocalRevision, resp.S3Revision)
+			if resp.GapFirstRevision > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), " skipped_revisions=%d-%d", resp.GapFirstRevision, resp.GapLastRevision)
+			}
+			fmt.Fprintln(cmd.OutOrStdout())
+			if resp.DryRun {
+				fmt.Fprintln(cmd.OutOrStdout(), "the next revision was not set, re-run with --yes to set it")
+			}
+			return nil
+		},
+	}
+	setNextRevisionCmd.Flags().String("endpoint", "localhost:2378", "Address of the server's client API")
+	setNextRevisionCmd.Flags().Bool("yes", false, "Set the revision, rather than only validating it")
+	setNextRevisionCmd.Flags().Duration("timeout", 30*time.Second, "Timeout for the request")
+	return setNextRevisionCmd
+}
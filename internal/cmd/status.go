@@ -0,0 +1,66 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/cobra"
+)
+
+// newStatusCmd returns the `netsy status` command, which prints the
+// netsy-specific state of a running server
+func newStatusCmd(c *config.Config) *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print the write fence, memory, replication and operation status of a running server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			endpoint, _ := cmd.Flags().GetString("endpoint")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			format, _ := cmd.Flags().GetString("format")
+			if format != "json" && format != "text" {
+				return fmt.Errorf("unsupported format %q, expected json or text", format)
+			}
+			client, conn, err := dialAdmin(c, endpoint)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			resp, err := client.GetStatus(ctx, &pb.GetStatusRequest{})
+			if err != nil {
+				return fmt.Errorf("failed to get status from %s: %w", endpoint, err)
+			}
+			if format == "json" {
+				return printJSON(cmd.OutOrStdout(), resp)
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "local revision: %d\n", resp.LocalRevision)
+			fmt.Fprintf(out, "memory level: %s\n", resp.MemoryLevel)
+			if fence := resp.WriteFence; fence != nil {
+				fmt.Fprintf(out, "writes fenced since %s: another writer wrote revision %d: %s\n",
+					fence.FencedAt.AsTime().Format(time.RFC3339), fence.Revision, fence.Cause)
+			}
+			if lag := resp.Replication; lag != nil {
+				fmt.Fprintf(out, "replication lag: %d records (%s) behind leader revision %d, applied revision %d\n",
+					lag.LagRecords, lag.Lag.AsDuration().Round(time.Millisecond), lag.LeaderRevision, lag.AppliedRevision)
+			}
+			for _, op := range resp.Operations {
+				fmt.Fprintf(out, "%s in progress: %d/%d records, %d/%d bytes\n",
+					op.Name, op.RecordsDone, op.RecordsTotal, op.BytesDone, op.BytesTotal)
+			}
+			return nil
+		},
+	}
+	statusCmd.Flags().String("endpoint", "localhost:2378", "Address of the server's client API")
+	statusCmd.Flags().Duration("timeout", 10*time.Second, "Timeout for the request")
+	statusCmd.Flags().String("format", "text", "Output format: text or json")
+	return statusCmd
+}
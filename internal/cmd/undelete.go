@@ -0,0 +1,54 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/keys"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/cobra"
+)
+
+// newUndeleteCmd returns the `netsy undelete` command, for recovering keys
+// which were deleted by accident, e.g. by kubectl delete
+func newUndeleteCmd(c *config.Config) *cobra.Command {
+	undeleteCmd := &cobra.Command{
+		Use:   "undelete <key>",
+		Short: "Recreate a deleted key with its value from before it was deleted",
+		Long: `Recreate a deleted key with its value from before it was deleted, or as of
+--as-of revision, by writing a new create record through the server's normal
+transaction path, so that it is replicated and watchers see it created.
+
+The value must not have been compacted. The key is not attached to a lease.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			endpoint, _ := cmd.Flags().GetString("endpoint")
+			asOf, _ := cmd.Flags().GetInt64("as-of")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			client, conn, err := dialAdmin(c, endpoint)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			key := []byte(args[0])
+			resp, err := client.UndeleteKey(ctx, &pb.UndeleteKeyRequest{Key: key, AsOfRevision: asOf})
+			if err != nil {
+				return fmt.Errorf("failed to undelete %s: %w", keys.Quote(key), err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "ok: key=%s revision=%d restored_revision=%d deleted_revision=%d\n",
+				keys.Quote(key), resp.Revision, resp.RestoredRevision, resp.DeletedRevision)
+			return nil
+		},
+	}
+	undeleteCmd.Flags().String("endpoint", "localhost:2378", "Address of the server's client API")
+	undeleteCmd.Flags().Int64("as-of", 0, "Restore the key's value as of this revision (default = the last revision before it was deleted)")
+	undeleteCmd.Flags().Duration("timeout", 10*time.Second, "Timeout for the request")
+	return undeleteCmd
+}
@@ -0,0 +1,62 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/cobra"
+)
+
+// newWatchesCmd returns the `netsy watches` command, for finding clients
+// which leak watches
+func newWatchesCmd(c *config.Config) *cobra.Command {
+	watchesCmd := &cobra.Command{
+		Use:   "watches",
+		Short: "Print the number of active watches per key prefix of a running server",
+		Long: `Print the number of active watches per key prefix of a running server, most
+watches first, where the prefix is the first two path segments of the watched
+key, e.g. /registry/pods. A prefix whose watches keep growing while the
+number of watchers (streams) does not suggests a client is leaking watches.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			endpoint, _ := cmd.Flags().GetString("endpoint")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			format, _ := cmd.Flags().GetString("format")
+			if format != "json" && format != "text" {
+				return fmt.Errorf("unsupported format %q, expected json or text", format)
+			}
+			client, conn, err := dialAdmin(c, endpoint)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			resp, err := client.ListWatchPrefixes(ctx, &pb.ListWatchPrefixesRequest{})
+			if err != nil {
+				return fmt.Errorf("failed to list watches from %s: %w", endpoint, err)
+			}
+			if format == "json" {
+				return printJSON(cmd.OutOrStdout(), resp)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "PREFIX\tWATCHES\tWATCHERS")
+			for _, prefix := range resp.Prefixes {
+				fmt.Fprintf(w, "%s\t%d\t%d\n", prefix.Prefix, prefix.Watches, prefix.Watchers)
+			}
+			fmt.Fprintf(w, "total\t%d\t%d\n", resp.Watches, resp.Watchers)
+			return w.Flush()
+		},
+	}
+	watchesCmd.Flags().String("endpoint", "localhost:2378", "Address of the server's client API")
+	watchesCmd.Flags().Duration("timeout", 10*time.Second, "Timeout for the request")
+	watchesCmd.Flags().String("format", "text", "Output format: text (a table) or json")
+	return watchesCmd
+}
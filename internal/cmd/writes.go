@@ -0,0 +1,70 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"github.com/spf13/cobra"
+)
+
+// newWritesCmd returns the `netsy writes` command, for finding the
+// namespaces which write the most
+func newWritesCmd(c *config.Config) *cobra.Command {
+	writesCmd := &cobra.Command{
+		Use:   "writes",
+		Short: "Print the top talkers: the recent write rate per namespace of a running server",
+		Long: `Print the recent write rate per Kubernetes namespace of a running server, most
+writes first, averaged over the last few minutes. Writes to keys without a
+namespace, e.g. of cluster-scoped resources, are reported as _cluster. Each
+record committed adds a revision and is uploaded to S3, so the namespaces
+writing the most are those driving revision growth and S3 costs.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			endpoint, _ := cmd.Flags().GetString("endpoint")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			format, _ := cmd.Flags().GetString("format")
+			limit, _ := cmd.Flags().GetInt64("limit")
+			if format != "json" && format != "text" {
+				return fmt.Errorf("unsupported format %q, expected json or text", format)
+			}
+			client, conn, err := dialAdmin(c, endpoint)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			resp, err := client.ListNamespaceWrites(ctx, &pb.ListNamespaceWritesRequest{Limit: limit})
+			if err != nil {
+				return fmt.Errorf("failed to list namespace writes from %s: %w", endpoint, err)
+			}
+			if format == "json" {
+				return printJSON(cmd.OutOrStdout(), resp)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAMESPACE\tWRITES/MIN\tBYTES/MIN\tWRITES\tBYTES")
+			for _, ns := range resp.Namespaces {
+				fmt.Fprintf(w, "%s\t%.1f\t%.0f\t%d\t%d\n", ns.Namespace, ns.WritesPerMinute, ns.BytesPerMinute, ns.Writes, ns.Bytes)
+			}
+			minutes := resp.Window.AsDuration().Minutes()
+			fmt.Fprintf(w, "total\t%.1f\t%.0f\t%d\t%d\n", float64(resp.Writes)/minutes, float64(resp.Bytes)/minutes, resp.Writes, resp.Bytes)
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "averaged over the last %s\n", resp.Window.AsDuration().Round(time.Second))
+			return nil
+		},
+	}
+	writesCmd.Flags().String("endpoint", "localhost:2378", "Address of the server's client API")
+	writesCmd.Flags().Duration("timeout", 10*time.Second, "Timeout for the request")
+	writesCmd.Flags().String("format", "text", "Output format: text (a table) or json")
+	writesCmd.Flags().Int64("limit", 20, "Maximum number of namespaces printed (0 = all)")
+	return writesCmd
+}
@@ -0,0 +1,73 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"context"
+
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/transform"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	mvccpb "go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+)
+
+// IsBatchableGet returns true if r gets a single exact key without options
+// other than a revision, so that it can be served by BatchGet. Gets with
+// other options, including unsupported ones, are served by Range.
+func IsBatchableGet(r *pb.RangeRequest) bool {
+	_, knownSortTarget := sortTargets[r.SortTarget]
+	return len(r.Key) > 0 &&
+		len(r.RangeEnd) == 0 &&
+		r.Limit >= 0 &&
+		knownSortTarget &&
+		!r.CountOnly &&
+		!r.KeysOnly &&
+		!r.Serializable &&
+		r.MinModRevision == 0 &&
+		r.MaxModRevision == 0 &&
+		r.MinCreateRevision == 0 &&
+		r.MaxCreateRevision == 0
+}
+
+// BatchGet gets many exact keys as of revision (or the latest revision if
+// 0), e.g. for clients which fan out gets of individual objects, looking up
+// the keys together rather than one query per key. It returns a response
+// for each key, in the order of keys, as Range would for a get of the key.
+func BatchGet(db localdb.Database, header ResponseHeader, values transform.Chain, ctx context.Context, keys [][]byte, revision int64) ([]*pb.RangeResponse, error) {
+	records, err := db.FindLatestRecords(keys, revision)
+	if err != nil {
+		return nil, err
+	}
+	latestRevision, err := db.LatestRevision()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]*proto.Record, len(records))
+	for _, record := range records {
+		if record.CompactedAt != nil {
+			return nil, rpctypes.ErrGRPCCompacted
+		}
+		found[string(record.Key)] = record
+	}
+
+	responses := make([]*pb.RangeResponse, len(keys))
+	for i, key := range keys {
+		resp := &pb.RangeResponse{
+			Header: header.At(latestRevision),
+			Kvs:    []*mvccpb.KeyValue{},
+		}
+		if record, ok := found[string(key)]; ok {
+			kv := &mvccpb.KeyValue{}
+			if err := recordKeyValue(kv, record, values); err != nil {
+				return nil, err
+			}
+			resp.Kvs = append(resp.Kvs, kv)
+			resp.Count = 1
+		}
+		responses[i] = resp
+	}
+	return responses, nil
+}
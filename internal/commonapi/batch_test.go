@@ -0,0 +1,59 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/transform"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// TestBatchGet checks that BatchGet returns the same response for each key
+// as Range does, including keys which differ only in case, missing keys and
+// repeated keys, at the latest revision and at an earlier revision
+func TestBatchGet(t *testing.T) {
+	db := newTestRangeDB(t)
+	ctx := context.Background()
+	keys := append([][]byte{[]byte("missing"), []byte("a"), []byte("a")}, testKeys...)
+	for _, revision := range []int64{0, 10} {
+		resps, err := BatchGet(db, ResponseHeader{}, transform.Chain{}, ctx, keys, revision)
+		if err != nil {
+			t.Fatalf("BatchGet at revision %d: %v", revision, err)
+		}
+		if len(resps) != len(keys) {
+			t.Fatalf("expected %d responses, got %d", len(keys), len(resps))
+		}
+		for i, key := range keys {
+			expect, err := Range(db, ResponseHeader{}, transform.Chain{}, ctx, &pb.RangeRequest{Key: key, Revision: revision})
+			if err != nil {
+				t.Fatalf("Range %q: %v", key, err)
+			}
+			if resps[i].String() != expect.String() {
+				t.Errorf("BatchGet %q at revision %d = %v, want %v", key, revision, resps[i], expect)
+			}
+		}
+	}
+}
+
+func TestIsBatchableGet(t *testing.T) {
+	tests := []struct {
+		r      *pb.RangeRequest
+		expect bool
+	}{
+		{&pb.RangeRequest{Key: []byte("a")}, true},
+		{&pb.RangeRequest{Key: []byte("a"), Revision: 5, Limit: 1}, true},
+		{&pb.RangeRequest{Key: []byte("a"), RangeEnd: []byte("b")}, false},
+		{&pb.RangeRequest{Key: []byte("a"), CountOnly: true}, false},
+		{&pb.RangeRequest{Key: []byte("a"), Serializable: true}, false},
+		{&pb.RangeRequest{Key: []byte("a"), Limit: -1}, false},
+		{&pb.RangeRequest{}, false},
+	}
+	for _, test := range tests {
+		if result := IsBatchableGet(test.r); result != test.expect {
+			t.Errorf("IsBatchableGet(%v) = %t, want %t", test.r, result, test.expect)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// ResponseHeader is the template for the header of every response from this
+// server. Its cluster and member IDs are computed once at startup (see
+// NewResponseHeader), so that all handlers report the same IDs.
+//
+// The zero value has zero IDs, like the headers of responses from netsy
+// versions which did not report them.
+type ResponseHeader struct {
+	clusterID uint64
+	memberID  uint64
+}
+
+// NewResponseHeader returns the header template for this server.
+// The member ID is derived from the instance ID. The cluster ID is derived
+// from the S3 bucket and key prefix, which are shared by all servers in a
+// cluster, or from the instance ID if S3 is disabled (as the server is then
+// the only member of its cluster).
+func NewResponseHeader(conf *config.Config) ResponseHeader {
+	cluster := "instance/" + conf.InstanceID()
+	if conf.S3Enabled() {
+		cluster = "s3://" + conf.S3BucketName() + "/" + conf.S3KeyPrefix()
+	}
+	return ResponseHeader{
+		clusterID: hashID(cluster),
+		memberID:  hashID(conf.InstanceID()),
+	}
+}
+
+// hashID returns the ID for name, which like etcd's IDs is the first 8 bytes
+// of a hash
+func hashID(name string) uint64 {
+	sum := sha256.Sum256([]byte(name))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// ClusterID returns the ID of the cluster this server is a member of
+func (h ResponseHeader) ClusterID() uint64 {
+	return h.clusterID
+}
+
+// MemberID returns the ID of this server
+func (h ResponseHeader) MemberID() uint64 {
+	return h.memberID
+}
+
+// At returns a new header for a response at revision. As netsy does not use
+// raft, the raft term is always 0.
+func (h ResponseHeader) At(revision int64) *pb.ResponseHeader {
+	return &pb.ResponseHeader{
+		ClusterId: h.clusterID,
+		MemberId:  h.memberID,
+		Revision:  revision,
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/spf13/viper"
+)
+
+func TestNewResponseHeader(t *testing.T) {
+	configtest.Restore(t, "instance_id", "s3_enabled")
+	header := func(instanceID string, s3Enabled bool) ResponseHeader {
+		viper.Set("instance_id", instanceID)
+		viper.Set("s3_enabled", s3Enabled)
+		return NewResponseHeader(&config.Config{})
+	}
+	configtest.Set(t, map[string]any{"s3_bucket_name": "bucket", "s3_key_prefix": "cluster-a"})
+
+	// servers sharing an S3 bucket and prefix are members of the same
+	// cluster, and the IDs are stable across restarts
+	a, b := header("a", true), header("b", true)
+	if a.ClusterID() == 0 || a.ClusterID() != b.ClusterID() {
+		t.Fatalf("expected servers to share a cluster ID, got %x and %x", a.ClusterID(), b.ClusterID())
+	}
+	if a.MemberID() == 0 || a.MemberID() == b.MemberID() {
+		t.Fatalf("expected servers to have distinct member IDs, got %x and %x", a.MemberID(), b.MemberID())
+	}
+	if restarted := header("a", true); restarted != a {
+		t.Fatalf("expected the same IDs after a restart, got %+v and %+v", a, restarted)
+	}
+
+	// without S3 each server is its own cluster
+	if standalone := header("b", false); standalone.ClusterID() == b.ClusterID() || standalone.MemberID() != b.MemberID() {
+		t.Fatalf("expected a standalone server to have its own cluster ID, got %+v", standalone)
+	}
+
+	h := a.At(7)
+	if h.ClusterId != a.ClusterID() || h.MemberId != a.MemberID() || h.Revision != 7 {
+		t.Fatalf("expected header at revision 7 with the server's IDs, got %+v", h)
+	}
+}
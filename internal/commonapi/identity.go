@@ -0,0 +1,41 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIdentity returns the common name of the TLS client certificate of
+// the client in ctx, or an empty string if it did not present one
+func ClientIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+		return tlsInfo.State.PeerCertificates[0].Subject.CommonName
+	}
+	return ""
+}
+
+// internalCallerKey is the context key of the internal caller of a request
+type internalCallerKey struct{}
+
+// WithInternalCaller returns a context for requests made by netsy itself
+// rather than a client, e.g. deleting the keys of an expired lease, where
+// caller names what made the request
+func WithInternalCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, internalCallerKey{}, caller)
+}
+
+// InternalCaller returns the internal caller of a request (see
+// WithInternalCaller), or an empty string for client requests
+func InternalCaller(ctx context.Context) string {
+	caller, _ := ctx.Value(internalCallerKey{}).(string)
+	return caller
+}
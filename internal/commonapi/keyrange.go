@@ -0,0 +1,45 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"bytes"
+)
+
+// zeroByte is the range_end which means all keys greater than or equal to key
+var zeroByte = []byte{0}
+
+// KeyInRange returns true if key is in the range specified by an etcd
+// key and range_end, using byte ordering as etcd does:
+//   - range_end empty: only key itself
+//   - range_end "\x00": all keys greater than or equal to key
+//   - otherwise: keys in [key, range_end), which includes prefixes (where
+//     range_end is key plus one) and single keys (where range_end is key
+//     plus a zero byte)
+func KeyInRange(key []byte, rangeKey []byte, rangeEnd []byte) bool {
+	switch {
+	case len(rangeEnd) == 0:
+		return bytes.Equal(key, rangeKey)
+	case bytes.Equal(rangeEnd, zeroByte):
+		return bytes.Compare(key, rangeKey) >= 0
+	default:
+		return bytes.Compare(key, rangeKey) >= 0 && bytes.Compare(key, rangeEnd) < 0
+	}
+}
+
+// keyRangeQuery returns the SQL WHERE criteria and args matching the same
+// keys as KeyInRange. Keys are stored as BLOBs and args are bound as BLOBs,
+// so SQLite compares them byte by byte (memcmp), matching bytes.Compare. LIKE
+// is deliberately not used, as it is case-insensitive and treats % and _ as
+// wildcards.
+func keyRangeQuery(rangeKey []byte, rangeEnd []byte) (where string, args []any) {
+	switch {
+	case len(rangeEnd) == 0:
+		return "key = ?", []any{rangeKey}
+	case bytes.Equal(rangeEnd, zeroByte):
+		return "key >= ?", []any{rangeKey}
+	default:
+		return "key >= ? AND key < ?", []any{rangeKey, rangeEnd}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/transform"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// testKeys are keys which differ only in case, contain LIKE wildcards, or
+// are not valid UTF-8, to catch comparisons which are not byte ordered
+var testKeys = [][]byte{
+	[]byte("/registry/pods/a"),
+	[]byte("/registry/pods/A"),
+	[]byte("/registry/pods/b"),
+	[]byte("/registry/pods/B"),
+	[]byte("/registry/pods/%"),
+	[]byte("/registry/pods/_"),
+	[]byte("/registry/pods/a%b"),
+	[]byte("/registry/pods/a_b"),
+	[]byte("/registry/pods/\x00"),
+	[]byte("/registry/pods/\xff"),
+	[]byte("/registry/pods/\xc3\x28"),
+	[]byte("/registry/pods0"),
+	[]byte("/registry/podS/a"),
+	[]byte("/registry/pods"),
+	[]byte("a"),
+	[]byte("A"),
+	[]byte("\x00"),
+	[]byte("\xff\xff"),
+}
+
+// newTestRangeDB returns a database containing testKeys
+func newTestRangeDB(t testing.TB) localdb.Database {
+	t.Helper()
+	db := localdbtest.New(t)
+	for i, key := range testKeys {
+		_, err := db.InsertRecord(&proto.Record{
+			Revision: int64(i + 1),
+			Key:      key,
+			Value:    key,
+			Created:  true,
+			LeaderId: "test",
+		}, nil)
+		if err != nil {
+			t.Fatalf("InsertRecord %q: %v", key, err)
+		}
+	}
+	return db
+}
+
+// referenceRange returns the keys in range using an in-memory implementation
+func referenceRange(rangeKey []byte, rangeEnd []byte, descending bool) [][]byte {
+	var keys [][]byte
+	for _, key := range testKeys {
+		if KeyInRange(key, rangeKey, rangeEnd) {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, bytes.Compare)
+	if descending {
+		slices.Reverse(keys)
+	}
+	return keys
+}
+
+func FuzzRange(f *testing.F) {
+	// prefix, single key, from key, and case/wildcard sensitive ranges
+	f.Add([]byte("/registry/pods/"), []byte("/registry/pods0"))
+	f.Add([]byte("/registry/pods/a"), []byte{})
+	f.Add([]byte("/registry/pods/A"), []byte{})
+	f.Add([]byte("/registry/pods/%"), []byte{})
+	f.Add([]byte("/registry/pods/a"), []byte("/registry/pods/a\x00"))
+	f.Add([]byte("/registry/pods/a"), []byte("/registry/pods/b"))
+	f.Add([]byte("/registry/pods/_"), []byte("/registry/pods/a"))
+	f.Add([]byte("/registry/pods/\xc3"), []byte("/registry/pods/\xc4"))
+	f.Add([]byte("A"), []byte("a"))
+	f.Add([]byte("a"), []byte("\x00"))
+	f.Add([]byte("\x00"), []byte("\x00"))
+
+	db := newTestRangeDB(f)
+	f.Fuzz(func(t *testing.T, rangeKey []byte, rangeEnd []byte) {
+		for _, sortOrder := range []pb.RangeRequest_SortOrder{pb.RangeRequest_ASCEND, pb.RangeRequest_DESCEND} {
+			resp, err := Range(db, ResponseHeader{}, transform.Chain{}, context.Background(), &pb.RangeRequest{
+				Key:       rangeKey,
+				RangeEnd:  rangeEnd,
+				SortOrder: sortOrder,
+			})
+			if err != nil {
+				t.Fatalf("Range(%q, %q): %v", rangeKey, rangeEnd, err)
+			}
+			var got [][]byte
+			for _, kv := range resp.Kvs {
+				got = append(got, kv.Key)
+			}
+			want := referenceRange(rangeKey, rangeEnd, sortOrder == pb.RangeRequest_DESCEND)
+			if !slices.EqualFunc(got, want, bytes.Equal) {
+				t.Errorf("Range(%q, %q, %s) = %q, want %q", rangeKey, rangeEnd, sortOrder, got, want)
+			}
+			if resp.Count != int64(len(want)) {
+				t.Errorf("Range(%q, %q, %s) count = %d, want %d", rangeKey, rangeEnd, sortOrder, resp.Count, len(want))
+			}
+		}
+	})
+}
@@ -4,10 +4,11 @@
 package commonapi
 
 import (
-	"bytes"
 	"context"
 
 	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/transform"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	mvccpb "go.etcd.io/etcd/api/v3/mvccpb"
 	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
@@ -15,22 +16,35 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func Range(db localdb.Database, ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
+// rangeChunkSize is the number of key-values Range allocates at a time
+const rangeChunkSize = 1024
+
+// sortTargets maps Range sort targets to the column records are sorted by.
+// As in etcd, records are sorted (in ascending order, unless descending is
+// requested) before the limit is applied, and records with equal values are
+// sorted by key.
+var sortTargets = map[pb.RangeRequest_SortTarget]string{
+	pb.RangeRequest_KEY:     localdb.SortByKey,
+	pb.RangeRequest_VERSION: localdb.SortByVersion,
+	pb.RangeRequest_CREATE:  localdb.SortByCreateRevision,
+	pb.RangeRequest_MOD:     localdb.SortByModRevision,
+	pb.RangeRequest_VALUE:   localdb.SortByValue,
+}
+
+func Range(db localdb.Database, header ResponseHeader, values transform.Chain, ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
 	// check if an unsupported option was specified
 	if r.KeysOnly {
-		return nil, status.Errorf(codes.Unimplemented, "keys_only not supported")
+		return nil, Unsupported("Range keys_only")
 	} else if r.MaxCreateRevision != 0 {
-		return nil, status.Errorf(codes.Unimplemented, "max_create_revision not supported")
+		return nil, Unsupported("Range max_create_revision")
 	} else if r.MaxModRevision != 0 {
-		return nil, status.Errorf(codes.Unimplemented, "max_mod_revision not supported")
+		return nil, Unsupported("Range max_mod_revision")
 	} else if r.MinModRevision != 0 {
-		return nil, status.Errorf(codes.Unimplemented, "min_mod_revision not supported")
+		return nil, Unsupported("Range min_mod_revision")
 	} else if r.MinCreateRevision != 0 {
-		return nil, status.Errorf(codes.Unimplemented, "min_create_revision not supported")
+		return nil, Unsupported("Range min_create_revision")
 	} else if r.Serializable {
-		return nil, status.Errorf(codes.Unimplemented, "serializable not supported")
-	} else if r.SortTarget != 0 {
-		return nil, status.Errorf(codes.Unimplemented, "sort_target not supported")
+		return nil, Unsupported("Range serializable")
 	}
 
 	// validate options
@@ -39,101 +53,94 @@ func Range(db localdb.Database, ctx context.Context, r *pb.RangeRequest) (*pb.Ra
 	}
 
 	// determine query where criteria and args
-	// TODO: similar to watch.Go isInRange, consider refactor
-	zeroByte := []byte{0}
-	keyAndZeroByte := append(r.Key, byte(0))
-	keyCopy := make([]byte, len(r.Key))
-	copy(keyCopy, r.Key)
-	rangeEndPrefixValue := append(
-		keyCopy[:len(keyCopy)-1],
-		keyCopy[len(keyCopy)-1]+1,
-	)
-	var queryWhere string
-	var queryArgs []any
-	if len(r.RangeEnd) == 0 || bytes.Equal(r.RangeEnd, keyAndZeroByte) {
-		// exact match
-		// key = r.Key
-		queryWhere = "key = ?"
-		queryArgs = []any{r.Key}
-	} else if bytes.Equal(r.Key, zeroByte) && bytes.Equal(r.RangeEnd, zeroByte) {
-		// both keys are zero bytes, return all keys
-		// no WHERE
-	} else if bytes.Equal(r.RangeEnd, zeroByte) {
-		// rangeEnd is zero bytes, get all keys greater than or equal to r.Key
-		// key > r.Key
-		queryWhere = "key >= ?" // TODO: verify > works as expected
-		queryArgs = []any{r.Key}
-	} else if bytes.Equal(r.RangeEnd, rangeEndPrefixValue) {
-		// get all keys matching prefix, where key is the prefix
-		// this is invoked by sending key+1 byte as rangeEnd
-		// per the docs:
-		// "If range_end is key plus one
-		// (e.g., “aa”+1 == “ab”, “a\xff”+1 == “b”),
-		// then the range represents all keys prefixed with key."
-		// key LIKE prefix%
-		queryWhere = "key LIKE ?" /// TODO: verify ? works as expected
-		queryArgs = []any{append(r.Key, byte(37))}
-	} else {
-		// range; get all keys from r.Key to less than r.RangeEnd
-		// key >= r.Key
-		// AND key < r.RangeEnd
-		queryWhere = "key >= ? AND key < ?" // TODO: verify >= and < works as expected
-		queryArgs = []any{r.Key, r.RangeEnd}
-	}
+	queryWhere, queryArgs := keyRangeQuery(r.Key, r.RangeEnd)
 
-	// determine sort order
+	// determine sort target and order
+	sortBy, ok := sortTargets[r.SortTarget]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown sort_target %d", r.SortTarget)
+	}
+	// transformed values are stored (and so sorted) encoded
+	if r.SortTarget == pb.RangeRequest_VALUE && values.Enabled() {
+		return nil, Unsupported("Range sort_target VALUE with value transformers")
+	}
 	order := "ASC"
 	if r.SortOrder == pb.RangeRequest_DESCEND {
 		order = "DESC"
 	}
 
-	// query data with count
-	var revision int64
-	kvs := []*mvccpb.KeyValue{}
-	rows, totalCount, maxRevision, err := db.FindRecordsBy(queryWhere, queryArgs, r.Revision, r.Limit, order)
-	if err != nil {
-		return nil, err
-	}
-
-	// determine if there are more results
-	more := totalCount > int64(len(rows))
-
+	// count only ranges (e.g. resource quota counts of a prefix) count the
+	// matching keys without reading their records
 	if r.CountOnly {
+		totalCount, maxRevision, err := db.CountRecordsBy(queryWhere, queryArgs, r.Revision)
+		if err != nil {
+			return nil, err
+		}
 		return &pb.RangeResponse{
-			Header: &pb.ResponseHeader{
-				Revision: maxRevision,
-			},
-			Count: totalCount,
-			More:  more,
+			Header: header.At(maxRevision),
+			Count:  totalCount,
+			More:   r.Limit > 0 && totalCount > r.Limit,
 		}, nil
 	}
 
-	// process results and return response
-	kvs = []*mvccpb.KeyValue{}
-	for _, row := range rows {
+	// read records through a cursor, so that only the response is held in
+	// memory rather than every record as well
+	cursor, err := db.CursorRecordsBy(queryWhere, queryArgs, r.Revision, r.Limit, sortBy, order)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+	n := cursor.Count
+	if r.Limit > 0 && r.Limit < n {
+		n = r.Limit
+	}
+
+	// process results and return response, allocating key-values in chunks
+	// rather than one at a time
+	kvs := make([]*mvccpb.KeyValue, 0, n)
+	var chunk []mvccpb.KeyValue
+	for {
+		row, err := cursor.Next()
+		if err != nil {
+			return nil, err
+		} else if row == nil {
+			break
+		}
 		if row.CompactedAt != nil {
 			return nil, rpctypes.ErrGRPCCompacted
 		}
-		if revision == 0 || revision < row.Revision {
-			revision = row.Revision
+		if len(chunk) == 0 {
+			chunk = make([]mvccpb.KeyValue, min(max(n-int64(len(kvs)), 1), rangeChunkSize))
 		}
-		kvs = append(kvs,
-			&mvccpb.KeyValue{
-				Key:            row.Key,
-				CreateRevision: row.CreateRevision,
-				ModRevision:    row.Revision,
-				Value:          row.Value,
-				Version:        row.Version,
-				Lease:          row.Lease,
-			},
-		)
+		kv := &chunk[0]
+		chunk = chunk[1:]
+		if err = recordKeyValue(kv, row, values); err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, kv)
 	}
 	return &pb.RangeResponse{
-		Header: &pb.ResponseHeader{
-			Revision: maxRevision,
-		},
-		Kvs:   kvs,
-		Count: totalCount,
-		More:  more,
+		Header: header.At(cursor.MaxRevision),
+		Kvs:    kvs,
+		Count:  cursor.Count,
+		More:   cursor.Count > int64(len(kvs)),
 	}, nil
 }
+
+// recordKeyValue sets kv to the etcd key-value of a record, decoding its
+// value
+func recordKeyValue(kv *mvccpb.KeyValue, record *proto.Record, values transform.Chain) error {
+	value, err := values.Decode(record.Key, record.Value)
+	if err != nil {
+		return status.Errorf(codes.DataLoss, "%s", err)
+	}
+	*kv = mvccpb.KeyValue{
+		Key:            record.Key,
+		CreateRevision: record.CreateRevision,
+		ModRevision:    record.Revision,
+		Value:          value,
+		Version:        record.Version,
+		Lease:          record.Lease,
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/transform"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRangeSortTarget(t *testing.T) {
+	db := newTestRangeDB(t)
+	// testKeys are inserted in order, so sorting by create or mod revision
+	// returns them in insertion order
+	for _, target := range []pb.RangeRequest_SortTarget{pb.RangeRequest_CREATE, pb.RangeRequest_MOD} {
+		resp, err := Range(db, ResponseHeader{}, transform.Chain{}, context.Background(), &pb.RangeRequest{
+			Key:        []byte{0},
+			RangeEnd:   []byte{0},
+			SortTarget: target,
+			SortOrder:  pb.RangeRequest_DESCEND,
+			Limit:      3,
+		})
+		if err != nil {
+			t.Fatalf("Range(%s): %v", target, err)
+		}
+		var got [][]byte
+		for _, kv := range resp.Kvs {
+			got = append(got, kv.Key)
+		}
+		want := slices.Clone(testKeys[len(testKeys)-3:])
+		slices.Reverse(want)
+		if !slices.EqualFunc(got, want, bytes.Equal) {
+			t.Errorf("Range(%s) = %q, want %q", target, got, want)
+		}
+		if resp.Count != int64(len(testKeys)) || !resp.More {
+			t.Errorf("Range(%s) count = %d more = %t, want %d true", target, resp.Count, resp.More, len(testKeys))
+		}
+	}
+
+	_, err := Range(db, ResponseHeader{}, transform.Chain{}, context.Background(), &pb.RangeRequest{Key: []byte("a"), SortTarget: 100})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for unknown sort target, got %v", err)
+	}
+}
+
+func TestRangeLarge(t *testing.T) {
+	db := localdbtest.New(t)
+	// more keys than fit in a chunk of key-values
+	n := rangeChunkSize*2 + 10
+	for i := range n {
+		key := []byte(fmt.Sprintf("key-%05d", i))
+		if _, err := db.InsertRecord(&proto.Record{Revision: int64(i + 1), Key: key, Value: key, Created: true, LeaderId: "test"}, nil); err != nil {
+			t.Fatalf("InsertRecord %s: %v", key, err)
+		}
+	}
+	for _, limit := range []int64{0, rangeChunkSize + 1, int64(n) + 1} {
+		resp, err := Range(db, ResponseHeader{}, transform.Chain{}, context.Background(), &pb.RangeRequest{
+			Key:      []byte("key-"),
+			RangeEnd: []byte("key."),
+			Limit:    limit,
+		})
+		if err != nil {
+			t.Fatalf("Range(limit %d): %v", limit, err)
+		}
+		expected := n
+		if limit > 0 && limit < int64(n) {
+			expected = int(limit)
+		}
+		if len(resp.Kvs) != expected || resp.Count != int64(n) || resp.More != (expected < n) {
+			t.Fatalf("Range(limit %d) returned %d keys, count %d, more %t", limit, len(resp.Kvs), resp.Count, resp.More)
+		}
+		for i, kv := range resp.Kvs {
+			if key := fmt.Sprintf("key-%05d", i); string(kv.Key) != key || string(kv.Value) != key || kv.ModRevision != int64(i+1) {
+				t.Fatalf("Range(limit %d) returned %s at revision %d at %d, expected %s", limit, kv.Key, kv.ModRevision, i, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/transform"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	mvccpb "go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// IsReadOnlyTxn returns true if the success and failure branches of a
+// transaction only contain range operations, so it can be executed without
+// writing a record
+func IsReadOnlyTxn(r *pb.TxnRequest) bool {
+	for _, ops := range [][]*pb.RequestOp{r.Success, r.Failure} {
+		for _, op := range ops {
+			if op.GetRequestRange() == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ReadOnlyTxn executes a read-only transaction (see IsReadOnlyTxn). The
+// compares and ranges which do not specify a revision are evaluated at the
+// latest revision when the transaction started, so they see a consistent
+// view even if records are written concurrently.
+func ReadOnlyTxn(db localdb.Database, header ResponseHeader, values transform.Chain, ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	revision, err := db.LatestRevision()
+	if err != nil {
+		return nil, err
+	}
+
+	succeeded := true
+	for _, compare := range r.Compare {
+		ok, err := applyCompare(db, values, ctx, compare, revision)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			succeeded = false
+			break
+		}
+	}
+	ops := r.Success
+	if !succeeded {
+		ops = r.Failure
+	}
+
+	// gets of exact keys at the transaction's revision, e.g. from clients
+	// which batch gets of individual objects, are looked up together
+	var batchIndexes []int
+	var batchKeys [][]byte
+	for i, op := range ops {
+		rangeReq := op.GetRequestRange()
+		if IsBatchableGet(rangeReq) && (rangeReq.Revision == 0 || rangeReq.Revision == revision) {
+			batchIndexes = append(batchIndexes, i)
+			batchKeys = append(batchKeys, rangeReq.Key)
+		}
+	}
+	batched := map[int]*pb.RangeResponse{}
+	if len(batchKeys) > 1 {
+		batchResps, err := BatchGet(db, header, values, ctx, batchKeys, revision)
+		if err != nil {
+			return nil, err
+		}
+		for i, index := range batchIndexes {
+			batched[index] = batchResps[i]
+		}
+	}
+
+	responses := make([]*pb.ResponseOp, 0, len(ops))
+	for i, op := range ops {
+		if rangeResp, ok := batched[i]; ok {
+			responses = append(responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponseRange{
+					ResponseRange: rangeResp,
+				},
+			})
+			continue
+		}
+		rangeReq := op.GetRequestRange()
+		if rangeReq.Revision == 0 {
+			rangeReq = &pb.RangeRequest{
+				Key:       rangeReq.Key,
+				RangeEnd:  rangeReq.RangeEnd,
+				Limit:     rangeReq.Limit,
+				Revision:  revision,
+				SortOrder: rangeReq.SortOrder,
+				CountOnly: rangeReq.CountOnly,
+				// unsupported options are passed through so Range rejects them
+				SortTarget:        rangeReq.SortTarget,
+				Serializable:      rangeReq.Serializable,
+				KeysOnly:          rangeReq.KeysOnly,
+				MinModRevision:    rangeReq.MinModRevision,
+				MaxModRevision:    rangeReq.MaxModRevision,
+				MinCreateRevision: rangeReq.MinCreateRevision,
+				MaxCreateRevision: rangeReq.MaxCreateRevision,
+			}
+		}
+		rangeResp, err := Range(db, header, values, ctx, rangeReq)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, &pb.ResponseOp{
+			Response: &pb.ResponseOp_ResponseRange{
+				ResponseRange: rangeResp,
+			},
+		})
+	}
+
+	return &pb.TxnResponse{
+		Header:    header.At(revision),
+		Succeeded: succeeded,
+		Responses: responses,
+	}, nil
+}
+
+// applyCompare returns true if all keys in the compare's range satisfy it
+// at the given revision. As with etcd, a compare against a single key
+// which does not exist compares against zero values, except for value
+// compares which fail.
+func applyCompare(db localdb.Database, values transform.Chain, ctx context.Context, c *pb.Compare, revision int64) (bool, error) {
+	rangeResp, err := Range(db, ResponseHeader{}, values, ctx, &pb.RangeRequest{
+		Key:      c.Key,
+		RangeEnd: c.RangeEnd,
+		Revision: revision,
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(rangeResp.Kvs) == 0 {
+		if c.Target == pb.Compare_VALUE {
+			return false, nil
+		}
+		return compareKV(c, &mvccpb.KeyValue{}), nil
+	}
+	for _, kv := range rangeResp.Kvs {
+		if !compareKV(c, kv) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compareKV returns true if kv satisfies the compare
+func compareKV(c *pb.Compare, kv *mvccpb.KeyValue) bool {
+	var result int
+	switch c.Target {
+	case pb.Compare_VALUE:
+		result = bytes.Compare(kv.Value, c.GetValue())
+	case pb.Compare_VERSION:
+		result = cmp.Compare(kv.Version, c.GetVersion())
+	case pb.Compare_CREATE:
+		result = cmp.Compare(kv.CreateRevision, c.GetCreateRevision())
+	case pb.Compare_MOD:
+		result = cmp.Compare(kv.ModRevision, c.GetModRevision())
+	case pb.Compare_LEASE:
+		result = cmp.Compare(kv.Lease, c.GetLease())
+	}
+	switch c.Result {
+	case pb.Compare_EQUAL:
+		return result == 0
+	case pb.Compare_NOT_EQUAL:
+		return result != 0
+	case pb.Compare_GREATER:
+		return result > 0
+	case pb.Compare_LESS:
+		return result < 0
+	}
+	return false
+}
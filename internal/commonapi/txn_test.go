@@ -0,0 +1,82 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/transform"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+func TestReadOnlyTxn(t *testing.T) {
+	db := newTestRangeDB(t)
+	latestRevision := int64(len(testKeys))
+	// "a" is inserted at revision 15
+	rangeOp := func(key string) *pb.RequestOp {
+		return &pb.RequestOp{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte(key)}}}
+	}
+	tests := []struct {
+		name      string
+		compare   *pb.Compare
+		succeeded bool
+	}{
+		{"mod equal", &pb.Compare{Key: []byte("a"), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 15}}, true},
+		{"mod not equal", &pb.Compare{Key: []byte("a"), Target: pb.Compare_MOD, Result: pb.Compare_NOT_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 15}}, false},
+		{"version greater", &pb.Compare{Key: []byte("a"), Target: pb.Compare_VERSION, Result: pb.Compare_GREATER, TargetUnion: &pb.Compare_Version{Version: 0}}, true},
+		{"value equal", &pb.Compare{Key: []byte("a"), Target: pb.Compare_VALUE, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_Value{Value: []byte("a")}}, true},
+		{"missing key create", &pb.Compare{Key: []byte("missing"), Target: pb.Compare_CREATE, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_CreateRevision{CreateRevision: 0}}, true},
+		{"missing key value", &pb.Compare{Key: []byte("missing"), Target: pb.Compare_VALUE, Result: pb.Compare_NOT_EQUAL, TargetUnion: &pb.Compare_Value{Value: []byte("a")}}, false},
+		{"range all less", &pb.Compare{Key: []byte("/registry/pods/"), RangeEnd: []byte("/registry/pods0"), Target: pb.Compare_MOD, Result: pb.Compare_LESS, TargetUnion: &pb.Compare_ModRevision{ModRevision: 12}}, true},
+		{"range not all less", &pb.Compare{Key: []byte("/registry/pods/"), RangeEnd: []byte("/registry/pods0"), Target: pb.Compare_MOD, Result: pb.Compare_LESS, TargetUnion: &pb.Compare_ModRevision{ModRevision: 11}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &pb.TxnRequest{
+				Compare: []*pb.Compare{tt.compare},
+				Success: []*pb.RequestOp{rangeOp("a")},
+				Failure: []*pb.RequestOp{rangeOp("A"), rangeOp("missing")},
+			}
+			if !IsReadOnlyTxn(r) {
+				t.Fatalf("expected read-only transaction")
+			}
+			resp, err := ReadOnlyTxn(db, ResponseHeader{}, transform.Chain{}, context.Background(), r)
+			if err != nil {
+				t.Fatalf("ReadOnlyTxn: %v", err)
+			}
+			if resp.Succeeded != tt.succeeded {
+				t.Fatalf("expected succeeded=%v", tt.succeeded)
+			}
+			if resp.Header.Revision != latestRevision {
+				t.Fatalf("expected header revision %d, got %d", latestRevision, resp.Header.Revision)
+			}
+			expectedOps := 1
+			if !tt.succeeded {
+				expectedOps = 2
+			}
+			if len(resp.Responses) != expectedOps {
+				t.Fatalf("expected %d responses, got %d", expectedOps, len(resp.Responses))
+			}
+			kvs := resp.Responses[0].GetResponseRange().Kvs
+			if len(kvs) != 1 {
+				t.Fatalf("expected 1 kv, got %d", len(kvs))
+			}
+		})
+	}
+}
+
+func TestIsReadOnlyTxn(t *testing.T) {
+	put := &pb.RequestOp{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("a")}}}
+	get := &pb.RequestOp{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte("a")}}}
+	if !IsReadOnlyTxn(&pb.TxnRequest{Success: []*pb.RequestOp{get}, Failure: []*pb.RequestOp{get}}) {
+		t.Errorf("expected ranges only to be read-only")
+	}
+	if IsReadOnlyTxn(&pb.TxnRequest{Success: []*pb.RequestOp{put}, Failure: []*pb.RequestOp{get}}) {
+		t.Errorf("expected put in success to not be read-only")
+	}
+	if IsReadOnlyTxn(&pb.TxnRequest{Success: []*pb.RequestOp{get}, Failure: []*pb.RequestOp{put}}) {
+		t.Errorf("expected put in failure to not be read-only")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"errors"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrUnsupported is wrapped by the errors of requests which use an etcd
+// feature netsy does not implement, as netsy implements the subset of the
+// etcd API used by Kubernetes
+var ErrUnsupported = errors.New("unsupported etcd feature")
+
+// unsupportedReason is the reason of the ErrorInfo detail of unsupported
+// feature errors, which clients can match on
+const unsupportedReason = "UNSUPPORTED_FEATURE"
+
+// UnsupportedError is the error of a request which uses an etcd feature
+// netsy does not implement. It is returned to clients as Unimplemented,
+// with an ErrorInfo detail whose metadata has the feature.
+type UnsupportedError struct {
+	// Feature identifies the exact feature, e.g. "Compare target VERSION"
+	Feature string
+}
+
+// Unsupported returns the error for a request which uses feature, counting
+// it so that compatibility gaps are measurable. Functions which validate
+// requests without serving them (e.g. peerapi.ParseTxnRequest) return an
+// UnsupportedError instead, which is counted by CountUnsupported.
+func Unsupported(feature string) error {
+	err := &UnsupportedError{Feature: feature}
+	CountUnsupported(err)
+	return err
+}
+
+// CountUnsupported counts err if it is an UnsupportedError, for requests
+// rejected after being validated
+func CountUnsupported(err error) {
+	var unsupported *UnsupportedError
+	if errors.As(err, &unsupported) {
+		metrics.RequestsUnsupported.WithLabelValues(unsupported.Feature).Inc()
+	}
+}
+
+func (e *UnsupportedError) Error() string {
+	return ErrUnsupported.Error() + ": " + e.Feature
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return ErrUnsupported
+}
+
+// GRPCStatus returns the Unimplemented status sent to clients
+func (e *UnsupportedError) GRPCStatus() *status.Status {
+	s := status.New(codes.Unimplemented, e.Error())
+	detailed, err := s.WithDetails(&errdetails.ErrorInfo{
+		Reason:   unsupportedReason,
+		Domain:   "netsy",
+		Metadata: map[string]string{"feature": e.Feature},
+	})
+	if err != nil {
+		return s
+	}
+	return detailed
+}
@@ -0,0 +1,50 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package commonapi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnsupported(t *testing.T) {
+	err := fmt.Errorf("error parsing request: %w", Unsupported("Compare target VERSION"))
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected error to wrap ErrUnsupported, got %v", err)
+	}
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented status, got %v", s)
+	}
+	details := s.Details()
+	if len(details) != 1 {
+		t.Fatalf("expected 1 detail, got %v", details)
+	}
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	if !ok || info.Reason != unsupportedReason || info.Metadata["feature"] != "Compare target VERSION" {
+		t.Fatalf("expected ErrorInfo with feature, got %v", details[0])
+	}
+}
+
+func TestCountUnsupported(t *testing.T) {
+	counter := metrics.RequestsUnsupported.WithLabelValues("Compare target LEASE")
+	before := testutil.ToFloat64(counter)
+	// validation errors are only counted once the request is rejected
+	err := fmt.Errorf("error parsing request: %w", &UnsupportedError{Feature: "Compare target LEASE"})
+	if got := testutil.ToFloat64(counter) - before; got != 0 {
+		t.Fatalf("expected no count before CountUnsupported, got %v", got)
+	}
+	CountUnsupported(err)
+	CountUnsupported(errors.New("other error"))
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("expected 1 count, got %v", got)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package compaction periodically compacts the history of keys outside of a
+// retention window, either a period of time or a number of revisions as
+// with etcd's --auto-compaction-mode, so that the values of superseded
+// revisions do not accumulate when no client (such as kube-apiserver)
+// requests compactions.
+// As with compactions requested by clients, compacted records keep their
+// revisions, with their values emptied and compacted_at set.
+package compaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/peerapi"
+)
+
+// CompactFunc compacts the history up to revision, returning the number of
+// records compacted, e.g. ClientAPIServer.CompactTo
+type CompactFunc func(ctx context.Context, revision int64) (compacted int64, err error)
+
+// Worker periodically compacts revisions outside of the retention window
+type Worker struct {
+	logger  log.Logger
+	config  *config.Config
+	db      localdb.Database
+	compact CompactFunc
+	now     func() time.Time
+
+	// Context for shutdown, cancelled by Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks the worker goroutine
+	wg sync.WaitGroup
+}
+
+// NewWorker creates a new compaction worker
+func NewWorker(logger log.Logger, config *config.Config, db localdb.Database, compact CompactFunc) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{
+		logger:  logger,
+		config:  config,
+		db:      db,
+		compact: compact,
+		now:     time.Now,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// revisionModeInterval is the interval between compactions in revision
+// mode, unless configured, as in etcd
+const revisionModeInterval = 5 * time.Minute
+
+// retention is the history kept by periodic compactions, as configured by
+// compaction_mode and compaction_retention
+type retention struct {
+	// period of history kept in periodic mode
+	period time.Duration
+	// revisions kept in revision mode
+	revisions int64
+}
+
+// String returns the retention for logging
+func (r retention) String() string {
+	if r.revisions > 0 {
+		return fmt.Sprintf("%d revisions", r.revisions)
+	}
+	return r.period.String()
+}
+
+// interval returns the interval between compactions derived from the
+// retention as in etcd: every retention period up to an hour in periodic
+// mode, and every 5 minutes in revision mode
+func (r retention) interval() time.Duration {
+	if r.revisions > 0 {
+		return revisionModeInterval
+	}
+	return min(r.period, time.Hour)
+}
+
+// Start begins the compaction worker goroutine, unless it is disabled
+func (w *Worker) Start() {
+	var r retention
+	r.period, r.revisions = w.config.CompactionRetention()
+	if r.period <= 0 && r.revisions <= 0 {
+		level.Info(w.logger).Log("msg", "periodic compaction disabled")
+		return
+	}
+	interval := time.Duration(w.config.CompactionIntervalMinutes()) * time.Minute
+	if interval <= 0 {
+		interval = r.interval()
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run(interval, r)
+	}()
+}
+
+// Stop shuts down the compaction worker, waiting for an in-flight
+// compaction to complete
+func (w *Worker) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+// run is the main worker loop
+func (w *Worker) run(interval time.Duration, r retention) {
+	level.Info(w.logger).Log("msg", "compaction worker started", "mode", w.config.CompactionMode(), "interval", interval, "retention", r)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			level.Info(w.logger).Log("msg", "compaction worker stopping")
+			return
+		case <-ticker.C:
+			w.compactOnce(r)
+		}
+	}
+}
+
+// retainedRevision returns the latest revision outside of the retention:
+// the latest created before the retention period in periodic mode, or
+// the latest revision less the retained revisions in revision mode
+func (w *Worker) retainedRevision(r retention) (int64, error) {
+	if r.revisions > 0 {
+		latest, err := w.db.LatestRevision()
+		if err != nil {
+			return 0, err
+		}
+		return latest - r.revisions, nil
+	}
+	return w.db.RevisionCreatedBefore(w.now().Add(-r.period))
+}
+
+// compactOnce compacts the history up to the latest revision outside of
+// the retention, unless it has already been compacted
+func (w *Worker) compactOnce(r retention) {
+	revision, err := w.retainedRevision(r)
+	if err != nil {
+		metrics.CompactionRuns.WithLabelValues("error").Inc()
+		level.Error(w.logger).Log("msg", "failed to find revision to compact to", "error", err)
+		return
+	}
+	compactRevision, err := w.db.CompactRevision()
+	if err != nil {
+		metrics.CompactionRuns.WithLabelValues("error").Inc()
+		level.Error(w.logger).Log("msg", "failed to get compact revision", "error", err)
+		return
+	}
+	if revision <= compactRevision {
+		metrics.CompactionRuns.WithLabelValues("skipped").Inc()
+		level.Debug(w.logger).Log("msg", "no revisions to compact", "revision", revision, "compact_revision", compactRevision)
+		return
+	}
+
+	level.Info(w.logger).Log("msg", "starting periodic compaction", "from_revision", compactRevision, "to_revision", revision, "retention", r)
+	start := w.now()
+	compacted, err := w.compact(w.ctx, revision)
+	if errors.Is(err, peerapi.ErrCompacted) {
+		// a client compacted further in the meantime
+		metrics.CompactionRuns.WithLabelValues("skipped").Inc()
+		level.Debug(w.logger).Log("msg", "periodic compaction skipped", "revision", revision, "error", err)
+		return
+	} else if err != nil {
+		metrics.CompactionRuns.WithLabelValues("error").Inc()
+		level.Error(w.logger).Log("msg", "periodic compaction failed", "revision", revision, "error", err)
+		return
+	}
+	duration := w.now().Sub(start)
+	metrics.CompactionRuns.WithLabelValues("compacted").Inc()
+	metrics.CompactionRecords.Add(float64(compacted))
+	metrics.CompactionRevision.Set(float64(revision))
+	metrics.CompactionDuration.Observe(duration.Seconds())
+	level.Info(w.logger).Log("msg", "periodic compaction completed", "revision", revision, "compacted_records", compacted, "duration", duration)
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package compaction
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/peerapi"
+)
+
+// fakeDB finds the revision created before a time from created, and
+// records the latest and compact revisions
+type fakeDB struct {
+	localdb.Database
+	created         map[int64]time.Time
+	latestRevision  int64
+	compactRevision int64
+}
+
+func (db *fakeDB) RevisionCreatedBefore(t time.Time) (revision int64, err error) {
+	for rev, createdAt := range db.created {
+		if !createdAt.After(t) && rev > revision {
+			revision = rev
+		}
+	}
+	return revision, nil
+}
+
+func (db *fakeDB) LatestRevision() (int64, error) {
+	return db.latestRevision, nil
+}
+
+func (db *fakeDB) CompactRevision() (int64, error) {
+	return db.compactRevision, nil
+}
+
+func TestCompactOnce(t *testing.T) {
+	now := time.Now()
+	db := &fakeDB{created: map[int64]time.Time{
+		1: now.Add(-3 * time.Hour),
+		2: now.Add(-2 * time.Hour),
+		3: now.Add(-30 * time.Minute),
+	}}
+	var compactedTo []int64
+	var compactErr error
+	w := NewWorker(log.NewNopLogger(), &config.Config{}, db, func(ctx context.Context, revision int64) (int64, error) {
+		if compactErr != nil {
+			return 0, compactErr
+		}
+		compactedTo = append(compactedTo, revision)
+		db.compactRevision = revision
+		return 1, nil
+	})
+	w.now = func() time.Time {
+		return now
+	}
+
+	// revisions 1 and 2 are older than the retention window
+	w.compactOnce(retention{period: time.Hour})
+	// already compacted to revision 2
+	w.compactOnce(retention{period: time.Hour})
+	// nothing is older than the retention window
+	w.compactOnce(retention{period: 4 * time.Hour})
+	// a client compacted further in the meantime
+	db.compactRevision = 1
+	compactErr = fmt.Errorf("%w: revision 2", peerapi.ErrCompacted)
+	w.compactOnce(retention{period: time.Hour})
+	compactErr = nil
+	// revision 3 is now older than the retention window
+	w.compactOnce(retention{period: 10 * time.Minute})
+
+	if fmt.Sprint(compactedTo) != "[2 3]" {
+		t.Errorf("expected compactions to revisions [2 3], got %v", compactedTo)
+	}
+}
+
+func TestCompactOnceRevisionMode(t *testing.T) {
+	db := &fakeDB{latestRevision: 5}
+	var compactedTo []int64
+	w := NewWorker(log.NewNopLogger(), &config.Config{}, db, func(ctx context.Context, revision int64) (int64, error) {
+		compactedTo = append(compactedTo, revision)
+		db.compactRevision = revision
+		return 1, nil
+	})
+
+	// fewer revisions than are retained
+	w.compactOnce(retention{revisions: 10})
+	// the latest 3 revisions are retained
+	w.compactOnce(retention{revisions: 3})
+	// already compacted to revision 2
+	w.compactOnce(retention{revisions: 3})
+	db.latestRevision = 9
+	w.compactOnce(retention{revisions: 3})
+
+	if fmt.Sprint(compactedTo) != "[2 6]" {
+		t.Errorf("expected compactions to revisions [2 6], got %v", compactedTo)
+	}
+}
+
+func TestRetentionInterval(t *testing.T) {
+	for _, tc := range []struct {
+		retention retention
+		interval  time.Duration
+	}{
+		{retention{period: 30 * time.Minute}, 30 * time.Minute},
+		{retention{period: 10 * time.Hour}, time.Hour},
+		{retention{revisions: 1000}, revisionModeInterval},
+	} {
+		if interval := tc.retention.interval(); interval != tc.interval {
+			t.Errorf("%s: expected interval %v, got %v", tc.retention, tc.interval, interval)
+		}
+	}
+}
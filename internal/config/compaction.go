@@ -0,0 +1,43 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// parseCompactionRetention parses compaction_retention as etcd parses
+// --auto-compaction-retention: in periodic mode, a duration or a whole
+// number of hours, and in revision mode, a number of revisions
+func parseCompactionRetention(mode, retention string) (period time.Duration, revisions int64, err error) {
+	if mode == "revision" {
+		revisions, err = strconv.ParseInt(retention, 10, 64)
+		if err != nil || revisions < 0 {
+			return 0, 0, fmt.Errorf("invalid compaction retention %q, expected a number of revisions", retention)
+		}
+		return 0, revisions, nil
+	}
+	if hours, err := strconv.ParseInt(retention, 10, 64); err == nil {
+		period = time.Duration(hours) * time.Hour
+	} else if period, err = time.ParseDuration(retention); err != nil {
+		return 0, 0, fmt.Errorf("invalid compaction retention %q, expected a duration or a number of hours", retention)
+	}
+	if period < 0 {
+		return 0, 0, fmt.Errorf("invalid compaction retention %q, expected a positive duration", retention)
+	}
+	return period, 0, nil
+}
+
+// validateCompactionRetention checks compaction_retention parses in the
+// configured compaction_mode
+func validateCompactionRetention(sl validator.StructLevel) {
+	config := sl.Current().Interface().(runtimeConfig)
+	if _, _, err := parseCompactionRetention(config.CompactionMode, config.CompactionRetention); err != nil {
+		sl.ReportError(config.CompactionRetention, "CompactionRetention", "CompactionRetention", "compaction_retention", "")
+	}
+}
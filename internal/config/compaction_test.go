@@ -0,0 +1,38 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCompactionRetention(t *testing.T) {
+	for _, tc := range []struct {
+		mode      string
+		retention string
+		period    time.Duration
+		revisions int64
+		valid     bool
+	}{
+		{"periodic", "0", 0, 0, true},
+		{"periodic", "2", 2 * time.Hour, 0, true},
+		{"periodic", "30m", 30 * time.Minute, 0, true},
+		{"periodic", "1h30m", 90 * time.Minute, 0, true},
+		{"periodic", "-1h", 0, 0, false},
+		{"periodic", "soon", 0, 0, false},
+		{"revision", "0", 0, 0, true},
+		{"revision", "1000", 0, 1000, true},
+		{"revision", "30m", 0, 0, false},
+		{"revision", "-1", 0, 0, false},
+	} {
+		period, revisions, err := parseCompactionRetention(tc.mode, tc.retention)
+		if (err == nil) != tc.valid {
+			t.Errorf("%s %q: expected valid %v, got error %v", tc.mode, tc.retention, tc.valid, err)
+		}
+		if period != tc.period || revisions != tc.revisions {
+			t.Errorf("%s %q: expected %v and %d revisions, got %v and %d revisions", tc.mode, tc.retention, tc.period, tc.revisions, period, revisions)
+		}
+	}
+}
@@ -4,16 +4,18 @@
 package config
 
 import (
-	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-kit/log"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 // Config provides getters/setters for working with the config
 type Config struct {
 	logger log.Logger
+	flags  *pflag.FlagSet
 }
 
 // Init initializes the Config struct
@@ -22,43 +24,154 @@ func Init(logger log.Logger) (*Config, error) {
 	return c, nil
 }
 
+// SetFlags sets the command line flags bound to config variables, so that
+// Settings can report which were set by a flag
+func (c *Config) SetFlags(flags *pflag.FlagSet) {
+	c.flags = flags
+}
+
 // runtimeConfig defines the config variables, validation, and viper config
 // TODO: add path to leaders list file
 type runtimeConfig struct {
-	Environment       string `viper:"environment" envkey:"ENVIRONMENT" default:"development" description:"Environment (development|production|[string])"`
-	InstanceID        string `viper:"instance_id" validate:"puidv7" envkey:"INSTANCE_ID" default:"" description:"Random puidv7 of this instance"`
-	InstanceHostname  string `viper:"instance_hostname" validate:"hostname" envkey:"INSTANCE_HOSTNAME" default:"" description:"Hostname of this instance"`
-	Verbose           bool   `viper:"verbose" envkey:"NETSY_DEBUG" default:"false" description:"Enable verbose output"`
-	ListenClientsAddr string `viper:"listen_clients_addr" envkey:"NETSY_LISTEN_CLIENTS_ADDR" default:":2378" description:"Address of etcd-compatible API server for client requests"`
-	ListenPeersAddr   string `viper:"listen_peers_addr" envkey:"NETSY_LISTEN_PEERS_ADDR" default:":2381" description:"Address for other netsy servers to connect to"`
-	TLSServerCA       string `viper:"tls_server_ca" envkey:"NETSY_TLS_SERVER_CA" default:"" description:"Path to file containing the CA x509 certificate used when serving connections on the server listen address"`
-	TLSServerCert     string `viper:"tls_server_cert" envkey:"NETSY_TLS_SERVER_CERT" default:"" description:"Path to file containing the x509 certificate used when serving connections on the server listen address"`
-	TLSServerKey      string `viper:"tls_server_key" envkey:"NETSY_TLS_SERVER_KEY" default:"" description:"Path to file containing the Ed25519 private key used when serving connections on the server listen address"`
-	TLSClientCA       string `viper:"tls_client_ca" envkey:"NETSY_TLS_CLIENT_CA" default:"" description:"Path to file containing the CA x509 certificate used when connecting to peer netsy servers"`
-	TLSClientCert     string `viper:"tls_client_cert" envkey:"NETSY_TLS_CLIENT_CERT" default:"" description:"Path to file containing the x509 certificate used when connecting to peer netsy servers"`
-	TLSClientKey      string `viper:"tls_client_key" envkey:"NETSY_TLS_CLIENT_KEY" default:"" description:"Path to file containing the Ed25519 private key used when connecting to peer netsy servers"`
-	DataDir           string `viper:"data_dir" validate:"omitempty,dirpath" envkey:"NETSY_DATA_DIR" default:"/opt/data" description:"(Optional) Path to directory for data"`
+	Environment           string `viper:"environment" envkey:"ENVIRONMENT" default:"development" description:"Environment (development|production|[string])"`
+	InstanceID            string `viper:"instance_id" validate:"puidv7" envkey:"INSTANCE_ID" default:"" description:"Random puidv7 of this instance"`
+	InstanceHostname      string `viper:"instance_hostname" validate:"hostname" envkey:"INSTANCE_HOSTNAME" default:"" description:"Hostname of this instance"`
+	Verbose               bool   `viper:"verbose" envkey:"NETSY_DEBUG" default:"false" description:"Enable verbose output"`
+	ListenClientsAddr     string `viper:"listen_clients_addr" envkey:"NETSY_LISTEN_CLIENTS_ADDR" default:":2378" description:"Address of etcd-compatible API server for client requests"`
+	ListenClientsEarly    bool   `viper:"listen_clients_early" envkey:"NETSY_LISTEN_CLIENTS_EARLY" default:"false" description:"Start the client API listener before backfill, failing requests with Unavailable (and reporting NOT_SERVING health) until ready"`
+	ListenPeersAddr       string `viper:"listen_peers_addr" envkey:"NETSY_LISTEN_PEERS_ADDR" default:":2381" description:"Address for other netsy servers to connect to"`
+	ListenMetricsAddr     string `viper:"listen_metrics_addr" envkey:"NETSY_LISTEN_METRICS_ADDR" default:"127.0.0.1:2382" description:"Address of HTTP server for Prometheus metrics (empty = disabled)"`
+	ListenHealthAddr      string `viper:"listen_health_addr" envkey:"NETSY_LISTEN_HEALTH_ADDR" default:"" description:"Address of a plaintext gRPC server serving only the gRPC health service, e.g. for Kubernetes grpc probes, which do not support TLS (empty = disabled)"`
+	TLSServerCA           string `viper:"tls_server_ca" envkey:"NETSY_TLS_SERVER_CA" default:"" path:"true" description:"Path to file containing the CA x509 certificate used when serving connections on the server listen address"`
+	TLSServerCert         string `viper:"tls_server_cert" envkey:"NETSY_TLS_SERVER_CERT" default:"" path:"true" description:"Path to file containing the x509 certificate used when serving connections on the server listen address"`
+	TLSServerKey          string `viper:"tls_server_key" envkey:"NETSY_TLS_SERVER_KEY" default:"" path:"true" description:"Path to file containing the Ed25519 private key used when serving connections on the server listen address"`
+	TLSClientCA           string `viper:"tls_client_ca" envkey:"NETSY_TLS_CLIENT_CA" default:"" path:"true" description:"Path to file containing the CA x509 certificate used when connecting to peer netsy servers"`
+	TLSClientCert         string `viper:"tls_client_cert" envkey:"NETSY_TLS_CLIENT_CERT" default:"" path:"true" description:"Path to file containing the x509 certificate used when connecting to peer netsy servers"`
+	TLSClientKey          string `viper:"tls_client_key" envkey:"NETSY_TLS_CLIENT_KEY" default:"" path:"true" description:"Path to file containing the Ed25519 private key used when connecting to peer netsy servers"`
+	DataDir               string `viper:"data_dir" validate:"omitempty,dirpath" envkey:"NETSY_DATA_DIR" default:"" path:"true" description:"(Optional) Path to directory for data. Defaults to /opt/data on Linux, otherwise netsy/data in the user's config directory (e.g. ~/Library/Application Support on macOS, %AppData% on Windows)"`
+	EtcdVersion           string `viper:"etcd_version" validate:"oneof=3.4 3.5" envkey:"NETSY_ETCD_VERSION" default:"3.5" description:"etcd minor version to emulate for version-specific client behaviour (3.4|3.5)"`
+	DBMaxReadConns        int64  `viper:"db_max_read_conns" envkey:"NETSY_DB_MAX_READ_CONNS" default:"8" description:"Maximum number of concurrent read connections to the local database"`
+	DBIntegrityCheck      string `viper:"db_integrity_check" validate:"oneof=quick full off" envkey:"NETSY_DB_INTEGRITY_CHECK" default:"quick" description:"Check the local database for corruption at startup (quick|full|off)"`
+	DBRebuildOnCorruption bool   `viper:"db_rebuild_on_corruption" envkey:"NETSY_DB_REBUILD_ON_CORRUPTION" default:"false" description:"Move a corrupt local database aside and rebuild it from S3 snapshots and chunks at startup (requires S3)"`
 	// S3 Configuration
-	S3Enabled         bool   `viper:"s3_enabled" envkey:"NETSY_S3_ENABLED" default:"true" description:"Enable S3 storage backend (default = true)"`
-	S3BucketName      string `viper:"s3_bucket_name" validate:"required_if=S3Enabled true" envkey:"NETSY_S3_BUCKET_NAME" default:"" description:"S3 bucket name (required when S3 is enabled)"`
-	S3KeyPrefix       string `viper:"s3_key_prefix" envkey:"NETSY_S3_KEY_PREFIX" default:"" description:"S3 object key prefix"`
-	S3Region          string `viper:"s3_region" envkey:"AWS_DEFAULT_REGION" default:"us-east-1" description:"AWS region for S3 bucket"`
-	S3Endpoint        string `viper:"s3_endpoint" envkey:"AWS_ENDPOINT_URL" default:"" description:"Custom S3 endpoint URL (for MinIO, etc.)"`
-	S3AccessKeyID     string `viper:"s3_access_key_id" envkey:"AWS_ACCESS_KEY_ID" default:"" description:"AWS access key ID (optional, prefer IAM roles)"`
-	S3SecretAccessKey string `viper:"s3_secret_access_key" envkey:"AWS_SECRET_ACCESS_KEY" default:"" description:"AWS secret access key (optional, prefer IAM roles)"`
-	S3SessionToken    string `viper:"s3_session_token" envkey:"AWS_SESSION_TOKEN" default:"" description:"AWS session token for temporary credentials"`
-	S3RoleArn         string `viper:"s3_role_arn" envkey:"NETSY_S3_ROLE_ARN" default:"" description:"IAM role ARN to assume for S3 access"`
-	S3RoleSessionName string `viper:"s3_role_session_name" envkey:"NETSY_S3_ROLE_SESSION_NAME" default:"netsy-session" description:"Session name when assuming IAM role"`
-	S3ForcePathStyle  bool   `viper:"s3_force_path_style" envkey:"NETSY_S3_FORCE_PATH_STYLE" default:"false" description:"Use path-style S3 addressing (required for MinIO)"`
-	S3StorageClass    string `viper:"s3_storage_class" envkey:"NETSY_S3_STORAGE_CLASS" default:"STANDARD" description:"S3 storage class (STANDARD, STANDARD_IA, GLACIER, etc.)"`
-	S3Encryption      string `viper:"s3_encryption" envkey:"NETSY_S3_ENCRYPTION" default:"AES256" description:"S3 server-side encryption (AES256 or aws:kms)"`
-	S3KMSKeyID        string `viper:"s3_kms_key_id" envkey:"NETSY_S3_KMS_KEY_ID" default:"" description:"KMS key ID for S3 encryption (when using aws:kms)"`
+	S3Enabled            bool   `viper:"s3_enabled" envkey:"NETSY_S3_ENABLED" default:"true" description:"Enable S3 storage backend (default = true)"`
+	S3BucketName         string `viper:"s3_bucket_name" validate:"required_if=S3Enabled true" envkey:"NETSY_S3_BUCKET_NAME" default:"" description:"S3 bucket name (required when S3 is enabled)"`
+	S3KeyPrefix          string `viper:"s3_key_prefix" envkey:"NETSY_S3_KEY_PREFIX" default:"" description:"S3 object key prefix"`
+	S3Region             string `viper:"s3_region" envkey:"AWS_DEFAULT_REGION" default:"us-east-1" description:"AWS region for S3 bucket"`
+	S3Endpoint           string `viper:"s3_endpoint" envkey:"AWS_ENDPOINT_URL" default:"" description:"Custom S3 endpoint URL (for MinIO, etc.)"`
+	S3AccessKeyID        string `viper:"s3_access_key_id" envkey:"AWS_ACCESS_KEY_ID" default:"" description:"AWS access key ID (optional, prefer IAM roles)"`
+	S3SecretAccessKey    string `viper:"s3_secret_access_key" envkey:"AWS_SECRET_ACCESS_KEY" default:"" secret:"true" description:"AWS secret access key (optional, prefer IAM roles)"`
+	S3SessionToken       string `viper:"s3_session_token" envkey:"AWS_SESSION_TOKEN" default:"" secret:"true" description:"AWS session token for temporary credentials"`
+	S3RoleArn            string `viper:"s3_role_arn" envkey:"NETSY_S3_ROLE_ARN" default:"" description:"IAM role ARN to assume for S3 access"`
+	S3RoleSessionName    string `viper:"s3_role_session_name" envkey:"NETSY_S3_ROLE_SESSION_NAME" default:"netsy-session" description:"Session name when assuming IAM role"`
+	S3ForcePathStyle     bool   `viper:"s3_force_path_style" envkey:"NETSY_S3_FORCE_PATH_STYLE" default:"false" description:"Use path-style S3 addressing (required for MinIO)"`
+	S3StorageClass       string `viper:"s3_storage_class" envkey:"NETSY_S3_STORAGE_CLASS" default:"STANDARD" description:"S3 storage class (STANDARD, STANDARD_IA, GLACIER, etc.)"`
+	S3Encryption         string `viper:"s3_encryption" envkey:"NETSY_S3_ENCRYPTION" default:"AES256" description:"S3 server-side encryption (AES256 or aws:kms)"`
+	S3KMSKeyID           string `viper:"s3_kms_key_id" envkey:"NETSY_S3_KMS_KEY_ID" default:"" description:"KMS key ID for S3 encryption (when using aws:kms)"`
+	S3Checksums          bool   `viper:"s3_checksums" envkey:"NETSY_S3_CHECKSUMS" default:"true" description:"Send the SHA-256 checksum of uploads (x-amz-checksum-sha256) so S3 rejects uploads corrupted in transit, and verify downloads against it (disable for S3-compatible stores which do not support checksums)"`
+	S3ValidateBucket     bool   `viper:"s3_validate_bucket" envkey:"NETSY_S3_VALIDATE_BUCKET" default:"false" description:"Check at startup that the bucket exists, is writable under the key prefix, supports conditional writes and encrypts objects as configured, exiting with an error if not (or continuing with a warning if backfill is skipped)"`
+	S3CreatePrefixMarker bool   `viper:"s3_create_prefix_marker" envkey:"NETSY_S3_CREATE_PREFIX_MARKER" default:"false" description:"Create a marker object (.netsy/marker) under the key prefix at startup, if it does not exist, recording the instance which created it (requires s3_validate_bucket)"`
 	// Replication Configuration
-	ReplicationMode string `viper:"replication_mode" envkey:"NETSY_REPLICATION_MODE" default:"synchronous" description:"Replication mode (synchronous|asynchronous)"`
+	ReplicationMode               string `viper:"replication_mode" envkey:"NETSY_REPLICATION_MODE" default:"synchronous" description:"Replication mode (synchronous|asynchronous)"`
+	ReplicationS3FailureThreshold int64  `viper:"replication_s3_failure_threshold" envkey:"NETSY_REPLICATION_S3_FAILURE_THRESHOLD" default:"5" description:"In synchronous mode, fail writes fast without waiting for S3 after N consecutive S3 upload failures (0 = disabled)"`
+	ReplicationS3RetrySeconds     int64  `viper:"replication_s3_retry_seconds" envkey:"NETSY_REPLICATION_S3_RETRY_SECONDS" default:"10" description:"Once writes are failing fast, let a write through to retry S3 every N seconds"`
 	// Snapshot Configuration
-	SnapshotThresholdRecords    int64 `viper:"snapshot_threshold_records" envkey:"NETSY_SNAPSHOT_THRESHOLD_RECORDS" default:"10000" description:"Create snapshot after N records since last snapshot (0 = disabled)"`
-	SnapshotThresholdSizeMB     int64 `viper:"snapshot_threshold_size_mb" envkey:"NETSY_SNAPSHOT_THRESHOLD_SIZE_MB" default:"10000" description:"Create snapshot when chunks exceed N MB (0 = disabled)"`
-	SnapshotThresholdAgeMinutes int64 `viper:"snapshot_threshold_age_minutes" envkey:"NETSY_SNAPSHOT_THRESHOLD_AGE_MINUTES" default:"0" description:"Create snapshot after N minutes since last snapshot (0 = disabled)"`
+	SnapshotThresholdRecords       int64 `viper:"snapshot_threshold_records" envkey:"NETSY_SNAPSHOT_THRESHOLD_RECORDS" default:"10000" description:"Create snapshot after N records since last snapshot (0 = disabled)"`
+	SnapshotThresholdSizeMB        int64 `viper:"snapshot_threshold_size_mb" envkey:"NETSY_SNAPSHOT_THRESHOLD_SIZE_MB" default:"10000" description:"Create snapshot when chunks exceed N MB (0 = disabled)"`
+	SnapshotThresholdAgeMinutes    int64 `viper:"snapshot_threshold_age_minutes" envkey:"NETSY_SNAPSHOT_THRESHOLD_AGE_MINUTES" default:"0" description:"Create snapshot after N minutes since last snapshot (0 = disabled)"`
+	SnapshotShutdownTimeoutSeconds int64 `viper:"snapshot_shutdown_timeout_seconds" envkey:"NETSY_SNAPSHOT_SHUTDOWN_TIMEOUT_SECONDS" default:"30" description:"Maximum time to wait for an in-flight snapshot to complete on shutdown before cancelling it"`
+	SnapshotDryRun                 bool  `viper:"snapshot_dry_run" envkey:"NETSY_SNAPSHOT_DRY_RUN" default:"false" description:"Log when a snapshot would be created instead of creating it, for tuning snapshot thresholds"`
+	SnapshotCompressionLevel       int64 `viper:"snapshot_compression_level" envkey:"NETSY_SNAPSHOT_COMPRESSION_LEVEL" default:"0" description:"zstd compression level for snapshots, from 1 (fastest) to 22 (best ratio) (0 = default)"`
+	SnapshotCompressionWindowKB    int64 `viper:"snapshot_compression_window_kb" envkey:"NETSY_SNAPSHOT_COMPRESSION_WINDOW_KB" default:"0" description:"zstd window size in KB for snapshots, a power of 2 (0 = default)"`
+	SnapshotPartMaxSizeMB          int64 `viper:"snapshot_part_max_size_mb" envkey:"NETSY_SNAPSHOT_PART_MAX_SIZE_MB" default:"1024" description:"Split snapshots into parts holding at most N MB of records (before compression) each, plus a manifest (0 = never split)"`
+	// Compaction Configuration
+	CompactionMode            string `viper:"compaction_mode" validate:"oneof=periodic revision" envkey:"NETSY_COMPACTION_MODE" default:"periodic" description:"How compaction_retention is interpreted when compacting periodically, as etcd's --auto-compaction-mode (periodic|revision)"`
+	CompactionRetention       string `viper:"compaction_retention" envkey:"NETSY_COMPACTION_RETENTION" default:"0" description:"Compact periodically, keeping the history created within a duration in periodic mode (e.g. 30m, or a number of hours), or the latest N revisions in revision mode, in addition to compactions requested by clients such as kube-apiserver, as etcd's --auto-compaction-retention (0 = disabled)"`
+	CompactionIntervalMinutes int64  `viper:"compaction_interval_minutes" validate:"gte=0" envkey:"NETSY_COMPACTION_INTERVAL_MINUTES" default:"0" description:"Compact periodically every N minutes (0 = as etcd: every retention period up to an hour in periodic mode, or every 5 minutes in revision mode)"`
+	CompactionPruneTombstones bool   `viper:"compaction_prune_tombstones" envkey:"NETSY_COMPACTION_PRUNE_TOMBSTONES" default:"false" description:"Delete the history of keys deleted before the compaction revision (and covered by a snapshot when S3 is enabled) when compacting"`
+	// Chunk Coalescing Configuration
+	ChunkCoalesceIntervalMinutes int64 `viper:"chunk_coalesce_interval_minutes" envkey:"NETSY_CHUNK_COALESCE_INTERVAL_MINUTES" default:"0" description:"Merge small contiguous chunk files in S3 every N minutes (0 = disabled)"`
+	ChunkCoalesceTargetSizeMB    int64 `viper:"chunk_coalesce_target_size_mb" envkey:"NETSY_CHUNK_COALESCE_TARGET_SIZE_MB" default:"16" description:"Target size of merged chunk files in MB"`
+	// Chunk Compression Configuration
+	ChunkCompressionLevel    int64 `viper:"chunk_compression_level" envkey:"NETSY_CHUNK_COMPRESSION_LEVEL" default:"0" description:"zstd compression level for compressed chunks, from 1 (fastest) to 22 (best ratio) (0 = default)"`
+	ChunkCompressionWindowKB int64 `viper:"chunk_compression_window_kb" envkey:"NETSY_CHUNK_COMPRESSION_WINDOW_KB" default:"0" description:"zstd window size in KB for compressed chunks, a power of 2 (0 = default)"`
+	ChunkCompressionMinBytes int64 `viper:"chunk_compression_min_bytes" envkey:"NETSY_CHUNK_COMPRESSION_MIN_BYTES" default:"4096" description:"Compress multi-record chunks, such as coalesced chunks, whose serialized records exceed N bytes"`
+	// Chunk Retention Configuration
+	ChunkRetentionIntervalMinutes int64 `viper:"chunk_retention_interval_minutes" envkey:"NETSY_CHUNK_RETENTION_INTERVAL_MINUTES" default:"15" description:"Delete chunk files covered by a snapshot every N minutes (0 = disabled)"`
+	ChunkRetentionGraceHours      int64 `viper:"chunk_retention_grace_hours" envkey:"NETSY_CHUNK_RETENTION_GRACE_HOURS" default:"1" description:"Keep chunk files for N hours after the snapshot which covers them was created"`
+	// Chunk Dictionary Configuration
+	ChunkDictionaryIntervalMinutes int64 `viper:"chunk_dictionary_interval_minutes" envkey:"NETSY_CHUNK_DICTIONARY_INTERVAL_MINUTES" default:"0" description:"Train a zstd dictionary from recent values for compressing small chunks every N minutes (0 = disabled)"`
+	ChunkDictionarySamples         int64 `viper:"chunk_dictionary_samples" envkey:"NETSY_CHUNK_DICTIONARY_SAMPLES" default:"2000" description:"Number of recent values used to train the chunk dictionary"`
+	ChunkDictionarySizeKB          int64 `viper:"chunk_dictionary_size_kb" envkey:"NETSY_CHUNK_DICTIONARY_SIZE_KB" default:"64" description:"Maximum size of the chunk dictionary in KB"`
+	// Backfill Configuration
+	SkipBackfill                     bool   `viper:"skip_backfill" envkey:"NETSY_SKIP_BACKFILL" default:"false" description:"Start from the local database without backfilling from S3, for recovery when S3 cannot be listed but the local database is known to be good, then check for missing revisions once S3 is reachable"`
+	BackfillReconcileIntervalSeconds int64  `viper:"backfill_reconcile_interval_seconds" envkey:"NETSY_BACKFILL_RECONCILE_INTERVAL_SECONDS" default:"60" description:"How often to retry checking S3 for revisions missing from the local database after backfill was skipped"`
+	BackfillKnownLeaders             string `viper:"backfill_known_leaders" envkey:"NETSY_BACKFILL_KNOWN_LEADERS" default:"" description:"Comma-separated instance IDs expected to have written data files, warning on files written by other instances during backfill (empty = any instance)"`
+	BackfillClockSkewSeconds         int64  `viper:"backfill_clock_skew_seconds" envkey:"NETSY_BACKFILL_CLOCK_SKEW_SECONDS" default:"300" description:"Tolerated clock skew between instances, beyond which data files created in the future or out of order are warned about during backfill"`
+	// Watch Configuration
+	WatchCreateWorkers         int64  `viper:"watch_create_workers" envkey:"NETSY_WATCH_CREATE_WORKERS" default:"8" description:"Maximum number of watch create batches processed concurrently across all watchers"`
+	WatchCreateQueueSize       int64  `viper:"watch_create_queue_size" envkey:"NETSY_WATCH_CREATE_QUEUE_SIZE" default:"1024" description:"Maximum number of pending watch create requests per watcher"`
+	WatchQueueSize             int64  `viper:"watch_queue_size" envkey:"NETSY_WATCH_QUEUE_SIZE" default:"1024" description:"Maximum number of responses queued per watcher, beyond which it falls behind and catches up from the local db"`
+	WatchLagAlarmMS            int64  `viper:"watch_lag_alarm_ms" envkey:"NETSY_WATCH_LAG_ALARM_MS" default:"0" description:"Alarm when a watcher's events are delivered more than N ms after they were committed (0 = disabled)"`
+	WatchLagAlarmSeconds       int64  `viper:"watch_lag_alarm_seconds" envkey:"NETSY_WATCH_LAG_ALARM_SECONDS" default:"30" description:"Only alarm once a watcher's events have been delivered late for N seconds"`
+	WatchMaxPerWatcher         int64  `viper:"watch_max_per_watcher" envkey:"NETSY_WATCH_MAX_PER_WATCHER" default:"10000" description:"Maximum number of watches per watcher, beyond which watch create requests are cancelled (0 = unlimited)"`
+	WatchMaxWatchers           int64  `viper:"watch_max_watchers" envkey:"NETSY_WATCH_MAX_WATCHERS" default:"1000" description:"Maximum number of watchers (watch streams), beyond which a new watcher's watch create requests are cancelled (0 = unlimited)"`
+	WatchOverflowPolicy        string `viper:"watch_overflow_policy" validate:"oneof=catch_up cancel" envkey:"NETSY_WATCH_OVERFLOW_POLICY" default:"catch_up" description:"How a watcher whose queue overflows is handled (catch_up = send its events from the local db once there is room, cancel = cancel its watches as the watcher is slow)"`
+	WatchLagCancel             bool   `viper:"watch_lag_cancel" envkey:"NETSY_WATCH_LAG_CANCEL" default:"false" description:"End the watch stream of a watcher which alarms, so its client reconnects rather than falling further behind and delaying other watchers"`
+	WatchProgressIntervalMS    int64  `viper:"watch_progress_interval_ms" envkey:"NETSY_WATCH_PROGRESS_INTERVAL_MS" default:"5000" description:"How often watchers are sent progress notifications, in ms"`
+	WatchProgressJitterPercent int64  `viper:"watch_progress_jitter_percent" envkey:"NETSY_WATCH_PROGRESS_JITTER_PERCENT" default:"20" description:"Randomly lengthen each watcher's progress interval by up to N%, so that watchers do not send progress notifications in sync (0 = no jitter)"`
+	WatchDrainTimeoutMS        int64  `viper:"watch_drain_timeout_ms" envkey:"NETSY_WATCH_DRAIN_TIMEOUT_MS" default:"5000" description:"On shutdown, wait up to N ms for each watcher to be sent its queued responses and the cancellation of its watches, before watch streams are ended (0 = end watch streams immediately)"`
+	// Lease Configuration
+	LeaseMinTTLSeconds       int64 `viper:"lease_min_ttl_seconds" envkey:"NETSY_LEASE_MIN_TTL_SECONDS" default:"5" description:"Minimum lease TTL, leases granted with a shorter TTL are given this TTL instead"`
+	LeaseCheckIntervalMS     int64 `viper:"lease_check_interval_ms" envkey:"NETSY_LEASE_CHECK_INTERVAL_MS" default:"500" description:"How often to check for expired leases, whose attached keys are then deleted"`
+	LeaseRestartGraceSeconds int64 `viper:"lease_restart_grace_seconds" envkey:"NETSY_LEASE_RESTART_GRACE_SECONDS" default:"30" description:"Leases expire no sooner than N seconds after a server becomes the leader, including on startup, so that clients can keep them alive after a restart or leader change (0 to disable)"`
+	// Lock Configuration
+	LockHoldWarnMS int64 `viper:"lock_hold_warn_ms" envkey:"NETSY_LOCK_HOLD_WARN_MS" default:"100" description:"Warn when the leader transaction lock or watcher locks are held for longer than N ms (0 = disabled)"`
+	// Request Priority Configuration
+	RequestMaxInFlight       int64  `viper:"request_max_in_flight" envkey:"NETSY_REQUEST_MAX_IN_FLIGHT" default:"256" description:"Maximum number of concurrent Range and Txn requests (0 = unlimited)"`
+	RequestReservedSystem    int64  `viper:"request_reserved_system" envkey:"NETSY_REQUEST_RESERVED_SYSTEM" default:"32" description:"Number of in-flight request slots reserved for system key prefixes"`
+	RequestSystemKeyPrefixes string `viper:"request_system_key_prefixes" envkey:"NETSY_REQUEST_SYSTEM_KEY_PREFIXES" default:"/registry/leases/,/registry/masterleases/,/registry/configmaps/kube-system/,/registry/services/endpoints/kube-system/" description:"Comma-separated key prefixes prioritized over other requests when saturated"`
+	RequestClientRateLimit   int64  `viper:"request_client_rate_limit" envkey:"NETSY_REQUEST_CLIENT_RATE_LIMIT" default:"0" description:"Maximum number of Range and Txn requests per second per client, identified by its TLS client certificate common name (0 = unlimited)"`
+	// Range Cache Configuration
+	RangeCacheSizeMB        int64 `viper:"range_cache_size_mb" envkey:"NETSY_RANGE_CACHE_SIZE_MB" default:"64" description:"Cache the responses of Range requests at a past revision, which cannot change, e.g. the pages of lists by multiple kube-apiservers, up to N MB (0 = disabled)"`
+	RangeCacheVerifyPercent int64 `viper:"range_cache_verify_percent" envkey:"NETSY_RANGE_CACHE_VERIFY_PERCENT" default:"0" description:"Also query the local db for N% of Range requests served from the range cache, evicting and logging cached responses which differ, to verify responses at past revisions never change (0 = disabled)"`
+	// Client Configuration
+	ClientOverrides       string `viper:"client_overrides" envkey:"NETSY_CLIENT_OVERRIDES" default:"" description:"Semicolon-separated per-client settings keyed by TLS client certificate common name (or anonymous), overriding watch_progress_interval_ms and request_client_rate_limit, e.g. apiserver-a=watch_progress_interval_ms:1000,request_client_rate_limit:500;apiserver-b=request_client_rate_limit:100"`
+	AdminClientIdentities string `viper:"admin_client_identities" envkey:"NETSY_ADMIN_CLIENT_IDENTITIES" default:"" description:"Comma-separated TLS client certificate common names allowed to call the Admin API (default = the common name of tls_client_cert, which netsy commands such as status connect with)"`
+	ReadRules             string `viper:"read_rules" envkey:"NETSY_READ_RULES" default:"" description:"Semicolon-separated rules restricting access to keys under a prefix by client TLS client certificate common name (or anonymous, or * for clients not listed), each of the form prefix=client:action,client:action, where action is allow, redact (values are stripped from ranges and watch events) or deny (requests and watches including the prefix are rejected), e.g. /registry/secrets/=system:kube-apiserver:allow,backup:redact,*:deny (clients not matched are allowed)"`
+	// Write Validation Configuration
+	WriteKeyAllowedPrefixes string `viper:"write_key_allowed_prefixes" envkey:"NETSY_WRITE_KEY_ALLOWED_PREFIXES" default:"" description:"Comma-separated key prefixes writes are restricted to, where prefixes not ending in / must match the whole key, e.g. /registry/,compact_rev_key (empty = all keys allowed)"`
+	// Audit Configuration
+	AuditSinks string `viper:"audit_sinks" envkey:"NETSY_AUDIT_SINKS" default:"" description:"Comma-separated sinks to audit Txn, Range and watch create requests to (log|file, empty = disabled)"`
+	AuditFile  string `viper:"audit_file" envkey:"NETSY_AUDIT_FILE" default:"" path:"true" description:"Path to file to append audit entries to as JSON lines (required for the file audit sink)"`
+	// Value Transform Configuration
+	ValueTransformers      string `viper:"value_transformers" envkey:"NETSY_VALUE_TRANSFORMERS" default:"" description:"Comma-separated transformers applied to values in order as they are written, and in reverse as they are read (zstd|aes-gcm|hmac-sha256, empty = disabled). All instances must use the same transformers and keys"`
+	ValueEncryptionKeyFile string `viper:"value_encryption_key_file" envkey:"NETSY_VALUE_ENCRYPTION_KEY_FILE" default:"" path:"true" description:"Path to file containing the base64 encoded 32 byte AES-256 key (required for the aes-gcm value transformer)"`
+	ValueHMACKeyFile       string `viper:"value_hmac_key_file" envkey:"NETSY_VALUE_HMAC_KEY_FILE" default:"" path:"true" description:"Path to file containing the base64 encoded key values are signed with (required for the hmac-sha256 value transformer)"`
+	ValueTransformStrict   bool   `viper:"value_transform_strict" envkey:"NETSY_VALUE_TRANSFORM_STRICT" default:"false" description:"Reject values read which were not transformed by every value transformer, e.g. values written before zstd compression was enabled, rather than reading them as-is (required for the aes-gcm and hmac-sha256 value transformers, so values cannot be replaced by unencrypted or unsigned values)"`
+	// Memory Configuration
+	MemorySoftLimitMB int64 `viper:"memory_soft_limit_mb" envkey:"NETSY_MEMORY_SOFT_LIMIT_MB" default:"0" description:"Reject new watches when process RSS or Go heap exceeds N MB (0 = disabled)"`
+	MemoryHardLimitMB int64 `viper:"memory_hard_limit_mb" envkey:"NETSY_MEMORY_HARD_LIMIT_MB" default:"0" description:"Additionally force a snapshot when process RSS or Go heap exceeds N MB (0 = disabled)"`
+	// Metrics Configuration
+	MetricsTLS             bool   `viper:"metrics_tls" envkey:"NETSY_METRICS_TLS" default:"false" description:"Serve metrics over HTTPS using tls_server_cert and tls_server_key"`
+	MetricsTLSClientAuth   bool   `viper:"metrics_tls_client_auth" envkey:"NETSY_METRICS_TLS_CLIENT_AUTH" default:"false" description:"Require metrics clients to present a certificate signed by tls_client_ca (requires metrics_tls)"`
+	MetricsBearerTokenFile string `viper:"metrics_bearer_token_file" envkey:"NETSY_METRICS_BEARER_TOKEN_FILE" default:"" path:"true" description:"Path to file containing a bearer token metrics requests must present (empty = no token required)"`
+	MetricsAllowedCIDRs    string `viper:"metrics_allowed_cidrs" envkey:"NETSY_METRICS_ALLOWED_CIDRS" default:"" description:"Comma-separated CIDRs or IP addresses metrics requests are restricted to (empty = all addresses allowed)"`
+	MetricsNamespacesMax   int64  `viper:"metrics_namespaces_max" envkey:"NETSY_METRICS_NAMESPACES_MAX" default:"100" description:"Maximum number of Kubernetes namespaces whose writes are labelled in per-namespace write metrics, in the order they are first written to; writes to further namespaces are labelled _overflow (0 = per-namespace write metrics disabled)"`
+	// Shadow Configuration
+	ShadowEtcdEndpoints          string `viper:"shadow_etcd_endpoints" envkey:"NETSY_SHADOW_ETCD_ENDPOINTS" default:"" description:"Comma-separated endpoints of an etcd cluster to forward every write to and compare keys with, to validate netsy before cutting over. etcd must start with the same keys as netsy (empty = disabled)"`
+	ShadowEtcdCA                 string `viper:"shadow_etcd_ca" envkey:"NETSY_SHADOW_ETCD_CA" default:"" path:"true" description:"Path to file containing the CA x509 certificate used to verify the shadow etcd endpoints (empty = connect without TLS)"`
+	ShadowEtcdCert               string `viper:"shadow_etcd_cert" envkey:"NETSY_SHADOW_ETCD_CERT" default:"" path:"true" description:"Path to file containing the x509 client certificate used when connecting to the shadow etcd endpoints"`
+	ShadowEtcdKey                string `viper:"shadow_etcd_key" envkey:"NETSY_SHADOW_ETCD_KEY" default:"" path:"true" description:"Path to file containing the private key of the shadow etcd client certificate"`
+	ShadowComparePrefix          string `viper:"shadow_compare_prefix" envkey:"NETSY_SHADOW_COMPARE_PREFIX" default:"" description:"Prefix of the keys compared with the shadow etcd, e.g. /registry/ (empty = all keys)"`
+	ShadowCompareIntervalSeconds int64  `viper:"shadow_compare_interval_seconds" envkey:"NETSY_SHADOW_COMPARE_INTERVAL_SECONDS" default:"300" description:"Compare keys with the shadow etcd every N seconds (0 = writes are forwarded but never compared)"`
+
+	// Proxy Configuration
+	ProxyEtcdEndpoints      string `viper:"proxy_etcd_endpoints" envkey:"NETSY_PROXY_ETCD_ENDPOINTS" default:"" description:"Comma-separated endpoints of an upstream etcd cluster to run netsy as a read cache in front of: keys are replicated from etcd into the local database, reads and watches are served locally, and writes are forwarded to etcd. Requires s3_enabled=false (empty = disabled)"`
+	ProxyEtcdCA             string `viper:"proxy_etcd_ca" envkey:"NETSY_PROXY_ETCD_CA" default:"" path:"true" description:"Path to file containing the CA x509 certificate used to verify the upstream etcd endpoints (empty = connect without TLS)"`
+	ProxyEtcdCert           string `viper:"proxy_etcd_cert" envkey:"NETSY_PROXY_ETCD_CERT" default:"" path:"true" description:"Path to file containing the x509 client certificate used when connecting to the upstream etcd endpoints"`
+	ProxyEtcdKey            string `viper:"proxy_etcd_key" envkey:"NETSY_PROXY_ETCD_KEY" default:"" path:"true" description:"Path to file containing the private key of the upstream etcd client certificate"`
+	ProxyWriteWaitTimeoutMS int64  `viper:"proxy_write_wait_timeout_ms" envkey:"NETSY_PROXY_WRITE_WAIT_TIMEOUT_MS" default:"5000" description:"How long a write forwarded to the upstream etcd waits for its revision to be replicated locally, so that the client reads its own write, before failing with Unavailable"`
 }
 
 // Environment returns the current environment (development, production, etc)
@@ -86,93 +199,78 @@ func (c *Config) ListenClientsAddr() string {
 	return viper.GetString("listen_clients_addr")
 }
 
+// ListenClientsEarly returns whether the client API listener is started
+// before backfill, failing requests until ready
+func (c *Config) ListenClientsEarly() bool {
+	return viper.GetBool("listen_clients_early")
+}
+
 // ListenPeersAddr returns the address for other netsy servers to connect to
 func (c *Config) ListenPeersAddr() string {
 	return viper.GetString("listen_peers_addr")
 }
 
+// ListenMetricsAddr returns the address of the HTTP server for Prometheus metrics
+func (c *Config) ListenMetricsAddr() string {
+	return viper.GetString("listen_metrics_addr")
+}
+
+// ListenHealthAddr returns the address of the plaintext gRPC health server,
+// or an empty string if it is disabled
+func (c *Config) ListenHealthAddr() string {
+	return viper.GetString("listen_health_addr")
+}
+
 // TLSServerCA returns the path to file containing the CA x509 certificate used when serving connections on the server listen address
 func (c *Config) TLSServerCA() string {
-	caCert := viper.GetString("tls_server_ca")
-	if strings.HasPrefix(caCert, "./") {
-		caCert = strings.TrimPrefix(caCert, "./")
-		currentDir, _ := filepath.Abs(".")
-		caCert = filepath.Join(currentDir, caCert)
-		viper.Set("tls_server_ca", caCert)
-	}
-	return caCert
+	return absPath("tls_server_ca")
 }
 
 // TLSServerCert returns the path to file containing the x509 certificate used when serving connections on the server listen address
 func (c *Config) TLSServerCert() string {
-	serverCert := viper.GetString("tls_server_cert")
-	if strings.HasPrefix(serverCert, "./") {
-		serverCert = strings.TrimPrefix(serverCert, "./")
-		currentDir, _ := filepath.Abs(".")
-		serverCert = filepath.Join(currentDir, serverCert)
-		viper.Set("tls_server_cert", serverCert)
-	}
-	return serverCert
+	return absPath("tls_server_cert")
 }
 
 // TLSServerKey returns the path to the Path to file containing the Ed25519 private key used when serving connections on the server listen address
 func (c *Config) TLSServerKey() string {
-	keyFile := viper.GetString("tls_server_key")
-	if strings.HasPrefix(keyFile, "./") {
-		keyFile = strings.TrimPrefix(keyFile, "./")
-		currentDir, _ := filepath.Abs(".")
-		keyFile = filepath.Join(currentDir, keyFile)
-		viper.Set("tls_server_key", keyFile)
-	}
-	return keyFile
+	return absPath("tls_server_key")
 }
 
 // TLSClientCA returns the path to file containing the CA x509 certificate used when connecting to peer netsy servers
 func (c *Config) TLSClientCA() string {
-	caCert := viper.GetString("tls_client_ca")
-	if strings.HasPrefix(caCert, "./") {
-		caCert = strings.TrimPrefix(caCert, "./")
-		currentDir, _ := filepath.Abs(".")
-		caCert = filepath.Join(currentDir, caCert)
-		viper.Set("tls_client_ca", caCert)
-	}
-	return caCert
+	return absPath("tls_client_ca")
 }
 
 // TLSClientCert returns the path to file containing the x509 certificate used when connecting to peer netsy servers
 func (c *Config) TLSClientCert() string {
-	clientCert := viper.GetString("tls_client_cert")
-	if strings.HasPrefix(clientCert, "./") {
-		clientCert = strings.TrimPrefix(clientCert, "./")
-		currentDir, _ := filepath.Abs(".")
-		clientCert = filepath.Join(currentDir, clientCert)
-		viper.Set("tls_client_cert", clientCert)
-	}
-	return clientCert
+	return absPath("tls_client_cert")
 }
 
 // TLSClientKey returns the path to file containing the Ed25519 private key used when connecting to peer netsy servers
 func (c *Config) TLSClientKey() string {
-	keyFile := viper.GetString("tls_client_key")
-	if strings.HasPrefix(keyFile, "./") {
-		keyFile = strings.TrimPrefix(keyFile, "./")
-		currentDir, _ := filepath.Abs(".")
-		keyFile = filepath.Join(currentDir, keyFile)
-		viper.Set("tls_client_key", keyFile)
-	}
-	return keyFile
+	return absPath("tls_client_key")
 }
 
 // DataDir returns the directory path for data
 func (c *Config) DataDir() string {
-	dir := viper.GetString("data_dir")
-	if strings.HasPrefix(dir, "./") {
-		dir = strings.TrimPrefix(dir, "./")
-		currentDir, _ := filepath.Abs(".")
-		dir = filepath.Join(currentDir, dir)
-		viper.Set("data_dir", dir)
-	}
-	return dir
+	return absPath("data_dir")
+}
+
+// DBMaxReadConns returns the maximum number of concurrent local database read connections
+func (c *Config) DBMaxReadConns() int64 {
+	return viper.GetInt64("db_max_read_conns")
+}
+
+// DBIntegrityCheck returns the local database startup corruption check mode
+// (quick|full|off)
+func (c *Config) DBIntegrityCheck() string {
+	return viper.GetString("db_integrity_check")
+}
+
+// DBRebuildOnCorruption returns whether a corrupt local database is rebuilt
+// from S3 at startup
+func (c *Config) DBRebuildOnCorruption() bool {
+	return viper.GetBool("db_rebuild_on_corruption")
 }
 
 // S3Enabled returns whether S3 storage backend is enabled
@@ -245,11 +343,43 @@ func (c *Config) S3KMSKeyID() string {
 	return viper.GetString("s3_kms_key_id")
 }
 
+// S3Checksums returns whether uploads are sent with, and downloads verified
+// against, their SHA-256 checksum
+func (c *Config) S3Checksums() bool {
+	return viper.GetBool("s3_checksums")
+}
+
+// S3ValidateBucket returns whether the bucket is checked at startup
+func (c *Config) S3ValidateBucket() bool {
+	return viper.GetBool("s3_validate_bucket")
+}
+
+// S3CreatePrefixMarker returns whether a marker object is created under the
+// key prefix at startup
+func (c *Config) S3CreatePrefixMarker() bool {
+	return viper.GetBool("s3_create_prefix_marker")
+}
+
+// EtcdVersion returns the etcd minor version to emulate (3.4|3.5)
+func (c *Config) EtcdVersion() string {
+	return viper.GetString("etcd_version")
+}
+
 // ReplicationMode returns the replication mode (synchronous|asynchronous)
 func (c *Config) ReplicationMode() string {
 	return viper.GetString("replication_mode")
 }
 
+// ReplicationS3FailureThreshold returns the number of consecutive S3 upload failures after which writes fail fast
+func (c *Config) ReplicationS3FailureThreshold() int64 {
+	return viper.GetInt64("replication_s3_failure_threshold")
+}
+
+// ReplicationS3RetrySeconds returns how often S3 is retried while writes are failing fast
+func (c *Config) ReplicationS3RetrySeconds() int64 {
+	return viper.GetInt64("replication_s3_retry_seconds")
+}
+
 // SnapshotThresholdRecords returns the record count threshold for snapshots
 func (c *Config) SnapshotThresholdRecords() int64 {
 	return viper.GetInt64("snapshot_threshold_records")
@@ -264,3 +394,426 @@ func (c *Config) SnapshotThresholdSizeMB() int64 {
 func (c *Config) SnapshotThresholdAgeMinutes() int64 {
 	return viper.GetInt64("snapshot_threshold_age_minutes")
 }
+
+// SnapshotShutdownTimeoutSeconds returns the maximum time to wait for an in-flight snapshot on shutdown
+func (c *Config) SnapshotShutdownTimeoutSeconds() int64 {
+	return viper.GetInt64("snapshot_shutdown_timeout_seconds")
+}
+
+// SnapshotDryRun returns whether snapshots are only logged rather than created
+func (c *Config) SnapshotDryRun() bool {
+	return viper.GetBool("snapshot_dry_run")
+}
+
+// SnapshotCompressionLevel returns the zstd compression level for snapshots
+func (c *Config) SnapshotCompressionLevel() int64 {
+	return viper.GetInt64("snapshot_compression_level")
+}
+
+// SnapshotCompressionWindowKB returns the zstd window size in KB for snapshots
+func (c *Config) SnapshotCompressionWindowKB() int64 {
+	return viper.GetInt64("snapshot_compression_window_kb")
+}
+
+// SnapshotPartMaxSizeMB returns the maximum size in MB of the records in each
+// part of a multi-part snapshot, or 0 if snapshots are never split
+func (c *Config) SnapshotPartMaxSizeMB() int64 {
+	return viper.GetInt64("snapshot_part_max_size_mb")
+}
+
+// ChunkCompressionLevel returns the zstd compression level for compressed chunks
+func (c *Config) ChunkCompressionLevel() int64 {
+	return viper.GetInt64("chunk_compression_level")
+}
+
+// ChunkCompressionWindowKB returns the zstd window size in KB for compressed chunks
+func (c *Config) ChunkCompressionWindowKB() int64 {
+	return viper.GetInt64("chunk_compression_window_kb")
+}
+
+// ChunkCompressionMinBytes returns the serialized size of a chunk's records above which it is compressed
+func (c *Config) ChunkCompressionMinBytes() int64 {
+	return viper.GetInt64("chunk_compression_min_bytes")
+}
+
+// CompactionMode returns how the periodic compaction retention is
+// interpreted, either periodic or revision
+func (c *Config) CompactionMode() string {
+	return viper.GetString("compaction_mode")
+}
+
+// CompactionRetention returns the history kept by periodic compactions: a
+// duration in periodic mode, or a number of revisions in revision mode.
+// Both are 0 if periodic compaction is disabled.
+func (c *Config) CompactionRetention() (period time.Duration, revisions int64) {
+	period, revisions, _ = parseCompactionRetention(c.CompactionMode(), viper.GetString("compaction_retention"))
+	return period, revisions
+}
+
+// CompactionIntervalMinutes returns the interval in minutes between
+// periodic compactions, or 0 if it is derived from the retention
+func (c *Config) CompactionIntervalMinutes() int64 {
+	return viper.GetInt64("compaction_interval_minutes")
+}
+
+// CompactionPruneTombstones returns whether the history of deleted keys is
+// pruned when compacting
+func (c *Config) CompactionPruneTombstones() bool {
+	return viper.GetBool("compaction_prune_tombstones")
+}
+
+// ChunkCoalesceIntervalMinutes returns the interval in minutes between chunk coalescing runs
+func (c *Config) ChunkCoalesceIntervalMinutes() int64 {
+	return viper.GetInt64("chunk_coalesce_interval_minutes")
+}
+
+// ChunkCoalesceTargetSizeMB returns the target size of merged chunk files in MB
+func (c *Config) ChunkCoalesceTargetSizeMB() int64 {
+	return viper.GetInt64("chunk_coalesce_target_size_mb")
+}
+
+// ChunkRetentionIntervalMinutes returns the interval in minutes between chunk retention runs
+func (c *Config) ChunkRetentionIntervalMinutes() int64 {
+	return viper.GetInt64("chunk_retention_interval_minutes")
+}
+
+// ChunkRetentionGraceHours returns the number of hours chunk files are kept after a snapshot covers them
+func (c *Config) ChunkRetentionGraceHours() int64 {
+	return viper.GetInt64("chunk_retention_grace_hours")
+}
+
+// ChunkDictionaryIntervalMinutes returns the interval in minutes between chunk dictionary training runs
+func (c *Config) ChunkDictionaryIntervalMinutes() int64 {
+	return viper.GetInt64("chunk_dictionary_interval_minutes")
+}
+
+// ChunkDictionarySamples returns the number of recent values used to train the chunk dictionary
+func (c *Config) ChunkDictionarySamples() int64 {
+	return viper.GetInt64("chunk_dictionary_samples")
+}
+
+// ChunkDictionarySizeKB returns the maximum size of the chunk dictionary in KB
+func (c *Config) ChunkDictionarySizeKB() int64 {
+	return viper.GetInt64("chunk_dictionary_size_kb")
+}
+
+// SkipBackfill returns whether backfill is skipped, trusting the local database
+func (c *Config) SkipBackfill() bool {
+	return viper.GetBool("skip_backfill")
+}
+
+// BackfillReconcileIntervalSeconds returns how often to retry checking S3
+// for missing revisions after backfill was skipped
+func (c *Config) BackfillReconcileIntervalSeconds() int64 {
+	return viper.GetInt64("backfill_reconcile_interval_seconds")
+}
+
+// BackfillKnownLeaders returns the instance IDs expected to have written data
+// files, or none if files written by any instance are expected
+func (c *Config) BackfillKnownLeaders() []string {
+	var leaders []string
+	for _, leader := range strings.Split(viper.GetString("backfill_known_leaders"), ",") {
+		if leader = strings.TrimSpace(leader); leader != "" {
+			leaders = append(leaders, leader)
+		}
+	}
+	return leaders
+}
+
+// BackfillClockSkewSeconds returns the tolerated clock skew between instances
+func (c *Config) BackfillClockSkewSeconds() int64 {
+	return viper.GetInt64("backfill_clock_skew_seconds")
+}
+
+// WatchCreateWorkers returns the maximum number of concurrent watch create batches
+func (c *Config) WatchCreateWorkers() int64 {
+	return viper.GetInt64("watch_create_workers")
+}
+
+// WatchCreateQueueSize returns the maximum number of pending watch create requests per watcher
+func (c *Config) WatchCreateQueueSize() int64 {
+	return viper.GetInt64("watch_create_queue_size")
+}
+
+// WatchQueueSize returns the maximum number of responses queued per watcher
+func (c *Config) WatchQueueSize() int64 {
+	return viper.GetInt64("watch_queue_size")
+}
+
+// WatchMaxPerWatcher returns the maximum number of watches per watcher, or 0 if unlimited
+func (c *Config) WatchMaxPerWatcher() int64 {
+	return viper.GetInt64("watch_max_per_watcher")
+}
+
+// WatchMaxWatchers returns the maximum number of watchers, or 0 if unlimited
+func (c *Config) WatchMaxWatchers() int64 {
+	return viper.GetInt64("watch_max_watchers")
+}
+
+// WatchLagAlarmMS returns the watch delivery lag in ms above which watchers alarm
+func (c *Config) WatchLagAlarmMS() int64 {
+	return viper.GetInt64("watch_lag_alarm_ms")
+}
+
+// WatchLagAlarmSeconds returns how long a watcher's events must be delivered late before it alarms
+func (c *Config) WatchLagAlarmSeconds() int64 {
+	return viper.GetInt64("watch_lag_alarm_seconds")
+}
+
+// WatchOverflowPolicy returns how a watcher whose queue overflows is handled
+// (catch_up|cancel)
+func (c *Config) WatchOverflowPolicy() string {
+	return viper.GetString("watch_overflow_policy")
+}
+
+// WatchLagCancel returns whether the watch streams of watchers which alarm are ended
+func (c *Config) WatchLagCancel() bool {
+	return viper.GetBool("watch_lag_cancel")
+}
+
+// WatchProgressIntervalMS returns how often watchers are sent progress
+// notifications in milliseconds
+func (c *Config) WatchProgressIntervalMS() int64 {
+	return viper.GetInt64("watch_progress_interval_ms")
+}
+
+// WatchProgressJitterPercent returns the maximum percentage by which each
+// watcher's progress interval is randomly lengthened
+func (c *Config) WatchProgressJitterPercent() int64 {
+	return viper.GetInt64("watch_progress_jitter_percent")
+}
+
+// WatchDrainTimeoutMS returns how long to wait on shutdown for watchers to be
+// sent the cancellation of their watches, in milliseconds
+func (c *Config) WatchDrainTimeoutMS() int64 {
+	return viper.GetInt64("watch_drain_timeout_ms")
+}
+
+// LeaseMinTTLSeconds returns the minimum lease TTL in seconds
+func (c *Config) LeaseMinTTLSeconds() int64 {
+	return viper.GetInt64("lease_min_ttl_seconds")
+}
+
+// LeaseCheckIntervalMS returns how often to check for expired leases in
+// milliseconds
+func (c *Config) LeaseCheckIntervalMS() int64 {
+	return viper.GetInt64("lease_check_interval_ms")
+}
+
+// LeaseRestartGraceSeconds returns how long after a server becomes the
+// leader its leases are guaranteed not to expire, in seconds, or 0 if they
+// expire on schedule
+func (c *Config) LeaseRestartGraceSeconds() int64 {
+	return viper.GetInt64("lease_restart_grace_seconds")
+}
+
+// LockHoldWarnMS returns the lock hold duration beyond which holds are warned about
+func (c *Config) LockHoldWarnMS() int64 {
+	return viper.GetInt64("lock_hold_warn_ms")
+}
+
+// RequestMaxInFlight returns the maximum number of concurrent Range and Txn requests
+func (c *Config) RequestMaxInFlight() int64 {
+	return viper.GetInt64("request_max_in_flight")
+}
+
+// RequestReservedSystem returns the number of in-flight request slots reserved for system keys
+func (c *Config) RequestReservedSystem() int64 {
+	return viper.GetInt64("request_reserved_system")
+}
+
+// RequestSystemKeyPrefixes returns the key prefixes of system (prioritized) requests
+func (c *Config) RequestSystemKeyPrefixes() []string {
+	var prefixes []string
+	for _, prefix := range strings.Split(viper.GetString("request_system_key_prefixes"), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// RequestClientRateLimit returns the maximum number of Range and Txn requests per second per client
+func (c *Config) RequestClientRateLimit() int64 {
+	return viper.GetInt64("request_client_rate_limit")
+}
+
+// RangeCacheSizeMB returns the maximum size in MB of cached Range responses
+func (c *Config) RangeCacheSizeMB() int64 {
+	return viper.GetInt64("range_cache_size_mb")
+}
+
+// RangeCacheVerifyPercent returns the percentage of Range requests served
+// from the range cache which are verified against the local db
+func (c *Config) RangeCacheVerifyPercent() int64 {
+	return viper.GetInt64("range_cache_verify_percent")
+}
+
+// ClientOverrides returns the per-client settings, which are parsed by the client API server
+func (c *Config) ClientOverrides() string {
+	return viper.GetString("client_overrides")
+}
+
+// AdminClientIdentities returns the TLS client certificate common names
+// allowed to call the Admin API, or none if only the common name of
+// tls_client_cert is allowed
+func (c *Config) AdminClientIdentities() []string {
+	var identities []string
+	for _, identity := range strings.Split(viper.GetString("admin_client_identities"), ",") {
+		if identity = strings.TrimSpace(identity); identity != "" {
+			identities = append(identities, identity)
+		}
+	}
+	return identities
+}
+
+// ReadRules returns the semicolon-separated rules restricting access to key
+// prefixes by client
+func (c *Config) ReadRules() string {
+	return viper.GetString("read_rules")
+}
+
+// WriteKeyAllowedPrefixes returns the key prefixes writes are restricted to, or none if all keys are allowed
+func (c *Config) WriteKeyAllowedPrefixes() []string {
+	var prefixes []string
+	for _, prefix := range strings.Split(viper.GetString("write_key_allowed_prefixes"), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// AuditSinks returns the comma-separated sinks requests are audited to
+func (c *Config) AuditSinks() string {
+	return viper.GetString("audit_sinks")
+}
+
+// AuditFile returns the path to the file audit entries are appended to
+func (c *Config) AuditFile() string {
+	return absPath("audit_file")
+}
+
+// ValueTransformers returns the comma-separated transformers applied to values
+func (c *Config) ValueTransformers() string {
+	return viper.GetString("value_transformers")
+}
+
+// ValueEncryptionKeyFile returns the path to the aes-gcm value transformer's key
+func (c *Config) ValueEncryptionKeyFile() string {
+	return absPath("value_encryption_key_file")
+}
+
+// ValueHMACKeyFile returns the path to the hmac-sha256 value transformer's key
+func (c *Config) ValueHMACKeyFile() string {
+	return absPath("value_hmac_key_file")
+}
+
+// ValueTransformStrict returns whether values read must have been
+// transformed by every value transformer
+func (c *Config) ValueTransformStrict() bool {
+	return viper.GetBool("value_transform_strict")
+}
+
+// MemorySoftLimitMB returns the memory usage in MB above which new watches are rejected
+func (c *Config) MemorySoftLimitMB() int64 {
+	return viper.GetInt64("memory_soft_limit_mb")
+}
+
+// MemoryHardLimitMB returns the memory usage in MB above which a snapshot is forced
+func (c *Config) MemoryHardLimitMB() int64 {
+	return viper.GetInt64("memory_hard_limit_mb")
+}
+
+// MetricsTLS returns whether metrics are served over HTTPS
+func (c *Config) MetricsTLS() bool {
+	return viper.GetBool("metrics_tls")
+}
+
+// MetricsTLSClientAuth returns whether metrics clients must present a
+// certificate signed by the client CA
+func (c *Config) MetricsTLSClientAuth() bool {
+	return viper.GetBool("metrics_tls_client_auth")
+}
+
+// MetricsBearerTokenFile returns the path to the file containing the bearer
+// token metrics requests must present
+func (c *Config) MetricsBearerTokenFile() string {
+	return absPath("metrics_bearer_token_file")
+}
+
+// MetricsAllowedCIDRs returns the comma-separated CIDRs metrics requests are
+// restricted to
+func (c *Config) MetricsAllowedCIDRs() string {
+	return viper.GetString("metrics_allowed_cidrs")
+}
+
+// MetricsNamespacesMax returns the maximum number of namespaces labelled in
+// per-namespace write metrics, or 0 if they are disabled
+func (c *Config) MetricsNamespacesMax() int64 {
+	return viper.GetInt64("metrics_namespaces_max")
+}
+
+// ShadowEtcdEndpoints returns the comma-separated endpoints of the etcd
+// cluster writes are forwarded to, or empty if shadow mode is disabled
+func (c *Config) ShadowEtcdEndpoints() string {
+	return viper.GetString("shadow_etcd_endpoints")
+}
+
+// ShadowEtcdCA returns the path to the CA certificate of the shadow etcd
+func (c *Config) ShadowEtcdCA() string {
+	return absPath("shadow_etcd_ca")
+}
+
+// ShadowEtcdCert returns the path to the client certificate used when
+// connecting to the shadow etcd
+func (c *Config) ShadowEtcdCert() string {
+	return absPath("shadow_etcd_cert")
+}
+
+// ShadowEtcdKey returns the path to the private key of the shadow etcd
+// client certificate
+func (c *Config) ShadowEtcdKey() string {
+	return absPath("shadow_etcd_key")
+}
+
+// ShadowComparePrefix returns the prefix of the keys compared with the
+// shadow etcd
+func (c *Config) ShadowComparePrefix() string {
+	return viper.GetString("shadow_compare_prefix")
+}
+
+// ShadowCompareIntervalSeconds returns how often keys are compared with the
+// shadow etcd
+func (c *Config) ShadowCompareIntervalSeconds() int64 {
+	return viper.GetInt64("shadow_compare_interval_seconds")
+}
+
+// ProxyEtcdEndpoints returns the comma-separated endpoints of the upstream
+// etcd cluster, or empty if proxy mode is disabled
+func (c *Config) ProxyEtcdEndpoints() string {
+	return viper.GetString("proxy_etcd_endpoints")
+}
+
+// ProxyEtcdCA returns the path to the CA certificate of the upstream etcd
+func (c *Config) ProxyEtcdCA() string {
+	return absPath("proxy_etcd_ca")
+}
+
+// ProxyEtcdCert returns the path to the client certificate used when
+// connecting to the upstream etcd
+func (c *Config) ProxyEtcdCert() string {
+	return absPath("proxy_etcd_cert")
+}
+
+// ProxyEtcdKey returns the path to the private key of the upstream etcd
+// client certificate
+func (c *Config) ProxyEtcdKey() string {
+	return absPath("proxy_etcd_key")
+}
+
+// ProxyWriteWaitTimeoutMS returns how long a forwarded write waits for its
+// revision to be replicated locally
+func (c *Config) ProxyWriteWaitTimeoutMS() int64 {
+	return viper.GetInt64("proxy_write_wait_timeout_ms")
+}
@@ -0,0 +1,35 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package configtest changes the global config in tests, restoring it once
+// each test completes, so that tests do not affect the config of the tests
+// which run after them
+package configtest
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// Set sets config values until the test completes
+func Set(t testing.TB, settings map[string]any) {
+	t.Helper()
+	for key, value := range settings {
+		Restore(t, key)
+		viper.Set(key, value)
+	}
+}
+
+// Restore restores the current values of keys once the test completes, for
+// tests which change them other than with Set, e.g. by calling code which
+// sets them
+func Restore(t testing.TB, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		previous := viper.Get(key)
+		t.Cleanup(func() {
+			viper.Set(key, previous)
+		})
+	}
+}
@@ -56,3 +56,29 @@ func LoadTLSFiles(c *Config) (*TLSFiles, error) {
 		ClientCert: &clientCert,
 	}, nil
 }
+
+// LoadEtcdClientTLS returns the TLS config for connecting to an etcd cluster
+// (e.g. the shadow etcd) with the given CA, and client certificate and key
+// if cert is set. It returns nil if ca is empty, to connect without TLS.
+func LoadEtcdClientTLS(name, ca, cert, key string) (*tls.Config, error) {
+	if ca == "" {
+		return nil, nil
+	}
+	caPem, err := os.ReadFile(ca)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s CA file: %w", name, err)
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("failed to append %s CA cert to pool", name)
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: caPool}
+	if cert != "" {
+		keyPair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s cert %s and key %s: %w", name, cert, key, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{keyPair}
+	}
+	return tlsConfig, nil
+}
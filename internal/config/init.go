@@ -20,8 +20,8 @@ func init() {
 			panic("Unexpected missing viper tag on Config struct")
 		}
 		// set default
-		if defaultValue, ok := field.Tag.Lookup("default"); ok {
-			viper.SetDefault(viperKey, defaultValue)
+		if _, ok := field.Tag.Lookup("default"); ok {
+			viper.SetDefault(viperKey, fieldDefault(field))
 		}
 		// bind env
 		if envkey, ok := field.Tag.Lookup("envkey"); ok {
@@ -0,0 +1,72 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// fieldDefault returns the default value of a config variable, which is
+// its default tag unless the default depends on the OS, as for data_dir,
+// whose default tag is empty (see osDataDir)
+func fieldDefault(field reflect.StructField) string {
+	if field.Tag.Get("viper") == "data_dir" {
+		return osDataDir(runtime.GOOS, os.UserConfigDir)
+	}
+	return field.Tag.Get("default")
+}
+
+// osDataDir returns the default data_dir on goos. On Linux this is
+// /opt/data, e.g. a volume mounted into the container, but on other OSes
+// (typically dev clusters) /opt is not writable by users, so netsy/data in
+// the user's config directory is used instead, falling back to ./data.
+func osDataDir(goos string, userConfigDir func() (string, error)) string {
+	if goos == "linux" {
+		return "/opt/data"
+	}
+	dir, err := userConfigDir()
+	if err != nil || dir == "" {
+		return filepath.Join(".", "data")
+	}
+	return filepath.Join(dir, "netsy", "data")
+}
+
+// absPath returns the value of the config variable key normalized to an
+// absolute path using the OS's separators, expanding a leading ~ to the
+// user's home directory, and stores the normalized path so it is only
+// normalized once. Empty paths are left empty.
+func absPath(key string) string {
+	path := viper.GetString(key)
+	if path == "" {
+		return path
+	}
+	normalized := normalizePath(path, os.UserHomeDir)
+	if normalized != path {
+		viper.Set(key, normalized)
+	}
+	return normalized
+}
+
+// normalizePath returns path as an absolute path using the OS's
+// separators, expanding a leading ~ using homeDir. path is returned as-is
+// if it cannot be made absolute.
+func normalizePath(path string, homeDir func() (string, error)) string {
+	path = filepath.FromSlash(path)
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		if home, err := homeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
@@ -0,0 +1,83 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+)
+
+func TestOSDataDir(t *testing.T) {
+	configDir := func() (string, error) {
+		return filepath.FromSlash("/home/user/.config"), nil
+	}
+	noConfigDir := func() (string, error) {
+		return "", errors.New("no config dir")
+	}
+	for _, tc := range []struct {
+		goos          string
+		userConfigDir func() (string, error)
+		expected      string
+	}{
+		{"linux", configDir, "/opt/data"},
+		{"darwin", configDir, filepath.FromSlash("/home/user/.config/netsy/data")},
+		{"windows", configDir, filepath.FromSlash("/home/user/.config/netsy/data")},
+		{"windows", noConfigDir, "data"},
+	} {
+		if dir := osDataDir(tc.goos, tc.userConfigDir); dir != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.goos, tc.expected, dir)
+		}
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	home := func() (string, error) {
+		return filepath.FromSlash("/home/user"), nil
+	}
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path     string
+		expected string
+	}{
+		{"./data", filepath.Join(cwd, "data")},
+		{"data/../certs/ca.pem", filepath.Join(cwd, "certs", "ca.pem")},
+		{"~/netsy/data", filepath.FromSlash("/home/user/netsy/data")},
+		{"~", filepath.FromSlash("/home/user")},
+		{"~other/data", filepath.Join(cwd, "~other", "data")},
+	} {
+		expected, _ := filepath.Abs(tc.expected)
+		if path := normalizePath(tc.path, home); path != expected {
+			t.Errorf("%s: expected %q, got %q", tc.path, expected, path)
+		}
+	}
+}
+
+func TestPathSettings(t *testing.T) {
+	c := &Config{}
+	for key, get := range map[string]func() string{
+		"data_dir":                  c.DataDir,
+		"tls_server_ca":             c.TLSServerCA,
+		"audit_file":                c.AuditFile,
+		"value_encryption_key_file": c.ValueEncryptionKeyFile,
+		"value_hmac_key_file":       c.ValueHMACKeyFile,
+		"metrics_bearer_token_file": c.MetricsBearerTokenFile,
+		"shadow_etcd_ca":            c.ShadowEtcdCA,
+		"shadow_etcd_cert":          c.ShadowEtcdCert,
+		"shadow_etcd_key":           c.ShadowEtcdKey,
+		"proxy_etcd_ca":             c.ProxyEtcdCA,
+		"proxy_etcd_cert":           c.ProxyEtcdCert,
+		"proxy_etcd_key":            c.ProxyEtcdKey,
+	} {
+		configtest.Set(t, map[string]any{key: "relative/" + key})
+		if path := get(); !filepath.IsAbs(path) {
+			t.Errorf("%s: expected an absolute path, got %q", key, path)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Sources of the value of a config variable
+const (
+	// SourceDefault is the default value of the variable
+	SourceDefault = "default"
+	// SourceEnv is the value of the variable's environment variable
+	SourceEnv = "env"
+	// SourceFlag is the value of the variable's command line flag
+	SourceFlag = "flag"
+	// SourceOverride is a value set by netsy itself, e.g. when embedded
+	SourceOverride = "override"
+)
+
+// Redacted replaces the value of secret config variables
+const Redacted = "[REDACTED]"
+
+// Setting is the effective value of a config variable, and where it came from
+type Setting struct {
+	Name        string
+	EnvKey      string
+	Value       string
+	Default     string
+	Source      string
+	Description string
+	// Secret is true if Value is redacted (unless it is empty)
+	Secret bool
+	// Path is true if Value is the path of a file or directory on this
+	// host, which is made absolute
+	Path bool
+}
+
+// Settings returns the effective value of every config variable, in the
+// order they are defined, with the values of secrets redacted
+func (c *Config) Settings() []Setting {
+	typeOf := reflect.TypeOf(runtimeConfig{})
+	settings := make([]Setting, 0, typeOf.NumField())
+	for i := range typeOf.NumField() {
+		field := typeOf.Field(i)
+		setting := Setting{
+			Name:        field.Tag.Get("viper"),
+			EnvKey:      field.Tag.Get("envkey"),
+			Default:     fieldDefault(field),
+			Description: field.Tag.Get("description"),
+			Secret:      field.Tag.Get("secret") == "true",
+			Path:        field.Tag.Get("path") == "true",
+		}
+		setting.Value = viper.GetString(setting.Name)
+		setting.Source = c.source(setting)
+		if setting.Secret && setting.Value != "" {
+			setting.Value = Redacted
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// source returns where the value of a config variable came from. Values are
+// read from (in order of precedence) flags, env vars and defaults, however
+// netsy may also set values itself, e.g. when paths are made absolute.
+func (c *Config) source(setting Setting) string {
+	if c.flags != nil {
+		// flags are named after their variable, with either underscores or
+		// dashes, e.g. --skip-backfill
+		for _, name := range []string{setting.Name, strings.ReplaceAll(setting.Name, "_", "-")} {
+			if flag := c.flags.Lookup(name); flag != nil && flag.Changed {
+				return SourceFlag
+			}
+		}
+	}
+	if setting.EnvKey != "" {
+		if _, ok := os.LookupEnv(setting.EnvKey); ok {
+			return SourceEnv
+		}
+	}
+	if setting.Value == setting.Default {
+		return SourceDefault
+	}
+	return SourceOverride
+}
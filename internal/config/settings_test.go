@@ -0,0 +1,67 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestSettings(t *testing.T) {
+	t.Setenv("NETSY_S3_BUCKET_NAME", "from-env")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	configtest.Set(t, map[string]any{"etcd_version": "3.4"})
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Bool("verbose", false, "")
+	viper.BindPFlag("verbose", flags.Lookup("verbose"))
+	flags.Bool("skip-backfill", false, "")
+	viper.BindPFlag("skip_backfill", flags.Lookup("skip-backfill"))
+	if err := flags.Parse([]string{"--verbose", "--skip-backfill"}); err != nil {
+		t.Fatal(err)
+	}
+	// flags cannot be unbound, so reset them to their defaults, which are
+	// only used if a value is not set otherwise
+	t.Cleanup(func() {
+		flags.VisitAll(func(flag *pflag.Flag) {
+			flag.Value.Set(flag.DefValue)
+			flag.Changed = false
+		})
+	})
+
+	c, _ := Init(log.NewNopLogger())
+	c.SetFlags(flags)
+	settings := map[string]Setting{}
+	for _, setting := range c.Settings() {
+		settings[setting.Name] = setting
+	}
+
+	for _, tc := range []struct {
+		name   string
+		value  string
+		source string
+	}{
+		{"environment", "development", SourceDefault},
+		{"s3_bucket_name", "from-env", SourceEnv},
+		{"s3_secret_access_key", Redacted, SourceEnv},
+		{"s3_session_token", "", SourceDefault},
+		{"etcd_version", "3.4", SourceOverride},
+		{"verbose", "true", SourceFlag},
+		{"skip_backfill", "true", SourceFlag},
+	} {
+		setting, ok := settings[tc.name]
+		if !ok {
+			t.Fatalf("missing setting %s", tc.name)
+		}
+		if setting.Value != tc.value || setting.Source != tc.source {
+			t.Errorf("%s: expected value %q from %s, got %q from %s", tc.name, tc.value, tc.source, setting.Value, setting.Source)
+		}
+	}
+	if !settings["s3_secret_access_key"].Secret || settings["s3_bucket_name"].Secret {
+		t.Errorf("expected only s3_secret_access_key to be secret")
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// RequiresStrictValueTransform returns true if transformers includes a
+// transformer which protects values (aes-gcm or hmac-sha256). Values are
+// read as-is if they do not have a transformer's prefix, so unless reads
+// are strict, a value written other than by netsy (e.g. by editing the
+// local db or S3 directly) without the prefix would be read unencrypted
+// and unsigned.
+func RequiresStrictValueTransform(transformers string) bool {
+	for _, name := range strings.Split(transformers, ",") {
+		switch strings.TrimSpace(name) {
+		case "aes-gcm", "hmac-sha256":
+			return true
+		}
+	}
+	return false
+}
+
+// validateValueTransformStrict checks value_transform_strict is enabled if
+// the configured value_transformers require it
+func validateValueTransformStrict(sl validator.StructLevel) {
+	config := sl.Current().Interface().(runtimeConfig)
+	if RequiresStrictValueTransform(config.ValueTransformers) && !config.ValueTransformStrict {
+		sl.ReportError(config.ValueTransformStrict, "ValueTransformStrict", "ValueTransformStrict", "value_transform_strict", "")
+	}
+}
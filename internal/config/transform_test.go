@@ -0,0 +1,20 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestRequiresStrictValueTransform(t *testing.T) {
+	for transformers, expected := range map[string]bool{
+		"":                         false,
+		"zstd":                     false,
+		"aes-gcm":                  true,
+		"zstd, hmac-sha256":        true,
+		"zstd,aes-gcm,hmac-sha256": true,
+	} {
+		if required := RequiresStrictValueTransform(transformers); required != expected {
+			t.Errorf("%q: expected %v, got %v", transformers, expected, required)
+		}
+	}
+}
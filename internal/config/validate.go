@@ -57,6 +57,10 @@ func (c *Config) Validate() error {
 	if err := validate.RegisterValidation("puidv7", validatePuidv7); err != nil {
 		return fmt.Errorf("error registering puidv7 validator for config validation: %w", err)
 	}
+	validate.RegisterStructValidation(func(sl validator.StructLevel) {
+		validateCompactionRetention(sl)
+		validateValueTransformStrict(sl)
+	}, runtimeConfig{})
 	err := validate.Struct(config)
 	if err != nil {
 		msg := ""
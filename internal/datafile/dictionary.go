@@ -0,0 +1,60 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package datafile
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DictionaryMaxSize is the default maximum size of a trained dictionary
+const DictionaryMaxSize = 64 * 1024
+
+// dictionaryMinSamples is the minimum number of samples required for training
+const dictionaryMinSamples = 16
+
+// Dictionary is a zstd dictionary used to compress small files, such as
+// single record chunks, which otherwise compress poorly
+type Dictionary struct {
+	ID   uint32
+	Data []byte
+}
+
+// DictionaryLoader returns the dictionary with the given ID
+type DictionaryLoader func(id uint32) (*Dictionary, error)
+
+// TrainDictionary builds a dictionary from sample values (e.g. recent record
+// values). The dictionary ID is taken from the trained dictionary, which is
+// randomly assigned.
+func TrainDictionary(samples [][]byte, maxSize int) (dictionary *Dictionary, err error) {
+	if len(samples) < dictionaryMinSamples {
+		return nil, fmt.Errorf("not enough samples to train dictionary: %d < %d", len(samples), dictionaryMinSamples)
+	}
+	if maxSize <= 0 {
+		maxSize = DictionaryMaxSize
+	}
+	data, err := dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes:   6,
+		ZstdLevel:   zstd.SpeedDefault,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build dictionary: %w", err)
+	}
+	return ParseDictionary(data)
+}
+
+// ParseDictionary validates a serialized zstd dictionary and reads its ID
+func ParseDictionary(data []byte) (dictionary *Dictionary, err error) {
+	header, err := zstd.InspectDictionary(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect dictionary: %w", err)
+	}
+	if header.ID() == 0 {
+		return nil, fmt.Errorf("dictionary has no ID")
+	}
+	return &Dictionary{ID: header.ID(), Data: data}, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package datafile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"testing"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestDictionaryRoundTrip(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 200; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"kind":"Lease","apiVersion":"coordination.k8s.io/v1","metadata":{"name":"node-%d","namespace":"kube-node-lease"},"spec":{"holderIdentity":"node-%d","leaseDurationSeconds":40}}`, i, i)))
+	}
+	dictionary, err := TrainDictionary(samples, 0)
+	if err != nil {
+		t.Fatalf("TrainDictionary: %v", err)
+	}
+
+	// write a single record chunk using the dictionary
+	buffer := &bytes.Buffer{}
+	bufWriter := bufio.NewWriter(buffer)
+	writer, err := NewWriterWithDictionary(bufWriter, pb.FileKind_KIND_CHUNK, 1, "test", dictionary, CompressionOptions{})
+	if err != nil {
+		t.Fatalf("NewWriterWithDictionary: %v", err)
+	}
+	if err = writer.Write(&pb.Record{Revision: 1, Key: []byte("/registry/leases/node-1"), Value: samples[1]}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	data := buffer.Bytes()
+
+	// reading without the dictionary must fail
+	if _, err = NewReader(bufio.NewReader(bytes.NewReader(data)), nil); err == nil {
+		t.Fatalf("expected NewReader to fail without dictionary")
+	}
+
+	loadDictionary := func(id uint32) (*Dictionary, error) {
+		if id != dictionary.ID {
+			t.Fatalf("expected dictionary %d, got %d", dictionary.ID, id)
+		}
+		return dictionary, nil
+	}
+	reader, err := NewReaderWithDictionaries(bufio.NewReader(bytes.NewReader(data)), nil, loadDictionary)
+	if err != nil {
+		t.Fatalf("NewReaderWithDictionaries: %v", err)
+	}
+	record, err := reader.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !bytes.Equal(record.Value, samples[1]) {
+		t.Fatalf("value mismatch: %q", record.Value)
+	}
+	if _, err = reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestTrainDictionaryTooFewSamples(t *testing.T) {
+	if _, err := TrainDictionary([][]byte{[]byte("a")}, 0); err == nil {
+		t.Fatalf("expected error for too few samples")
+	}
+}
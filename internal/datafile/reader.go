@@ -18,12 +18,15 @@ import (
 )
 
 type Reader struct {
+	header               *pb.FileHeader
+	footer               *pb.FileFooter
 	buffer               *bufio.Reader
 	decompressor         *zstd.Decoder
 	reader               *bufio.Reader // Either decompressed or raw buffer
 	hasher               hash.Hash64
 	kind                 pb.FileKind
 	compression          pb.FileCompression
+	schemaVersion        uint32
 	expectedRecordsCount int64
 	firstRevision        int64
 	lastRevision         int64
@@ -35,21 +38,24 @@ type ReadResults struct {
 	RecordsCount  int64
 	FirstRevision int64
 	LastRevision  int64
+	RecordsCrc    uint64
+	SchemaVersion uint32
 }
 
 func NewReader(buffer *bufio.Reader, expectKind *pb.FileKind) (*Reader, error) {
-	// Always read header uncompressed first
+	return NewReaderWithDictionaries(buffer, expectKind, nil)
+}
+
+// ReadHeader reads and verifies the header of a file from buffer, without
+// reading any records
+func ReadHeader(buffer *bufio.Reader) (*pb.FileHeader, error) {
+	// The header is always uncompressed
 	var header pb.FileHeader
 	err := protodelim.UnmarshalFrom(buffer, &header)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read header: %w", err)
 	}
 
-	// Check kind matches expected
-	if expectKind != nil && *expectKind != header.Kind {
-		return nil, fmt.Errorf("expected kind mismatch - expected %d, got %d", expectKind, header.Kind)
-	}
-
 	// Validate compression type
 	if header.Compression == pb.FileCompression_COMPRESSION_UNKNOWN {
 		return nil, fmt.Errorf("unknown compression type in header")
@@ -72,13 +78,47 @@ func NewReader(buffer *bufio.Reader, expectKind *pb.FileKind) (*Reader, error) {
 		return nil, fmt.Errorf("header CRC %d mismatch - expected %d", actualCrc, header.Crc)
 	}
 
+	// Check the file can be read by this version
+	if err = checkSchemaVersion(header.SchemaVersion); err != nil {
+		return nil, err
+	}
+
+	return &header, nil
+}
+
+// NewReaderWithDictionaries creates a reader which can read files compressed
+// with a zstd dictionary, using loadDictionary to look up the dictionary
+// referenced by the file header. loadDictionary may be nil, in which case
+// files which reference a dictionary cannot be read.
+func NewReaderWithDictionaries(buffer *bufio.Reader, expectKind *pb.FileKind, loadDictionary DictionaryLoader) (*Reader, error) {
+	header, err := ReadHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check kind matches expected
+	if expectKind != nil && *expectKind != header.Kind {
+		return nil, fmt.Errorf("expected kind mismatch - expected %d, got %d", expectKind, header.Kind)
+	}
+
 	// Set up record reader based on compression type from header
 	var decompressor *zstd.Decoder
 	var recordReader io.Reader = buffer
 
 	if header.Compression == pb.FileCompression_COMPRESSION_ZSTD {
 		// Records and footer are compressed
-		decompressor, err = zstd.NewReader(buffer)
+		var options []zstd.DOption
+		if header.DictionaryId != 0 {
+			if loadDictionary == nil {
+				return nil, fmt.Errorf("file requires dictionary %d but no dictionary loader was provided", header.DictionaryId)
+			}
+			dictionary, err := loadDictionary(header.DictionaryId)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load dictionary %d: %w", header.DictionaryId, err)
+			}
+			options = append(options, zstd.WithDecoderDicts(dictionary.Data))
+		}
+		decompressor, err = zstd.NewReader(buffer, options...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create zstd decompressor: %w", err)
 		}
@@ -88,16 +128,29 @@ func NewReader(buffer *bufio.Reader, expectKind *pb.FileKind) (*Reader, error) {
 
 	// Return a reader
 	return &Reader{
+		header:               header,
 		buffer:               buffer,
 		decompressor:         decompressor,
 		reader:               bufio.NewReader(recordReader),
 		hasher:               crc64.New(crcTable),
 		kind:                 header.Kind,
 		compression:          header.Compression,
+		schemaVersion:        header.SchemaVersion,
 		expectedRecordsCount: header.RecordsCount,
 	}, nil
 }
 
+// Header returns the file header, which has been verified
+func (r *Reader) Header() *pb.FileHeader {
+	return r.header
+}
+
+// Footer returns the file footer once Close has read and verified it, or nil
+// before then
+func (r *Reader) Footer() *pb.FileFooter {
+	return r.footer
+}
+
 func (r *Reader) Count() int64 {
 	return r.expectedRecordsCount
 }
@@ -144,11 +197,24 @@ func (r *Reader) Read() (record *pb.Record, err error) {
 	r.lastCount++
 	r.lastRevision = record.Revision
 
+	// Translate records from older schema versions (after CRC verification,
+	// as CRCs are calculated over the record as written)
+	if err = upgradeRecord(record, r.schemaVersion); err != nil {
+		return nil, err
+	}
+	if err = checkEntries(r.kind, record); err != nil {
+		return nil, err
+	}
+
 	// Return record
 	return record, nil
 }
 
+// Close verifies the footer once all records have been read, and releases
+// the reader (see Release)
 func (r *Reader) Close() (results ReadResults, err error) {
+	defer r.Release()
+
 	// Check last count matches expected records count from header
 	if r.lastCount != r.expectedRecordsCount {
 		return ReadResults{}, fmt.Errorf("last count %d does not match expected count %d", r.lastCount, r.expectedRecordsCount)
@@ -196,10 +262,23 @@ func (r *Reader) Close() (results ReadResults, err error) {
 		return ReadResults{}, fmt.Errorf("last revision %d does not match expected last revision %d", r.lastRevision, footer.LastRevision)
 	}
 
+	r.footer = &footer
 	return ReadResults{
 		Kind:          r.kind.String(),
 		RecordsCount:  r.lastCount,
 		FirstRevision: r.firstRevision,
 		LastRevision:  r.lastRevision,
+		RecordsCrc:    recordsCrc,
+		SchemaVersion: r.schemaVersion,
 	}, nil
 }
+
+// Release releases the zstd decompressor (and its goroutines) used to read
+// compressed files. Callers which stop reading before Close, e.g. on error,
+// must call Release. It is safe to call more than once.
+func (r *Reader) Release() {
+	if r.decompressor != nil {
+		r.decompressor.Close()
+		r.decompressor = nil
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package datafile
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+var updateGolden = flag.Bool("update", false, "regenerate golden datafiles in testdata")
+
+// goldenFile is a datafile test vector in testdata, written by an earlier
+// version of netsy, which must remain readable
+type goldenFile struct {
+	name        string
+	kind        pb.FileKind
+	compression pb.FileCompression
+	results     ReadResults
+}
+
+var goldenFiles = []goldenFile{
+	{"chunk-none.netsy", pb.FileKind_KIND_CHUNK, pb.FileCompression_COMPRESSION_NONE,
+		ReadResults{Kind: "KIND_CHUNK", RecordsCount: 3, FirstRevision: 1, LastRevision: 3, SchemaVersion: 1}},
+	{"snapshot-zstd.netsy", pb.FileKind_KIND_SNAPSHOT, pb.FileCompression_COMPRESSION_ZSTD,
+		ReadResults{Kind: "KIND_SNAPSHOT", RecordsCount: 3, FirstRevision: 1, LastRevision: 3, SchemaVersion: 1}},
+}
+
+// goldenRecords returns the records written to golden files
+func goldenRecords() []*pb.Record {
+	return []*pb.Record{
+		{Revision: 1, Key: []byte("/registry/pods/default/a"), Value: []byte("a1"), Created: true, CreateRevision: 1, Version: 1, LeaderId: "golden"},
+		{Revision: 2, Key: []byte("/registry/pods/default/a"), Value: []byte("a2"), CreateRevision: 1, PrevRevision: 1, Version: 2, LeaderId: "golden"},
+		{Revision: 3, Key: []byte("/registry/pods/default/a"), Deleted: true, CreateRevision: 1, PrevRevision: 2, Version: 3, LeaderId: "golden"},
+	}
+}
+
+// readAll reads a whole datafile, returning the first error
+func readAll(data []byte) (results ReadResults, err error) {
+	reader, err := NewReader(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return results, err
+	}
+	for i := int64(0); i < reader.Count(); i++ {
+		if _, err = reader.Read(); err != nil {
+			return results, err
+		}
+	}
+	return reader.Close()
+}
+
+// readGolden returns the contents of a golden file, regenerating it first
+// if -update is set
+func readGolden(t testing.TB, golden goldenFile) []byte {
+	t.Helper()
+	path := filepath.Join("testdata", golden.name)
+	if *updateGolden {
+		buffer := &bytes.Buffer{}
+		bufWriter := bufio.NewWriter(buffer)
+		records := goldenRecords()
+		writer, err := NewWriterWithCompression(bufWriter, golden.kind, int64(len(records)), "golden", &golden.compression)
+		if err != nil {
+			t.Fatalf("NewWriterWithCompression: %v", err)
+		}
+		for _, record := range records {
+			if err = writer.Write(record); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+		}
+		if err = writer.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if err = os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	return data
+}
+
+func TestReaderGoldenFiles(t *testing.T) {
+	for _, golden := range goldenFiles {
+		t.Run(golden.name, func(t *testing.T) {
+			results, err := readAll(readGolden(t, golden))
+			if err != nil {
+				t.Fatalf("failed to read golden file: %v", err)
+			}
+			results.RecordsCrc = 0
+			if results != golden.results {
+				t.Errorf("results = %+v, want %+v", results, golden.results)
+			}
+		})
+	}
+}
+
+func TestReaderCorruptedGoldenFiles(t *testing.T) {
+	for _, golden := range goldenFiles {
+		data := readGolden(t, golden)
+		t.Run(golden.name+"/truncated", func(t *testing.T) {
+			for n := 0; n < len(data); n++ {
+				if _, err := readAll(data[:n]); err == nil {
+					t.Errorf("no error reading file truncated to %d of %d bytes", n, len(data))
+				}
+			}
+		})
+		t.Run(golden.name+"/corrupted", func(t *testing.T) {
+			for i := 0; i < len(data); i++ {
+				corrupted := bytes.Clone(data)
+				corrupted[i] ^= 0xff
+				if _, err := readAll(corrupted); err == nil {
+					t.Errorf("no error reading file with byte %d of %d corrupted", i, len(data))
+				}
+			}
+		})
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	for _, golden := range goldenFiles {
+		f.Add(readGolden(f, golden))
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0x00})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x0f})
+	// Malformed files must produce an error rather than panic or hang
+	f.Fuzz(func(t *testing.T, data []byte) {
+		readAll(data)
+	})
+}
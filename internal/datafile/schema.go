@@ -0,0 +1,77 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package datafile
+
+import (
+	"fmt"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+// SchemaVersion is the schema version of files written by this version of
+// netsy. It must be incremented whenever the meaning of file contents
+// changes, along with adding an entry to recordUpgrades for the old version.
+const SchemaVersion uint32 = 1
+
+// schemaVersionUnversioned is the schema version of files written before
+// the schema version was recorded, which have the same format as version 1
+const schemaVersionUnversioned uint32 = 0
+
+// recordUpgrades translates records read from files with an older schema
+// version. recordUpgrades[v] converts a record from version v to version
+// v+1, and they are applied in sequence up to SchemaVersion.
+var recordUpgrades = map[uint32]func(record *pb.Record) error{
+	schemaVersionUnversioned: func(record *pb.Record) error {
+		return nil
+	},
+}
+
+// checkSchemaVersion returns an error if files with the given schema version
+// cannot be read, either because they were written by a newer version of
+// netsy or because there is no upgrade path from an older version
+func checkSchemaVersion(version uint32) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("file schema version %d is newer than supported version %d - upgrade netsy to read this file", version, SchemaVersion)
+	}
+	for v := version; v < SchemaVersion; v++ {
+		if _, ok := recordUpgrades[v]; !ok {
+			return fmt.Errorf("file schema version %d is no longer supported (no upgrade from version %d) - read it with an older netsy version and rewrite it", version, v)
+		}
+	}
+	return nil
+}
+
+// upgradeRecord translates a record read from a file with the given schema
+// version to the current schema version
+func upgradeRecord(record *pb.Record, version uint32) error {
+	for v := version; v < SchemaVersion; v++ {
+		if err := recordUpgrades[v](record); err != nil {
+			return fmt.Errorf("failed to upgrade record %d from schema version %d: %w", record.Revision, v, err)
+		}
+	}
+	return nil
+}
+
+// checkEntries returns an error unless record belongs in a file of kind:
+// lease files only contain lease entries, snapshot manifests only contain
+// snapshot parts, and other files neither, so that they are never imported
+// as keys
+func checkEntries(kind pb.FileKind, record *pb.Record) error {
+	if err := checkEntry(kind, pb.FileKind_KIND_LEASES, record, record.LeaseEntry != nil, "lease entry"); err != nil {
+		return err
+	}
+	return checkEntry(kind, pb.FileKind_KIND_SNAPSHOT_MANIFEST, record, record.SnapshotPart != nil, "snapshot part")
+}
+
+// checkEntry returns an error if record, in a file of kind, has an entry
+// (named name) but entryKind is another kind, or has none but is of entryKind
+func checkEntry(kind pb.FileKind, entryKind pb.FileKind, record *pb.Record, hasEntry bool, name string) error {
+	if kind == entryKind && !hasEntry {
+		return fmt.Errorf("record %d in %s file has no %s", record.Revision, kind, name)
+	}
+	if kind != entryKind && hasEntry {
+		return fmt.Errorf("record %d in %s file has a %s", record.Revision, kind, name)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package datafile
+
+import (
+	"bufio"
+	"bytes"
+	"hash/crc64"
+	"strings"
+	"testing"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+)
+
+// headerOnly returns file data containing only a valid header with the given
+// schema version
+func headerOnly(t *testing.T, version uint32) []byte {
+	t.Helper()
+	header := &pb.FileHeader{
+		SchemaVersion: version,
+		Kind:          pb.FileKind_KIND_CHUNK,
+		Compression:   pb.FileCompression_COMPRESSION_NONE,
+	}
+	data, err := proto.Marshal(header)
+	if err != nil {
+		t.Fatalf("failed to marshal header: %v", err)
+	}
+	header.Crc = crc64.Checksum(data, crcTable)
+	buffer := &bytes.Buffer{}
+	if _, err = protodelim.MarshalTo(buffer, header); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestSchemaVersionWritten(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	bufWriter := bufio.NewWriter(buffer)
+	writer, err := NewWriter(bufWriter, pb.FileKind_KIND_CHUNK, 1, "test")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err = writer.Write(&pb.Record{Revision: 1, Key: []byte("k")}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reader, err := NewReader(bufio.NewReader(buffer), nil)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if _, err = reader.Read(); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	results, err := reader.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if results.SchemaVersion != SchemaVersion {
+		t.Fatalf("expected schema version %d, got %d", SchemaVersion, results.SchemaVersion)
+	}
+}
+
+func TestSchemaVersionChecked(t *testing.T) {
+	// unversioned files are readable
+	if _, err := NewReader(bufio.NewReader(bytes.NewReader(headerOnly(t, 0))), nil); err != nil {
+		t.Fatalf("expected unversioned file to be readable: %v", err)
+	}
+
+	// files from newer versions are rejected with an upgrade error
+	_, err := NewReader(bufio.NewReader(bytes.NewReader(headerOnly(t, SchemaVersion+1))), nil)
+	if err == nil || !strings.Contains(err.Error(), "upgrade netsy") {
+		t.Fatalf("expected upgrade error, got %v", err)
+	}
+}
+
+func TestLeaseEntriesOnlyInLeaseFiles(t *testing.T) {
+	entry := &pb.LeaseEntry{Event: pb.LeaseEntry_EVENT_GRANTED, Id: 7, Ttl: 60}
+
+	// lease files round trip their lease entries, and reject records
+	// without one
+	buffer := &bytes.Buffer{}
+	bufWriter := bufio.NewWriter(buffer)
+	writer, err := NewWriter(bufWriter, pb.FileKind_KIND_LEASES, 1, "test")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err = writer.Write(&pb.Record{Revision: 3, Key: []byte("k")}); err == nil {
+		t.Fatalf("expected a record without a lease entry to be rejected")
+	}
+	if err = writer.Write(&pb.Record{Revision: 3, LeaseEntry: entry}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	expectedKind := pb.FileKind_KIND_LEASES
+	reader, err := NewReader(bufio.NewReader(buffer), &expectedKind)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	record, err := reader.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !proto.Equal(record.LeaseEntry, entry) {
+		t.Fatalf("expected lease entry %v, got %v", entry, record.LeaseEntry)
+	}
+	if _, err = reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// other files reject lease entries
+	writer, err = NewWriter(bufio.NewWriter(&bytes.Buffer{}), pb.FileKind_KIND_CHUNK, 1, "test")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err = writer.Write(&pb.Record{Revision: 3, LeaseEntry: entry}); err == nil {
+		t.Fatalf("expected a lease entry in a chunk to be rejected")
+	}
+}
+
+func TestSnapshotPartsOnlyInManifests(t *testing.T) {
+	part := &pb.SnapshotPart{Key: "snapshots/0000000000000000010/00001.netsy", FirstRevision: 1, LastRevision: 10, RecordsCount: 10}
+	writer, err := NewWriter(bufio.NewWriter(&bytes.Buffer{}), pb.FileKind_KIND_SNAPSHOT_MANIFEST, 1, "test")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err = writer.Write(&pb.Record{Revision: 10, Key: []byte("k")}); err == nil {
+		t.Fatalf("expected a record without a snapshot part to be rejected")
+	}
+	if err = writer.Write(&pb.Record{Revision: 10, SnapshotPart: part, LeaseEntry: &pb.LeaseEntry{}}); err == nil {
+		t.Fatalf("expected a lease entry in a snapshot manifest to be rejected")
+	}
+	if err = writer.Write(&pb.Record{Revision: 10, SnapshotPart: part}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	writer, err = NewWriter(bufio.NewWriter(&bytes.Buffer{}), pb.FileKind_KIND_SNAPSHOT, 1, "test")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err = writer.Write(&pb.Record{Revision: 10, SnapshotPart: part}); err == nil {
+		t.Fatalf("expected a snapshot part in a snapshot to be rejected")
+	}
+}
@@ -9,18 +9,51 @@ import (
 	"hash"
 	"hash/crc64"
 	"io"
+	"time"
 
 	"github.com/klauspost/compress/zstd"
+	"github.com/nadrama-com/netsy/internal/metrics"
 	pb "github.com/nadrama-com/netsy/internal/proto"
 	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// CompressionOptions tunes zstd compression, trading speed for ratio. The
+// zero value uses the zstd defaults.
+type CompressionOptions struct {
+	// Level is a zstd compression level, from 1 (fastest) to 22 (best
+	// ratio), which is mapped to the nearest supported encoder level.
+	// 0 uses the default level.
+	Level int
+	// WindowSize is the zstd window size in bytes, which must be a power of
+	// 2 between 1KB and 512MB. Larger windows can improve the ratio of large
+	// files at the cost of memory. 0 uses the default window size.
+	WindowSize int
+	// MinSize is the serialized size of a chunk's records in bytes above
+	// which NewWriterWithSmartCompression compresses it. 0 uses
+	// DefaultCompressionMinSize.
+	MinSize int
+}
+
+// encoderOptions returns the zstd encoder options for o
+func (o CompressionOptions) encoderOptions() []zstd.EOption {
+	var options []zstd.EOption
+	if o.Level > 0 {
+		options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(o.Level)))
+	}
+	if o.WindowSize > 0 {
+		options = append(options, zstd.WithWindowSize(o.WindowSize))
+	}
+	return options
+}
+
 type Writer struct {
 	buffer        *bufio.Writer
 	compressor    *zstd.Encoder
-	recordWriter  io.Writer // Either compressor or buffer directly for records/footer
+	recordWriter  io.Writer      // Either compressor or buffer directly for records/footer
+	compressStats *compressStats // nil if not compressed
 	hasher        hash.Hash64
 	kind          pb.FileKind
 	compression   pb.FileCompression
@@ -34,32 +67,84 @@ func NewWriter(buffer *bufio.Writer, kind pb.FileKind, recordsCount int64, leade
 	return NewWriterWithCompression(buffer, kind, recordsCount, leaderID, nil)
 }
 
+// NewWriterWithCompressionOptions creates a writer like
+// NewWriterWithCompression, using the given zstd options if compressed
+func NewWriterWithCompressionOptions(buffer *bufio.Writer, kind pb.FileKind, recordsCount int64, leaderID string, forceCompression *pb.FileCompression, options CompressionOptions) (*Writer, error) {
+	return newWriter(buffer, kind, recordsCount, leaderID, forceCompression, nil, options)
+}
+
+// DefaultCompressionMinSize is the serialized size of a chunk's records in
+// bytes above which NewWriterWithSmartCompression compresses it, if
+// CompressionOptions.MinSize is not set
+const DefaultCompressionMinSize = 4096
+
 // NewWriterWithSmartCompression creates a writer that determines compression based on content size for chunks
-func NewWriterWithSmartCompression(buffer *bufio.Writer, kind pb.FileKind, records []*pb.Record, leaderID string) (*Writer, error) {
+func NewWriterWithSmartCompression(buffer *bufio.Writer, kind pb.FileKind, records []*pb.Record, leaderID string, options CompressionOptions) (*Writer, error) {
 	var compression pb.FileCompression
-	
+	var size int
 	if kind == pb.FileKind_KIND_SNAPSHOT {
 		// Always compress snapshots for internal Netsy use
 		compression = pb.FileCompression_COMPRESSION_ZSTD
 	} else {
-		// For chunks, estimate size from key + value data
-		totalSize := 0
-		for _, record := range records {
-			totalSize += len(record.Key) + len(record.Value)
+		// For chunks, compress if the records are large enough to benefit,
+		// as zstd frame overhead outweighs any saving on small chunks
+		minSize := options.MinSize
+		if minSize <= 0 {
+			minSize = DefaultCompressionMinSize
 		}
-		
-		// Use compression for chunks > 4KB
-		if totalSize > 4096 {
+		size = RecordsSize(records)
+		if size > minSize {
 			compression = pb.FileCompression_COMPRESSION_ZSTD
 		} else {
 			compression = pb.FileCompression_COMPRESSION_NONE
 		}
+		metrics.DatafileSmartCompressionSize.WithLabelValues(compression.String()).Observe(float64(size))
+	}
+
+	w, err := newWriter(buffer, kind, int64(len(records)), leaderID, &compression, nil, options)
+	if err != nil {
+		return nil, err
+	}
+	if w.compressStats != nil && kind != pb.FileKind_KIND_SNAPSHOT {
+		w.compressStats.smart = true
+	}
+	return w, nil
+}
+
+// RecordsSize returns the size in bytes of records as serialized by Write,
+// i.e. including protobuf field overhead and each record's length prefix
+func RecordsSize(records []*pb.Record) (size int) {
+	for _, record := range records {
+		// Write sets the CRC, which is counted even if it is not yet set
+		recordSize := proto.Size(record)
+		if record.Crc == 0 {
+			recordSize += crcFieldSize
+		}
+		size += protowire.SizeBytes(recordSize)
+	}
+	return size
+}
+
+// crcFieldSize is the size of a record's CRC field once set, at most a
+// 1 byte tag and a 10 byte varint
+const crcFieldSize = 1 + 10
+
+// NewWriterWithDictionary creates a writer which always compresses records
+// using the given zstd dictionary, which is referenced in the file header.
+// This suits small chunks which otherwise compress poorly.
+func NewWriterWithDictionary(buffer *bufio.Writer, kind pb.FileKind, recordsCount int64, leaderID string, dictionary *Dictionary, options CompressionOptions) (*Writer, error) {
+	if dictionary == nil {
+		return nil, fmt.Errorf("dictionary is required")
 	}
-	
-	return NewWriterWithCompression(buffer, kind, int64(len(records)), leaderID, &compression)
+	compression := pb.FileCompression_COMPRESSION_ZSTD
+	return newWriter(buffer, kind, recordsCount, leaderID, &compression, dictionary, options)
 }
 
 func NewWriterWithCompression(buffer *bufio.Writer, kind pb.FileKind, recordsCount int64, leaderID string, forceCompression *pb.FileCompression) (*Writer, error) {
+	return newWriter(buffer, kind, recordsCount, leaderID, forceCompression, nil, CompressionOptions{})
+}
+
+func newWriter(buffer *bufio.Writer, kind pb.FileKind, recordsCount int64, leaderID string, forceCompression *pb.FileCompression, dictionary *Dictionary, compressionOptions CompressionOptions) (*Writer, error) {
 	// Determine compression type
 	var compression pb.FileCompression
 	if forceCompression != nil {
@@ -89,12 +174,16 @@ func NewWriterWithCompression(buffer *bufio.Writer, kind pb.FileKind, recordsCou
 
 	// Create header (always uncompressed)
 	header := &pb.FileHeader{
-		Kind:         kind,
-		RecordsCount: recordsCount,
-		CreatedAt:    timestamppb.Now(),
-		LeaderId:     leaderID,
-		Compression:  compression,
-		Crc:          0,
+		SchemaVersion: SchemaVersion,
+		Kind:          kind,
+		RecordsCount:  recordsCount,
+		CreatedAt:     timestamppb.Now(),
+		LeaderId:      leaderID,
+		Compression:   compression,
+		Crc:           0,
+	}
+	if dictionary != nil {
+		header.DictionaryId = dictionary.ID
 	}
 
 	// Calculate header CRC
@@ -115,12 +204,18 @@ func NewWriterWithCompression(buffer *bufio.Writer, kind pb.FileKind, recordsCou
 	var recordWriter io.Writer = buffer
 
 	if compression == pb.FileCompression_COMPRESSION_ZSTD {
-		// Create compressor for records and footer
-		compressor, err = zstd.NewWriter(buffer)
+		// Create compressor for records and footer, counting bytes in and
+		// out of the compressor and the time spent compressing
+		options := compressionOptions.encoderOptions()
+		if dictionary != nil {
+			options = append(options, zstd.WithEncoderDict(dictionary.Data))
+		}
+		w.compressStats = &compressStats{}
+		compressor, err = zstd.NewWriter(&countingWriter{writer: buffer, count: &w.compressStats.compressedBytes}, options...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create zstd compressor: %w", err)
 		}
-		recordWriter = compressor
+		recordWriter = &timingWriter{writer: compressor, stats: w.compressStats}
 	}
 
 	w.compressor = compressor
@@ -130,6 +225,10 @@ func NewWriterWithCompression(buffer *bufio.Writer, kind pb.FileKind, recordsCou
 }
 
 func (w *Writer) Write(record *pb.Record) error {
+	if err := checkEntries(w.kind, record); err != nil {
+		return err
+	}
+
 	// Calculate record CRC
 	record.Crc = 0
 	data, err := proto.Marshal(record)
@@ -189,12 +288,62 @@ func (w *Writer) Close() error {
 
 	// Close compressor if it exists (flushes and finalizes compression)
 	if w.compressor != nil {
+		start := time.Now()
 		err = w.compressor.Close()
 		if err != nil {
 			return fmt.Errorf("failed to close compressor: %w", err)
 		}
+		w.compressStats.duration += time.Since(start)
+		w.compressStats.observe(w.kind)
 	}
 
 	// Flush underlying buffer
 	return w.buffer.Flush()
 }
+
+// compressStats tracks the compression of a single file
+type compressStats struct {
+	uncompressedBytes int64
+	compressedBytes   int64
+	duration          time.Duration
+	// smart is set if compression was chosen by NewWriterWithSmartCompression
+	smart bool
+}
+
+// observe records the compression ratio and time of a completed file
+func (s *compressStats) observe(kind pb.FileKind) {
+	if s.compressedBytes > 0 {
+		ratio := float64(s.uncompressedBytes) / float64(s.compressedBytes)
+		metrics.DatafileCompressionRatio.WithLabelValues(kind.String()).Observe(ratio)
+		if s.smart {
+			metrics.DatafileSmartCompressionRatio.Observe(ratio)
+		}
+	}
+	metrics.DatafileCompressionDuration.WithLabelValues(kind.String()).Observe(s.duration.Seconds())
+}
+
+// timingWriter counts bytes written to the compressor and the time taken
+type timingWriter struct {
+	writer io.Writer
+	stats  *compressStats
+}
+
+func (w *timingWriter) Write(p []byte) (n int, err error) {
+	start := time.Now()
+	n, err = w.writer.Write(p)
+	w.stats.duration += time.Since(start)
+	w.stats.uncompressedBytes += int64(n)
+	return n, err
+}
+
+// countingWriter counts bytes written by the compressor
+type countingWriter struct {
+	writer io.Writer
+	count  *int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.writer.Write(p)
+	*w.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,109 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package datafile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"testing"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestWriterCompressionOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CompressionOptions
+	}{
+		{"default", CompressionOptions{}},
+		{"fastest", CompressionOptions{Level: 1}},
+		{"best", CompressionOptions{Level: 22, WindowSize: 1 << 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			writer, err := NewWriterWithCompressionOptions(bufio.NewWriter(buffer), pb.FileKind_KIND_SNAPSHOT, 100, "test", nil, tt.options)
+			if err != nil {
+				t.Fatalf("NewWriterWithCompressionOptions: %v", err)
+			}
+			for i := int64(1); i <= 100; i++ {
+				record := &pb.Record{Revision: i, Key: []byte(fmt.Sprintf("/registry/pods/default/pod-%d", i)), Value: bytes.Repeat([]byte("v"), 100)}
+				if err = writer.Write(record); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+			if err = writer.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if writer.compressStats.uncompressedBytes <= writer.compressStats.compressedBytes {
+				t.Errorf("expected compression, %d bytes compressed to %d", writer.compressStats.uncompressedBytes, writer.compressStats.compressedBytes)
+			}
+
+			reader, err := NewReader(bufio.NewReader(buffer), nil)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			for i := int64(0); i < reader.Count(); i++ {
+				if _, err = reader.Read(); err != nil {
+					t.Fatalf("Read: %v", err)
+				}
+			}
+			if _, err = reader.Close(); err != nil {
+				t.Fatalf("reader.Close: %v", err)
+			}
+		})
+	}
+}
+
+func TestWriterInvalidWindowSize(t *testing.T) {
+	_, err := NewWriterWithCompressionOptions(bufio.NewWriter(&bytes.Buffer{}), pb.FileKind_KIND_SNAPSHOT, 0, "test", nil, CompressionOptions{WindowSize: 1000})
+	if err == nil {
+		t.Fatalf("expected error for window size which is not a power of 2")
+	}
+}
+
+func TestWriterSmartCompressionSize(t *testing.T) {
+	// many small records, whose keys and values alone are below the
+	// threshold, but whose serialized size is above it
+	var records []*pb.Record
+	for i := int64(1); i <= 400; i++ {
+		records = append(records, &pb.Record{Revision: i, Key: []byte("/k"), CreateRevision: i, Version: 1, LeaderId: "test"})
+	}
+	estimate := RecordsSize(records)
+	if estimate <= DefaultCompressionMinSize {
+		t.Fatalf("expected records to serialize to more than %d bytes, got %d", DefaultCompressionMinSize, estimate)
+	}
+
+	for _, tt := range []struct {
+		minSize  int
+		expected pb.FileCompression
+	}{
+		{0, pb.FileCompression_COMPRESSION_ZSTD},
+		{estimate, pb.FileCompression_COMPRESSION_NONE},
+	} {
+		buffer := &bytes.Buffer{}
+		writer, err := NewWriterWithSmartCompression(bufio.NewWriter(buffer), pb.FileKind_KIND_CHUNK, records, "test", CompressionOptions{MinSize: tt.minSize})
+		if err != nil {
+			t.Fatalf("NewWriterWithSmartCompression: %v", err)
+		}
+		if writer.compression != tt.expected {
+			t.Errorf("min size %d: expected %s, got %s", tt.minSize, tt.expected, writer.compression)
+		}
+		for _, record := range records {
+			if err = writer.Write(record); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+		}
+		if err = writer.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	// once written, the CRCs are set and the size is exact, which the
+	// estimate must not be below
+	if written := RecordsSize(records); estimate < written || estimate-written > len(records)*crcFieldSize {
+		t.Errorf("expected estimate %d to be at most %d bytes above the written size %d", estimate, len(records)*crcFieldSize, written)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package keys renders keys for humans, e.g. in logs, errors, CLI output and
+// metric labels. Keys are arbitrary bytes: Kubernetes keys are mostly
+// printable paths, but may contain binary data, which must be escaped so it
+// does not break logfmt lines or terminals, and may be long, so are
+// truncated.
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLen is the maximum number of bytes of a key which are rendered, after
+// which the key is truncated
+const MaxLen = 256
+
+// maxLabelLen is the maximum length of a metric label value
+const maxLabelLen = 64
+
+// maxLabels is the maximum number of distinct metric label values returned
+// by Label, after which keys with new prefixes are labelled "other"
+const maxLabels = 100
+
+// labels are the distinct values returned by Label so far
+var labels = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: map[string]bool{}}
+
+// Key is a key which is rendered safely (see String) when logged or
+// formatted. Converting a []byte to Key does not copy it, and rendering is
+// deferred until it is formatted, so it is cheap for filtered log levels.
+type Key []byte
+
+// String returns the key with non-printable bytes escaped, truncated to
+// MaxLen bytes
+func (k Key) String() string {
+	return String(k)
+}
+
+// String returns key with non-printable bytes and invalid UTF-8 escaped as
+// \xNN (and backslashes as \\), truncated to MaxLen bytes with a suffix
+// noting how many bytes were omitted
+func String(key []byte) string {
+	truncated := key
+	if len(truncated) > MaxLen {
+		truncated = truncated[:MaxLen]
+	}
+	var b strings.Builder
+	b.Grow(len(truncated))
+	for i := 0; i < len(truncated); {
+		r, size := utf8.DecodeRune(truncated[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&b, `\x%02x`, truncated[i])
+		case r == '\\':
+			b.WriteString(`\\`)
+		case !unicode.IsPrint(r):
+			for _, c := range truncated[i : i+size] {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		default:
+			b.Write(truncated[i : i+size])
+		}
+		i += size
+	}
+	if omitted := len(key) - len(truncated); omitted > 0 {
+		fmt.Fprintf(&b, "...(%d more bytes)", omitted)
+	}
+	return b.String()
+}
+
+// Quote returns key as a double-quoted Go string literal, truncated to
+// MaxLen bytes, e.g. for error messages and CLI output
+func Quote(key []byte) string {
+	if len(key) <= MaxLen {
+		return strconv.Quote(string(key))
+	}
+	return fmt.Sprintf("%s...(%d more bytes)", strconv.Quote(string(key[:MaxLen])), len(key)-MaxLen)
+}
+
+// Label returns a metric label value for key, with bounded cardinality: the
+// first two path segments of the key, e.g. "/registry/pods" for Kubernetes
+// keys, with any characters other than letters, digits and "/._-" replaced
+// by "_", truncated to 64 characters. Keys which are not paths return
+// "other", as do keys with a new prefix once 100 distinct prefixes have been
+// returned, as clients may write or watch arbitrary keys.
+func Label(key []byte) string {
+	if len(key) == 0 || key[0] != '/' {
+		return "other"
+	}
+	// keep up to (but excluding) the third "/"
+	end := len(key)
+	slashes := 0
+	for i, c := range key {
+		if c == '/' {
+			slashes++
+			if slashes == 3 {
+				end = i
+				break
+			}
+		}
+	}
+	end = min(end, maxLabelLen)
+	label := make([]byte, end)
+	for i, c := range key[:end] {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '/', c == '.', c == '_', c == '-':
+			label[i] = c
+		default:
+			label[i] = '_'
+		}
+	}
+
+	labels.Lock()
+	defer labels.Unlock()
+	if !labels.seen[string(label)] {
+		if len(labels.seen) >= maxLabels {
+			return "other"
+		}
+		labels.seen[string(label)] = true
+	}
+	return string(label)
+}
+
+// maxNamespaceLen is the maximum length of a Kubernetes namespace name
+const maxNamespaceLen = 63
+
+// Namespace returns the Kubernetes namespace of key, for keys of namespaced
+// resources under the default /registry prefix, e.g. "default" for
+// /registry/pods/default/nginx. Namespaced resources of the core group are
+// stored at /registry/<resource>/<namespace>/<name>, and those of other
+// groups (and some of the core group, e.g. /registry/services/specs) at
+// /registry/<group>/<resource>/<namespace>/<name>, whereas cluster-scoped
+// resources have one path segment fewer. Keys of cluster-scoped resources,
+// keys which are not Kubernetes keys, and namespaces which are not valid
+// names return "".
+func Namespace(key []byte) string {
+	rest, ok := bytes.CutPrefix(key, []byte("/registry/"))
+	if !ok {
+		return ""
+	}
+	segments := bytes.Split(rest, []byte("/"))
+	var namespace []byte
+	switch len(segments) {
+	case 3:
+		// /registry/<group>/<resource>/<name> is cluster-scoped, and group
+		// names contain dots, e.g. apiextensions.k8s.io
+		if bytes.IndexByte(segments[0], '.') >= 0 {
+			return ""
+		}
+		namespace = segments[1]
+	case 4:
+		namespace = segments[2]
+	default:
+		return ""
+	}
+	if !isNamespaceName(namespace) {
+		return ""
+	}
+	return string(namespace)
+}
+
+// isNamespaceName returns true if name is a valid Kubernetes namespace
+// name: a DNS label of lowercase letters, digits and "-"
+func isNamespaceName(name []byte) bool {
+	if len(name) == 0 || len(name) > maxNamespaceLen || name[0] == '-' || name[len(name)-1] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		key    []byte
+		expect string
+	}{
+		{[]byte("/registry/pods/default/nginx"), "/registry/pods/default/nginx"},
+		{[]byte("/registry/héllo"), "/registry/héllo"},
+		{[]byte("a b\"c"), `a b"c`},
+		{[]byte("a\\b"), `a\\b`},
+		{[]byte("k8s\x00\x01\n"), `k8s\x00\x01\x0a`},
+		{[]byte{'a', 0xff, 0xfe}, `a\xff\xfe`},
+		{[]byte{}, ""},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if result := String(test.key); result != test.expect {
+				t.Errorf("String(%q) = %q, want %q", test.key, result, test.expect)
+			}
+			if result := fmt.Sprintf("%s", Key(test.key)); result != test.expect {
+				t.Errorf("Key(%q).String() = %q, want %q", test.key, result, test.expect)
+			}
+		})
+	}
+
+	long := bytes.Repeat([]byte("a"), MaxLen+10)
+	if result := String(long); result != strings.Repeat("a", MaxLen)+"...(10 more bytes)" {
+		t.Errorf("String(long) = %q", result)
+	}
+	if result := Quote(long); result != `"`+strings.Repeat("a", MaxLen)+`"...(10 more bytes)` {
+		t.Errorf("Quote(long) = %q", result)
+	}
+	if result := Quote([]byte("a\x00")); result != `"a\x00"` {
+		t.Errorf("Quote = %q", result)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		key    []byte
+		expect string
+	}{
+		{[]byte("/registry/pods/default/nginx"), "/registry/pods"},
+		{[]byte("/registry/pods"), "/registry/pods"},
+		{[]byte("/registry"), "/registry"},
+		{[]byte("/registry/apiextensions.k8s.io/x"), "/registry/apiextensions.k8s.io"},
+		{[]byte("/a b/\xff/c"), "/a_b/_"},
+		{[]byte("/" + strings.Repeat("a", 100)), "/" + strings.Repeat("a", maxLabelLen-1)},
+		{[]byte("registry/pods"), "other"},
+		{[]byte{}, "other"},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if result := Label(test.key); result != test.expect {
+				t.Errorf("Label(%q) = %q, want %q", test.key, result, test.expect)
+			}
+		})
+	}
+}
+
+func TestLabelCardinality(t *testing.T) {
+	labels.Lock()
+	prev := labels.seen
+	labels.seen = map[string]bool{}
+	labels.Unlock()
+	t.Cleanup(func() {
+		labels.Lock()
+		labels.seen = prev
+		labels.Unlock()
+	})
+
+	for i := range maxLabels {
+		key := fmt.Appendf(nil, "/registry/r%d/name", i)
+		if result, expect := Label(key), fmt.Sprintf("/registry/r%d", i); result != expect {
+			t.Fatalf("Label(%q) = %q, want %q", key, result, expect)
+		}
+	}
+	// once the limit is reached, only labels already returned are returned
+	if result := Label([]byte("/registry/new/name")); result != "other" {
+		t.Errorf("expected a new prefix to be labelled other, got %q", result)
+	}
+	if result := Label([]byte("/registry/r0/other-name")); result != "/registry/r0" {
+		t.Errorf("expected an existing prefix to keep its label, got %q", result)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	tests := []struct {
+		key    []byte
+		expect string
+	}{
+		{[]byte("/registry/pods/default/nginx"), "default"},
+		{[]byte("/registry/services/specs/kube-system/kube-dns"), "kube-system"},
+		{[]byte("/registry/example.com/widgets/team-a/w1"), "team-a"},
+		{[]byte("/registry/apiextensions.k8s.io/customresourcedefinitions/widgets.example.com"), ""},
+		{[]byte("/registry/namespaces/default"), ""},
+		{[]byte("/registry/pods/Default/nginx"), ""},
+		{[]byte("/registry/pods/def\x00ault/nginx"), ""},
+		{[]byte("/other/pods/default/nginx"), ""},
+		{[]byte{}, ""},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			if result := Namespace(test.key); result != test.expect {
+				t.Errorf("Namespace(%q) = %q, want %q", test.key, result, test.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,484 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package lease implements etcd leases. The Manager tracks when each lease
+// expires, persists leases in the local database, and replicates them (e.g.
+// to S3) so that backfill can restore them. When a lease expires or
+// is revoked, the keys attached to it are deleted through the leader
+// transaction path, so that they are replicated and watchers receive DELETE
+// events, as for any other delete.
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// MaxTTL is the maximum lease TTL in seconds, as in etcd
+const MaxTTL = 9000000000
+
+var (
+	// ErrLeaseNotFound is returned for leases which were never granted, or
+	// have expired or been revoked
+	ErrLeaseNotFound = errors.New("lease not found")
+	// ErrLeaseExists is returned when granting a lease ID which is in use
+	ErrLeaseExists = errors.New("lease already exists")
+	// ErrTTLTooLarge is returned when granting a lease with a TTL above MaxTTL
+	ErrTTLTooLarge = errors.New("lease TTL is too large")
+	// ErrNotLeader is returned when granting, revoking or keeping alive a
+	// lease on a server which is not the leader
+	ErrNotLeader = errors.New("not the leader")
+)
+
+// Deleter writes transactions through the leader transaction path, which is
+// the etcd KV Txn API
+type Deleter interface {
+	Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error)
+}
+
+// Leader reports whether this server is the leader, which owns leases
+type Leader interface {
+	IsLeader() bool
+}
+
+// lease is a granted lease and when it expires
+type lease struct {
+	localdb.Lease
+	expiresAt time.Time
+	// ending is set while the keys of an expired or revoked lease are
+	// deleted, after which the lease can no longer be used
+	ending bool
+}
+
+// Manager grants leases, renews them on keep alive, and deletes their keys
+// once they expire or are revoked.
+//
+// Expiry is tracked per lease rather than per record: each lease expires its
+// TTL after it was last kept alive, and the keys of an expired lease are
+// found using the records lease index (see localdb.FindLeaseRecords), so no
+// scan of all records is needed.
+//
+// Leases are stored in the local database, and the lease state is recorded
+// with the Replicator whenever a lease is granted or ends. As clients cannot
+// keep leases alive while the server is down, and keep alives are not
+// replicated, leases are given a grace period when this server becomes the
+// leader, including on startup (see load).
+//
+// Leases are owned by the leader: only the leader grants, renews and ends
+// them, and a server which becomes the leader again reloads them (see
+// lead), as the expiry times it holds are stale.
+type Manager struct {
+	logger        log.Logger
+	db            localdb.Database
+	deleter       Deleter
+	leader        Leader
+	minTTL        int64
+	checkInterval time.Duration
+	// restartGrace is the minimum time until leases expire after this
+	// server becomes the leader, or zero to expire them on schedule
+	restartGrace time.Duration
+	now          func() time.Time
+	// replicator records the lease state, may be nil
+	replicator     Replicator
+	replicateRetry time.Duration
+	// replicateFailures logs repeated failures to record the lease state
+	replicateFailures *s3client.FailureLog
+	// replicateMu serializes recording the lease state, so that it is
+	// recorded in order
+	replicateMu sync.Mutex
+	// replicateCh signals the replication goroutine that the lease state
+	// changed (see replicateSoon)
+	replicateCh chan struct{}
+
+	mu     sync.Mutex
+	leases map[int64]*lease
+	// granting holds the IDs of leases being granted, which are reserved
+	// while they are stored (see Grant)
+	granting map[int64]bool
+	// leading is whether this server was the leader when last checked
+	leading bool
+	// ended holds the leases which ended since the lease state was last
+	// replicated, and replicatePending is set until the lease state is
+	// replicated, which is retried after replicateRetryAt if it fails
+	ended            map[int64]proto.LeaseEntry_Event
+	replicatePending bool
+	replicateRetryAt time.Time
+
+	// Context for shutdown, cancelled by Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks the expiry and replication goroutines
+	wg sync.WaitGroup
+}
+
+// NewManager creates a lease manager, which deletes the keys of leases
+// which end using deleter, and records the lease state with replicator,
+// which may be nil if leases are not replicated. Leases are only managed
+// while leader reports that this server is the leader.
+func NewManager(logger log.Logger, conf *config.Config, db localdb.Database, deleter Deleter, replicator Replicator, leader Leader) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		logger:            logger,
+		db:                db,
+		deleter:           deleter,
+		leader:            leader,
+		minTTL:            conf.LeaseMinTTLSeconds(),
+		checkInterval:     time.Duration(conf.LeaseCheckIntervalMS()) * time.Millisecond,
+		restartGrace:      time.Duration(max(conf.LeaseRestartGraceSeconds(), 0)) * time.Second,
+		now:               time.Now,
+		replicator:        replicator,
+		replicateRetry:    time.Duration(conf.ReplicationS3RetrySeconds()) * time.Second,
+		replicateFailures: s3client.NewFailureLog(logger, "lease replication"),
+		replicateCh:       make(chan struct{}, 1),
+		leases:            map[int64]*lease{},
+		granting:          map[int64]bool{},
+		ended:             map[int64]proto.LeaseEntry_Event{},
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+}
+
+// Start loads the leases stored in the database (see load), with the
+// restart grace period if this server is the leader, then starts the
+// goroutines which end expired leases while this server is the leader, and
+// record the lease state with the replicator.
+func (m *Manager) Start() error {
+	leading := m.leader.IsLeader()
+	grace := time.Duration(0)
+	if leading {
+		grace = m.restartGrace
+	}
+	if err := m.load(grace); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.leading = leading
+	m.mu.Unlock()
+
+	m.wg.Add(2)
+	go func() {
+		defer m.wg.Done()
+		m.run()
+	}()
+	go func() {
+		defer m.wg.Done()
+		m.runReplicate()
+	}()
+	return nil
+}
+
+// load replaces the leases with those stored in the database, each
+// expiring its TTL after it was last kept alive. Leases which would expire
+// within grace (e.g. as they expired while the server was down, or kept
+// alive with another leader) are re-armed to expire at the end of it
+// instead, so that a brief restart does not end the leases of clients
+// which are still running, such as every kubelet's node lease.
+func (m *Manager) load(grace time.Duration) error {
+	stored, err := m.db.ListLeases()
+	if err != nil {
+		return fmt.Errorf("failed to load leases: %w", err)
+	}
+	m.mu.Lock()
+	now := m.now()
+	graceExpiresAt := now.Add(grace)
+	rearmed := 0
+	m.leases = make(map[int64]*lease, len(stored))
+	for _, l := range stored {
+		expiresAt := l.LastKeepAlive.Add(time.Duration(l.TTL) * time.Second)
+		if grace > 0 && expiresAt.Before(graceExpiresAt) {
+			expiresAt = graceExpiresAt
+			rearmed++
+		}
+		m.leases[l.ID] = &lease{Lease: l, expiresAt: expiresAt}
+	}
+	metrics.LeasesActive.Set(float64(len(m.leases)))
+	metrics.LeasesRearmed.Add(float64(rearmed))
+	m.mu.Unlock()
+	level.Info(m.logger).Log("msg", "leases loaded", "leases", len(stored), "rearmed", rearmed, "grace", grace, "check_interval", m.checkInterval)
+	return nil
+}
+
+// lead returns true if this server is the leader, reloading the leases
+// with the restart grace period (see load) when it has just become the
+// leader, as keep alives were sent to another leader while it was not
+func (m *Manager) lead() bool {
+	leading := m.leader.IsLeader()
+	m.mu.Lock()
+	wasLeading := m.leading
+	m.leading = leading
+	m.mu.Unlock()
+	if !leading || wasLeading {
+		return leading
+	}
+	level.Info(m.logger).Log("msg", "became the leader, reloading leases")
+	if err := m.load(m.restartGrace); err != nil {
+		level.Error(m.logger).Log("msg", "failed to reload leases", "err", err)
+		// reloading is retried on the next check
+		m.mu.Lock()
+		m.leading = false
+		m.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// Stop stops ending expired leases, aborting any in-flight key deletions.
+// Leases which did not end are ended once the server is started again.
+// Lease state changes which were not yet replicated are replicated with
+// the next change.
+func (m *Manager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// run is the main expiry loop
+func (m *Manager) run() {
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			if !m.lead() {
+				continue
+			}
+			m.expire()
+			// retry replicating the lease state if it failed
+			m.replicate()
+		}
+	}
+}
+
+// expire ends every lease which has expired
+func (m *Manager) expire() {
+	m.mu.Lock()
+	now := m.now()
+	var expired []int64
+	for id, l := range m.leases {
+		if !l.ending && !now.Before(l.expiresAt) {
+			l.ending = true
+			expired = append(expired, id)
+		}
+	}
+	m.mu.Unlock()
+	slices.Sort(expired)
+	for _, id := range expired {
+		if err := m.end(m.ctx, id, "expired"); err != nil {
+			// the lease is retried on the next check
+			level.Error(m.logger).Log("msg", "failed to end expired lease", "lease", id, "err", err)
+		}
+	}
+}
+
+// Grant grants a lease with the given ID, or a random ID if id is 0. TTLs
+// below the minimum TTL are raised to it. The ID is reserved before the
+// lease is stored, so that m.mu is not held while writing to the database,
+// and the lease can only be used once it has been stored.
+func (m *Manager) Grant(id int64, ttl int64) (granted localdb.Lease, err error) {
+	if ttl > MaxTTL {
+		return granted, ErrTTLTooLarge
+	}
+	ttl = max(ttl, m.minTTL, 1)
+	if !m.leader.IsLeader() {
+		return granted, ErrNotLeader
+	}
+	m.mu.Lock()
+	if id == 0 {
+		for id == 0 || m.leases[id] != nil || m.granting[id] {
+			id = rand.Int63()
+		}
+	} else if m.leases[id] != nil || m.granting[id] {
+		m.mu.Unlock()
+		return granted, ErrLeaseExists
+	}
+	m.granting[id] = true
+	now := m.now()
+	m.mu.Unlock()
+
+	granted = localdb.Lease{ID: id, TTL: ttl, GrantedAt: now, LastKeepAlive: now}
+	err = m.db.GrantLease(granted)
+	m.mu.Lock()
+	delete(m.granting, id)
+	if err != nil {
+		m.mu.Unlock()
+		return granted, err
+	}
+	m.leases[id] = &lease{Lease: granted, expiresAt: now.Add(time.Duration(ttl) * time.Second)}
+	delete(m.ended, id)
+	m.changed()
+	metrics.LeasesActive.Set(float64(len(m.leases)))
+	m.mu.Unlock()
+	m.replicateSoon()
+	return granted, nil
+}
+
+// Revoke ends a lease, deleting the keys attached to it
+func (m *Manager) Revoke(ctx context.Context, id int64) error {
+	if !m.leader.IsLeader() {
+		return ErrNotLeader
+	}
+	m.mu.Lock()
+	l := m.leases[id]
+	if l == nil || l.ending {
+		m.mu.Unlock()
+		return ErrLeaseNotFound
+	}
+	l.ending = true
+	m.mu.Unlock()
+	return m.end(ctx, id, "revoked")
+}
+
+// KeepAlive renews a lease for its full TTL, storing when it was kept alive,
+// and returns the TTL. The lease is renewed before it is stored, so that
+// m.mu is not held while writing to the database; if storing fails, the
+// lease is still renewed until the server restarts.
+func (m *Manager) KeepAlive(id int64) (ttl int64, err error) {
+	if !m.leader.IsLeader() {
+		return 0, ErrNotLeader
+	}
+	m.mu.Lock()
+	l := m.leases[id]
+	if l == nil || l.ending {
+		m.mu.Unlock()
+		return 0, ErrLeaseNotFound
+	}
+	now := m.now()
+	l.LastKeepAlive = now
+	l.expiresAt = now.Add(time.Duration(l.TTL) * time.Second)
+	ttl = l.TTL
+	m.mu.Unlock()
+	if err = m.db.RenewLease(id, now); err != nil {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+// TimeToLive returns a lease and its remaining TTL in seconds
+func (m *Manager) TimeToLive(id int64) (granted localdb.Lease, remaining int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.leases[id]
+	if l == nil || l.ending {
+		return granted, 0, ErrLeaseNotFound
+	}
+	remaining = int64(math.Ceil(l.expiresAt.Sub(m.now()).Seconds()))
+	return l.Lease, max(remaining, 0), nil
+}
+
+// Check returns ErrLeaseNotFound unless keys can be attached to the lease
+func (m *Manager) Check(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l := m.leases[id]; l == nil || l.ending {
+		return ErrLeaseNotFound
+	}
+	return nil
+}
+
+// Leases returns the IDs of all leases, in ID order
+func (m *Manager) Leases() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]int64, 0, len(m.leases))
+	for id, l := range m.leases {
+		if !l.ending {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Keys returns the keys attached to a lease
+func (m *Manager) Keys(id int64) ([][]byte, error) {
+	records, err := m.db.FindLeaseRecords(id)
+	if err != nil {
+		return nil, err
+	}
+	attached := make([][]byte, 0, len(records))
+	for _, record := range records {
+		attached = append(attached, record.Key)
+	}
+	return attached, nil
+}
+
+// end deletes the keys attached to a lease which is ending, then the lease.
+// If deleting fails, the lease can be ended again.
+func (m *Manager) end(ctx context.Context, id int64, reason string) (err error) {
+	defer func() {
+		if err != nil {
+			m.mu.Lock()
+			if l := m.leases[id]; l != nil {
+				l.ending = false
+			}
+			m.mu.Unlock()
+		}
+	}()
+	records, err := m.db.FindLeaseRecords(id)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		resp, err := m.deleter.Txn(commonapi.WithInternalCaller(ctx, "lease_"+reason), deleteTxn(record))
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", keys.Quote(record.Key), err)
+		}
+		// the compare fails if the key was written since it was found, in
+		// which case it is only deleted if it is still attached to the
+		// lease, when the lease is ended again
+		if !resp.Succeeded {
+			return fmt.Errorf("%s was modified while deleting it", keys.Quote(record.Key))
+		}
+		metrics.LeaseKeysDeleted.Inc()
+	}
+	if err = m.db.RevokeLease(id); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.leases, id)
+	m.ended[id] = endedEvents[reason]
+	m.changed()
+	metrics.LeasesActive.Set(float64(len(m.leases)))
+	m.mu.Unlock()
+	metrics.LeasesEnded.WithLabelValues(reason).Inc()
+	level.Debug(m.logger).Log("msg", "lease ended", "lease", id, "reason", reason, "keys", len(records))
+	m.replicateSoon()
+	return nil
+}
+
+// deleteTxn returns a transaction which deletes record's key, unless it was
+// written since record, in the form the leader transaction path accepts
+func deleteTxn(record *proto.Record) *pb.TxnRequest {
+	return &pb.TxnRequest{
+		Compare: []*pb.Compare{{
+			Key:         record.Key,
+			Target:      pb.Compare_MOD,
+			Result:      pb.Compare_EQUAL,
+			TargetUnion: &pb.Compare_ModRevision{ModRevision: record.Revision},
+		}},
+		Success: []*pb.RequestOp{{
+			Request: &pb.RequestOp_RequestDeleteRange{RequestDeleteRange: &pb.DeleteRangeRequest{Key: record.Key}},
+		}},
+		Failure: []*pb.RequestOp{{
+			Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: record.Key}},
+		}},
+	}
+}
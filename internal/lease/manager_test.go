@@ -0,0 +1,314 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package lease
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/peerapi"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// leaderDeleter deletes keys using the leader transaction path
+type leaderDeleter struct {
+	ps *peerapi.PeerAPIServer
+}
+
+func (d leaderDeleter) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	_, resp, err := d.ps.LeaderTxn(ctx, r)
+	return resp, err
+}
+
+// testLeader is the leader unless notLeader is set
+type testLeader struct {
+	notLeader atomic.Bool
+}
+
+func (l *testLeader) IsLeader() bool {
+	return !l.notLeader.Load()
+}
+
+func TestManagerLeadership(t *testing.T) {
+	leader := &testLeader{}
+	m := NewManager(log.NewNopLogger(), &config.Config{}, localdbtest.New(t), nil, nil, leader)
+	now := time.Unix(1000, 0)
+	m.now = func() time.Time { return now }
+	if err := m.load(0); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !m.lead() {
+		t.Fatal("expected to lead")
+	}
+	if _, err := m.Grant(1, 60); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+
+	// only the leader grants and renews leases
+	leader.notLeader.Store(true)
+	if m.lead() {
+		t.Fatal("expected not to lead")
+	}
+	if _, err := m.Grant(2, 60); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("expected ErrNotLeader granting, got %v", err)
+	}
+	if _, err := m.KeepAlive(1); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("expected ErrNotLeader keeping alive, got %v", err)
+	}
+	if err := m.Revoke(context.Background(), 1); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("expected ErrNotLeader revoking, got %v", err)
+	}
+
+	// on becoming the leader again, the leases are reloaded, and those which
+	// expired meanwhile are re-armed for the restart grace period
+	now = now.Add(time.Hour)
+	leader.notLeader.Store(false)
+	if !m.lead() {
+		t.Fatal("expected to lead")
+	}
+	if _, remaining, err := m.TimeToLive(1); err != nil || remaining != 30 {
+		t.Fatalf("expected the reloaded lease to have 30 seconds remaining, got %d: %v", remaining, err)
+	}
+}
+
+func TestManagerRestartGrace(t *testing.T) {
+	db := localdbtest.New(t)
+	now := time.Unix(1000, 0)
+	if err := db.GrantLease(localdb.Lease{ID: 1, TTL: 10, GrantedAt: now, LastKeepAlive: now}); err != nil {
+		t.Fatalf("GrantLease: %v", err)
+	}
+	now = now.Add(time.Hour)
+	remaining := func(grace int64, leader *testLeader) int64 {
+		t.Helper()
+		configtest.Set(t, map[string]any{"lease_restart_grace_seconds": grace})
+		m := NewManager(log.NewNopLogger(), &config.Config{}, db, nil, nil, leader)
+		m.now = func() time.Time { return now }
+		if err := m.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		m.Stop()
+		_, remaining, err := m.TimeToLive(1)
+		if err != nil {
+			t.Fatalf("TimeToLive: %v", err)
+		}
+		return remaining
+	}
+
+	// the grace period applies once the server becomes the leader
+	if r := remaining(30, &testLeader{}); r != 30 {
+		t.Fatalf("expected the leader's lease to have 30 seconds remaining, got %d", r)
+	}
+	follower := &testLeader{}
+	follower.notLeader.Store(true)
+	if r := remaining(30, follower); r != 0 {
+		t.Fatalf("expected the follower's lease not to be re-armed, got %d seconds remaining", r)
+	}
+
+	// and can be disabled
+	if r := remaining(0, &testLeader{}); r != 0 {
+		t.Fatalf("expected the lease not to be re-armed without a grace period, got %d seconds remaining", r)
+	}
+}
+
+func TestManagerExpiresLeases(t *testing.T) {
+	configtest.Set(t, map[string]any{"s3_enabled": false, "instance_id": "test"})
+
+	conf := &config.Config{}
+	db := localdbtest.New(t)
+	ps, err := peerapi.NewServer(log.NewNopLogger(), conf, db, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	if err = ps.InitializeRevisionCounter(); err != nil {
+		t.Fatalf("InitializeRevisionCounter: %v", err)
+	}
+	put := func(key string, lease int64, modRevision int64) {
+		t.Helper()
+		r := &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: modRevision}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte(key), Lease: lease}}}},
+			Failure: []*pb.RequestOp{{Request: &pb.RequestOp_RequestRange{RequestRange: &pb.RangeRequest{Key: []byte(key)}}}},
+		}
+		if _, _, err := ps.LeaderTxn(context.Background(), r); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	liveKeys := func() (live []string) {
+		t.Helper()
+		records, _, _, err := db.FindRecordsBy("1=1", nil, 0, 0, localdb.SortByKey, "ASC")
+		if err != nil {
+			t.Fatalf("FindRecordsBy: %v", err)
+		}
+		for _, record := range records {
+			live = append(live, string(record.Key))
+		}
+		return live
+	}
+
+	m := NewManager(log.NewNopLogger(), conf, db, leaderDeleter{ps}, nil, ps)
+	now := time.Unix(1000, 0)
+	m.now = func() time.Time { return now }
+
+	// TTLs are raised to the minimum TTL, and IDs must be unique
+	granted, err := m.Grant(7, 1)
+	if err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if granted.TTL != 5 {
+		t.Fatalf("expected TTL to be raised to 5, got %d", granted.TTL)
+	}
+	if _, err = m.Grant(7, 10); !errors.Is(err, ErrLeaseExists) {
+		t.Fatalf("expected ErrLeaseExists, got %v", err)
+	}
+	random, err := m.Grant(0, 60)
+	if err != nil || random.ID <= 0 {
+		t.Fatalf("expected a random lease ID, got %d: %v", random.ID, err)
+	}
+
+	// a is attached to lease 7, c was attached but has since been updated
+	// without the lease, and b was never attached
+	put("a", 7, 0)
+	put("b", 0, 0)
+	put("c", 7, 0)
+	put("c", 0, 3)
+	attached, err := m.Keys(7)
+	if err != nil || len(attached) != 1 || string(attached[0]) != "a" {
+		t.Fatalf("expected key a to be attached to lease 7, got %q: %v", attached, err)
+	}
+
+	// keep alive renews the lease for its full TTL
+	now = now.Add(4 * time.Second)
+	if ttl, err := m.KeepAlive(7); err != nil || ttl != 5 {
+		t.Fatalf("expected keep alive to return TTL 5, got %d: %v", ttl, err)
+	}
+	now = now.Add(4 * time.Second)
+	m.expire()
+	if _, remaining, err := m.TimeToLive(7); err != nil || remaining != 1 {
+		t.Fatalf("expected 1 second remaining, got %d: %v", remaining, err)
+	}
+
+	// once expired, the lease ends and its keys are deleted
+	now = now.Add(time.Second)
+	m.expire()
+	if err = m.Check(7); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("expected expired lease to be not found, got %v", err)
+	}
+	if live := liveKeys(); !slices.Equal(live, []string{"b", "c"}) {
+		t.Fatalf("expected keys b and c to remain, got %v", live)
+	}
+	if _, err = m.KeepAlive(7); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("expected keep alive of expired lease to fail, got %v", err)
+	}
+
+	// keep alives are stored, and loaded leases expire their TTL after they
+	// were last kept alive, unless that is within the restart grace period
+	if _, err = m.KeepAlive(random.ID); err != nil {
+		t.Fatalf("KeepAlive: %v", err)
+	}
+	if _, err = m.Grant(8, 5); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if stored, err := db.ListLeases(); err != nil || len(stored) != 2 || !stored[1].LastKeepAlive.Equal(now) {
+		t.Fatalf("expected lease %d kept alive at %v to be stored, got %v: %v", random.ID, now, stored, err)
+	}
+	now = now.Add(20 * time.Second)
+	restarted := NewManager(log.NewNopLogger(), conf, db, leaderDeleter{ps}, nil, ps)
+	restarted.now = func() time.Time { return now }
+	if err = restarted.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer restarted.Stop()
+	if leases := restarted.Leases(); !slices.Equal(leases, []int64{8, random.ID}) {
+		t.Fatalf("expected leases 8 and %d to be loaded, got %v", random.ID, leases)
+	}
+	if _, remaining, err := restarted.TimeToLive(random.ID); err != nil || remaining != 40 {
+		t.Fatalf("expected loaded lease to have 40 seconds remaining, got %d remaining: %v", remaining, err)
+	}
+	// lease 8 expired while the server was down, so is re-armed
+	now = now.Add(29 * time.Second)
+	restarted.expire()
+	if _, remaining, err := restarted.TimeToLive(8); err != nil || remaining != 1 {
+		t.Fatalf("expected re-armed lease to have 1 second remaining, got %d remaining: %v", remaining, err)
+	}
+	now = now.Add(time.Second)
+	restarted.expire()
+	if err = restarted.Check(8); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("expected re-armed lease to expire after the grace period, got %v", err)
+	}
+
+	// revoking a lease deletes its keys immediately
+	put("d", random.ID, 0)
+	if err = restarted.Revoke(context.Background(), random.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if live := liveKeys(); !slices.Equal(live, []string{"b", "c"}) {
+		t.Fatalf("expected revoked lease's key d to be deleted, got %v", live)
+	}
+	if err = restarted.Revoke(context.Background(), random.ID); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("expected ErrLeaseNotFound revoking again, got %v", err)
+	}
+	if stored, err := db.ListLeases(); err != nil || len(stored) != 0 {
+		t.Fatalf("expected no stored leases, got %v: %v", stored, err)
+	}
+}
+
+// blockingGrantDB blocks storing a granted lease until release is closed
+type blockingGrantDB struct {
+	localdb.Database
+	granting chan struct{}
+	release  chan struct{}
+}
+
+func (db *blockingGrantDB) GrantLease(l localdb.Lease) error {
+	close(db.granting)
+	<-db.release
+	return db.Database.GrantLease(l)
+}
+
+// TestManagerGrantDoesNotBlock checks that the lease lock is not held while
+// a granted lease is stored, and that the lease ID is reserved meanwhile
+func TestManagerGrantDoesNotBlock(t *testing.T) {
+	db := &blockingGrantDB{Database: localdbtest.New(t), granting: make(chan struct{}), release: make(chan struct{})}
+	m := NewManager(log.NewNopLogger(), &config.Config{}, db, nil, nil, &testLeader{})
+	granted := make(chan error, 1)
+	go func() {
+		_, err := m.Grant(1, 60)
+		granted <- err
+	}()
+	<-db.granting
+
+	// the lease cannot be used or granted again until it is stored
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := m.Check(1); !errors.Is(err, ErrLeaseNotFound) {
+			t.Errorf("expected ErrLeaseNotFound checking a lease being granted, got %v", err)
+		}
+		if _, err := m.Grant(1, 60); !errors.Is(err, ErrLeaseExists) {
+			t.Errorf("expected ErrLeaseExists granting a lease being granted, got %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lease lock not to be held while the lease is stored")
+	}
+
+	close(db.release)
+	if err := <-granted; err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if err := m.Check(1); err != nil {
+		t.Fatalf("expected the granted lease to be usable, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package lease
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Replicator records lease state, so that it can be restored by backfill.
+// It is implemented by s3client.S3Client.
+type Replicator interface {
+	WriteLeases(ctx context.Context, leases s3client.Leases) error
+}
+
+// endedEvents maps the reasons leases end to their lease entry events
+var endedEvents = map[string]proto.LeaseEntry_Event{
+	"expired": proto.LeaseEntry_EVENT_EXPIRED,
+	"revoked": proto.LeaseEntry_EVENT_REVOKED,
+}
+
+// changed records that the lease state changed and must be replicated. The
+// caller must hold m.mu.
+func (m *Manager) changed() {
+	m.replicatePending = true
+	m.replicateRetryAt = m.now()
+}
+
+// replicateSoon signals the replication goroutine to record the lease state,
+// so that requests which change it do not wait for the replicator. Changes
+// made while the lease state is being recorded are recorded together once
+// it has been.
+func (m *Manager) replicateSoon() {
+	select {
+	case m.replicateCh <- struct{}{}:
+	default:
+	}
+}
+
+// runReplicate records the lease state each time it changes, until the
+// manager is stopped. Failures are retried by run.
+func (m *Manager) runReplicate() {
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.replicateCh:
+			m.replicate()
+		}
+	}
+}
+
+// replicate records the lease state with the replicator if it changed since
+// it was last recorded. Failures are logged and retried once the retry
+// interval has passed, as leases are still stored in the local database.
+func (m *Manager) replicate() {
+	if m.replicator == nil {
+		return
+	}
+	m.replicateMu.Lock()
+	defer m.replicateMu.Unlock()
+
+	m.mu.Lock()
+	if !m.replicatePending || m.now().Before(m.replicateRetryAt) {
+		m.mu.Unlock()
+		return
+	}
+	// entries are taken with the revision, so that a later change to the
+	// lease state is never recorded at an earlier revision
+	entries := m.entries()
+	ended := m.ended
+	m.ended = map[int64]proto.LeaseEntry_Event{}
+	m.replicatePending = false
+	revision, err := m.db.LatestRevision()
+	m.mu.Unlock()
+
+	if err == nil {
+		err = m.replicator.WriteLeases(m.ctx, s3client.Leases{Revision: revision, Entries: entries})
+	}
+	if err != nil {
+		metrics.LeaseReplicationFailures.Inc()
+		m.replicateFailures.Failure(err, "retry_interval", m.replicateRetry)
+		m.mu.Lock()
+		// leases which ended since are already in m.ended
+		for id, event := range ended {
+			if _, ok := m.ended[id]; !ok && m.leases[id] == nil {
+				m.ended[id] = event
+			}
+		}
+		m.replicatePending = true
+		m.replicateRetryAt = m.now().Add(m.replicateRetry)
+		m.mu.Unlock()
+	} else {
+		m.replicateFailures.Success()
+	}
+}
+
+// entries returns a lease entry for each lease which ended since the lease
+// state was last replicated, then for each granted lease, in ID order. The
+// caller must hold m.mu.
+func (m *Manager) entries() []*proto.LeaseEntry {
+	entries := make([]*proto.LeaseEntry, 0, len(m.ended)+len(m.leases))
+	for _, id := range slices.Sorted(maps.Keys(m.ended)) {
+		entries = append(entries, &proto.LeaseEntry{Event: m.ended[id], Id: id})
+	}
+	for _, id := range slices.Sorted(maps.Keys(m.leases)) {
+		l := m.leases[id]
+		entries = append(entries, &proto.LeaseEntry{
+			Event:         proto.LeaseEntry_EVENT_GRANTED,
+			Id:            id,
+			Ttl:           l.TTL,
+			GrantedAt:     timestamppb.New(l.GrantedAt),
+			LastKeepalive: timestamppb.New(l.LastKeepAlive),
+		})
+	}
+	return entries
+}
+
+// Apply applies lease entries read from a lease file to db. Granted leases
+// are stored, replacing any stored lease with the same ID, and leases which
+// ended are removed. Stored leases without an entry are left as is, and end
+// once they expire.
+func Apply(db localdb.Database, entries []*proto.LeaseEntry) (granted int, ended int, err error) {
+	for _, entry := range entries {
+		switch entry.Event {
+		case proto.LeaseEntry_EVENT_GRANTED:
+			err = db.GrantLease(localdb.Lease{
+				ID:            entry.Id,
+				TTL:           entry.Ttl,
+				GrantedAt:     entry.GrantedAt.AsTime(),
+				LastKeepAlive: entry.LastKeepalive.AsTime(),
+			})
+			granted++
+		case proto.LeaseEntry_EVENT_REVOKED, proto.LeaseEntry_EVENT_EXPIRED:
+			err = db.RevokeLease(entry.Id)
+			ended++
+		default:
+			err = fmt.Errorf("lease %d has unknown event %s", entry.Id, entry.Event)
+		}
+		if err != nil {
+			return granted, ended, err
+		}
+	}
+	return granted, ended, nil
+}
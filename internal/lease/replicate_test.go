@@ -0,0 +1,103 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+// testReplicator records the lease states written, failing while err is set
+type testReplicator struct {
+	attempts int
+	written  []s3client.Leases
+	err      error
+}
+
+func (r *testReplicator) WriteLeases(ctx context.Context, leases s3client.Leases) error {
+	r.attempts++
+	if r.err != nil {
+		return r.err
+	}
+	r.written = append(r.written, leases)
+	return nil
+}
+
+func TestManagerReplicatesLeases(t *testing.T) {
+	replicator := &testReplicator{}
+	// leases without keys are ended without deleting through the deleter
+	m := NewManager(log.NewNopLogger(), &config.Config{}, localdbtest.New(t), nil, replicator, &testLeader{})
+	now := time.Unix(1000, 0)
+	m.now = func() time.Time { return now }
+	m.replicateRetry = 10 * time.Second
+	entry := func(event proto.LeaseEntry_Event, id int64) string {
+		return fmt.Sprintf("%s/%d", event, id)
+	}
+	lastWritten := func() (events []string) {
+		t.Helper()
+		if len(replicator.written) == 0 {
+			t.Fatalf("expected the lease state to be written")
+		}
+		for _, e := range replicator.written[len(replicator.written)-1].Entries {
+			events = append(events, entry(e.Event, e.Id))
+		}
+		return events
+	}
+
+	// granting a lease replicates it
+	if _, err := m.Grant(7, 60); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	m.replicate()
+	if events := lastWritten(); len(events) != 1 || events[0] != entry(proto.LeaseEntry_EVENT_GRANTED, 7) {
+		t.Fatalf("expected lease 7 granted, got %v", events)
+	}
+
+	// failures are retried once the retry interval has passed, with the
+	// leases which ended in the meantime
+	replicator.err = errors.New("unavailable")
+	if _, err := m.Grant(8, 60); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	m.replicate()
+	if err := m.Revoke(context.Background(), 7); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	m.replicate()
+	replicator.err = nil
+	m.replicate()
+	if replicator.attempts != 3 || len(replicator.written) != 1 {
+		t.Fatalf("expected no retry before the retry interval, got %d attempts", replicator.attempts)
+	}
+	now = now.Add(10 * time.Second)
+	m.replicate()
+	events := lastWritten()
+	if len(events) != 2 || events[0] != entry(proto.LeaseEntry_EVENT_REVOKED, 7) || events[1] != entry(proto.LeaseEntry_EVENT_GRANTED, 8) {
+		t.Fatalf("expected lease 7 revoked and 8 granted, got %v", events)
+	}
+
+	// the replicated lease state is applied to another database
+	db := localdbtest.New(t)
+	if err := db.GrantLease(localdb.Lease{ID: 7, TTL: 5, GrantedAt: now}); err != nil {
+		t.Fatalf("GrantLease: %v", err)
+	}
+	granted, ended, err := Apply(db, replicator.written[len(replicator.written)-1].Entries)
+	if err != nil || granted != 1 || ended != 1 {
+		t.Fatalf("expected 1 lease granted and 1 ended, got %d and %d: %v", granted, ended, err)
+	}
+	stored, err := db.ListLeases()
+	if err != nil || len(stored) != 1 || stored[0].ID != 8 || stored[0].TTL != 60 || !stored[0].LastKeepAlive.Equal(time.Unix(1000, 0)) {
+		t.Fatalf("expected lease 8 to be stored, got %v: %v", stored, err)
+	}
+}
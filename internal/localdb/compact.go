@@ -0,0 +1,71 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Compact compacts all revisions before revision which have been superseded
+// by a later revision of the same key at or before revision, as etcd does.
+// Compacted records are not deleted (see VerifyIntegrity), instead their
+// values are emptied and compacted_at is set. The compaction revision is
+// recorded (see CompactRevision). Compacting is idempotent, so the same
+// compaction may be applied again (e.g. during backfill).
+func (db *database) Compact(revision int64, compactedAt time.Time) (compacted int64, err error) {
+	if revision <= 0 {
+		return 0, fmt.Errorf("invalid compaction revision: %d", revision)
+	}
+	err = db.write(func(sqlTx *sql.Tx) error {
+		compactedAtText := compactedAt.UTC().Format(time.RFC3339Nano)
+		result, err := sqlTx.Exec(compactSQL, revision, compactedAtText)
+		if err != nil {
+			return err
+		}
+		compacted, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		_, err = sqlTx.Exec("INSERT OR IGNORE INTO compactions (revision, compacted_at) VALUES (?, ?)", revision, compactedAtText)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compact to revision %d: %w", revision, err)
+	}
+	return compacted, nil
+}
+
+const compactSQL = `
+  UPDATE records
+  SET value = NULL, compacted_at = ?2
+  WHERE revision < ?1
+    AND compacted_at IS NULL
+    AND EXISTS (
+      SELECT 1 FROM records AS newer
+      WHERE newer.key = records.key
+        AND newer.revision > records.revision
+        AND newer.revision <= ?1
+    )
+`
+
+// CompactRevision returns the latest revision the database has been
+// compacted to, or 0 if it has never been compacted
+func (db *database) CompactRevision() (revision int64, err error) {
+	err = db.readConn.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM compactions").Scan(&revision)
+	return revision, err
+}
+
+// RevisionCreatedBefore returns the latest revision created at or before t,
+// or 0 if there is none. Revisions are created in order, so it is the
+// revision created last at or before t, which is found with a single seek of
+// the created_at index.
+func (db *database) RevisionCreatedBefore(t time.Time) (revision int64, err error) {
+	err = db.readConn.QueryRow(
+		"SELECT COALESCE((SELECT revision FROM records WHERE julianday(created_at) <= julianday(?) ORDER BY julianday(created_at) DESC, revision DESC LIMIT 1), 0)",
+		t.UTC().Format(time.RFC3339Nano),
+	).Scan(&revision)
+	return revision, err
+}
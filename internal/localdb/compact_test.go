@@ -0,0 +1,45 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestRevisionCreatedBefore(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// created_at has varying numbers of fractional digits
+	for i, offset := range []time.Duration{0, 1500 * time.Millisecond, 2*time.Second + 123456789, 10 * time.Second} {
+		db.now = func() time.Time {
+			return start.Add(offset)
+		}
+		insertTestRecord(t, db, &proto.Record{Revision: int64(i + 1), Key: []byte("a"), Value: []byte("a"), Created: i == 0, PrevRevision: int64(i)})
+	}
+
+	for _, tc := range []struct {
+		before   time.Duration
+		expected int64
+	}{
+		{-time.Second, 0},
+		{0, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{2 * time.Second, 2},
+		{2*time.Second + 123456789, 3},
+		{5 * time.Second, 3},
+		{time.Minute, 4},
+	} {
+		revision, err := db.RevisionCreatedBefore(start.Add(tc.before))
+		if err != nil {
+			t.Fatalf("RevisionCreatedBefore: %v", err)
+		}
+		if revision != tc.expected {
+			t.Errorf("RevisionCreatedBefore(start+%s) = %d, want %d", tc.before, revision, tc.expected)
+		}
+	}
+}
@@ -12,7 +12,13 @@ import (
 	"path/filepath"
 )
 
+// Connect opens the db file, creating it if it does not exist, and migrates
+// its schema. Returns an error wrapping ErrCorrupt if the file is corrupt.
 func (db *database) Connect() error {
+	return wrapCorrupt(db.connect())
+}
+
+func (db *database) connect() error {
 	if db.file == "" {
 		return errors.New("db file path not configured")
 	}
@@ -20,7 +26,7 @@ func (db *database) Connect() error {
 	// check directory exists
 	dbDir := filepath.Dir(db.file)
 	if _, err := os.Stat(dbDir); os.IsNotExist(err) {
-		err := os.Mkdir(dbDir, 0750)
+		err := os.MkdirAll(dbDir, 0750)
 		if err != nil {
 			return fmt.Errorf("error creating database directory %s: %s", dbDir, err)
 		} else {
@@ -28,11 +34,14 @@ func (db *database) Connect() error {
 		}
 	}
 
-	// connect
-	conn, err := sql.Open("sqlite3", db.file)
+	// connect writer
+	// SQLite only supports a single writer at a time, so we limit the writer
+	// pool to one connection rather than having connections wait on locks
+	conn, err := sql.Open("sqlite3", db.file+"?_busy_timeout=5000")
 	if err != nil {
 		return err
 	}
+	conn.SetMaxOpenConns(1)
 	db.conn = conn
 
 	// Enable WAL mode for better concurrency (allows reads during writes)
@@ -42,6 +51,9 @@ func (db *database) Connect() error {
 	}
 
 	// define schema
+	// migrations are applied in order, with the number applied so far stored
+	// in the db's user_version. The first migrations predate user_version
+	// being tracked and so must remain idempotent.
 	migrations := []string{
 		`CREATE TABLE IF NOT EXISTS records (
 			revision integer PRIMARY KEY NOT NULL,
@@ -61,18 +73,107 @@ func (db *database) Connect() error {
 		);`,
 		`CREATE UNIQUE INDEX IF NOT EXISTS records_key_create_rev_prev_rev_uindex ON records (key, create_revision, prev_revision)`,
 		`CREATE INDEX IF NOT EXISTS records_index_key ON records (key);`,
+		// lease expiry, so that expired keys can be found using an index
+		// rather than scanning all records. Existing records are left NULL, as
+		// no lease TTLs were known when they were written. Dropped below.
+		`ALTER TABLE records ADD COLUMN lease_expires_at text;`,
+		`CREATE INDEX IF NOT EXISTS records_index_lease_expires_at ON records (lease_expires_at) WHERE lease_expires_at IS NOT NULL;`,
+		// keys must be BLOBs so they are compared byte by byte. SQLite orders
+		// TEXT after BLOB and may compare it using a collation, so convert
+		// any keys which were stored as TEXT.
+		`UPDATE records SET key = CAST(key AS BLOB) WHERE typeof(key) != 'blob';`,
+		// revisions whose records were deleted by PruneTombstones, so they
+		// are still accounted for
+		`CREATE TABLE IF NOT EXISTS pruned_revisions (revision integer PRIMARY KEY NOT NULL);`,
+		// ranges of revisions which intentionally have no records (see
+		// gaps.go), replacing pruned_revisions
+		`CREATE TABLE IF NOT EXISTS revision_gaps (
+			first_revision integer PRIMARY KEY NOT NULL,
+			last_revision integer NOT NULL,
+			reason text NOT NULL,
+			created_at text NOT NULL
+		);`,
+		`INSERT INTO revision_gaps (first_revision, last_revision, reason, created_at)
+			SELECT MIN(revision), MAX(revision), 'prune_tombstones', strftime('%Y-%m-%dT%H:%M:%fZ', 'now')
+			FROM (SELECT revision, revision - ROW_NUMBER() OVER (ORDER BY revision) AS island FROM pruned_revisions)
+			GROUP BY island;`,
+		`DROP TABLE pruned_revisions;`,
+		// compaction revisions, so the current compaction revision is known
+		// (see CompactRevision)
+		`CREATE TABLE IF NOT EXISTS compactions (
+			revision integer PRIMARY KEY NOT NULL,
+			compacted_at text NOT NULL
+		);`,
+		// granted leases and when each was last kept alive, so leases expire
+		// on schedule after a restart (see leases.go), and an index to find
+		// the records attached to a lease when it expires
+		`CREATE TABLE IF NOT EXISTS leases (
+			id integer PRIMARY KEY NOT NULL,
+			ttl integer NOT NULL,
+			granted_at text NOT NULL,
+			last_keepalive text NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS records_index_lease ON records (lease) WHERE lease != 0;`,
+		// the deleted flag of each record by key, so that count_only ranges
+		// are answered by scanning the index (see CountRecordsBy)
+		`CREATE INDEX IF NOT EXISTS records_index_key_deleted ON records (key, deleted);`,
+		// when each record was created, so that the revision created at a
+		// time is found without scanning records (see RevisionCreatedBefore)
+		`CREATE INDEX IF NOT EXISTS records_index_created_at ON records (julianday(created_at), revision);`,
+		// leases expire using the leases table, and their keys are found
+		// using records_index_lease, so the per-record lease expiry was never
+		// written. The index is dropped first, as SQLite cannot drop an
+		// indexed column.
+		`DROP INDEX IF EXISTS records_index_lease_expires_at;
+		ALTER TABLE records DROP COLUMN lease_expires_at;`,
 	}
-	for _, sqlStmt := range migrations {
-		_, err = db.conn.Exec(sqlStmt)
-		if err != nil {
+	var userVersion int
+	if err = db.conn.QueryRow("PRAGMA user_version").Scan(&userVersion); err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	for i := userVersion; i < len(migrations); i++ {
+		if err = migrate(db.conn, migrations[i], i+1); err != nil {
 			log.Printf(
 				"error running migration.\nmigration: %s\nerror: %s\n",
-				sqlStmt,
+				migrations[i],
 				err,
 			)
 			return err
 		}
 	}
 
+	// connect readers
+	// these are opened after the writer has enabled WAL mode and run
+	// migrations, and are query-only to guarantee writes use the writer
+	readConn, err := sql.Open("sqlite3", db.file+"?_busy_timeout=5000&_query_only=true")
+	if err != nil {
+		return err
+	}
+	readConn.SetMaxOpenConns(db.maxReadConns)
+	readConn.SetMaxIdleConns(db.maxReadConns)
+	db.readConn = readConn
+
+	// start write loop, which owns the writer connection from here on
+	db.startWriteLoop()
+
 	return nil
 }
+
+// migrate runs a migration and sets the schema version to version in one
+// transaction, so that a crash part way through never leaves a migration
+// applied without its version, which would run it again
+func migrate(conn *sql.DB, sqlStmt string, version int) error {
+	sqlTx, err := conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer sqlTx.Rollback()
+	if _, err = sqlTx.Exec(sqlStmt); err != nil {
+		return err
+	}
+	// PRAGMA does not support bound parameters
+	if _, err = sqlTx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return fmt.Errorf("failed to set schema version: %w", err)
+	}
+	return sqlTx.Commit()
+}
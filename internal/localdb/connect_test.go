@@ -0,0 +1,47 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestMigrateIsAtomic(t *testing.T) {
+	conn, err := sql.Open("sqlite3", t.TempDir()+"/db.sqlite3")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	version := func() (v int) {
+		if err := conn.QueryRow("PRAGMA user_version").Scan(&v); err != nil {
+			t.Fatalf("user_version: %v", err)
+		}
+		return v
+	}
+
+	if err := migrate(conn, `CREATE TABLE migrate_test (id integer PRIMARY KEY);`, 1); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if v := version(); v != 1 {
+		t.Fatalf("expected schema version 1, got %d", v)
+	}
+
+	// a failed migration leaves neither its changes nor its version
+	err = migrate(conn, `ALTER TABLE migrate_test ADD COLUMN name text; ALTER TABLE missing ADD COLUMN name text;`, 2)
+	if err == nil {
+		t.Fatalf("expected the migration to fail")
+	}
+	if v := version(); v != 1 {
+		t.Errorf("expected schema version 1 after a failed migration, got %d", v)
+	}
+	// so it can be run again once fixed
+	if err := migrate(conn, `ALTER TABLE migrate_test ADD COLUMN name text;`, 2); err != nil {
+		t.Errorf("expected the migration to be retried, got %v", err)
+	}
+	if v := version(); v != 2 {
+		t.Errorf("expected schema version 2, got %d", v)
+	}
+}
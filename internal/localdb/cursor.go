@@ -0,0 +1,110 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RecordCursor iterates over the records found by CursorRecordsBy, reading
+// each from the database as it is requested, so that only the records the
+// caller keeps are held in memory
+type RecordCursor struct {
+	rows *sql.Rows
+	// Count is the total number of matching records, ignoring the limit
+	Count int64
+	// MaxRevision is the latest revision in the database
+	MaxRevision int64
+}
+
+// newRecordCursor returns a cursor over rows, reading the metadata row
+// (which is always first) into Count and MaxRevision. rows are closed on
+// error.
+func newRecordCursor(rows *sql.Rows) (*RecordCursor, error) {
+	c := &RecordCursor{rows: rows}
+	if !rows.Next() {
+		err := rows.Err()
+		rows.Close()
+		if err == nil {
+			err = errors.New("missing metadata row")
+		}
+		return nil, err
+	}
+	var isMetadata int64
+	var record proto.Record
+	if err := c.scan(&isMetadata, &c.MaxRevision, &c.Count, &record); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Next returns the next record, or nil once there are no more records
+func (c *RecordCursor) Next() (*proto.Record, error) {
+	if !c.rows.Next() {
+		return nil, c.rows.Err()
+	}
+	var isMetadata, maxRevision, count int64
+	var record proto.Record
+	if err := c.scan(&isMetadata, &maxRevision, &count, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Close closes the cursor, releasing its read connection
+func (c *RecordCursor) Close() error {
+	return c.rows.Close()
+}
+
+// scan scans the current row into the metadata columns and record
+func (c *RecordCursor) scan(isMetadata, maxRevision, count *int64, record *proto.Record) error {
+	var createdAtStr string
+	var compactedAtStr, replicatedAtStr sql.NullString
+	err := c.rows.Scan(
+		isMetadata,  // is_metadata (only set in first row)
+		maxRevision, // max_revision (only in first row)
+		count,       // records_count (only in first row)
+		&record.Revision,
+		&record.Key,
+		&record.Created,
+		&record.Deleted,
+		&record.CreateRevision,
+		&record.PrevRevision,
+		&record.Version,
+		&record.Lease,
+		&record.Dek,
+		&record.Value,
+		&createdAtStr,
+		&compactedAtStr,
+		&record.LeaderId,
+		&replicatedAtStr,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Convert string timestamps to protobuf timestamps
+	if createdAtStr != "" {
+		if t, err := time.Parse(time.RFC3339Nano, createdAtStr); err == nil {
+			record.CreatedAt = timestamppb.New(t)
+		}
+	}
+	if compactedAtStr.Valid && compactedAtStr.String != "" {
+		if t, err := time.Parse(time.RFC3339Nano, compactedAtStr.String); err == nil {
+			record.CompactedAt = timestamppb.New(t)
+		}
+	}
+	if replicatedAtStr.Valid && replicatedAtStr.String != "" {
+		if t, err := time.Parse(time.RFC3339Nano, replicatedAtStr.String); err == nil {
+			record.ReplicatedAt = timestamppb.New(t)
+		}
+	}
+	return nil
+}
@@ -6,41 +6,82 @@ package localdb
 import (
 	"database/sql"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/nadrama-com/netsy/internal/proto"
 )
 
+// database holds two connection pools to the same SQLite file: conn is
+// limited to a single connection and used for all writes, while readConn is
+// a pool of query-only connections used for reads. In WAL mode readers do not
+// block the writer (or each other), so reads can run in parallel.
+// Writes are not performed on conn directly, but are instead submitted to a
+// write loop goroutine which owns conn (see writer.go).
 type database struct {
-	file string
-	conn *sql.DB
+	file         string
+	maxReadConns int
+	conn         *sql.DB
+	readConn     *sql.DB
+	now          func() time.Time
+
+	// write loop
+	writeCh       chan *writeRequest
+	writeStop     chan struct{}
+	writeLoopDone chan struct{}
 }
 
 type Database interface {
 	Connect() error
 	LatestRevision() (int64, error)
 	GetRevision(findRevision int64) (revision int64, compacted bool, compactedAt sql.NullString, err error)
+	GetRevisions(findRevisions []int64) (compacted map[int64]bool, compactRevision int64, err error)
 	VerifyIntegrity() error
-	FindRecordsBy(whereQuery string, whereArgs []any, revision int64, limit int64, order string) ([]*proto.Record, int64, int64, error)
+	CheckIntegrity(full bool) error
+	FindRecordsBy(whereQuery string, whereArgs []any, revision int64, limit int64, sortBy string, order string) ([]*proto.Record, int64, int64, error)
+	CursorRecordsBy(whereQuery string, whereArgs []any, revision int64, limit int64, sortBy string, order string) (*RecordCursor, error)
+	CountRecordsBy(whereQuery string, whereArgs []any, revision int64) (int64, int64, error)
 	FindRecordByRev(revision int64) (*proto.Record, error)
-	FindAllRecordsForSnapshot(upToRevision int64) ([]*proto.Record, error)
+	FindKeyRecords(key []byte) ([]*proto.Record, error)
+	FindLatestRecords(keys [][]byte, revision int64) ([]*proto.Record, error)
+	FindRecordsFrom(revision int64, limit int64) ([]*proto.Record, error)
+	ScanRecordsForSnapshot(firstRevision int64, lastRevision int64, fn func(record *proto.Record) error) error
+	FindRecentValues(limit int64) ([][]byte, error)
 	InsertRecord(record *proto.Record, tx *Tx) (*proto.Record, error)
 	BeginTx() (*Tx, error)
-	ReplicateRecord(record *proto.Record) (*proto.Record, error)
-	Size() (int64, error)
+	ReplicateRecord(record *proto.Record, tx *Tx) (*proto.Record, error)
+	Compact(revision int64, compactedAt time.Time) (int64, error)
+	CompactRevision() (int64, error)
+	RevisionCreatedBefore(t time.Time) (int64, error)
+	PruneTombstones(revision int64, limit int) (int64, error)
+	RecordGap(firstRevision int64, lastRevision int64, reason string, tx *Tx) error
+	Gaps() ([]Gap, error)
+	GrantLease(lease Lease) error
+	RenewLease(id int64, keptAliveAt time.Time) error
+	RevokeLease(id int64) error
+	ListLeases() ([]Lease, error)
+	FindLeaseRecords(lease int64) ([]*proto.Record, error)
+	Size() (SizeStats, error)
 	Close() error
 }
 
-func New(file string) *database {
+func New(file string, maxReadConns int) *database {
+	if maxReadConns < 1 {
+		maxReadConns = 1
+	}
 	return &database{
-		file: file,
+		file:         file,
+		maxReadConns: maxReadConns,
+		now:          time.Now,
 	}
 }
 
 func (db *database) LatestRevision() (int64, error) {
 	query := "SELECT revision FROM records ORDER BY revision DESC LIMIT 1"
 	var revision int64
-	row := db.conn.QueryRow(query)
+	row := db.readConn.QueryRow(query)
 	if err := row.Scan(&revision); err != nil {
 		if err == sql.ErrNoRows {
 			return 0, nil
@@ -50,10 +91,22 @@ func (db *database) LatestRevision() (int64, error) {
 	return revision, nil
 }
 
+// GetRevision looks up a revision, returning sql.ErrNoRows if it does not
+// exist. Revisions within a gap (e.g. pruned revisions) are reported as
+// compacted, without compactedAt.
 func (db *database) GetRevision(findRevision int64) (revision int64, compacted bool, compactedAt sql.NullString, err error) {
 	query := "SELECT revision,compacted_at FROM records WHERE revision = ? ORDER BY revision DESC LIMIT 1"
-	row := db.conn.QueryRow(query, findRevision)
-	if err = row.Scan(&revision, &compactedAt); err != nil {
+	row := db.readConn.QueryRow(query, findRevision)
+	if err = row.Scan(&revision, &compactedAt); err == sql.ErrNoRows {
+		gapped, gapErr := db.inGaps([]int64{findRevision})
+		if gapErr != nil {
+			return 0, false, compactedAt, gapErr
+		}
+		if gapped[findRevision] {
+			return findRevision, true, compactedAt, nil
+		}
+	}
+	if err != nil {
 		return
 	}
 	if compactedAt.Valid {
@@ -62,39 +115,166 @@ func (db *database) GetRevision(findRevision int64) (revision int64, compacted b
 	return
 }
 
+// GetRevisions looks up multiple revisions in a single query. The returned map
+// contains an entry for each revision which exists, set to true if that
+// revision has been compacted (or is within a gap). Revisions which do not
+// exist are omitted. compactRevision is the revision the database has been
+// compacted to (see CompactRevision), as history at or before it cannot be
+// watched even where the record at a revision has not been compacted itself.
+func (db *database) GetRevisions(findRevisions []int64) (compacted map[int64]bool, compactRevision int64, err error) {
+	compacted = make(map[int64]bool, len(findRevisions))
+	if len(findRevisions) == 0 {
+		return
+	}
+	if compactRevision, err = db.CompactRevision(); err != nil {
+		return nil, 0, err
+	}
+	placeholders := strings.Repeat("?,", len(findRevisions))
+	query := "SELECT revision,compacted_at FROM records WHERE revision IN (" + placeholders[:len(placeholders)-1] + ")"
+	args := make([]any, len(findRevisions))
+	for i, revision := range findRevisions {
+		args[i] = revision
+	}
+	rows, err := db.readConn.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var revision int64
+		var compactedAt sql.NullString
+		if err = rows.Scan(&revision, &compactedAt); err != nil {
+			return nil, 0, err
+		}
+		compacted[revision] = compactedAt.Valid
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// revisions without records may be within a gap
+	var missing []int64
+	for _, revision := range findRevisions {
+		if _, ok := compacted[revision]; !ok {
+			missing = append(missing, revision)
+		}
+	}
+	gapped, err := db.inGaps(missing)
+	if err != nil {
+		return nil, 0, err
+	}
+	for revision := range gapped {
+		compacted[revision] = true
+	}
+	return compacted, compactRevision, nil
+}
+
+// FindRecentValues returns the values of up to limit of the most recent
+// non-deleted records, newest first, e.g. for training a compression dictionary
+func (db *database) FindRecentValues(limit int64) (values [][]byte, err error) {
+	query := "SELECT value FROM records WHERE deleted = 0 AND length(value) > 0 ORDER BY revision DESC LIMIT ?"
+	rows, err := db.readConn.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value []byte
+		if err = rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
 // VerifyIntegrity checks that the latest revision is the same as the total
-// number of records in the records table. Essentially - ensuring that no records
-// are missing. We can do this because our form of compaction is not to delete
-// records, but rather to empty their values.
+// number of records in the records table plus the number of revisions in
+// recorded gaps. Essentially - ensuring that no records are missing. We can
+// do this because our form of compaction is not to delete records, but rather
+// to empty their values, and records which are intentionally removed (e.g. by
+// PruneTombstones) are recorded as gaps, so missing records are corruption.
+// The latest revision includes revisions skipped after the latest record
+// (see GapReasonSetNextRevision).
 func (db *database) VerifyIntegrity() error {
 	query := "SELECT " +
-		"COUNT(*) as total," +
-		"COALESCE(MAX(revision), 0) as latest " +
-		"FROM records"
-	row := db.conn.QueryRow(query)
-	var total, latest int64
-	if err := row.Scan(&total, &latest); err != nil {
+		"(SELECT COUNT(*) FROM records) as total," +
+		"(SELECT COALESCE(SUM(last_revision - first_revision + 1), 0) FROM revision_gaps) as gapped," +
+		"MAX((SELECT COALESCE(MAX(revision), 0) FROM records), (SELECT COALESCE(MAX(last_revision), 0) FROM revision_gaps)) as latest," +
+		"(SELECT COUNT(*) FROM revision_gaps JOIN records ON records.revision BETWEEN first_revision AND last_revision) as gapped_records," +
+		"(SELECT COUNT(*) FROM revision_gaps AS a JOIN revision_gaps AS b ON b.first_revision > a.first_revision AND b.first_revision <= a.last_revision) as overlapping_gaps"
+	row := db.readConn.QueryRow(query)
+	var total, gapped, latest, gappedRecords, overlappingGaps int64
+	if err := row.Scan(&total, &gapped, &latest, &gappedRecords, &overlappingGaps); err != nil {
 		return err
 	}
-	if total != latest {
-		return fmt.Errorf("integrity error: total records (%d) does not match latest revision (%d)", total, latest)
+	if gappedRecords != 0 {
+		return fmt.Errorf("integrity error: %d records have revisions within recorded gaps", gappedRecords)
+	}
+	if overlappingGaps != 0 {
+		return fmt.Errorf("integrity error: %d recorded gaps overlap", overlappingGaps)
+	}
+	if total+gapped != latest {
+		return fmt.Errorf("integrity error: total records (%d) plus gap revisions (%d) does not match latest revision (%d)", total, gapped, latest)
 	}
 	return nil
 }
 
-func (db *database) Size() (int64, error) {
-	query := "SELECT (page_count * page_size) AS db_size FROM pragma_page_count(), pragma_page_size();"
-	var dbSize int64
-	row := db.conn.QueryRow(query)
-	if err := row.Scan(&dbSize); err != nil {
-		return 0, err
+// SizeStats describes the on-disk size of the local db
+type SizeStats struct {
+	PageSize      int64
+	PageCount     int64
+	FreelistCount int64 // pages which are allocated but unused
+	WALSize       int64 // bytes, zero if there is no WAL file
+}
+
+// Size returns the total size of the db file in bytes
+func (s SizeStats) Size() int64 {
+	return s.PageCount * s.PageSize
+}
+
+// SizeInUse returns the size of the db file in bytes excluding free pages,
+// i.e. the size the db file would be after a VACUUM
+func (s SizeStats) SizeInUse() int64 {
+	return (s.PageCount - s.FreelistCount) * s.PageSize
+}
+
+// PageUtilization returns the fraction of pages in use, between 0 and 1
+func (s SizeStats) PageUtilization() float64 {
+	if s.PageCount == 0 {
+		return 1
+	}
+	return float64(s.PageCount-s.FreelistCount) / float64(s.PageCount)
+}
+
+func (db *database) Size() (stats SizeStats, err error) {
+	query := "SELECT page_size, page_count, freelist_count FROM pragma_page_size(), pragma_page_count(), pragma_freelist_count();"
+	row := db.readConn.QueryRow(query)
+	if err = row.Scan(&stats.PageSize, &stats.PageCount, &stats.FreelistCount); err != nil {
+		return
+	}
+	walInfo, err := os.Stat(db.file + "-wal")
+	if err != nil && !os.IsNotExist(err) {
+		return stats, fmt.Errorf("failed to stat WAL file: %w", err)
+	} else if err == nil {
+		stats.WALSize = walInfo.Size()
 	}
-	return dbSize, nil
+	return stats, nil
 }
 
 func (db *database) Close() error {
-	if db.conn == nil {
-		return nil
+	db.stopWriteLoop()
+	var err error
+	if db.readConn != nil {
+		err = db.readConn.Close()
+	}
+	if db.conn != nil {
+		if closeErr := db.conn.Close(); closeErr != nil {
+			err = closeErr
+		}
 	}
-	return db.conn.Close()
+	return err
 }
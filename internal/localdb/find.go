@@ -4,31 +4,23 @@
 package localdb
 
 import (
+	"bytes"
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/nadrama-com/netsy/internal/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// recordColumns are the columns of records scanned by forEachRecord
+const recordColumns = "revision, key, created, deleted, create_revision, prev_revision, version, lease, dek, value, created_at, compacted_at, leader_id, replicated_at"
+
 func (db *database) selectRecord(queryEnd string, latestPerKey bool, excludeDeleted bool, args ...any) (records []*proto.Record, err error) {
-	query := "SELECT " +
-		"revision, " +
-		"key, " +
-		"created, " +
-		"deleted, " +
-		"create_revision, " +
-		"prev_revision, " +
-		"version, " +
-		"lease, " +
-		"dek, " +
-		"value, " +
-		"created_at, " +
-		"compacted_at, " +
-		"leader_id, " +
-		"replicated_at " +
+	query := "SELECT " + recordColumns +
 		" FROM (SELECT " +
 		"records.*," +
 		"ROW_NUMBER() OVER (" +
@@ -47,9 +39,19 @@ func (db *database) selectRecord(queryEnd string, latestPerKey bool, excludeDele
 		}
 		query += " deleted = 0"
 	}
-	rows, err := db.conn.Query(query, args...)
+	err = db.forEachRecord(query, args, func(record *proto.Record) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// forEachRecord runs query, which selects the columns of records, calling fn
+// with each record as it is read. It stops at the first error fn returns.
+func (db *database) forEachRecord(query string, args []any, fn func(record *proto.Record) error) error {
+	rows, err := db.readConn.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 	for rows.Next() {
@@ -76,7 +78,7 @@ func (db *database) selectRecord(queryEnd string, latestPerKey bool, excludeDele
 			continue
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// Convert string timestamps to protobuf timestamps
@@ -96,20 +98,64 @@ func (db *database) selectRecord(queryEnd string, latestPerKey bool, excludeDele
 			}
 		}
 
-		records = append(records, &row)
+		if err = fn(&row); err != nil {
+			return err
+		}
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+	return rows.Err()
+}
+
+// Columns which FindRecordsBy can sort records by, i.e. the etcd Range sort
+// targets
+const (
+	SortByKey            = "key"
+	SortByVersion        = "version"
+	SortByCreateRevision = "create_revision"
+	SortByModRevision    = "revision"
+	SortByValue          = "value"
+)
+
+// FindRecordsBy returns the latest record for each key matching whereQuery
+// as of revision (or the latest revision if 0), excluding deleted keys,
+// sorted by sortBy (see SortBy*) in order (ASC or DESC) and limited to limit
+// records if limit > 0. Records with equal sortBy values are sorted by key.
+// It also returns the total number of matching records and the latest
+// revision in the database.
+func (db *database) FindRecordsBy(whereQuery string, whereArgs []any, revision int64, limit int64, sortBy string, order string) ([]*proto.Record, int64, int64, error) {
+	cursor, err := db.CursorRecordsBy(whereQuery, whereArgs, revision, limit, sortBy, order)
+	if err != nil {
+		return nil, 0, 0, err
 	}
-	return records, nil
+	defer cursor.Close()
+	var records []*proto.Record
+	for {
+		record, err := cursor.Next()
+		if err != nil {
+			return nil, 0, 0, err
+		} else if record == nil {
+			break
+		}
+		records = append(records, record)
+	}
+	return records, cursor.Count, cursor.MaxRevision, nil
 }
 
-func (db *database) FindRecordsBy(whereQuery string, whereArgs []any, revision int64, limit int64, order string) ([]*proto.Record, int64, int64, error) {
+// CursorRecordsBy returns a cursor over the records FindRecordsBy returns,
+// so that large result sets are read one record at a time rather than held
+// in memory. The cursor must be closed.
+func (db *database) CursorRecordsBy(whereQuery string, whereArgs []any, revision int64, limit int64, sortBy string, order string) (*RecordCursor, error) {
 	if order != "ASC" && order != "DESC" {
-		return nil, 0, 0, fmt.Errorf("invalid order: %s", order)
+		return nil, fmt.Errorf("invalid order: %s", order)
+	}
+	switch sortBy {
+	case SortByKey, SortByVersion, SortByCreateRevision, SortByModRevision, SortByValue:
+	default:
+		return nil, fmt.Errorf("invalid sort column: %s", sortBy)
 	}
 
-	// Build WHERE clause
+	// Build WHERE clause, which is applied before finding the latest record
+	// for each key, so that for revision-pinned reads the latest record is
+	// the latest as of that revision (even if the key is deleted later)
 	whereClause := fmt.Sprintf("WHERE (%s)", whereQuery)
 	if revision > 0 {
 		whereClause += " AND revision <= ?"
@@ -118,120 +164,156 @@ func (db *database) FindRecordsBy(whereQuery string, whereArgs []any, revision i
 
 	// Build ORDER BY clause
 	orderClause := fmt.Sprintf("ORDER BY key %s, revision DESC", order)
+	if sortBy != SortByKey {
+		orderClause = fmt.Sprintf("ORDER BY %s %s, key ASC", sortBy, order)
+	}
 
-	// Build LIMIT clause
+	// Build LIMIT clause (whether there are more records is determined
+	// from records_count)
 	limitClause := ""
 	if limit > 0 {
-		limitClause = fmt.Sprintf("LIMIT %d", limit+1)
+		limitClause = fmt.Sprintf("LIMIT %d", limit)
 	}
 
-	// Single query with CTE to get both count and records,
+	// Select the records to return from visible (see below), which is
+	// ordered by key as it is built using the key index. When sorting by
+	// revision, records are instead selected from the records table in
+	// primary key (revision) order, checking each is the latest for its key
+	// using the key index, so that a LIMIT does not require finding and
+	// sorting every visible record, e.g. when paginating by mod revision.
+	columns := "revision, key, created, deleted, create_revision, prev_revision, version, lease, dek, value, created_at, compacted_at, leader_id, replicated_at"
+	recordsQuery := fmt.Sprintf("SELECT 0 as is_metadata, 0 as max_revision, 0 as records_count, %s FROM visible %s %s", columns, orderClause, limitClause)
+	queryArgs := whereArgs
+	if sortBy == SortByModRevision {
+		// whereArgs are used by both at_revision and the records query
+		newerClause := ""
+		queryArgs = append(slices.Clone(whereArgs), whereArgs...)
+		if revision > 0 {
+			newerClause = " AND newer.revision <= ?"
+			queryArgs = append(queryArgs, revision)
+		}
+		recordsQuery = fmt.Sprintf(`SELECT 0 as is_metadata, 0 as max_revision, 0 as records_count, %s FROM records
+				%s AND deleted = 0 AND NOT EXISTS (
+					SELECT 1 FROM records AS newer WHERE newer.key = records.key AND newer.revision > records.revision%s
+				)
+				%s %s`, columns, whereClause, newerClause, orderClause, limitClause)
+	}
+
+	// Single query with CTEs to get both count and records:
+	// - at_revision: matching records up to the requested revision, numbered
+	//   per key from latest to earliest
+	// - visible: the latest record per key, excluding keys whose latest
+	//   record (at the requested revision) is a tombstone
 	// using UNION ALL to return first row for metadata, then actual records after.
 	// This means an empty record set still returns the max revision in metadata.
+	// ORDER BY and LIMIT are applied to the records only, and is_metadata
+	// keeps the metadata row first regardless of the requested order.
 	query := fmt.Sprintf(`
-		WITH filtered AS (
+		WITH at_revision AS (
 			SELECT
-				revision, key, created, deleted, create_revision, prev_revision, version, lease, dek, value, created_at, compacted_at, leader_id, replicated_at,
+				%s,
 				ROW_NUMBER() OVER (PARTITION BY key ORDER BY revision DESC) as rn
 			FROM records
 			%s
+		),
+		visible AS (
+			SELECT * FROM at_revision WHERE rn = 1 AND deleted = 0
 		)
-		SELECT
-			COALESCE((SELECT MAX(revision) FROM records), 0) as max_revision,
-			(SELECT COUNT(*) FROM filtered WHERE rn = 1 AND deleted = 0) as records_count,
-			0 as revision, '' as key, 0 as created, 0 as deleted, 0 as create_revision, 0 as prev_revision, 0 as version, 0 as lease, 0 as dek, '' as value, '' as created_at, NULL as compacted_at, '' as leader_id, NULL as replicated_at
-		UNION ALL
-		SELECT
-			0 as max_revision, 0 as records_count,
-			revision, key, created, deleted, create_revision, prev_revision, version, lease, dek, value, created_at, compacted_at, leader_id, replicated_at
-		FROM filtered
-		WHERE rn = 1 AND deleted = 0
-		%s %s`, whereClause, orderClause, limitClause)
-	rows, err := db.conn.Query(query, whereArgs...)
+		SELECT * FROM (
+			SELECT
+				1 as is_metadata,
+				COALESCE((SELECT MAX(revision) FROM records), 0) as max_revision,
+				(SELECT COUNT(*) FROM visible) as records_count,
+				0 as revision, '' as key, 0 as created, 0 as deleted, 0 as create_revision, 0 as prev_revision, 0 as version, 0 as lease, 0 as dek, '' as value, '' as created_at, NULL as compacted_at, '' as leader_id, NULL as replicated_at
+			UNION ALL
+			SELECT * FROM (
+				%s
+			)
+		)
+		ORDER BY is_metadata DESC, %s`, columns, whereClause, recordsQuery, strings.TrimPrefix(orderClause, "ORDER BY "))
+	rows, err := db.readConn.Query(query, queryArgs...)
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
-	defer rows.Close()
+	return newRecordCursor(rows)
+}
 
-	// Parse query results - first row is always metadata, subsequent rows are records
-	var records []*proto.Record
-	var maxRevision int64
-	var totalCount int64
-	isFirstRow := true
+// CountRecordsBy returns the number of keys matching whereQuery as of
+// revision (or the latest revision if 0), excluding deleted keys, i.e. the
+// count FindRecordsBy returns, and the latest revision in the database. No
+// records are read: the latest record of each key is found by grouping the
+// records_index_key_deleted index by key, so that counting a prefix is a
+// scan of the index rather than building the set of matching records.
+func (db *database) CountRecordsBy(whereQuery string, whereArgs []any, revision int64) (count int64, maxRevision int64, err error) {
+	whereClause := fmt.Sprintf("WHERE (%s)", whereQuery)
+	if revision > 0 {
+		whereClause += " AND revision <= ?"
+		whereArgs = append(whereArgs, revision)
+	}
+	// SQLite takes the bare deleted column from the row with the MAX
+	// revision of each group
+	query := fmt.Sprintf(`
+		SELECT
+			(SELECT COUNT(*) FROM (
+				SELECT MAX(revision), deleted FROM records INDEXED BY records_index_key_deleted
+				%s
+				GROUP BY key
+			) WHERE deleted = 0),
+			COALESCE((SELECT MAX(revision) FROM records), 0)`, whereClause)
+	err = db.readConn.QueryRow(query, whereArgs...).Scan(&count, &maxRevision)
+	return count, maxRevision, err
+}
 
-	for rows.Next() {
-		var maxRevisionValue, totalCountValue int64
-		var record proto.Record
-		var createdAtStr string
-		var compactedAtStr, replicatedAtStr sql.NullString
+// ScanRecordsForSnapshot calls fn with each record from firstRevision to
+// lastRevision in revision order, including deleted and compacted records,
+// reading each from the database as it is scanned, so that snapshots of
+// large databases are not held in memory. It stops at the first error fn
+// returns.
+func (db *database) ScanRecordsForSnapshot(firstRevision int64, lastRevision int64, fn func(record *proto.Record) error) error {
+	query := "SELECT " + recordColumns + " FROM records WHERE revision BETWEEN ? AND ? ORDER BY revision ASC"
+	return db.forEachRecord(query, []any{firstRevision, lastRevision}, fn)
+}
 
-		err := rows.Scan(
-			&maxRevisionValue, // max_revision (only in first row)
-			&totalCountValue,  // records_count (only in first row)
-			&record.Revision,
-			&record.Key,
-			&record.Created,
-			&record.Deleted,
-			&record.CreateRevision,
-			&record.PrevRevision,
-			&record.Version,
-			&record.Lease,
-			&record.Dek,
-			&record.Value,
-			&createdAtStr,
-			&compactedAtStr,
-			&record.LeaderId,
-			&replicatedAtStr,
-		)
-		if err != nil {
-			return nil, 0, 0, err
-		}
+// FindRecordsFrom returns up to limit records from revision onwards,
+// including deleted and compacted records, ordered by revision
+func (db *database) FindRecordsFrom(revision int64, limit int64) ([]*proto.Record, error) {
+	return db.selectRecord("WHERE revision >= ? ORDER BY revision ASC LIMIT ?", false, false, revision, limit)
+}
 
-		// First row contains metadata
-		if isFirstRow {
-			maxRevision = maxRevisionValue
-			totalCount = totalCountValue
-			isFirstRow = false
-			continue // Skip to next row for actual records
-		}
+// FindKeyRecords returns all records of key, including deleted and compacted
+// records, ordered by revision
+func (db *database) FindKeyRecords(key []byte) ([]*proto.Record, error) {
+	return db.selectRecord("WHERE key = ? ORDER BY revision ASC", false, false, key)
+}
 
-		// Convert string timestamps to protobuf timestamps
-		if createdAtStr != "" {
-			if t, err := time.Parse(time.RFC3339Nano, createdAtStr); err == nil {
-				record.CreatedAt = timestamppb.New(t)
-			}
+// findLatestBatchSize is the maximum number of keys FindLatestRecords looks
+// up per query, keeping IN-lists well below SQLite's variable limit
+const findLatestBatchSize = 500
+
+// FindLatestRecords returns the latest record of each of keys as of revision
+// (or the latest revision if 0), excluding deleted keys, ordered by key. Keys
+// are looked up using IN-lists, so many exact keys are found in one query
+// per batch of findLatestBatchSize keys rather than one query per key.
+func (db *database) FindLatestRecords(keys [][]byte, revision int64) (records []*proto.Record, err error) {
+	for batch := range slices.Chunk(keys, findLatestBatchSize) {
+		args := make([]any, 0, len(batch)+1)
+		for _, key := range batch {
+			args = append(args, key)
 		}
-		if compactedAtStr.Valid && compactedAtStr.String != "" {
-			if t, err := time.Parse(time.RFC3339Nano, compactedAtStr.String); err == nil {
-				record.CompactedAt = timestamppb.New(t)
-			}
+		queryEnd := "WHERE key IN (?" + strings.Repeat(", ?", len(batch)-1) + ")"
+		if revision > 0 {
+			queryEnd += " AND revision <= ?"
+			args = append(args, revision)
 		}
-		if replicatedAtStr.Valid && replicatedAtStr.String != "" {
-			if t, err := time.Parse(time.RFC3339Nano, replicatedAtStr.String); err == nil {
-				record.ReplicatedAt = timestamppb.New(t)
-			}
+		found, err := db.selectRecord(queryEnd, true, true, args...)
+		if err != nil {
+			return nil, err
 		}
-
-		records = append(records, &record)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, 0, 0, err
-	}
-
-	return records, totalCount, maxRevision, nil
-}
-
-// FindAllRecordsForSnapshot returns all records up to the specified revision,
-// including deleted records (needed for proper snapshot creation)
-func (db *database) FindAllRecordsForSnapshot(upToRevision int64) ([]*proto.Record, error) {
-	queryEnd := "WHERE revision <= ? ORDER BY revision ASC"
-	var records []*proto.Record
-	var err error
-	// latestPerKey=false, excludeDeleted=false - we want all non-compacted records including deleted ones
-	records, err = db.selectRecord(queryEnd, false, false, upToRevision)
-	if err != nil {
-		return nil, err
+		records = append(records, found...)
 	}
+	slices.SortFunc(records, func(a, b *proto.Record) int {
+		return bytes.Compare(a.Key, b.Key)
+	})
 	return records, nil
 }
 
@@ -252,7 +334,7 @@ func (db *database) FindRecordByRev(rev int64) (record *proto.Record, err error)
 		"leader_id, " +
 		"replicated_at " +
 		"FROM records WHERE revision = ?"
-	rows, err := db.conn.Query(query, rev)
+	rows, err := db.readConn.Query(query, rev)
 	if err != nil {
 		return nil, err
 	}
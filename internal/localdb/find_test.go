@@ -0,0 +1,200 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+// newTestDB returns a connected database in a temporary directory
+func newTestDB(t *testing.T) *database {
+	t.Helper()
+	db := New(t.TempDir()+"/db.sqlite3", 2)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+// insertTestRecord inserts a record, failing the test on error
+func insertTestRecord(t *testing.T, db *database, record *proto.Record) {
+	t.Helper()
+	record.LeaderId = "test"
+	if _, err := db.InsertRecord(record, nil); err != nil {
+		t.Fatalf("InsertRecord %d: %v", record.Revision, err)
+	}
+}
+
+func TestFindRecordsByAtRevision(t *testing.T) {
+	db := newTestDB(t)
+	insertTestRecord(t, db, &proto.Record{Revision: 1, Key: []byte("a"), Value: []byte("a1"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 2, Key: []byte("b"), Value: []byte("b2"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 3, Key: []byte("a"), PrevRevision: 1, Deleted: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 4, Key: []byte("c"), Value: []byte("c4"), Created: true})
+
+	tests := []struct {
+		name     string
+		revision int64
+		limit    int64
+		order    string
+		keys     []string
+		count    int64
+	}{
+		{"latest", 0, 0, "ASC", []string{"b", "c"}, 2},
+		{"latest descending", 0, 0, "DESC", []string{"c", "b"}, 2},
+		{"before delete", 2, 0, "ASC", []string{"a", "b"}, 2},
+		{"before delete descending", 2, 0, "DESC", []string{"b", "a"}, 2},
+		{"at delete", 3, 0, "ASC", []string{"b"}, 1},
+		{"limited", 0, 1, "ASC", []string{"b"}, 2},
+		{"limited descending", 0, 1, "DESC", []string{"c"}, 2},
+		{"limited before delete descending", 2, 1, "DESC", []string{"b"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, count, maxRevision, err := db.FindRecordsBy("1=1", nil, tt.revision, tt.limit, SortByKey, tt.order)
+			if err != nil {
+				t.Fatalf("FindRecordsBy: %v", err)
+			}
+			var keys []string
+			for _, record := range records {
+				keys = append(keys, string(record.Key))
+			}
+			if !slices.Equal(keys, tt.keys) {
+				t.Errorf("expected keys %v, got %v", tt.keys, keys)
+			}
+			if count != tt.count {
+				t.Errorf("expected count %d, got %d", tt.count, count)
+			}
+			if maxRevision != 4 {
+				t.Errorf("expected max revision 4, got %d", maxRevision)
+			}
+		})
+	}
+}
+
+func TestFindRecordsByDeletedKeyAtOlderRevision(t *testing.T) {
+	db := newTestDB(t)
+	insertTestRecord(t, db, &proto.Record{Revision: 1, Key: []byte("a"), Value: []byte("a1"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 2, Key: []byte("a"), Value: []byte("a2"), PrevRevision: 1})
+	insertTestRecord(t, db, &proto.Record{Revision: 3, Key: []byte("a"), PrevRevision: 2, Deleted: true})
+
+	records, _, _, err := db.FindRecordsBy("key = ?", []any{[]byte("a")}, 2, 0, SortByKey, "ASC")
+	if err != nil {
+		t.Fatalf("FindRecordsBy: %v", err)
+	}
+	if len(records) != 1 || string(records[0].Value) != "a2" || records[0].Revision != 2 {
+		t.Fatalf("expected a at revision 2, got %v", records)
+	}
+
+	records, _, _, err = db.FindRecordsBy("key = ?", []any{[]byte("a")}, 0, 0, SortByKey, "ASC")
+	if err != nil {
+		t.Fatalf("FindRecordsBy: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected deleted key to be excluded, got %v", records)
+	}
+}
+
+func TestFindRecordsBySort(t *testing.T) {
+	db := newTestDB(t)
+	insertTestRecord(t, db, &proto.Record{Revision: 1, Key: []byte("b"), Value: []byte("z"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 2, Key: []byte("a"), Value: []byte("y"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 3, Key: []byte("c"), Value: []byte("x"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 4, Key: []byte("b"), Value: []byte("w"), PrevRevision: 1})
+	insertTestRecord(t, db, &proto.Record{Revision: 5, Key: []byte("d"), Value: []byte("v"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 6, Key: []byte("d"), PrevRevision: 5, Deleted: true})
+
+	tests := []struct {
+		name     string
+		sortBy   string
+		revision int64
+		limit    int64
+		order    string
+		keys     []string
+	}{
+		{"version", SortByVersion, 0, 0, "ASC", []string{"a", "c", "b"}},
+		{"version descending", SortByVersion, 0, 0, "DESC", []string{"b", "a", "c"}},
+		{"create revision", SortByCreateRevision, 0, 0, "ASC", []string{"b", "a", "c"}},
+		{"create revision descending", SortByCreateRevision, 0, 0, "DESC", []string{"c", "a", "b"}},
+		{"mod revision", SortByModRevision, 0, 0, "ASC", []string{"a", "c", "b"}},
+		{"mod revision descending", SortByModRevision, 0, 0, "DESC", []string{"b", "c", "a"}},
+		{"mod revision limited", SortByModRevision, 0, 2, "DESC", []string{"b", "c"}},
+		{"mod revision before update", SortByModRevision, 3, 0, "ASC", []string{"b", "a", "c"}},
+		{"mod revision before delete", SortByModRevision, 5, 0, "DESC", []string{"d", "b", "c", "a"}},
+		{"value", SortByValue, 0, 0, "ASC", []string{"b", "c", "a"}},
+		{"value descending limited", SortByValue, 0, 1, "DESC", []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, count, _, err := db.FindRecordsBy("1=1", nil, tt.revision, tt.limit, tt.sortBy, tt.order)
+			if err != nil {
+				t.Fatalf("FindRecordsBy: %v", err)
+			}
+			var keys []string
+			for _, record := range records {
+				keys = append(keys, string(record.Key))
+			}
+			if !slices.Equal(keys, tt.keys) {
+				t.Errorf("expected keys %v, got %v", tt.keys, keys)
+			}
+			if tt.limit == 0 && count != int64(len(tt.keys)) {
+				t.Errorf("expected count %d, got %d", len(tt.keys), count)
+			}
+		})
+	}
+
+	if _, _, _, err := db.FindRecordsBy("1=1", nil, 0, 0, "lease", "ASC"); err == nil {
+		t.Errorf("expected invalid sort column to fail")
+	}
+}
+
+func TestCountRecordsBy(t *testing.T) {
+	db := newTestDB(t)
+	insertTestRecord(t, db, &proto.Record{Revision: 1, Key: []byte("a"), Value: []byte("a1"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 2, Key: []byte("b"), Value: []byte("b2"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 3, Key: []byte("a"), PrevRevision: 1, Deleted: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 4, Key: []byte("c"), Value: []byte("c4"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 5, Key: []byte("b"), Value: []byte("b5"), PrevRevision: 2})
+	insertTestRecord(t, db, &proto.Record{Revision: 6, Key: []byte("a"), Value: []byte("a6"), Created: true})
+
+	tests := []struct {
+		name      string
+		where     string
+		whereArgs []any
+		revision  int64
+	}{
+		{"all", "1=1", nil, 0},
+		{"all before delete", "1=1", nil, 2},
+		{"all at delete", "1=1", nil, 3},
+		{"all before recreate", "1=1", nil, 5},
+		{"range", "key >= ? AND key < ?", []any{[]byte("a"), []byte("c")}, 0},
+		{"range at delete", "key >= ? AND key < ?", []any{[]byte("a"), []byte("c")}, 3},
+		{"deleted key", "key = ?", []any{[]byte("a")}, 4},
+		{"missing key", "key = ?", []any{[]byte("d")}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, expected, _, err := db.FindRecordsBy(tt.where, tt.whereArgs, tt.revision, 0, SortByKey, "ASC")
+			if err != nil {
+				t.Fatalf("FindRecordsBy: %v", err)
+			}
+			count, maxRevision, err := db.CountRecordsBy(tt.where, tt.whereArgs, tt.revision)
+			if err != nil {
+				t.Fatalf("CountRecordsBy: %v", err)
+			}
+			if count != expected {
+				t.Errorf("expected count %d, got %d", expected, count)
+			}
+			if maxRevision != 6 {
+				t.Errorf("expected max revision 6, got %d", maxRevision)
+			}
+		})
+	}
+}
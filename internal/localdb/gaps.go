@@ -0,0 +1,140 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Gap is a range of revisions which intentionally have no records, e.g.
+// because they were pruned. Gaps are recorded so that VerifyIntegrity can
+// tell policy-based removal of records apart from missing records.
+type Gap struct {
+	FirstRevision int64
+	LastRevision  int64
+	Reason        string
+	CreatedAt     time.Time
+}
+
+// Revisions returns the number of revisions in the gap
+func (g Gap) Revisions() int64 {
+	return g.LastRevision - g.FirstRevision + 1
+}
+
+// Gap reasons
+const (
+	// GapReasonPruneTombstones is used for revisions removed by PruneTombstones
+	GapReasonPruneTombstones = "prune_tombstones"
+	// GapReasonBackfill is used for revisions missing from a snapshot because
+	// they had been removed by the leader before the snapshot was written
+	GapReasonBackfill = "backfill"
+	// GapReasonSetNextRevision is used for revisions skipped by an operator
+	// setting the next revision (see peerapi SetNextRevision)
+	GapReasonSetNextRevision = "set_next_revision"
+	// GapReasonProxy is used for revisions of an upstream etcd (see proxy
+	// mode) which were no longer in its history when its keys were first
+	// replicated
+	GapReasonProxy = "proxy"
+)
+
+// RecordGap records revisions firstRevision to lastRevision (inclusive) as
+// a gap, e.g. when backfilling from a snapshot which omits pruned revisions.
+// The revisions must not have records. If tx is not nil, the gap is
+// recorded within it.
+func (db *database) RecordGap(firstRevision int64, lastRevision int64, reason string, tx *Tx) error {
+	if firstRevision <= 0 || lastRevision < firstRevision {
+		return fmt.Errorf("invalid gap revisions %d to %d", firstRevision, lastRevision)
+	}
+	insert := func(sqlTx *sql.Tx) error {
+		return insertGap(sqlTx, Gap{FirstRevision: firstRevision, LastRevision: lastRevision, Reason: reason, CreatedAt: db.now()})
+	}
+	var err error
+	if tx != nil {
+		err = insert(tx.tx)
+	} else {
+		err = db.write(insert)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record gap %d to %d: %w", firstRevision, lastRevision, err)
+	}
+	return nil
+}
+
+// Gaps returns all recorded gaps, ordered by revision
+func (db *database) Gaps() (gaps []Gap, err error) {
+	return db.findGaps("", nil)
+}
+
+// findGaps returns gaps matching whereQuery, ordered by revision
+func (db *database) findGaps(whereQuery string, whereArgs []any) (gaps []Gap, err error) {
+	query := "SELECT first_revision, last_revision, reason, created_at FROM revision_gaps " + whereQuery + " ORDER BY first_revision ASC"
+	rows, err := db.readConn.Query(query, whereArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var gap Gap
+		var createdAt string
+		if err = rows.Scan(&gap.FirstRevision, &gap.LastRevision, &gap.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		if gap.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, fmt.Errorf("invalid gap created_at %q: %w", createdAt, err)
+		}
+		gaps = append(gaps, gap)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return gaps, nil
+}
+
+// inGaps returns the subset of revisions which are within a recorded gap
+func (db *database) inGaps(revisions []int64) (found map[int64]bool, err error) {
+	found = map[int64]bool{}
+	if len(revisions) == 0 {
+		return found, nil
+	}
+	gaps, err := db.findGaps("WHERE last_revision >= ? AND first_revision <= ?", []any{slices.Min(revisions), slices.Max(revisions)})
+	if err != nil {
+		return nil, err
+	}
+	for _, revision := range revisions {
+		for _, gap := range gaps {
+			if revision >= gap.FirstRevision && revision <= gap.LastRevision {
+				found[revision] = true
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// insertGaps records revisions, which must be sorted, as gaps, grouping
+// consecutive revisions into a single gap
+func insertGaps(sqlTx *sql.Tx, revisions []int64, reason string, createdAt time.Time) error {
+	for i := 0; i < len(revisions); {
+		gap := Gap{FirstRevision: revisions[i], LastRevision: revisions[i], Reason: reason, CreatedAt: createdAt}
+		for i++; i < len(revisions) && revisions[i] == gap.LastRevision+1; i++ {
+			gap.LastRevision = revisions[i]
+		}
+		if err := insertGap(sqlTx, gap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertGap records a single gap
+func insertGap(sqlTx *sql.Tx, gap Gap) error {
+	_, err := sqlTx.Exec(
+		"INSERT INTO revision_gaps (first_revision, last_revision, reason, created_at) VALUES (?, ?, ?, ?)",
+		gap.FirstRevision, gap.LastRevision, gap.Reason, gap.CreatedAt.UTC().Format(time.RFC3339Nano),
+	)
+	return err
+}
@@ -59,50 +59,48 @@ func (db *database) InsertRecord(record *proto.Record, tx *Tx) (*proto.Record, e
 	}
 
 	// Set created at
-	record.CreatedAt = timestamppb.Now()
-
-	// Determine which query interface to use
-	var queryInterface interface {
-		QueryRow(query string, args ...any) *sql.Row
-	}
-	if tx != nil {
-		queryInterface = tx.tx
-	} else {
-		queryInterface = db.conn
-	}
+	record.CreatedAt = timestamppb.New(db.now())
 
 	// insert record and get returned values
 	var returnedRecord proto.Record
 	var createdAtStr string
 	var compactedAtStr, replicatedAtStr sql.NullString
-	err := queryInterface.QueryRow(
-		insertRecordSQL,
-		record.Revision,     // ?1
-		record.Key,          // ?2
-		record.Created,      // ?3
-		record.Deleted,      // ?4
-		record.PrevRevision, // ?5
-		record.Lease,        // ?6
-		record.Dek,          // ?7
-		record.Value,        // ?8
-		record.CreatedAt.AsTime().Format(time.RFC3339Nano), // ?9
-		record.LeaderId, // ?10
-	).Scan(
-		&returnedRecord.Revision,
-		&returnedRecord.Key,
-		&returnedRecord.Created,
-		&returnedRecord.Deleted,
-		&returnedRecord.CreateRevision,
-		&returnedRecord.PrevRevision,
-		&returnedRecord.Version,
-		&returnedRecord.Lease,
-		&returnedRecord.Dek,
-		&returnedRecord.Value,
-		&createdAtStr,
-		&compactedAtStr,
-		&returnedRecord.LeaderId,
-		&replicatedAtStr,
-	)
+	insert := func(sqlTx *sql.Tx) error {
+		return sqlTx.QueryRow(
+			insertRecordSQL,
+			record.Revision,     // ?1
+			record.Key,          // ?2
+			record.Created,      // ?3
+			record.Deleted,      // ?4
+			record.PrevRevision, // ?5
+			record.Lease,        // ?6
+			record.Dek,          // ?7
+			record.Value,        // ?8
+			record.CreatedAt.AsTime().Format(time.RFC3339Nano), // ?9
+			record.LeaderId, // ?10
+		).Scan(
+			&returnedRecord.Revision,
+			&returnedRecord.Key,
+			&returnedRecord.Created,
+			&returnedRecord.Deleted,
+			&returnedRecord.CreateRevision,
+			&returnedRecord.PrevRevision,
+			&returnedRecord.Version,
+			&returnedRecord.Lease,
+			&returnedRecord.Dek,
+			&returnedRecord.Value,
+			&createdAtStr,
+			&compactedAtStr,
+			&returnedRecord.LeaderId,
+			&replicatedAtStr,
+		)
+	}
+	var err error
+	if tx != nil {
+		err = insert(tx.tx)
+	} else {
+		err = db.write(insert)
+	}
 	if err != nil && err.Error() == "NOT NULL constraint failed: records.created" {
 		return nil, ErrCreateKeyExists
 	} else if err != nil && err.Error() == "NOT NULL constraint failed: records.deleted" {
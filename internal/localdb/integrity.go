@@ -0,0 +1,88 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrCorrupt is returned when the db file is corrupt, in which case it must
+// not be served from and should instead be rebuilt (e.g. from S3)
+var ErrCorrupt = errors.New("database file is corrupt")
+
+// maxIntegrityErrors limits the number of problems reported by CheckIntegrity
+const maxIntegrityErrors = 10
+
+// CheckIntegrity checks the db file for corruption using SQLite's
+// quick_check, or integrity_check if full is true. quick_check verifies the
+// structure of the file in O(N) time, while integrity_check additionally
+// verifies that indexes match their tables, which is much slower for large
+// dbs. Returns an error wrapping ErrCorrupt if any problems are found.
+func (db *database) CheckIntegrity(full bool) error {
+	pragma := "quick_check"
+	if full {
+		pragma = "integrity_check"
+	}
+	// PRAGMA does not support bound parameters
+	rows, err := db.readConn.Query(fmt.Sprintf("PRAGMA %s(%d)", pragma, maxIntegrityErrors))
+	if err != nil {
+		return wrapCorrupt(fmt.Errorf("failed to run %s: %w", pragma, err))
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err = rows.Scan(&result); err != nil {
+			return wrapCorrupt(fmt.Errorf("failed to read %s result: %w", pragma, err))
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return wrapCorrupt(fmt.Errorf("failed to read %s results: %w", pragma, err))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s found: %s", ErrCorrupt, pragma, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// isCorrupt returns true if err is a SQLite error caused by a corrupt or
+// invalid db file
+func isCorrupt(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrCorrupt || sqliteErr.Code == sqlite3.ErrNotADB
+}
+
+// wrapCorrupt wraps err with ErrCorrupt if it was caused by a corrupt db file
+func wrapCorrupt(err error) error {
+	if err != nil && isCorrupt(err) {
+		return fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return err
+}
+
+// Quarantine moves a (closed) db file and its WAL and shared memory files
+// aside, so that a new db can be created in its place while keeping the
+// corrupt files for investigation. Returns the path the db file was moved to.
+func Quarantine(file string) (quarantined string, err error) {
+	quarantined = fmt.Sprintf("%s.corrupt-%d", file, time.Now().Unix())
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err = os.Rename(file+suffix, quarantined+suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to move %s aside: %w", file+suffix, err)
+		}
+	}
+	return quarantined, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	file := t.TempDir() + "/db.sqlite3"
+	db := New(file, 2)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	for i := int64(1); i <= 500; i++ {
+		insertTestRecord(t, db, &proto.Record{Revision: i, Key: []byte(fmt.Sprintf("/key/%d", i)), Value: bytes.Repeat([]byte("v"), 100), Created: true})
+	}
+	for _, full := range []bool{false, true} {
+		if err := db.CheckIntegrity(full); err != nil {
+			t.Fatalf("CheckIntegrity(%t) on a valid db: %v", full, err)
+		}
+	}
+	stats, err := db.Size()
+	if err != nil {
+		t.Fatalf("Size: %v", err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// overwrite the pages after the first (which holds the schema)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for i := stats.PageSize; i < int64(len(data)); i++ {
+		data[i] = 0xa5
+	}
+	if err = os.WriteFile(file, data, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	db = New(file, 2)
+	defer db.Close()
+	err = db.Connect()
+	if err == nil {
+		err = db.CheckIntegrity(false)
+	}
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	file := t.TempDir() + "/db.sqlite3"
+	for _, suffix := range []string{"", "-wal"} {
+		if err := os.WriteFile(file+suffix, []byte(suffix), 0600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	quarantined, err := Quarantine(file)
+	if err != nil {
+		t.Fatalf("Quarantine: %v", err)
+	}
+	for _, suffix := range []string{"", "-wal"} {
+		if _, err = os.Stat(file + suffix); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be moved, got %v", file+suffix, err)
+		}
+		data, err := os.ReadFile(quarantined + suffix)
+		if err != nil || string(data) != suffix {
+			t.Fatalf("expected %s to contain %q, got %q (%v)", quarantined+suffix, suffix, data, err)
+		}
+	}
+}
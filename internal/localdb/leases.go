@@ -0,0 +1,116 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+// Lease is a granted lease, and when it was last kept alive. When leases
+// are loaded (e.g. after a restart) they expire their TTL after they were
+// last kept alive.
+type Lease struct {
+	ID            int64
+	TTL           int64
+	GrantedAt     time.Time
+	LastKeepAlive time.Time
+}
+
+// GrantLease stores a granted lease, replacing any lease with the same ID
+func (db *database) GrantLease(lease Lease) error {
+	lastKeepAlive := lease.LastKeepAlive
+	if lastKeepAlive.IsZero() {
+		lastKeepAlive = lease.GrantedAt
+	}
+	err := db.write(func(sqlTx *sql.Tx) error {
+		_, err := sqlTx.Exec(
+			"INSERT OR REPLACE INTO leases (id, ttl, granted_at, last_keepalive) VALUES (?, ?, ?, ?)",
+			lease.ID, lease.TTL, lease.GrantedAt.UTC().Format(time.RFC3339Nano), lastKeepAlive.UTC().Format(time.RFC3339Nano),
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to grant lease %d: %w", lease.ID, err)
+	}
+	return nil
+}
+
+// RenewLease records that a lease was kept alive at keptAliveAt, unless it
+// was since kept alive later, as concurrent keep alives may be recorded out
+// of order. Renewing a lease which does not exist is not an error.
+func (db *database) RenewLease(id int64, keptAliveAt time.Time) error {
+	err := db.write(func(sqlTx *sql.Tx) error {
+		_, err := sqlTx.Exec(
+			"UPDATE leases SET last_keepalive = ?2 WHERE id = ?1 AND julianday(last_keepalive) < julianday(?2)",
+			id, keptAliveAt.UTC().Format(time.RFC3339Nano),
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to renew lease %d: %w", id, err)
+	}
+	return nil
+}
+
+// RevokeLease removes a revoked or expired lease. Revoking a lease which
+// does not exist is not an error.
+func (db *database) RevokeLease(id int64) error {
+	err := db.write(func(sqlTx *sql.Tx) error {
+		_, err := sqlTx.Exec("DELETE FROM leases WHERE id = ?", id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke lease %d: %w", id, err)
+	}
+	return nil
+}
+
+// ListLeases returns all stored leases, ordered by ID
+func (db *database) ListLeases() (leases []Lease, err error) {
+	rows, err := db.readConn.Query("SELECT id, ttl, granted_at, last_keepalive FROM leases ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var lease Lease
+		var grantedAt, lastKeepAlive string
+		if err = rows.Scan(&lease.ID, &lease.TTL, &grantedAt, &lastKeepAlive); err != nil {
+			return nil, err
+		}
+		if lease.GrantedAt, err = time.Parse(time.RFC3339Nano, grantedAt); err != nil {
+			return nil, fmt.Errorf("invalid lease granted_at %q: %w", grantedAt, err)
+		}
+		if lease.LastKeepAlive, err = time.Parse(time.RFC3339Nano, lastKeepAlive); err != nil {
+			return nil, fmt.Errorf("invalid lease last_keepalive %q: %w", lastKeepAlive, err)
+		}
+		leases = append(leases, lease)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+// FindLeaseRecords returns the latest record of each key which is attached
+// to lease, i.e. whose latest record is not deleted and has the lease
+func (db *database) FindLeaseRecords(lease int64) ([]*proto.Record, error) {
+	// keys are found using the lease index, then the latest record of each
+	// is checked, as the key may since have been updated without the lease
+	candidates, err := db.selectRecord("WHERE key IN (SELECT key FROM records WHERE lease = ?)", true, true, lease)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find records of lease %d: %w", lease, err)
+	}
+	records := make([]*proto.Record, 0, len(candidates))
+	for _, record := range candidates {
+		if record.Lease == lease {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRenewLease checks that a lease keeps the latest keep alive when keep
+// alives are recorded out of order
+func TestRenewLease(t *testing.T) {
+	db := newTestDB(t)
+	grantedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.GrantLease(Lease{ID: 1, TTL: 60, GrantedAt: grantedAt}); err != nil {
+		t.Fatalf("GrantLease: %v", err)
+	}
+	latest := grantedAt.Add(10*time.Second + 500*time.Millisecond)
+	for _, keptAliveAt := range []time.Time{latest, grantedAt.Add(10 * time.Second)} {
+		if err := db.RenewLease(1, keptAliveAt); err != nil {
+			t.Fatalf("RenewLease: %v", err)
+		}
+	}
+	leases, err := db.ListLeases()
+	if err != nil {
+		t.Fatalf("ListLeases: %v", err)
+	}
+	if len(leases) != 1 || !leases[0].LastKeepAlive.Equal(latest) {
+		t.Fatalf("expected lease last kept alive at %s, got %+v", latest, leases)
+	}
+}
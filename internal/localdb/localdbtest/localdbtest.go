@@ -0,0 +1,25 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package localdbtest opens local databases for tests
+package localdbtest
+
+import (
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/localdb"
+)
+
+// New opens an empty local database in a temporary directory, which is
+// closed once the test completes
+func New(t testing.TB) localdb.Database {
+	t.Helper()
+	db := localdb.New(t.TempDir()+"/db.sqlite3", 2)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
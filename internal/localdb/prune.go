@@ -0,0 +1,85 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// PruneTombstonesBatchSize is the number of keys whose history is pruned in
+// each call to PruneTombstones
+const PruneTombstonesBatchSize = 1000
+
+// PruneTombstones deletes the entire history of up to limit keys which were
+// deleted at or before revision and not recreated since, as etcd does for
+// compacted tombstones. Each call is one write transaction, which blocks
+// other writes, so callers prune in batches by calling it until it returns 0. Compaction only empties values, so without pruning a deleted
+// key's records would be kept forever. Pruned revisions are recorded as gaps
+// (see RecordGap), so that they are still accounted for by VerifyIntegrity
+// and reported as compacted. The latest revision is never pruned, as it
+// determines the next revision.
+// Compact must have been applied to at least revision first, so that every
+// pruned record has been compacted.
+func (db *database) PruneTombstones(revision int64, limit int) (pruned int64, err error) {
+	if revision <= 0 {
+		return 0, fmt.Errorf("invalid prune revision: %d", revision)
+	}
+	if limit <= 0 {
+		return 0, fmt.Errorf("invalid prune limit: %d", limit)
+	}
+	prunedAt := db.now()
+	err = db.write(func(sqlTx *sql.Tx) error {
+		rows, err := sqlTx.Query("SELECT revision FROM records WHERE key IN ("+tombstonedKeysSQL+") ORDER BY revision ASC", revision, limit)
+		if err != nil {
+			return err
+		}
+		var revisions []int64
+		for rows.Next() {
+			var revision int64
+			if err = rows.Scan(&revision); err != nil {
+				rows.Close()
+				return err
+			}
+			revisions = append(revisions, revision)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+		result, err := sqlTx.Exec("DELETE FROM records WHERE key IN ("+tombstonedKeysSQL+")", revision, limit)
+		if err != nil {
+			return err
+		}
+		if pruned, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if pruned != int64(len(revisions)) {
+			return fmt.Errorf("deleted %d records but expected %d", pruned, len(revisions))
+		}
+		return insertGaps(sqlTx, revisions, GapReasonPruneTombstones, prunedAt)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune tombstones to revision %d: %w", revision, err)
+	}
+	return pruned, nil
+}
+
+// tombstonedKeysSQL selects up to ?2 keys whose latest record is a deletion
+// at or before ?1 which is not the latest revision, in key order so the same
+// keys are selected by each statement in a transaction. SQLite takes the value of bare
+// columns (deleted) from the row which has the MAX(revision).
+const tombstonedKeysSQL = `
+  SELECT key FROM (
+    SELECT key, deleted, MAX(revision) AS latest FROM records GROUP BY key
+  )
+  WHERE deleted = 1
+    AND latest <= ?1
+    AND latest < (SELECT MAX(revision) FROM records)
+  ORDER BY key
+  LIMIT ?2
+`
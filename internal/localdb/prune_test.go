@@ -0,0 +1,131 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestPruneTombstones(t *testing.T) {
+	db := newTestDB(t)
+	// a: created, updated, deleted
+	insertTestRecord(t, db, &proto.Record{Revision: 1, Key: []byte("a"), Value: []byte("a1"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 2, Key: []byte("a"), Value: []byte("a2"), PrevRevision: 1})
+	insertTestRecord(t, db, &proto.Record{Revision: 3, Key: []byte("a"), PrevRevision: 2, Deleted: true})
+	// b: created, deleted after the prune revision
+	insertTestRecord(t, db, &proto.Record{Revision: 4, Key: []byte("b"), Value: []byte("b4"), Created: true})
+	// c: created, deleted, recreated
+	insertTestRecord(t, db, &proto.Record{Revision: 5, Key: []byte("c"), Value: []byte("c5"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 6, Key: []byte("c"), PrevRevision: 5, Deleted: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 7, Key: []byte("c"), Value: []byte("c7"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 8, Key: []byte("b"), PrevRevision: 4, Deleted: true})
+
+	if _, err := db.Compact(7, time.Now()); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	pruned, err := db.PruneTombstones(7, PruneTombstonesBatchSize)
+	if err != nil {
+		t.Fatalf("PruneTombstones: %v", err)
+	}
+	if pruned != 3 {
+		t.Fatalf("expected 3 pruned records, got %d", pruned)
+	}
+	if err = db.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+	gaps, err := db.Gaps()
+	if err != nil {
+		t.Fatalf("Gaps: %v", err)
+	}
+	if len(gaps) != 1 || gaps[0].FirstRevision != 1 || gaps[0].LastRevision != 3 || gaps[0].Reason != GapReasonPruneTombstones {
+		t.Fatalf("expected a single gap of revisions 1 to 3, got %+v", gaps)
+	}
+	latest, err := db.LatestRevision()
+	if err != nil || latest != 8 {
+		t.Fatalf("expected latest revision 8, got %d (%v)", latest, err)
+	}
+
+	// pruned revisions are reported as compacted
+	compacted, compactRevision, err := db.GetRevisions([]int64{1, 2, 3, 4, 7, 9})
+	if err != nil {
+		t.Fatalf("GetRevisions: %v", err)
+	}
+	if compactRevision != 7 {
+		t.Fatalf("expected compact revision 7, got %d", compactRevision)
+	}
+	expect := map[int64]bool{1: true, 2: true, 3: true, 4: false, 7: false}
+	if len(compacted) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, compacted)
+	}
+	for revision, isCompacted := range expect {
+		if compacted[revision] != isCompacted {
+			t.Fatalf("expected %v, got %v", expect, compacted)
+		}
+	}
+	if _, isCompacted, _, err := db.GetRevision(2); err != nil || !isCompacted {
+		t.Fatalf("expected revision 2 to be compacted, got %t (%v)", isCompacted, err)
+	}
+
+	// the latest revision is never pruned, even when it is a tombstone
+	if _, err = db.Compact(8, time.Now()); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if pruned, err = db.PruneTombstones(8, PruneTombstonesBatchSize); err != nil || pruned != 0 {
+		t.Fatalf("expected nothing pruned, got %d (%v)", pruned, err)
+	}
+}
+
+func TestPruneTombstonesBatches(t *testing.T) {
+	db := newTestDB(t)
+	insertTestRecord(t, db, &proto.Record{Revision: 1, Key: []byte("a"), Value: []byte("a1"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 2, Key: []byte("a"), PrevRevision: 1, Deleted: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 3, Key: []byte("b"), Value: []byte("b3"), Created: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 4, Key: []byte("b"), PrevRevision: 3, Deleted: true})
+	insertTestRecord(t, db, &proto.Record{Revision: 5, Key: []byte("c"), Value: []byte("c5"), Created: true})
+	if _, err := db.Compact(4, time.Now()); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	// each batch prunes the history of one key, in key order
+	for i, expect := range []int64{2, 2, 0} {
+		pruned, err := db.PruneTombstones(4, 1)
+		if err != nil {
+			t.Fatalf("PruneTombstones batch %d: %v", i, err)
+		}
+		if pruned != expect {
+			t.Fatalf("batch %d: expected %d pruned records, got %d", i, expect, pruned)
+		}
+	}
+	if err := db.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+	if _, err := db.PruneTombstones(4, 0); err == nil {
+		t.Fatal("expected an error with an invalid limit")
+	}
+}
+
+func TestRecordGap(t *testing.T) {
+	db := newTestDB(t)
+	insertTestRecord(t, db, &proto.Record{Revision: 4, Key: []byte("a"), Value: []byte("a4"), Created: true})
+	if err := db.VerifyIntegrity(); err == nil {
+		t.Fatal("expected integrity error with missing revisions")
+	}
+	if err := db.RecordGap(1, 3, GapReasonBackfill, nil); err != nil {
+		t.Fatalf("RecordGap: %v", err)
+	}
+	if err := db.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+
+	// gaps must not overlap records
+	if err := db.RecordGap(4, 4, GapReasonBackfill, nil); err != nil {
+		t.Fatalf("RecordGap: %v", err)
+	}
+	if err := db.VerifyIntegrity(); err == nil {
+		t.Fatal("expected integrity error with a gap overlapping a record")
+	}
+}
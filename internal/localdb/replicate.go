@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/replication"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -16,14 +17,15 @@ import (
 // or when backfilling records. It differs significantly from the InsertRecord function,
 // in that no validation is performed on the fields and there is no handling of revision
 // incrementation - meaning you must be extremely careful when using this function.
-func (db *database) ReplicateRecord(record *proto.Record) (*proto.Record, error) {
+// If tx is not nil, the record is inserted within it.
+func (db *database) ReplicateRecord(record *proto.Record, tx *Tx) (*proto.Record, error) {
 	// do not allow zero values for revision
 	if record.Revision == 0 {
 		return nil, fmt.Errorf("cannot insert record with revision=0")
 	}
 
 	// set replicated at
-	record.ReplicatedAt = timestamppb.Now()
+	record.ReplicatedAt = timestamppb.New(db.now())
 
 	// prepare data
 	query := `INSERT INTO records (` +
@@ -74,37 +76,45 @@ func (db *database) ReplicateRecord(record *proto.Record) (*proto.Record, error)
 	var returnedRecord proto.Record
 	var returnedCreatedAtStr string
 	var compactedAtStr, returnedReplicatedAtStr sql.NullString
-	err := db.conn.QueryRow(
-		query,
-		record.Revision,       // 1
-		record.Key,            // 2
-		record.Created,        // 3
-		record.Deleted,        // 4
-		record.CreateRevision, // 5
-		record.PrevRevision,   // 6
-		record.Version,        // 7
-		record.Lease,          // 8
-		record.Dek,            // 9
-		record.Value,          // 10
-		createdAtStr,          // 11
-		record.LeaderId,       // 12
-		replicatedAtStr,       // 13
-	).Scan(
-		&returnedRecord.Revision,
-		&returnedRecord.Key,
-		&returnedRecord.Created,
-		&returnedRecord.Deleted,
-		&returnedRecord.CreateRevision,
-		&returnedRecord.PrevRevision,
-		&returnedRecord.Version,
-		&returnedRecord.Lease,
-		&returnedRecord.Dek,
-		&returnedRecord.Value,
-		&returnedCreatedAtStr,
-		&compactedAtStr,
-		&returnedRecord.LeaderId,
-		&returnedReplicatedAtStr,
-	)
+	insert := func(sqlTx *sql.Tx) error {
+		return sqlTx.QueryRow(
+			query,
+			record.Revision,       // 1
+			record.Key,            // 2
+			record.Created,        // 3
+			record.Deleted,        // 4
+			record.CreateRevision, // 5
+			record.PrevRevision,   // 6
+			record.Version,        // 7
+			record.Lease,          // 8
+			record.Dek,            // 9
+			record.Value,          // 10
+			createdAtStr,          // 11
+			record.LeaderId,       // 12
+			replicatedAtStr,       // 13
+		).Scan(
+			&returnedRecord.Revision,
+			&returnedRecord.Key,
+			&returnedRecord.Created,
+			&returnedRecord.Deleted,
+			&returnedRecord.CreateRevision,
+			&returnedRecord.PrevRevision,
+			&returnedRecord.Version,
+			&returnedRecord.Lease,
+			&returnedRecord.Dek,
+			&returnedRecord.Value,
+			&returnedCreatedAtStr,
+			&compactedAtStr,
+			&returnedRecord.LeaderId,
+			&returnedReplicatedAtStr,
+		)
+	}
+	var err error
+	if tx != nil {
+		err = insert(tx.tx)
+	} else {
+		err = db.write(insert)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -131,5 +141,7 @@ func (db *database) ReplicateRecord(record *proto.Record) (*proto.Record, error)
 		}
 	}
 
+	replication.ObserveApplied(&returnedRecord)
+
 	return &returnedRecord, nil
 }
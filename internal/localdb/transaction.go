@@ -9,21 +9,38 @@ import (
 )
 
 // Tx represents a database transaction, similar to database/sql.Tx
+// A Tx has exclusive use of the writer connection, so no other writes are
+// processed until it has been committed or rolled back.
 type Tx struct {
-	tx *sql.Tx
-	db *database
+	tx       *sql.Tx
+	db       *database
+	released chan struct{}
 }
 
 // BeginTx starts a new transaction
+// Note that the caller must not perform writes other than via the returned
+// Tx until it is committed or rolled back, as those writes would wait on it.
 func (db *database) BeginTx() (*Tx, error) {
-	sqlTx, err := db.conn.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	if db.writeCh == nil {
+		return nil, ErrDatabaseClosed
 	}
-	
+	req := &writeRequest{
+		begin: make(chan beginResult, 1),
+	}
+	select {
+	case db.writeCh <- req:
+	case <-db.writeStop:
+		return nil, ErrDatabaseClosed
+	}
+	res := <-req.begin
+	if res.err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", res.err)
+	}
+
 	return &Tx{
-		tx: sqlTx,
-		db: db,
+		tx:       res.tx,
+		db:       db,
+		released: res.released,
 	}, nil
 }
 
@@ -35,6 +52,7 @@ func (tx *Tx) Commit() error {
 	
 	err := tx.tx.Commit()
 	tx.tx = nil // Mark as completed
+	close(tx.released)
 	if err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -49,5 +67,6 @@ func (tx *Tx) Rollback() error {
 	
 	err := tx.tx.Rollback()
 	tx.tx = nil // Mark as completed
+	close(tx.released)
 	return err
 }
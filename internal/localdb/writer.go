@@ -0,0 +1,177 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+)
+
+// ErrDatabaseClosed is returned for writes submitted after Close
+var ErrDatabaseClosed = errors.New("database is closed")
+
+// maxWriteBatch is the maximum number of writes grouped into one transaction
+const maxWriteBatch = 128
+
+// writeRequest is a unit of work for the write loop. Either fn is set, in
+// which case fn is run inside a (possibly shared) transaction and the result
+// is sent on done, or begin is set, in which case the caller is handed an
+// exclusive transaction which it must Commit or Rollback.
+type writeRequest struct {
+	fn    func(sqlTx *sql.Tx) error
+	done  chan error
+	begin chan beginResult
+}
+
+// beginResult is the response to an exclusive transaction request
+type beginResult struct {
+	tx       *sql.Tx
+	released chan struct{}
+	err      error
+}
+
+// startWriteLoop starts the goroutine which owns the writer connection
+func (db *database) startWriteLoop() {
+	db.writeCh = make(chan *writeRequest)
+	db.writeStop = make(chan struct{})
+	db.writeLoopDone = make(chan struct{})
+	go db.writeLoop()
+}
+
+// stopWriteLoop stops the write loop, waiting for any in-progress write
+func (db *database) stopWriteLoop() {
+	if db.writeStop == nil {
+		return
+	}
+	select {
+	case <-db.writeStop:
+		// already stopped
+	default:
+		close(db.writeStop)
+	}
+	<-db.writeLoopDone
+}
+
+// writeLoop is the only goroutine which writes using the writer connection.
+// Writes which are queued at the same time are grouped into a single
+// transaction, so that they share a single commit (and fsync). Exclusive
+// transactions (see BeginTx) are run one at a time, in queue order.
+func (db *database) writeLoop() {
+	defer close(db.writeLoopDone)
+	for {
+		// block until the next request is received
+		var req *writeRequest
+		select {
+		case <-db.writeStop:
+			return
+		case req = <-db.writeCh:
+		}
+		if req.begin != nil {
+			db.runExclusive(req)
+			continue
+		}
+
+		// group any other queued writes, stopping at an exclusive request
+		batch := []*writeRequest{req}
+		var exclusive *writeRequest
+	gather:
+		for len(batch) < maxWriteBatch {
+			select {
+			case next := <-db.writeCh:
+				if next.begin != nil {
+					exclusive = next
+					break gather
+				}
+				batch = append(batch, next)
+			default:
+				break gather
+			}
+		}
+		db.runBatch(batch)
+		if exclusive != nil {
+			db.runExclusive(exclusive)
+		}
+	}
+}
+
+// runBatch runs a group of writes in one transaction. When there is more
+// than one write, each runs within its own savepoint so that a failing write
+// (e.g. a compare failure) does not affect the others.
+func (db *database) runBatch(batch []*writeRequest) {
+	metrics.DBWriteBatchSize.Observe(float64(len(batch)))
+	results := make([]error, len(batch))
+	sqlTx, err := db.conn.Begin()
+	if err != nil {
+		for _, req := range batch {
+			req.done <- fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		return
+	}
+	for i, req := range batch {
+		if len(batch) == 1 {
+			results[i] = req.fn(sqlTx)
+			continue
+		}
+		if _, err = sqlTx.Exec("SAVEPOINT write_request"); err != nil {
+			results[i] = err
+			continue
+		}
+		results[i] = req.fn(sqlTx)
+		if results[i] != nil {
+			_, _ = sqlTx.Exec("ROLLBACK TO write_request")
+		}
+		_, _ = sqlTx.Exec("RELEASE write_request")
+	}
+	if len(batch) == 1 && results[0] != nil {
+		_ = sqlTx.Rollback()
+	} else if err = sqlTx.Commit(); err != nil {
+		// writes which succeeded were not persisted
+		for i := range results {
+			if results[i] == nil {
+				results[i] = fmt.Errorf("failed to commit transaction: %w", err)
+			}
+		}
+	}
+	for i, req := range batch {
+		req.done <- results[i]
+	}
+}
+
+// runExclusive begins a transaction and hands it to the requester, then
+// waits until the requester has committed or rolled it back. If the write
+// loop is stopped first, the transaction is rolled back.
+func (db *database) runExclusive(req *writeRequest) {
+	sqlTx, err := db.conn.Begin()
+	if err != nil {
+		req.begin <- beginResult{err: err}
+		return
+	}
+	released := make(chan struct{})
+	req.begin <- beginResult{tx: sqlTx, released: released}
+	select {
+	case <-released:
+	case <-db.writeStop:
+		_ = sqlTx.Rollback()
+	}
+}
+
+// write submits fn to the write loop and waits for its result
+func (db *database) write(fn func(sqlTx *sql.Tx) error) error {
+	if db.writeCh == nil {
+		return ErrDatabaseClosed
+	}
+	req := &writeRequest{
+		fn:   fn,
+		done: make(chan error, 1),
+	}
+	select {
+	case db.writeCh <- req:
+	case <-db.writeStop:
+		return ErrDatabaseClosed
+	}
+	return <-req.done
+}
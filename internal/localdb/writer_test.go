@@ -0,0 +1,123 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package localdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countTestRows returns the number of rows in the test table
+func countTestRows(t *testing.T, db *database) (count int) {
+	t.Helper()
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM write_test").Scan(&count); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return count
+}
+
+func TestWriteIsolatesFailedWrites(t *testing.T) {
+	db := newTestDB(t)
+	err := db.write(func(sqlTx *sql.Tx) error {
+		_, err := sqlTx.Exec("CREATE TABLE write_test (id integer PRIMARY KEY)")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	// concurrent writes may be grouped into one transaction, in which case
+	// a failed write must only roll back its own changes
+	failErr := errors.New("fail")
+	var wg sync.WaitGroup
+	results := make([]error, 20)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = db.write(func(sqlTx *sql.Tx) error {
+				if _, err := sqlTx.Exec("INSERT INTO write_test (id) VALUES (?)", i); err != nil {
+					return err
+				}
+				if i%2 == 1 {
+					return failErr
+				}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	for i, err := range results {
+		if i%2 == 1 && !errors.Is(err, failErr) {
+			t.Errorf("write %d: expected failure, got %v", i, err)
+		} else if i%2 == 0 && err != nil {
+			t.Errorf("write %d: %v", i, err)
+		}
+	}
+	if count := countTestRows(t, db); count != len(results)/2 {
+		t.Errorf("expected %d rows, got %d", len(results)/2, count)
+	}
+}
+
+func TestBeginTxIsExclusive(t *testing.T) {
+	db := newTestDB(t)
+	err := db.write(func(sqlTx *sql.Tx) error {
+		_, err := sqlTx.Exec("CREATE TABLE write_test (id integer PRIMARY KEY)")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	written := make(chan error, 1)
+	go func() {
+		written <- db.write(func(sqlTx *sql.Tx) error {
+			_, err := sqlTx.Exec("INSERT INTO write_test (id) VALUES (2)")
+			return err
+		})
+	}()
+	// the write waits until the exclusive transaction is released
+	select {
+	case err := <-written:
+		t.Fatalf("expected the write to wait for the transaction, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := tx.tx.Exec("INSERT INTO write_test (id) VALUES (1)"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if count := countTestRows(t, db); count != 2 {
+		t.Errorf("expected 2 rows, got %d", count)
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	db := New(t.TempDir()+"/db.sqlite3", 2)
+	if err := db.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	db.Close()
+	err := db.write(func(sqlTx *sql.Tx) error {
+		return fmt.Errorf("unexpected write")
+	})
+	if !errors.Is(err, ErrDatabaseClosed) {
+		t.Errorf("expected ErrDatabaseClosed from write, got %v", err)
+	}
+	if _, err := db.BeginTx(); !errors.Is(err, ErrDatabaseClosed) {
+		t.Errorf("expected ErrDatabaseClosed from BeginTx, got %v", err)
+	}
+}
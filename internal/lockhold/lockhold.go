@@ -0,0 +1,131 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package lockhold measures how long contended locks, such as the leader
+// transaction lock and the watcher locks held while distributing events, are
+// held, and reports it via metrics and logs, so that contention regressions
+// are caught before they reduce throughput.
+package lockhold
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+)
+
+// Lock modes
+const (
+	// Read is a shared (read) hold of an RWMutex
+	Read = "read"
+	// Write is an exclusive hold of a Mutex or RWMutex
+	Write = "write"
+)
+
+// warnInterval is the minimum interval between slow hold warnings per lock
+const warnInterval = 10 * time.Second
+
+// warnConfig is the configuration set by SetWarnThreshold
+type warnConfig struct {
+	logger    log.Logger
+	warnAfter time.Duration
+}
+
+// warnState is when a lock was last warned about, and the number of slow
+// holds since
+type warnState struct {
+	lastWarned atomic.Int64 // unix nanoseconds
+	suppressed atomic.Int64
+}
+
+var (
+	// config is read on every unlock, so is swapped atomically rather than
+	// guarded by a mutex which every lock would contend on
+	config atomic.Pointer[warnConfig]
+	// warnStates holds the *warnState of each lock which was held slowly
+	warnStates sync.Map
+)
+
+func init() {
+	config.Store(&warnConfig{logger: log.NewNopLogger()})
+}
+
+// SetWarnThreshold sets the logger holds longer than threshold are warned
+// about, or disables warnings if threshold is not positive. Slow holds are
+// counted regardless.
+func SetWarnThreshold(l log.Logger, threshold time.Duration) {
+	config.Store(&warnConfig{logger: l, warnAfter: threshold})
+}
+
+// Observe records that the named lock was held in mode from acquired until
+// now, warning if it was held for longer than the warn threshold
+func Observe(name string, mode string, acquired time.Time) {
+	held := time.Since(acquired)
+	if name == "" {
+		name = "unknown"
+	}
+	metrics.LockHoldDuration.WithLabelValues(name, mode).Observe(held.Seconds())
+
+	c := config.Load()
+	if c.warnAfter <= 0 || held <= c.warnAfter {
+		return
+	}
+	metrics.LockHoldsSlow.WithLabelValues(name, mode).Inc()
+	value, _ := warnStates.LoadOrStore(name, &warnState{})
+	state := value.(*warnState)
+	now := time.Now().UnixNano()
+	lastWarned := state.lastWarned.Load()
+	// only one of concurrent slow holds warns, once the interval has passed
+	if now-lastWarned < int64(warnInterval) || !state.lastWarned.CompareAndSwap(lastWarned, now) {
+		state.suppressed.Add(1)
+		return
+	}
+	level.Warn(c.logger).Log("msg", "lock held longer than threshold", "lock", name, "mode", mode,
+		"held", held, "threshold", c.warnAfter, "suppressed", state.suppressed.Swap(0))
+}
+
+// Mutex is a sync.Mutex which records how long it is held
+type Mutex struct {
+	sync.Mutex
+	// Name is the metric label of the lock
+	Name     string
+	acquired time.Time
+}
+
+// Lock locks m
+func (m *Mutex) Lock() {
+	m.Mutex.Lock()
+	m.acquired = time.Now()
+}
+
+// Unlock unlocks m, recording how long it was held
+func (m *Mutex) Unlock() {
+	acquired := m.acquired
+	m.Mutex.Unlock()
+	Observe(m.Name, Write, acquired)
+}
+
+// RWMutex is a sync.RWMutex which records how long it is held for writing.
+// As read holds overlap, callers record them using Observe.
+type RWMutex struct {
+	sync.RWMutex
+	// Name is the metric label of the lock
+	Name     string
+	acquired time.Time
+}
+
+// Lock locks m for writing
+func (m *RWMutex) Lock() {
+	m.RWMutex.Lock()
+	m.acquired = time.Now()
+}
+
+// Unlock unlocks m for writing, recording how long it was held
+func (m *RWMutex) Unlock() {
+	acquired := m.acquired
+	m.RWMutex.Unlock()
+	Observe(m.Name, Write, acquired)
+}
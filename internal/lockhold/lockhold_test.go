@@ -0,0 +1,47 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package lockhold
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// TestSlowHoldWarnings checks that holds longer than the threshold are
+// warned about, at most once per interval per lock
+func TestSlowHoldWarnings(t *testing.T) {
+	var buf bytes.Buffer
+	SetWarnThreshold(log.NewLogfmtLogger(&buf), time.Millisecond)
+	t.Cleanup(func() {
+		SetWarnThreshold(log.NewNopLogger(), 0)
+	})
+
+	m := Mutex{Name: "test"}
+	hold := func(d time.Duration) {
+		m.Lock()
+		time.Sleep(d)
+		m.Unlock()
+	}
+	hold(0)
+	if buf.Len() != 0 {
+		t.Fatalf("expected no warning for a short hold, got %q", buf.String())
+	}
+	hold(5 * time.Millisecond)
+	if !strings.Contains(buf.String(), "lock=test mode=write") {
+		t.Fatalf("expected a warning for a slow hold, got %q", buf.String())
+	}
+	buf.Reset()
+	hold(5 * time.Millisecond)
+	if buf.Len() != 0 {
+		t.Fatalf("expected repeated warnings to be suppressed, got %q", buf.String())
+	}
+	state, _ := warnStates.Load("test")
+	if suppressed := state.(*warnState).suppressed.Load(); suppressed != 1 {
+		t.Fatalf("expected 1 suppressed warning, got %d", suppressed)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// AuditEntriesDropped counts audit entries which could not be written,
+	// by sink, as requests do not fail because they could not be audited
+	AuditEntriesDropped = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "audit",
+		Name:      "entries_dropped_total",
+		Help:      "Total number of audit entries which could not be written, by sink.",
+	}, []string{"sink"})
+)
@@ -0,0 +1,29 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// BackfillSkipped is 1 while backfill was skipped and the local database
+	// has not been reconciled with S3, e.g. as S3 is still unreachable or the
+	// local database is missing revisions, and 0 otherwise
+	BackfillSkipped = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "backfill",
+		Name:      "skipped",
+		Help:      "Whether backfill was skipped and the local database has not been reconciled with S3 (1 = unreconciled).",
+	})
+
+	// BackfillReconciles counts attempts to reconcile the local database with
+	// S3 after backfill was skipped, by result (reconciled, behind or error)
+	BackfillReconciles = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "backfill",
+		Name:      "reconciles_total",
+		Help:      "Total number of attempts to reconcile the local database with S3 after backfill was skipped, by result.",
+	}, []string{"result"})
+)
@@ -0,0 +1,93 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Clients are labelled by the common name of their TLS client certificate,
+// or anonymous if they did not present one
+
+var (
+	// ClientRequests counts the Range and Txn requests admitted from each
+	// client, by type (read or write)
+	ClientRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "requests_total",
+		Help:      "Total number of requests admitted from each client, by type.",
+	}, []string{"client", "type"})
+
+	// ClientRequestsThrottled counts the Range and Txn requests rejected as
+	// each client exceeded its rate limit, by type (read or write)
+	ClientRequestsThrottled = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "requests_throttled_total",
+		Help:      "Total number of requests rejected as each client exceeded its rate limit, by type.",
+	}, []string{"client", "type"})
+
+	// ClientRequestsDenied counts the requests and watches of each client
+	// rejected by read rules
+	ClientRequestsDenied = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "requests_denied_total",
+		Help:      "Total number of requests and watches from each client rejected by read rules.",
+	}, []string{"client"})
+
+	// ClientWatchers is the number of watchers (watch streams) of each client
+	ClientWatchers = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "watchers",
+		Help:      "Number of watchers of each client.",
+	}, []string{"client"})
+
+	// ClientWatchesActive is the number of active watches of each client
+	ClientWatchesActive = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "watches_active",
+		Help:      "Number of active watches of each client.",
+	}, []string{"client"})
+
+	// ClientWatchEventsSent counts the watch events sent to each client
+	ClientWatchEventsSent = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "watch_events_sent_total",
+		Help:      "Total number of watch events sent to each client.",
+	}, []string{"client"})
+
+	// ClientWatchEventsDropped counts the watch events which were not queued
+	// for each client as its watcher's queue was full, which are then sent
+	// by catch up, or whose watches are cancelled
+	ClientWatchEventsDropped = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "watch_events_dropped_total",
+		Help:      "Total number of watch events not queued for each client as its watcher's queue was full.",
+	}, []string{"client"})
+
+	// ClientWatchSendDuration observes how long sending each watch response
+	// to each client took, which grows as the client falls behind
+	ClientWatchSendDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "watch_send_duration_seconds",
+		Help:      "Time taken to send each watch response to each client.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"client"})
+
+	// ClientWatchCreates counts the watch create requests received from each
+	// client
+	ClientWatchCreates = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "watch_creates_total",
+		Help:      "Total number of watch create requests received from each client.",
+	}, []string{"client"})
+)
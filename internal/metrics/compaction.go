@@ -0,0 +1,46 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// CompactionRuns counts periodic compaction runs, by result (compacted,
+	// skipped if there was nothing to compact, or error)
+	CompactionRuns = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "compaction",
+		Name:      "runs_total",
+		Help:      "Total number of periodic compaction runs, by result (compacted, skipped or error).",
+	}, []string{"result"})
+
+	// CompactionRecords counts records whose values were compacted by
+	// periodic compaction
+	CompactionRecords = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "compaction",
+		Name:      "records_total",
+		Help:      "Total number of superseded records compacted by periodic compaction.",
+	})
+
+	// CompactionRevision is the revision the database was last compacted to
+	// by periodic compaction
+	CompactionRevision = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "compaction",
+		Name:      "revision",
+		Help:      "Revision the database was last compacted to by periodic compaction.",
+	})
+
+	// CompactionDuration observes the time taken by each periodic compaction
+	CompactionDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "compaction",
+		Name:      "duration_seconds",
+		Help:      "Time taken by each periodic compaction.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+)
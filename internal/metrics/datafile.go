@@ -0,0 +1,72 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// DatafileCompressionRatio observes the ratio of uncompressed to
+	// compressed size of each compressed datafile written, by file kind
+	DatafileCompressionRatio = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "datafile",
+		Name:      "compression_ratio",
+		Help:      "Ratio of uncompressed to compressed size of compressed datafiles written, by file kind.",
+		Buckets:   []float64{1, 1.5, 2, 3, 4, 6, 8, 12, 16, 32},
+	}, []string{"kind"})
+
+	// DatafileCompressionDuration observes the time spent compressing each
+	// compressed datafile written, by file kind
+	DatafileCompressionDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "datafile",
+		Name:      "compression_duration_seconds",
+		Help:      "Time spent compressing datafiles written, by file kind.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"kind"})
+
+	// DatafileSmartCompressionSize observes the serialized size of the
+	// records of each chunk whose compression was chosen by size, by the
+	// compression chosen
+	DatafileSmartCompressionSize = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "datafile",
+		Name:      "smart_compression_size_bytes",
+		Help:      "Serialized size of the records of chunks whose compression was chosen by size, by compression.",
+		Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+	}, []string{"compression"})
+
+	// DatafileSmartCompressionRatio observes the compression ratio of each
+	// chunk compressed because it was above the size threshold, to validate
+	// the threshold, e.g. ratios near 1 suggest it is too low
+	DatafileSmartCompressionRatio = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "datafile",
+		Name:      "smart_compression_ratio",
+		Help:      "Ratio of uncompressed to compressed size of chunks compressed because they were above the size threshold.",
+		Buckets:   []float64{1, 1.5, 2, 3, 4, 6, 8, 12, 16, 32},
+	})
+
+	// DatafileLineageAnomalies counts data files imported by backfill whose
+	// header leader ID or creation time, or metadata leader epoch, does not
+	// fit the files before it, which may indicate foreign or tampered files
+	// in the bucket, or a leader takeover which was not fenced, by reason
+	DatafileLineageAnomalies = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "datafile",
+		Name:      "lineage_anomalies_total",
+		Help:      "Data files imported by backfill whose header leader ID, creation time or leader epoch is anomalous, by reason.",
+	}, []string{"reason"})
+
+	// DatafileChecksumMismatches counts data files downloaded from S3 whose
+	// SHA-256 hash did not match the checksum they were uploaded with
+	DatafileChecksumMismatches = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "datafile",
+		Name:      "checksum_mismatches_total",
+		Help:      "Total number of data files downloaded from S3 whose hash did not match their checksum.",
+	})
+)
@@ -0,0 +1,79 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// DBWriteBatchSize observes how many writes are grouped into a single
+	// local db transaction by the write loop
+	DBWriteBatchSize = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "write_batch_size",
+		Help:      "Number of local db writes committed per transaction.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+	})
+)
+
+// DBSize holds the local db size stats reported by the db size collector
+type DBSize struct {
+	SizeBytes       int64
+	SizeInUseBytes  int64
+	WALSizeBytes    int64
+	FreelistPages   int64
+	PageUtilization float64
+}
+
+var (
+	dbSizeBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "size_bytes"),
+		"Total size of the local db file in bytes.", nil, nil)
+	dbSizeInUseBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "size_in_use_bytes"),
+		"Size of the local db file in bytes excluding free pages.", nil, nil)
+	dbWALSizeBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "wal_size_bytes"),
+		"Size of the local db WAL file in bytes.", nil, nil)
+	dbFreelistPagesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "freelist_pages"),
+		"Number of unused pages in the local db file.", nil, nil)
+	dbPageUtilizationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "page_utilization_ratio"),
+		"Fraction of local db pages in use. A low ratio indicates a VACUUM would reclaim space.", nil, nil)
+)
+
+// dbSizeCollector reports local db size stats, which are read at scrape time
+type dbSizeCollector struct {
+	size func() (DBSize, error)
+}
+
+// RegisterDBSize registers a collector which reports the stats returned by
+// size each time metrics are scraped
+func RegisterDBSize(size func() (DBSize, error)) {
+	Registry.MustRegister(&dbSizeCollector{size: size})
+}
+
+func (c *dbSizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbSizeBytesDesc
+	ch <- dbSizeInUseBytesDesc
+	ch <- dbWALSizeBytesDesc
+	ch <- dbFreelistPagesDesc
+	ch <- dbPageUtilizationDesc
+}
+
+func (c *dbSizeCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.size()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(dbSizeBytesDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(dbSizeBytesDesc, prometheus.GaugeValue, float64(stats.SizeBytes))
+	ch <- prometheus.MustNewConstMetric(dbSizeInUseBytesDesc, prometheus.GaugeValue, float64(stats.SizeInUseBytes))
+	ch <- prometheus.MustNewConstMetric(dbWALSizeBytesDesc, prometheus.GaugeValue, float64(stats.WALSizeBytes))
+	ch <- prometheus.MustNewConstMetric(dbFreelistPagesDesc, prometheus.GaugeValue, float64(stats.FreelistPages))
+	ch <- prometheus.MustNewConstMetric(dbPageUtilizationDesc, prometheus.GaugeValue, stats.PageUtilization)
+}
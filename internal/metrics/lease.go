@@ -0,0 +1,54 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// LeasesActive is the number of granted leases which have not expired or
+	// been revoked
+	LeasesActive = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "lease",
+		Name:      "active",
+		Help:      "Number of granted leases which have not expired or been revoked.",
+	})
+
+	// LeasesEnded counts leases which ended, by reason (expired or revoked)
+	LeasesEnded = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lease",
+		Name:      "ended_total",
+		Help:      "Total number of leases which ended, by reason (expired or revoked).",
+	}, []string{"reason"})
+
+	// LeaseKeysDeleted counts keys deleted because their lease ended
+	LeaseKeysDeleted = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lease",
+		Name:      "keys_deleted_total",
+		Help:      "Total number of keys deleted because their lease expired or was revoked.",
+	})
+
+	// LeaseReplicationFailures counts failures to replicate the lease state,
+	// which are retried
+	LeaseReplicationFailures = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lease",
+		Name:      "replication_failures_total",
+		Help:      "Total number of failures to replicate the lease state to S3, which are retried.",
+	})
+
+	// LeasesRearmed counts leases loaded on becoming the leader which were
+	// given the restart grace period, as they would otherwise have expired
+	// sooner
+	LeasesRearmed = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lease",
+		Name:      "rearmed_total",
+		Help:      "Total number of leases loaded on becoming the leader which were given the restart grace period.",
+	})
+)
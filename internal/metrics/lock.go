@@ -0,0 +1,29 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// LockHoldDuration observes how long contended locks were held, by lock
+	// (leader_txn, all_watchers or watcher) and mode (read or write)
+	LockHoldDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "lock",
+		Name:      "hold_duration_seconds",
+		Help:      "Time contended locks were held, by lock and mode.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+	}, []string{"lock", "mode"})
+
+	// LockHoldsSlow counts lock holds longer than the lock hold warning
+	// threshold, by lock and mode
+	LockHoldsSlow = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lock",
+		Name:      "holds_slow_total",
+		Help:      "Total number of lock holds longer than the lock hold warning threshold, by lock and mode.",
+	}, []string{"lock", "mode"})
+)
@@ -0,0 +1,36 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// MemoryRSSBytes is the process resident set size, as last sampled by
+	// the memory watchdog
+	MemoryRSSBytes = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "memory",
+		Name:      "rss_bytes",
+		Help:      "Process resident set size in bytes, as sampled by the memory watchdog.",
+	})
+
+	// MemoryHeapBytes is the Go heap size, as last sampled by the memory
+	// watchdog
+	MemoryHeapBytes = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "memory",
+		Name:      "heap_bytes",
+		Help:      "Go heap object size in bytes, as sampled by the memory watchdog.",
+	})
+
+	// MemoryDegradationLevel is the current memory degradation level
+	MemoryDegradationLevel = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "memory",
+		Name:      "degradation_level",
+		Help:      "Current memory degradation level (0 = normal, 1 = elevated, 2 = critical).",
+	})
+)
@@ -0,0 +1,28 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// namespace is the prefix for all netsy metric names
+const namespace = "netsy"
+
+// Registry is the Prometheus registry all netsy metrics are registered with.
+// We use our own registry rather than the global default registry so that
+// only netsy (plus Go runtime and process) metrics are exposed.
+var Registry = prometheus.NewRegistry()
+
+// factory registers metrics with Registry on creation
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
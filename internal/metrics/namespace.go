@@ -0,0 +1,31 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Writes are labelled by the Kubernetes namespace of their key, _cluster
+// for keys without a namespace, or _overflow once metrics_namespaces_max
+// namespaces have been labelled
+
+var (
+	// NamespaceWrites counts the records committed in each namespace
+	NamespaceWrites = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "namespace",
+		Name:      "writes_total",
+		Help:      "Total number of records committed in each Kubernetes namespace.",
+	}, []string{"namespace"})
+
+	// NamespaceWriteBytes counts the bytes of the keys and values of the
+	// records committed in each namespace
+	NamespaceWriteBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "namespace",
+		Name:      "write_bytes_total",
+		Help:      "Total bytes of the keys and values of records committed in each Kubernetes namespace.",
+	}, []string{"namespace"})
+)
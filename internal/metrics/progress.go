@@ -0,0 +1,19 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// OperationProgress is the fraction completed of each running long
+	// operation, such as backfill or snapshot creation
+	OperationProgress = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "operation",
+		Name:      "progress_ratio",
+		Help:      "Fraction completed of running long operations (e.g. backfill, snapshot), between 0 and 1.",
+	}, []string{"operation"})
+)
@@ -0,0 +1,47 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ProxyRequests counts requests forwarded to the upstream etcd in proxy
+	// mode (see proxy_etcd_endpoints), by method and result (success, error,
+	// or not_replicated if the write was not replicated locally in time)
+	ProxyRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "requests_total",
+		Help:      "Total number of requests forwarded to the upstream etcd, by method and result.",
+	}, []string{"method", "result"})
+
+	// ProxyReplicatedRevision is the latest revision of the upstream etcd
+	// replicated to the local database
+	ProxyReplicatedRevision = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "replicated_revision",
+		Help:      "Latest revision of the upstream etcd replicated to the local database.",
+	})
+
+	// ProxyUpstreamRevision is the latest revision of the upstream etcd, as
+	// reported by its watch responses
+	ProxyUpstreamRevision = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "upstream_revision",
+		Help:      "Latest revision of the upstream etcd, as reported by its watch responses.",
+	})
+
+	// ProxyWatchRestarts counts restarts of the watch replicating the
+	// upstream etcd, e.g. after it lost its leader
+	ProxyWatchRestarts = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "proxy",
+		Name:      "watch_restarts_total",
+		Help:      "Total number of restarts of the watch replicating the upstream etcd.",
+	})
+)
@@ -0,0 +1,56 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// RangeCacheRequests counts Range requests at a past revision looked up
+	// in the range cache, by result (hit or miss)
+	RangeCacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "range_cache",
+		Name:      "requests_total",
+		Help:      "Total number of Range requests at a past revision looked up in the range cache, by result.",
+	}, []string{"result"})
+
+	// RangeCacheEvictions counts responses evicted from the range cache to
+	// keep it within its size
+	RangeCacheEvictions = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "range_cache",
+		Name:      "evictions_total",
+		Help:      "Total number of responses evicted from the range cache.",
+	})
+
+	// RangeCacheVerifications counts cached responses verified against the
+	// local db (see range_cache_verify_percent), by result (match,
+	// compacted if its revision was compacted while it was verified, or
+	// mismatch if the response at a past revision changed, which is a bug)
+	RangeCacheVerifications = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "range_cache",
+		Name:      "verifications_total",
+		Help:      "Total number of cached Range responses verified against the local db, by result.",
+	}, []string{"result"})
+
+	// RangeCacheEntries is the number of responses in the range cache
+	RangeCacheEntries = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "range_cache",
+		Name:      "entries",
+		Help:      "Number of responses in the range cache.",
+	})
+
+	// RangeCacheBytes is the approximate size of the responses in the range
+	// cache
+	RangeCacheBytes = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "range_cache",
+		Name:      "bytes",
+		Help:      "Approximate size of the responses in the range cache, in bytes.",
+	})
+)
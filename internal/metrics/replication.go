@@ -0,0 +1,63 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReplicationLag holds the follower replication stats reported by the
+// replication lag collector
+type ReplicationLag struct {
+	LeaderRevision  int64
+	AppliedRevision int64
+	LagRecords      int64
+	LagSeconds      float64
+}
+
+var (
+	replicationLeaderRevisionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "replication", "leader_revision"),
+		"Latest revision known to have been written by the leader.", nil, nil)
+	replicationAppliedRevisionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "replication", "applied_revision"),
+		"Latest revision replicated from the leader and applied to the local db.", nil, nil)
+	replicationLagRecordsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "replication", "lag_records"),
+		"Number of revisions the local db is behind the leader.", nil, nil)
+	replicationLagSecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "replication", "lag_seconds"),
+		"Time since the leader wrote the latest applied revision, while behind the leader (0 = caught up).", nil, nil)
+)
+
+// replicationLagCollector reports follower replication stats, which are read
+// at scrape time so that the lag in seconds grows while replication stalls
+type replicationLagCollector struct {
+	lag func() (ReplicationLag, bool)
+}
+
+// RegisterReplicationLag registers a collector which reports the stats
+// returned by lag each time metrics are scraped. No metrics are reported
+// while lag returns false, e.g. before a leader revision is known.
+func RegisterReplicationLag(lag func() (ReplicationLag, bool)) {
+	Registry.MustRegister(&replicationLagCollector{lag: lag})
+}
+
+func (c *replicationLagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- replicationLeaderRevisionDesc
+	ch <- replicationAppliedRevisionDesc
+	ch <- replicationLagRecordsDesc
+	ch <- replicationLagSecondsDesc
+}
+
+func (c *replicationLagCollector) Collect(ch chan<- prometheus.Metric) {
+	lag, ok := c.lag()
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(replicationLeaderRevisionDesc, prometheus.GaugeValue, float64(lag.LeaderRevision))
+	ch <- prometheus.MustNewConstMetric(replicationAppliedRevisionDesc, prometheus.GaugeValue, float64(lag.AppliedRevision))
+	ch <- prometheus.MustNewConstMetric(replicationLagRecordsDesc, prometheus.GaugeValue, float64(lag.LagRecords))
+	ch <- prometheus.MustNewConstMetric(replicationLagSecondsDesc, prometheus.GaugeValue, lag.LagSeconds)
+}
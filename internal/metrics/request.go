@@ -0,0 +1,39 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// RequestsInFlight is the number of admitted Range and Txn requests
+	// currently being processed, by priority class (system or user)
+	RequestsInFlight = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "request",
+		Name:      "in_flight",
+		Help:      "Number of admitted requests currently being processed, by priority class.",
+	}, []string{"class"})
+
+	// RequestAdmissionWait observes how long requests waited for an
+	// admission slot, by priority class
+	RequestAdmissionWait = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "request",
+		Name:      "admission_wait_seconds",
+		Help:      "Time requests waited to be admitted, by priority class.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"class"})
+
+	// RequestsUnsupported counts requests rejected for using an etcd
+	// feature which netsy does not implement, by feature (e.g. "Compare
+	// target VERSION"), so that compatibility gaps can be measured
+	RequestsUnsupported = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "request",
+		Name:      "unsupported_total",
+		Help:      "Total number of requests rejected for using an unsupported etcd feature, by feature.",
+	}, []string{"feature"})
+)
@@ -0,0 +1,119 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ServerOptions restricts access to the metrics server, as metrics can leak
+// details of the cluster. The zero value serves plain HTTP to anyone.
+type ServerOptions struct {
+	// TLSConfig serves HTTPS if set, which can also require client certs
+	TLSConfig *tls.Config
+	// BearerToken requires requests to have an "Authorization: Bearer"
+	// header with this token if set
+	BearerToken string
+	// AllowedPrefixes restricts requests to remote addresses within these
+	// prefixes if set
+	AllowedPrefixes []netip.Prefix
+}
+
+// ParseAllowedPrefixes parses a comma-separated list of CIDRs and/or IP
+// addresses, e.g. "10.0.0.0/8,192.168.1.10"
+func ParseAllowedPrefixes(value string) (prefixes []netip.Prefix, err error) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var prefix netip.Prefix
+		if strings.Contains(item, "/") {
+			prefix, err = netip.ParsePrefix(item)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(item)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid address or CIDR %q: %w", item, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// NewServer returns an HTTP server which serves the Registry metrics on
+// the /metrics path of the given address. Use ListenAndServe to start it,
+// which serves HTTPS if options.TLSConfig is set.
+func NewServer(addr string, options ServerOptions) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	return &Server{
+		Server: &http.Server{
+			Addr:              addr,
+			Handler:           options.restrict(mux),
+			TLSConfig:         options.TLSConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Server is a metrics HTTP server
+type Server struct {
+	*http.Server
+}
+
+// ListenAndServe serves HTTPS if the server has a TLS config, otherwise HTTP
+func (s *Server) ListenAndServe() error {
+	if s.TLSConfig != nil {
+		// certificates are provided by the TLS config
+		return s.Server.ListenAndServeTLS("", "")
+	}
+	return s.Server.ListenAndServe()
+}
+
+// restrict wraps handler to reject requests from addresses which are not
+// allowed or without the bearer token
+func (o ServerOptions) restrict(handler http.Handler) http.Handler {
+	if o.BearerToken == "" && len(o.AllowedPrefixes) == 0 {
+		return handler
+	}
+	expectAuthorization := []byte("Bearer " + o.BearerToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(o.AllowedPrefixes) > 0 && !o.allowed(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if o.BearerToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expectAuthorization) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// allowed returns true if remoteAddr is within one of the allowed prefixes
+func (o ServerOptions) allowed(remoteAddr string) bool {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range o.AllowedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAllowedPrefixes(t *testing.T) {
+	prefixes, err := ParseAllowedPrefixes(" 10.1.2.3/8, 192.168.1.10,,::1 ")
+	if err != nil {
+		t.Fatalf("ParseAllowedPrefixes: %v", err)
+	}
+	expect := []string{"10.0.0.0/8", "192.168.1.10/32", "::1/128"}
+	if len(prefixes) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, prefixes)
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != expect[i] {
+			t.Fatalf("expected %v, got %v", expect, prefixes)
+		}
+	}
+	if _, err = ParseAllowedPrefixes("10.0.0.0/33"); err == nil {
+		t.Fatalf("expected error for invalid CIDR")
+	}
+}
+
+func TestServerRestrict(t *testing.T) {
+	prefixes, err := ParseAllowedPrefixes("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("ParseAllowedPrefixes: %v", err)
+	}
+	tests := []struct {
+		name          string
+		options       ServerOptions
+		remoteAddr    string
+		authorization string
+		expectStatus  int
+	}{
+		{"unrestricted", ServerOptions{}, "192.0.2.1:1234", "", http.StatusOK},
+		{"allowed address", ServerOptions{AllowedPrefixes: prefixes}, "10.1.2.3:1234", "", http.StatusOK},
+		{"allowed mapped address", ServerOptions{AllowedPrefixes: prefixes}, "[::ffff:10.1.2.3]:1234", "", http.StatusOK},
+		{"disallowed address", ServerOptions{AllowedPrefixes: prefixes}, "192.0.2.1:1234", "", http.StatusForbidden},
+		{"valid token", ServerOptions{BearerToken: "secret"}, "192.0.2.1:1234", "Bearer secret", http.StatusOK},
+		{"invalid token", ServerOptions{BearerToken: "secret"}, "192.0.2.1:1234", "Bearer wrong", http.StatusUnauthorized},
+		{"missing token", ServerOptions{BearerToken: "secret"}, "192.0.2.1:1234", "", http.StatusUnauthorized},
+		{"valid token disallowed address", ServerOptions{BearerToken: "secret", AllowedPrefixes: prefixes}, "192.0.2.1:1234", "Bearer secret", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer("", tt.options)
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			server.Handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.expectStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectStatus, recorder.Code)
+			}
+		})
+	}
+}
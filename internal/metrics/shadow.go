@@ -0,0 +1,49 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ShadowWrites counts writes forwarded to the shadow etcd (see
+	// shadow_etcd_endpoints), by result (forwarded, error, or dropped if
+	// the forwarding queue was full, or the write was queued after later
+	// writes were forwarded)
+	ShadowWrites = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "shadow",
+		Name:      "writes_total",
+		Help:      "Total number of writes forwarded to the shadow etcd, by result.",
+	}, []string{"result"})
+
+	// ShadowComparisons counts comparisons of keys with the shadow etcd, by
+	// result (match, diverged, skipped if writes had not yet been forwarded,
+	// or error)
+	ShadowComparisons = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "shadow",
+		Name:      "comparisons_total",
+		Help:      "Total number of comparisons of keys with the shadow etcd, by result.",
+	}, []string{"result"})
+
+	// ShadowDivergences counts keys which differed from the shadow etcd, by
+	// kind (missing_in_etcd, missing_in_netsy or value_mismatch)
+	ShadowDivergences = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "shadow",
+		Name:      "divergences_total",
+		Help:      "Total number of keys which differed from the shadow etcd, by kind.",
+	}, []string{"kind"})
+
+	// ShadowDivergentKeys is the number of keys which differed from the
+	// shadow etcd in the latest comparison
+	ShadowDivergentKeys = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "shadow",
+		Name:      "divergent_keys",
+		Help:      "Number of keys which differed from the shadow etcd in the latest comparison.",
+	})
+)
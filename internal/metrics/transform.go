@@ -0,0 +1,20 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ValueTransformErrors counts record values which could not be
+	// transformed, by transformer and operation (encode or decode), e.g.
+	// values whose signature did not match
+	ValueTransformErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "value_transform",
+		Name:      "errors_total",
+		Help:      "Total number of record values which could not be transformed, by transformer and operation.",
+	}, []string{"transformer", "operation"})
+)
@@ -0,0 +1,80 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// TxnTotal counts leader transactions by operation (create, update,
+	// delete, delete_range or unknown) and result (success,
+	// revision_mismatch, key_exists, key_not_found, fenced, s3_unavailable,
+	// unsupported or error). Conflicts are the revision_mismatch, key_exists
+	// and key_not_found results, e.g. controllers fighting over the same
+	// key.
+	TxnTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "txn",
+		Name:      "total",
+		Help:      "Total number of leader transactions, by operation and result.",
+	}, []string{"operation", "result"})
+
+	// TxnDuration observes how long leader transactions took, by operation,
+	// including waiting for earlier transactions and S3 sync
+	TxnDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "txn",
+		Name:      "duration_seconds",
+		Help:      "Time taken to process leader transactions, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// TxnS3SyncDuration observes how long records took to upload to S3 in
+	// synchronous replication mode, by result (success or error)
+	TxnS3SyncDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "txn",
+		Name:      "s3_sync_duration_seconds",
+		Help:      "Time taken to upload records to S3 in synchronous replication mode, by result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// TxnS3BreakerState is the state of the S3 circuit breaker in
+	// synchronous replication mode: 0 when closed (uploading to S3), 1 when
+	// open (failing writes fast) and 2 when half-open (retrying S3)
+	TxnS3BreakerState = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "txn",
+		Name:      "s3_breaker_state",
+		Help:      "State of the S3 circuit breaker in synchronous replication mode (0 = closed, 1 = open, 2 = half-open).",
+	})
+
+	// TxnS3BreakerTrips counts how many times the S3 circuit breaker opened,
+	// after consecutive S3 upload failures or a failed retry
+	TxnS3BreakerTrips = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "txn",
+		Name:      "s3_breaker_trips_total",
+		Help:      "Total number of times writes started failing fast because S3 uploads were failing.",
+	})
+
+	// TxnWriteFenced is 1 while writes are fenced because another writer was
+	// detected, until an operator clears the fence
+	TxnWriteFenced = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "txn",
+		Name:      "write_fenced",
+		Help:      "Whether writes are fenced because another writer wrote the same revision to S3 (1 = fenced).",
+	})
+
+	// TxnKeyRejected counts transactions rejected because they write to a
+	// key which is not allowed, by key prefix (see keys.Label)
+	TxnKeyRejected = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "txn",
+		Name:      "key_rejected_total",
+		Help:      "Total number of transactions rejected because they write to a key which is not allowed, by key prefix.",
+	}, []string{"prefix"})
+)
@@ -0,0 +1,161 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// WatchCreateQueued is the number of watch create requests waiting to be
+	// processed, across all watchers
+	WatchCreateQueued = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "create_queued",
+		Help:      "Number of watch create requests waiting to be processed.",
+	})
+
+	// WatchCreateRejected counts watch create requests rejected, by reason
+	// (queue_full, memory_pressure, watch_limit, watcher_limit, denied or
+	// draining)
+	WatchCreateRejected = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "create_rejected_total",
+		Help:      "Total number of watch create requests rejected without being processed.",
+	}, []string{"reason"})
+
+	// WatchCreateWorkersBusy is the number of watch create workers currently
+	// processing a batch
+	WatchCreateWorkersBusy = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "create_workers_busy",
+		Help:      "Number of watch create workers currently processing a batch.",
+	})
+
+	// WatchCreateBatchSize observes the number of create requests per batch
+	WatchCreateBatchSize = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "create_batch_size",
+		Help:      "Number of watch create requests processed per batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	// WatchCreateBatchDuration observes how long each batch takes to process,
+	// including revision validation and acknowledging each watch
+	WatchCreateBatchDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "create_batch_duration_seconds",
+		Help:      "Time taken to process a batch of watch create requests.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// WatchEventsFenced counts watch events dropped because they were written
+	// in an earlier leader epoch
+	WatchEventsFenced = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "events_fenced_total",
+		Help:      "Total number of watch events dropped because they were from a stale leader epoch.",
+	})
+
+	// WatchDeliveryLag observes how long after an event was committed it
+	// was sent to a watcher
+	WatchDeliveryLag = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "delivery_lag_seconds",
+		Help:      "Time from an event being committed to it being sent to a watcher.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+
+	// WatchLagAlarms counts watchers whose events were consistently delivered
+	// later than the configured threshold, by action (warn, or cancel when
+	// the watcher's stream was ended)
+	WatchLagAlarms = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "lag_alarms_total",
+		Help:      "Total number of watchers whose events were consistently delivered late, by action taken.",
+	}, []string{"action"})
+
+	// WatchSendFailures counts watchers ended because sending to the client
+	// failed, by reason (error or panic)
+	WatchSendFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "send_failures_total",
+		Help:      "Total number of watchers ended because sending a response failed, by reason.",
+	}, []string{"reason"})
+
+	// WatchesActive is the number of active watches, by key prefix (see
+	// keys.Label), e.g. to find clients which leak watches
+	WatchesActive = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "watches_active",
+		Help:      "Number of active watches, by key prefix.",
+	}, []string{"prefix"})
+
+	// WatchersActive is the number of watchers, i.e. open watch streams,
+	// excluding those rejected by the watcher limit
+	WatchersActive = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "watchers_active",
+		Help:      "Number of active watchers (watch streams).",
+	})
+
+	// WatchersRejected counts watchers whose watch create requests were all
+	// rejected as the watcher limit was reached
+	WatchersRejected = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "watchers_rejected_total",
+		Help:      "Total number of watchers rejected as the watcher limit was reached.",
+	})
+
+	// WatchersBehind is the number of watchers whose queue overflowed, which
+	// are catching up from the local db
+	WatchersBehind = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "watchers_behind",
+		Help:      "Number of watchers catching up from the local db after their queue overflowed.",
+	})
+
+	// WatchCatchUps counts watchers which fell behind, by result (caught_up,
+	// compacted, error, or slow if their watches were cancelled by the
+	// overflow policy)
+	WatchCatchUps = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "catch_ups_total",
+		Help:      "Total number of watchers which fell behind and caught up from the local db, by result.",
+	}, []string{"result"})
+
+	// WatchReplays counts watches created with a past start revision whose
+	// events were replayed from the local db, by result (replayed,
+	// compacted, canceled or error)
+	WatchReplays = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "replays_total",
+		Help:      "Total number of watches created with a past start revision whose events were replayed from the local db, by result.",
+	}, []string{"result"})
+
+	// WatchersDrained counts watchers whose watches were cancelled on
+	// shutdown, by result (drained, or timeout if the cancellations were
+	// not sent before the drain timeout)
+	WatchersDrained = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "watch",
+		Name:      "watchers_drained_total",
+		Help:      "Total number of watchers whose watches were cancelled on shutdown, by result.",
+	}, []string{"result"})
+)
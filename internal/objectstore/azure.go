@@ -0,0 +1,60 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package objectstore
+
+import (
+	"context"
+	"net/http"
+)
+
+// AzureBlobAPIVersion is the Blob service REST API version of requests
+const AzureBlobAPIVersion = "2021-12-02"
+
+// AzureBlob writes objects to an Azure Blob Storage container as block blobs.
+// Versions are ETags, and Conditions are ETag preconditions (If-None-Match: *
+// and If-Match), as with S3.
+type AzureBlob struct {
+	// Endpoint is the storage account's blob endpoint, e.g.
+	// https://{account}.blob.core.windows.net
+	Endpoint  string
+	Container string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	// Authorize adds credentials to each request, e.g. a bearer token or a
+	// shared key signature. It may be nil, e.g. when Endpoint includes a
+	// shared access signature.
+	Authorize func(req *http.Request) error
+}
+
+var _ ConditionalPutter = (*AzureBlob)(nil)
+
+// ConditionalPut implements ConditionalPutter
+func (a *AzureBlob) ConditionalPut(ctx context.Context, key string, data []byte, cond Condition) (version string, err error) {
+	objURL, err := objectURL(a.Endpoint, a.Container, key)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("x-ms-blob-type", "BlockBlob")
+	header.Set("x-ms-version", AzureBlobAPIVersion)
+	switch {
+	case cond.IfNotExists:
+		header.Set("If-None-Match", "*")
+	case cond.IfVersion != "":
+		header.Set("If-Match", cond.IfVersion)
+	}
+	return httpPut{
+		client:        a.Client,
+		authorize:     a.Authorize,
+		url:           objURL,
+		header:        header,
+		versionHeader: "ETag",
+		preconditionFailed: func(resp *http.Response) bool {
+			// Azure reports If-None-Match: * failures as conflicts
+			return resp.StatusCode == http.StatusPreconditionFailed ||
+				(resp.StatusCode == http.StatusConflict && resp.Header.Get("x-ms-error-code") == "BlobAlreadyExists")
+		},
+	}.do(ctx, data)
+}
@@ -0,0 +1,244 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package objectstore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/objectstore"
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+// dialect describes how a fake object store reports conditional writes
+type dialect struct {
+	// condition returns the precondition of a request
+	condition func(r *http.Request) objectstore.Condition
+	// respond writes the response to a successful write of version n
+	respond func(w http.ResponseWriter, n int)
+	// version returns the version reported for n, as used in conditions
+	version func(n int) string
+	// fail writes the response to a failed precondition
+	fail func(w http.ResponseWriter, cond objectstore.Condition)
+}
+
+// fakeStore is an in-memory object store which accepts writes with the
+// preconditions of its dialect
+type fakeStore struct {
+	dialect dialect
+	mu      sync.Mutex
+	objects map[string][]byte
+	// versions of objects, incremented on each write
+	versions map[string]int
+	writes   int
+}
+
+func newFakeStore(t *testing.T, d dialect) (*fakeStore, *httptest.Server) {
+	store := &fakeStore{dialect: d, objects: map[string][]byte{}, versions: map[string]int{}}
+	server := httptest.NewServer(store)
+	t.Cleanup(server.Close)
+	return store, server
+}
+
+func (f *fakeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cond := f.dialect.condition(r)
+	n, exists := f.versions[r.URL.Path]
+	if (cond.IfNotExists && exists) || (cond.IfVersion != "" && (!exists || cond.IfVersion != f.dialect.version(n))) {
+		f.dialect.fail(w, cond)
+		return
+	}
+	f.writes++
+	f.objects[r.URL.Path] = data
+	f.versions[r.URL.Path] = f.writes
+	f.dialect.respond(w, f.writes)
+}
+
+// object returns the data of the object at path
+func (f *fakeStore) object(path string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return string(f.objects[path])
+}
+
+// etagCondition returns the precondition of a request with ETag headers
+func etagCondition(r *http.Request) objectstore.Condition {
+	return objectstore.Condition{
+		IfNotExists: r.Header.Get("If-None-Match") == "*",
+		IfVersion:   r.Header.Get("If-Match"),
+	}
+}
+
+var s3Dialect = dialect{
+	condition: etagCondition,
+	version:   func(n int) string { return fmt.Sprintf("\"etag-%d\"", n) },
+	respond: func(w http.ResponseWriter, n int) {
+		w.Header().Set("ETag", fmt.Sprintf("\"etag-%d\"", n))
+	},
+	fail: func(w http.ResponseWriter, cond objectstore.Condition) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusPreconditionFailed)
+		io.WriteString(w, "<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>")
+	},
+}
+
+var gcsDialect = dialect{
+	condition: func(r *http.Request) objectstore.Condition {
+		generation := r.Header.Get("x-goog-if-generation-match")
+		if generation == "0" {
+			return objectstore.Condition{IfNotExists: true}
+		}
+		return objectstore.Condition{IfVersion: generation}
+	},
+	version: strconv.Itoa,
+	respond: func(w http.ResponseWriter, n int) {
+		w.Header().Set("x-goog-generation", strconv.Itoa(n))
+	},
+	fail: func(w http.ResponseWriter, cond objectstore.Condition) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		io.WriteString(w, "<Error><Code>PreconditionFailed</Code></Error>")
+	},
+}
+
+var azureDialect = dialect{
+	condition: func(r *http.Request) objectstore.Condition {
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			return objectstore.Condition{IfVersion: "missing blob type"}
+		}
+		return etagCondition(r)
+	},
+	version: func(n int) string { return fmt.Sprintf("\"0x8D%X\"", n) },
+	respond: func(w http.ResponseWriter, n int) {
+		w.Header().Set("ETag", fmt.Sprintf("\"0x8D%X\"", n))
+		w.WriteHeader(http.StatusCreated)
+	},
+	fail: func(w http.ResponseWriter, cond objectstore.Condition) {
+		// Azure reports that a blob exists as a conflict
+		if cond.IfNotExists {
+			w.Header().Set("x-ms-error-code", "BlobAlreadyExists")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.Header().Set("x-ms-error-code", "ConditionNotMet")
+		w.WriteHeader(http.StatusPreconditionFailed)
+	},
+}
+
+// testConditionalPut checks put has the semantics of a ConditionalPutter,
+// where object returns the data of the object at key
+func testConditionalPut(t *testing.T, put objectstore.ConditionalPutter, object func(key string) string) {
+	ctx := context.Background()
+	key := "chunks/0001/0000000000000000001.netsy"
+
+	// only the first create-only write succeeds
+	v1, err := put.ConditionalPut(ctx, key, []byte("first"), objectstore.IfNotExists())
+	if err != nil || v1 == "" {
+		t.Fatalf("expected create to succeed with a version, got %q: %v", v1, err)
+	}
+	_, err = put.ConditionalPut(ctx, key, []byte("second"), objectstore.IfNotExists())
+	if !errors.Is(err, objectstore.ErrPreconditionFailed) {
+		t.Fatalf("expected second create to fail with ErrPreconditionFailed, got %v", err)
+	}
+	if data := object(key); data != "first" {
+		t.Fatalf("expected failed create not to overwrite, got %q", data)
+	}
+
+	// writes with the current version succeed, and return a new version
+	v2, err := put.ConditionalPut(ctx, key, []byte("replaced"), objectstore.IfVersion(v1))
+	if err != nil || v2 == "" || v2 == v1 {
+		t.Fatalf("expected replace to succeed with a new version, got %q: %v", v2, err)
+	}
+	_, err = put.ConditionalPut(ctx, key, []byte("stale"), objectstore.IfVersion(v1))
+	if !errors.Is(err, objectstore.ErrPreconditionFailed) {
+		t.Fatalf("expected replace with a stale version to fail with ErrPreconditionFailed, got %v", err)
+	}
+	if data := object(key); data != "replaced" {
+		t.Fatalf("expected failed replace not to overwrite, got %q", data)
+	}
+
+	// writes with a version require the object exists
+	_, err = put.ConditionalPut(ctx, "missing", []byte("missing"), objectstore.IfVersion(v2))
+	if !errors.Is(err, objectstore.ErrPreconditionFailed) {
+		t.Fatalf("expected replace of a missing object to fail with ErrPreconditionFailed, got %v", err)
+	}
+
+	// unconditional writes always succeed
+	if _, err = put.ConditionalPut(ctx, key, []byte("overwritten"), objectstore.Condition{}); err != nil {
+		t.Fatalf("expected unconditional write to succeed: %v", err)
+	}
+	if data := object(key); data != "overwritten" {
+		t.Fatalf("expected unconditional write to overwrite, got %q", data)
+	}
+}
+
+func TestS3ConditionalPut(t *testing.T) {
+	store, server := newFakeStore(t, s3Dialect)
+	configtest.Set(t, map[string]any{
+		"s3_enabled":           true,
+		"s3_bucket_name":       "netsy",
+		"s3_key_prefix":        "",
+		"s3_region":            "us-east-1",
+		"s3_endpoint":          server.URL,
+		"s3_force_path_style":  true,
+		"s3_access_key_id":     "test",
+		"s3_secret_access_key": "test",
+	})
+	client, err := s3client.New(&config.Config{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("s3client.New: %v", err)
+	}
+	testConditionalPut(t, client, func(key string) string {
+		return store.object("/netsy/" + key)
+	})
+}
+
+func TestGCSConditionalPut(t *testing.T) {
+	store, server := newFakeStore(t, gcsDialect)
+	authorized := func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer test")
+		return nil
+	}
+	testConditionalPut(t, &objectstore.GCS{Endpoint: server.URL, Bucket: "netsy", Authorize: authorized}, func(key string) string {
+		return store.object("/netsy/" + key)
+	})
+}
+
+func TestAzureBlobConditionalPut(t *testing.T) {
+	store, server := newFakeStore(t, azureDialect)
+	testConditionalPut(t, &objectstore.AzureBlob{Endpoint: server.URL, Container: "netsy"}, func(key string) string {
+		return store.object("/netsy/" + key)
+	})
+}
+
+func TestUnexpectedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "access denied", http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+	_, err := (&objectstore.GCS{Endpoint: server.URL, Bucket: "netsy"}).ConditionalPut(context.Background(), "key", nil, objectstore.IfNotExists())
+	if err == nil || errors.Is(err, objectstore.ErrPreconditionFailed) || !strings.Contains(err.Error(), "access denied") {
+		t.Fatalf("expected an error which is not a precondition failure, got %v", err)
+	}
+}
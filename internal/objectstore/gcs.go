@@ -0,0 +1,59 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package objectstore
+
+import (
+	"context"
+	"net/http"
+)
+
+// GCSDefaultEndpoint is the endpoint of the Google Cloud Storage XML API
+const GCSDefaultEndpoint = "https://storage.googleapis.com"
+
+// GCS writes objects to a Google Cloud Storage bucket with the XML API.
+// Versions are object generations, and Conditions are generation
+// preconditions (x-goog-if-generation-match), where generation 0 requires
+// that there is no object.
+type GCS struct {
+	// Endpoint defaults to GCSDefaultEndpoint
+	Endpoint string
+	Bucket   string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	// Authorize adds credentials to each request, e.g. an OAuth 2.0 bearer
+	// token. It may be nil, e.g. when Client adds credentials.
+	Authorize func(req *http.Request) error
+}
+
+var _ ConditionalPutter = (*GCS)(nil)
+
+// ConditionalPut implements ConditionalPutter
+func (g *GCS) ConditionalPut(ctx context.Context, key string, data []byte, cond Condition) (version string, err error) {
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = GCSDefaultEndpoint
+	}
+	objURL, err := objectURL(endpoint, g.Bucket, key)
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	switch {
+	case cond.IfNotExists:
+		header.Set("x-goog-if-generation-match", "0")
+	case cond.IfVersion != "":
+		header.Set("x-goog-if-generation-match", cond.IfVersion)
+	}
+	return httpPut{
+		client:        g.Client,
+		authorize:     g.Authorize,
+		url:           objURL,
+		header:        header,
+		versionHeader: "x-goog-generation",
+		preconditionFailed: func(resp *http.Response) bool {
+			return resp.StatusCode == http.StatusPreconditionFailed
+		},
+	}.do(ctx, data)
+}
@@ -0,0 +1,64 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// httpPut describes a conditional write to an object store's HTTP API
+type httpPut struct {
+	client    *http.Client
+	authorize func(req *http.Request) error
+	url       string
+	header    http.Header
+	// versionHeader is the response header with the written object's version
+	versionHeader string
+	// preconditionFailed returns true if resp is a precondition failure
+	preconditionFailed func(resp *http.Response) bool
+}
+
+// do sends the write, returning the version of the written object
+func (p httpPut) do(ctx context.Context, data []byte) (version string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	for name, values := range p.header {
+		req.Header[name] = values
+	}
+	if p.authorize != nil {
+		if err = p.authorize(req); err != nil {
+			return "", fmt.Errorf("failed to authorize request: %w", err)
+		}
+	}
+	client := p.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case p.preconditionFailed(resp):
+		return "", fmt.Errorf("%w: %s", ErrPreconditionFailed, resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return "", fmt.Errorf("unexpected response %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp.Header.Get(p.versionHeader), nil
+}
+
+// objectURL returns the URL of key in bucket, escaping each segment
+func objectURL(endpoint string, bucket string, key string) (string, error) {
+	return url.JoinPath(endpoint, append([]string{bucket}, strings.Split(key, "/")...)...)
+}
@@ -0,0 +1,51 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package objectstore defines the conditional writes netsy relies on to
+// detect more than one writer (split brain), independently of the object
+// store. Each object store implements them with its own preconditions: S3
+// and Azure Blob Storage compare ETags, and Google Cloud Storage compares
+// object generations, but a ConditionalPutter has the same semantics for
+// each (see the contract tests). Only S3 can currently be configured; the
+// GCS and AzureBlob implementations are not yet selectable.
+package objectstore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrPreconditionFailed is returned by ConditionalPut when its Condition
+// does not hold, in which case the object was not written
+var ErrPreconditionFailed = errors.New("object store precondition failed")
+
+// Condition is the precondition of a ConditionalPut. The zero value writes
+// the object unconditionally.
+type Condition struct {
+	// IfNotExists requires that there is no object at the key, e.g. so that
+	// two writers cannot both write the same chunk
+	IfNotExists bool
+	// IfVersion requires that the object at the key has this version, i.e.
+	// it has not been replaced since the version was read
+	IfVersion string
+}
+
+// IfNotExists returns a Condition which requires there is no object
+func IfNotExists() Condition {
+	return Condition{IfNotExists: true}
+}
+
+// IfVersion returns a Condition which requires the object has version
+func IfVersion(version string) Condition {
+	return Condition{IfVersion: version}
+}
+
+// ConditionalPutter is implemented by object stores which support
+// conditional writes
+type ConditionalPutter interface {
+	// ConditionalPut writes data to the object at key if cond holds, and
+	// returns the version of the written object, which can be used with
+	// IfVersion. If cond does not hold, it returns an error wrapping
+	// ErrPreconditionFailed.
+	ConditionalPut(ctx context.Context, key string, data []byte, cond Condition) (version string, err error)
+}
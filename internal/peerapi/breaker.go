@@ -0,0 +1,134 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+)
+
+// ErrS3Unavailable is returned for writes which fail fast, without waiting
+// for S3, because recent S3 uploads have failed
+var ErrS3Unavailable = errors.New("S3 is unavailable")
+
+// breakerState is the state of an s3Breaker, as reported by
+// metrics.TxnS3BreakerState
+type breakerState int
+
+const (
+	// breakerClosed uploads every write to S3
+	breakerClosed breakerState = iota
+	// breakerOpen fails writes fast until the retry time
+	breakerOpen
+	// breakerHalfOpen has let a single write through to retry S3
+	breakerHalfOpen
+)
+
+// s3Breaker is a circuit breaker for S3 uploads in synchronous replication
+// mode. When S3 is down, every write would otherwise wait for the upload to
+// time out while holding the transaction lock, stalling all writers. After
+// failureThreshold consecutive upload failures the breaker opens and writes
+// fail fast with ErrS3Unavailable. Once retryInterval has passed, a single
+// write is let through to retry S3 (half-open): if its upload succeeds, the
+// breaker closes, otherwise it opens again.
+//
+// Writes are not committed locally while the breaker is open, as nothing
+// would upload them to S3 later.
+type s3Breaker struct {
+	logger           log.Logger
+	failureThreshold int64
+	retryInterval    time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int64
+	retryAt  time.Time
+}
+
+// newS3Breaker returns a closed breaker. A failureThreshold below 1
+// disables it, so that it never opens.
+func newS3Breaker(logger log.Logger, failureThreshold int64, retryInterval time.Duration) *s3Breaker {
+	metrics.TxnS3BreakerState.Set(float64(breakerClosed))
+	return &s3Breaker{
+		logger:           logger,
+		failureThreshold: failureThreshold,
+		retryInterval:    retryInterval,
+		now:              time.Now,
+	}
+}
+
+// allow returns an error wrapping ErrS3Unavailable if a write must fail fast
+// rather than be uploaded to S3. Once the breaker is due to retry S3, allow
+// lets one write through, whose result must then be reported with success,
+// failure or abort.
+func (b *s3Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now := b.now(); now.Before(b.retryAt) {
+			return fmt.Errorf("%w: failing writes fast after %d consecutive S3 upload failures, retrying S3 in %s",
+				ErrS3Unavailable, b.failures, b.retryAt.Sub(now).Round(time.Second))
+		}
+		b.setState(breakerHalfOpen)
+		level.Info(b.logger).Log("msg", "retrying S3 after upload failures", "failures", b.failures)
+	case breakerHalfOpen:
+		return fmt.Errorf("%w: failing writes fast while retrying S3", ErrS3Unavailable)
+	}
+	return nil
+}
+
+// success records a successful upload (or any response from S3), closing
+// the breaker
+func (b *s3Breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerClosed {
+		level.Info(b.logger).Log("msg", "S3 uploads recovered, accepting writes", "failures", b.failures)
+	}
+	b.failures = 0
+	b.setState(breakerClosed)
+}
+
+// failure records a failed upload, opening the breaker once the failure
+// threshold is reached, or immediately if S3 was being retried
+func (b *s3Breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failureThreshold < 1 || (b.state == breakerClosed && b.failures < b.failureThreshold) {
+		return
+	}
+	if b.state == breakerClosed {
+		level.Error(b.logger).Log("msg", "S3 uploads are failing, failing writes fast until S3 recovers", "failures", b.failures, "retry_interval", b.retryInterval)
+	}
+	metrics.TxnS3BreakerTrips.Inc()
+	b.retryAt = b.now().Add(b.retryInterval)
+	b.setState(breakerOpen)
+}
+
+// abort records that an upload ended without a result from S3, e.g. because
+// the client cancelled the request. If S3 was being retried, the next write
+// retries it instead.
+func (b *s3Breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.retryAt = b.now()
+		b.setState(breakerOpen)
+	}
+}
+
+// setState updates the state and its metric. b.mu must be held.
+func (b *s3Breaker) setState(state breakerState) {
+	b.state = state
+	metrics.TxnS3BreakerState.Set(float64(state))
+}
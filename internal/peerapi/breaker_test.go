@@ -0,0 +1,77 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestS3Breaker(t *testing.T) {
+	b := newS3Breaker(log.NewNopLogger(), 3, 10*time.Second)
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+
+	// failures below the threshold, and a success, keep the breaker closed
+	b.failure()
+	b.failure()
+	b.success()
+	b.failure()
+	b.failure()
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected breaker to be closed, got %v", err)
+	}
+
+	// the third consecutive failure opens it
+	b.failure()
+	if err := b.allow(); !errors.Is(err, ErrS3Unavailable) {
+		t.Fatalf("expected ErrS3Unavailable once open, got %v", err)
+	}
+
+	// once the retry interval has passed, a single write retries S3
+	now = now.Add(10 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected a retry once the retry interval passed, got %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrS3Unavailable) {
+		t.Fatalf("expected ErrS3Unavailable while retrying, got %v", err)
+	}
+	// a failed retry opens it again for another retry interval
+	b.failure()
+	now = now.Add(5 * time.Second)
+	if err := b.allow(); !errors.Is(err, ErrS3Unavailable) {
+		t.Fatalf("expected ErrS3Unavailable after a failed retry, got %v", err)
+	}
+
+	// a retry which is aborted lets the next write retry instead
+	now = now.Add(5 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected a retry, got %v", err)
+	}
+	b.abort()
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected a retry after an aborted retry, got %v", err)
+	}
+
+	// a successful retry closes it
+	b.success()
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected breaker to be closed, got %v", err)
+	}
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected breaker to stay closed, got %v", err)
+	}
+
+	// a threshold of 0 never opens
+	disabled := newS3Breaker(log.NewNopLogger(), 0, time.Second)
+	for range 10 {
+		disabled.failure()
+	}
+	if err := disabled.allow(); err != nil {
+		t.Fatalf("expected disabled breaker to stay closed, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+)
+
+// ErrWriteFenced is returned for writes while writes are fenced
+var ErrWriteFenced = errors.New("writes are fenced because another writer was detected")
+
+// WriteFence records why writes were fenced
+type WriteFence struct {
+	// Revision is the revision another writer wrote
+	Revision int64
+	// Cause is the error which triggered the fence
+	Cause error
+	// FencedAt is when writes were fenced
+	FencedAt time.Time
+}
+
+func (f *WriteFence) String() string {
+	return fmt.Sprintf("writes fenced since %s: another writer wrote revision %d: %v",
+		f.FencedAt.Format(time.RFC3339), f.Revision, f.Cause)
+}
+
+// fenceWrites stops this instance accepting writes, as another instance has
+// written revision to S3, i.e. there is more than one writer. Writes are not
+// resumed automatically, as continuing would diverge further from the other
+// writer; an operator must stop the other writer, and then restart this
+// instance (so it backfills the other writer's records) or clear the fence.
+func (ps *PeerAPIServer) fenceWrites(revision int64, cause error) {
+	fence := &WriteFence{Revision: revision, Cause: cause, FencedAt: ps.now()}
+	if !ps.writeFence.CompareAndSwap(nil, fence) {
+		return
+	}
+	metrics.TxnWriteFenced.Set(1)
+	level.Error(ps.logger).Log("msg", "ALARM: another writer wrote the same revision to S3, writes are fenced until an operator intervenes", "revision", revision, "error", cause)
+}
+
+// IsLeader returns true if this instance is the leader, i.e. it accepts
+// writes, which it does unless writes are fenced
+func (ps *PeerAPIServer) IsLeader() bool {
+	return ps.writeFence.Load() == nil
+}
+
+// WriteFence returns the current write fence, or nil if writes are not
+// fenced
+func (ps *PeerAPIServer) WriteFence() *WriteFence {
+	return ps.writeFence.Load()
+}
+
+// ClearWriteFence resumes accepting writes after they were fenced, returning
+// the fence which was cleared (if any). The revision counter is
+// reinitialized from the local database. The operator must ensure the other
+// writer has stopped and that the local database contains its records
+// (e.g. by restarting instead), otherwise writes will conflict again.
+func (ps *PeerAPIServer) ClearWriteFence() (*WriteFence, error) {
+	ps.leaderTxnMutex.Lock()
+	defer ps.leaderTxnMutex.Unlock()
+	fence := ps.writeFence.Load()
+	if fence == nil {
+		return nil, nil
+	}
+	if err := ps.InitializeRevisionCounter(); err != nil {
+		return nil, fmt.Errorf("failed to reinitialize revision counter: %w", err)
+	}
+	ps.writeFence.Store(nil)
+	metrics.TxnWriteFenced.Set(0)
+	level.Warn(ps.logger).Log("msg", "write fence cleared by operator, accepting writes", "fenced_revision", fence.Revision)
+	return fence, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/s3client"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+func TestWriteFence(t *testing.T) {
+	configtest.Set(t, map[string]any{"s3_enabled": false, "instance_id": "test"})
+	db := localdbtest.New(t)
+	ps := &PeerAPIServer{logger: log.NewNopLogger(), config: &config.Config{}, db: db, now: time.Now}
+	if err := ps.InitializeRevisionCounter(); err != nil {
+		t.Fatalf("InitializeRevisionCounter: %v", err)
+	}
+	create := &pb.TxnRequest{
+		Compare: []*pb.Compare{{
+			Key:         []byte("a"),
+			Target:      pb.Compare_MOD,
+			Result:      pb.Compare_EQUAL,
+			TargetUnion: &pb.Compare_ModRevision{ModRevision: 0},
+		}},
+		Success: []*pb.RequestOp{{
+			Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("a"), Value: []byte("v")}},
+		}},
+	}
+	ctx := context.Background()
+
+	ps.fenceWrites(1, s3client.ErrChunkConflict)
+	// the first fence is kept
+	ps.fenceWrites(2, errors.New("later conflict"))
+	if fence := ps.WriteFence(); fence == nil || fence.Revision != 1 {
+		t.Fatalf("expected fence at revision 1, got %v", fence)
+	}
+	if _, _, err := ps.LeaderTxn(ctx, create); !errors.Is(err, ErrWriteFenced) {
+		t.Fatalf("expected ErrWriteFenced from LeaderTxn, got %v", err)
+	}
+	if _, err := ps.LeaderCompact(ctx, 1, false); !errors.Is(err, ErrWriteFenced) {
+		t.Fatalf("expected ErrWriteFenced from LeaderCompact, got %v", err)
+	}
+	if _, err := ps.SetNextRevision(ctx, 10, false); !errors.Is(err, ErrWriteFenced) {
+		t.Fatalf("expected ErrWriteFenced from SetNextRevision, got %v", err)
+	}
+
+	fence, err := ps.ClearWriteFence()
+	if err != nil || fence == nil || fence.Revision != 1 {
+		t.Fatalf("expected cleared fence at revision 1, got %v (%v)", fence, err)
+	}
+	if _, _, err := ps.LeaderTxn(ctx, create); err != nil {
+		t.Fatalf("LeaderTxn after clearing fence: %v", err)
+	}
+	if fence, err = ps.ClearWriteFence(); err != nil || fence != nil {
+		t.Fatalf("expected no fence to clear, got %v (%v)", fence, err)
+	}
+}
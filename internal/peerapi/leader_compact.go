@@ -0,0 +1,123 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+// ErrCompacted is returned when compacting to a revision which has already
+// been compacted
+var ErrCompacted = errors.New("revision has already been compacted")
+
+// ErrFutureRevision is returned when compacting to a revision which does not
+// exist yet
+var ErrFutureRevision = errors.New("revision is a future revision")
+
+// LeaderCompact compacts the local database to the given revision. When S3
+// is enabled, the compaction is first recorded to S3, so that it is applied
+// by backfill when restoring from S3, before being applied locally.
+// If tombstone pruning is enabled, pruning reclaims the space used by deleted
+// keys. When physical is true, LeaderCompact waits for pruning to complete,
+// otherwise it returns once the compaction has been applied and prunes in
+// the background, as etcd does for physical compaction.
+func (ps *PeerAPIServer) LeaderCompact(ctx context.Context, revision int64, physical bool) (compacted int64, err error) {
+	ps.leaderCompactMutex.Lock()
+	defer ps.leaderCompactMutex.Unlock()
+
+	if fence := ps.writeFence.Load(); fence != nil {
+		return 0, fmt.Errorf("%w: %s", ErrWriteFenced, fence)
+	}
+
+	compactRevision, err := ps.db.CompactRevision()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get compact revision: %w", err)
+	}
+	if revision <= compactRevision {
+		return 0, fmt.Errorf("%w: revision %d (compacted to revision %d)", ErrCompacted, revision, compactRevision)
+	}
+	latestRevision, err := ps.db.LatestRevision()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest revision: %w", err)
+	}
+	if revision > latestRevision {
+		return 0, fmt.Errorf("%w: revision %d (latest revision %d)", ErrFutureRevision, revision, latestRevision)
+	}
+
+	compactedAt := ps.now()
+	if ps.config.S3Enabled() {
+		err = ps.s3Client.WriteCompaction(ctx, s3client.Compaction{
+			Revision:    revision,
+			CompactedAt: compactedAt,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to record compaction to S3: %w", err)
+		}
+	}
+
+	compacted, err = ps.db.Compact(revision, compactedAt)
+	if err != nil {
+		return 0, err
+	}
+	level.Info(ps.logger).Log("msg", "compacted database", "revision", revision, "compacted_records", compacted, "physical", physical)
+
+	if ps.config.CompactionPruneTombstones() {
+		if physical {
+			ps.pruneTombstones(ctx, revision)
+		} else {
+			// the request context ends when the response is sent, so prune
+			// with its values but without its cancellation
+			pruneCtx := context.WithoutCancel(ctx)
+			ps.background.Add(1)
+			go func() {
+				defer ps.background.Done()
+				ps.pruneTombstones(pruneCtx, revision)
+			}()
+		}
+	}
+	return compacted, nil
+}
+
+// pruneTombstones prunes the history of keys deleted at or before the
+// compaction revision. When S3 is enabled, only revisions covered by the
+// latest snapshot are pruned, so chunks are never needed to restore them.
+// Pruning is in batches (see PruneTombstones), so that other writes are not
+// blocked for long, and stops between batches if ctx is done. Pruning is an
+// optimization, so failures are logged rather than returned.
+func (ps *PeerAPIServer) pruneTombstones(ctx context.Context, revision int64) {
+	if ps.config.S3Enabled() {
+		snapshotInfo, err := ps.s3Client.GetLatestSnapshot(ctx)
+		if err != nil {
+			level.Warn(ps.logger).Log("msg", "failed to get latest snapshot, not pruning tombstones", "error", err)
+			return
+		}
+		if !snapshotInfo.Found {
+			return
+		}
+		revision = min(revision, snapshotInfo.Revision)
+	}
+	var pruned int64
+	for {
+		if err := ctx.Err(); err != nil {
+			level.Warn(ps.logger).Log("msg", "stopped pruning tombstones", "revision", revision, "pruned_records", pruned, "error", err)
+			return
+		}
+		batch, err := ps.db.PruneTombstones(revision, localdb.PruneTombstonesBatchSize)
+		if err != nil {
+			level.Warn(ps.logger).Log("msg", "failed to prune tombstones", "revision", revision, "pruned_records", pruned, "error", err)
+			return
+		}
+		if batch == 0 {
+			break
+		}
+		pruned += batch
+	}
+	level.Info(ps.logger).Log("msg", "pruned tombstones", "revision", revision, "pruned_records", pruned)
+}
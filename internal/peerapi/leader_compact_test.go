@@ -0,0 +1,54 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestLeaderCompact(t *testing.T) {
+	configtest.Set(t, map[string]any{"s3_enabled": false})
+	db := localdbtest.New(t)
+	for revision := int64(1); revision <= 3; revision++ {
+		record := &proto.Record{Revision: revision, Key: []byte("a"), Value: []byte("v"), PrevRevision: revision - 1, Created: revision == 1, LeaderId: "test"}
+		if _, err := db.InsertRecord(record, nil); err != nil {
+			t.Fatalf("InsertRecord %d: %v", revision, err)
+		}
+	}
+	ps := &PeerAPIServer{logger: log.NewNopLogger(), config: &config.Config{}, db: db, now: time.Now}
+	ctx := context.Background()
+
+	if _, err := ps.LeaderCompact(ctx, 4, false); !errors.Is(err, ErrFutureRevision) {
+		t.Fatalf("expected ErrFutureRevision, got %v", err)
+	}
+	compacted, err := ps.LeaderCompact(ctx, 2, true)
+	if err != nil {
+		t.Fatalf("LeaderCompact: %v", err)
+	}
+	if compacted != 1 {
+		t.Fatalf("expected 1 compacted record, got %d", compacted)
+	}
+	if compactRevision, err := db.CompactRevision(); err != nil || compactRevision != 2 {
+		t.Fatalf("expected compact revision 2, got %d (%v)", compactRevision, err)
+	}
+	for _, revision := range []int64{0, 1, 2} {
+		if _, err = ps.LeaderCompact(ctx, revision, false); !errors.Is(err, ErrCompacted) {
+			t.Fatalf("expected ErrCompacted for revision %d, got %v", revision, err)
+		}
+	}
+	if _, err = ps.LeaderCompact(ctx, 3, false); err != nil {
+		t.Fatalf("LeaderCompact: %v", err)
+	}
+	// wait for tombstone pruning before the db is closed
+	ps.Close()
+}
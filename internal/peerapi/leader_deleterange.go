@@ -0,0 +1,113 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/transform"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	googlepb "google.golang.org/protobuf/proto"
+)
+
+// LeaderDeleteRange is our backend for the etcd DeleteRange API, which
+// deletes a single key, or every key in the range from r.Key to r.RangeEnd
+// (e.g. all keys under a prefix).
+//
+// A delete record is inserted for each key, at consecutive revisions. This
+// differs from etcd, which deletes every key at a single revision, as each
+// record has its own revision (the primary key of the records table), so
+// watchers see one event per revision rather than every event at one
+// revision. The records are inserted in a single database transaction and,
+// in synchronous replication mode, uploaded to S3 before it is committed
+// (see WriteRecords), so either every key is deleted or none are. The
+// response header has the revision of the last record, and the response
+// includes the deleted key-values if r.PrevKv is set.
+func (ps *PeerAPIServer) LeaderDeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (inserted []*proto.Record, resp *pb.DeleteRangeResponse, err error) {
+	// Record metrics once the result is known
+	start := time.Now()
+	defer func() {
+		metrics.TxnTotal.WithLabelValues("delete_range", txnResult(err, false)).Inc()
+		metrics.TxnDuration.WithLabelValues("delete_range").Observe(time.Since(start).Seconds())
+	}()
+	// Serialize with leader transactions, so the keys found are those
+	// deleted
+	ps.leaderTxnMutex.Lock()
+	defer ps.leaderTxnMutex.Unlock()
+	if fence := ps.writeFence.Load(); fence != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrWriteFenced, fence)
+	}
+
+	// Find the keys to delete, with their values for the response. Values
+	// are only decoded if they are returned.
+	values := ps.values
+	if !r.PrevKv {
+		values = transform.Chain{}
+	}
+	rangeResp, err := commonapi.Range(ps.db, ps.header, values, ctx, &pb.RangeRequest{
+		Key:      r.Key,
+		RangeEnd: r.RangeEnd,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding keys to delete: %w", err)
+	}
+	if len(rangeResp.Kvs) == 0 {
+		return nil, &pb.DeleteRangeResponse{Header: rangeResp.Header}, nil
+	}
+	revision := ps.nextRevisionID.Load()
+	records := make([]*proto.Record, len(rangeResp.Kvs))
+	for i, kv := range rangeResp.Kvs {
+		records[i] = &proto.Record{
+			Key:          kv.Key,
+			Deleted:      true,
+			PrevRevision: kv.ModRevision,
+			LeaderId:     ps.config.InstanceID(),
+			Revision:     revision + int64(i),
+		}
+	}
+
+	// Insert all records in one transaction
+	tx, err := ps.db.BeginTx()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	var recordsSize int64
+	for _, record := range records {
+		row, err := ps.db.InsertRecord(record, tx)
+		if err != nil {
+			tx.Rollback()
+			return nil, nil, fmt.Errorf("error for %s: %w", keys.Quote(record.Key), err)
+		}
+		inserted = append(inserted, row)
+		recordsSize += int64(googlepb.Size(row))
+	}
+	if ps.s3Client != nil && ps.config.ReplicationMode() == "synchronous" {
+		if err = ps.uploadRecords(ctx, inserted); err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	// Increment revision counter only after successful commit
+	ps.nextRevisionID.Add(int64(len(inserted)))
+	last := inserted[len(inserted)-1]
+	ps.checkAndCreateSnapshot(last.Revision, recordsSize)
+
+	resp = &pb.DeleteRangeResponse{
+		Header:  ps.header.At(last.Revision),
+		Deleted: int64(len(inserted)),
+	}
+	if r.PrevKv {
+		resp.PrevKvs = rangeResp.Kvs
+	}
+	return inserted, resp, nil
+}
@@ -3,10 +3,6 @@
 
 package peerapi
 
-import (
-	"time"
-)
-
 // checkAndCreateSnapshot checks if a snapshot should be created based on configured thresholds
 // and creates one asynchronously if needed. This should ideally only be called by the leader, since
 // we ideally want to create snapshots from the latest data.
@@ -16,7 +12,14 @@ func (ps *PeerAPIServer) checkAndCreateSnapshot(currentRevision int64, recordSiz
 		return
 	}
 
-	currentTime := time.Now()
+	// force a snapshot once revisions skipped by SetNextRevision are
+	// followed by a record, as backfill requires chunks to be contiguous
+	if at := ps.snapshotAtRevision.Load(); at > 0 && currentRevision >= at && ps.snapshotAtRevision.CompareAndSwap(at, 0) {
+		ps.snapshotWorker.ForceSnapshot(currentRevision)
+		return
+	}
+
+	currentTime := ps.now()
 
 	// Send snapshot request to worker (non-blocking)
 	ps.snapshotWorker.RequestSnapshot(currentRevision, currentTime, recordSize)
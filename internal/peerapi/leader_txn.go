@@ -8,16 +8,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-kit/log/level"
 	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/keys"
 	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/metrics"
 	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	googlepb "google.golang.org/protobuf/proto"
 )
 
-var ErrUnsupported = errors.New("Unsupported request - netsy only implementes the Kubernetes etcd API subet")
+// ErrUnsupported is wrapped by the errors of transactions which use an etcd
+// feature netsy does not implement (see commonapi.Unsupported)
+var ErrUnsupported = commonapi.ErrUnsupported
+
+// ErrEmptyTxnResponse is returned by BuildTxnResponse when there is neither
+// an inserted record nor a range response to build the response from
+var ErrEmptyTxnResponse = errors.New("no record or range response to build transaction response from")
+
+// ErrS3UploadFailed is returned for writes which failed to upload to S3.
+// Repeated failures are logged by the leader, so callers need not log them.
+var ErrS3UploadFailed = errors.New("S3 upload failed")
 
 // LeaderTxn is our backend for the etcd transaction API, responsible for committing changes.
 //
@@ -53,19 +67,56 @@ var ErrUnsupported = errors.New("Unsupported request - netsy only implementes th
 //
 // Essentially the compare and failure condition for update and delete are the same, just success differs.
 // Note that create and update can have a lease ID specified, which gets recorded in the success operation.
+//
+// When an error is returned, parsed is a response whose header contains the
+// latest revision (read while holding the transaction lock), unless the
+// latest revision could not be read.
 func (ps *PeerAPIServer) LeaderTxn(ctx context.Context, r *pb.TxnRequest) (record *proto.Record, parsed *pb.TxnResponse, err error) {
 	var rangeResp *pb.RangeResponse
 	var inserted *proto.Record
+	// Record metrics once the result is known
+	start := time.Now()
+	operation := "unknown"
+	defer func() {
+		metrics.TxnTotal.WithLabelValues(operation, txnResult(err, rangeResp != nil)).Inc()
+		metrics.TxnDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}()
 	// Serialize all leader transaction processing
 	ps.leaderTxnMutex.Lock()
 	defer ps.leaderTxnMutex.Unlock()
+	// On error, respond with the latest revision, read before the lock is
+	// released so that it is not from a later transaction
+	defer func() {
+		if err == nil {
+			return
+		}
+		latestRevision, revErr := ps.db.LatestRevision()
+		if revErr != nil {
+			level.Error(ps.logger).Log("msg", "failed to get latest revision for transaction error response", "error", revErr)
+			parsed = nil
+			return
+		}
+		parsed = &pb.TxnResponse{
+			Header: ps.header.At(latestRevision),
+		}
+	}()
+	// Reject writes while fenced
+	if fence := ps.writeFence.Load(); fence != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrWriteFenced, fence)
+	}
 	// Validate and parse request
 	record, err = ParseTxnRequest(r)
-	if errors.Is(err, ErrUnsupported) {
-		return nil, nil, fmt.Errorf("%w - request: %+v", err, r)
-	} else if err != nil {
+	if err != nil {
+		commonapi.CountUnsupported(err)
 		return nil, nil, fmt.Errorf("error parsing request: %w", err)
 	}
+	operation = txnOperation(record)
+	// Transform the value, so it is stored, uploaded and replicated encoded
+	if !record.Deleted {
+		if record.Value, err = ps.values.Encode(record.Key, record.Value); err != nil {
+			return nil, nil, err
+		}
+	}
 	// Use the instance ID from config as the leader ID
 	record.LeaderId = ps.config.InstanceID()
 	// Assign the next revision ID
@@ -86,7 +137,7 @@ func (ps *PeerAPIServer) LeaderTxn(ctx context.Context, r *pb.TxnRequest) (recor
 			// Range on compare failure
 			level.Debug(ps.logger).Log("msg", "record insert error - executing failure op (range)", "error", err)
 			err = nil
-			rangeResp, err = commonapi.Range(ps.db, ctx, &pb.RangeRequest{
+			rangeResp, err = commonapi.Range(ps.db, ps.header, ps.values, ctx, &pb.RangeRequest{
 				Key: []byte(record.Key),
 			})
 			if rangeResp == nil {
@@ -95,13 +146,12 @@ func (ps *PeerAPIServer) LeaderTxn(ctx context.Context, r *pb.TxnRequest) (recor
 			// Don't upload to S3 on compare failure, just handle the range response
 		} else if err != nil {
 			tx.Rollback()
-			return nil, nil, fmt.Errorf("error for %s: %w", record.Key, err)
+			return nil, nil, fmt.Errorf("error for %s: %w", keys.Quote(record.Key), err)
 		} else {
 			// Upload to S3 within transaction boundary only on successful insert
-			err = ps.s3Client.WriteRecord(ctx, inserted)
-			if err != nil {
+			if err = ps.uploadRecords(ctx, []*proto.Record{inserted}); err != nil {
 				tx.Rollback()
-				return nil, nil, fmt.Errorf("S3 upload failed: %w", err)
+				return nil, nil, err
 			}
 			// Commit transaction
 			err = tx.Commit()
@@ -124,7 +174,7 @@ func (ps *PeerAPIServer) LeaderTxn(ctx context.Context, r *pb.TxnRequest) (recor
 			// Range on compare failure
 			level.Debug(ps.logger).Log("msg", "record insert error - executing failure op (range)", "error", err)
 			err = nil
-			rangeResp, err = commonapi.Range(ps.db, ctx, &pb.RangeRequest{
+			rangeResp, err = commonapi.Range(ps.db, ps.header, ps.values, ctx, &pb.RangeRequest{
 				Key: []byte(record.Key),
 			})
 			if rangeResp == nil {
@@ -139,51 +189,136 @@ func (ps *PeerAPIServer) LeaderTxn(ctx context.Context, r *pb.TxnRequest) (recor
 			ps.checkAndCreateSnapshot(inserted.Revision, recordSize)
 		}
 		if err != nil {
-			return nil, nil, fmt.Errorf("error for %s: %w", record.Key, err)
+			return nil, nil, fmt.Errorf("error for %s: %w", keys.Quote(record.Key), err)
 		}
 	}
-	resp, err := BuildTxnResponse(inserted, rangeResp)
+	parsed, err = BuildTxnResponse(ps.header, inserted, rangeResp)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error building response: %w", err)
 	}
-	return inserted, resp, nil
+	return inserted, parsed, nil
 }
 
-// ParseTxnRequest validates a pb.TxnRequest and creates a proto.Record
+// uploadRecords uploads records inserted in synchronous replication mode to
+// S3 as a single chunk file, before the transaction inserting them is
+// committed. It fails fast rather than wait for S3 while uploads are
+// failing, and fences writes if another writer wrote the chunk.
+func (ps *PeerAPIServer) uploadRecords(ctx context.Context, records []*proto.Record) error {
+	if err := ps.s3Breaker.allow(); err != nil {
+		return err
+	}
+	last := records[len(records)-1]
+	uploadStart := time.Now()
+	err := ps.s3Client.WriteRecords(ctx, records)
+	switch {
+	case err == nil, errors.Is(err, s3client.ErrChunkConflict):
+		ps.s3Breaker.success()
+		ps.s3Failures.Success()
+	case ctx.Err() != nil:
+		ps.s3Breaker.abort()
+	default:
+		ps.s3Breaker.failure()
+		ps.s3Failures.Failure(err, "revision", last.Revision)
+	}
+	if err != nil {
+		metrics.TxnS3SyncDuration.WithLabelValues("error").Observe(time.Since(uploadStart).Seconds())
+		if errors.Is(err, s3client.ErrChunkConflict) {
+			ps.fenceWrites(last.Revision, err)
+			return fmt.Errorf("%w: %w", ErrWriteFenced, err)
+		}
+		return fmt.Errorf("%w: %w", ErrS3UploadFailed, err)
+	}
+	metrics.TxnS3SyncDuration.WithLabelValues("success").Observe(time.Since(uploadStart).Seconds())
+	return nil
+}
+
+// txnOperation returns the operation label for a parsed transaction record
+func txnOperation(record *proto.Record) string {
+	switch {
+	case record.Created:
+		return "create"
+	case record.Deleted:
+		return "delete"
+	default:
+		return "update"
+	}
+}
+
+// txnResult returns the result label for a leader transaction. A compare
+// failure which executed the failure range has no error, so compareFailed
+// reports it separately.
+func txnResult(err error, compareFailed bool) string {
+	switch {
+	case errors.Is(err, localdb.ErrCompareRevisionFailed):
+		return "revision_mismatch"
+	case errors.Is(err, localdb.ErrCreateKeyExists):
+		return "key_exists"
+	case errors.Is(err, localdb.ErrDeleteKeyNotFound):
+		return "key_not_found"
+	case errors.Is(err, ErrWriteFenced):
+		return "fenced"
+	case errors.Is(err, ErrS3Unavailable):
+		return "s3_unavailable"
+	case errors.Is(err, ErrUnsupported):
+		return "unsupported"
+	case err != nil:
+		return "error"
+	case compareFailed:
+		return "revision_mismatch"
+	default:
+		return "success"
+	}
+}
+
+// ParseTxnRequest validates a pb.TxnRequest and creates a proto.Record.
+// Requests which use an etcd feature outside the supported subset return a
+// commonapi.UnsupportedError identifying the feature, which is not counted
+// (see commonapi.CountUnsupported) as the request may not be served.
 func ParseTxnRequest(r *pb.TxnRequest) (*proto.Record, error) {
 	// Validate request
-	if len(r.Compare) != 1 ||
-		len(r.Success) != 1 ||
-		(len(r.Failure) != 0 && len(r.Failure) != 1) ||
-		r.Compare[0].Target != pb.Compare_MOD ||
-		r.Compare[0].Result != pb.Compare_EQUAL {
-		return nil, fmt.Errorf("invalid request - missing required fields")
+	switch {
+	case len(r.Compare) == 0:
+		return nil, &commonapi.UnsupportedError{Feature: "Txn without compare"}
+	case len(r.Compare) > 1:
+		return nil, &commonapi.UnsupportedError{Feature: "Txn with multiple compares"}
+	case len(r.Success) == 0:
+		return nil, &commonapi.UnsupportedError{Feature: "Txn without success operation"}
+	case len(r.Success) > 1:
+		return nil, &commonapi.UnsupportedError{Feature: "Txn with multiple success operations"}
+	case len(r.Failure) > 1:
+		return nil, &commonapi.UnsupportedError{Feature: "Txn with multiple failure operations"}
+	case r.Compare[0].Target != pb.Compare_MOD:
+		return nil, &commonapi.UnsupportedError{Feature: "Compare target " + r.Compare[0].Target.String()}
+	case r.Compare[0].Result != pb.Compare_EQUAL:
+		return nil, &commonapi.UnsupportedError{Feature: "Compare result " + r.Compare[0].Result.String()}
 	}
 	compareKey := r.Compare[0].GetKey()
 	compareModRevision := r.Compare[0].GetModRevision()
 	successPut := r.Success[0].GetRequestPut()
 	if successPut != nil && successPut.PrevKv {
-		return nil, fmt.Errorf("invalid request - prevKv not supported for success put operations")
+		return nil, &commonapi.UnsupportedError{Feature: "Put prev_kv in Txn success"}
 	}
 	successDelete := r.Success[0].GetRequestDeleteRange()
 	if successDelete != nil && successDelete.PrevKv {
-		return nil, fmt.Errorf("invalid request - prevKv not supported for success delete operations")
+		return nil, &commonapi.UnsupportedError{Feature: "DeleteRange prev_kv in Txn success"}
+	} else if successDelete != nil && len(successDelete.RangeEnd) > 0 {
+		return nil, &commonapi.UnsupportedError{Feature: "DeleteRange range_end in Txn success"}
 	}
 	if (successPut != nil && !bytes.Equal(compareKey, successPut.Key)) ||
 		(successDelete != nil && !bytes.Equal(compareKey, successDelete.Key)) {
-		return nil, fmt.Errorf("invalid request - key mismatch between compare and success operations")
+		return nil, &commonapi.UnsupportedError{Feature: "Txn success operation on a key other than the compared key"}
 	}
 	var failureRange *pb.RangeRequest = nil
 	if len(r.Failure) == 1 {
 		failureRange = r.Failure[0].GetRequestRange()
 		if failureRange == nil {
-			return nil, fmt.Errorf("invalid request - failure operation must contain a range request")
+			return nil, &commonapi.UnsupportedError{Feature: "Txn failure operation other than Range"}
 		}
 		if failureRange.RangeEnd != nil {
-			return nil, fmt.Errorf("invalid request - rangeEnd not supported for failure range operations")
+			return nil, &commonapi.UnsupportedError{Feature: "Range range_end in Txn failure"}
 		}
 		if !bytes.Equal(compareKey, failureRange.Key) {
-			return nil, fmt.Errorf("invalid request - key mismatch between compare and failure operations")
+			return nil, &commonapi.UnsupportedError{Feature: "Txn failure operation on a key other than the compared key"}
 		}
 	}
 	// check if create, update, or delete
@@ -216,17 +351,28 @@ func ParseTxnRequest(r *pb.TxnRequest) (*proto.Record, error) {
 			Deleted:      true, // true=deleted
 			PrevRevision: compareModRevision,
 		}
+	} else if successPut == nil && successDelete == nil {
+		return nil, &commonapi.UnsupportedError{Feature: "Txn success operation other than Put or DeleteRange"}
+	} else if compareModRevision == 0 {
+		return nil, &commonapi.UnsupportedError{Feature: "DeleteRange in Txn comparing mod_revision 0"}
+	} else if compareModRevision > 0 {
+		return nil, &commonapi.UnsupportedError{Feature: "Txn update or delete without failure Range"}
 	} else {
-		// unknown
-		return nil, ErrUnsupported
+		return nil, &commonapi.UnsupportedError{Feature: "Compare mod_revision below 0"}
 	}
 	return record, nil
 }
 
-// BuildTxnResponse converts a proto.Record or pb.RangeResponse to a pb.TxnResponse
-func BuildTxnResponse(record *proto.Record, rangeResp *pb.RangeResponse) (*pb.TxnResponse, error) {
+// BuildTxnResponse converts a proto.Record or pb.RangeResponse to a pb.TxnResponse,
+// with headers from the header template.
+// It returns ErrEmptyTxnResponse if both are nil, rather than a response
+// with a zero revision.
+func BuildTxnResponse(header commonapi.ResponseHeader, record *proto.Record, rangeResp *pb.RangeResponse) (*pb.TxnResponse, error) {
+	if record == nil && rangeResp == nil {
+		return nil, ErrEmptyTxnResponse
+	}
 	response := &pb.TxnResponse{
-		Header: &pb.ResponseHeader{},
+		Header: header.At(0),
 	}
 
 	if rangeResp != nil {
@@ -248,7 +394,7 @@ func BuildTxnResponse(record *proto.Record, rangeResp *pb.RangeResponse) (*pb.Tx
 			{
 				Response: &pb.ResponseOp_ResponseDeleteRange{
 					ResponseDeleteRange: &pb.DeleteRangeResponse{
-						Header:  &pb.ResponseHeader{Revision: record.Revision},
+						Header:  header.At(record.Revision),
 						Deleted: 1,
 					},
 				},
@@ -262,7 +408,7 @@ func BuildTxnResponse(record *proto.Record, rangeResp *pb.RangeResponse) (*pb.Tx
 			{
 				Response: &pb.ResponseOp_ResponsePut{
 					ResponsePut: &pb.PutResponse{
-						Header: &pb.ResponseHeader{Revision: record.Revision},
+						Header: header.At(record.Revision),
 					},
 				},
 			},
@@ -4,9 +4,19 @@
 package peerapi
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/commonapi"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
 	"github.com/nadrama-com/netsy/internal/proto"
 	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/mvccpb"
@@ -177,7 +187,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - missing required fields",
+			errorMsg:    "Txn without compare",
 		},
 		// Invalid: Multiple compare operations
 		{
@@ -211,7 +221,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - missing required fields",
+			errorMsg:    "Txn with multiple compares",
 		},
 		// Invalid: Missing success operation
 		{
@@ -228,7 +238,7 @@ func TestParseTxnRequest(t *testing.T) {
 				Success: []*pb.RequestOp{},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - missing required fields",
+			errorMsg:    "Txn without success operation",
 		},
 		// Invalid: Multiple success operations
 		{
@@ -262,7 +272,7 @@ func TestParseTxnRequest(t *testing.T) {
 				},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - missing required fields",
+			errorMsg:    "Txn with multiple success operations",
 		},
 		// Invalid: Multiple failure operations
 		{
@@ -302,7 +312,7 @@ func TestParseTxnRequest(t *testing.T) {
 				},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - missing required fields",
+			errorMsg:    "Txn with multiple failure operations",
 		},
 		// Invalid: Wrong compare target
 		{
@@ -326,7 +336,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - missing required fields",
+			errorMsg:    "Compare target VERSION",
 		},
 		// Invalid: Wrong compare result
 		{
@@ -350,7 +360,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - missing required fields",
+			errorMsg:    "Compare result GREATER",
 		},
 		// Invalid: Key mismatch between compare and success put
 		{
@@ -374,7 +384,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - key mismatch between compare and success operations",
+			errorMsg:    "Txn success operation on a key other than the compared key",
 		},
 		// Invalid: Key mismatch between compare and success delete
 		{
@@ -397,7 +407,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - key mismatch between compare and success operations",
+			errorMsg:    "Txn success operation on a key other than the compared key",
 		},
 		// Invalid: Key mismatch between compare and failure operations
 		{
@@ -428,7 +438,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - key mismatch between compare and failure operations",
+			errorMsg:    "Txn failure operation on a key other than the compared key",
 		},
 		// Invalid: PrevKv in success put
 		{
@@ -453,7 +463,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - prevKv not supported for success put operations",
+			errorMsg:    "Put prev_kv in Txn success",
 		},
 		// Invalid: PrevKv in success delete
 		{
@@ -477,7 +487,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - prevKv not supported for success delete operations",
+			errorMsg:    "DeleteRange prev_kv in Txn success",
 		},
 		// Invalid: RangeEnd in failure range
 		{
@@ -509,7 +519,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - rangeEnd not supported for failure range operations",
+			errorMsg:    "Range range_end in Txn failure",
 		},
 		// Valid delete operation (this was incorrectly marked as invalid in previous version)
 		{
@@ -567,7 +577,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    ErrUnsupported.Error(),
+			errorMsg:    "DeleteRange in Txn comparing mod_revision 0",
 		},
 		// Edge case: Create with empty value
 		{
@@ -689,7 +699,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    "invalid request - failure operation must contain a range request",
+			errorMsg:    "Txn failure operation other than Range",
 		},
 		// Invalid: Success operation with nil put request (regression test for potential nil pointer dereference)
 		{
@@ -712,7 +722,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    ErrUnsupported.Error(),
+			errorMsg:    "Txn success operation other than Put or DeleteRange",
 		},
 		// Invalid: Success operation with nil delete request (regression test for potential nil pointer dereference)
 		{
@@ -742,7 +752,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    ErrUnsupported.Error(),
+			errorMsg:    "Txn success operation other than Put or DeleteRange",
 		},
 		// Invalid: Success operation is neither put nor delete
 		{
@@ -765,7 +775,7 @@ func TestParseTxnRequest(t *testing.T) {
 				}},
 			},
 			expectError: true,
-			errorMsg:    ErrUnsupported.Error(),
+			errorMsg:    "Txn success operation other than Put or DeleteRange",
 		},
 		// Invalid: Update with zero mod revision (indeterminate)
 		{
@@ -1176,11 +1186,19 @@ func TestBuildTxnResponse(t *testing.T) {
 			},
 			expectError: false,
 		},
+		// Case: neither record nor range response
+		{
+			name:        "no_record_or_range_response",
+			record:      nil,
+			rangeResp:   nil,
+			expectError: true,
+			errorMsg:    ErrEmptyTxnResponse.Error(),
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := BuildTxnResponse(tt.record, tt.rangeResp)
+			result, err := BuildTxnResponse(commonapi.ResponseHeader{}, tt.record, tt.rangeResp)
 
 			if tt.expectError {
 				if err == nil {
@@ -1279,3 +1297,55 @@ func TestBuildTxnResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestTxnResult(t *testing.T) {
+	tests := []struct {
+		err           error
+		compareFailed bool
+		expected      string
+	}{
+		{nil, false, "success"},
+		{nil, true, "revision_mismatch"},
+		{fmt.Errorf("error for key: %w", localdb.ErrCompareRevisionFailed), false, "revision_mismatch"},
+		{fmt.Errorf("error for key: %w", localdb.ErrCreateKeyExists), false, "key_exists"},
+		{fmt.Errorf("error for key: %w", localdb.ErrDeleteKeyNotFound), false, "key_not_found"},
+		{fmt.Errorf("%w: chunk conflict", ErrWriteFenced), false, "fenced"},
+		{errors.New("S3 upload failed"), false, "error"},
+	}
+	for _, tt := range tests {
+		if result := txnResult(tt.err, tt.compareFailed); result != tt.expected {
+			t.Errorf("txnResult(%v, %t) = %s, want %s", tt.err, tt.compareFailed, result, tt.expected)
+		}
+	}
+}
+
+func TestLeaderTxnErrorHeader(t *testing.T) {
+	configtest.Set(t, map[string]any{"s3_enabled": false, "instance_id": "test"})
+	db := localdbtest.New(t)
+	ps := &PeerAPIServer{logger: log.NewNopLogger(), config: &config.Config{}, db: db, now: time.Now}
+	if err := ps.InitializeRevisionCounter(); err != nil {
+		t.Fatalf("InitializeRevisionCounter: %v", err)
+	}
+	create := &pb.TxnRequest{
+		Compare: []*pb.Compare{{
+			Key:         []byte("a"),
+			Target:      pb.Compare_MOD,
+			Result:      pb.Compare_EQUAL,
+			TargetUnion: &pb.Compare_ModRevision{ModRevision: 0},
+		}},
+		Success: []*pb.RequestOp{{
+			Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte("a"), Value: []byte("v")}},
+		}},
+	}
+	if _, _, err := ps.LeaderTxn(context.Background(), create); err != nil {
+		t.Fatalf("LeaderTxn: %v", err)
+	}
+	// creating the key again fails, with the latest revision in the header
+	_, resp, err := ps.LeaderTxn(context.Background(), create)
+	if err == nil {
+		t.Fatalf("expected error creating existing key")
+	}
+	if resp == nil || resp.Header == nil || resp.Header.Revision != 1 {
+		t.Fatalf("expected response header with revision 1, got %v", resp)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/localdb"
+)
+
+// ErrInvalidNextRevision is returned by SetNextRevision for a revision which
+// would reuse an existing revision
+var ErrInvalidNextRevision = errors.New("invalid next revision")
+
+// NextRevisionChange describes a change of the revision counter by
+// SetNextRevision
+type NextRevisionChange struct {
+	// Previous is the next revision before the change
+	Previous int64
+	// Next is the next revision after the change
+	Next int64
+	// LocalRevision is the latest revision in the local db, including
+	// revisions previously skipped
+	LocalRevision int64
+	// S3Revision is the latest revision in S3, or 0 if S3 is disabled
+	S3Revision int64
+	// GapFirst and GapLast are the revisions skipped, recorded as a gap, or
+	// 0 if none were skipped
+	GapFirst int64
+	GapLast  int64
+}
+
+// SetNextRevision sets the revision assigned to the next transaction, for
+// recovering from manual changes to the local db or S3. next must be after
+// the latest revision in both the local db and S3, and after any revisions
+// previously skipped, so that no revision is assigned twice, and the local
+// db must not be missing revisions written to S3. Revisions skipped are
+// recorded as a gap, so the counter survives a restart (see
+// InitializeRevisionCounter) and integrity checks account for them, and a
+// snapshot is forced once the next record is written, as chunks are
+// expected to be contiguous. Only the leader assigns revisions, so it
+// returns ErrWriteFenced while writes are fenced. If dryRun is true, next
+// is validated but the counter is not changed.
+func (ps *PeerAPIServer) SetNextRevision(ctx context.Context, next int64, dryRun bool) (change NextRevisionChange, err error) {
+	// hold the transaction lock, so no revision is assigned meanwhile
+	ps.leaderTxnMutex.Lock()
+	defer ps.leaderTxnMutex.Unlock()
+
+	if fence := ps.writeFence.Load(); fence != nil {
+		return change, fmt.Errorf("%w: %s", ErrWriteFenced, fence)
+	}
+	change.Previous = ps.nextRevisionID.Load()
+	change.Next = next
+	if change.LocalRevision, err = ps.latestLocalRevision(); err != nil {
+		return change, fmt.Errorf("failed to get latest revision: %w", err)
+	}
+	if next <= change.LocalRevision {
+		return change, fmt.Errorf("%w: revision %d is at or before the latest revision %d in the local db", ErrInvalidNextRevision, next, change.LocalRevision)
+	}
+	if ps.config.S3Enabled() && ps.s3Client != nil {
+		if change.S3Revision, err = ps.latestS3Revision(ctx, change.LocalRevision); err != nil {
+			return change, fmt.Errorf("failed to get latest revision in S3: %w", err)
+		}
+		if next <= change.S3Revision {
+			return change, fmt.Errorf("%w: revision %d is at or before the latest revision %d in S3", ErrInvalidNextRevision, next, change.S3Revision)
+		}
+		// skipped revisions must not have records, so revisions missing
+		// from the local db must be backfilled rather than skipped
+		if change.S3Revision > change.LocalRevision {
+			return change, fmt.Errorf("%w: the local db is missing revisions %d to %d written to S3, restart to backfill them first", ErrInvalidNextRevision, change.LocalRevision+1, change.S3Revision)
+		}
+	}
+	if next > change.LocalRevision+1 {
+		change.GapFirst, change.GapLast = change.LocalRevision+1, next-1
+	}
+	if dryRun {
+		return change, nil
+	}
+
+	if change.GapFirst > 0 {
+		if err = ps.db.RecordGap(change.GapFirst, change.GapLast, localdb.GapReasonSetNextRevision, nil); err != nil {
+			return change, err
+		}
+		ps.snapshotAtRevision.Store(next)
+	}
+	ps.nextRevisionID.Store(next)
+	level.Warn(ps.logger).Log("msg", "next revision set by operator", "previous", change.Previous, "next", next,
+		"local_revision", change.LocalRevision, "s3_revision", change.S3Revision, "gap_first", change.GapFirst, "gap_last", change.GapLast)
+	return change, nil
+}
+
+// latestS3Revision returns the latest revision in S3, from the latest
+// snapshot and any chunks after localRevision
+func (ps *PeerAPIServer) latestS3Revision(ctx context.Context, localRevision int64) (revision int64, err error) {
+	snapshotInfo, err := ps.s3Client.GetLatestSnapshot(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if snapshotInfo != nil && snapshotInfo.Found {
+		revision = snapshotInfo.Revision
+	}
+	chunks, err := ps.s3Client.ListChunks(ctx, localRevision)
+	if err != nil {
+		return 0, err
+	}
+	if len(chunks) > 0 {
+		revision = max(revision, chunks[len(chunks)-1].Revision)
+	}
+	return revision, nil
+}
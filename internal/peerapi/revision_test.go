@@ -0,0 +1,80 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package peerapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// TestSetNextRevision checks that the next revision cannot reuse a revision,
+// that a dry run does not change it, and that skipped revisions are recorded
+// as a gap so the revision is kept once the counter is reinitialized
+func TestSetNextRevision(t *testing.T) {
+	configtest.Set(t, map[string]any{"s3_enabled": false, "instance_id": "test"})
+	db := localdbtest.New(t)
+	ps := &PeerAPIServer{logger: log.NewNopLogger(), config: &config.Config{}, db: db, now: time.Now}
+	if err := ps.InitializeRevisionCounter(); err != nil {
+		t.Fatalf("InitializeRevisionCounter: %v", err)
+	}
+	ctx := context.Background()
+	create := func(key string) int64 {
+		t.Helper()
+		inserted, _, err := ps.LeaderTxn(ctx, &pb.TxnRequest{
+			Compare: []*pb.Compare{{Key: []byte(key), Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+			Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: []byte(key), Value: []byte("v")}}}},
+		})
+		if err != nil {
+			t.Fatalf("LeaderTxn: %v", err)
+		}
+		return inserted.Revision
+	}
+	create("a")
+	create("b")
+
+	if _, err := ps.SetNextRevision(ctx, 2, false); !errors.Is(err, ErrInvalidNextRevision) {
+		t.Fatalf("expected ErrInvalidNextRevision reusing revision 2, got %v", err)
+	}
+	change, err := ps.SetNextRevision(ctx, 10, true)
+	if err != nil {
+		t.Fatalf("SetNextRevision dry run: %v", err)
+	}
+	if change.Previous != 3 || change.LocalRevision != 2 || change.GapFirst != 3 || change.GapLast != 9 {
+		t.Fatalf("unexpected dry run change %+v", change)
+	}
+	if revision := create("c"); revision != 3 {
+		t.Fatalf("expected dry run not to change the next revision, got %d", revision)
+	}
+
+	if change, err = ps.SetNextRevision(ctx, 10, false); err != nil {
+		t.Fatalf("SetNextRevision: %v", err)
+	}
+	if change.GapFirst != 4 || change.GapLast != 9 {
+		t.Fatalf("expected revisions 4 to 9 to be skipped, got %+v", change)
+	}
+	// the skipped revisions are kept once reinitialized, e.g. on restart
+	if err = ps.InitializeRevisionCounter(); err != nil {
+		t.Fatalf("InitializeRevisionCounter: %v", err)
+	}
+	if err = db.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity before write: %v", err)
+	}
+	if revision := create("d"); revision != 10 {
+		t.Fatalf("expected next write at revision 10, got %d", revision)
+	}
+	if err = db.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity after write: %v", err)
+	}
+	if _, err = ps.SetNextRevision(ctx, 10, false); !errors.Is(err, ErrInvalidNextRevision) {
+		t.Fatalf("expected ErrInvalidNextRevision reusing revision 10, got %v", err)
+	}
+}
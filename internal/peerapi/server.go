@@ -6,13 +6,17 @@ package peerapi
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/go-kit/log"
 
+	"github.com/nadrama-com/netsy/internal/commonapi"
 	"github.com/nadrama-com/netsy/internal/config"
 	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/lockhold"
 	"github.com/nadrama-com/netsy/internal/s3client"
 	"github.com/nadrama-com/netsy/internal/snapshot"
+	"github.com/nadrama-com/netsy/internal/transform"
 )
 
 type PeerAPIServer struct {
@@ -21,38 +25,78 @@ type PeerAPIServer struct {
 	db             localdb.Database
 	s3Client       *s3client.S3Client
 	snapshotWorker *snapshot.Worker
+	now            func() time.Time
+	// header is the template for response headers
+	header commonapi.ResponseHeader
+	// values transforms the values of records as they are written and read
+	values transform.Chain
 
 	// leaderTxnMutex serializes all transaction processing on the leader node
 	// This mutex should ONLY be used by the leader, not by follower nodes
-	leaderTxnMutex sync.Mutex
+	leaderTxnMutex lockhold.Mutex
+
+	// leaderCompactMutex serializes compactions on the leader node, so that
+	// each compaction is validated against the previous one
+	leaderCompactMutex sync.Mutex
 
 	// nextRevisionID holds the next revision ID to assign
 	// Managed atomically to ensure thread-safe access
 	nextRevisionID atomic.Int64
+
+	// snapshotAtRevision is the revision from which a snapshot is forced,
+	// once written, after revisions were skipped by SetNextRevision, or 0
+	snapshotAtRevision atomic.Int64
+
+	// writeFence is set when another writer is detected, after which writes
+	// are rejected until an operator clears it (see fenceWrites)
+	writeFence atomic.Pointer[WriteFence]
+
+	// s3Breaker fails writes fast while S3 uploads are failing in
+	// synchronous replication mode
+	s3Breaker *s3Breaker
+	// s3Failures logs repeated S3 upload failures of writes
+	s3Failures *s3client.FailureLog
+
+	// background tracks work which continues after a request completes,
+	// such as tombstone pruning, which Close waits for
+	background sync.WaitGroup
 }
 
 func NewServer(logger log.Logger, conf *config.Config, db localdb.Database, snapshotWorker *snapshot.Worker, s3Client *s3client.S3Client) (*PeerAPIServer, error) {
+	values, err := transform.New(conf)
+	if err != nil {
+		return nil, err
+	}
 	ps := &PeerAPIServer{
 		logger:         logger,
 		config:         conf,
 		db:             db,
 		s3Client:       s3Client,
 		snapshotWorker: snapshotWorker,
-	}
-
-	// Initialize the next revision ID from database
-	err := ps.initializeRevisionCounter()
-	if err != nil {
-		return nil, err
+		now:            time.Now,
+		header:         commonapi.NewResponseHeader(conf),
+		values:         values,
+		leaderTxnMutex: lockhold.Mutex{Name: "leader_txn"},
+		s3Breaker: newS3Breaker(logger, conf.ReplicationS3FailureThreshold(),
+			time.Duration(conf.ReplicationS3RetrySeconds())*time.Second),
+		s3Failures: s3client.NewFailureLog(logger, "S3 upload"),
 	}
 
 	return ps, nil
 }
 
-// initializeRevisionCounter sets the next revision ID based on the highest
-// revision currently in the database. This should only be called on leader startup.
-func (ps *PeerAPIServer) initializeRevisionCounter() error {
-	latestRevision, err := ps.db.LatestRevision()
+// Close waits for background work started by requests to complete
+func (ps *PeerAPIServer) Close() {
+	ps.background.Wait()
+}
+
+// InitializeRevisionCounter sets the next revision ID based on the highest
+// revision currently in the database, or the end of the last recorded gap if
+// later, as revisions skipped by SetNextRevision are recorded as a gap. This
+// should only be called on leader startup, once the database has been
+// backfilled, and before any transactions are processed.
+func (ps *PeerAPIServer) InitializeRevisionCounter() error {
+	latestRevision, err := ps.latestLocalRevision()
 	if err != nil {
 		return err
 	}
@@ -60,4 +104,21 @@ func (ps *PeerAPIServer) initializeRevisionCounter() error {
 	return nil
 }
 
+// latestLocalRevision returns the highest revision in the database, or the
+// end of the last recorded gap if later
+func (ps *PeerAPIServer) latestLocalRevision() (latestRevision int64, err error) {
+	latestRevision, err = ps.db.LatestRevision()
+	if err != nil {
+		return 0, err
+	}
+	gaps, err := ps.db.Gaps()
+	if err != nil {
+		return 0, err
+	}
+	for _, gap := range gaps {
+		latestRevision = max(latestRevision, gap.LastRevision)
+	}
+	return latestRevision, nil
+}
+
 
@@ -0,0 +1,203 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package progress tracks the progress of long running operations such as
+// backfill and snapshot creation, and reports it via logs, metrics and the
+// Admin GetStatus and ListOperations APIs.
+package progress
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/metrics"
+)
+
+// logInterval is the minimum interval between progress log messages
+const logInterval = 10 * time.Second
+
+var (
+	activeMutex sync.Mutex
+	active      = make(map[*Tracker]struct{})
+	// finished holds the final progress of the most recent run of each
+	// operation, guarded by activeMutex
+	finished = make(map[string]Progress)
+)
+
+// Progress is a point-in-time view of an operation's progress
+type Progress struct {
+	Operation    string
+	RecordsDone  int64
+	RecordsTotal int64
+	BytesDone    int64
+	BytesTotal   int64
+	Elapsed      time.Duration
+	// ETA is the estimated time remaining, or zero if unknown
+	ETA time.Duration
+}
+
+// Ratio returns the fraction of the operation completed, between 0 and 1,
+// based on bytes if the total is known, otherwise records
+func (p Progress) Ratio() float64 {
+	if p.BytesTotal > 0 {
+		return min(float64(p.BytesDone)/float64(p.BytesTotal), 1)
+	}
+	if p.RecordsTotal > 0 {
+		return min(float64(p.RecordsDone)/float64(p.RecordsTotal), 1)
+	}
+	return 0
+}
+
+// String returns a human readable summary, e.g. for logs
+func (p Progress) String() string {
+	s := fmt.Sprintf("%s in progress: %.1f%% (%d/%d records, %d/%d bytes)",
+		p.Operation, p.Ratio()*100, p.RecordsDone, p.RecordsTotal, p.BytesDone, p.BytesTotal)
+	if p.ETA > 0 {
+		s += fmt.Sprintf(", eta %s", p.ETA.Round(time.Second))
+	}
+	return s
+}
+
+// Tracker tracks the progress of a single running operation
+type Tracker struct {
+	logger    log.Logger
+	operation string
+	startedAt time.Time
+
+	mutex        sync.Mutex
+	recordsDone  int64
+	recordsTotal int64
+	bytesDone    int64
+	bytesTotal   int64
+	lastLog      time.Time
+}
+
+// Start begins tracking an operation. Totals may be zero if not yet known
+// and added later with AddTotal. Finish must be called when the operation
+// completes, successfully or not.
+func Start(logger log.Logger, operation string, recordsTotal int64, bytesTotal int64) *Tracker {
+	now := time.Now()
+	t := &Tracker{
+		logger:       logger,
+		operation:    operation,
+		startedAt:    now,
+		recordsTotal: recordsTotal,
+		bytesTotal:   bytesTotal,
+		lastLog:      now,
+	}
+	activeMutex.Lock()
+	active[t] = struct{}{}
+	activeMutex.Unlock()
+	metrics.OperationProgress.WithLabelValues(operation).Set(0)
+	return t
+}
+
+// AddTotal increases the expected totals, e.g. as each file header is read
+func (t *Tracker) AddTotal(records int64, bytes int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.recordsTotal += records
+	t.bytesTotal += bytes
+}
+
+// Add records progress, logging it at most once per logInterval
+func (t *Tracker) Add(records int64, bytes int64) {
+	t.mutex.Lock()
+	t.recordsDone += records
+	t.bytesDone += bytes
+	now := time.Now()
+	shouldLog := now.Sub(t.lastLog) >= logInterval
+	if shouldLog {
+		t.lastLog = now
+	}
+	p := t.progressLocked(now)
+	t.mutex.Unlock()
+
+	metrics.OperationProgress.WithLabelValues(t.operation).Set(p.Ratio())
+	if shouldLog {
+		level.Info(t.logger).Log("msg", "operation progress",
+			"operation", p.Operation,
+			"percent", fmt.Sprintf("%.1f", p.Ratio()*100),
+			"records_done", p.RecordsDone, "records_total", p.RecordsTotal,
+			"bytes_done", p.BytesDone, "bytes_total", p.BytesTotal,
+			"elapsed", p.Elapsed.Round(time.Second), "eta", p.ETA.Round(time.Second))
+	}
+}
+
+// Finish stops tracking the operation
+func (t *Tracker) Finish() {
+	p := t.Progress()
+	p.ETA = 0
+	activeMutex.Lock()
+	delete(active, t)
+	finished[t.operation] = p
+	activeMutex.Unlock()
+	metrics.OperationProgress.DeleteLabelValues(t.operation)
+}
+
+// Progress returns the operation's current progress
+func (t *Tracker) Progress() Progress {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.progressLocked(time.Now())
+}
+
+func (t *Tracker) progressLocked(now time.Time) Progress {
+	p := Progress{
+		Operation:    t.operation,
+		RecordsDone:  t.recordsDone,
+		RecordsTotal: t.recordsTotal,
+		BytesDone:    t.bytesDone,
+		BytesTotal:   t.bytesTotal,
+		Elapsed:      now.Sub(t.startedAt),
+	}
+	p.ETA = estimate(p.Elapsed, p.Ratio())
+	return p
+}
+
+// estimate returns the remaining time for an operation which has completed
+// ratio of its work in elapsed, assuming a constant rate
+func estimate(elapsed time.Duration, ratio float64) time.Duration {
+	if ratio <= 0 || ratio >= 1 {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * (1 - ratio) / ratio)
+}
+
+// Active returns the progress of all running operations, ordered by start time
+func Active() []Progress {
+	activeMutex.Lock()
+	trackers := make([]*Tracker, 0, len(active))
+	for t := range active {
+		trackers = append(trackers, t)
+	}
+	activeMutex.Unlock()
+
+	sort.Slice(trackers, func(i, j int) bool {
+		return trackers[i].startedAt.Before(trackers[j].startedAt)
+	})
+	results := make([]Progress, len(trackers))
+	for i, t := range trackers {
+		results[i] = t.Progress()
+	}
+	return results
+}
+
+// Finished returns the final progress of the most recent run of each
+// operation which has finished, ordered by operation name
+func Finished() []Progress {
+	activeMutex.Lock()
+	defer activeMutex.Unlock()
+	results := make([]Progress, 0, len(finished))
+	for _, p := range finished {
+		results = append(results, p)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Operation < results[j].Operation
+	})
+	return results
+}
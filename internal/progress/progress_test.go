@@ -0,0 +1,54 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestRatio(t *testing.T) {
+	tests := []struct {
+		p    Progress
+		want float64
+	}{
+		{Progress{}, 0},
+		{Progress{RecordsDone: 1, RecordsTotal: 4}, 0.25},
+		{Progress{RecordsDone: 1, RecordsTotal: 4, BytesDone: 50, BytesTotal: 100}, 0.5},
+		{Progress{BytesDone: 150, BytesTotal: 100}, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Ratio(); got != tt.want {
+			t.Errorf("%+v: got %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	if got := estimate(10*time.Second, 0.25); got != 30*time.Second {
+		t.Errorf("got %v, want 30s", got)
+	}
+	if got := estimate(10*time.Second, 0); got != 0 {
+		t.Errorf("got %v, want 0 for unknown ratio", got)
+	}
+}
+
+func TestActive(t *testing.T) {
+	tracker := Start(log.NewNopLogger(), "test", 10, 0)
+	tracker.Add(5, 0)
+	active := Active()
+	if len(active) != 1 || active[0].Operation != "test" || active[0].RecordsDone != 5 {
+		t.Fatalf("unexpected active operations: %+v", active)
+	}
+	tracker.Finish()
+	if active = Active(); len(active) != 0 {
+		t.Fatalf("expected no active operations, got %+v", active)
+	}
+	finished := Finished()
+	if len(finished) != 1 || finished[0].Operation != "test" || finished[0].RecordsDone != 5 {
+		t.Fatalf("unexpected finished operations: %+v", finished)
+	}
+}
@@ -0,0 +1,1869 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: proto/admin.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DataFile struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Kind          FileKind               `protobuf:"varint,1,opt,name=kind,proto3,enum=netsy.FileKind" json:"kind,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Size          int64                  `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	Revision      int64                  `protobuf:"varint,4,opt,name=revision,proto3" json:"revision,omitempty"` // last revision in the file
+	LastModified  *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=last_modified,json=lastModified,proto3" json:"last_modified,omitempty"`
+	Metadata      *DataFileMetadata      `protobuf:"bytes,6,opt,name=metadata,proto3" json:"metadata,omitempty"` // unset unless requested, or if the file has none
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DataFile) Reset() {
+	*x = DataFile{}
+	mi := &file_proto_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DataFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataFile) ProtoMessage() {}
+
+func (x *DataFile) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataFile.ProtoReflect.Descriptor instead.
+func (*DataFile) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DataFile) GetKind() FileKind {
+	if x != nil {
+		return x.Kind
+	}
+	return FileKind_KIND_UNKNOWN
+}
+
+func (x *DataFile) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *DataFile) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *DataFile) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *DataFile) GetLastModified() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastModified
+	}
+	return nil
+}
+
+func (x *DataFile) GetMetadata() *DataFileMetadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+// DataFileMetadata is the metadata recorded in S3 when a file is uploaded
+type DataFileMetadata struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FirstRevision int64                  `protobuf:"varint,1,opt,name=first_revision,json=firstRevision,proto3" json:"first_revision,omitempty"`
+	LastRevision  int64                  `protobuf:"varint,2,opt,name=last_revision,json=lastRevision,proto3" json:"last_revision,omitempty"`
+	RecordsCount  int64                  `protobuf:"varint,3,opt,name=records_count,json=recordsCount,proto3" json:"records_count,omitempty"`
+	LeaderId      string                 `protobuf:"bytes,4,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`           // instance which uploaded the file
+	LeaderEpoch   int64                  `protobuf:"varint,5,opt,name=leader_epoch,json=leaderEpoch,proto3" json:"leader_epoch,omitempty"` // leader epoch of the instance when it uploaded the file
+	Sha256        string                 `protobuf:"bytes,6,opt,name=sha256,proto3" json:"sha256,omitempty"`                               // hex encoded SHA-256 hash of the file
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DataFileMetadata) Reset() {
+	*x = DataFileMetadata{}
+	mi := &file_proto_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DataFileMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataFileMetadata) ProtoMessage() {}
+
+func (x *DataFileMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataFileMetadata.ProtoReflect.Descriptor instead.
+func (*DataFileMetadata) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *DataFileMetadata) GetFirstRevision() int64 {
+	if x != nil {
+		return x.FirstRevision
+	}
+	return 0
+}
+
+func (x *DataFileMetadata) GetLastRevision() int64 {
+	if x != nil {
+		return x.LastRevision
+	}
+	return 0
+}
+
+func (x *DataFileMetadata) GetRecordsCount() int64 {
+	if x != nil {
+		return x.RecordsCount
+	}
+	return 0
+}
+
+func (x *DataFileMetadata) GetLeaderId() string {
+	if x != nil {
+		return x.LeaderId
+	}
+	return ""
+}
+
+func (x *DataFileMetadata) GetLeaderEpoch() int64 {
+	if x != nil {
+		return x.LeaderEpoch
+	}
+	return 0
+}
+
+func (x *DataFileMetadata) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+type ListDataFilesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// only list chunks after this revision (0 = chunks after the latest snapshot)
+	ChunksFromRevision int64 `protobuf:"varint,1,opt,name=chunks_from_revision,json=chunksFromRevision,proto3" json:"chunks_from_revision,omitempty"`
+	// read the metadata of each listed file, which is one request per file
+	IncludeMetadata bool `protobuf:"varint,2,opt,name=include_metadata,json=includeMetadata,proto3" json:"include_metadata,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ListDataFilesRequest) Reset() {
+	*x = ListDataFilesRequest{}
+	mi := &file_proto_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDataFilesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDataFilesRequest) ProtoMessage() {}
+
+func (x *ListDataFilesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDataFilesRequest.ProtoReflect.Descriptor instead.
+func (*ListDataFilesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListDataFilesRequest) GetChunksFromRevision() int64 {
+	if x != nil {
+		return x.ChunksFromRevision
+	}
+	return 0
+}
+
+func (x *ListDataFilesRequest) GetIncludeMetadata() bool {
+	if x != nil {
+		return x.IncludeMetadata
+	}
+	return false
+}
+
+type ListDataFilesResponse struct {
+	state                  protoimpl.MessageState `protogen:"open.v1"`
+	Snapshots              []*DataFile            `protobuf:"bytes,1,rep,name=snapshots,proto3" json:"snapshots,omitempty"` // newest first
+	Chunks                 []*DataFile            `protobuf:"bytes,2,rep,name=chunks,proto3" json:"chunks,omitempty"`       // oldest first
+	LatestSnapshotRevision int64                  `protobuf:"varint,3,opt,name=latest_snapshot_revision,json=latestSnapshotRevision,proto3" json:"latest_snapshot_revision,omitempty"`
+	LatestChunkRevision    int64                  `protobuf:"varint,4,opt,name=latest_chunk_revision,json=latestChunkRevision,proto3" json:"latest_chunk_revision,omitempty"` // latest revision stored in S3
+	LocalRevision          int64                  `protobuf:"varint,5,opt,name=local_revision,json=localRevision,proto3" json:"local_revision,omitempty"`                     // latest revision in the local db
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *ListDataFilesResponse) Reset() {
+	*x = ListDataFilesResponse{}
+	mi := &file_proto_admin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDataFilesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDataFilesResponse) ProtoMessage() {}
+
+func (x *ListDataFilesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDataFilesResponse.ProtoReflect.Descriptor instead.
+func (*ListDataFilesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListDataFilesResponse) GetSnapshots() []*DataFile {
+	if x != nil {
+		return x.Snapshots
+	}
+	return nil
+}
+
+func (x *ListDataFilesResponse) GetChunks() []*DataFile {
+	if x != nil {
+		return x.Chunks
+	}
+	return nil
+}
+
+func (x *ListDataFilesResponse) GetLatestSnapshotRevision() int64 {
+	if x != nil {
+		return x.LatestSnapshotRevision
+	}
+	return 0
+}
+
+func (x *ListDataFilesResponse) GetLatestChunkRevision() int64 {
+	if x != nil {
+		return x.LatestChunkRevision
+	}
+	return 0
+}
+
+func (x *ListDataFilesResponse) GetLocalRevision() int64 {
+	if x != nil {
+		return x.LocalRevision
+	}
+	return 0
+}
+
+type Operation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Running       bool                   `protobuf:"varint,2,opt,name=running,proto3" json:"running,omitempty"` // false for the result of the most recent run
+	RecordsDone   int64                  `protobuf:"varint,3,opt,name=records_done,json=recordsDone,proto3" json:"records_done,omitempty"`
+	RecordsTotal  int64                  `protobuf:"varint,4,opt,name=records_total,json=recordsTotal,proto3" json:"records_total,omitempty"`
+	BytesDone     int64                  `protobuf:"varint,5,opt,name=bytes_done,json=bytesDone,proto3" json:"bytes_done,omitempty"`
+	BytesTotal    int64                  `protobuf:"varint,6,opt,name=bytes_total,json=bytesTotal,proto3" json:"bytes_total,omitempty"`
+	Elapsed       *durationpb.Duration   `protobuf:"bytes,7,opt,name=elapsed,proto3" json:"elapsed,omitempty"`
+	Eta           *durationpb.Duration   `protobuf:"bytes,8,opt,name=eta,proto3" json:"eta,omitempty"` // unset if unknown or not running
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Operation) Reset() {
+	*x = Operation{}
+	mi := &file_proto_admin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Operation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Operation) ProtoMessage() {}
+
+func (x *Operation) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Operation.ProtoReflect.Descriptor instead.
+func (*Operation) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Operation) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Operation) GetRunning() bool {
+	if x != nil {
+		return x.Running
+	}
+	return false
+}
+
+func (x *Operation) GetRecordsDone() int64 {
+	if x != nil {
+		return x.RecordsDone
+	}
+	return 0
+}
+
+func (x *Operation) GetRecordsTotal() int64 {
+	if x != nil {
+		return x.RecordsTotal
+	}
+	return 0
+}
+
+func (x *Operation) GetBytesDone() int64 {
+	if x != nil {
+		return x.BytesDone
+	}
+	return 0
+}
+
+func (x *Operation) GetBytesTotal() int64 {
+	if x != nil {
+		return x.BytesTotal
+	}
+	return 0
+}
+
+func (x *Operation) GetElapsed() *durationpb.Duration {
+	if x != nil {
+		return x.Elapsed
+	}
+	return nil
+}
+
+func (x *Operation) GetEta() *durationpb.Duration {
+	if x != nil {
+		return x.Eta
+	}
+	return nil
+}
+
+type ListOperationsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOperationsRequest) Reset() {
+	*x = ListOperationsRequest{}
+	mi := &file_proto_admin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOperationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOperationsRequest) ProtoMessage() {}
+
+func (x *ListOperationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOperationsRequest.ProtoReflect.Descriptor instead.
+func (*ListOperationsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{5}
+}
+
+type ListOperationsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operations    []*Operation           `protobuf:"bytes,1,rep,name=operations,proto3" json:"operations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOperationsResponse) Reset() {
+	*x = ListOperationsResponse{}
+	mi := &file_proto_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOperationsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOperationsResponse) ProtoMessage() {}
+
+func (x *ListOperationsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOperationsResponse.ProtoReflect.Descriptor instead.
+func (*ListOperationsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListOperationsResponse) GetOperations() []*Operation {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+type ClearWriteFenceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClearWriteFenceRequest) Reset() {
+	*x = ClearWriteFenceRequest{}
+	mi := &file_proto_admin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClearWriteFenceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClearWriteFenceRequest) ProtoMessage() {}
+
+func (x *ClearWriteFenceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClearWriteFenceRequest.ProtoReflect.Descriptor instead.
+func (*ClearWriteFenceRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{7}
+}
+
+type ClearWriteFenceResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Cleared        bool                   `protobuf:"varint,1,opt,name=cleared,proto3" json:"cleared,omitempty"`                                     // false if writes were not fenced
+	FencedRevision int64                  `protobuf:"varint,2,opt,name=fenced_revision,json=fencedRevision,proto3" json:"fenced_revision,omitempty"` // revision written by the other writer
+	FencedAt       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=fenced_at,json=fencedAt,proto3" json:"fenced_at,omitempty"`
+	Cause          string                 `protobuf:"bytes,4,opt,name=cause,proto3" json:"cause,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ClearWriteFenceResponse) Reset() {
+	*x = ClearWriteFenceResponse{}
+	mi := &file_proto_admin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClearWriteFenceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClearWriteFenceResponse) ProtoMessage() {}
+
+func (x *ClearWriteFenceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClearWriteFenceResponse.ProtoReflect.Descriptor instead.
+func (*ClearWriteFenceResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ClearWriteFenceResponse) GetCleared() bool {
+	if x != nil {
+		return x.Cleared
+	}
+	return false
+}
+
+func (x *ClearWriteFenceResponse) GetFencedRevision() int64 {
+	if x != nil {
+		return x.FencedRevision
+	}
+	return 0
+}
+
+func (x *ClearWriteFenceResponse) GetFencedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FencedAt
+	}
+	return nil
+}
+
+func (x *ClearWriteFenceResponse) GetCause() string {
+	if x != nil {
+		return x.Cause
+	}
+	return ""
+}
+
+type ConfigSetting struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`   // "[REDACTED]" for secrets which are set
+	Source        string                 `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"` // default, env, flag or override (set by netsy itself)
+	EnvKey        string                 `protobuf:"bytes,4,opt,name=env_key,json=envKey,proto3" json:"env_key,omitempty"`
+	DefaultValue  string                 `protobuf:"bytes,5,opt,name=default_value,json=defaultValue,proto3" json:"default_value,omitempty"`
+	Description   string                 `protobuf:"bytes,6,opt,name=description,proto3" json:"description,omitempty"`
+	Secret        bool                   `protobuf:"varint,7,opt,name=secret,proto3" json:"secret,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigSetting) Reset() {
+	*x = ConfigSetting{}
+	mi := &file_proto_admin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigSetting) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigSetting) ProtoMessage() {}
+
+func (x *ConfigSetting) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigSetting.ProtoReflect.Descriptor instead.
+func (*ConfigSetting) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ConfigSetting) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ConfigSetting) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *ConfigSetting) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *ConfigSetting) GetEnvKey() string {
+	if x != nil {
+		return x.EnvKey
+	}
+	return ""
+}
+
+func (x *ConfigSetting) GetDefaultValue() string {
+	if x != nil {
+		return x.DefaultValue
+	}
+	return ""
+}
+
+func (x *ConfigSetting) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *ConfigSetting) GetSecret() bool {
+	if x != nil {
+		return x.Secret
+	}
+	return false
+}
+
+type GetConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigRequest) Reset() {
+	*x = GetConfigRequest{}
+	mi := &file_proto_admin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigRequest) ProtoMessage() {}
+
+func (x *GetConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigRequest.ProtoReflect.Descriptor instead.
+func (*GetConfigRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{10}
+}
+
+type GetConfigResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Settings      []*ConfigSetting       `protobuf:"bytes,1,rep,name=settings,proto3" json:"settings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse) Reset() {
+	*x = GetConfigResponse{}
+	mi := &file_proto_admin_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse) ProtoMessage() {}
+
+func (x *GetConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetConfigResponse) GetSettings() []*ConfigSetting {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+type UndeleteKeyRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// restore the value as of this revision (0 = the last revision before the
+	// key was deleted)
+	AsOfRevision  int64 `protobuf:"varint,2,opt,name=as_of_revision,json=asOfRevision,proto3" json:"as_of_revision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UndeleteKeyRequest) Reset() {
+	*x = UndeleteKeyRequest{}
+	mi := &file_proto_admin_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UndeleteKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UndeleteKeyRequest) ProtoMessage() {}
+
+func (x *UndeleteKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UndeleteKeyRequest.ProtoReflect.Descriptor instead.
+func (*UndeleteKeyRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UndeleteKeyRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *UndeleteKeyRequest) GetAsOfRevision() int64 {
+	if x != nil {
+		return x.AsOfRevision
+	}
+	return 0
+}
+
+type UndeleteKeyResponse struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Revision         int64                  `protobuf:"varint,1,opt,name=revision,proto3" json:"revision,omitempty"`                                         // revision of the create record
+	RestoredRevision int64                  `protobuf:"varint,2,opt,name=restored_revision,json=restoredRevision,proto3" json:"restored_revision,omitempty"` // revision whose value was restored
+	DeletedRevision  int64                  `protobuf:"varint,3,opt,name=deleted_revision,json=deletedRevision,proto3" json:"deleted_revision,omitempty"`    // revision at which the key was deleted
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *UndeleteKeyResponse) Reset() {
+	*x = UndeleteKeyResponse{}
+	mi := &file_proto_admin_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UndeleteKeyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UndeleteKeyResponse) ProtoMessage() {}
+
+func (x *UndeleteKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UndeleteKeyResponse.ProtoReflect.Descriptor instead.
+func (*UndeleteKeyResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *UndeleteKeyResponse) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *UndeleteKeyResponse) GetRestoredRevision() int64 {
+	if x != nil {
+		return x.RestoredRevision
+	}
+	return 0
+}
+
+func (x *UndeleteKeyResponse) GetDeletedRevision() int64 {
+	if x != nil {
+		return x.DeletedRevision
+	}
+	return 0
+}
+
+type WatchPrefix struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"` // first two path segments of the watched key, e.g. /registry/pods
+	Watches       int64                  `protobuf:"varint,2,opt,name=watches,proto3" json:"watches,omitempty"`
+	Watchers      int64                  `protobuf:"varint,3,opt,name=watchers,proto3" json:"watchers,omitempty"` // number of streams with watches on the prefix
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchPrefix) Reset() {
+	*x = WatchPrefix{}
+	mi := &file_proto_admin_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchPrefix) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchPrefix) ProtoMessage() {}
+
+func (x *WatchPrefix) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchPrefix.ProtoReflect.Descriptor instead.
+func (*WatchPrefix) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *WatchPrefix) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *WatchPrefix) GetWatches() int64 {
+	if x != nil {
+		return x.Watches
+	}
+	return 0
+}
+
+func (x *WatchPrefix) GetWatchers() int64 {
+	if x != nil {
+		return x.Watchers
+	}
+	return 0
+}
+
+type ListWatchPrefixesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWatchPrefixesRequest) Reset() {
+	*x = ListWatchPrefixesRequest{}
+	mi := &file_proto_admin_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWatchPrefixesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWatchPrefixesRequest) ProtoMessage() {}
+
+func (x *ListWatchPrefixesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWatchPrefixesRequest.ProtoReflect.Descriptor instead.
+func (*ListWatchPrefixesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{15}
+}
+
+type ListWatchPrefixesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefixes      []*WatchPrefix         `protobuf:"bytes,1,rep,name=prefixes,proto3" json:"prefixes,omitempty"`  // most watches first
+	Watches       int64                  `protobuf:"varint,2,opt,name=watches,proto3" json:"watches,omitempty"`   // total across all prefixes
+	Watchers      int64                  `protobuf:"varint,3,opt,name=watchers,proto3" json:"watchers,omitempty"` // total number of streams
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListWatchPrefixesResponse) Reset() {
+	*x = ListWatchPrefixesResponse{}
+	mi := &file_proto_admin_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListWatchPrefixesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListWatchPrefixesResponse) ProtoMessage() {}
+
+func (x *ListWatchPrefixesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListWatchPrefixesResponse.ProtoReflect.Descriptor instead.
+func (*ListWatchPrefixesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ListWatchPrefixesResponse) GetPrefixes() []*WatchPrefix {
+	if x != nil {
+		return x.Prefixes
+	}
+	return nil
+}
+
+func (x *ListWatchPrefixesResponse) GetWatches() int64 {
+	if x != nil {
+		return x.Watches
+	}
+	return 0
+}
+
+func (x *ListWatchPrefixesResponse) GetWatchers() int64 {
+	if x != nil {
+		return x.Watchers
+	}
+	return 0
+}
+
+type NamespaceWrites struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Namespace       string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"` // _cluster for keys without a namespace, e.g. of cluster-scoped resources
+	Writes          int64                  `protobuf:"varint,2,opt,name=writes,proto3" json:"writes,omitempty"`      // records committed in the window
+	Bytes           int64                  `protobuf:"varint,3,opt,name=bytes,proto3" json:"bytes,omitempty"`        // bytes of the keys and values of the records
+	WritesPerMinute float64                `protobuf:"fixed64,4,opt,name=writes_per_minute,json=writesPerMinute,proto3" json:"writes_per_minute,omitempty"`
+	BytesPerMinute  float64                `protobuf:"fixed64,5,opt,name=bytes_per_minute,json=bytesPerMinute,proto3" json:"bytes_per_minute,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *NamespaceWrites) Reset() {
+	*x = NamespaceWrites{}
+	mi := &file_proto_admin_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NamespaceWrites) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NamespaceWrites) ProtoMessage() {}
+
+func (x *NamespaceWrites) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NamespaceWrites.ProtoReflect.Descriptor instead.
+func (*NamespaceWrites) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *NamespaceWrites) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *NamespaceWrites) GetWrites() int64 {
+	if x != nil {
+		return x.Writes
+	}
+	return 0
+}
+
+func (x *NamespaceWrites) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *NamespaceWrites) GetWritesPerMinute() float64 {
+	if x != nil {
+		return x.WritesPerMinute
+	}
+	return 0
+}
+
+func (x *NamespaceWrites) GetBytesPerMinute() float64 {
+	if x != nil {
+		return x.BytesPerMinute
+	}
+	return 0
+}
+
+type ListNamespaceWritesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Limit         int64                  `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"` // maximum number of namespaces returned (0 = all)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListNamespaceWritesRequest) Reset() {
+	*x = ListNamespaceWritesRequest{}
+	mi := &file_proto_admin_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListNamespaceWritesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListNamespaceWritesRequest) ProtoMessage() {}
+
+func (x *ListNamespaceWritesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListNamespaceWritesRequest.ProtoReflect.Descriptor instead.
+func (*ListNamespaceWritesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *ListNamespaceWritesRequest) GetLimit() int64 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListNamespaceWritesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespaces    []*NamespaceWrites     `protobuf:"bytes,1,rep,name=namespaces,proto3" json:"namespaces,omitempty"` // most writes first
+	Window        *durationpb.Duration   `protobuf:"bytes,2,opt,name=window,proto3" json:"window,omitempty"`         // period the rates are averaged over
+	Writes        int64                  `protobuf:"varint,3,opt,name=writes,proto3" json:"writes,omitempty"`        // total across all namespaces, including those not returned
+	Bytes         int64                  `protobuf:"varint,4,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListNamespaceWritesResponse) Reset() {
+	*x = ListNamespaceWritesResponse{}
+	mi := &file_proto_admin_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListNamespaceWritesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListNamespaceWritesResponse) ProtoMessage() {}
+
+func (x *ListNamespaceWritesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListNamespaceWritesResponse.ProtoReflect.Descriptor instead.
+func (*ListNamespaceWritesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ListNamespaceWritesResponse) GetNamespaces() []*NamespaceWrites {
+	if x != nil {
+		return x.Namespaces
+	}
+	return nil
+}
+
+func (x *ListNamespaceWritesResponse) GetWindow() *durationpb.Duration {
+	if x != nil {
+		return x.Window
+	}
+	return nil
+}
+
+func (x *ListNamespaceWritesResponse) GetWrites() int64 {
+	if x != nil {
+		return x.Writes
+	}
+	return 0
+}
+
+func (x *ListNamespaceWritesResponse) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type SetNextRevisionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Revision      int64                  `protobuf:"varint,1,opt,name=revision,proto3" json:"revision,omitempty"`
+	DryRun        bool                   `protobuf:"varint,2,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"` // validate the revision without setting it
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetNextRevisionRequest) Reset() {
+	*x = SetNextRevisionRequest{}
+	mi := &file_proto_admin_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetNextRevisionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetNextRevisionRequest) ProtoMessage() {}
+
+func (x *SetNextRevisionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetNextRevisionRequest.ProtoReflect.Descriptor instead.
+func (*SetNextRevisionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *SetNextRevisionRequest) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *SetNextRevisionRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+type SetNextRevisionResponse struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	PreviousRevision int64                  `protobuf:"varint,1,opt,name=previous_revision,json=previousRevision,proto3" json:"previous_revision,omitempty"`   // next revision before it was set
+	Revision         int64                  `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`                                           // next revision once set
+	LocalRevision    int64                  `protobuf:"varint,3,opt,name=local_revision,json=localRevision,proto3" json:"local_revision,omitempty"`            // latest revision in the local db, including skipped revisions
+	S3Revision       int64                  `protobuf:"varint,4,opt,name=s3_revision,json=s3Revision,proto3" json:"s3_revision,omitempty"`                     // latest revision in S3 (0 = S3 disabled)
+	GapFirstRevision int64                  `protobuf:"varint,5,opt,name=gap_first_revision,json=gapFirstRevision,proto3" json:"gap_first_revision,omitempty"` // first revision skipped (0 = none)
+	GapLastRevision  int64                  `protobuf:"varint,6,opt,name=gap_last_revision,json=gapLastRevision,proto3" json:"gap_last_revision,omitempty"`    // last revision skipped (0 = none)
+	DryRun           bool                   `protobuf:"varint,7,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`                                 // true if the revision was not set
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *SetNextRevisionResponse) Reset() {
+	*x = SetNextRevisionResponse{}
+	mi := &file_proto_admin_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetNextRevisionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetNextRevisionResponse) ProtoMessage() {}
+
+func (x *SetNextRevisionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetNextRevisionResponse.ProtoReflect.Descriptor instead.
+func (*SetNextRevisionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *SetNextRevisionResponse) GetPreviousRevision() int64 {
+	if x != nil {
+		return x.PreviousRevision
+	}
+	return 0
+}
+
+func (x *SetNextRevisionResponse) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *SetNextRevisionResponse) GetLocalRevision() int64 {
+	if x != nil {
+		return x.LocalRevision
+	}
+	return 0
+}
+
+func (x *SetNextRevisionResponse) GetS3Revision() int64 {
+	if x != nil {
+		return x.S3Revision
+	}
+	return 0
+}
+
+func (x *SetNextRevisionResponse) GetGapFirstRevision() int64 {
+	if x != nil {
+		return x.GapFirstRevision
+	}
+	return 0
+}
+
+func (x *SetNextRevisionResponse) GetGapLastRevision() int64 {
+	if x != nil {
+		return x.GapLastRevision
+	}
+	return 0
+}
+
+func (x *SetNextRevisionResponse) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+type WriteFenceStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Revision      int64                  `protobuf:"varint,1,opt,name=revision,proto3" json:"revision,omitempty"` // revision written by the other writer
+	FencedAt      *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=fenced_at,json=fencedAt,proto3" json:"fenced_at,omitempty"`
+	Cause         string                 `protobuf:"bytes,3,opt,name=cause,proto3" json:"cause,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteFenceStatus) Reset() {
+	*x = WriteFenceStatus{}
+	mi := &file_proto_admin_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteFenceStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteFenceStatus) ProtoMessage() {}
+
+func (x *WriteFenceStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteFenceStatus.ProtoReflect.Descriptor instead.
+func (*WriteFenceStatus) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *WriteFenceStatus) GetRevision() int64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *WriteFenceStatus) GetFencedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FencedAt
+	}
+	return nil
+}
+
+func (x *WriteFenceStatus) GetCause() string {
+	if x != nil {
+		return x.Cause
+	}
+	return ""
+}
+
+type ReplicationStatus struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	LeaderRevision  int64                  `protobuf:"varint,1,opt,name=leader_revision,json=leaderRevision,proto3" json:"leader_revision,omitempty"`    // latest revision known to have been written by the leader
+	AppliedRevision int64                  `protobuf:"varint,2,opt,name=applied_revision,json=appliedRevision,proto3" json:"applied_revision,omitempty"` // latest revision replicated and applied locally
+	LagRecords      int64                  `protobuf:"varint,3,opt,name=lag_records,json=lagRecords,proto3" json:"lag_records,omitempty"`
+	Lag             *durationpb.Duration   `protobuf:"bytes,4,opt,name=lag,proto3" json:"lag,omitempty"` // how long ago the leader wrote the latest applied revision
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ReplicationStatus) Reset() {
+	*x = ReplicationStatus{}
+	mi := &file_proto_admin_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicationStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicationStatus) ProtoMessage() {}
+
+func (x *ReplicationStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicationStatus.ProtoReflect.Descriptor instead.
+func (*ReplicationStatus) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ReplicationStatus) GetLeaderRevision() int64 {
+	if x != nil {
+		return x.LeaderRevision
+	}
+	return 0
+}
+
+func (x *ReplicationStatus) GetAppliedRevision() int64 {
+	if x != nil {
+		return x.AppliedRevision
+	}
+	return 0
+}
+
+func (x *ReplicationStatus) GetLagRecords() int64 {
+	if x != nil {
+		return x.LagRecords
+	}
+	return 0
+}
+
+func (x *ReplicationStatus) GetLag() *durationpb.Duration {
+	if x != nil {
+		return x.Lag
+	}
+	return nil
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_proto_admin_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{24}
+}
+
+type GetStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LocalRevision int64                  `protobuf:"varint,1,opt,name=local_revision,json=localRevision,proto3" json:"local_revision,omitempty"` // latest revision in the local db
+	MemoryLevel   string                 `protobuf:"bytes,2,opt,name=memory_level,json=memoryLevel,proto3" json:"memory_level,omitempty"`        // memory degradation level, e.g. normal
+	WriteFence    *WriteFenceStatus      `protobuf:"bytes,3,opt,name=write_fence,json=writeFence,proto3" json:"write_fence,omitempty"`           // unset unless writes are fenced
+	Operations    []*Operation           `protobuf:"bytes,4,rep,name=operations,proto3" json:"operations,omitempty"`                             // running operations
+	Replication   *ReplicationStatus     `protobuf:"bytes,5,opt,name=replication,proto3" json:"replication,omitempty"`                           // unset unless replicating from a leader
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusResponse) Reset() {
+	*x = GetStatusResponse{}
+	mi := &file_proto_admin_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusResponse) ProtoMessage() {}
+
+func (x *GetStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetStatusResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *GetStatusResponse) GetLocalRevision() int64 {
+	if x != nil {
+		return x.LocalRevision
+	}
+	return 0
+}
+
+func (x *GetStatusResponse) GetMemoryLevel() string {
+	if x != nil {
+		return x.MemoryLevel
+	}
+	return ""
+}
+
+func (x *GetStatusResponse) GetWriteFence() *WriteFenceStatus {
+	if x != nil {
+		return x.WriteFence
+	}
+	return nil
+}
+
+func (x *GetStatusResponse) GetOperations() []*Operation {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+func (x *GetStatusResponse) GetReplication() *ReplicationStatus {
+	if x != nil {
+		return x.Replication
+	}
+	return nil
+}
+
+var File_proto_admin_proto protoreflect.FileDescriptor
+
+const file_proto_admin_proto_rawDesc = "" +
+	"\n" +
+	"\x11proto/admin.proto\x12\x05netsy\x1a\x10proto/file.proto\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe7\x01\n" +
+	"\bDataFile\x12#\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\x0f.netsy.FileKindR\x04kind\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x03R\x04size\x12\x1a\n" +
+	"\brevision\x18\x04 \x01(\x03R\brevision\x12?\n" +
+	"\rlast_modified\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\flastModified\x123\n" +
+	"\bmetadata\x18\x06 \x01(\v2\x17.netsy.DataFileMetadataR\bmetadata\"\xdb\x01\n" +
+	"\x10DataFileMetadata\x12%\n" +
+	"\x0efirst_revision\x18\x01 \x01(\x03R\rfirstRevision\x12#\n" +
+	"\rlast_revision\x18\x02 \x01(\x03R\flastRevision\x12#\n" +
+	"\rrecords_count\x18\x03 \x01(\x03R\frecordsCount\x12\x1b\n" +
+	"\tleader_id\x18\x04 \x01(\tR\bleaderId\x12!\n" +
+	"\fleader_epoch\x18\x05 \x01(\x03R\vleaderEpoch\x12\x16\n" +
+	"\x06sha256\x18\x06 \x01(\tR\x06sha256\"s\n" +
+	"\x14ListDataFilesRequest\x120\n" +
+	"\x14chunks_from_revision\x18\x01 \x01(\x03R\x12chunksFromRevision\x12)\n" +
+	"\x10include_metadata\x18\x02 \x01(\bR\x0fincludeMetadata\"\x84\x02\n" +
+	"\x15ListDataFilesResponse\x12-\n" +
+	"\tsnapshots\x18\x01 \x03(\v2\x0f.netsy.DataFileR\tsnapshots\x12'\n" +
+	"\x06chunks\x18\x02 \x03(\v2\x0f.netsy.DataFileR\x06chunks\x128\n" +
+	"\x18latest_snapshot_revision\x18\x03 \x01(\x03R\x16latestSnapshotRevision\x122\n" +
+	"\x15latest_chunk_revision\x18\x04 \x01(\x03R\x13latestChunkRevision\x12%\n" +
+	"\x0elocal_revision\x18\x05 \x01(\x03R\rlocalRevision\"\xa3\x02\n" +
+	"\tOperation\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\arunning\x18\x02 \x01(\bR\arunning\x12!\n" +
+	"\frecords_done\x18\x03 \x01(\x03R\vrecordsDone\x12#\n" +
+	"\rrecords_total\x18\x04 \x01(\x03R\frecordsTotal\x12\x1d\n" +
+	"\n" +
+	"bytes_done\x18\x05 \x01(\x03R\tbytesDone\x12\x1f\n" +
+	"\vbytes_total\x18\x06 \x01(\x03R\n" +
+	"bytesTotal\x123\n" +
+	"\aelapsed\x18\a \x01(\v2\x19.google.protobuf.DurationR\aelapsed\x12+\n" +
+	"\x03eta\x18\b \x01(\v2\x19.google.protobuf.DurationR\x03eta\"\x17\n" +
+	"\x15ListOperationsRequest\"J\n" +
+	"\x16ListOperationsResponse\x120\n" +
+	"\n" +
+	"operations\x18\x01 \x03(\v2\x10.netsy.OperationR\n" +
+	"operations\"\x18\n" +
+	"\x16ClearWriteFenceRequest\"\xab\x01\n" +
+	"\x17ClearWriteFenceResponse\x12\x18\n" +
+	"\acleared\x18\x01 \x01(\bR\acleared\x12'\n" +
+	"\x0ffenced_revision\x18\x02 \x01(\x03R\x0efencedRevision\x127\n" +
+	"\tfenced_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\bfencedAt\x12\x14\n" +
+	"\x05cause\x18\x04 \x01(\tR\x05cause\"\xc9\x01\n" +
+	"\rConfigSetting\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x16\n" +
+	"\x06source\x18\x03 \x01(\tR\x06source\x12\x17\n" +
+	"\aenv_key\x18\x04 \x01(\tR\x06envKey\x12#\n" +
+	"\rdefault_value\x18\x05 \x01(\tR\fdefaultValue\x12 \n" +
+	"\vdescription\x18\x06 \x01(\tR\vdescription\x12\x16\n" +
+	"\x06secret\x18\a \x01(\bR\x06secret\"\x12\n" +
+	"\x10GetConfigRequest\"E\n" +
+	"\x11GetConfigResponse\x120\n" +
+	"\bsettings\x18\x01 \x03(\v2\x14.netsy.ConfigSettingR\bsettings\"L\n" +
+	"\x12UndeleteKeyRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12$\n" +
+	"\x0eas_of_revision\x18\x02 \x01(\x03R\fasOfRevision\"\x89\x01\n" +
+	"\x13UndeleteKeyResponse\x12\x1a\n" +
+	"\brevision\x18\x01 \x01(\x03R\brevision\x12+\n" +
+	"\x11restored_revision\x18\x02 \x01(\x03R\x10restoredRevision\x12)\n" +
+	"\x10deleted_revision\x18\x03 \x01(\x03R\x0fdeletedRevision\"[\n" +
+	"\vWatchPrefix\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x18\n" +
+	"\awatches\x18\x02 \x01(\x03R\awatches\x12\x1a\n" +
+	"\bwatchers\x18\x03 \x01(\x03R\bwatchers\"\x1a\n" +
+	"\x18ListWatchPrefixesRequest\"\x81\x01\n" +
+	"\x19ListWatchPrefixesResponse\x12.\n" +
+	"\bprefixes\x18\x01 \x03(\v2\x12.netsy.WatchPrefixR\bprefixes\x12\x18\n" +
+	"\awatches\x18\x02 \x01(\x03R\awatches\x12\x1a\n" +
+	"\bwatchers\x18\x03 \x01(\x03R\bwatchers\"\xb3\x01\n" +
+	"\x0fNamespaceWrites\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x16\n" +
+	"\x06writes\x18\x02 \x01(\x03R\x06writes\x12\x14\n" +
+	"\x05bytes\x18\x03 \x01(\x03R\x05bytes\x12*\n" +
+	"\x11writes_per_minute\x18\x04 \x01(\x01R\x0fwritesPerMinute\x12(\n" +
+	"\x10bytes_per_minute\x18\x05 \x01(\x01R\x0ebytesPerMinute\"2\n" +
+	"\x1aListNamespaceWritesRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x03R\x05limit\"\xb6\x01\n" +
+	"\x1bListNamespaceWritesResponse\x126\n" +
+	"\n" +
+	"namespaces\x18\x01 \x03(\v2\x16.netsy.NamespaceWritesR\n" +
+	"namespaces\x121\n" +
+	"\x06window\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\x06window\x12\x16\n" +
+	"\x06writes\x18\x03 \x01(\x03R\x06writes\x12\x14\n" +
+	"\x05bytes\x18\x04 \x01(\x03R\x05bytes\"M\n" +
+	"\x16SetNextRevisionRequest\x12\x1a\n" +
+	"\brevision\x18\x01 \x01(\x03R\brevision\x12\x17\n" +
+	"\adry_run\x18\x02 \x01(\bR\x06dryRun\"\x9d\x02\n" +
+	"\x17SetNextRevisionResponse\x12+\n" +
+	"\x11previous_revision\x18\x01 \x01(\x03R\x10previousRevision\x12\x1a\n" +
+	"\brevision\x18\x02 \x01(\x03R\brevision\x12%\n" +
+	"\x0elocal_revision\x18\x03 \x01(\x03R\rlocalRevision\x12\x1f\n" +
+	"\vs3_revision\x18\x04 \x01(\x03R\n" +
+	"s3Revision\x12,\n" +
+	"\x12gap_first_revision\x18\x05 \x01(\x03R\x10gapFirstRevision\x12*\n" +
+	"\x11gap_last_revision\x18\x06 \x01(\x03R\x0fgapLastRevision\x12\x17\n" +
+	"\adry_run\x18\a \x01(\bR\x06dryRun\"}\n" +
+	"\x10WriteFenceStatus\x12\x1a\n" +
+	"\brevision\x18\x01 \x01(\x03R\brevision\x127\n" +
+	"\tfenced_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\bfencedAt\x12\x14\n" +
+	"\x05cause\x18\x03 \x01(\tR\x05cause\"\xb5\x01\n" +
+	"\x11ReplicationStatus\x12'\n" +
+	"\x0fleader_revision\x18\x01 \x01(\x03R\x0eleaderRevision\x12)\n" +
+	"\x10applied_revision\x18\x02 \x01(\x03R\x0fappliedRevision\x12\x1f\n" +
+	"\vlag_records\x18\x03 \x01(\x03R\n" +
+	"lagRecords\x12+\n" +
+	"\x03lag\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\x03lag\"\x12\n" +
+	"\x10GetStatusRequest\"\x85\x02\n" +
+	"\x11GetStatusResponse\x12%\n" +
+	"\x0elocal_revision\x18\x01 \x01(\x03R\rlocalRevision\x12!\n" +
+	"\fmemory_level\x18\x02 \x01(\tR\vmemoryLevel\x128\n" +
+	"\vwrite_fence\x18\x03 \x01(\v2\x17.netsy.WriteFenceStatusR\n" +
+	"writeFence\x120\n" +
+	"\n" +
+	"operations\x18\x04 \x03(\v2\x10.netsy.OperationR\n" +
+	"operations\x12:\n" +
+	"\vreplication\x18\x05 \x01(\v2\x18.netsy.ReplicationStatusR\vreplication2\xc2\x05\n" +
+	"\x05Admin\x12J\n" +
+	"\rListDataFiles\x12\x1b.netsy.ListDataFilesRequest\x1a\x1c.netsy.ListDataFilesResponse\x12M\n" +
+	"\x0eListOperations\x12\x1c.netsy.ListOperationsRequest\x1a\x1d.netsy.ListOperationsResponse\x12P\n" +
+	"\x0fClearWriteFence\x12\x1d.netsy.ClearWriteFenceRequest\x1a\x1e.netsy.ClearWriteFenceResponse\x12>\n" +
+	"\tGetConfig\x12\x17.netsy.GetConfigRequest\x1a\x18.netsy.GetConfigResponse\x12D\n" +
+	"\vUndeleteKey\x12\x19.netsy.UndeleteKeyRequest\x1a\x1a.netsy.UndeleteKeyResponse\x12V\n" +
+	"\x11ListWatchPrefixes\x12\x1f.netsy.ListWatchPrefixesRequest\x1a .netsy.ListWatchPrefixesResponse\x12\\\n" +
+	"\x13ListNamespaceWrites\x12!.netsy.ListNamespaceWritesRequest\x1a\".netsy.ListNamespaceWritesResponse\x12P\n" +
+	"\x0fSetNextRevision\x12\x1d.netsy.SetNextRevisionRequest\x1a\x1e.netsy.SetNextRevisionResponse\x12>\n" +
+	"\tGetStatus\x12\x17.netsy.GetStatusRequest\x1a\x18.netsy.GetStatusResponseB-Z+github.com/nadrama-com/netsy/internal/protob\x06proto3"
+
+var (
+	file_proto_admin_proto_rawDescOnce sync.Once
+	file_proto_admin_proto_rawDescData []byte
+)
+
+func file_proto_admin_proto_rawDescGZIP() []byte {
+	file_proto_admin_proto_rawDescOnce.Do(func() {
+		file_proto_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)))
+	})
+	return file_proto_admin_proto_rawDescData
+}
+
+var file_proto_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 26)
+var file_proto_admin_proto_goTypes = []any{
+	(*DataFile)(nil),                    // 0: netsy.DataFile
+	(*DataFileMetadata)(nil),            // 1: netsy.DataFileMetadata
+	(*ListDataFilesRequest)(nil),        // 2: netsy.ListDataFilesRequest
+	(*ListDataFilesResponse)(nil),       // 3: netsy.ListDataFilesResponse
+	(*Operation)(nil),                   // 4: netsy.Operation
+	(*ListOperationsRequest)(nil),       // 5: netsy.ListOperationsRequest
+	(*ListOperationsResponse)(nil),      // 6: netsy.ListOperationsResponse
+	(*ClearWriteFenceRequest)(nil),      // 7: netsy.ClearWriteFenceRequest
+	(*ClearWriteFenceResponse)(nil),     // 8: netsy.ClearWriteFenceResponse
+	(*ConfigSetting)(nil),               // 9: netsy.ConfigSetting
+	(*GetConfigRequest)(nil),            // 10: netsy.GetConfigRequest
+	(*GetConfigResponse)(nil),           // 11: netsy.GetConfigResponse
+	(*UndeleteKeyRequest)(nil),          // 12: netsy.UndeleteKeyRequest
+	(*UndeleteKeyResponse)(nil),         // 13: netsy.UndeleteKeyResponse
+	(*WatchPrefix)(nil),                 // 14: netsy.WatchPrefix
+	(*ListWatchPrefixesRequest)(nil),    // 15: netsy.ListWatchPrefixesRequest
+	(*ListWatchPrefixesResponse)(nil),   // 16: netsy.ListWatchPrefixesResponse
+	(*NamespaceWrites)(nil),             // 17: netsy.NamespaceWrites
+	(*ListNamespaceWritesRequest)(nil),  // 18: netsy.ListNamespaceWritesRequest
+	(*ListNamespaceWritesResponse)(nil), // 19: netsy.ListNamespaceWritesResponse
+	(*SetNextRevisionRequest)(nil),      // 20: netsy.SetNextRevisionRequest
+	(*SetNextRevisionResponse)(nil),     // 21: netsy.SetNextRevisionResponse
+	(*WriteFenceStatus)(nil),            // 22: netsy.WriteFenceStatus
+	(*ReplicationStatus)(nil),           // 23: netsy.ReplicationStatus
+	(*GetStatusRequest)(nil),            // 24: netsy.GetStatusRequest
+	(*GetStatusResponse)(nil),           // 25: netsy.GetStatusResponse
+	(FileKind)(0),                       // 26: netsy.FileKind
+	(*timestamppb.Timestamp)(nil),       // 27: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),         // 28: google.protobuf.Duration
+}
+var file_proto_admin_proto_depIdxs = []int32{
+	26, // 0: netsy.DataFile.kind:type_name -> netsy.FileKind
+	27, // 1: netsy.DataFile.last_modified:type_name -> google.protobuf.Timestamp
+	1,  // 2: netsy.DataFile.metadata:type_name -> netsy.DataFileMetadata
+	0,  // 3: netsy.ListDataFilesResponse.snapshots:type_name -> netsy.DataFile
+	0,  // 4: netsy.ListDataFilesResponse.chunks:type_name -> netsy.DataFile
+	28, // 5: netsy.Operation.elapsed:type_name -> google.protobuf.Duration
+	28, // 6: netsy.Operation.eta:type_name -> google.protobuf.Duration
+	4,  // 7: netsy.ListOperationsResponse.operations:type_name -> netsy.Operation
+	27, // 8: netsy.ClearWriteFenceResponse.fenced_at:type_name -> google.protobuf.Timestamp
+	9,  // 9: netsy.GetConfigResponse.settings:type_name -> netsy.ConfigSetting
+	14, // 10: netsy.ListWatchPrefixesResponse.prefixes:type_name -> netsy.WatchPrefix
+	17, // 11: netsy.ListNamespaceWritesResponse.namespaces:type_name -> netsy.NamespaceWrites
+	28, // 12: netsy.ListNamespaceWritesResponse.window:type_name -> google.protobuf.Duration
+	27, // 13: netsy.WriteFenceStatus.fenced_at:type_name -> google.protobuf.Timestamp
+	28, // 14: netsy.ReplicationStatus.lag:type_name -> google.protobuf.Duration
+	22, // 15: netsy.GetStatusResponse.write_fence:type_name -> netsy.WriteFenceStatus
+	4,  // 16: netsy.GetStatusResponse.operations:type_name -> netsy.Operation
+	23, // 17: netsy.GetStatusResponse.replication:type_name -> netsy.ReplicationStatus
+	2,  // 18: netsy.Admin.ListDataFiles:input_type -> netsy.ListDataFilesRequest
+	5,  // 19: netsy.Admin.ListOperations:input_type -> netsy.ListOperationsRequest
+	7,  // 20: netsy.Admin.ClearWriteFence:input_type -> netsy.ClearWriteFenceRequest
+	10, // 21: netsy.Admin.GetConfig:input_type -> netsy.GetConfigRequest
+	12, // 22: netsy.Admin.UndeleteKey:input_type -> netsy.UndeleteKeyRequest
+	15, // 23: netsy.Admin.ListWatchPrefixes:input_type -> netsy.ListWatchPrefixesRequest
+	18, // 24: netsy.Admin.ListNamespaceWrites:input_type -> netsy.ListNamespaceWritesRequest
+	20, // 25: netsy.Admin.SetNextRevision:input_type -> netsy.SetNextRevisionRequest
+	24, // 26: netsy.Admin.GetStatus:input_type -> netsy.GetStatusRequest
+	3,  // 27: netsy.Admin.ListDataFiles:output_type -> netsy.ListDataFilesResponse
+	6,  // 28: netsy.Admin.ListOperations:output_type -> netsy.ListOperationsResponse
+	8,  // 29: netsy.Admin.ClearWriteFence:output_type -> netsy.ClearWriteFenceResponse
+	11, // 30: netsy.Admin.GetConfig:output_type -> netsy.GetConfigResponse
+	13, // 31: netsy.Admin.UndeleteKey:output_type -> netsy.UndeleteKeyResponse
+	16, // 32: netsy.Admin.ListWatchPrefixes:output_type -> netsy.ListWatchPrefixesResponse
+	19, // 33: netsy.Admin.ListNamespaceWrites:output_type -> netsy.ListNamespaceWritesResponse
+	21, // 34: netsy.Admin.SetNextRevision:output_type -> netsy.SetNextRevisionResponse
+	25, // 35: netsy.Admin.GetStatus:output_type -> netsy.GetStatusResponse
+	27, // [27:36] is the sub-list for method output_type
+	18, // [18:27] is the sub-list for method input_type
+	18, // [18:18] is the sub-list for extension type_name
+	18, // [18:18] is the sub-list for extension extendee
+	0,  // [0:18] is the sub-list for field type_name
+}
+
+func init() { file_proto_admin_proto_init() }
+func file_proto_admin_proto_init() {
+	if File_proto_admin_proto != nil {
+		return
+	}
+	file_proto_file_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   26,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_admin_proto_goTypes,
+		DependencyIndexes: file_proto_admin_proto_depIdxs,
+		MessageInfos:      file_proto_admin_proto_msgTypes,
+	}.Build()
+	File_proto_admin_proto = out.File
+	file_proto_admin_proto_goTypes = nil
+	file_proto_admin_proto_depIdxs = nil
+}
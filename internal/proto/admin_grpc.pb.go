@@ -0,0 +1,475 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: proto/admin.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Admin_ListDataFiles_FullMethodName       = "/netsy.Admin/ListDataFiles"
+	Admin_ListOperations_FullMethodName      = "/netsy.Admin/ListOperations"
+	Admin_ClearWriteFence_FullMethodName     = "/netsy.Admin/ClearWriteFence"
+	Admin_GetConfig_FullMethodName           = "/netsy.Admin/GetConfig"
+	Admin_UndeleteKey_FullMethodName         = "/netsy.Admin/UndeleteKey"
+	Admin_ListWatchPrefixes_FullMethodName   = "/netsy.Admin/ListWatchPrefixes"
+	Admin_ListNamespaceWrites_FullMethodName = "/netsy.Admin/ListNamespaceWrites"
+	Admin_SetNextRevision_FullMethodName     = "/netsy.Admin/SetNextRevision"
+	Admin_GetStatus_FullMethodName           = "/netsy.Admin/GetStatus"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Admin is a netsy-specific service for operators and automation (such as
+// the admin UI), served alongside the etcd client API
+type AdminClient interface {
+	// ListDataFiles lists the snapshot and chunk files stored in S3
+	ListDataFiles(ctx context.Context, in *ListDataFilesRequest, opts ...grpc.CallOption) (*ListDataFilesResponse, error)
+	// ListOperations reports running operations (e.g. snapshots) and the
+	// result of the most recent run of each operation (e.g. backfill)
+	ListOperations(ctx context.Context, in *ListOperationsRequest, opts ...grpc.CallOption) (*ListOperationsResponse, error)
+	// ClearWriteFence resumes accepting writes after they were fenced because
+	// another writer was detected. The other writer must be stopped first.
+	ClearWriteFence(ctx context.Context, in *ClearWriteFenceRequest, opts ...grpc.CallOption) (*ClearWriteFenceResponse, error)
+	// GetConfig returns the effective runtime configuration of the server, and
+	// where each value came from, with secrets redacted
+	GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error)
+	// UndeleteKey recreates a deleted key with its value from before it was
+	// deleted, by writing a create record through the normal transaction
+	// path. The value must not have been compacted.
+	UndeleteKey(ctx context.Context, in *UndeleteKeyRequest, opts ...grpc.CallOption) (*UndeleteKeyResponse, error)
+	// ListWatchPrefixes reports the number of active watches per key prefix,
+	// e.g. to find clients which leak watches
+	ListWatchPrefixes(ctx context.Context, in *ListWatchPrefixesRequest, opts ...grpc.CallOption) (*ListWatchPrefixesResponse, error)
+	// ListNamespaceWrites reports the recent write rate per Kubernetes
+	// namespace, e.g. to find the noisy tenants driving revision growth and
+	// S3 costs
+	ListNamespaceWrites(ctx context.Context, in *ListNamespaceWritesRequest, opts ...grpc.CallOption) (*ListNamespaceWritesResponse, error)
+	// SetNextRevision sets the revision assigned to the next transaction, for
+	// expert recovery after manual changes to the local db or S3. The revision
+	// must be after the latest revision in both, and revisions skipped are
+	// recorded as a gap.
+	SetNextRevision(ctx context.Context, in *SetNextRevisionRequest, opts ...grpc.CallOption) (*SetNextRevisionResponse, error)
+	// GetStatus reports netsy-specific server state which etcd's Status API
+	// has no fields for: write fencing, memory degradation, replication lag
+	// and running operations
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListDataFiles(ctx context.Context, in *ListDataFilesRequest, opts ...grpc.CallOption) (*ListDataFilesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDataFilesResponse)
+	err := c.cc.Invoke(ctx, Admin_ListDataFiles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListOperations(ctx context.Context, in *ListOperationsRequest, opts ...grpc.CallOption) (*ListOperationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListOperationsResponse)
+	err := c.cc.Invoke(ctx, Admin_ListOperations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ClearWriteFence(ctx context.Context, in *ClearWriteFenceRequest, opts ...grpc.CallOption) (*ClearWriteFenceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ClearWriteFenceResponse)
+	err := c.cc.Invoke(ctx, Admin_ClearWriteFence_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetConfigResponse)
+	err := c.cc.Invoke(ctx, Admin_GetConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) UndeleteKey(ctx context.Context, in *UndeleteKeyRequest, opts ...grpc.CallOption) (*UndeleteKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UndeleteKeyResponse)
+	err := c.cc.Invoke(ctx, Admin_UndeleteKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListWatchPrefixes(ctx context.Context, in *ListWatchPrefixesRequest, opts ...grpc.CallOption) (*ListWatchPrefixesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWatchPrefixesResponse)
+	err := c.cc.Invoke(ctx, Admin_ListWatchPrefixes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListNamespaceWrites(ctx context.Context, in *ListNamespaceWritesRequest, opts ...grpc.CallOption) (*ListNamespaceWritesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListNamespaceWritesResponse)
+	err := c.cc.Invoke(ctx, Admin_ListNamespaceWrites_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetNextRevision(ctx context.Context, in *SetNextRevisionRequest, opts ...grpc.CallOption) (*SetNextRevisionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetNextRevisionResponse)
+	err := c.cc.Invoke(ctx, Admin_SetNextRevision_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStatusResponse)
+	err := c.cc.Invoke(ctx, Admin_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility.
+//
+// Admin is a netsy-specific service for operators and automation (such as
+// the admin UI), served alongside the etcd client API
+type AdminServer interface {
+	// ListDataFiles lists the snapshot and chunk files stored in S3
+	ListDataFiles(context.Context, *ListDataFilesRequest) (*ListDataFilesResponse, error)
+	// ListOperations reports running operations (e.g. snapshots) and the
+	// result of the most recent run of each operation (e.g. backfill)
+	ListOperations(context.Context, *ListOperationsRequest) (*ListOperationsResponse, error)
+	// ClearWriteFence resumes accepting writes after they were fenced because
+	// another writer was detected. The other writer must be stopped first.
+	ClearWriteFence(context.Context, *ClearWriteFenceRequest) (*ClearWriteFenceResponse, error)
+	// GetConfig returns the effective runtime configuration of the server, and
+	// where each value came from, with secrets redacted
+	GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error)
+	// UndeleteKey recreates a deleted key with its value from before it was
+	// deleted, by writing a create record through the normal transaction
+	// path. The value must not have been compacted.
+	UndeleteKey(context.Context, *UndeleteKeyRequest) (*UndeleteKeyResponse, error)
+	// ListWatchPrefixes reports the number of active watches per key prefix,
+	// e.g. to find clients which leak watches
+	ListWatchPrefixes(context.Context, *ListWatchPrefixesRequest) (*ListWatchPrefixesResponse, error)
+	// ListNamespaceWrites reports the recent write rate per Kubernetes
+	// namespace, e.g. to find the noisy tenants driving revision growth and
+	// S3 costs
+	ListNamespaceWrites(context.Context, *ListNamespaceWritesRequest) (*ListNamespaceWritesResponse, error)
+	// SetNextRevision sets the revision assigned to the next transaction, for
+	// expert recovery after manual changes to the local db or S3. The revision
+	// must be after the latest revision in both, and revisions skipped are
+	// recorded as a gap.
+	SetNextRevision(context.Context, *SetNextRevisionRequest) (*SetNextRevisionResponse, error)
+	// GetStatus reports netsy-specific server state which etcd's Status API
+	// has no fields for: write fencing, memory degradation, replication lag
+	// and running operations
+	GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAdminServer struct{}
+
+func (UnimplementedAdminServer) ListDataFiles(context.Context, *ListDataFilesRequest) (*ListDataFilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDataFiles not implemented")
+}
+func (UnimplementedAdminServer) ListOperations(context.Context, *ListOperationsRequest) (*ListOperationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOperations not implemented")
+}
+func (UnimplementedAdminServer) ClearWriteFence(context.Context, *ClearWriteFenceRequest) (*ClearWriteFenceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClearWriteFence not implemented")
+}
+func (UnimplementedAdminServer) GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedAdminServer) UndeleteKey(context.Context, *UndeleteKeyRequest) (*UndeleteKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UndeleteKey not implemented")
+}
+func (UnimplementedAdminServer) ListWatchPrefixes(context.Context, *ListWatchPrefixesRequest) (*ListWatchPrefixesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWatchPrefixes not implemented")
+}
+func (UnimplementedAdminServer) ListNamespaceWrites(context.Context, *ListNamespaceWritesRequest) (*ListNamespaceWritesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNamespaceWrites not implemented")
+}
+func (UnimplementedAdminServer) SetNextRevision(context.Context, *SetNextRevisionRequest) (*SetNextRevisionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetNextRevision not implemented")
+}
+func (UnimplementedAdminServer) GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+func (UnimplementedAdminServer) testEmbeddedByValue()               {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	// If the following call pancis, it indicates UnimplementedAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_ListDataFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDataFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListDataFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListDataFiles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListDataFiles(ctx, req.(*ListDataFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListOperations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListOperationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListOperations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListOperations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListOperations(ctx, req.(*ListOperationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ClearWriteFence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClearWriteFenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ClearWriteFence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ClearWriteFence_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ClearWriteFence(ctx, req.(*ClearWriteFenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetConfig(ctx, req.(*GetConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UndeleteKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndeleteKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UndeleteKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_UndeleteKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UndeleteKey(ctx, req.(*UndeleteKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListWatchPrefixes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWatchPrefixesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListWatchPrefixes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListWatchPrefixes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListWatchPrefixes(ctx, req.(*ListWatchPrefixesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListNamespaceWrites_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNamespaceWritesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListNamespaceWrites(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListNamespaceWrites_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListNamespaceWrites(ctx, req.(*ListNamespaceWritesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetNextRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetNextRevisionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetNextRevision(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_SetNextRevision_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetNextRevision(ctx, req.(*SetNextRevisionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "netsy.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListDataFiles",
+			Handler:    _Admin_ListDataFiles_Handler,
+		},
+		{
+			MethodName: "ListOperations",
+			Handler:    _Admin_ListOperations_Handler,
+		},
+		{
+			MethodName: "ClearWriteFence",
+			Handler:    _Admin_ClearWriteFence_Handler,
+		},
+		{
+			MethodName: "GetConfig",
+			Handler:    _Admin_GetConfig_Handler,
+		},
+		{
+			MethodName: "UndeleteKey",
+			Handler:    _Admin_UndeleteKey_Handler,
+		},
+		{
+			MethodName: "ListWatchPrefixes",
+			Handler:    _Admin_ListWatchPrefixes_Handler,
+		},
+		{
+			MethodName: "ListNamespaceWrites",
+			Handler:    _Admin_ListNamespaceWrites_Handler,
+		},
+		{
+			MethodName: "SetNextRevision",
+			Handler:    _Admin_SetNextRevision_Handler,
+		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _Admin_GetStatus_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/admin.proto",
+}
@@ -25,9 +25,12 @@ const (
 type FileKind int32
 
 const (
-	FileKind_KIND_UNKNOWN  FileKind = 0
-	FileKind_KIND_SNAPSHOT FileKind = 1
-	FileKind_KIND_CHUNK    FileKind = 2
+	FileKind_KIND_UNKNOWN           FileKind = 0
+	FileKind_KIND_SNAPSHOT          FileKind = 1
+	FileKind_KIND_CHUNK             FileKind = 2
+	FileKind_KIND_COMPACTION        FileKind = 3 // marker recording a compaction, see Record.compacted_at
+	FileKind_KIND_LEASES            FileKind = 4 // lease state, see Record.lease_entry
+	FileKind_KIND_SNAPSHOT_MANIFEST FileKind = 5 // parts of a multi-part snapshot, see Record.snapshot_part
 )
 
 // Enum value maps for FileKind.
@@ -36,11 +39,17 @@ var (
 		0: "KIND_UNKNOWN",
 		1: "KIND_SNAPSHOT",
 		2: "KIND_CHUNK",
+		3: "KIND_COMPACTION",
+		4: "KIND_LEASES",
+		5: "KIND_SNAPSHOT_MANIFEST",
 	}
 	FileKind_value = map[string]int32{
-		"KIND_UNKNOWN":  0,
-		"KIND_SNAPSHOT": 1,
-		"KIND_CHUNK":    2,
+		"KIND_UNKNOWN":           0,
+		"KIND_SNAPSHOT":          1,
+		"KIND_CHUNK":             2,
+		"KIND_COMPACTION":        3,
+		"KIND_LEASES":            4,
+		"KIND_SNAPSHOT_MANIFEST": 5,
 	}
 )
 
@@ -128,6 +137,7 @@ type FileHeader struct {
 	RecordsCount  int64                  `protobuf:"varint,5,opt,name=records_count,json=recordsCount,proto3" json:"records_count,omitempty"`
 	LeaderId      string                 `protobuf:"bytes,6,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`
 	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	DictionaryId  uint32                 `protobuf:"varint,8,opt,name=dictionary_id,json=dictionaryId,proto3" json:"dictionary_id,omitempty"` // zstd dictionary used for records, 0 = none
 	Crc           uint64                 `protobuf:"varint,1,opt,name=crc,proto3" json:"crc,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -205,6 +215,13 @@ func (x *FileHeader) GetCreatedAt() *timestamppb.Timestamp {
 	return nil
 }
 
+func (x *FileHeader) GetDictionaryId() uint32 {
+	if x != nil {
+		return x.DictionaryId
+	}
+	return 0
+}
+
 func (x *FileHeader) GetCrc() uint64 {
 	if x != nil {
 		return x.Crc
@@ -284,7 +301,7 @@ var File_proto_file_proto protoreflect.FileDescriptor
 
 const file_proto_file_proto_rawDesc = "" +
 	"\n" +
-	"\x10proto/file.proto\x12\x05netsy\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa1\x02\n" +
+	"\x10proto/file.proto\x12\x05netsy\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc6\x02\n" +
 	"\n" +
 	"FileHeader\x12%\n" +
 	"\x0eschema_version\x18\x02 \x01(\rR\rschemaVersion\x12#\n" +
@@ -293,7 +310,8 @@ const file_proto_file_proto_rawDesc = "" +
 	"\rrecords_count\x18\x05 \x01(\x03R\frecordsCount\x12\x1b\n" +
 	"\tleader_id\x18\x06 \x01(\tR\bleaderId\x129\n" +
 	"\n" +
-	"created_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x10\n" +
+	"created_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12#\n" +
+	"\rdictionary_id\x18\b \x01(\rR\fdictionaryId\x12\x10\n" +
 	"\x03crc\x18\x01 \x01(\x04R\x03crc\"\x8b\x01\n" +
 	"\n" +
 	"FileFooter\x12\x1f\n" +
@@ -301,12 +319,15 @@ const file_proto_file_proto_rawDesc = "" +
 	"recordsCrc\x12%\n" +
 	"\x0efirst_revision\x18\x03 \x01(\x03R\rfirstRevision\x12#\n" +
 	"\rlast_revision\x18\x04 \x01(\x03R\flastRevision\x12\x10\n" +
-	"\x03crc\x18\b \x01(\x04R\x03crc*?\n" +
+	"\x03crc\x18\b \x01(\x04R\x03crc*\x81\x01\n" +
 	"\bFileKind\x12\x10\n" +
 	"\fKIND_UNKNOWN\x10\x00\x12\x11\n" +
 	"\rKIND_SNAPSHOT\x10\x01\x12\x0e\n" +
 	"\n" +
-	"KIND_CHUNK\x10\x02*V\n" +
+	"KIND_CHUNK\x10\x02\x12\x13\n" +
+	"\x0fKIND_COMPACTION\x10\x03\x12\x0f\n" +
+	"\vKIND_LEASES\x10\x04\x12\x1a\n" +
+	"\x16KIND_SNAPSHOT_MANIFEST\x10\x05*V\n" +
 	"\x0fFileCompression\x12\x17\n" +
 	"\x13COMPRESSION_UNKNOWN\x10\x00\x12\x14\n" +
 	"\x10COMPRESSION_NONE\x10\x01\x12\x14\n" +
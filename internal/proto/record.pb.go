@@ -22,6 +22,58 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type LeaseEntry_Event int32
+
+const (
+	LeaseEntry_EVENT_UNKNOWN LeaseEntry_Event = 0
+	LeaseEntry_EVENT_GRANTED LeaseEntry_Event = 1
+	LeaseEntry_EVENT_REVOKED LeaseEntry_Event = 2
+	LeaseEntry_EVENT_EXPIRED LeaseEntry_Event = 3
+)
+
+// Enum value maps for LeaseEntry_Event.
+var (
+	LeaseEntry_Event_name = map[int32]string{
+		0: "EVENT_UNKNOWN",
+		1: "EVENT_GRANTED",
+		2: "EVENT_REVOKED",
+		3: "EVENT_EXPIRED",
+	}
+	LeaseEntry_Event_value = map[string]int32{
+		"EVENT_UNKNOWN": 0,
+		"EVENT_GRANTED": 1,
+		"EVENT_REVOKED": 2,
+		"EVENT_EXPIRED": 3,
+	}
+)
+
+func (x LeaseEntry_Event) Enum() *LeaseEntry_Event {
+	p := new(LeaseEntry_Event)
+	*p = x
+	return p
+}
+
+func (x LeaseEntry_Event) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (LeaseEntry_Event) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_record_proto_enumTypes[0].Descriptor()
+}
+
+func (LeaseEntry_Event) Type() protoreflect.EnumType {
+	return &file_proto_record_proto_enumTypes[0]
+}
+
+func (x LeaseEntry_Event) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use LeaseEntry_Event.Descriptor instead.
+func (LeaseEntry_Event) EnumDescriptor() ([]byte, []int) {
+	return file_proto_record_proto_rawDescGZIP(), []int{1, 0}
+}
+
 type Record struct {
 	state          protoimpl.MessageState `protogen:"open.v1"`
 	Revision       int64                  `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"`
@@ -38,6 +90,8 @@ type Record struct {
 	CompactedAt    *timestamppb.Timestamp `protobuf:"bytes,13,opt,name=compacted_at,json=compactedAt,proto3" json:"compacted_at,omitempty"`
 	LeaderId       string                 `protobuf:"bytes,14,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`
 	ReplicatedAt   *timestamppb.Timestamp `protobuf:"bytes,15,opt,name=replicated_at,json=replicatedAt,proto3" json:"replicated_at,omitempty"`
+	LeaseEntry     *LeaseEntry            `protobuf:"bytes,17,opt,name=lease_entry,json=leaseEntry,proto3" json:"lease_entry,omitempty"`       // set in lease files only, which have no keys
+	SnapshotPart   *SnapshotPart          `protobuf:"bytes,18,opt,name=snapshot_part,json=snapshotPart,proto3" json:"snapshot_part,omitempty"` // set in snapshot manifests only, which have no keys
 	Crc            uint64                 `protobuf:"varint,1,opt,name=crc,proto3" json:"crc,omitempty"`
 	unknownFields  protoimpl.UnknownFields
 	sizeCache      protoimpl.SizeCache
@@ -171,6 +225,20 @@ func (x *Record) GetReplicatedAt() *timestamppb.Timestamp {
 	return nil
 }
 
+func (x *Record) GetLeaseEntry() *LeaseEntry {
+	if x != nil {
+		return x.LeaseEntry
+	}
+	return nil
+}
+
+func (x *Record) GetSnapshotPart() *SnapshotPart {
+	if x != nil {
+		return x.SnapshotPart
+	}
+	return nil
+}
+
 func (x *Record) GetCrc() uint64 {
 	if x != nil {
 		return x.Crc
@@ -178,11 +246,169 @@ func (x *Record) GetCrc() uint64 {
 	return 0
 }
 
+// LeaseEntry is a lease lifecycle event. Lease files contain an entry for
+// each lease which has been granted and not ended, and for each lease which
+// ended since the previous lease file was written.
+type LeaseEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         LeaseEntry_Event       `protobuf:"varint,1,opt,name=event,proto3,enum=netsy.LeaseEntry_Event" json:"event,omitempty"`
+	Id            int64                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	Ttl           int64                  `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"` // seconds
+	GrantedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=granted_at,json=grantedAt,proto3" json:"granted_at,omitempty"`
+	LastKeepalive *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=last_keepalive,json=lastKeepalive,proto3" json:"last_keepalive,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaseEntry) Reset() {
+	*x = LeaseEntry{}
+	mi := &file_proto_record_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaseEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaseEntry) ProtoMessage() {}
+
+func (x *LeaseEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_record_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaseEntry.ProtoReflect.Descriptor instead.
+func (*LeaseEntry) Descriptor() ([]byte, []int) {
+	return file_proto_record_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LeaseEntry) GetEvent() LeaseEntry_Event {
+	if x != nil {
+		return x.Event
+	}
+	return LeaseEntry_EVENT_UNKNOWN
+}
+
+func (x *LeaseEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *LeaseEntry) GetTtl() int64 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *LeaseEntry) GetGrantedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.GrantedAt
+	}
+	return nil
+}
+
+func (x *LeaseEntry) GetLastKeepalive() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastKeepalive
+	}
+	return nil
+}
+
+// SnapshotPart is a part of a multi-part snapshot. Each part is a snapshot
+// file holding consecutive records, and a snapshot manifest contains a
+// SnapshotPart for each, in revision order.
+type SnapshotPart struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"` // S3 key of the part, without the key prefix
+	FirstRevision int64                  `protobuf:"varint,2,opt,name=first_revision,json=firstRevision,proto3" json:"first_revision,omitempty"`
+	LastRevision  int64                  `protobuf:"varint,3,opt,name=last_revision,json=lastRevision,proto3" json:"last_revision,omitempty"`
+	RecordsCount  int64                  `protobuf:"varint,4,opt,name=records_count,json=recordsCount,proto3" json:"records_count,omitempty"`
+	Size          int64                  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"` // bytes
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SnapshotPart) Reset() {
+	*x = SnapshotPart{}
+	mi := &file_proto_record_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotPart) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotPart) ProtoMessage() {}
+
+func (x *SnapshotPart) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_record_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotPart.ProtoReflect.Descriptor instead.
+func (*SnapshotPart) Descriptor() ([]byte, []int) {
+	return file_proto_record_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SnapshotPart) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *SnapshotPart) GetFirstRevision() int64 {
+	if x != nil {
+		return x.FirstRevision
+	}
+	return 0
+}
+
+func (x *SnapshotPart) GetLastRevision() int64 {
+	if x != nil {
+		return x.LastRevision
+	}
+	return 0
+}
+
+func (x *SnapshotPart) GetRecordsCount() int64 {
+	if x != nil {
+		return x.RecordsCount
+	}
+	return 0
+}
+
+func (x *SnapshotPart) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
 var File_proto_record_proto protoreflect.FileDescriptor
 
 const file_proto_record_proto_rawDesc = "" +
 	"\n" +
-	"\x12proto/record.proto\x12\x05netsy\x1a\x1fgoogle/protobuf/timestamp.proto\"\xfa\x03\n" +
+	"\x12proto/record.proto\x12\x05netsy\x1a\x1fgoogle/protobuf/timestamp.proto\"\xee\x04\n" +
 	"\x06Record\x12\x1a\n" +
 	"\brevision\x18\x02 \x01(\x03R\brevision\x12\x10\n" +
 	"\x03key\x18\x03 \x01(\fR\x03key\x12\x18\n" +
@@ -199,8 +425,30 @@ const file_proto_record_proto_rawDesc = "" +
 	"created_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12=\n" +
 	"\fcompacted_at\x18\r \x01(\v2\x1a.google.protobuf.TimestampR\vcompactedAt\x12\x1b\n" +
 	"\tleader_id\x18\x0e \x01(\tR\bleaderId\x12?\n" +
-	"\rreplicated_at\x18\x0f \x01(\v2\x1a.google.protobuf.TimestampR\freplicatedAt\x12\x10\n" +
-	"\x03crc\x18\x01 \x01(\x04R\x03crcB-Z+github.com/nadrama-com/netsy/internal/protob\x06proto3"
+	"\rreplicated_at\x18\x0f \x01(\v2\x1a.google.protobuf.TimestampR\freplicatedAt\x122\n" +
+	"\vlease_entry\x18\x11 \x01(\v2\x11.netsy.LeaseEntryR\n" +
+	"leaseEntry\x128\n" +
+	"\rsnapshot_part\x18\x12 \x01(\v2\x13.netsy.SnapshotPartR\fsnapshotPart\x12\x10\n" +
+	"\x03crc\x18\x01 \x01(\x04R\x03crcJ\x04\b\x10\x10\x11\"\xb0\x02\n" +
+	"\n" +
+	"LeaseEntry\x12-\n" +
+	"\x05event\x18\x01 \x01(\x0e2\x17.netsy.LeaseEntry.EventR\x05event\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x03R\x02id\x12\x10\n" +
+	"\x03ttl\x18\x03 \x01(\x03R\x03ttl\x129\n" +
+	"\n" +
+	"granted_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tgrantedAt\x12A\n" +
+	"\x0elast_keepalive\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\rlastKeepalive\"S\n" +
+	"\x05Event\x12\x11\n" +
+	"\rEVENT_UNKNOWN\x10\x00\x12\x11\n" +
+	"\rEVENT_GRANTED\x10\x01\x12\x11\n" +
+	"\rEVENT_REVOKED\x10\x02\x12\x11\n" +
+	"\rEVENT_EXPIRED\x10\x03\"\xa5\x01\n" +
+	"\fSnapshotPart\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12%\n" +
+	"\x0efirst_revision\x18\x02 \x01(\x03R\rfirstRevision\x12#\n" +
+	"\rlast_revision\x18\x03 \x01(\x03R\flastRevision\x12#\n" +
+	"\rrecords_count\x18\x04 \x01(\x03R\frecordsCount\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04sizeB-Z+github.com/nadrama-com/netsy/internal/protob\x06proto3"
 
 var (
 	file_proto_record_proto_rawDescOnce sync.Once
@@ -214,20 +462,29 @@ func file_proto_record_proto_rawDescGZIP() []byte {
 	return file_proto_record_proto_rawDescData
 }
 
-var file_proto_record_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_record_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_record_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_proto_record_proto_goTypes = []any{
-	(*Record)(nil),                // 0: netsy.Record
-	(*timestamppb.Timestamp)(nil), // 1: google.protobuf.Timestamp
+	(LeaseEntry_Event)(0),         // 0: netsy.LeaseEntry.Event
+	(*Record)(nil),                // 1: netsy.Record
+	(*LeaseEntry)(nil),            // 2: netsy.LeaseEntry
+	(*SnapshotPart)(nil),          // 3: netsy.SnapshotPart
+	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
 }
 var file_proto_record_proto_depIdxs = []int32{
-	1, // 0: netsy.Record.created_at:type_name -> google.protobuf.Timestamp
-	1, // 1: netsy.Record.compacted_at:type_name -> google.protobuf.Timestamp
-	1, // 2: netsy.Record.replicated_at:type_name -> google.protobuf.Timestamp
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	4, // 0: netsy.Record.created_at:type_name -> google.protobuf.Timestamp
+	4, // 1: netsy.Record.compacted_at:type_name -> google.protobuf.Timestamp
+	4, // 2: netsy.Record.replicated_at:type_name -> google.protobuf.Timestamp
+	2, // 3: netsy.Record.lease_entry:type_name -> netsy.LeaseEntry
+	3, // 4: netsy.Record.snapshot_part:type_name -> netsy.SnapshotPart
+	0, // 5: netsy.LeaseEntry.event:type_name -> netsy.LeaseEntry.Event
+	4, // 6: netsy.LeaseEntry.granted_at:type_name -> google.protobuf.Timestamp
+	4, // 7: netsy.LeaseEntry.last_keepalive:type_name -> google.protobuf.Timestamp
+	8, // [8:8] is the sub-list for method output_type
+	8, // [8:8] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_proto_record_proto_init() }
@@ -240,13 +497,14 @@ func file_proto_record_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_record_proto_rawDesc), len(file_proto_record_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   1,
+			NumEnums:      1,
+			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_proto_record_proto_goTypes,
 		DependencyIndexes: file_proto_record_proto_depIdxs,
+		EnumInfos:         file_proto_record_proto_enumTypes,
 		MessageInfos:      file_proto_record_proto_msgTypes,
 	}.Build()
 	File_proto_record_proto = out.File
@@ -0,0 +1,74 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// Txn forwards a transaction to etcd, waiting for the revision of its
+// response to be replicated
+func (p *Proxy) Txn(ctx context.Context, r *pb.TxnRequest) (resp *pb.TxnResponse, err error) {
+	defer func() {
+		observe("txn", err)
+	}()
+	if resp, err = p.kv.Txn(ctx, r); err != nil {
+		return nil, err
+	}
+	if err = p.WaitForRevision(ctx, resp.Header.Revision); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// DeleteRange forwards a delete to etcd, waiting for the revision of its
+// response to be replicated
+func (p *Proxy) DeleteRange(ctx context.Context, r *pb.DeleteRangeRequest) (resp *pb.DeleteRangeResponse, err error) {
+	defer func() {
+		observe("delete_range", err)
+	}()
+	if resp, err = p.kv.DeleteRange(ctx, r); err != nil {
+		return nil, err
+	}
+	if err = p.WaitForRevision(ctx, resp.Header.Revision); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Compact forwards a compaction to etcd, waiting for the compacted revision
+// to be replicated, so that it can then be compacted locally
+func (p *Proxy) Compact(ctx context.Context, r *pb.CompactionRequest) (resp *pb.CompactionResponse, err error) {
+	defer func() {
+		observe("compact", err)
+	}()
+	if resp, err = p.kv.Compact(ctx, r); err != nil {
+		return nil, err
+	}
+	if err = p.WaitForRevision(ctx, r.Revision); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Lease returns a client of the etcd lease service, as leases are granted
+// by etcd, which ends them by deleting their keys
+func (p *Proxy) Lease() pb.LeaseClient {
+	return p.lease
+}
+
+// observe records the result of a forwarded request
+func observe(method string, err error) {
+	result := "success"
+	if errors.Is(err, ErrNotReplicated) {
+		result = "not_replicated"
+	} else if err != nil {
+		result = "error"
+	}
+	metrics.ProxyRequests.WithLabelValues(method, result).Inc()
+}
@@ -0,0 +1,416 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package proxy runs netsy as a read cache in front of an upstream etcd
+// cluster, as a stepping stone towards replacing etcd with netsy. The keys
+// of etcd are replicated into the local database with an etcd watch, so
+// that Range and Watch requests are served locally by the existing read and
+// watch paths, while writes and leases are forwarded to etcd.
+//
+// Local records have the revisions of etcd, so revisions returned by
+// forwarded writes can be read and watched from netsy. As netsy stores one
+// record per revision, etcd must only be written to by single-key writes
+// (as Kubernetes does): replication stops if a revision changes more than
+// one key.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/replication"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// pageSize is the number of keys read from etcd at a time when its keys
+	// are first replicated
+	pageSize = 1000
+	// retryInterval is how long to wait before restarting a watch which
+	// failed
+	retryInterval = time.Second
+)
+
+// ErrNotReplicated is returned when a forwarded write was not replicated to
+// the local database within the write wait timeout
+var ErrNotReplicated = errors.New("write not replicated from upstream etcd in time")
+
+// Distributor sends replicated records to watchers
+type Distributor interface {
+	Distribute(record *proto.Record, prevRecord *proto.Record)
+}
+
+// Proxy replicates the keys of an upstream etcd, and forwards writes to it
+type Proxy struct {
+	logger log.Logger
+	client *clientv3.Client
+	db     localdb.Database
+	kv     pb.KVClient
+	lease  pb.LeaseClient
+	// writeWaitTimeout bounds how long a forwarded write waits to be
+	// replicated
+	writeWaitTimeout time.Duration
+
+	// replicated is the latest revision replicated to the local database,
+	// and replicatedCh is closed and replaced each time it advances
+	mu           sync.Mutex
+	replicated   int64
+	replicatedCh chan struct{}
+
+	// errCh receives the error which stopped replication
+	errCh chan error
+
+	// Context for shutdown, cancelled by Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks the replication goroutine
+	wg sync.WaitGroup
+}
+
+// NewFromConfig creates a Proxy for the configured upstream etcd endpoints,
+// which replicates into db. It returns nil if no endpoints are configured.
+func NewFromConfig(logger log.Logger, c *config.Config, db localdb.Database) (*Proxy, error) {
+	if c.ProxyEtcdEndpoints() == "" {
+		return nil, nil
+	}
+	if c.S3Enabled() {
+		return nil, fmt.Errorf("proxy mode requires s3_enabled=false, as records are replicated from the upstream etcd")
+	} else if c.ShadowEtcdEndpoints() != "" {
+		return nil, fmt.Errorf("proxy mode cannot be used with shadow mode")
+	}
+	var endpoints []string
+	for _, endpoint := range strings.Split(c.ProxyEtcdEndpoints(), ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	tlsConfig, err := config.LoadEtcdClientTLS("upstream etcd", c.ProxyEtcdCA(), c.ProxyEtcdCert(), c.ProxyEtcdKey())
+	if err != nil {
+		return nil, err
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+		TLS:         tlsConfig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream etcd client: %w", err)
+	}
+	return New(logger, client, db, time.Duration(c.ProxyWriteWaitTimeoutMS())*time.Millisecond), nil
+}
+
+// New creates a Proxy which forwards writes with client and replicates its
+// keys into db. The Proxy owns client, which is closed by Stop.
+func New(logger log.Logger, client *clientv3.Client, db localdb.Database, writeWaitTimeout time.Duration) *Proxy {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Proxy{
+		logger:           logger,
+		client:           client,
+		db:               db,
+		kv:               pb.NewKVClient(client.ActiveConnection()),
+		lease:            pb.NewLeaseClient(client.ActiveConnection()),
+		writeWaitTimeout: writeWaitTimeout,
+		replicatedCh:     make(chan struct{}),
+		errCh:            make(chan error, 1),
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+}
+
+// Start replicates the keys of etcd if the local database is empty, then
+// starts replicating its changes, sending them to watchers with
+// distributor. It returns once the keys have been replicated, so must be
+// called before serving client requests.
+func (p *Proxy) Start(distributor Distributor) error {
+	revision, err := p.localRevision()
+	if err != nil {
+		return err
+	}
+	if revision == 0 {
+		start := time.Now()
+		if revision, err = p.sync(p.ctx); err != nil {
+			return fmt.Errorf("failed to replicate keys from upstream etcd: %w", err)
+		}
+		level.Info(p.logger).Log("msg", "replicated keys from upstream etcd", "rev", revision, "duration", time.Since(start))
+	}
+	p.advance(revision)
+	level.Info(p.logger).Log("msg", "proxying upstream etcd", "endpoints", strings.Join(p.client.Endpoints(), ","), "rev", revision)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.run(distributor)
+	}()
+	return nil
+}
+
+// Stop stops replicating, and closes the etcd client
+func (p *Proxy) Stop() {
+	p.cancel()
+	p.wg.Wait()
+	p.client.Close()
+}
+
+// Err returns a channel which receives the error which stopped replication,
+// after which reads are no longer updated, e.g. if etcd compacted revisions
+// before they were replicated
+func (p *Proxy) Err() <-chan error {
+	return p.errCh
+}
+
+// Revision returns the latest revision replicated to the local database
+func (p *Proxy) Revision() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.replicated
+}
+
+// WaitForRevision waits until revision has been replicated to the local
+// database, so that a client of a forwarded write reads its own write,
+// returning ErrNotReplicated after the write wait timeout
+func (p *Proxy) WaitForRevision(ctx context.Context, revision int64) error {
+	timeout := time.NewTimer(p.writeWaitTimeout)
+	defer timeout.Stop()
+	for {
+		p.mu.Lock()
+		replicated, replicatedCh := p.replicated, p.replicatedCh
+		p.mu.Unlock()
+		if replicated >= revision {
+			return nil
+		}
+		select {
+		case <-replicatedCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("%w: revision %d (replicated revision %d)", ErrNotReplicated, revision, replicated)
+		}
+	}
+}
+
+// advance sets the replicated revision, waking writes waiting for it
+func (p *Proxy) advance(revision int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if revision <= p.replicated {
+		return
+	}
+	p.replicated = revision
+	close(p.replicatedCh)
+	p.replicatedCh = make(chan struct{})
+	metrics.ProxyReplicatedRevision.Set(float64(revision))
+}
+
+// localRevision returns the latest revision in the local database,
+// including revisions recorded as gaps after the latest record
+func (p *Proxy) localRevision() (revision int64, err error) {
+	if revision, err = p.db.LatestRevision(); err != nil {
+		return 0, fmt.Errorf("failed to get latest revision: %w", err)
+	}
+	gaps, err := p.db.Gaps()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get gaps: %w", err)
+	}
+	if len(gaps) > 0 {
+		revision = max(revision, gaps[len(gaps)-1].LastRevision)
+	}
+	return revision, nil
+}
+
+// sync replicates the keys of etcd into an empty local database, at the
+// revision of the first page read. The history of keys is not replicated,
+// so revisions which are not the latest revision of a key are recorded as
+// gaps. The keys and gaps are written in a single transaction, so a sync
+// which is interrupted (e.g. by a restart) leaves the local database empty,
+// and is run again by the next Start. It returns the revision replicated.
+func (p *Proxy) sync(ctx context.Context) (revision int64, err error) {
+	tx, err := p.db.BeginTx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var revisions []int64
+	key := []byte{0}
+	for {
+		resp, err := p.client.Get(ctx, string(key),
+			clientv3.WithFromKey(),
+			clientv3.WithLimit(pageSize),
+			clientv3.WithRev(revision),
+			clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+		if err != nil {
+			return 0, err
+		}
+		if revision == 0 {
+			revision = resp.Header.Revision
+			replication.ObserveLeaderRevision(revision)
+		}
+		for _, kv := range resp.Kvs {
+			if _, err = p.db.ReplicateRecord(newRecord(kv, false, nil, resp.Header.MemberId), tx); err != nil {
+				return 0, fmt.Errorf("failed to replicate %s at revision %d: %w", keys.Quote(kv.Key), kv.ModRevision, err)
+			}
+			revisions = append(revisions, kv.ModRevision)
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			break
+		}
+		// the next page starts after the last key of this page
+		key = append(bytes.Clone(resp.Kvs[len(resp.Kvs)-1].Key), 0)
+	}
+
+	slices.Sort(revisions)
+	next := int64(1)
+	for _, rev := range append(revisions, revision+1) {
+		if rev > next {
+			if err = p.db.RecordGap(next, rev-1, localdb.GapReasonProxy, tx); err != nil {
+				return 0, err
+			}
+		}
+		next = rev + 1
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+// run replicates the changes of etcd until Stop is called, restarting the
+// watch if it fails. Replication stops if a change cannot be replicated.
+func (p *Proxy) run(distributor Distributor) {
+	for {
+		err := p.replicate(distributor)
+		if p.ctx.Err() != nil {
+			return
+		}
+		var fatal *fatalError
+		if errors.As(err, &fatal) {
+			level.Error(p.logger).Log("msg", "stopped replicating upstream etcd", "rev", p.Revision(), "err", err)
+			p.errCh <- err
+			return
+		}
+		metrics.ProxyWatchRestarts.Inc()
+		level.Warn(p.logger).Log("msg", "restarting upstream etcd watch", "rev", p.Revision(), "err", err)
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// fatalError is a replication error which restarting the watch does not
+// resolve
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fatalError) Unwrap() error {
+	return e.err
+}
+
+// replicate watches etcd from the revision after the latest revision
+// replicated, replicating each change and sending it to watchers, until the
+// watch fails
+func (p *Proxy) replicate(distributor Distributor) error {
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(p.ctx))
+	defer cancel()
+	watchCh := p.client.Watch(ctx, "\x00",
+		clientv3.WithFromKey(),
+		clientv3.WithRev(p.Revision()+1),
+		clientv3.WithProgressNotify())
+	for resp := range watchCh {
+		if resp.CompactRevision != 0 {
+			return &fatalError{fmt.Errorf("upstream etcd compacted revision %d before it was replicated, remove the local database to replicate its keys again", resp.CompactRevision)}
+		} else if err := resp.Err(); err != nil {
+			return err
+		}
+		metrics.ProxyUpstreamRevision.Set(float64(resp.Header.Revision))
+		replication.ObserveLeaderRevision(resp.Header.Revision)
+		if resp.IsProgressNotify() {
+			// every change up to the header revision has been sent
+			p.advance(resp.Header.Revision)
+			continue
+		}
+		for i, event := range resp.Events {
+			if i+1 < len(resp.Events) && resp.Events[i+1].Kv.ModRevision == event.Kv.ModRevision {
+				return &fatalError{fmt.Errorf("upstream etcd revision %d changed more than one key, which cannot be replicated", event.Kv.ModRevision)}
+			}
+			record, prevRecord, err := p.apply(event, resp.Header.MemberId)
+			if err != nil {
+				return &fatalError{err}
+			}
+			distributor.Distribute(record, prevRecord)
+			p.advance(record.Revision)
+		}
+	}
+	return p.ctx.Err()
+}
+
+// apply replicates an event to the local database, returning the record
+// and the key's previous record
+func (p *Proxy) apply(event *clientv3.Event, memberID uint64) (record *proto.Record, prevRecord *proto.Record, err error) {
+	prev, err := p.db.FindLatestRecords([][]byte{event.Kv.Key}, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find %s: %w", keys.Quote(event.Kv.Key), err)
+	}
+	if len(prev) > 0 {
+		prevRecord = prev[0]
+	}
+	record, err = p.db.ReplicateRecord(newRecord(event.Kv, event.Type == clientv3.EventTypeDelete, prevRecord, memberID), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to replicate %s at revision %d: %w", keys.Quote(event.Kv.Key), event.Kv.ModRevision, err)
+	}
+	if record.Created {
+		prevRecord = nil
+	}
+	return record, prevRecord, nil
+}
+
+// newRecord returns the record of an etcd key-value, where prevRecord is
+// the latest record of the key in the local database, if any
+func newRecord(kv *mvccpb.KeyValue, deleted bool, prevRecord *proto.Record, memberID uint64) *proto.Record {
+	record := &proto.Record{
+		Revision:  kv.ModRevision,
+		Key:       kv.Key,
+		LeaderId:  fmt.Sprintf("etcd-%x", memberID),
+		CreatedAt: timestamppb.Now(),
+	}
+	if prevRecord != nil {
+		record.PrevRevision = prevRecord.Revision
+	}
+	if deleted {
+		record.Deleted = true
+		if prevRecord != nil {
+			record.CreateRevision = prevRecord.CreateRevision
+		}
+		return record
+	}
+	record.Created = kv.CreateRevision == kv.ModRevision
+	if record.Created {
+		record.PrevRevision = 0
+	}
+	record.CreateRevision = kv.CreateRevision
+	record.Version = kv.Version
+	record.Lease = kv.Lease
+	record.Value = kv.Value
+	return record
+}
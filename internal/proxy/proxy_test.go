@@ -0,0 +1,107 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package proxy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/etcdtest"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/proto"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// testDistributor records the revisions distributed to watchers
+type testDistributor struct {
+	mu        sync.Mutex
+	revisions []int64
+}
+
+func (d *testDistributor) Distribute(record *proto.Record, prevRecord *proto.Record) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.revisions = append(d.revisions, record.Revision)
+}
+
+func TestProxy(t *testing.T) {
+	client := etcdtest.Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// revisions 2 to 4, of which revision 2 is overwritten
+	for _, key := range []string{"/registry/a", "/registry/b", "/registry/a"} {
+		if _, err := client.Put(ctx, key, "v1"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	db := localdbtest.New(t)
+
+	// the keys of etcd are replicated, with its earlier revisions as gaps
+	p := New(log.NewNopLogger(), client, db, 5*time.Second)
+	distributor := &testDistributor{}
+	if err := p.Start(distributor); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer p.Stop()
+	if p.Revision() != 4 {
+		t.Fatalf("expected revision 4 to be replicated, got %d", p.Revision())
+	}
+	if err := db.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+
+	// forwarded writes are replicated before they return
+	key := []byte("/registry/c")
+	txnResp, err := p.Txn(ctx, &pb.TxnRequest{
+		Compare: []*pb.Compare{{Key: key, Target: pb.Compare_MOD, Result: pb.Compare_EQUAL, TargetUnion: &pb.Compare_ModRevision{ModRevision: 0}}},
+		Success: []*pb.RequestOp{{Request: &pb.RequestOp_RequestPut{RequestPut: &pb.PutRequest{Key: key, Value: []byte("v1")}}}},
+	})
+	if err != nil || !txnResp.Succeeded || txnResp.Header.Revision != 5 {
+		t.Fatalf("expected create at revision 5, got %v (%v)", txnResp, err)
+	}
+	record, err := db.FindRecordByRev(5)
+	if err != nil || !record.Created || string(record.Key) != string(key) {
+		t.Fatalf("expected create to be replicated, got %v (%v)", record, err)
+	}
+
+	// writes made directly to etcd are replicated, and deletes refer to
+	// the key's previous record
+	if _, err = client.Put(ctx, "/registry/b", "v2"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	deleteResp, err := p.DeleteRange(ctx, &pb.DeleteRangeRequest{Key: []byte("/registry/b")})
+	if err != nil || deleteResp.Deleted != 1 {
+		t.Fatalf("expected delete, got %v (%v)", deleteResp, err)
+	}
+	record, err = db.FindRecordByRev(7)
+	if err != nil || !record.Deleted || record.PrevRevision != 6 || record.CreateRevision != 3 {
+		t.Fatalf("expected delete of revision 6 to be replicated, got %v (%v)", record, err)
+	}
+	if err = db.VerifyIntegrity(); err != nil {
+		t.Fatalf("VerifyIntegrity: %v", err)
+	}
+	distributor.mu.Lock()
+	if len(distributor.revisions) != 3 {
+		t.Fatalf("expected revisions 5 to 7 to be distributed, got %v", distributor.revisions)
+	}
+	distributor.mu.Unlock()
+
+	// replication stops at a revision which changes more than one key
+	_, err = client.Txn(ctx).Then(clientv3.OpPut("/registry/d", "v1"), clientv3.OpPut("/registry/e", "v1")).Commit()
+	if err != nil {
+		t.Fatalf("Txn: %v", err)
+	}
+	select {
+	case err = <-p.Err():
+	case <-ctx.Done():
+		t.Fatalf("expected replication to stop")
+	}
+	if p.Revision() != 7 {
+		t.Fatalf("expected replication to stop at revision 7, got %d", p.Revision())
+	}
+}
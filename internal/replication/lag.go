@@ -0,0 +1,129 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package replication tracks how far this server's local db is behind the
+// leader, comparing the latest revision known to have been written by the
+// leader with the latest revision replicated and applied locally. It is
+// reported via metrics and the Admin GetStatus API.
+package replication
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+	"github.com/nadrama-com/netsy/internal/proto"
+)
+
+// Lag is a point-in-time view of replication lag
+type Lag struct {
+	// LeaderRevision is the latest revision known to have been written by
+	// the leader
+	LeaderRevision int64
+	// AppliedRevision is the latest revision replicated and applied locally
+	AppliedRevision int64
+	// Records is the number of revisions the local db is behind the leader
+	Records int64
+	// Duration is how long ago the leader wrote the latest applied revision,
+	// or zero when caught up
+	Duration time.Duration
+}
+
+// String returns a human readable summary, e.g. for logs
+func (l Lag) String() string {
+	return fmt.Sprintf("replication lag: %d records (%s) behind leader revision %d, applied revision %d",
+		l.Records, l.Duration.Round(time.Millisecond), l.LeaderRevision, l.AppliedRevision)
+}
+
+// Tracker tracks replication lag
+type Tracker struct {
+	mutex           sync.Mutex
+	now             func() time.Time
+	leaderRevision  int64
+	appliedRevision int64
+	// appliedAt is when the leader wrote the latest applied revision
+	appliedAt time.Time
+}
+
+// NewTracker returns a new replication lag tracker
+func NewTracker() *Tracker {
+	return &Tracker{now: time.Now}
+}
+
+// ObserveLeaderRevision records that the leader has written up to revision
+func (t *Tracker) ObserveLeaderRevision(revision int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.leaderRevision = max(t.leaderRevision, revision)
+}
+
+// ObserveApplied records that a record replicated from the leader has been
+// applied locally
+func (t *Tracker) ObserveApplied(record *proto.Record) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if record.Revision < t.appliedRevision {
+		return
+	}
+	t.appliedRevision = record.Revision
+	t.appliedAt = time.Time{}
+	if record.CreatedAt != nil {
+		t.appliedAt = record.CreatedAt.AsTime()
+	}
+	// the leader has written at least the applied revision
+	t.leaderRevision = max(t.leaderRevision, record.Revision)
+}
+
+// Lag returns the current replication lag. It returns false if no leader
+// revision has been observed, i.e. this server has not replicated from a
+// leader.
+func (t *Tracker) Lag() (Lag, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.leaderRevision == 0 {
+		return Lag{}, false
+	}
+	lag := Lag{
+		LeaderRevision:  t.leaderRevision,
+		AppliedRevision: t.appliedRevision,
+		Records:         max(t.leaderRevision-t.appliedRevision, 0),
+	}
+	if lag.Records > 0 && !t.appliedAt.IsZero() {
+		lag.Duration = max(t.now().Sub(t.appliedAt), 0)
+	}
+	return lag, true
+}
+
+// defaultTracker tracks replication lag for this server
+var defaultTracker = NewTracker()
+
+// ObserveLeaderRevision records that the leader has written up to revision
+func ObserveLeaderRevision(revision int64) {
+	defaultTracker.ObserveLeaderRevision(revision)
+}
+
+// ObserveApplied records that a record replicated from the leader has been
+// applied locally
+func ObserveApplied(record *proto.Record) {
+	defaultTracker.ObserveApplied(record)
+}
+
+// Current returns the current replication lag of this server, and false if
+// it has not replicated from a leader
+func Current() (Lag, bool) {
+	return defaultTracker.Lag()
+}
+
+// RegisterMetrics registers the replication lag metrics
+func RegisterMetrics() {
+	metrics.RegisterReplicationLag(func() (metrics.ReplicationLag, bool) {
+		lag, ok := Current()
+		return metrics.ReplicationLag{
+			LeaderRevision:  lag.LeaderRevision,
+			AppliedRevision: lag.AppliedRevision,
+			LagRecords:      lag.Records,
+			LagSeconds:      lag.Duration.Seconds(),
+		}, ok
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package replication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestTrackerLag(t *testing.T) {
+	now := time.Now()
+	tracker := NewTracker()
+	tracker.now = func() time.Time { return now }
+
+	if _, ok := tracker.Lag(); ok {
+		t.Fatalf("expected no lag before a leader revision is observed")
+	}
+
+	tracker.ObserveLeaderRevision(10)
+	tracker.ObserveApplied(&proto.Record{Revision: 4, CreatedAt: timestamppb.New(now.Add(-time.Minute))})
+	lag, ok := tracker.Lag()
+	if !ok {
+		t.Fatalf("expected lag once a leader revision is observed")
+	}
+	if lag.LeaderRevision != 10 || lag.AppliedRevision != 4 || lag.Records != 6 || lag.Duration != time.Minute {
+		t.Fatalf("unexpected lag %+v", lag)
+	}
+
+	// an earlier leader revision does not reduce the leader revision
+	tracker.ObserveLeaderRevision(8)
+	tracker.ObserveApplied(&proto.Record{Revision: 10, CreatedAt: timestamppb.New(now.Add(-time.Second))})
+	lag, _ = tracker.Lag()
+	if lag.LeaderRevision != 10 || lag.AppliedRevision != 10 || lag.Records != 0 || lag.Duration != 0 {
+		t.Fatalf("expected no lag once caught up, got %+v", lag)
+	}
+
+	// applying beyond the known leader revision advances it
+	tracker.ObserveApplied(&proto.Record{Revision: 12})
+	if lag, _ = tracker.Lag(); lag.LeaderRevision != 12 || lag.Records != 0 {
+		t.Fatalf("unexpected lag %+v", lag)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package retention deletes chunk files from S3 once they are covered by a
+// snapshot. It runs separately from snapshot creation, on its own schedule
+// and with a grace period, so that restores which started from an earlier
+// snapshot can still read the chunks they need. It also deletes the parts of
+// multi-part snapshots whose upload never completed.
+package retention
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+// Worker periodically deletes chunk files covered by a snapshot which is
+// older than the grace period
+type Worker struct {
+	logger   log.Logger
+	config   *config.Config
+	s3Client *s3client.S3Client
+	now      func() time.Time
+
+	// Context for shutdown, cancelled by Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks the worker goroutine
+	wg sync.WaitGroup
+}
+
+// NewWorker creates a new chunk retention worker
+func NewWorker(logger log.Logger, config *config.Config, s3Client *s3client.S3Client) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{
+		logger:   logger,
+		config:   config,
+		s3Client: s3Client,
+		now:      time.Now,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start begins the retention worker goroutine, unless it is disabled
+func (w *Worker) Start() {
+	interval := w.config.ChunkRetentionIntervalMinutes()
+	if interval <= 0 {
+		level.Info(w.logger).Log("msg", "chunk retention disabled")
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run(time.Duration(interval) * time.Minute)
+	}()
+}
+
+// Stop shuts down the retention worker, aborting any in-flight cleanup.
+// Chunks which were not deleted are cleaned up by a later run.
+func (w *Worker) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+// run is the main worker loop
+func (w *Worker) run(interval time.Duration) {
+	level.Info(w.logger).Log("msg", "chunk retention worker started", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			level.Info(w.logger).Log("msg", "chunk retention worker stopping")
+			return
+		case <-ticker.C:
+			w.cleanup()
+			w.cleanupSnapshotParts()
+		}
+	}
+}
+
+// cleanup deletes chunk files covered by the newest snapshot which is older
+// than the grace period
+func (w *Worker) cleanup() {
+	snapshots, err := w.s3Client.ListSnapshots(w.ctx)
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to list snapshots for chunk retention", "error", err)
+		return
+	}
+	grace := time.Duration(w.config.ChunkRetentionGraceHours()) * time.Hour
+	upToRevision := cleanupRevision(snapshots, w.now(), grace)
+	if upToRevision == 0 {
+		level.Debug(w.logger).Log("msg", "no snapshot older than grace period, skipping chunk retention", "grace", grace)
+		return
+	}
+
+	// List all chunk files that are covered by the snapshot (revision <= upToRevision)
+	chunks, err := w.s3Client.ListChunksForCleanup(w.ctx, upToRevision)
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to list chunks for cleanup", "error", err)
+		return
+	}
+	if len(chunks) == 0 {
+		return
+	}
+	level.Info(w.logger).Log("msg", "starting chunk file cleanup", "up_to_revision", upToRevision, "chunks", len(chunks))
+
+	deletedCount := 0
+	for _, chunk := range chunks {
+		// Remaining chunks are cleaned up by the next run
+		if w.ctx.Err() != nil {
+			level.Warn(w.logger).Log("msg", "chunk file cleanup cancelled", "deleted_chunks", deletedCount)
+			return
+		}
+		err := w.s3Client.DeleteFile(w.ctx, chunk.Key)
+		if err != nil {
+			level.Warn(w.logger).Log("msg", "failed to delete chunk file", "key", chunk.Key, "error", err)
+			continue
+		}
+		deletedCount++
+		level.Debug(w.logger).Log("msg", "deleted chunk file", "key", chunk.Key, "revision", chunk.Revision)
+	}
+
+	level.Info(w.logger).Log("msg", "chunk file cleanup completed",
+		"up_to_revision", upToRevision, "deleted_chunks", deletedCount)
+}
+
+// cleanupSnapshotParts deletes the parts of multi-part snapshots which have
+// no manifest, as their upload failed, once they are older than the grace
+// period, so that snapshots which are still uploading are not affected
+func (w *Worker) cleanupSnapshotParts() {
+	grace := time.Duration(w.config.ChunkRetentionGraceHours()) * time.Hour
+	parts, err := w.s3Client.ListOrphanedSnapshotParts(w.ctx, w.now().Add(-grace))
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to list orphaned snapshot parts", "error", err)
+		return
+	}
+	deletedCount := 0
+	for _, part := range parts {
+		// Remaining parts are cleaned up by the next run
+		if w.ctx.Err() != nil {
+			break
+		}
+		if err := w.s3Client.DeleteFile(w.ctx, part.Key); err != nil {
+			level.Warn(w.logger).Log("msg", "failed to delete orphaned snapshot part", "key", part.Key, "error", err)
+			continue
+		}
+		deletedCount++
+	}
+	if len(parts) > 0 {
+		level.Info(w.logger).Log("msg", "orphaned snapshot part cleanup completed", "deleted_parts", deletedCount, "parts", len(parts))
+	}
+}
+
+// cleanupRevision returns the revision of the newest snapshot created at
+// least grace before now, or 0 if there is none. Chunk files up to this
+// revision are no longer needed, as restores use that snapshot or a newer one.
+func cleanupRevision(snapshots []s3client.FileInfo, now time.Time, grace time.Duration) int64 {
+	var revision int64
+	for _, snapshot := range snapshots {
+		if snapshot.LastModified.IsZero() || now.Sub(snapshot.LastModified) < grace {
+			continue
+		}
+		if snapshot.Revision > revision {
+			revision = snapshot.Revision
+		}
+	}
+	return revision
+}
@@ -0,0 +1,39 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+func TestCleanupRevision(t *testing.T) {
+	now := time.Now()
+	snapshots := []s3client.FileInfo{
+		{Revision: 300, LastModified: now.Add(-10 * time.Minute)},
+		{Revision: 200, LastModified: now.Add(-2 * time.Hour)},
+		{Revision: 100, LastModified: now.Add(-5 * time.Hour)},
+		{Revision: 400}, // unknown creation time
+	}
+
+	tests := []struct {
+		name     string
+		grace    time.Duration
+		expected int64
+	}{
+		{"no grace", 0, 300},
+		{"within grace of newest", time.Hour, 200},
+		{"within grace of all but oldest", 3 * time.Hour, 100},
+		{"within grace of all", 6 * time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if revision := cleanupRevision(snapshots, now, tt.grace); revision != tt.expected {
+				t.Errorf("cleanupRevision() = %d, want %d", revision, tt.expected)
+			}
+		})
+	}
+}
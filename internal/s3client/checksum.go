@@ -0,0 +1,71 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nadrama-com/netsy/internal/metrics"
+)
+
+// ErrChecksumMismatch is returned when a file downloaded from S3 does not
+// match the SHA-256 hash it was uploaded with, i.e. it was corrupted in
+// transit
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// sha256Hex returns the hex encoded SHA-256 hash of data
+func sha256Hex(data io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, data); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checksumSHA256 returns a hex encoded SHA-256 hash (as in ObjectMetadata)
+// as the base64 encoded value of the x-amz-checksum-sha256 header, so that
+// S3 rejects an upload which does not match it
+func checksumSHA256(hexHash string) (string, error) {
+	hash, err := hex.DecodeString(hexHash)
+	if err != nil {
+		return "", fmt.Errorf("invalid SHA-256 hash %q: %w", hexHash, err)
+	}
+	return base64.StdEncoding.EncodeToString(hash), nil
+}
+
+// checksumHeader returns the x-amz-checksum-sha256 header for a file with
+// the given hex encoded SHA-256 hash, or nil if checksums are disabled
+func (s *S3Client) checksumHeader(hexHash string) (*string, error) {
+	if !s.config.S3Checksums() {
+		return nil, nil
+	}
+	checksum, err := checksumSHA256(hexHash)
+	if err != nil {
+		return nil, err
+	}
+	return &checksum, nil
+}
+
+// verifySHA256 checks that data has the hex encoded SHA-256 hash expected,
+// returning ErrChecksumMismatch if not. Files uploaded without a hash (i.e.
+// expected is empty) are not verified.
+func verifySHA256(key string, data io.Reader, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	actual, err := sha256Hex(data)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		metrics.DatafileChecksumMismatches.Inc()
+		return fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksumMismatch, key, actual, expected)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChecksumSHA256(t *testing.T) {
+	const hash = "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+	checksum, err := checksumSHA256(hash)
+	if err != nil {
+		t.Fatalf("checksumSHA256: %v", err)
+	}
+	if expected := "Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc="; checksum != expected {
+		t.Fatalf("expected checksum %s, got %s", expected, checksum)
+	}
+	if _, err = checksumSHA256("not hex"); err == nil {
+		t.Fatal("expected error for invalid hash")
+	}
+
+	if err = verifySHA256("key", bytes.NewReader([]byte("data")), hash); err != nil {
+		t.Fatalf("verifySHA256: %v", err)
+	}
+	if err = verifySHA256("key", bytes.NewReader([]byte("dat4")), hash); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	// files uploaded without a hash are not verified
+	if err = verifySHA256("key", bytes.NewReader([]byte("dat4")), ""); err != nil {
+		t.Fatalf("expected file without a hash not to be verified, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/objectstore"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Compaction is a compaction recorded in S3
+type Compaction struct {
+	Revision    int64
+	CompactedAt time.Time
+}
+
+// compactionKey returns the S3 key (without prefix) for a compaction marker
+// Format: compactions/{zero-padded-revision}.netsy
+func compactionKey(revision int64) string {
+	return fmt.Sprintf("compactions/%019d.netsy", revision)
+}
+
+// WriteCompaction records a compaction to S3 as a compaction marker file,
+// containing a single record with the compaction revision and time. As each
+// compaction includes all earlier compactions, older markers are deleted.
+func (s *S3Client) WriteCompaction(ctx context.Context, compaction Compaction) error {
+	buffer := &bytes.Buffer{}
+	bufWriter := bufio.NewWriter(buffer)
+	writer, err := datafile.NewWriter(bufWriter, pb.FileKind_KIND_COMPACTION, 1, s.config.InstanceID())
+	if err != nil {
+		return fmt.Errorf("failed to create datafile writer: %w", err)
+	}
+	err = writer.Write(&pb.Record{
+		Revision:    compaction.Revision,
+		CompactedAt: timestamppb.New(compaction.CompactedAt),
+		LeaderId:    s.config.InstanceID(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write compaction record: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to close datafile writer: %w", err)
+	}
+
+	// Compacting to the same revision again is harmless, so overwrite
+	key := compactionKey(compaction.Revision)
+	_, err = s.putChunkFile(ctx, key, bytes.NewReader(buffer.Bytes()), pb.FileKind_KIND_COMPACTION,
+		RevisionRange{First: compaction.Revision, Last: compaction.Revision, Count: 1}, objectstore.Condition{})
+	if err != nil {
+		return fmt.Errorf("failed to upload compaction marker: %w", err)
+	}
+
+	// Remove markers for earlier compactions
+	compactions, err := s.listRevisionFiles(ctx, "compactions/")
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "failed to list compaction markers for cleanup", "error", err)
+		return nil
+	}
+	for _, marker := range compactions {
+		if marker.Revision >= compaction.Revision {
+			continue
+		}
+		if err = s.DeleteFile(ctx, marker.Key); err != nil {
+			level.Warn(s.logger).Log("msg", "failed to delete compaction marker", "key", marker.Key, "error", err)
+		}
+	}
+
+	level.Debug(s.logger).Log("msg", "compaction written to S3", "revision", compaction.Revision, "key", key)
+	return nil
+}
+
+// LatestCompaction returns the most recent compaction recorded in S3, or nil
+// if there is none
+func (s *S3Client) LatestCompaction(ctx context.Context) (*Compaction, error) {
+	compactions, err := s.listRevisionFiles(ctx, "compactions/")
+	if err != nil {
+		return nil, err
+	}
+	if len(compactions) == 0 {
+		return nil, nil
+	}
+	latest := compactions[0]
+
+	body, err := s.downloadSmallFile(ctx, latest.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download compaction marker: %w", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compaction marker: %w", err)
+	}
+
+	expectedKind := pb.FileKind_KIND_COMPACTION
+	reader, err := datafile.NewReader(bufio.NewReader(bytes.NewReader(data)), &expectedKind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create datafile reader: %w", err)
+	}
+	defer reader.Release()
+	record, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compaction record: %w", err)
+	}
+	if _, err = reader.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close datafile reader: %w", err)
+	}
+	if record.Revision != latest.Revision || record.CompactedAt == nil {
+		return nil, fmt.Errorf("invalid compaction marker %s", latest.Key)
+	}
+
+	return &Compaction{
+		Revision:    record.Revision,
+		CompactedAt: record.CompactedAt.AsTime(),
+	}, nil
+}
+
+// listRevisionFiles returns the files in dir which are named by revision,
+// e.g. compaction markers, sorted by revision (newest first)
+func (s *S3Client) listRevisionFiles(ctx context.Context, dir string) ([]FileInfo, error) {
+	prefix := s.objectKey(dir)
+	bucketName := s.config.S3BucketName()
+	input := &s3.ListObjectsV2Input{
+		Bucket: &bucketName,
+		Prefix: &prefix,
+	}
+
+	var files []FileInfo
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s objects: %w", dir, err)
+		}
+
+		for _, obj := range output.Contents {
+			// Extract revision from filename: {dir}/{revision}.netsy
+			keyParts := strings.Split(*obj.Key, "/")
+			filename := keyParts[len(keyParts)-1]
+			if !strings.HasSuffix(filename, ".netsy") {
+				continue
+			}
+			revision, err := strconv.ParseInt(strings.TrimSuffix(filename, ".netsy"), 10, 64)
+			if err != nil {
+				level.Debug(s.logger).Log("msg", "skipping invalid filename", "dir", dir, "filename", filename)
+				continue
+			}
+			files = append(files, FileInfo{
+				Key:      *obj.Key,
+				Size:     *obj.Size,
+				Revision: revision,
+			})
+		}
+	}
+
+	// Sort by revision (newest first)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Revision > files[j].Revision
+	})
+
+	return files, nil
+}
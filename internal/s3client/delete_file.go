@@ -14,10 +14,7 @@ import (
 // DeleteFile deletes a file from S3
 func (s *S3Client) DeleteFile(ctx context.Context, key string) error {
 	// Prepare S3 key with prefix
-	s3Key := key
-	if s.config.S3KeyPrefix() != "" {
-		s3Key = s.config.S3KeyPrefix() + "/" + key
-	}
+	s3Key := s.objectKey(key)
 
 	// Prepare delete object input
 	bucketName := s.config.S3BucketName()
@@ -0,0 +1,135 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/objectstore"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+// dictionaryKey returns the S3 key (without prefix) for a dictionary
+// Format: dictionaries/{zero-padded-id}.zdict
+func dictionaryKey(id uint32) string {
+	return fmt.Sprintf("dictionaries/%010d.zdict", id)
+}
+
+// UploadDictionary uploads a dictionary to S3 and makes it the dictionary
+// used to compress single record chunks
+func (s *S3Client) UploadDictionary(ctx context.Context, dictionary *datafile.Dictionary) error {
+	// Dictionaries are immutable once uploaded, as chunks reference them by ID
+	_, err := s.putChunkFile(ctx, dictionaryKey(dictionary.ID), bytes.NewReader(dictionary.Data), pb.FileKind_KIND_UNKNOWN, RevisionRange{}, objectstore.IfNotExists())
+	if err != nil {
+		return fmt.Errorf("failed to upload dictionary %d: %w", dictionary.ID, err)
+	}
+	s.SetDictionary(dictionary)
+	return nil
+}
+
+// SetDictionary sets the dictionary used to compress single record chunks
+func (s *S3Client) SetDictionary(dictionary *datafile.Dictionary) {
+	s.dictionaryMutex.Lock()
+	defer s.dictionaryMutex.Unlock()
+	s.dictionary = dictionary
+	if dictionary != nil {
+		s.dictionaries[dictionary.ID] = dictionary
+	}
+}
+
+// Dictionary returns the dictionary used to compress single record chunks,
+// or nil if there is none
+func (s *S3Client) Dictionary() *datafile.Dictionary {
+	s.dictionaryMutex.RLock()
+	defer s.dictionaryMutex.RUnlock()
+	return s.dictionary
+}
+
+// DictionaryLoader returns a datafile.DictionaryLoader which downloads
+// dictionaries from S3, caching them for subsequent reads
+func (s *S3Client) DictionaryLoader(ctx context.Context) datafile.DictionaryLoader {
+	return func(id uint32) (*datafile.Dictionary, error) {
+		s.dictionaryMutex.RLock()
+		dictionary, ok := s.dictionaries[id]
+		s.dictionaryMutex.RUnlock()
+		if ok {
+			return dictionary, nil
+		}
+
+		dictionary, err := s.downloadDictionary(ctx, dictionaryKey(id))
+		if err != nil {
+			return nil, err
+		}
+		if dictionary.ID != id {
+			return nil, fmt.Errorf("dictionary ID %d mismatch - expected %d", dictionary.ID, id)
+		}
+
+		s.dictionaryMutex.Lock()
+		s.dictionaries[id] = dictionary
+		s.dictionaryMutex.Unlock()
+		return dictionary, nil
+	}
+}
+
+// LoadLatestDictionary finds the most recently uploaded dictionary in S3 and
+// makes it the dictionary used to compress single record chunks. It does
+// nothing if no dictionary has been uploaded.
+func (s *S3Client) LoadLatestDictionary(ctx context.Context) error {
+	prefix := s.objectKey("dictionaries/")
+	bucketName := s.config.S3BucketName()
+	input := &s3.ListObjectsV2Input{
+		Bucket: &bucketName,
+		Prefix: &prefix,
+	}
+
+	var latestKey string
+	var latestModified int64
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list dictionary objects: %w", err)
+		}
+		for _, obj := range output.Contents {
+			if obj.LastModified == nil {
+				continue
+			}
+			if modified := obj.LastModified.UnixNano(); latestKey == "" || modified > latestModified {
+				latestKey = *obj.Key
+				latestModified = modified
+			}
+		}
+	}
+	if latestKey == "" {
+		return nil
+	}
+
+	dictionary, err := s.downloadDictionary(ctx, latestKey)
+	if err != nil {
+		return err
+	}
+	s.SetDictionary(dictionary)
+	level.Info(s.logger).Log("msg", "loaded chunk dictionary", "id", dictionary.ID, "key", latestKey)
+	return nil
+}
+
+// downloadDictionary downloads and parses the dictionary at key
+func (s *S3Client) downloadDictionary(ctx context.Context, key string) (*datafile.Dictionary, error) {
+	body, err := s.downloadSmallFile(ctx, s.objectKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download dictionary: %w", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary: %w", err)
+	}
+	return datafile.ParseDictionary(data)
+}
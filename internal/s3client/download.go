@@ -4,6 +4,7 @@
 package s3client
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -13,23 +14,51 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/go-kit/log/level"
 )
 
 // DownloadFile downloads a file from S3, automatically choosing the best strategy based on size
-// Returns a reader that should be closed by the caller
-func (s *S3Client) DownloadFile(ctx context.Context, key string, size int64, dataDir string, tempFiles *[]string) (io.ReadCloser, error) {
+// Returns a reader that should be closed by the caller, and the file's
+// metadata, which is nil if it has no valid netsy metadata
+func (s *S3Client) DownloadFile(ctx context.Context, key string, size int64, dataDir string, tempFiles *[]string) (io.ReadCloser, *ObjectMetadata, error) {
 	const maxMemorySize = 2 * 1024 * 1024 // 2MB
 
+	var body io.ReadCloser
+	var metadata map[string]string
+	var err error
 	if size > maxMemorySize {
-		return s.downloadLargeFile(ctx, key, size, dataDir, tempFiles)
+		body, metadata, err = s.downloadLargeFile(ctx, key, size, dataDir, tempFiles)
 	} else {
-		return s.downloadSmallFile(ctx, key)
+		body, metadata, err = s.getSmallFile(ctx, key)
 	}
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok, err := parseObjectMetadata(metadata)
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "ignoring invalid file metadata", "key", key, "error", err)
+		return body, nil, nil
+	}
+	if !ok {
+		return body, nil, nil
+	}
+	return body, &m, nil
 }
 
-// downloadSmallFile downloads small files to memory with retry logic
+// downloadSmallFile downloads small files to memory with retry logic. If
+// checksums are enabled, the file is verified against the checksum it was
+// uploaded with as it is read, and against the SHA-256 hash in its metadata
+// (which is the same hash, but is also recorded for files uploaded without
+// a checksum), and downloaded again if it does not match.
 func (s *S3Client) downloadSmallFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, _, err := s.getSmallFile(ctx, key)
+	return body, err
+}
+
+// getSmallFile downloads a small file like downloadSmallFile, also returning
+// its S3 user metadata
+func (s *S3Client) getSmallFile(ctx context.Context, key string) (io.ReadCloser, map[string]string, error) {
 	level.Debug(s.logger).Log("msg", "downloading small file to memory", "key", key)
 
 	bucketName := s.config.S3BucketName()
@@ -37,6 +66,10 @@ func (s *S3Client) downloadSmallFile(ctx context.Context, key string) (io.ReadCl
 		Bucket: &bucketName,
 		Key:    &key,
 	}
+	checksums := s.config.S3Checksums()
+	if checksums {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
 
 	var lastErr error
 	maxRetries := 3
@@ -57,15 +90,30 @@ func (s *S3Client) downloadSmallFile(ctx context.Context, key string) (io.ReadCl
 			continue
 		}
 
+		if !checksums {
+			level.Debug(s.logger).Log("msg", "small file download succeeded", "key", key, "attempt", attempt+1)
+			return output.Body, output.Metadata, nil
+		}
+		data, err := io.ReadAll(output.Body)
+		output.Body.Close()
+		if err == nil {
+			err = verifySHA256(key, bytes.NewReader(data), output.Metadata[metadataSHA256])
+		}
+		if err != nil {
+			lastErr = err
+			level.Warn(s.logger).Log("msg", "small file download attempt could not be verified", "key", key, "attempt", attempt+1, "error", err)
+			continue
+		}
+
 		level.Debug(s.logger).Log("msg", "small file download succeeded", "key", key, "attempt", attempt+1)
-		return output.Body, nil
+		return io.NopCloser(bytes.NewReader(data)), output.Metadata, nil
 	}
 
-	return nil, fmt.Errorf("failed to download small file after %d attempts: %w", maxRetries, lastErr)
+	return nil, nil, fmt.Errorf("failed to download small file after %d attempts: %w", maxRetries, lastErr)
 }
 
 // downloadLargeFile downloads large files to disk with multipart support
-func (s *S3Client) downloadLargeFile(ctx context.Context, key string, size int64, dataDir string, tempFiles *[]string) (io.ReadCloser, error) {
+func (s *S3Client) downloadLargeFile(ctx context.Context, key string, size int64, dataDir string, tempFiles *[]string) (io.ReadCloser, map[string]string, error) {
 	level.Debug(s.logger).Log("msg", "downloading large file to disk", "key", key, "size", size)
 
 	// Determine file prefix based on key
@@ -79,7 +127,7 @@ func (s *S3Client) downloadLargeFile(ctx context.Context, key string, size int64
 	// Create temporary file
 	tempFile, err := os.CreateTemp(dataDir, prefix+"*.netsy")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		return nil, nil, fmt.Errorf("failed to create temporary file: %w", err)
 	}
 	tempPath := tempFile.Name()
 	*tempFiles = append(*tempFiles, tempPath)
@@ -94,13 +142,32 @@ func (s *S3Client) downloadLargeFile(ctx context.Context, key string, size int64
 	})
 
 	bucketName := s.config.S3BucketName()
-	_, err = downloader.Download(ctx, tempFile, &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
+		Bucket: &bucketName,
+		Key:    &key,
+	}
+	// Ranged downloads do not return the file's metadata, so it is read
+	// first, downloading the version it describes in case the file is
+	// replaced meanwhile. S3 does not return checksums of ranged downloads
+	// either, so the file is verified against the SHA-256 hash in its
+	// metadata instead.
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: &bucketName,
 		Key:    &key,
 	})
 	if err != nil {
 		tempFile.Close()
-		return nil, fmt.Errorf("failed to download large file from S3: %w", err)
+		return nil, nil, fmt.Errorf("failed to head %s: %w", key, err)
+	}
+	input.IfMatch = head.ETag
+	var expectedSHA256 string
+	if s.config.S3Checksums() {
+		expectedSHA256 = head.Metadata[metadataSHA256]
+	}
+	_, err = downloader.Download(ctx, tempFile, input)
+	if err != nil {
+		tempFile.Close()
+		return nil, nil, fmt.Errorf("failed to download large file from S3: %w", err)
 	}
 
 	// Close and reopen file for reading
@@ -108,9 +175,17 @@ func (s *S3Client) downloadLargeFile(ctx context.Context, key string, size int64
 
 	readFile, err := os.Open(tempPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to reopen downloaded file: %w", err)
+		return nil, nil, fmt.Errorf("failed to reopen downloaded file: %w", err)
+	}
+	if err = verifySHA256(key, readFile, expectedSHA256); err != nil {
+		readFile.Close()
+		return nil, nil, err
+	}
+	if _, err = readFile.Seek(0, io.SeekStart); err != nil {
+		readFile.Close()
+		return nil, nil, fmt.Errorf("failed to seek downloaded file: %w", err)
 	}
 
 	level.Debug(s.logger).Log("msg", "large file download succeeded", "key", key, "path", tempPath)
-	return readFile, nil
+	return readFile, head.Metadata, nil
 }
@@ -0,0 +1,136 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	// failureLogWarnAfter is the number of consecutive failures after which
+	// they are logged as warnings rather than at debug level
+	failureLogWarnAfter = 3
+	// failureLogErrorAfter is the number of consecutive failures after which
+	// they are logged as errors
+	failureLogErrorAfter = 10
+	// failureLogInterval is how often repeated failures are logged once they
+	// are logged as warnings or errors
+	failureLogInterval = time.Minute
+)
+
+// failureSeverity is the level consecutive failures are logged at
+type failureSeverity int
+
+const (
+	severityDebug failureSeverity = iota
+	severityWarn
+	severityError
+)
+
+// FailureLog aggregates the logging of repeated failures of an S3
+// operation, e.g. uploads while S3 is unavailable, which would otherwise log
+// every failure identically for the length of an incident. Consecutive
+// failures are logged at debug level, then escalate to warnings and errors
+// as they continue. Once escalated, a failure is logged when the severity
+// increases or failureLogInterval has passed, with the number of failures,
+// the time of the first and last, and how many were not logged. A success
+// logs the recovery and clears the failures.
+type FailureLog struct {
+	logger    log.Logger
+	operation string
+	now       func() time.Time
+
+	mu         sync.Mutex
+	failures   int64
+	suppressed int64
+	first      time.Time
+	last       time.Time
+	severity   failureSeverity
+	loggedAt   time.Time
+}
+
+// NewFailureLog returns a FailureLog for operation, which is used in log
+// messages, e.g. "S3 upload"
+func NewFailureLog(logger log.Logger, operation string) *FailureLog {
+	return &FailureLog{
+		logger:    logger,
+		operation: operation,
+		now:       time.Now,
+	}
+}
+
+// Failure records a failure of the operation with err, logging it unless
+// the failure is being repeated within failureLogInterval. keyvals are
+// added to the log entry.
+func (f *FailureLog) Failure(err error, keyvals ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	f.failures++
+	if f.failures == 1 {
+		f.first = now
+	}
+	f.last = now
+
+	severity := severityDebug
+	switch {
+	case f.failures >= failureLogErrorAfter:
+		severity = severityError
+	case f.failures >= failureLogWarnAfter:
+		severity = severityWarn
+	}
+	if severity != severityDebug && severity == f.severity && now.Sub(f.loggedAt) < failureLogInterval {
+		f.suppressed++
+		return
+	}
+	keyvals = append([]any{"msg", f.operation + " failed",
+		"failures", f.failures,
+		"first_failure", f.first,
+		"last_failure", f.last,
+		"suppressed", f.suppressed,
+		"err", err,
+	}, keyvals...)
+	f.levelLogger(severity).Log(keyvals...)
+	f.severity = severity
+	f.loggedAt = now
+	f.suppressed = 0
+}
+
+// Success records a success of the operation, logging the recovery if it
+// had failed and clearing the failures
+func (f *FailureLog) Success() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures == 0 {
+		return
+	}
+	logger := level.Debug(f.logger)
+	if f.severity != severityDebug {
+		logger = level.Info(f.logger)
+	}
+	logger.Log("msg", f.operation+" recovered",
+		"failures", f.failures,
+		"first_failure", f.first,
+		"last_failure", f.last,
+		"duration", f.now().Sub(f.first).Round(time.Millisecond))
+	f.failures = 0
+	f.suppressed = 0
+	f.severity = severityDebug
+}
+
+// levelLogger returns the logger for failures of severity. f.mu must be
+// held.
+func (f *FailureLog) levelLogger(severity failureSeverity) log.Logger {
+	switch severity {
+	case severityError:
+		return level.Error(f.logger)
+	case severityWarn:
+		return level.Warn(f.logger)
+	}
+	return level.Debug(f.logger)
+}
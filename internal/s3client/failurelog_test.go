@@ -0,0 +1,66 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+func TestFailureLog(t *testing.T) {
+	var logged []string
+	logger := log.LoggerFunc(func(keyvals ...any) error {
+		entry := map[any]any{}
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			entry[keyvals[i]] = keyvals[i+1]
+		}
+		logged = append(logged, fmt.Sprintf("%v %v %v", entry[level.Key()], entry["msg"], entry["failures"]))
+		return nil
+	})
+	now := time.Unix(0, 0)
+	f := NewFailureLog(logger, "S3 upload")
+	f.now = func() time.Time { return now }
+	fail := func(n int) {
+		for range n {
+			f.Failure(errors.New("unavailable"))
+			now = now.Add(time.Second)
+		}
+	}
+
+	// failures escalate from debug to warn to error, and are only logged
+	// once per interval after escalating
+	fail(failureLogErrorAfter + 5)
+	expected := []string{
+		"debug S3 upload failed 1",
+		"debug S3 upload failed 2",
+		"warn S3 upload failed 3",
+		"error S3 upload failed 10",
+	}
+	if fmt.Sprint(logged) != fmt.Sprint(expected) {
+		t.Fatalf("logged %q, want %q", logged, expected)
+	}
+	now = now.Add(failureLogInterval)
+	fail(1)
+	f.Success()
+	expected = append(expected, "error S3 upload failed 16", "info S3 upload recovered 16")
+	if fmt.Sprint(logged) != fmt.Sprint(expected) {
+		t.Fatalf("logged %q, want %q", logged, expected)
+	}
+
+	// failures are cleared by a success, which is logged at debug level
+	// unless the failures escalated
+	logged = nil
+	f.Success()
+	fail(1)
+	f.Success()
+	expected = []string{"debug S3 upload failed 1", "debug S3 upload recovered 1"}
+	if fmt.Sprint(logged) != fmt.Sprint(expected) {
+		t.Fatalf("logged %q, want %q", logged, expected)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/objectstore"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+// Leases is the lease state recorded in S3 at a revision
+type Leases struct {
+	Revision int64
+	Entries  []*pb.LeaseEntry
+}
+
+// leasesKey returns the S3 key (without prefix) for a lease file
+// Format: leases/{zero-padded-revision}.netsy
+func leasesKey(revision int64) string {
+	return fmt.Sprintf("leases/%019d.netsy", revision)
+}
+
+// ErrLeasesConflict is returned when writing a lease file which another
+// instance has written at the same revision, as only the leader may record
+// the lease state
+var ErrLeasesConflict = errors.New("lease file was written by another writer")
+
+// WriteLeases records the lease state to S3 as a lease file, containing a
+// record per lease entry. As each lease file includes every lease which has
+// not ended, older lease files are deleted.
+//
+// Lease files are written conditionally: a new lease file must not exist,
+// and a lease file at the same revision as the last one written replaces it
+// only if it has not been written since, so that a server which is no
+// longer the leader cannot overwrite the lease state of the new leader.
+func (s *S3Client) WriteLeases(ctx context.Context, leases Leases) error {
+	buffer := &bytes.Buffer{}
+	bufWriter := bufio.NewWriter(buffer)
+	writer, err := datafile.NewWriter(bufWriter, pb.FileKind_KIND_LEASES, int64(len(leases.Entries)), s.config.InstanceID())
+	if err != nil {
+		return fmt.Errorf("failed to create datafile writer: %w", err)
+	}
+	for _, entry := range leases.Entries {
+		err = writer.Write(&pb.Record{
+			Revision:   leases.Revision,
+			LeaseEntry: entry,
+			LeaderId:   s.config.InstanceID(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write lease %d entry: %w", entry.Id, err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to close datafile writer: %w", err)
+	}
+
+	s.leasesMu.Lock()
+	defer s.leasesMu.Unlock()
+	key := leasesKey(leases.Revision)
+	revisions := RevisionRange{First: leases.Revision, Last: leases.Revision, Count: int64(len(leases.Entries))}
+	cond := objectstore.IfNotExists()
+	if s.leasesWritten.key == key {
+		cond = objectstore.IfVersion(s.leasesWritten.version)
+	}
+	version, err := s.putChunkFile(ctx, key, bytes.NewReader(buffer.Bytes()), pb.FileKind_KIND_LEASES, revisions, cond)
+	if errors.Is(err, objectstore.ErrPreconditionFailed) {
+		version, err = s.replaceOwnLeases(ctx, key, buffer.Bytes(), revisions)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload lease file: %w", err)
+	}
+	previous := s.leasesWritten
+	s.leasesWritten = writtenFile{key: key, version: version}
+
+	// Remove earlier lease files. Only the previous lease file is deleted
+	// once one has been written, so that each write does not list them.
+	if previous.key != "" {
+		if previous.key != key {
+			if err = s.DeleteFile(ctx, previous.key); err != nil {
+				level.Warn(s.logger).Log("msg", "failed to delete lease file", "key", previous.key, "error", err)
+			}
+		}
+	} else if err = s.deleteLeasesBefore(ctx, leases.Revision); err != nil {
+		level.Warn(s.logger).Log("msg", "failed to list lease files for cleanup", "error", err)
+	}
+
+	level.Debug(s.logger).Log("msg", "leases written to S3", "revision", leases.Revision, "entries", len(leases.Entries), "key", key)
+	return nil
+}
+
+// replaceOwnLeases replaces the lease file at key if it was written by this
+// instance, e.g. by an earlier attempt whose response was lost, returning
+// ErrLeasesConflict if it was written by another instance
+func (s *S3Client) replaceOwnLeases(ctx context.Context, key string, data []byte, revisions RevisionRange) (string, error) {
+	bucketName := s.config.S3BucketName()
+	s3Key := s.objectKey(key)
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &bucketName, Key: &s3Key})
+	if err != nil {
+		return "", fmt.Errorf("failed to head %s: %w", s3Key, err)
+	}
+	metadata, ok, err := parseObjectMetadata(head.Metadata)
+	if err != nil {
+		return "", err
+	}
+	if !ok || metadata.LeaderID != s.config.InstanceID() {
+		return "", fmt.Errorf("%w: %s was written by %q", ErrLeasesConflict, key, metadata.LeaderID)
+	}
+	return s.putChunkFile(ctx, key, bytes.NewReader(data), pb.FileKind_KIND_LEASES, revisions, objectstore.IfVersion(aws.ToString(head.ETag)))
+}
+
+// deleteLeasesBefore deletes the lease files before revision
+func (s *S3Client) deleteLeasesBefore(ctx context.Context, revision int64) error {
+	files, err := s.listRevisionFiles(ctx, "leases/")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Revision >= revision {
+			continue
+		}
+		if err = s.DeleteFile(ctx, file.Key); err != nil {
+			level.Warn(s.logger).Log("msg", "failed to delete lease file", "key", file.Key, "error", err)
+		}
+	}
+	return nil
+}
+
+// LatestLeases returns the most recent lease state recorded in S3, or nil if
+// there is none
+func (s *S3Client) LatestLeases(ctx context.Context) (*Leases, error) {
+	files, err := s.listRevisionFiles(ctx, "leases/")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	latest := files[0]
+
+	body, err := s.downloadSmallFile(ctx, latest.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download lease file: %w", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease file: %w", err)
+	}
+
+	expectedKind := pb.FileKind_KIND_LEASES
+	reader, err := datafile.NewReader(bufio.NewReader(bytes.NewReader(data)), &expectedKind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create datafile reader: %w", err)
+	}
+	defer reader.Release()
+	leases := &Leases{Revision: latest.Revision}
+	for range reader.Count() {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lease record: %w", err)
+		}
+		if record.Revision != latest.Revision {
+			return nil, fmt.Errorf("invalid lease file %s: record revision %d", latest.Key, record.Revision)
+		}
+		leases.Entries = append(leases.Entries, record.LeaseEntry)
+	}
+	if _, err = reader.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close datafile reader: %w", err)
+	}
+	return leases, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+// TestWriteLeasesConditional checks that lease files replace only the lease
+// file last written by this instance, and are not written over a lease file
+// written by another instance
+func TestWriteLeasesConditional(t *testing.T) {
+	bucket := &fakeBucket{
+		objects:    map[string]string{},
+		encryption: map[string]string{},
+		versions:   map[string]int{},
+		metadata:   map[string]http.Header{},
+	}
+	client := newTestS3Client(t, bucket, nil)
+	ctx := context.Background()
+	write := func(revision int64, ids ...int64) error {
+		leases := Leases{Revision: revision}
+		for _, id := range ids {
+			leases.Entries = append(leases.Entries, &pb.LeaseEntry{Event: pb.LeaseEntry_EVENT_GRANTED, Id: id})
+		}
+		return client.WriteLeases(ctx, leases)
+	}
+	latestIDs := func() (ids []int64) {
+		t.Helper()
+		leases, err := client.LatestLeases(ctx)
+		if err != nil {
+			t.Fatalf("LatestLeases: %v", err)
+		}
+		for _, entry := range leases.Entries {
+			ids = append(ids, entry.Id)
+		}
+		return ids
+	}
+
+	// a lease file at the same revision replaces the one last written
+	if err := write(5, 1); err != nil {
+		t.Fatalf("WriteLeases: %v", err)
+	}
+	if err := write(5, 1, 2); err != nil {
+		t.Fatalf("WriteLeases: %v", err)
+	}
+	if ids := latestIDs(); len(ids) != 2 {
+		t.Fatalf("expected leases 1 and 2, got %v", ids)
+	}
+
+	// including if the response to the last write was lost
+	client.leasesWritten = writtenFile{}
+	if err := write(5, 3); err != nil {
+		t.Fatalf("WriteLeases after a lost response: %v", err)
+	}
+
+	// but not once another instance has written it
+	key := "cluster/" + leasesKey(5)
+	bucket.versions[key]++
+	bucket.metadata[key].Set("X-Amz-Meta-Netsy-Leader-Id", "other")
+	if err := write(5, 4); !errors.Is(err, ErrLeasesConflict) {
+		t.Fatalf("expected ErrLeasesConflict, got %v", err)
+	}
+
+	// a lease file at a later revision replaces the earlier one
+	if err := write(6, 5); err != nil {
+		t.Fatalf("WriteLeases: %v", err)
+	}
+	if _, ok := bucket.objects[key]; ok || len(bucket.objects) != 1 {
+		t.Fatalf("expected only the latest lease file, got %d files", len(bucket.objects))
+	}
+	if ids := latestIDs(); len(ids) != 1 || ids[0] != 5 {
+		t.Fatalf("expected lease 5, got %v", ids)
+	}
+}
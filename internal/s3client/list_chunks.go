@@ -4,46 +4,142 @@
 package s3client
 
 import (
+	"container/heap"
 	"context"
 	"fmt"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-kit/log/level"
 )
 
+// chunkPartitions is the number of partitions chunk files are spread over,
+// see chunkKey
+const chunkPartitions = 10000
+
+// listChunksConcurrency is the number of partitions listed at once
+const listChunksConcurrency = 16
+
+// chunkKey returns the S3 key (without prefix) for a chunk file
+// Format: chunks/{partition}/{zero-padded-revision}.netsy
+// Partition is modulo 10000 to avoid hot paths
+// Revision is zero-padded to 19 characters (max int64)
+func chunkKey(revision int64) string {
+	return fmt.Sprintf("%s%019d.netsy", chunkPartition(revision), revision)
+}
+
+// chunkPartition returns the S3 key prefix (without prefix) of the partition
+// containing the chunk file of revision
+func chunkPartition(revision int64) string {
+	return fmt.Sprintf("chunks/%04d/", revision%chunkPartitions)
+}
+
+// MaxChunkRevisions is the maximum number of revisions a chunk file covers.
+// WriteRecords splits larger writes into several chunk files, and coalescing
+// stops merging chunks at it, so that ListChunks knows the chunk after any
+// revision is within MaxChunkRevisions partitions of it.
+const MaxChunkRevisions = 1000
+
 // ListChunks returns all chunk files with revision > fromRevision, sorted by revision (oldest first)
+//
+// Chunk keys sort by revision within each partition, so each partition is
+// listed starting after fromRevision, which returns all of its chunks that
+// are needed. Partitions are listed in revision order, starting at the
+// partition containing fromRevision+1. As chunks are contiguous and each
+// covers at most MaxChunkRevisions revisions, listing stops once the
+// MaxChunkRevisions partitions after the latest chunk found have been
+// listed, or every partition has been. The cost is then proportional to the
+// number of new chunks, rather than all partitions or chunks.
+//
+// Chunks which do not follow on from fromRevision, e.g. after revisions
+// skipped by SetNextRevision, or when older chunks have been deleted by
+// retention, may not be listed. Both are covered by a snapshot, so callers
+// needing them list from the latest snapshot revision.
 func (s *S3Client) ListChunks(ctx context.Context, fromRevision int64) ([]FileInfo, error) {
-	prefix := "chunks/"
-	if s.config.S3KeyPrefix() != "" {
-		prefix = s.config.S3KeyPrefix() + "/" + prefix
+	var listings [][]FileInfo
+	latest := fromRevision
+	end := fromRevision + chunkPartitions
+	for next := fromRevision + 1; next <= min(latest+MaxChunkRevisions, end); {
+		count := min(int64(listChunksConcurrency), min(latest+MaxChunkRevisions, end)-next+1)
+		batch, err := s.listPartitionsChunks(ctx, next, count, fromRevision)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunks := range batch {
+			if len(chunks) > 0 {
+				listings = append(listings, chunks)
+				latest = max(latest, chunks[len(chunks)-1].Revision)
+			}
+		}
+		next += count
+	}
+	return mergeChunkListings(listings), nil
+}
+
+// listPartitionsChunks concurrently lists the chunk files with revision >
+// fromRevision in count consecutive partitions, starting at the partition
+// containing revision, returning the listing of each partition
+func (s *S3Client) listPartitionsChunks(ctx context.Context, revision int64, count int64, fromRevision int64) ([][]FileInfo, error) {
+	listings := make([][]FileInfo, count)
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var listErr error
+	var listErrOnce sync.Once
+	var wg sync.WaitGroup
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			partition := s.objectKey(chunkPartition(revision + i))
+			chunks, err := s.listPartitionChunks(listCtx, partition, fromRevision)
+			if err != nil {
+				// Keep the first error and abort listing other partitions
+				listErrOnce.Do(func() {
+					listErr = err
+					cancel()
+				})
+				return
+			}
+			listings[i] = chunks
+		}()
+	}
+	wg.Wait()
+	if listErr != nil {
+		return nil, listErr
 	}
+	return listings, nil
+}
 
+// listPartitionChunks returns the chunk files in a partition with revision >
+// fromRevision, sorted by revision (oldest first)
+func (s *S3Client) listPartitionChunks(ctx context.Context, partition string, fromRevision int64) ([]FileInfo, error) {
 	bucketName := s.config.S3BucketName()
 	input := &s3.ListObjectsV2Input{
 		Bucket: &bucketName,
-		Prefix: &prefix,
+		Prefix: &partition,
+	}
+	// Keys are listed in lexicographic order, which for zero-padded
+	// revisions is revision order
+	if fromRevision > 0 {
+		startAfter := fmt.Sprintf("%s%019d.netsy", partition, fromRevision)
+		input.StartAfter = &startAfter
 	}
 
 	var chunks []FileInfo
 	paginator := s3.NewListObjectsV2Paginator(s.client, input)
-
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list chunk objects: %w", err)
+			return nil, fmt.Errorf("failed to list chunk objects in %s: %w", partition, err)
 		}
 
 		for _, obj := range output.Contents {
 			// Extract revision from filename: chunks/{partition}/{revision}.netsy
-			keyParts := strings.Split(*obj.Key, "/")
-			if len(keyParts) < 3 {
-				continue
-			}
-			filename := keyParts[len(keyParts)-1]
-			if !strings.HasSuffix(filename, ".netsy") {
+			filename := strings.TrimPrefix(*obj.Key, partition)
+			if !strings.HasSuffix(filename, ".netsy") || strings.Contains(filename, "/") {
 				continue
 			}
 			revisionStr := strings.TrimSuffix(filename, ".netsy")
@@ -56,18 +152,68 @@ func (s *S3Client) ListChunks(ctx context.Context, fromRevision int64) ([]FileIn
 			// Only include chunks with revision > fromRevision
 			if revision > fromRevision {
 				chunks = append(chunks, FileInfo{
-					Key:      *obj.Key,
-					Size:     *obj.Size,
-					Revision: revision,
+					Key:          *obj.Key,
+					Size:         *obj.Size,
+					Revision:     revision,
+					ETag:         aws.ToString(obj.ETag),
+					LastModified: aws.ToTime(obj.LastModified),
 				})
 			}
 		}
 	}
+	return chunks, nil
+}
 
-	// Sort by revision (oldest first)
-	sort.Slice(chunks, func(i, j int) bool {
-		return chunks[i].Revision < chunks[j].Revision
-	})
+// mergeChunkListings merges chunk listings which are each sorted by revision
+// into a single listing sorted by revision, with ties broken by key so the
+// result is deterministic
+func mergeChunkListings(listings [][]FileInfo) []FileInfo {
+	total := 0
+	h := &chunkHeap{}
+	for _, listing := range listings {
+		total += len(listing)
+		if len(listing) > 0 {
+			h.cursors = append(h.cursors, listing)
+		}
+	}
+	heap.Init(h)
 
-	return chunks, nil
+	merged := make([]FileInfo, 0, total)
+	for h.Len() > 0 {
+		listing := h.cursors[0]
+		merged = append(merged, listing[0])
+		if len(listing) > 1 {
+			h.cursors[0] = listing[1:]
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return merged
+}
+
+// chunkHeap is a min-heap of the remaining chunks of each listing, ordered
+// by each listing's next chunk
+type chunkHeap struct {
+	cursors [][]FileInfo
+}
+
+func (h *chunkHeap) Len() int { return len(h.cursors) }
+
+func (h *chunkHeap) Less(i, j int) bool {
+	a, b := h.cursors[i][0], h.cursors[j][0]
+	if a.Revision != b.Revision {
+		return a.Revision < b.Revision
+	}
+	return a.Key < b.Key
+}
+
+func (h *chunkHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *chunkHeap) Push(x any) { h.cursors = append(h.cursors, x.([]FileInfo)) }
+
+func (h *chunkHeap) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
 }
@@ -0,0 +1,89 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestMergeChunkListings(t *testing.T) {
+	listing := func(revisions ...int64) []FileInfo {
+		var chunks []FileInfo
+		for _, revision := range revisions {
+			chunks = append(chunks, FileInfo{Key: chunkKey(revision), Revision: revision})
+		}
+		return chunks
+	}
+	listings := [][]FileInfo{
+		listing(1, 10001, 20001),
+		nil,
+		listing(2, 10002),
+		listing(3),
+		listing(9999, 19999),
+	}
+
+	merged := mergeChunkListings(listings)
+	expected := []int64{1, 2, 3, 9999, 10001, 10002, 19999, 20001}
+	if len(merged) != len(expected) {
+		t.Fatalf("merged %d chunks, want %d", len(merged), len(expected))
+	}
+	for i, chunk := range merged {
+		if chunk.Revision != expected[i] {
+			t.Errorf("merged[%d] = %d, want %d", i, chunk.Revision, expected[i])
+		}
+	}
+}
+
+func TestChunkKey(t *testing.T) {
+	if key := chunkKey(123456); key != "chunks/3456/0000000000000123456.netsy" {
+		t.Errorf("chunkKey(123456) = %s", key)
+	}
+}
+
+func TestListChunks(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string]string{}, encryption: map[string]string{}}
+	client := newTestS3Client(t, bucket, nil)
+	write := func(revisions ...int64) {
+		for _, revision := range revisions {
+			bucket.objects["cluster/"+chunkKey(revision)] = "chunk"
+		}
+	}
+	listed := func(fromRevision int64) (listed []int64) {
+		t.Helper()
+		bucket.lists = 0
+		chunks, err := client.ListChunks(context.Background(), fromRevision)
+		if err != nil {
+			t.Fatalf("ListChunks(%d): %v", fromRevision, err)
+		}
+		for _, chunk := range chunks {
+			listed = append(listed, chunk.Revision)
+		}
+		return listed
+	}
+
+	// contiguous chunks, including coalesced chunks, are listed from the
+	// partition of the revision after fromRevision up to MaxChunkRevisions
+	// partitions after the latest chunk found
+	write(5, 10, 900, 1500, 1501, 2000)
+	if chunks := listed(0); !slices.Equal(chunks, []int64{5, 10, 900, 1500, 1501, 2000}) {
+		t.Errorf("ListChunks(0) = %v", chunks)
+	}
+	if bucket.lists != 2000+MaxChunkRevisions {
+		t.Errorf("expected %d partitions to be listed, listed %d", 2000+MaxChunkRevisions, bucket.lists)
+	}
+	if chunks := listed(1500); !slices.Equal(chunks, []int64{1501, 2000}) {
+		t.Errorf("ListChunks(1500) = %v", chunks)
+	}
+	if chunks := listed(2000); len(chunks) != 0 || bucket.lists != MaxChunkRevisions {
+		t.Errorf("expected no chunks after listing %d partitions, got %v after %d", MaxChunkRevisions, chunks, bucket.lists)
+	}
+
+	// partitions wrap around, and hold chunks of every lap
+	write(2999, 3998, 4997, 5996, 6995, 7994, 8993, 9992, 9998, 10003, 10004)
+	if chunks := listed(9997); !slices.Equal(chunks, []int64{9998, 10003, 10004}) {
+		t.Errorf("ListChunks(9997) = %v", chunks)
+	}
+}
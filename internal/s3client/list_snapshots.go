@@ -7,64 +7,98 @@ import (
 	"context"
 	"fmt"
 	"sort"
-	"strconv"
-	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/go-kit/log/level"
 )
 
-// ListSnapshots returns all snapshot files sorted by revision (newest first)
+// ListSnapshots returns all snapshots sorted by revision (newest first). Each
+// is either a snapshot file, or the manifest of a multi-part snapshot (see
+// IsSnapshotManifest).
 func (s *S3Client) ListSnapshots(ctx context.Context) ([]FileInfo, error) {
-	prefix := "snapshots/"
-	if s.config.S3KeyPrefix() != "" {
-		prefix = s.config.S3KeyPrefix() + "/" + prefix
+	var snapshots []FileInfo
+	err := s.listSnapshotObjects(ctx, func(obj types.Object) {
+		// Extract revision from key, skipping parts of multi-part
+		// snapshots
+		revision, ok := parseSnapshotKey(*obj.Key)
+		if !ok {
+			level.Debug(s.logger).Log("msg", "skipping snapshot part or invalid snapshot key", "key", *obj.Key)
+			return
+		}
+		snapshots = append(snapshots, newFileInfo(obj, revision))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort by revision (newest first)
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Revision > snapshots[j].Revision
+	})
+
+	return snapshots, nil
+}
+
+// ListOrphanedSnapshotParts returns the parts of multi-part snapshots which
+// have no manifest, and were last modified before the given time. These are
+// left behind when a snapshot fails part way through uploading its parts,
+// and are never used (see WriteSnapshotManifest). Parts modified since are
+// not returned, as their snapshot may still be uploading.
+func (s *S3Client) ListOrphanedSnapshotParts(ctx context.Context, before time.Time) ([]FileInfo, error) {
+	manifests := map[int64]bool{}
+	var parts []FileInfo
+	err := s.listSnapshotObjects(ctx, func(obj types.Object) {
+		if revision, ok := parseSnapshotKey(*obj.Key); ok && IsSnapshotManifest(*obj.Key) {
+			manifests[revision] = true
+		} else if revision, ok := parseSnapshotPartKey(*obj.Key); ok {
+			parts = append(parts, newFileInfo(obj, revision))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	orphaned := parts[:0]
+	for _, part := range parts {
+		if !manifests[part.Revision] && part.LastModified.Before(before) {
+			orphaned = append(orphaned, part)
+		}
 	}
+	return orphaned, nil
+}
 
+// listSnapshotObjects calls fn with each object under snapshots/
+func (s *S3Client) listSnapshotObjects(ctx context.Context, fn func(obj types.Object)) error {
+	prefix := s.objectKey("snapshots/")
 	bucketName := s.config.S3BucketName()
 	input := &s3.ListObjectsV2Input{
 		Bucket: &bucketName,
 		Prefix: &prefix,
 	}
-
-	var snapshots []FileInfo
 	paginator := s3.NewListObjectsV2Paginator(s.client, input)
-
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list snapshot objects: %w", err)
+			return fmt.Errorf("failed to list snapshot objects: %w", err)
 		}
-
 		for _, obj := range output.Contents {
-			// Extract revision from filename: snapshots/{revision}.netsy
-			keyParts := strings.Split(*obj.Key, "/")
-			if len(keyParts) < 2 {
-				continue
-			}
-			filename := keyParts[len(keyParts)-1]
-			if !strings.HasSuffix(filename, ".netsy") {
-				continue
-			}
-			revisionStr := strings.TrimSuffix(filename, ".netsy")
-			revision, err := strconv.ParseInt(revisionStr, 10, 64)
-			if err != nil {
-				level.Debug(s.logger).Log("msg", "skipping invalid snapshot filename", "filename", filename)
-				continue
-			}
-
-			snapshots = append(snapshots, FileInfo{
-				Key:      *obj.Key,
-				Size:     *obj.Size,
-				Revision: revision,
-			})
+			fn(obj)
 		}
 	}
+	return nil
+}
 
-	// Sort by revision (newest first)
-	sort.Slice(snapshots, func(i, j int) bool {
-		return snapshots[i].Revision > snapshots[j].Revision
-	})
-
-	return snapshots, nil
+// newFileInfo returns the FileInfo of a listed object
+func newFileInfo(obj types.Object, revision int64) FileInfo {
+	info := FileInfo{
+		Key:      *obj.Key,
+		Size:     aws.ToInt64(obj.Size),
+		Revision: revision,
+	}
+	if obj.LastModified != nil {
+		info.LastModified = *obj.LastModified
+	}
+	return info
 }
@@ -0,0 +1,136 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+// S3 user metadata keys of chunk and snapshot files (S3 lowercases them, and
+// stores them as x-amz-meta-* headers)
+const (
+	metadataKind          = "netsy-kind"
+	metadataFirstRevision = "netsy-first-revision"
+	metadataLastRevision  = "netsy-last-revision"
+	metadataRecords       = "netsy-records"
+	metadataLeaderID      = "netsy-leader-id"
+	metadataLeaderEpoch   = "netsy-leader-epoch"
+	metadataSHA256        = "netsy-sha256"
+)
+
+// RevisionRange is the revisions of the records in a chunk or snapshot file
+type RevisionRange struct {
+	First int64
+	Last  int64
+	Count int64
+}
+
+// ObjectMetadata describes the contents of a chunk or snapshot file, and is
+// stored as S3 user metadata when it is uploaded, so that tooling can
+// inspect objects (e.g. with HeadObject) without downloading them
+type ObjectMetadata struct {
+	Kind          pb.FileKind
+	FirstRevision int64
+	LastRevision  int64
+	RecordsCount  int64
+	// LeaderID is the instance which uploaded the file, and LeaderEpoch its
+	// leader epoch at the time (see SetLeaderEpoch)
+	LeaderID    string
+	LeaderEpoch int64
+	// SHA256 is the hex encoded SHA-256 hash of the file
+	SHA256 string
+}
+
+// s3Metadata returns m as S3 user metadata
+func (m ObjectMetadata) s3Metadata() map[string]string {
+	return map[string]string{
+		metadataKind:          m.Kind.String(),
+		metadataFirstRevision: strconv.FormatInt(m.FirstRevision, 10),
+		metadataLastRevision:  strconv.FormatInt(m.LastRevision, 10),
+		metadataRecords:       strconv.FormatInt(m.RecordsCount, 10),
+		metadataLeaderID:      m.LeaderID,
+		metadataLeaderEpoch:   strconv.FormatInt(m.LeaderEpoch, 10),
+		metadataSHA256:        m.SHA256,
+	}
+}
+
+// parseObjectMetadata parses S3 user metadata written by s3Metadata. It
+// returns false if the object has no netsy metadata, e.g. because it was
+// uploaded by an older version.
+func parseObjectMetadata(metadata map[string]string) (m ObjectMetadata, ok bool, err error) {
+	if _, ok = metadata[metadataSHA256]; !ok {
+		return m, false, nil
+	}
+	kind, known := pb.FileKind_value[metadata[metadataKind]]
+	if !known {
+		return m, true, fmt.Errorf("invalid %s metadata %q", metadataKind, metadata[metadataKind])
+	}
+	m.Kind = pb.FileKind(kind)
+	for key, value := range map[string]*int64{
+		metadataFirstRevision: &m.FirstRevision,
+		metadataLastRevision:  &m.LastRevision,
+		metadataRecords:       &m.RecordsCount,
+		metadataLeaderEpoch:   &m.LeaderEpoch,
+	} {
+		if *value, err = strconv.ParseInt(metadata[key], 10, 64); err != nil {
+			return m, true, fmt.Errorf("invalid %s metadata: %w", key, err)
+		}
+	}
+	m.LeaderID = metadata[metadataLeaderID]
+	m.SHA256 = metadata[metadataSHA256]
+	return m, true, nil
+}
+
+// newObjectMetadata returns the metadata for a file with the given
+// contents, uploaded by this instance
+func (s *S3Client) newObjectMetadata(kind pb.FileKind, revisions RevisionRange, data io.Reader) (m ObjectMetadata, err error) {
+	hash, err := sha256Hex(data)
+	if err != nil {
+		return m, err
+	}
+	return ObjectMetadata{
+		Kind:          kind,
+		FirstRevision: revisions.First,
+		LastRevision:  revisions.Last,
+		RecordsCount:  revisions.Count,
+		LeaderID:      s.config.InstanceID(),
+		LeaderEpoch:   s.leaderEpoch.Load(),
+		SHA256:        hash,
+	}, nil
+}
+
+// SetLeaderEpoch sets the leader epoch recorded in the metadata of files
+// uploaded from now on
+func (s *S3Client) SetLeaderEpoch(epoch int64) {
+	s.leaderEpoch.Store(epoch)
+}
+
+// HeadObjectMetadata returns the metadata of the file at key (without the
+// key prefix), without downloading it. It returns false if the file has no
+// netsy metadata.
+func (s *S3Client) HeadObjectMetadata(ctx context.Context, key string) (ObjectMetadata, bool, error) {
+	bucketName := s.config.S3BucketName()
+	s3Key := s.objectKey(key)
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &bucketName,
+		Key:    &s3Key,
+	})
+	if err != nil {
+		return ObjectMetadata{}, false, fmt.Errorf("failed to head %s: %w", s3Key, err)
+	}
+	return parseObjectMetadata(output.Metadata)
+}
+
+// ChunkMetadata returns the metadata of the chunk file named by revision,
+// i.e. whose last revision is revision, without downloading it. It returns
+// false if the file has no netsy metadata.
+func (s *S3Client) ChunkMetadata(ctx context.Context, revision int64) (ObjectMetadata, bool, error) {
+	return s.HeadObjectMetadata(ctx, chunkKey(revision))
+}
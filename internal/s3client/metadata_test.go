@@ -0,0 +1,54 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestObjectMetadata(t *testing.T) {
+	configtest.Set(t, map[string]any{"instance_id": "test"})
+	s := &S3Client{config: &config.Config{}}
+	s.SetLeaderEpoch(3)
+
+	metadata, err := s.newObjectMetadata(pb.FileKind_KIND_CHUNK, RevisionRange{First: 10, Last: 12, Count: 3}, bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatalf("newObjectMetadata: %v", err)
+	}
+	expected := ObjectMetadata{
+		Kind:          pb.FileKind_KIND_CHUNK,
+		FirstRevision: 10,
+		LastRevision:  12,
+		RecordsCount:  3,
+		LeaderID:      "test",
+		LeaderEpoch:   3,
+		SHA256:        "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7",
+	}
+	if metadata != expected {
+		t.Fatalf("expected %+v, got %+v", expected, metadata)
+	}
+
+	parsed, ok, err := parseObjectMetadata(metadata.s3Metadata())
+	if err != nil || !ok {
+		t.Fatalf("parseObjectMetadata: ok=%t err=%v", ok, err)
+	}
+	if parsed != expected {
+		t.Fatalf("expected %+v, got %+v", expected, parsed)
+	}
+
+	// files uploaded by older versions have no metadata
+	if _, ok, err = parseObjectMetadata(map[string]string{}); ok || err != nil {
+		t.Fatalf("expected no metadata, got ok=%t err=%v", ok, err)
+	}
+	invalid := metadata.s3Metadata()
+	invalid[metadataLastRevision] = "x"
+	if _, _, err = parseObjectMetadata(invalid); err == nil {
+		t.Fatalf("expected invalid metadata to fail")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/objectstore"
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+// snapshotManifestSuffix replaces the .netsy suffix of snapshot keys for
+// snapshot manifests
+const snapshotManifestSuffix = ".manifest.netsy"
+
+// SnapshotKey returns the S3 key (without prefix) for a snapshot file
+// Format: snapshots/{zero-padded-revision}.netsy
+func SnapshotKey(revision int64) string {
+	return fmt.Sprintf("snapshots/%019d.netsy", revision)
+}
+
+// SnapshotManifestKey returns the S3 key (without prefix) for the manifest of
+// a multi-part snapshot
+// Format: snapshots/{zero-padded-revision}.manifest.netsy
+func SnapshotManifestKey(revision int64) string {
+	return fmt.Sprintf("snapshots/%019d%s", revision, snapshotManifestSuffix)
+}
+
+// SnapshotPartKey returns the S3 key (without prefix) for a part of a
+// multi-part snapshot, numbered from 1
+// Format: snapshots/{zero-padded-revision}/{zero-padded-part}.netsy
+func SnapshotPartKey(revision int64, part int) string {
+	return fmt.Sprintf("snapshots/%019d/%05d.netsy", revision, part)
+}
+
+// IsSnapshotManifest returns true if key is the key of a snapshot manifest,
+// rather than of a snapshot file
+func IsSnapshotManifest(key string) bool {
+	return strings.HasSuffix(key, snapshotManifestSuffix)
+}
+
+// parseSnapshotKey returns the revision of the snapshot file or manifest at
+// key. Keys of snapshot parts, which are in a directory per snapshot, are
+// not snapshots.
+func parseSnapshotKey(key string) (revision int64, ok bool) {
+	keyParts := strings.Split(key, "/")
+	if len(keyParts) < 2 || keyParts[len(keyParts)-2] != "snapshots" {
+		return 0, false
+	}
+	filename := keyParts[len(keyParts)-1]
+	if !strings.HasSuffix(filename, ".netsy") {
+		return 0, false
+	}
+	revisionStr := strings.TrimSuffix(strings.TrimSuffix(filename, snapshotManifestSuffix), ".netsy")
+	revision, err := strconv.ParseInt(revisionStr, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return revision, true
+}
+
+// parseSnapshotPartKey returns the revision of the multi-part snapshot which
+// the part at key belongs to
+func parseSnapshotPartKey(key string) (revision int64, ok bool) {
+	keyParts := strings.Split(key, "/")
+	if len(keyParts) < 3 || keyParts[len(keyParts)-3] != "snapshots" || !strings.HasSuffix(keyParts[len(keyParts)-1], ".netsy") {
+		return 0, false
+	}
+	revision, err := strconv.ParseInt(keyParts[len(keyParts)-2], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return revision, true
+}
+
+// WriteSnapshotManifest records a multi-part snapshot at revision, once all
+// of its parts have been uploaded. The manifest contains a record per part,
+// in revision order. Snapshots are only listed once their manifest exists
+// (see ListSnapshots), so a snapshot whose upload did not complete is never
+// used.
+func (s *S3Client) WriteSnapshotManifest(ctx context.Context, revision int64, parts []*pb.SnapshotPart) error {
+	buffer := &bytes.Buffer{}
+	bufWriter := bufio.NewWriter(buffer)
+	writer, err := datafile.NewWriter(bufWriter, pb.FileKind_KIND_SNAPSHOT_MANIFEST, int64(len(parts)), s.config.InstanceID())
+	if err != nil {
+		return fmt.Errorf("failed to create datafile writer: %w", err)
+	}
+	var recordsCount int64
+	for _, part := range parts {
+		err = writer.Write(&pb.Record{
+			Revision:     revision,
+			SnapshotPart: part,
+			LeaderId:     s.config.InstanceID(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write snapshot part %s: %w", part.Key, err)
+		}
+		recordsCount += part.RecordsCount
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to close datafile writer: %w", err)
+	}
+
+	// A snapshot written again at the same revision has the same records
+	key := SnapshotManifestKey(revision)
+	revisions := RevisionRange{First: parts[0].FirstRevision, Last: parts[len(parts)-1].LastRevision, Count: recordsCount}
+	_, err = s.putChunkFile(ctx, key, bytes.NewReader(buffer.Bytes()), pb.FileKind_KIND_SNAPSHOT_MANIFEST, revisions, objectstore.Condition{})
+	if err != nil {
+		return fmt.Errorf("failed to upload snapshot manifest: %w", err)
+	}
+	level.Debug(s.logger).Log("msg", "snapshot manifest written to S3", "revision", revision, "parts", len(parts), "key", key)
+	return nil
+}
+
+// SnapshotParts reads the snapshot manifest at key (as listed by
+// ListSnapshots), returning its parts in revision order. The Key of each
+// part includes the key prefix, and its Revision is its last revision.
+func (s *S3Client) SnapshotParts(ctx context.Context, key string) ([]FileInfo, error) {
+	body, err := s.downloadSmallFile(ctx, s.objectKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download snapshot manifest: %w", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot manifest: %w", err)
+	}
+
+	expectedKind := pb.FileKind_KIND_SNAPSHOT_MANIFEST
+	reader, err := datafile.NewReader(bufio.NewReader(bytes.NewReader(data)), &expectedKind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create datafile reader: %w", err)
+	}
+	defer reader.Release()
+	var parts []FileInfo
+	var lastRevision int64
+	for range reader.Count() {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot part: %w", err)
+		}
+		part := record.SnapshotPart
+		if part.FirstRevision <= lastRevision || part.LastRevision < part.FirstRevision || part.LastRevision > record.Revision {
+			return nil, fmt.Errorf("invalid snapshot manifest %s: part %s has revisions %d to %d", key, part.Key, part.FirstRevision, part.LastRevision)
+		}
+		lastRevision = part.LastRevision
+		parts = append(parts, FileInfo{
+			Key:      s.objectKey(part.Key),
+			Size:     part.Size,
+			Revision: part.LastRevision,
+		})
+	}
+	if _, err = reader.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close datafile reader: %w", err)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("invalid snapshot manifest %s: no parts", key)
+	}
+	return parts, nil
+}
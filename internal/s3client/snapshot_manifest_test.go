@@ -0,0 +1,108 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+)
+
+func TestParseSnapshotKey(t *testing.T) {
+	for _, test := range []struct {
+		key      string
+		revision int64
+		ok       bool
+		manifest bool
+	}{
+		{key: SnapshotKey(10), revision: 10, ok: true},
+		{key: "prefix/" + SnapshotKey(10), revision: 10, ok: true},
+		{key: SnapshotManifestKey(20), revision: 20, ok: true, manifest: true},
+		// parts are not snapshots
+		{key: SnapshotPartKey(20, 1)},
+		{key: "snapshots/invalid.netsy"},
+	} {
+		revision, ok := parseSnapshotKey(test.key)
+		if revision != test.revision || ok != test.ok {
+			t.Errorf("parseSnapshotKey(%s) = %d, %v, want %d, %v", test.key, revision, ok, test.revision, test.ok)
+		}
+		if manifest := IsSnapshotManifest(test.key); manifest != test.manifest {
+			t.Errorf("IsSnapshotManifest(%s) = %v, want %v", test.key, manifest, test.manifest)
+		}
+	}
+}
+
+func TestSnapshotManifest(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string]string{}, encryption: map[string]string{}}
+	client := newTestS3Client(t, bucket, nil)
+	ctx := context.Background()
+	parts := []*pb.SnapshotPart{
+		{Key: SnapshotPartKey(30, 1), FirstRevision: 1, LastRevision: 10, RecordsCount: 8, Size: 100},
+		{Key: SnapshotPartKey(30, 2), FirstRevision: 11, LastRevision: 30, RecordsCount: 15, Size: 200},
+	}
+	for _, part := range parts {
+		bucket.objects["cluster/"+part.Key] = "part"
+	}
+	// the parts of a snapshot which failed have no manifest
+	bucket.objects["cluster/"+SnapshotPartKey(40, 1)] = "part"
+	if err := client.WriteSnapshotManifest(ctx, 30, parts); err != nil {
+		t.Fatalf("WriteSnapshotManifest: %v", err)
+	}
+
+	// only the manifest is listed as a snapshot
+	snapshots, err := client.ListSnapshots(ctx)
+	if err != nil {
+		t.Fatalf("ListSnapshots: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Revision != 30 || !IsSnapshotManifest(snapshots[0].Key) {
+		t.Fatalf("expected the manifest at revision 30, got %v", snapshots)
+	}
+
+	// the parts are read from the manifest in order
+	read, err := client.SnapshotParts(ctx, snapshots[0].Key)
+	if err != nil {
+		t.Fatalf("SnapshotParts: %v", err)
+	}
+	if len(read) != len(parts) {
+		t.Fatalf("expected %d parts, got %v", len(parts), read)
+	}
+	for i, part := range parts {
+		if read[i].Key != "cluster/"+part.Key || read[i].Size != part.Size || read[i].Revision != part.LastRevision {
+			t.Errorf("part %d = %+v, want %s of size %d up to revision %d", i, read[i], part.Key, part.Size, part.LastRevision)
+		}
+	}
+
+	// parts without a manifest are orphaned, once old enough
+	orphaned, err := client.ListOrphanedSnapshotParts(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("ListOrphanedSnapshotParts: %v", err)
+	}
+	if len(orphaned) != 1 || orphaned[0].Key != "cluster/"+SnapshotPartKey(40, 1) || orphaned[0].Revision != 40 {
+		t.Fatalf("expected the part at revision 40 to be orphaned, got %v", orphaned)
+	}
+}
+
+func TestSnapshotManifestInvalid(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string]string{}, encryption: map[string]string{}}
+	client := newTestS3Client(t, bucket, nil)
+	ctx := context.Background()
+	// parts must be in revision order, and within the snapshot
+	for revision, parts := range map[int64][]*pb.SnapshotPart{
+		30: {
+			{Key: SnapshotPartKey(30, 1), FirstRevision: 11, LastRevision: 30},
+			{Key: SnapshotPartKey(30, 2), FirstRevision: 1, LastRevision: 10},
+		},
+		40: {{Key: SnapshotPartKey(40, 1), FirstRevision: 1, LastRevision: 50}},
+	} {
+		if err := client.WriteSnapshotManifest(ctx, revision, parts); err != nil {
+			t.Fatalf("WriteSnapshotManifest: %v", err)
+		}
+		if _, err := client.SnapshotParts(ctx, SnapshotManifestKey(revision)); err == nil || !strings.Contains(err.Error(), "invalid snapshot manifest") {
+			t.Errorf("expected the manifest at revision %d to be invalid, got %v", revision, err)
+		}
+	}
+}
@@ -6,16 +6,19 @@ package s3client
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/go-kit/log/level"
+	pb "github.com/nadrama-com/netsy/internal/proto"
 )
 
-// UploadFile uploads a local file to S3
-func (s *S3Client) UploadFile(ctx context.Context, key, filePath string) error {
+// UploadFile uploads a local data file of the given kind to S3, recording
+// revisions in its metadata (see ObjectMetadata)
+func (s *S3Client) UploadFile(ctx context.Context, key, filePath string, kind pb.FileKind, revisions RevisionRange) error {
 	// Open local file
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -29,6 +32,15 @@ func (s *S3Client) UploadFile(ctx context.Context, key, filePath string) error {
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
+	// Hash the file for its metadata, then upload it from the start
+	metadata, err := s.newObjectMetadata(kind, revisions, file)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek file %s: %w", filePath, err)
+	}
+
 	// Prepare S3 key with prefix
 	s3Key := key
 	if s.config.S3KeyPrefix() != "" {
@@ -44,6 +56,10 @@ func (s *S3Client) UploadFile(ctx context.Context, key, filePath string) error {
 		Body:         file,
 		ContentLength: aws.Int64(fileInfo.Size()),
 		StorageClass: types.StorageClass(storageClass),
+		Metadata:     metadata.s3Metadata(),
+	}
+	if input.ChecksumSHA256, err = s.checksumHeader(metadata.SHA256); err != nil {
+		return err
 	}
 
 	// Set server-side encryption
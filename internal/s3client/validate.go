@@ -0,0 +1,142 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/objectstore"
+)
+
+// ErrBucketMisconfigured is returned by ValidateBucket when the bucket cannot
+// be used by netsy
+var ErrBucketMisconfigured = errors.New("S3 bucket is misconfigured")
+
+// bucketProbePrefix is the key prefix of the objects ValidateBucket writes to
+// check the bucket, which are deleted once checked
+const bucketProbePrefix = ".netsy/probe-"
+
+// prefixMarkerKey is the key of the marker object created under the key
+// prefix (see s3_create_prefix_marker)
+const prefixMarkerKey = ".netsy/marker"
+
+// prefixMarker is the content of the prefix marker object
+type prefixMarker struct {
+	InstanceID string    `json:"instance_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ValidateBucket checks that the bucket exists, that objects can be written
+// under the key prefix, that conditional writes are supported (which netsy
+// relies on to detect more than one writer) and that objects are encrypted
+// as configured, by writing and then deleting a probe object. It returns an
+// error wrapping ErrBucketMisconfigured describing the first problem found.
+// A bucket with a default object lock retention is warned about, as chunk
+// files cannot be deleted until their retention expires. If configured, the
+// prefix marker object is then created.
+func (s *S3Client) ValidateBucket(ctx context.Context) (err error) {
+	bucket := s.config.S3BucketName()
+	location := fmt.Sprintf("s3://%s/%s", bucket, s.config.S3KeyPrefix())
+	if _, err = s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &bucket}); err != nil {
+		return fmt.Errorf("%w: bucket %s does not exist or is not accessible: %w", ErrBucketMisconfigured, bucket, err)
+	}
+
+	// write the probe object, then check that writing it again fails
+	probeKey := fmt.Sprintf("%s%s-%d", bucketProbePrefix, s.config.InstanceID(), time.Now().UnixNano())
+	if _, err = s.ConditionalPut(ctx, probeKey, []byte("netsy"), objectstore.IfNotExists()); err != nil {
+		return fmt.Errorf("%w: unable to write to %s: %w", ErrBucketMisconfigured, location, err)
+	}
+	defer func() {
+		if deleteErr := s.DeleteFile(ctx, probeKey); deleteErr != nil {
+			level.Warn(s.logger).Log("msg", "failed to delete S3 bucket probe object", "key", s.objectKey(probeKey), "error", deleteErr)
+		}
+	}()
+	_, err = s.ConditionalPut(ctx, probeKey, []byte("netsy"), objectstore.IfNotExists())
+	if err == nil {
+		return fmt.Errorf("%w: %s does not support conditional writes (If-None-Match), which netsy requires to detect more than one writer", ErrBucketMisconfigured, location)
+	} else if !errors.Is(err, objectstore.ErrPreconditionFailed) {
+		return fmt.Errorf("%w: unable to check conditional writes to %s: %w", ErrBucketMisconfigured, location, err)
+	}
+
+	if err = s.checkEncryption(ctx, probeKey); err != nil {
+		return fmt.Errorf("%w: %w", ErrBucketMisconfigured, err)
+	}
+	s.checkObjectLock(ctx)
+
+	if s.config.S3CreatePrefixMarker() {
+		if err = s.createPrefixMarker(ctx); err != nil {
+			return fmt.Errorf("%w: unable to create prefix marker in %s: %w", ErrBucketMisconfigured, location, err)
+		}
+	}
+	level.Info(s.logger).Log("msg", "S3 bucket validated", "location", location)
+	return nil
+}
+
+// checkEncryption returns an error if the object at key is not encrypted
+// with the configured server-side encryption (and KMS key, if configured),
+// e.g. as an S3-compatible store ignored the encryption requested
+func (s *S3Client) checkEncryption(ctx context.Context, key string) error {
+	var expected types.ServerSideEncryption
+	switch s.config.S3Encryption() {
+	case "aws:kms":
+		expected = types.ServerSideEncryptionAwsKms
+	case "AES256":
+		expected = types.ServerSideEncryptionAes256
+	default:
+		return nil
+	}
+	bucket, s3Key := s.config.S3BucketName(), s.objectKey(key)
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &bucket, Key: &s3Key})
+	if err != nil {
+		return fmt.Errorf("unable to read the encryption of %s: %w", s3Key, err)
+	}
+	if output.ServerSideEncryption != expected {
+		return fmt.Errorf("objects are encrypted with %q rather than %q (s3_encryption)", output.ServerSideEncryption, expected)
+	}
+	if kmsKeyID := s.config.S3KMSKeyID(); expected == types.ServerSideEncryptionAwsKms && kmsKeyID != "" &&
+		!strings.HasSuffix(aws.ToString(output.SSEKMSKeyId), kmsKeyID) {
+		return fmt.Errorf("objects are encrypted with KMS key %q rather than %q (s3_kms_key_id)", aws.ToString(output.SSEKMSKeyId), kmsKeyID)
+	}
+	return nil
+}
+
+// checkObjectLock warns if the bucket has a default object lock retention.
+// Stores which do not support object lock are not warned about.
+func (s *S3Client) checkObjectLock(ctx context.Context) {
+	bucket := s.config.S3BucketName()
+	output, err := s.client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{Bucket: &bucket})
+	if err != nil || output.ObjectLockConfiguration == nil {
+		return
+	}
+	lock := output.ObjectLockConfiguration
+	if lock.ObjectLockEnabled == types.ObjectLockEnabledEnabled && lock.Rule != nil && lock.Rule.DefaultRetention != nil {
+		level.Warn(s.logger).Log("msg", "S3 bucket has a default object lock retention, so chunk files cannot be deleted by chunk retention or coalescing until it expires", "bucket", bucket, "mode", lock.Rule.DefaultRetention.Mode)
+	}
+}
+
+// createPrefixMarker creates the prefix marker object, recording this
+// instance, unless it already exists
+func (s *S3Client) createPrefixMarker(ctx context.Context) error {
+	data, err := json.Marshal(prefixMarker{InstanceID: s.config.InstanceID(), CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	_, err = s.ConditionalPut(ctx, prefixMarkerKey, data, objectstore.IfNotExists())
+	if errors.Is(err, objectstore.ErrPreconditionFailed) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	level.Info(s.logger).Log("msg", "created S3 prefix marker", "key", s.objectKey(prefixMarkerKey))
+	return nil
+}
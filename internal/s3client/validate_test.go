@@ -0,0 +1,208 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+)
+
+// fakeBucket is an in-memory S3 bucket, which may ignore conditional writes
+// or server-side encryption as some S3-compatible stores do
+type fakeBucket struct {
+	ignoreConditions bool
+	ignoreEncryption bool
+	mu               sync.Mutex
+	objects          map[string]string
+	encryption       map[string]string
+	// versions are the ETags of objects, and metadata their user metadata
+	// headers, which are only recorded once set
+	versions map[string]int
+	metadata map[string]http.Header
+	// lists counts ListObjectsV2 requests
+	lists int
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/netsy/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		b.lists++
+		b.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("start-after"))
+	case r.URL.Path == "/netsy" || r.URL.Path == "/netsy/":
+		// HeadBucket and GetObjectLockConfiguration
+		if r.URL.Query().Has("object-lock") {
+			http.Error(w, "", http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		if _, ok := b.objects[key]; ok && r.Header.Get("If-None-Match") == "*" && !b.ignoreConditions {
+			http.Error(w, "", http.StatusPreconditionFailed)
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != b.etag(key) && !b.ignoreConditions {
+			http.Error(w, "", http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		b.objects[key] = string(data)
+		if !b.ignoreEncryption {
+			b.encryption[key] = r.Header.Get("X-Amz-Server-Side-Encryption")
+		}
+		if b.versions != nil {
+			b.versions[key]++
+			b.metadata[key] = http.Header{}
+			for name, values := range r.Header {
+				if strings.HasPrefix(name, "X-Amz-Meta-") {
+					b.metadata[key][name] = values
+				}
+			}
+		}
+		w.Header().Set("ETag", b.etag(key))
+	case r.Method == http.MethodGet:
+		data, ok := b.objects[key]
+		if !ok {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, data)
+	case r.Method == http.MethodHead:
+		if _, ok := b.objects[key]; !ok {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		if encryption := b.encryption[key]; encryption != "" {
+			w.Header().Set("X-Amz-Server-Side-Encryption", encryption)
+		}
+		w.Header().Set("ETag", b.etag(key))
+		for name, values := range b.metadata[key] {
+			w.Header()[name] = values
+		}
+	case r.Method == http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// etag returns the ETag of the object at key
+func (b *fakeBucket) etag(key string) string {
+	return fmt.Sprintf(`"%d"`, max(b.versions[key], 1))
+}
+
+// list writes a ListObjectsV2 response of the objects with prefix after
+// startAfter, in a single page
+func (b *fakeBucket) list(w http.ResponseWriter, prefix string, startAfter string) {
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) && key > startAfter {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	fmt.Fprintf(w, "<ListBucketResult><Name>netsy</Name><Prefix>%s</Prefix><KeyCount>%d</KeyCount><IsTruncated>false</IsTruncated>", prefix, len(keys))
+	for _, key := range keys {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", key, len(b.objects[key]))
+	}
+	io.WriteString(w, "</ListBucketResult>")
+}
+
+func newTestS3Client(t *testing.T, handler http.Handler, settings map[string]any) *S3Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	configtest.Set(t, map[string]any{
+		"s3_enabled":           true,
+		"s3_bucket_name":       "netsy",
+		"s3_key_prefix":        "cluster",
+		"s3_region":            "us-east-1",
+		"s3_endpoint":          server.URL,
+		"s3_force_path_style":  true,
+		"s3_access_key_id":     "test",
+		"s3_secret_access_key": "test",
+		"s3_encryption":        "AES256",
+		"instance_id":          "test",
+	})
+	configtest.Set(t, settings)
+	client, err := New(&config.Config{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return client
+}
+
+func TestValidateBucket(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string]string{}, encryption: map[string]string{}}
+	client := newTestS3Client(t, bucket, map[string]any{"s3_create_prefix_marker": true})
+	if err := client.ValidateBucket(context.Background()); err != nil {
+		t.Fatalf("ValidateBucket: %v", err)
+	}
+	// the probe object is deleted, and the marker is left
+	if len(bucket.objects) != 1 || !strings.Contains(bucket.objects["cluster/"+prefixMarkerKey], `"instance_id":"test"`) {
+		t.Fatalf("expected only the prefix marker to remain, got %v", bucket.objects)
+	}
+	// an existing marker is kept
+	bucket.objects["cluster/"+prefixMarkerKey] = "existing"
+	if err := client.ValidateBucket(context.Background()); err != nil || bucket.objects["cluster/"+prefixMarkerKey] != "existing" {
+		t.Fatalf("expected existing prefix marker to be kept, got %v (%v)", bucket.objects, err)
+	}
+}
+
+func TestValidateBucketMisconfigured(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+		expect  string
+	}{
+		{
+			name: "missing bucket",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "", http.StatusNotFound)
+			}),
+			expect: "does not exist",
+		},
+		{
+			name: "read only",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					http.Error(w, "", http.StatusForbidden)
+				}
+			}),
+			expect: "unable to write",
+		},
+		{
+			name:    "no conditional writes",
+			handler: &fakeBucket{ignoreConditions: true, objects: map[string]string{}, encryption: map[string]string{}},
+			expect:  "does not support conditional writes",
+		},
+		{
+			name:    "no encryption",
+			handler: &fakeBucket{ignoreEncryption: true, objects: map[string]string{}, encryption: map[string]string{}},
+			expect:  "s3_encryption",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTestS3Client(t, test.handler, nil)
+			err := client.ValidateBucket(context.Background())
+			if !errors.Is(err, ErrBucketMisconfigured) || !strings.Contains(err.Error(), test.expect) {
+				t.Fatalf("expected ErrBucketMisconfigured containing %q, got %v", test.expect, err)
+			}
+		})
+	}
+}
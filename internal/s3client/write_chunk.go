@@ -4,41 +4,168 @@
 package s3client
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/objectstore"
+	pb "github.com/nadrama-com/netsy/internal/proto"
 )
 
-// WriteChunkFile writes a chunk file to S3
-func (s *S3Client) WriteChunkFile(ctx context.Context, key string, data io.Reader) error {
+// ErrChunkConflict is returned when writing a chunk file which already exists
+// with different records, meaning another instance has written the same
+// revisions, i.e. there is more than one writer (split brain)
+var ErrChunkConflict = errors.New("chunk file was written by another writer")
+
+// WriteChunkFile writes a chunk file to S3. If the chunk already exists
+// (e.g. when the leader retries a write after a crash) and contains the same
+// records, the write is treated as successful, so that retries are idempotent.
+// If it contains different records, ErrChunkConflict is returned.
+// revisions is recorded in the file's metadata (see ObjectMetadata).
+func (s *S3Client) WriteChunkFile(ctx context.Context, key string, data io.Reader, revisions RevisionRange) error {
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(buf, data); err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+
+	// Use conditional write to prevent overwrite
+	_, err := s.putChunkFile(ctx, key, bytes.NewReader(buf.Bytes()), pb.FileKind_KIND_CHUNK, revisions, objectstore.IfNotExists())
+	if err == nil || !errors.Is(err, objectstore.ErrPreconditionFailed) {
+		return err
+	}
+
+	// Compare records rather than bytes, as the header includes a timestamp
+	same, cmpErr := s.chunkMatches(ctx, key, buf.Bytes())
+	if cmpErr != nil {
+		return fmt.Errorf("chunk %s already exists and could not be compared: %w", key, cmpErr)
+	}
+	if !same {
+		return fmt.Errorf("chunk %s already exists with different records: %w: %w", key, ErrChunkConflict, err)
+	}
+	level.Info(s.logger).Log("msg", "chunk file already exists with identical records, treating as written", "key", key)
+	return nil
+}
+
+// isPreconditionFailed returns true if err is an S3 conditional write failure
+func isPreconditionFailed(err error) bool {
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusPreconditionFailed
+}
+
+// chunkMatches downloads the existing chunk file at key and returns true if
+// it contains the same records as data
+func (s *S3Client) chunkMatches(ctx context.Context, key string, data []byte) (bool, error) {
+	body, err := s.downloadSmallFile(ctx, s.objectKey(key))
+	if err != nil {
+		return false, fmt.Errorf("failed to download existing chunk: %w", err)
+	}
+	defer body.Close()
+	existing, err := io.ReadAll(body)
+	if err != nil {
+		return false, fmt.Errorf("failed to read existing chunk: %w", err)
+	}
+
+	existingResults, err := s.readChunkResults(ctx, existing)
+	if err != nil {
+		return false, fmt.Errorf("failed to read existing chunk: %w", err)
+	}
+	newResults, err := s.readChunkResults(ctx, data)
+	if err != nil {
+		return false, fmt.Errorf("failed to read new chunk: %w", err)
+	}
+	// compare records only, as e.g. the schema version may differ
+	return existingResults.RecordsCrc == newResults.RecordsCrc &&
+		existingResults.RecordsCount == newResults.RecordsCount &&
+		existingResults.FirstRevision == newResults.FirstRevision &&
+		existingResults.LastRevision == newResults.LastRevision, nil
+}
+
+// readChunkResults reads and verifies all records in chunk file data
+func (s *S3Client) readChunkResults(ctx context.Context, data []byte) (results datafile.ReadResults, err error) {
+	reader, err := datafile.NewReaderWithDictionaries(bufio.NewReader(bytes.NewReader(data)), nil, s.DictionaryLoader(ctx))
+	if err != nil {
+		return results, err
+	}
+	defer reader.Release()
+	for i := int64(0); i < reader.Count(); i++ {
+		if _, err = reader.Read(); err != nil {
+			return results, err
+		}
+	}
+	return reader.Close()
+}
+
+// ReplaceChunkFile overwrites an existing chunk file in S3, but only if it
+// still has the given ETag, i.e. it has not been replaced since it was listed
+func (s *S3Client) ReplaceChunkFile(ctx context.Context, key string, etag string, data io.Reader, revisions RevisionRange) error {
+	_, err := s.putChunkFile(ctx, key, data, pb.FileKind_KIND_CHUNK, revisions, objectstore.IfVersion(etag))
+	return err
+}
+
+var _ objectstore.ConditionalPutter = (*S3Client)(nil)
+
+// ConditionalPut implements objectstore.ConditionalPutter, writing data to
+// key as-is (i.e. without data file metadata). Versions are ETags.
+func (s *S3Client) ConditionalPut(ctx context.Context, key string, data []byte, cond objectstore.Condition) (version string, err error) {
+	return s.putChunkFile(ctx, key, bytes.NewReader(data), pb.FileKind_KIND_UNKNOWN, RevisionRange{}, cond)
+}
+
+// putChunkFile uploads a file to S3 if cond holds, returning its ETag.
+// Data files of the given kind have revisions recorded in their metadata,
+// files which are not data files (KIND_UNKNOWN) have no metadata.
+func (s *S3Client) putChunkFile(ctx context.Context, key string, data io.Reader, kind pb.FileKind, revisions RevisionRange, cond objectstore.Condition) (version string, err error) {
 	// Read data into memory buffer to get content length
 	buf := &bytes.Buffer{}
-	_, err := io.Copy(buf, data)
+	_, err = io.Copy(buf, data)
 	if err != nil {
-		return fmt.Errorf("failed to read data: %w", err)
+		return "", fmt.Errorf("failed to read data: %w", err)
 	}
 
 	// Prepare S3 key with prefix
-	s3Key := key
-	if s.config.S3KeyPrefix() != "" {
-		s3Key = s.config.S3KeyPrefix() + "/" + key
-	}
+	s3Key := s.objectKey(key)
 
-	// Prepare put object input with conditional write to prevent overwrite
+	// Prepare put object input
 	bucketName := s.config.S3BucketName()
 	storageClass := s.config.S3StorageClass()
 	input := &s3.PutObjectInput{
-		Bucket:           &bucketName,
-		Key:              &s3Key,
-		Body:             bytes.NewReader(buf.Bytes()),
-		IfNoneMatch:      aws.String("*"), // Fail if object already exists
-		StorageClass:     types.StorageClass(storageClass),
+		Bucket:       &bucketName,
+		Key:          &s3Key,
+		Body:         bytes.NewReader(buf.Bytes()),
+		StorageClass: types.StorageClass(storageClass),
+	}
+	if kind != pb.FileKind_KIND_UNKNOWN {
+		metadata, err := s.newObjectMetadata(kind, revisions, bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return "", err
+		}
+		input.Metadata = metadata.s3Metadata()
+		if input.ChecksumSHA256, err = s.checksumHeader(metadata.SHA256); err != nil {
+			return "", err
+		}
+	} else if s.config.S3Checksums() {
+		hash, err := sha256Hex(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return "", err
+		}
+		if input.ChecksumSHA256, err = s.checksumHeader(hash); err != nil {
+			return "", err
+		}
+	}
+	switch {
+	case cond.IfNotExists:
+		input.IfNoneMatch = aws.String("*") // Fail if object already exists
+	case cond.IfVersion != "":
+		input.IfMatch = aws.String(cond.IfVersion) // Fail if object has changed
 	}
 
 	// Set server-side encryption
@@ -53,11 +180,14 @@ func (s *S3Client) WriteChunkFile(ctx context.Context, key string, data io.Reade
 	}
 
 	// Upload to S3
-	_, err = s.client.PutObject(ctx, input)
+	output, err := s.client.PutObject(ctx, input)
+	if isPreconditionFailed(err) {
+		return "", fmt.Errorf("failed to upload to S3: %w: %w", objectstore.ErrPreconditionFailed, err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to upload to S3: %w", err)
+		return "", fmt.Errorf("failed to upload to S3: %w", err)
 	}
 
 	level.Debug(s.logger).Log("msg", "chunk file uploaded to S3", "key", s3Key, "bucket", s.config.S3BucketName())
-	return nil
+	return aws.ToString(output.ETag), nil
 }
@@ -0,0 +1,63 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package s3client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "github.com/nadrama-com/netsy/internal/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestWriteRecordsExistingChunk(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string]string{}, encryption: map[string]string{}}
+	client := newTestS3Client(t, bucket, nil)
+	createdAt := timestamppb.Now()
+	record := func(value string) *pb.Record {
+		return &pb.Record{
+			Revision:       1,
+			Key:            []byte("/a"),
+			Created:        true,
+			CreateRevision: 1,
+			Version:        1,
+			Value:          []byte(value),
+			LeaderId:       "test",
+			CreatedAt:      createdAt,
+		}
+	}
+	ctx := context.Background()
+	if err := client.WriteRecord(ctx, record("1")); err != nil {
+		t.Fatalf("WriteRecord: %v", err)
+	}
+	// a retry of the same record succeeds, keeping the existing chunk
+	written := bucket.objects["cluster/"+chunkKey(1)]
+	if err := client.WriteRecord(ctx, record("1")); err != nil {
+		t.Fatalf("expected retrying an identical chunk to succeed, got %v", err)
+	}
+	if bucket.objects["cluster/"+chunkKey(1)] != written {
+		t.Fatalf("expected the existing chunk to be kept")
+	}
+	// a different record at the same revision is a conflict
+	if err := client.WriteRecord(ctx, record("2")); !errors.Is(err, ErrChunkConflict) {
+		t.Fatalf("expected ErrChunkConflict, got %v", err)
+	}
+}
+
+func TestWriteRecordsSplitsChunks(t *testing.T) {
+	bucket := &fakeBucket{objects: map[string]string{}, encryption: map[string]string{}}
+	client := newTestS3Client(t, bucket, nil)
+	var records []*pb.Record
+	for revision := int64(1); revision <= MaxChunkRevisions+1; revision++ {
+		records = append(records, &pb.Record{Revision: revision, Key: []byte("/a"), Deleted: true, LeaderId: "test", CreatedAt: timestamppb.Now()})
+	}
+	if err := client.WriteRecords(context.Background(), records); err != nil {
+		t.Fatalf("WriteRecords: %v", err)
+	}
+	// chunks cover at most MaxChunkRevisions revisions
+	if len(bucket.objects) != 2 || bucket.objects["cluster/"+chunkKey(MaxChunkRevisions)] == "" || bucket.objects["cluster/"+chunkKey(MaxChunkRevisions+1)] == "" {
+		t.Fatalf("expected chunks at revisions %d and %d, got %d objects", MaxChunkRevisions, MaxChunkRevisions+1, len(bucket.objects))
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/go-kit/log/level"
 	"github.com/nadrama-com/netsy/internal/datafile"
@@ -16,22 +18,58 @@ import (
 
 // WriteRecord writes a single record to S3 as a chunk file
 func (s *S3Client) WriteRecord(ctx context.Context, record *pb.Record) error {
+	return s.WriteRecords(ctx, []*pb.Record{record})
+}
+
+// WriteRecords writes records committed together, at consecutive revisions,
+// to S3 as a single chunk file. As with coalesced chunks, the chunk is keyed
+// by the last revision, so chunk conflicts are detected at that revision.
+// More than MaxChunkRevisions records are written as several chunk files, in
+// order. If writing one fails, those already written are left in S3, and
+// conflict with the next records written at their revisions.
+func (s *S3Client) WriteRecords(ctx context.Context, records []*pb.Record) error {
+	if len(records) == 0 {
+		return fmt.Errorf("no records to write")
+	}
+	if len(records) > MaxChunkRevisions {
+		for batch := range slices.Chunk(records, MaxChunkRevisions) {
+			if err := s.WriteRecords(ctx, batch); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	first, last := records[0], records[len(records)-1]
+
 	// Create a buffer to write the chunk file data
 	buffer := &bytes.Buffer{}
 	bufWriter := bufio.NewWriter(buffer)
 
-	// Create datafile writer for a single record chunk
+	// Create datafile writer for the chunk
 	// Use the instance ID from config as the leader ID
+	// Compress using the chunk dictionary if there is one, as single records
+	// otherwise compress poorly
 	leaderID := s.config.InstanceID()
-	writer, err := datafile.NewWriter(bufWriter, pb.FileKind_KIND_CHUNK, 1, leaderID)
+	var writer *datafile.Writer
+	var err error
+	if dictionary := s.Dictionary(); dictionary != nil {
+		options := datafile.CompressionOptions{
+			Level:      int(s.config.ChunkCompressionLevel()),
+			WindowSize: int(s.config.ChunkCompressionWindowKB()) * 1024,
+		}
+		writer, err = datafile.NewWriterWithDictionary(bufWriter, pb.FileKind_KIND_CHUNK, int64(len(records)), leaderID, dictionary, options)
+	} else {
+		writer, err = datafile.NewWriter(bufWriter, pb.FileKind_KIND_CHUNK, int64(len(records)), leaderID)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create datafile writer: %w", err)
 	}
 
-	// Write the record
-	err = writer.Write(record)
-	if err != nil {
-		return fmt.Errorf("failed to write record: %w", err)
+	// Write the records
+	for _, record := range records {
+		if err = writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
 	}
 
 	// Close/flush writer
@@ -41,24 +79,24 @@ func (s *S3Client) WriteRecord(ctx context.Context, record *pb.Record) error {
 	}
 
 	// Generate S3 key for the chunk file
-	// Format: chunks/{partition}/{zero-padded-revision}.netsy
-	// Partition is modulo 10000 to avoid hot paths
-	// Revision is zero-padded to 19 characters (max int64)
-	partition := record.Revision % 10000
-	key := fmt.Sprintf("chunks/%04d/%019d.netsy", partition, record.Revision)
+	key := chunkKey(last.Revision)
+	revisions := RevisionRange{First: first.Revision, Last: last.Revision, Count: int64(len(records))}
 
-	// Upload to S3 with retry-once logic
-	err = s.WriteChunkFile(ctx, key, bytes.NewReader(buffer.Bytes()))
-	if err != nil {
+	// Upload to S3 with retry-once logic, except when another writer has
+	// written the chunk, as retrying cannot succeed
+	err = s.WriteChunkFile(ctx, key, bytes.NewReader(buffer.Bytes()), revisions)
+	if errors.Is(err, ErrChunkConflict) {
+		return err
+	} else if err != nil {
 		level.Debug(s.logger).Log("msg", "first S3 upload attempt failed, retrying once", "error", err, "key", key)
 		// Retry once on failure
-		err = s.WriteChunkFile(ctx, key, bytes.NewReader(buffer.Bytes()))
+		err = s.WriteChunkFile(ctx, key, bytes.NewReader(buffer.Bytes()), revisions)
 		if err != nil {
 			return fmt.Errorf("S3 upload failed after retry: %w", err)
 		}
 		level.Info(s.logger).Log("msg", "S3 upload succeeded on retry", "key", key)
 	}
 
-	level.Debug(s.logger).Log("msg", "record written to S3", "revision", record.Revision, "key", key)
+	level.Debug(s.logger).Log("msg", "records written to S3", "first_revision", first.Revision, "revision", last.Revision, "records", len(records), "key", key)
 	return nil
 }
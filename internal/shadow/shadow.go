@@ -0,0 +1,542 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package shadow runs netsy in shadow of a real etcd cluster, so that
+// cautious operators can validate netsy before cutting over. Every write
+// committed by netsy is forwarded to etcd, and their keys are periodically
+// compared, reporting any keys which diverged. etcd must start with the same
+// keys as netsy, as only writes committed once shadowing starts are
+// forwarded.
+package shadow
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/hooks"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/metrics"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// queueSize is the number of commits which may wait to be forwarded,
+	// beyond which commits are dropped rather than block writes
+	queueSize = 10000
+	// forwardTimeout bounds each write forwarded to etcd
+	forwardTimeout = 10 * time.Second
+	// catchUpTimeout is how long a comparison waits for the writes
+	// committed before it to be forwarded, after which it is skipped
+	catchUpTimeout = 30 * time.Second
+	// holdBackTimeout is how long commits are held back waiting for the
+	// commit of an earlier revision, after which it is skipped
+	holdBackTimeout = time.Second
+	// forwardAttempts is the number of times a write is attempted before
+	// it is skipped
+	forwardAttempts = 5
+	// pageSize is the number of keys read from each side at a time
+	pageSize = 1000
+	// maxDivergences is the number of divergent keys rechecked and reported
+	// by a comparison
+	maxDivergences = 100
+)
+
+// Ranger reads netsy's keys from the local database
+type Ranger interface {
+	LocalRange(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error)
+}
+
+// Options configures a Shadow
+type Options struct {
+	// Prefix is the prefix of the keys compared, or empty for all keys
+	Prefix string
+	// CompareInterval is how often keys are compared, or 0 to only forward
+	// writes
+	CompareInterval time.Duration
+}
+
+// Shadow forwards writes to etcd and compares their keys
+type Shadow struct {
+	logger  log.Logger
+	client  *clientv3.Client
+	ranger  Ranger
+	options Options
+
+	queue chan hooks.Commit
+	// enqueued and forwarded are the latest revisions queued and forwarded
+	// to etcd, so that comparisons can wait for writes to be forwarded.
+	// Writes which fail are not counted as forwarded.
+	enqueued   atomic.Int64
+	forwarded  atomic.Int64
+	unregister func()
+
+	// Context for shutdown, cancelled by Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks the forwarding and comparison goroutines
+	wg sync.WaitGroup
+}
+
+// divergence is a key which differs between netsy and etcd, where netsy or
+// etcd is nil if the key only exists on the other side
+type divergence struct {
+	key   []byte
+	netsy *mvccpb.KeyValue
+	etcd  *mvccpb.KeyValue
+}
+
+// kind returns how the key diverged, as reported by metrics
+func (d divergence) kind() string {
+	switch {
+	case d.etcd == nil:
+		return "missing_in_etcd"
+	case d.netsy == nil:
+		return "missing_in_netsy"
+	}
+	return "value_mismatch"
+}
+
+// NewFromConfig creates a Shadow for the configured etcd endpoints, which
+// reads netsy's keys with ranger. It returns nil if no endpoints are
+// configured.
+func NewFromConfig(logger log.Logger, c *config.Config, ranger Ranger) (*Shadow, error) {
+	if c.ShadowEtcdEndpoints() == "" {
+		return nil, nil
+	}
+	var endpoints []string
+	for _, endpoint := range strings.Split(c.ShadowEtcdEndpoints(), ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	tlsConfig, err := config.LoadEtcdClientTLS("shadow etcd", c.ShadowEtcdCA(), c.ShadowEtcdCert(), c.ShadowEtcdKey())
+	if err != nil {
+		return nil, err
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+		TLS:         tlsConfig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shadow etcd client: %w", err)
+	}
+	return New(logger, client, ranger, Options{
+		Prefix:          c.ShadowComparePrefix(),
+		CompareInterval: time.Duration(c.ShadowCompareIntervalSeconds()) * time.Second,
+	}), nil
+}
+
+// New creates a Shadow which forwards writes with client, and compares the
+// keys read with ranger against it. The Shadow owns client, which is closed
+// by Stop.
+func New(logger log.Logger, client *clientv3.Client, ranger Ranger, options Options) *Shadow {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Shadow{
+		logger:  logger,
+		client:  client,
+		ranger:  ranger,
+		options: options,
+		queue:   make(chan hooks.Commit, queueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start registers a commit hook with h which forwards writes to etcd, and
+// starts comparing keys every compare interval
+func (s *Shadow) Start(h *hooks.Hooks) {
+	level.Info(s.logger).Log("msg", "shadowing etcd", "endpoints", strings.Join(s.client.Endpoints(), ","), "compare_interval", s.options.CompareInterval)
+	s.unregister = h.OnCommit(s.enqueue)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runForward()
+	}()
+	if s.options.CompareInterval <= 0 {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.options.CompareInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.Compare(s.ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops forwarding writes, discarding writes not yet forwarded, and
+// closes the etcd client
+func (s *Shadow) Stop() {
+	if s.unregister != nil {
+		s.unregister()
+	}
+	s.cancel()
+	s.wg.Wait()
+	s.client.Close()
+}
+
+// enqueue queues a commit to be forwarded. It is called by the commit hook,
+// so drops the commit rather than block the write if the queue is full.
+func (s *Shadow) enqueue(c hooks.Commit) {
+	select {
+	case s.queue <- c:
+		storeMax(&s.enqueued, c.Revision)
+	default:
+		metrics.ShadowWrites.WithLabelValues("dropped").Inc()
+		level.Debug(s.logger).Log("msg", "shadow etcd forwarding queue full, dropping write", "key", keys.Key(c.Key), "rev", c.Revision)
+	}
+}
+
+// runForward forwards queued commits to etcd in revision order until Stop
+// is called. Concurrent writes may queue commits out of order, so each
+// commit is held back until the commit of the revision before it has been
+// forwarded. Revisions may have no commit, e.g. as it was dropped, or the
+// revision was skipped (see SetNextRevision), so once commits have been
+// held back for holdBackTimeout, the missing revisions are skipped. The
+// first commit is held back, as the revision before it is not known.
+func (s *Shadow) runForward() {
+	var pending commitHeap
+	// next is the revision of the next commit to forward, or 0 until the
+	// first commit is forwarded
+	var next int64
+	holdBack := time.NewTimer(holdBackTimeout)
+	holdBack.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case c := <-s.queue:
+			if c.Revision < next {
+				metrics.ShadowWrites.WithLabelValues("dropped").Inc()
+				level.Warn(s.logger).Log("msg", "dropping write queued after later writes were forwarded to shadow etcd", "key", keys.Key(c.Key), "rev", c.Revision)
+				continue
+			}
+			if len(pending) == 0 {
+				holdBack.Reset(holdBackTimeout)
+			}
+			heap.Push(&pending, c)
+		case <-holdBack.C:
+			if next > 0 {
+				level.Warn(s.logger).Log("msg", "skipping revisions not queued to be forwarded to shadow etcd", "from", next, "to", pending[0].Revision-1)
+			}
+			next = pending[0].Revision
+		}
+		forwarded := false
+		for len(pending) > 0 && pending[0].Revision == next {
+			c := heap.Pop(&pending).(hooks.Commit)
+			s.forward(c)
+			next, forwarded = c.Revision+1, true
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+		if len(pending) == 0 {
+			holdBack.Stop()
+		} else if forwarded {
+			holdBack.Reset(holdBackTimeout)
+		}
+	}
+}
+
+// forward writes a commit to etcd, retrying until it succeeds, so that
+// later writes are not forwarded before it, or until forwardAttempts have
+// failed, in which case it is skipped and the key is left to be reported
+// by the next comparison. Leases are not forwarded, as lease IDs differ
+// between netsy and etcd, but the deletion of keys when their lease ends
+// is.
+func (s *Shadow) forward(c hooks.Commit) {
+	var err error
+	for attempt := range forwardAttempts {
+		if attempt > 0 {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			}
+		}
+		ctx, cancel := context.WithTimeout(s.ctx, forwardTimeout)
+		if c.Deleted {
+			_, err = s.client.Delete(ctx, string(c.Key))
+		} else {
+			_, err = s.client.Put(ctx, string(c.Key), string(c.Value))
+		}
+		cancel()
+		if err == nil {
+			s.forwarded.Store(c.Revision)
+			metrics.ShadowWrites.WithLabelValues("forwarded").Inc()
+			return
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+	}
+	metrics.ShadowWrites.WithLabelValues("error").Inc()
+	level.Warn(s.logger).Log("msg", "failed to forward write to shadow etcd, skipping it", "key", keys.Key(c.Key), "rev", c.Revision, "attempts", forwardAttempts, "err", err)
+}
+
+// commitHeap is a min-heap of commits by revision (see container/heap)
+type commitHeap []hooks.Commit
+
+func (h commitHeap) Len() int           { return len(h) }
+func (h commitHeap) Less(i, j int) bool { return h[i].Revision < h[j].Revision }
+func (h commitHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *commitHeap) Push(x any)        { *h = append(*h, x.(hooks.Commit)) }
+func (h *commitHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// Compare compares netsy's keys with etcd's once the writes committed
+// before the comparison have been forwarded, logging each key which
+// diverged. Keys which differ are rechecked before they are reported, so
+// that keys written during the comparison are not reported. It returns the
+// number of keys which diverged.
+func (s *Shadow) Compare(ctx context.Context) (diverged int) {
+	start := time.Now()
+	compared, divergences, revision, err := s.compare(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			metrics.ShadowComparisons.WithLabelValues("error").Inc()
+			level.Warn(s.logger).Log("msg", "failed to compare keys with shadow etcd", "err", err)
+		}
+		return 0
+	}
+	if compared < 0 {
+		metrics.ShadowComparisons.WithLabelValues("skipped").Inc()
+		level.Warn(s.logger).Log("msg", "skipping shadow etcd comparison, writes have not been forwarded", "timeout", catchUpTimeout)
+		return 0
+	}
+
+	// keys committed during the comparison are forwarded before rechecking
+	if len(divergences) > 0 && !s.waitForwarded(ctx, s.enqueued.Load()) {
+		metrics.ShadowComparisons.WithLabelValues("skipped").Inc()
+		return 0
+	}
+	for _, d := range divergences {
+		confirmed, err := s.confirm(ctx, d, revision)
+		if err != nil {
+			metrics.ShadowComparisons.WithLabelValues("error").Inc()
+			level.Warn(s.logger).Log("msg", "failed to recheck key which diverged from shadow etcd", "key", keys.Key(d.key), "err", err)
+			return 0
+		}
+		if !confirmed {
+			continue
+		}
+		diverged++
+		metrics.ShadowDivergences.WithLabelValues(d.kind()).Inc()
+		level.Warn(s.logger).Log("msg", "key diverged from shadow etcd", "key", keys.Key(d.key), "kind", d.kind())
+	}
+	metrics.ShadowDivergentKeys.Set(float64(diverged))
+	if diverged > 0 {
+		metrics.ShadowComparisons.WithLabelValues("diverged").Inc()
+		level.Error(s.logger).Log("msg", "keys diverged from shadow etcd", "keys", compared, "diverged", diverged, "rev", revision, "duration", time.Since(start))
+		return diverged
+	}
+	metrics.ShadowComparisons.WithLabelValues("match").Inc()
+	level.Info(s.logger).Log("msg", "keys match shadow etcd", "keys", compared, "rev", revision, "duration", time.Since(start))
+	return 0
+}
+
+// compare walks netsy's keys at a revision and etcd's keys in key order,
+// returning the number of keys compared and up to maxDivergences keys which
+// differ. compared is -1 if writes were not forwarded in time.
+func (s *Shadow) compare(ctx context.Context) (compared int, divergences []divergence, revision int64, err error) {
+	key, rangeEnd := []byte{0}, []byte{0}
+	if s.options.Prefix != "" {
+		key, rangeEnd = []byte(s.options.Prefix), []byte(clientv3.GetPrefixRangeEnd(s.options.Prefix))
+	}
+
+	// the first page sets the revision netsy is read at, after which the
+	// writes committed before it must be forwarded before etcd is read
+	target := s.enqueued.Load()
+	netsy := &pager{key: key, rangeEnd: rangeEnd, fetch: s.fetchNetsy}
+	netsyKv, err := netsy.next(ctx)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	revision = netsy.revision
+	if !s.waitForwarded(ctx, target) {
+		return -1, nil, revision, ctx.Err()
+	}
+	etcd := &pager{key: key, rangeEnd: rangeEnd, fetch: s.fetchEtcd}
+	etcdKv, err := etcd.next(ctx)
+	if err != nil {
+		return 0, nil, revision, err
+	}
+
+	for netsyKv != nil || etcdKv != nil {
+		var d *divergence
+		cmp := 0
+		switch {
+		case netsyKv == nil:
+			cmp = 1
+		case etcdKv == nil:
+			cmp = -1
+		default:
+			cmp = bytes.Compare(netsyKv.Key, etcdKv.Key)
+		}
+		switch {
+		case cmp < 0:
+			d = &divergence{key: netsyKv.Key, netsy: netsyKv}
+		case cmp > 0:
+			d = &divergence{key: etcdKv.Key, etcd: etcdKv}
+		case !bytes.Equal(netsyKv.Value, etcdKv.Value):
+			d = &divergence{key: netsyKv.Key, netsy: netsyKv, etcd: etcdKv}
+		}
+		if d != nil && len(divergences) < maxDivergences {
+			divergences = append(divergences, *d)
+		}
+		compared++
+		if cmp <= 0 {
+			if netsyKv, err = netsy.next(ctx); err != nil {
+				return 0, nil, revision, err
+			}
+		}
+		if cmp >= 0 {
+			if etcdKv, err = etcd.next(ctx); err != nil {
+				return 0, nil, revision, err
+			}
+		}
+	}
+	return compared, divergences, revision, nil
+}
+
+// confirm rechecks a key which diverged in a comparison at revision,
+// returning true if it still differs. Keys written in netsy since revision
+// are not confirmed, as etcd may have been read after the write was
+// forwarded; they are compared again by the next comparison.
+func (s *Shadow) confirm(ctx context.Context, d divergence, revision int64) (bool, error) {
+	resp, err := s.ranger.LocalRange(ctx, &pb.RangeRequest{Key: d.key})
+	if err != nil {
+		return false, err
+	}
+	var latest *mvccpb.KeyValue
+	if len(resp.Kvs) > 0 {
+		latest = resp.Kvs[0]
+	}
+	if (latest != nil && latest.ModRevision > revision) || (latest == nil && d.netsy != nil) {
+		return false, nil
+	}
+	etcdResp, err := s.client.Get(ctx, string(d.key))
+	if err != nil {
+		return false, err
+	}
+	var current *mvccpb.KeyValue
+	if len(etcdResp.Kvs) > 0 {
+		current = etcdResp.Kvs[0]
+	}
+	if latest == nil || current == nil {
+		return latest != current, nil
+	}
+	return !bytes.Equal(latest.Value, current.Value), nil
+}
+
+// waitForwarded waits for the writes up to revision to be forwarded,
+// returning false if they are not forwarded within catchUpTimeout
+func (s *Shadow) waitForwarded(ctx context.Context, revision int64) bool {
+	timeout := time.NewTimer(catchUpTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for s.forwarded.Load() < revision {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timeout.C:
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// fetchNetsy reads a page of netsy's keys from key, at the revision of the
+// first page
+func (s *Shadow) fetchNetsy(ctx context.Context, key, rangeEnd []byte, revision int64) (kvs []*mvccpb.KeyValue, more bool, rev int64, err error) {
+	resp, err := s.ranger.LocalRange(ctx, &pb.RangeRequest{Key: key, RangeEnd: rangeEnd, Limit: pageSize, Revision: revision})
+	if err != nil {
+		return nil, false, 0, err
+	}
+	return resp.Kvs, resp.More, resp.Header.Revision, nil
+}
+
+// fetchEtcd reads a page of etcd's keys from key, at the revision of the
+// first page
+func (s *Shadow) fetchEtcd(ctx context.Context, key, rangeEnd []byte, revision int64) (kvs []*mvccpb.KeyValue, more bool, rev int64, err error) {
+	resp, err := s.client.Get(ctx, string(key),
+		clientv3.WithRange(string(rangeEnd)),
+		clientv3.WithLimit(pageSize),
+		clientv3.WithRev(revision),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, false, 0, err
+	}
+	return resp.Kvs, resp.More, resp.Header.Revision, nil
+}
+
+// pager iterates over the keys of a range in key order, a page at a time.
+// Every page is read at the revision of the first page.
+type pager struct {
+	key, rangeEnd []byte
+	fetch         func(ctx context.Context, key, rangeEnd []byte, revision int64) (kvs []*mvccpb.KeyValue, more bool, rev int64, err error)
+	revision      int64
+	kvs           []*mvccpb.KeyValue
+	more          bool
+	fetched       bool
+}
+
+// next returns the next key-value, or nil once all have been returned
+func (p *pager) next(ctx context.Context) (*mvccpb.KeyValue, error) {
+	if len(p.kvs) == 0 {
+		if p.fetched && !p.more {
+			return nil, nil
+		}
+		kvs, more, rev, err := p.fetch(ctx, p.key, p.rangeEnd, p.revision)
+		if err != nil {
+			return nil, err
+		}
+		if !p.fetched {
+			p.revision = rev
+		}
+		p.kvs, p.more, p.fetched = kvs, more, true
+		if len(kvs) == 0 {
+			return nil, nil
+		}
+		// the next page starts after the last key of this page
+		p.key = append(bytes.Clone(kvs[len(kvs)-1].Key), 0)
+	}
+	kv := p.kvs[0]
+	p.kvs = p.kvs[1:]
+	return kv, nil
+}
+
+// storeMax sets v to revision if it is greater
+func storeMax(v *atomic.Int64, revision int64) {
+	for {
+		current := v.Load()
+		if revision <= current || v.CompareAndSwap(current, revision) {
+			return
+		}
+	}
+}
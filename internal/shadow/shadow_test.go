@@ -0,0 +1,141 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package shadow
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/hooks"
+	"github.com/nadrama-com/netsy/internal/etcdtest"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// testRanger serves Range requests from a map of keys, ignoring the
+// requested revision
+type testRanger struct {
+	mu       sync.Mutex
+	revision int64
+	kvs      map[string]*mvccpb.KeyValue
+}
+
+func (r *testRanger) put(key, value string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revision++
+	r.kvs[key] = &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: r.revision}
+	return r.revision
+}
+
+func (r *testRanger) LocalRange(ctx context.Context, req *pb.RangeRequest) (*pb.RangeResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for key := range r.kvs {
+		inRange := key == string(req.Key)
+		if len(req.RangeEnd) > 0 {
+			inRange = key >= string(req.Key) && (string(req.RangeEnd) == "\x00" || key < string(req.RangeEnd))
+		}
+		if inRange {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	resp := &pb.RangeResponse{Header: &pb.ResponseHeader{Revision: r.revision}, Count: int64(len(keys))}
+	if req.Limit > 0 && int64(len(keys)) > req.Limit {
+		keys, resp.More = keys[:req.Limit], true
+	}
+	for _, key := range keys {
+		resp.Kvs = append(resp.Kvs, r.kvs[key])
+	}
+	return resp, nil
+}
+
+func TestShadow(t *testing.T) {
+	client := etcdtest.Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ranger := &testRanger{kvs: map[string]*mvccpb.KeyValue{}}
+	// etcd starts with the same keys as netsy
+	for _, key := range []string{"/registry/a", "/registry/b", "/other"} {
+		ranger.put(key, strings.ToUpper(key))
+		if _, err := client.Put(ctx, key, strings.ToUpper(key)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	s := New(log.NewNopLogger(), client, ranger, Options{Prefix: "/registry/"})
+	h := hooks.New()
+	s.Start(h)
+	defer s.Stop()
+
+	// writes are forwarded to etcd
+	rev := ranger.put("/registry/c", "C")
+	h.FireCommit(hooks.Commit{Revision: rev, Key: []byte("/registry/c"), Value: []byte("C"), Created: true})
+	if diverged := s.Compare(ctx); diverged != 0 {
+		t.Fatalf("expected keys to match, got %d divergent keys", diverged)
+	}
+	resp, err := client.Get(ctx, "/registry/c")
+	if err != nil || len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "C" {
+		t.Fatalf("expected write to be forwarded, got %v (%v)", resp, err)
+	}
+
+	// keys which differ are reported, except outside the prefix
+	ranger.put("/registry/a", "changed")
+	ranger.put("/other", "changed")
+	if _, err = client.Put(ctx, "/registry/d", "D"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err = client.Delete(ctx, "/registry/b"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if diverged := s.Compare(ctx); diverged != 3 {
+		t.Fatalf("expected 3 divergent keys, got %d", diverged)
+	}
+}
+
+// TestShadowForwardOrder checks that writes are forwarded in revision order,
+// even if they are queued out of order, and that revisions which are never
+// queued are skipped
+func TestShadowForwardOrder(t *testing.T) {
+	client := etcdtest.Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	s := New(log.NewNopLogger(), client, &testRanger{kvs: map[string]*mvccpb.KeyValue{}}, Options{})
+	h := hooks.New()
+	s.Start(h)
+	defer s.Stop()
+	put := func(revision int64, value string) {
+		h.FireCommit(hooks.Commit{Revision: revision, Key: []byte("/a"), Value: []byte(value)})
+	}
+
+	put(1, "1")
+	if !s.waitForwarded(ctx, 1) {
+		t.Fatalf("expected revision 1 to be forwarded")
+	}
+	// revision 3 is held back until revision 2 is forwarded
+	put(3, "3")
+	time.Sleep(holdBackTimeout / 2)
+	put(2, "2")
+	if !s.waitForwarded(ctx, 3) {
+		t.Fatalf("expected revision 3 to be forwarded")
+	}
+	resp, err := client.Get(ctx, "/a")
+	if err != nil || len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "3" {
+		t.Fatalf("expected the write at revision 3 to be forwarded last, got %v (%v)", resp, err)
+	}
+
+	// revision 4 is never queued, so is skipped once revision 5 has been
+	// held back
+	put(5, "5")
+	if !s.waitForwarded(ctx, 5) {
+		t.Fatalf("expected revision 5 to be forwarded")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+// coalesceGroup is a run of chunk files with contiguous revisions which will
+// be merged into a single chunk file
+type coalesceGroup struct {
+	chunks  []s3client.FileInfo
+	records []*proto.Record
+	size    int64
+}
+
+// add appends a chunk and its records to the group, skipping any records
+// already in the group (e.g. when an earlier coalesce was interrupted before
+// its source chunks were deleted). It returns false without modifying the
+// group if the chunk's records do not directly follow the group's records,
+// or the group would cover more than s3client.MaxChunkRevisions revisions.
+func (g *coalesceGroup) add(chunk s3client.FileInfo, records []*proto.Record) bool {
+	var lastRevision int64
+	if len(g.records) > 0 {
+		lastRevision = g.records[len(g.records)-1].Revision
+	}
+	var newRecords []*proto.Record
+	for _, record := range records {
+		if record.Revision > lastRevision {
+			newRecords = append(newRecords, record)
+		}
+	}
+	if lastRevision > 0 && len(newRecords) > 0 && newRecords[0].Revision != lastRevision+1 {
+		return false
+	}
+	if len(g.records) > 0 && len(newRecords) > 0 && newRecords[len(newRecords)-1].Revision-g.records[0].Revision >= s3client.MaxChunkRevisions {
+		return false
+	}
+	g.chunks = append(g.chunks, chunk)
+	g.records = append(g.records, newRecords...)
+	g.size += chunk.Size
+	return true
+}
+
+// coalesceChunks merges runs of small chunk files with contiguous revisions
+// into fewer larger chunk files, which reduces S3 per-object costs and speeds
+// up backfill. Each merged chunk replaces the last chunk of its run (so it is
+// named by its last revision, like any other chunk), after which the other
+// chunks in the run are deleted. Backfill skips records it has already
+// imported, so chunks are consistent at every step.
+func (w *Worker) coalesceChunks() {
+	// Skip if S3 is not enabled
+	if w.s3Client == nil {
+		return
+	}
+
+	// Prevent snapshot creation running at the same time. The retention
+	// worker only deletes chunks covered by a snapshot, which are never
+	// coalesced (only chunks after the last snapshot are).
+	w.snapshotMutex.Lock()
+	defer w.snapshotMutex.Unlock()
+
+	w.stateMutex.Lock()
+	lastSnapshotRevision := w.lastSnapshotRevision
+	w.stateMutex.Unlock()
+
+	chunks, err := w.s3Client.ListChunks(w.ctx, lastSnapshotRevision)
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to list chunks for coalescing", "error", err)
+		return
+	}
+	if len(chunks) < 2 {
+		return
+	}
+
+	targetSize := w.config.ChunkCoalesceTargetSizeMB() * 1024 * 1024
+	var tempFiles []string
+	defer func() {
+		for _, file := range tempFiles {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				level.Warn(w.logger).Log("msg", "failed to clean up temporary file", "file", file, "error", err)
+			}
+		}
+	}()
+
+	group := &coalesceGroup{}
+	merged := 0
+	for _, chunk := range chunks {
+		// chunks at or above the target size are left as they are
+		if chunk.Size >= targetSize {
+			merged += w.flushCoalesceGroup(group)
+			group = &coalesceGroup{}
+			continue
+		}
+		records, err := w.readChunk(chunk, &tempFiles)
+		if err != nil {
+			level.Error(w.logger).Log("msg", "failed to read chunk for coalescing", "key", chunk.Key, "error", err)
+			return
+		}
+		if !group.add(chunk, records) {
+			// revisions are not contiguous, so start a new group
+			merged += w.flushCoalesceGroup(group)
+			group = &coalesceGroup{}
+			group.add(chunk, records)
+		}
+		if group.size >= targetSize {
+			merged += w.flushCoalesceGroup(group)
+			group = &coalesceGroup{}
+		}
+	}
+	merged += w.flushCoalesceGroup(group)
+
+	if merged > 0 {
+		level.Info(w.logger).Log("msg", "chunk coalescing completed", "merged_chunks", merged)
+	}
+}
+
+// readChunk downloads a chunk file and returns its records
+func (w *Worker) readChunk(chunk s3client.FileInfo, tempFiles *[]string) ([]*proto.Record, error) {
+	body, _, err := w.s3Client.DownloadFile(w.ctx, chunk.Key, chunk.Size, w.config.DataDir(), tempFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download chunk: %w", err)
+	}
+	defer body.Close()
+
+	expectedKind := proto.FileKind_KIND_CHUNK
+	reader, err := datafile.NewReaderWithDictionaries(bufio.NewReader(body), &expectedKind, w.s3Client.DictionaryLoader(w.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create datafile reader: %w", err)
+	}
+	defer reader.Release()
+	records := make([]*proto.Record, 0, reader.Count())
+	for i := int64(0); i < reader.Count(); i++ {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record %d: %w", i, err)
+		}
+		records = append(records, record)
+	}
+	if _, err = reader.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close reader: %w", err)
+	}
+	return records, nil
+}
+
+// flushCoalesceGroup writes the group's records as a single chunk file which
+// replaces the group's last chunk, then deletes the group's other chunks.
+// It returns the number of chunks merged, which is zero if the group has
+// fewer than two chunks (as there is nothing to merge) or on failure.
+func (w *Worker) flushCoalesceGroup(group *coalesceGroup) int {
+	if len(group.chunks) < 2 {
+		return 0
+	}
+	last := group.chunks[len(group.chunks)-1]
+
+	// write merged chunk file
+	buffer := &bytes.Buffer{}
+	bufWriter := bufio.NewWriter(buffer)
+	options := datafile.CompressionOptions{
+		Level:      int(w.config.ChunkCompressionLevel()),
+		WindowSize: int(w.config.ChunkCompressionWindowKB()) * 1024,
+		MinSize:    int(w.config.ChunkCompressionMinBytes()),
+	}
+	writer, err := datafile.NewWriterWithSmartCompression(bufWriter, proto.FileKind_KIND_CHUNK, group.records, w.config.InstanceID(), options)
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to create datafile writer for coalesced chunk", "error", err)
+		return 0
+	}
+	for _, record := range group.records {
+		if err = writer.Write(record); err != nil {
+			level.Error(w.logger).Log("msg", "failed to write record to coalesced chunk", "revision", record.Revision, "error", err)
+			return 0
+		}
+	}
+	if err = writer.Close(); err != nil {
+		level.Error(w.logger).Log("msg", "failed to close datafile writer for coalesced chunk", "error", err)
+		return 0
+	}
+
+	// atomically replace the last chunk, which fails if it has changed
+	revisions := s3client.RevisionRange{First: group.records[0].Revision, Last: last.Revision, Count: int64(len(group.records))}
+	err = w.s3Client.ReplaceChunkFile(w.ctx, last.Key, last.ETag, buffer, revisions)
+	if err != nil {
+		level.Warn(w.logger).Log("msg", "failed to replace chunk with coalesced chunk", "key", last.Key, "error", err)
+		return 0
+	}
+
+	// the replaced chunk now contains all records, so delete the others
+	for _, chunk := range group.chunks[:len(group.chunks)-1] {
+		if err := w.s3Client.DeleteFile(w.ctx, chunk.Key); err != nil {
+			level.Warn(w.logger).Log("msg", "failed to delete coalesced chunk file", "key", chunk.Key, "error", err)
+		}
+	}
+
+	level.Debug(w.logger).Log("msg", "coalesced chunk files", "key", last.Key, "chunks", len(group.chunks),
+		"first_revision", group.records[0].Revision, "last_revision", last.Revision)
+	return len(group.chunks)
+}
@@ -0,0 +1,57 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
+)
+
+func records(revisions ...int64) []*proto.Record {
+	var result []*proto.Record
+	for _, revision := range revisions {
+		result = append(result, &proto.Record{Revision: revision})
+	}
+	return result
+}
+
+func TestCoalesceGroupAdd(t *testing.T) {
+	group := &coalesceGroup{}
+	if !group.add(s3client.FileInfo{Key: "1", Size: 10}, records(1)) {
+		t.Fatalf("expected first chunk to be added")
+	}
+	if !group.add(s3client.FileInfo{Key: "2", Size: 10}, records(2)) {
+		t.Fatalf("expected contiguous chunk to be added")
+	}
+	// a coalesced chunk overlapping the group only adds its new records
+	if !group.add(s3client.FileInfo{Key: "4", Size: 20}, records(1, 2, 3, 4)) {
+		t.Fatalf("expected overlapping contiguous chunk to be added")
+	}
+	// a gap in revisions is rejected
+	if group.add(s3client.FileInfo{Key: "6", Size: 10}, records(6)) {
+		t.Fatalf("expected non-contiguous chunk to be rejected")
+	}
+	// as is a chunk which would make the group cover more than
+	// MaxChunkRevisions revisions
+	if group.add(s3client.FileInfo{Key: "5", Size: 10}, records(5, s3client.MaxChunkRevisions+1)) {
+		t.Fatalf("expected chunk beyond MaxChunkRevisions to be rejected")
+	}
+
+	if len(group.chunks) != 3 {
+		t.Errorf("chunks = %d, want 3", len(group.chunks))
+	}
+	if group.size != 40 {
+		t.Errorf("size = %d, want 40", group.size)
+	}
+	if len(group.records) != 4 {
+		t.Fatalf("records = %d, want 4", len(group.records))
+	}
+	for i, record := range group.records {
+		if record.Revision != int64(i+1) {
+			t.Errorf("records[%d].Revision = %d, want %d", i, record.Revision, i+1)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/datafile"
+)
+
+// trainDictionary trains a zstd dictionary from recent record values and
+// uploads it to S3, after which it is used to compress single record chunks.
+// Small objects such as Kubernetes Endpoints and Leases share most of their
+// content, so a dictionary greatly improves their compression ratio.
+func (w *Worker) trainDictionary() {
+	// Skip if S3 is not enabled
+	if w.s3Client == nil {
+		return
+	}
+
+	values, err := w.db.FindRecentValues(w.config.ChunkDictionarySamples())
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to find recent values for dictionary training", "error", err)
+		return
+	}
+
+	dictionary, err := datafile.TrainDictionary(values, int(w.config.ChunkDictionarySizeKB()*1024))
+	if err != nil {
+		level.Warn(w.logger).Log("msg", "failed to train chunk dictionary", "samples", len(values), "error", err)
+		return
+	}
+
+	if err = w.s3Client.UploadDictionary(w.ctx, dictionary); err != nil {
+		level.Error(w.logger).Log("msg", "failed to upload chunk dictionary", "id", dictionary.ID, "error", err)
+		return
+	}
+
+	level.Info(w.logger).Log("msg", "trained chunk dictionary", "id", dictionary.ID, "size", len(dictionary.Data), "samples", len(values))
+}
@@ -13,9 +13,11 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/hooks"
 	"github.com/nadrama-com/netsy/internal/config"
 	"github.com/nadrama-com/netsy/internal/datafile"
 	"github.com/nadrama-com/netsy/internal/localdb"
+	"github.com/nadrama-com/netsy/internal/progress"
 	"github.com/nadrama-com/netsy/internal/proto"
 	"github.com/nadrama-com/netsy/internal/s3client"
 )
@@ -25,6 +27,7 @@ type SnapshotRequest struct {
 	Revision   int64
 	Timestamp  time.Time
 	RecordSize int64
+	Force      bool // create a snapshot regardless of thresholds
 }
 
 // Worker handles snapshot creation in a separate goroutine
@@ -33,6 +36,9 @@ type Worker struct {
 	config    *config.Config
 	db        localdb.Database
 	s3Client  *s3client.S3Client
+	now       func() time.Time
+	// hooks are fired once snapshots are uploaded (see SetHooks), may be nil
+	hooks *hooks.Hooks
 	
 	// Channel for receiving snapshot requests
 	requestCh chan SnapshotRequest
@@ -46,9 +52,16 @@ type Worker struct {
 	// Prevents concurrent snapshot creation
 	snapshotMutex sync.Mutex
 	
-	// Context for shutdown
+	// Context for shutdown, cancelled by Stop once draining is complete
+	// or the shutdown deadline is exceeded
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// stopCh is closed by Stop to request the worker drains and exits
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	// wg tracks the worker goroutine
+	wg sync.WaitGroup
 }
 
 // NewWorker creates a new snapshot worker
@@ -60,19 +73,53 @@ func NewWorker(logger log.Logger, config *config.Config, db localdb.Database, s3
 		config:    config,
 		db:        db,
 		s3Client:  s3Client,
+		now:       time.Now,
 		requestCh: make(chan SnapshotRequest, 100), // Buffered channel to avoid blocking
 		ctx:       ctx,
 		cancel:    cancel,
+		stopCh:    make(chan struct{}),
 	}
 }
 
+// SetHooks sets the callbacks fired once snapshots are uploaded (see package
+// hooks). It must be called before Start.
+func (w *Worker) SetHooks(h *hooks.Hooks) {
+	w.hooks = h
+}
+
 // Start begins the snapshot worker goroutine
 func (w *Worker) Start() {
-	go w.run()
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run()
+	}()
 }
 
-// Stop gracefully shuts down the snapshot worker
+// Stop gracefully shuts down the snapshot worker. Queued requests are
+// processed and any in-flight snapshot is allowed to complete, up to the
+// configured shutdown timeout, after which the worker context is cancelled
+// so that in-flight S3 operations are aborted rather than left truncated.
+// Stop is safe to call concurrently and more than once.
 func (w *Worker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	timeout := time.Duration(w.config.SnapshotShutdownTimeoutSeconds()) * time.Second
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		level.Warn(w.logger).Log("msg", "snapshot worker did not stop before deadline, cancelling in-flight work", "timeout", timeout)
+		w.cancel()
+		<-done
+	}
 	w.cancel()
 }
 
@@ -93,17 +140,75 @@ func (w *Worker) RequestSnapshot(revision int64, timestamp time.Time, recordSize
 	}
 }
 
+// ForceSnapshot requests a snapshot up to the given revision regardless of
+// the configured thresholds, e.g. so that chunks can be cleaned up when
+// memory is constrained
+func (w *Worker) ForceSnapshot(revision int64) {
+	req := SnapshotRequest{
+		Revision:  revision,
+		Timestamp: w.now(),
+		Force:     true,
+	}
+
+	select {
+	case w.requestCh <- req:
+		// Request sent successfully
+	default:
+		// Channel is full, log warning but don't block
+		level.Warn(w.logger).Log("msg", "snapshot request channel full, dropping forced request", "revision", revision)
+	}
+}
+
 // run is the main worker loop
 func (w *Worker) run() {
 	level.Info(w.logger).Log("msg", "snapshot worker started")
-	
+
+	// Periodically coalesce chunks between snapshots, if enabled
+	var coalesceCh <-chan time.Time
+	if interval := w.config.ChunkCoalesceIntervalMinutes(); interval > 0 {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		coalesceCh = ticker.C
+	}
+
+	// Periodically train a dictionary for compressing small chunks, if enabled
+	var dictionaryCh <-chan time.Time
+	if interval := w.config.ChunkDictionaryIntervalMinutes(); interval > 0 {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		dictionaryCh = ticker.C
+	}
+
 	for {
 		select {
 		case <-w.ctx.Done():
 			level.Info(w.logger).Log("msg", "snapshot worker stopping")
 			return
+		case <-w.stopCh:
+			level.Info(w.logger).Log("msg", "snapshot worker stopping, draining queued requests")
+			w.drain()
+			return
 		case req := <-w.requestCh:
 			w.processRequest(req)
+		case <-coalesceCh:
+			w.coalesceChunks()
+		case <-dictionaryCh:
+			w.trainDictionary()
+		}
+	}
+}
+
+// drain processes requests which are already queued, stopping early if the
+// worker context is cancelled
+func (w *Worker) drain() {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case req := <-w.requestCh:
+			w.processRequest(req)
+		default:
+			return
 		}
 	}
 }
@@ -126,7 +231,12 @@ func (w *Worker) processRequest(req SnapshotRequest) {
 		w.lastSnapshotRevision,
 		w.lastSnapshotTime,
 	)
+	if req.Force && req.Revision > w.lastSnapshotRevision {
+		shouldCreate, reason = true, "forced"
+	}
 	
+	recordsSinceLast := req.Revision - w.lastSnapshotRevision
+	sizeSinceLast := w.cumulativeSize
 	if shouldCreate {
 		// Update state and reset cumulative size
 		w.lastSnapshotRevision = req.Revision
@@ -138,6 +248,13 @@ func (w *Worker) processRequest(req SnapshotRequest) {
 	if !shouldCreate {
 		return
 	}
+
+	// In dry-run mode, state is still reset above so that thresholds are
+	// evaluated as if the snapshot had been created
+	if w.config.SnapshotDryRun() {
+		w.logDryRun(req.Revision, reason, recordsSinceLast, sizeSinceLast)
+		return
+	}
 	
 	level.Info(w.logger).Log("msg", "snapshot thresholds met, creating snapshot",
 		"current_revision", req.Revision, "reason", reason)
@@ -145,6 +262,21 @@ func (w *Worker) processRequest(req SnapshotRequest) {
 	w.createSnapshot(req.Revision)
 }
 
+// logDryRun logs the snapshot which would have been created. The estimated
+// size is the local db size in use, as snapshots contain all records.
+func (w *Worker) logDryRun(revision int64, reason string, recordsSinceLast int64, sizeSinceLast int64) {
+	var estimatedSize int64
+	if stats, err := w.db.Size(); err != nil {
+		level.Warn(w.logger).Log("msg", "failed to get db size for snapshot dry run", "error", err)
+	} else {
+		estimatedSize = stats.SizeInUse()
+	}
+	level.Info(w.logger).Log("msg", "would create snapshot (dry run)",
+		"reason", reason, "revision", revision, "records", revision,
+		"records_since_last", recordsSinceLast, "size_since_last_bytes", sizeSinceLast,
+		"est_size_bytes", estimatedSize)
+}
+
 // shouldCreateSnapshot determines if a snapshot should be created based on thresholds
 // Returns (shouldCreate bool, reason string)
 func (w *Worker) shouldCreateSnapshot(currentRevision int64, currentTime time.Time, cumulativeSize int64, lastRevision int64, lastTime time.Time) (bool, string) {
@@ -194,7 +326,11 @@ func (w *Worker) shouldCreateSnapshot(currentRevision int64, currentTime time.Ti
 	return false, ""
 }
 
-// createSnapshot creates and uploads a snapshot file containing all records up to the specified revision
+// createSnapshot creates and uploads a snapshot containing all records up to
+// the specified revision. Snapshots whose records exceed the maximum part
+// size are uploaded as multiple parts, followed by a manifest of the parts.
+// Records are read from the database as they are written, once to plan the
+// parts and once to write them, so that they are not all held in memory.
 func (w *Worker) createSnapshot(upToRevision int64) {
 	// Acquire snapshot mutex to prevent concurrent snapshot creation
 	w.snapshotMutex.Lock()
@@ -202,23 +338,123 @@ func (w *Worker) createSnapshot(upToRevision int64) {
 
 	level.Info(w.logger).Log("msg", "starting snapshot creation", "up_to_revision", upToRevision)
 
-	// Get all non-compacted records up to the specified revision
-	records, err := w.db.FindAllRecordsForSnapshot(upToRevision)
+	// Split all non-compacted records up to the specified revision into parts
+	parts, err := w.planParts(upToRevision, w.config.SnapshotPartMaxSizeMB()*1024*1024)
 	if err != nil {
 		level.Error(w.logger).Log("msg", "failed to get records for snapshot", "error", err)
 		return
 	}
 
-	if len(records) == 0 {
+	if len(parts) == 0 {
 		level.Warn(w.logger).Log("msg", "no records found for snapshot", "up_to_revision", upToRevision)
 		return
 	}
 
+	var recordsCount int64
+	for _, part := range parts {
+		recordsCount += part.count
+	}
+	tracker := progress.Start(w.logger, "snapshot", recordsCount, 0)
+	defer tracker.Finish()
+	if len(parts) == 1 {
+		snapshotKey := s3client.SnapshotKey(upToRevision)
+		if _, err = w.uploadSnapshotFile(snapshotKey, parts[0], upToRevision, tracker); err != nil {
+			level.Error(w.logger).Log("msg", "failed to create snapshot", "key", snapshotKey, "error", err)
+			return
+		}
+		level.Info(w.logger).Log("msg", "snapshot uploaded to S3 successfully", "revision", upToRevision, "records", recordsCount, "key", snapshotKey)
+		w.hooks.FireSnapshot(hooks.Snapshot{Revision: upToRevision, Records: int(recordsCount), Parts: 1})
+		return
+	}
+
+	// Upload each part, then the manifest, which makes the snapshot visible.
+	// If the snapshot fails, the parts uploaded so far are deleted; any
+	// which are not are deleted by the retention worker.
+	level.Info(w.logger).Log("msg", "splitting snapshot into parts", "revision", upToRevision, "parts", len(parts))
+	manifest := make([]*proto.SnapshotPart, 0, len(parts))
+	for i, part := range parts {
+		partKey := s3client.SnapshotPartKey(upToRevision, i+1)
+		size, err := w.uploadSnapshotFile(partKey, part, upToRevision, tracker)
+		if err != nil {
+			level.Error(w.logger).Log("msg", "failed to create snapshot part", "key", partKey, "error", err)
+			w.deleteParts(manifest)
+			return
+		}
+		manifest = append(manifest, &proto.SnapshotPart{
+			Key:           partKey,
+			FirstRevision: part.firstRevision,
+			LastRevision:  part.lastRevision,
+			RecordsCount:  part.count,
+			Size:          size,
+		})
+	}
+	if err = w.s3Client.WriteSnapshotManifest(w.ctx, upToRevision, manifest); err != nil {
+		level.Error(w.logger).Log("msg", "failed to write snapshot manifest", "revision", upToRevision, "error", err)
+		w.deleteParts(manifest)
+		return
+	}
+
+	level.Info(w.logger).Log("msg", "multi-part snapshot uploaded to S3 successfully", "revision", upToRevision, "records", recordsCount, "parts", len(parts))
+	w.hooks.FireSnapshot(hooks.Snapshot{Revision: upToRevision, Records: int(recordsCount), Parts: len(parts)})
+
+	// Chunk files covered by the snapshot are deleted by the retention
+	// worker, once the grace period has passed
+}
+
+// deleteParts deletes the uploaded parts of a snapshot which failed
+func (w *Worker) deleteParts(parts []*proto.SnapshotPart) {
+	for _, part := range parts {
+		if err := w.s3Client.DeleteFile(w.ctx, part.Key); err != nil {
+			level.Warn(w.logger).Log("msg", "failed to delete part of failed snapshot", "key", part.Key, "error", err)
+		}
+	}
+}
+
+// snapshotPart is a range of consecutive records written to one snapshot
+// file, and their size as serialized, before compression
+type snapshotPart struct {
+	firstRevision int64
+	lastRevision  int64
+	count         int64
+	size          int64
+}
+
+// planParts splits the records up to upToRevision into parts (see
+// addToParts), reading each record without keeping it
+func (w *Worker) planParts(upToRevision int64, maxSize int64) (parts []snapshotPart, err error) {
+	err = w.db.ScanRecordsForSnapshot(0, upToRevision, func(record *proto.Record) error {
+		if err := w.ctx.Err(); err != nil {
+			return fmt.Errorf("snapshot cancelled: %w", err)
+		}
+		parts = addToParts(parts, record, maxSize)
+		return nil
+	})
+	return parts, err
+}
+
+// addToParts adds the next record to the last of parts, unless it would
+// then hold more than maxSize bytes of records (as serialized, before
+// compression), in which case it starts a new part. A single record larger
+// than maxSize is a part on its own, and records are not split if maxSize is
+// not positive.
+func addToParts(parts []snapshotPart, record *proto.Record, maxSize int64) []snapshotPart {
+	size := int64(datafile.RecordsSize([]*proto.Record{record}))
+	if n := len(parts); n > 0 && (maxSize <= 0 || parts[n-1].size+size <= maxSize) {
+		parts[n-1].lastRevision = record.Revision
+		parts[n-1].count++
+		parts[n-1].size += size
+		return parts
+	}
+	return append(parts, snapshotPart{firstRevision: record.Revision, lastRevision: record.Revision, count: 1, size: size})
+}
+
+// uploadSnapshotFile writes the records of part to a temporary snapshot
+// file, then uploads it to S3 at key, returning its size
+func (w *Worker) uploadSnapshotFile(key string, part snapshotPart, upToRevision int64, tracker *progress.Tracker) (size int64, err error) {
 	// Create temporary file for snapshot
 	tempFile, err := os.CreateTemp(w.config.DataDir(), fmt.Sprintf("snapshot_%d_*.netsy", upToRevision))
 	if err != nil {
-		level.Error(w.logger).Log("msg", "failed to create temporary snapshot file", "error", err)
-		return
+		return 0, fmt.Errorf("failed to create temporary snapshot file: %w", err)
 	}
 	tempFilePath := tempFile.Name()
 	defer func() {
@@ -229,72 +465,66 @@ func (w *Worker) createSnapshot(upToRevision int64) {
 	}()
 
 	// Write snapshot using datafile writer
-	level.Debug(w.logger).Log("msg", "writing snapshot file", "temp_file", tempFilePath, "records_count", len(records))
-	err = w.writeSnapshotFile(tempFile, records, upToRevision)
+	level.Debug(w.logger).Log("msg", "writing snapshot file", "temp_file", tempFilePath, "records_count", part.count)
+	if err = w.writeSnapshotFile(tempFile, part, tracker); err != nil {
+		return 0, fmt.Errorf("failed to write snapshot file %s: %w", tempFilePath, err)
+	}
+	info, err := tempFile.Stat()
 	if err != nil {
-		level.Error(w.logger).Log("msg", "failed to write snapshot file", "temp_file", tempFilePath, "error", err)
-		return
+		return 0, fmt.Errorf("failed to get snapshot file info: %w", err)
 	}
-	level.Debug(w.logger).Log("msg", "snapshot file written successfully", "temp_file", tempFilePath)
+	level.Debug(w.logger).Log("msg", "snapshot file written successfully", "temp_file", tempFilePath, "size", info.Size())
 
 	// Close temp file before upload
 	tempFile.Close()
 
-	// Upload snapshot to S3 (UploadFile will add the prefix)
-	snapshotKey := fmt.Sprintf("snapshots/%019d.netsy", upToRevision)
-
-	level.Info(w.logger).Log("msg", "uploading snapshot to S3", "key", snapshotKey, "file_path", tempFilePath)
-
-	err = w.s3Client.UploadFile(w.ctx, snapshotKey, tempFilePath)
-	if err != nil {
-		level.Error(w.logger).Log("msg", "failed to upload snapshot to S3", "key", snapshotKey, "file_path", tempFilePath, "error", err)
-		return
+	// Don't start the upload if the worker has been cancelled
+	if err = w.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("snapshot cancelled before upload: %w", err)
 	}
 
-	level.Info(w.logger).Log("msg", "snapshot uploaded to S3 successfully", "revision", upToRevision, "records", len(records), "key", snapshotKey)
-
-	// Start cleanup of old chunk files
-	level.Info(w.logger).Log("msg", "starting chunk file cleanup", "up_to_revision", upToRevision)
-
-	// List all chunk files that are covered by the snapshot (revision <= upToRevision)
-	chunks, err := w.s3Client.ListChunksForCleanup(w.ctx, upToRevision)
-	if err != nil {
-		level.Error(w.logger).Log("msg", "failed to list chunks for cleanup", "error", err)
-		return
-	}
-	deletedCount := 0
-	for _, chunk := range chunks {
-		err := w.s3Client.DeleteFile(w.ctx, chunk.Key)
-		if err != nil {
-			level.Warn(w.logger).Log("msg", "failed to delete chunk file", "key", chunk.Key, "error", err)
-			continue
-		}
-		deletedCount++
-		level.Debug(w.logger).Log("msg", "deleted chunk file", "key", chunk.Key, "revision", chunk.Revision)
+	// Upload snapshot to S3 (UploadFile will add the prefix)
+	level.Info(w.logger).Log("msg", "uploading snapshot to S3", "key", key, "file_path", tempFilePath)
+	revisions := s3client.RevisionRange{First: part.firstRevision, Last: part.lastRevision, Count: part.count}
+	if err = w.s3Client.UploadFile(w.ctx, key, tempFilePath, proto.FileKind_KIND_SNAPSHOT, revisions); err != nil {
+		return 0, fmt.Errorf("failed to upload snapshot to S3: %w", err)
 	}
-
-	level.Info(w.logger).Log("msg", "chunk file cleanup completed",
-		"up_to_revision", upToRevision, "deleted_chunks", deletedCount)
+	return info.Size(), nil
 }
 
-// writeSnapshotFile writes records to a snapshot file using the datafile writer
-func (w *Worker) writeSnapshotFile(file *os.File, records []*proto.Record, upToRevision int64) error {
+// writeSnapshotFile writes the records of part to a snapshot file using the
+// datafile writer, reading them from the database as they are written. If
+// records were removed since the part was planned (e.g. by tombstone
+// pruning), the count no longer matches and the snapshot fails, to be
+// retried by a later request.
+func (w *Worker) writeSnapshotFile(file *os.File, part snapshotPart, tracker *progress.Tracker) error {
 	// Create buffered writer
 	buffer := bufio.NewWriter(file)
 	defer buffer.Flush()
 
-	// Create datafile writer for snapshot
-	writer, err := datafile.NewWriter(buffer, proto.FileKind_KIND_SNAPSHOT, int64(len(records)), w.config.InstanceID())
+	// Create datafile writer for snapshot, which is always compressed
+	options := datafile.CompressionOptions{
+		Level:      int(w.config.SnapshotCompressionLevel()),
+		WindowSize: int(w.config.SnapshotCompressionWindowKB()) * 1024,
+	}
+	writer, err := datafile.NewWriterWithCompressionOptions(buffer, proto.FileKind_KIND_SNAPSHOT, part.count, w.config.InstanceID(), nil, options)
 	if err != nil {
 		return fmt.Errorf("failed to create datafile writer: %w", err)
 	}
 
 	// Write all records
-	for _, record := range records {
-		err = writer.Write(record)
-		if err != nil {
+	err = w.db.ScanRecordsForSnapshot(part.firstRevision, part.lastRevision, func(record *proto.Record) error {
+		if err := w.ctx.Err(); err != nil {
+			return fmt.Errorf("snapshot cancelled: %w", err)
+		}
+		if err := writer.Write(record); err != nil {
 			return fmt.Errorf("failed to write record %d to snapshot: %w", record.Revision, err)
 		}
+		tracker.Add(1, 0)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	// Close writer
@@ -323,7 +553,7 @@ func (w *Worker) InitializeWithSnapshot(snapshotInfo *s3client.LatestSnapshotInf
 
 	// Initialize from existing snapshot
 	w.lastSnapshotRevision = snapshotInfo.Revision
-	w.lastSnapshotTime = time.Now() // Use current time since we don't know exact creation time
+	w.lastSnapshotTime = w.now() // Use current time since we don't know exact creation time
 	w.cumulativeSize = 0 // Start tracking from zero
 
 	level.Info(w.logger).Log("msg", "initialized snapshot tracking from existing snapshot",
@@ -0,0 +1,150 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+	"github.com/nadrama-com/netsy/internal/datafile"
+	"github.com/nadrama-com/netsy/internal/localdb/localdbtest"
+	"github.com/nadrama-com/netsy/internal/proto"
+	"github.com/nadrama-com/netsy/internal/s3client"
+	"go.uber.org/goleak"
+)
+
+func TestWorkerStopDrains(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	configtest.Set(t, map[string]any{"snapshot_shutdown_timeout_seconds": 5})
+
+	w := NewWorker(log.NewNopLogger(), &config.Config{}, nil, nil)
+	w.Start()
+	for i := int64(1); i <= 10; i++ {
+		w.RequestSnapshot(i, time.Now(), 1)
+	}
+
+	// concurrent Stop calls must all return once the worker has exited
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Stop()
+		}()
+	}
+	wg.Wait()
+
+	if len(w.requestCh) != 0 {
+		t.Fatalf("expected queued requests to be drained, %d remain", len(w.requestCh))
+	}
+	if w.ctx.Err() == nil {
+		t.Fatalf("expected worker context to be cancelled after Stop")
+	}
+}
+
+func TestWorkerStopWithoutStart(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	w := NewWorker(log.NewNopLogger(), &config.Config{}, nil, nil)
+	w.Stop()
+}
+
+func TestShouldCreateSnapshotAge(t *testing.T) {
+	configtest.Set(t, map[string]any{
+		"snapshot_threshold_records":     0,
+		"snapshot_threshold_size_mb":     0,
+		"snapshot_threshold_age_minutes": 60,
+	})
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := NewWorker(log.NewNopLogger(), &config.Config{}, nil, nil)
+	w.now = func() time.Time { return now }
+	w.InitializeWithSnapshot(&s3client.LatestSnapshotInfo{Revision: 10, Found: true})
+	if !w.lastSnapshotTime.Equal(now) {
+		t.Fatalf("expected last snapshot time %v, got %v", now, w.lastSnapshotTime)
+	}
+
+	if create, _ := w.shouldCreateSnapshot(11, now.Add(59*time.Minute), 0, w.lastSnapshotRevision, w.lastSnapshotTime); create {
+		t.Fatalf("expected no snapshot before the age threshold")
+	}
+	if create, reason := w.shouldCreateSnapshot(11, now.Add(60*time.Minute), 0, w.lastSnapshotRevision, w.lastSnapshotTime); !create || reason != "age" {
+		t.Fatalf("expected an age snapshot at the threshold, got %v %q", create, reason)
+	}
+	// no snapshot without new records, however old the last one is
+	if create, _ := w.shouldCreateSnapshot(10, now.Add(2*time.Hour), 0, w.lastSnapshotRevision, w.lastSnapshotTime); create {
+		t.Fatalf("expected no snapshot without new records")
+	}
+}
+
+func TestProcessRequestDryRun(t *testing.T) {
+	configtest.Set(t, map[string]any{"snapshot_threshold_records": 5, "snapshot_dry_run": true})
+
+	db := localdbtest.New(t)
+	var logs bytes.Buffer
+	// the S3 client is never used, as no snapshot is created
+	w := NewWorker(log.NewLogfmtLogger(&logs), &config.Config{}, db, &s3client.S3Client{})
+	now := time.Now()
+	for revision := int64(1); revision <= 4; revision++ {
+		w.processRequest(SnapshotRequest{Revision: revision, Timestamp: now, RecordSize: 10})
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("expected nothing logged below the thresholds, got %s", logs.String())
+	}
+
+	w.processRequest(SnapshotRequest{Revision: 5, Timestamp: now, RecordSize: 10})
+	logged := logs.String()
+	for _, expected := range []string{`msg="would create snapshot (dry run)"`, "reason=record_count", "revision=5", "size_since_last_bytes=50"} {
+		if !strings.Contains(logged, expected) {
+			t.Errorf("expected dry run log to contain %s, got %s", expected, logged)
+		}
+	}
+	// thresholds are evaluated as if the snapshot had been created
+	if w.lastSnapshotRevision != 5 || w.cumulativeSize != 0 {
+		t.Errorf("expected state to be reset at revision 5, got revision %d size %d", w.lastSnapshotRevision, w.cumulativeSize)
+	}
+}
+
+func TestAddToParts(t *testing.T) {
+	var records []*proto.Record
+	for revision := int64(1); revision <= 10; revision++ {
+		records = append(records, &proto.Record{Revision: revision, Key: []byte("key"), Value: make([]byte, 100)})
+	}
+	recordSize := int64(datafile.RecordsSize(records[:1]))
+	split := func(maxSize int64) (parts []snapshotPart) {
+		for _, record := range records {
+			parts = addToParts(parts, record, maxSize)
+		}
+		return parts
+	}
+
+	// parts hold as many records as fit, in order
+	parts := split(3 * recordSize)
+	if len(parts) != 4 {
+		t.Fatalf("expected 4 parts, got %d", len(parts))
+	}
+	var next int64 = 1
+	for i, part := range parts {
+		if part.count != 3 && i != len(parts)-1 {
+			t.Errorf("part %d has %d records, want 3", i, part.count)
+		}
+		if part.firstRevision != next || part.lastRevision != next+part.count-1 || part.size != part.count*recordSize {
+			t.Fatalf("part %d has revisions %d to %d of size %d, want %d onwards", i, part.firstRevision, part.lastRevision, part.size, next)
+		}
+		next += part.count
+	}
+
+	// records larger than the maximum size are a part on their own, and
+	// records are not split without a maximum size
+	if parts = split(1); len(parts) != 10 {
+		t.Errorf("expected a part per record, got %d parts", len(parts))
+	}
+	if parts = split(0); len(parts) != 1 || parts[0].count != 10 {
+		t.Errorf("expected a single part, got %d parts", len(parts))
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package transform
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrInvalidSignature is returned when decoding a value whose signature does
+// not match its key and value, i.e. which was modified (or moved from
+// another key) other than by netsy
+var ErrInvalidSignature = errors.New("invalid value signature")
+
+// zstdMaxDecodedSize bounds the memory used to decompress a value, as values
+// are limited to well below this by clients such as the kube-apiserver
+const zstdMaxDecodedSize = 64 * 1024 * 1024
+
+// Zstd compresses values with zstd
+type Zstd struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewZstd returns a Zstd transformer
+func NewZstd() (*Zstd, error) {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(zstdMaxDecodedSize))
+	if err != nil {
+		return nil, err
+	}
+	return &Zstd{encoder: encoder, decoder: decoder}, nil
+}
+
+func (z *Zstd) Name() string { return TransformerZstd }
+
+func (z *Zstd) Encode(key, value []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(value, nil), nil
+}
+
+func (z *Zstd) Decode(key, value []byte) ([]byte, error) {
+	return z.decoder.DecodeAll(value, nil)
+}
+
+// AESGCM encrypts values with AES-256-GCM, authenticating the key as
+// additional data so that an encrypted value cannot be moved to another key.
+// Encoded values are a random nonce followed by the ciphertext.
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM returns an AESGCM transformer using a 32 byte AES-256 key
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("expected a 32 byte key, got %d bytes", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+func (a *AESGCM) Name() string { return TransformerAESGCM }
+
+func (a *AESGCM) Encode(key, value []byte) ([]byte, error) {
+	nonce := make([]byte, a.aead.NonceSize(), a.aead.NonceSize()+len(value)+a.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return a.aead.Seal(nonce, nonce, value, key), nil
+}
+
+func (a *AESGCM) Decode(key, value []byte) ([]byte, error) {
+	if len(value) < a.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted value is too short")
+	}
+	nonce, ciphertext := value[:a.aead.NonceSize()], value[a.aead.NonceSize():]
+	return a.aead.Open(nil, nonce, ciphertext, key)
+}
+
+// HMACSHA256 signs values with HMAC-SHA256 of their key and value, so that
+// values modified other than by netsy (e.g. by editing the local db or S3
+// directly) are rejected as they are read. Values without the transformer's
+// prefix are only rejected by a strict Chain, which New requires. Encoded
+// values are the signature followed by the value, which is not encrypted.
+type HMACSHA256 struct {
+	key []byte
+}
+
+// NewHMACSHA256 returns an HMACSHA256 transformer signing with key, which
+// should be at least 32 bytes
+func NewHMACSHA256(key []byte) (*HMACSHA256, error) {
+	if len(key) < 32 {
+		return nil, fmt.Errorf("expected a key of at least 32 bytes, got %d bytes", len(key))
+	}
+	return &HMACSHA256{key: key}, nil
+}
+
+func (h *HMACSHA256) Name() string { return TransformerHMACSHA256 }
+
+func (h *HMACSHA256) Encode(key, value []byte) ([]byte, error) {
+	return append(h.sign(key, value), value...), nil
+}
+
+func (h *HMACSHA256) Decode(key, value []byte) ([]byte, error) {
+	if len(value) < sha256.Size {
+		return nil, ErrInvalidSignature
+	}
+	signature, signed := value[:sha256.Size], value[sha256.Size:]
+	if !hmac.Equal(signature, h.sign(key, signed)) {
+		return nil, ErrInvalidSignature
+	}
+	return signed, nil
+}
+
+// sign returns the signature of value for key. The key's length is signed,
+// so that the boundary between the key and value cannot be moved.
+func (h *HMACSHA256) sign(key, value []byte) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(len(key))))
+	mac.Write(key)
+	mac.Write(value)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+// Package transform transforms record values as they are written and read,
+// e.g. to compress, encrypt or sign them. The leader encodes the value of
+// each record it writes with the configured Chain, so values are stored
+// transformed in the local db and S3 and replicated transformed, and values
+// are decoded as they are sent to clients. Other transformations (e.g. KMS
+// envelope encryption) implement Transformer (and are added in New) without
+// changing the write or read paths.
+package transform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/keys"
+	"github.com/nadrama-com/netsy/internal/metrics"
+)
+
+// Transformer transforms a value, and reverses the transformation. Both are
+// given the value's key, so that a value can be bound to its key (e.g. so a
+// signed value cannot be copied to another key).
+type Transformer interface {
+	// Name identifies the transformer in config, and in the prefix of the
+	// values it transforms
+	Name() string
+	// Encode transforms the value of key as it is written
+	Encode(key, value []byte) ([]byte, error)
+	// Decode reverses Encode for the value of key as it is read
+	Decode(key, value []byte) ([]byte, error)
+}
+
+// ErrUntransformed is returned by a strict Chain when decoding a value which
+// was not transformed by one of its transformers
+var ErrUntransformed = errors.New("value was not transformed")
+
+// Transformers for New
+const (
+	TransformerZstd       = "zstd"
+	TransformerAESGCM     = "aes-gcm"
+	TransformerHMACSHA256 = "hmac-sha256"
+)
+
+// Chain applies transformers to values in order as they are written, and in
+// reverse order as they are read. Each transformed value is prefixed with
+// the transformer's name, so that values written before a transformer was
+// added to the chain can still be read. The zero Chain leaves values as-is.
+type Chain struct {
+	transformers []Transformer
+	// strict rejects values which were not transformed by every
+	// transformer, rather than reading them as-is
+	strict bool
+}
+
+// NewChain returns a Chain of transformers
+func NewChain(strict bool, transformers ...Transformer) Chain {
+	return Chain{transformers: transformers, strict: strict}
+}
+
+// New returns the Chain of the configured value transformers. The aes-gcm
+// and hmac-sha256 transformers require value_transform_strict (see
+// config.RequiresStrictValueTransform).
+func New(conf *config.Config) (chain Chain, err error) {
+	chain.strict = conf.ValueTransformStrict()
+	if config.RequiresStrictValueTransform(conf.ValueTransformers()) && !chain.strict {
+		return chain, fmt.Errorf("value_transform_strict is required for the %s and %s value transformers", TransformerAESGCM, TransformerHMACSHA256)
+	}
+	for _, name := range strings.Split(conf.ValueTransformers(), ",") {
+		var transformer Transformer
+		switch name = strings.TrimSpace(name); name {
+		case "":
+			continue
+		case TransformerZstd:
+			transformer, err = NewZstd()
+		case TransformerAESGCM:
+			var key []byte
+			if key, err = readKeyFile(conf.ValueEncryptionKeyFile(), "value_encryption_key_file"); err == nil {
+				transformer, err = NewAESGCM(key)
+			}
+		case TransformerHMACSHA256:
+			var key []byte
+			if key, err = readKeyFile(conf.ValueHMACKeyFile(), "value_hmac_key_file"); err == nil {
+				transformer, err = NewHMACSHA256(key)
+			}
+		default:
+			err = fmt.Errorf("expected %s, %s or %s", TransformerZstd, TransformerAESGCM, TransformerHMACSHA256)
+		}
+		if err != nil {
+			return chain, fmt.Errorf("invalid value transformer %q: %w", name, err)
+		}
+		chain.transformers = append(chain.transformers, transformer)
+	}
+	return chain, nil
+}
+
+// readKeyFile reads the base64 encoded key in path, configured by setting
+func readKeyFile(path string, setting string) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%s is required", setting)
+	}
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", setting, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", setting, err)
+	}
+	return key, nil
+}
+
+// Enabled returns true if the chain has any transformers
+func (c Chain) Enabled() bool {
+	return len(c.transformers) > 0
+}
+
+// Encode transforms the value of key by each transformer in order
+func (c Chain) Encode(key, value []byte) (encoded []byte, err error) {
+	encoded = value
+	for _, t := range c.transformers {
+		if encoded, err = t.Encode(key, encoded); err != nil {
+			metrics.ValueTransformErrors.WithLabelValues(t.Name(), "encode").Inc()
+			return nil, fmt.Errorf("failed to %s encode value of key %s: %w", t.Name(), keys.Quote(key), err)
+		}
+		encoded = append(prefix(t), encoded...)
+	}
+	return encoded, nil
+}
+
+// Decode reverses Encode, decoding the value of key by each transformer in
+// reverse order. Unless the chain is strict, values which were not
+// transformed by a transformer (i.e. do not have its prefix) are passed to
+// the next as-is.
+func (c Chain) Decode(key, value []byte) (decoded []byte, err error) {
+	decoded = value
+	for i := len(c.transformers) - 1; i >= 0; i-- {
+		t := c.transformers[i]
+		transformed, ok := bytes.CutPrefix(decoded, prefix(t))
+		if !ok {
+			if c.strict {
+				metrics.ValueTransformErrors.WithLabelValues(t.Name(), "decode").Inc()
+				return nil, fmt.Errorf("value of key %s: %w by %s", keys.Quote(key), ErrUntransformed, t.Name())
+			}
+			continue
+		}
+		if decoded, err = t.Decode(key, transformed); err != nil {
+			metrics.ValueTransformErrors.WithLabelValues(t.Name(), "decode").Inc()
+			return nil, fmt.Errorf("failed to %s decode value of key %s: %w", t.Name(), keys.Quote(key), err)
+		}
+	}
+	return decoded, nil
+}
+
+// prefix returns the prefix of values transformed by t
+func prefix(t Transformer) []byte {
+	return []byte("netsy:" + t.Name() + ":")
+}
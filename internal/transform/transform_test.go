@@ -0,0 +1,113 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package transform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nadrama-com/netsy/internal/config"
+	"github.com/nadrama-com/netsy/internal/config/configtest"
+)
+
+// testKeySettings returns the settings of keys in files, as they would be
+// configured by an operator
+func testKeySettings(t *testing.T) map[string]any {
+	t.Helper()
+	dir := t.TempDir()
+	writeKey := func(name string, key []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return path
+	}
+	return map[string]any{
+		"value_encryption_key_file": writeKey("encryption.key", bytes.Repeat([]byte{1}, 32)),
+		"value_hmac_key_file":       writeKey("hmac.key", bytes.Repeat([]byte{2}, 32)),
+	}
+}
+
+// newTestChain returns a strict chain of all built-in transformers
+func newTestChain(t *testing.T) Chain {
+	t.Helper()
+	settings := testKeySettings(t)
+	settings["value_transformers"] = "zstd, aes-gcm, hmac-sha256"
+	settings["value_transform_strict"] = true
+	configtest.Set(t, settings)
+	chain, err := New(&config.Config{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return chain
+}
+
+func TestChain(t *testing.T) {
+	chain := newTestChain(t)
+	key, value := []byte("/registry/secrets/default/a"), bytes.Repeat([]byte("secret"), 100)
+	encoded, err := chain.Encode(key, value)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if !bytes.HasPrefix(encoded, []byte("netsy:hmac-sha256:")) || bytes.Contains(encoded, []byte("secret")) {
+		t.Fatalf("expected value to be signed and encrypted, got %q", encoded)
+	}
+	decoded, err := chain.Decode(key, encoded)
+	if err != nil || !bytes.Equal(decoded, value) {
+		t.Fatalf("expected value to be decoded, got %q (%v)", decoded, err)
+	}
+
+	// values moved to another key or modified are rejected
+	if _, err = chain.Decode([]byte("/registry/secrets/default/b"), encoded); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for value of another key, got %v", err)
+	}
+	modified := bytes.Clone(encoded)
+	modified[len(modified)-1] ^= 1
+	if _, err = chain.Decode(key, modified); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature for modified value, got %v", err)
+	}
+
+	// values which were not transformed are rejected, as the chain is strict
+	if _, err = chain.Decode(key, []byte("plain")); !errors.Is(err, ErrUntransformed) {
+		t.Fatalf("expected ErrUntransformed, got %v", err)
+	}
+	// unless the chain is not strict, in which case values written before
+	// the transformers were configured are read as-is
+	zstd, err := NewZstd()
+	if err != nil {
+		t.Fatalf("NewZstd: %v", err)
+	}
+	if decoded, err = NewChain(false, zstd).Decode(key, []byte("plain")); err != nil || string(decoded) != "plain" {
+		t.Fatalf("expected untransformed value to be read as-is, got %q (%v)", decoded, err)
+	}
+
+	// the zero chain leaves values as-is
+	if encoded, err = (Chain{}).Encode(key, value); err != nil || !bytes.Equal(encoded, value) {
+		t.Fatalf("expected zero chain not to transform value, got %q (%v)", encoded, err)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, settings := range []map[string]any{
+		{"value_transformers": "rot13"},
+		{"value_transformers": "aes-gcm", "value_encryption_key_file": "", "value_transform_strict": true},
+		{"value_transformers": "hmac-sha256", "value_hmac_key_file": "/nonexistent", "value_transform_strict": true},
+		// values must be read strictly to be protected
+		{"value_transformers": "aes-gcm", "value_transform_strict": false},
+		{"value_transformers": "zstd, hmac-sha256", "value_transform_strict": false},
+	} {
+		t.Run(fmt.Sprint(settings), func(t *testing.T) {
+			configtest.Set(t, testKeySettings(t))
+			configtest.Set(t, settings)
+			if _, err := New(&config.Config{}); err == nil {
+				t.Errorf("expected error for %v", settings)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package watchdog
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readRSS returns the resident set size of this process in bytes
+func readRSS() (uint64, error) {
+	// statm fields are measured in pages: size resident shared ...
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, strconv.ErrSyntax
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
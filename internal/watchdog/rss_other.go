@@ -0,0 +1,36 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package watchdog
+
+import (
+	"fmt"
+	"runtime/metrics"
+)
+
+const (
+	// totalMetric is the runtime/metrics name for all memory mapped by the
+	// Go runtime
+	totalMetric = "/memory/classes/total:bytes"
+	// releasedMetric is the runtime/metrics name for heap memory the Go
+	// runtime has returned to the OS
+	releasedMetric = "/memory/classes/heap/released:bytes"
+)
+
+// readRSS returns an estimate of the resident set size of this process in
+// bytes, as there is no /proc to read it from on macOS and Windows: the
+// memory mapped by the Go runtime, less what it has returned to the OS.
+// Memory allocated outside of the Go runtime, e.g. by SQLite, is not
+// included.
+func readRSS() (uint64, error) {
+	samples := []metrics.Sample{{Name: totalMetric}, {Name: releasedMetric}}
+	metrics.Read(samples)
+	for _, sample := range samples {
+		if sample.Value.Kind() != metrics.KindUint64 {
+			return 0, fmt.Errorf("runtime metric %s is not supported", sample.Name)
+		}
+	}
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64(), nil
+}
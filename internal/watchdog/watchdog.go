@@ -0,0 +1,184 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package watchdog
+
+import (
+	"context"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/nadrama-com/netsy/internal/config"
+	netsymetrics "github.com/nadrama-com/netsy/internal/metrics"
+)
+
+// checkInterval is how often memory usage is sampled
+const checkInterval = 5 * time.Second
+
+// heapMetric is the runtime/metrics name for bytes occupied by live and
+// not-yet-swept heap objects
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// Level is a degradation level. Higher levels shed more load.
+type Level int32
+
+const (
+	// LevelNormal means memory usage is below the soft limit
+	LevelNormal Level = iota
+	// LevelElevated means memory usage is above the soft limit, and new
+	// watches are rejected
+	LevelElevated
+	// LevelCritical means memory usage is above the hard limit, and in
+	// addition a snapshot is forced so that chunks can be cleaned up
+	LevelCritical
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelNormal:
+		return "normal"
+	case LevelElevated:
+		return "elevated"
+	case LevelCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// Watchdog periodically samples process RSS and Go heap size, and sets the
+// degradation level based on the configured soft and hard limits. Other
+// components check Level before accepting new work, and may register with
+// OnLevelChange to release memory when the level increases.
+type Watchdog struct {
+	logger    log.Logger
+	softLimit uint64 // bytes, 0 = disabled
+	hardLimit uint64 // bytes, 0 = disabled
+
+	level atomic.Int32
+
+	handlersMutex sync.Mutex
+	handlers      []func(Level)
+
+	// Context for shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks the watchdog goroutine
+	wg sync.WaitGroup
+}
+
+// New creates a new memory watchdog
+func New(logger log.Logger, config *config.Config) *Watchdog {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Watchdog{
+		logger:    logger,
+		softLimit: uint64(config.MemorySoftLimitMB()) * 1024 * 1024,
+		hardLimit: uint64(config.MemoryHardLimitMB()) * 1024 * 1024,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Start begins the watchdog goroutine
+func (w *Watchdog) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run()
+	}()
+}
+
+// Stop shuts down the watchdog, waiting for the watchdog goroutine to exit
+func (w *Watchdog) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+// Level returns the current degradation level.
+// A nil Watchdog always returns LevelNormal.
+func (w *Watchdog) Level() Level {
+	if w == nil {
+		return LevelNormal
+	}
+	return Level(w.level.Load())
+}
+
+// OnLevelChange registers fn to be invoked (from the watchdog goroutine)
+// whenever the degradation level changes
+func (w *Watchdog) OnLevelChange(fn func(Level)) {
+	w.handlersMutex.Lock()
+	defer w.handlersMutex.Unlock()
+	w.handlers = append(w.handlers, fn)
+}
+
+// run is the main watchdog loop
+func (w *Watchdog) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		w.check()
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check samples memory usage and updates the degradation level
+func (w *Watchdog) check() {
+	rss, err := readRSS()
+	if err != nil {
+		level.Debug(w.logger).Log("msg", "unable to read process RSS", "err", err)
+	}
+	heap := readHeap()
+	netsymetrics.MemoryRSSBytes.Set(float64(rss))
+	netsymetrics.MemoryHeapBytes.Set(float64(heap))
+
+	newLevel := levelFor(rss, heap, w.softLimit, w.hardLimit)
+	oldLevel := Level(w.level.Swap(int32(newLevel)))
+	netsymetrics.MemoryDegradationLevel.Set(float64(newLevel))
+	if newLevel == oldLevel {
+		return
+	}
+
+	level.Warn(w.logger).Log("msg", "memory degradation level changed",
+		"from", oldLevel, "to", newLevel, "rss_bytes", rss, "heap_bytes", heap)
+	if newLevel > oldLevel {
+		// return as much memory as possible to the OS
+		debug.FreeOSMemory()
+	}
+	w.handlersMutex.Lock()
+	handlers := w.handlers
+	w.handlersMutex.Unlock()
+	for _, fn := range handlers {
+		fn(newLevel)
+	}
+}
+
+// levelFor returns the degradation level for the given memory usage.
+// Limits of zero are disabled.
+func levelFor(rss uint64, heap uint64, softLimit uint64, hardLimit uint64) Level {
+	used := max(rss, heap)
+	if hardLimit > 0 && used >= hardLimit {
+		return LevelCritical
+	}
+	if softLimit > 0 && used >= softLimit {
+		return LevelElevated
+	}
+	return LevelNormal
+}
+
+// readHeap returns the number of bytes used by heap objects
+func readHeap() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 Nadrama Pty Ltd
+// SPDX-License-Identifier: Apache-2.0
+
+package watchdog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/nadrama-com/netsy/internal/config"
+	"go.uber.org/goleak"
+)
+
+func TestLevelFor(t *testing.T) {
+	tests := []struct {
+		rss, heap, soft, hard uint64
+		expect                Level
+	}{
+		// limits disabled
+		{1000, 1000, 0, 0, LevelNormal},
+		// below soft limit
+		{99, 50, 100, 200, LevelNormal},
+		// rss or heap at/above soft limit
+		{100, 50, 100, 200, LevelElevated},
+		{50, 150, 100, 200, LevelElevated},
+		// rss or heap at/above hard limit
+		{200, 50, 100, 200, LevelCritical},
+		{50, 250, 100, 200, LevelCritical},
+		// only hard limit set
+		{150, 50, 0, 200, LevelNormal},
+		{250, 50, 0, 200, LevelCritical},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			result := levelFor(test.rss, test.heap, test.soft, test.hard)
+			if result != test.expect {
+				t.Errorf("levelFor(%d, %d, %d, %d) = %s, want %s", test.rss, test.heap, test.soft, test.hard, result, test.expect)
+			}
+		})
+	}
+}
+
+func TestNilWatchdogLevel(t *testing.T) {
+	var w *Watchdog
+	if level := w.Level(); level != LevelNormal {
+		t.Errorf("nil Watchdog Level() = %s, want %s", level, LevelNormal)
+	}
+}
+
+func TestWatchdogStop(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	w := New(log.NewNopLogger(), &config.Config{})
+	w.Start()
+	w.Stop()
+}
+
+func TestReadRSS(t *testing.T) {
+	rss, err := readRSS()
+	if err != nil {
+		t.Fatalf("readRSS: %v", err)
+	}
+	if rss == 0 {
+		t.Errorf("expected a non-zero RSS")
+	}
+}